@@ -0,0 +1,170 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// MalformedArgumentsPolicy 工具调用的参数不是有效的JSON时的处理策略
+type MalformedArgumentsPolicy int
+
+const (
+	// MalformedArgumentsRepair 默认策略，去掉代码块、参数前后的文字和多余的逗号后重新解析，仍无法解析时让模型重新发送
+	MalformedArgumentsRepair MalformedArgumentsPolicy = iota
+	// MalformedArgumentsResend 不修复，以工具结果告诉模型参数无效并让模型重新发送
+	MalformedArgumentsResend
+	// MalformedArgumentsFail 返回错误并中止对话（开启RecoverToolErrors时错误作为工具结果返回）
+	MalformedArgumentsFail
+)
+
+// maxRawArgumentsInResult 让模型重新发送时在工具结果中附带的原始参数的最大长度
+const maxRawArgumentsInResult = 1000
+
+// SetMalformedArgumentsPolicy 设置工具调用的参数不是有效的JSON时的处理策略
+// 无论哪种策略，原始参数都保存在历史中工具调用的RawArguments里，无法修复时Arguments替换为{}，保证之后的请求可以正常发送
+func (cm *ConversationManager) SetMalformedArgumentsPolicy(policy MalformedArgumentsPolicy) {
+	cm.malformedArguments = policy
+}
+
+// checkToolArguments 在回复加入历史前检查工具调用的参数，按策略修复无效的参数并保留原始参数
+func (cm *ConversationManager) checkToolArguments(msg general.Message) general.Message {
+	var toolCalls []general.ToolCall
+	for i, toolCall := range msg.ToolCalls {
+		if fixed, ok := cm.fixToolCall(toolCall); ok {
+			if toolCalls == nil {
+				toolCalls = append([]general.ToolCall(nil), msg.ToolCalls...)
+			}
+			toolCalls[i] = fixed
+		}
+	}
+	if toolCalls != nil {
+		msg.ToolCalls = toolCalls
+	}
+
+	var contents []general.Content
+	for i, content := range msg.Content {
+		if content.ToolCall == nil {
+			continue
+		}
+		if fixed, ok := cm.fixToolCall(*content.ToolCall); ok {
+			if contents == nil {
+				contents = append([]general.Content(nil), msg.Content...)
+			}
+			contents[i].ToolCall = &fixed
+		}
+	}
+	if contents != nil {
+		msg.Content = contents
+	}
+	return msg
+}
+
+// fixToolCall 参数无效时返回修复后的工具调用，参数有效时返回false
+func (cm *ConversationManager) fixToolCall(toolCall general.ToolCall) (general.ToolCall, bool) {
+	raw := strings.TrimSpace(string(toolCall.Function.Arguments))
+	// 参数字符串不是有效JSON时OpenAI等客户端将其作为JSON字符串返回，DeepSeek的参数本身就是JSON字符串
+	var unquoted string
+	if json.Unmarshal([]byte(raw), &unquoted) == nil {
+		if unquoted = strings.TrimSpace(unquoted); unquoted != "" && json.Valid([]byte(unquoted)) {
+			return toolCall, false
+		}
+		raw = unquoted
+	} else if raw != "" && json.Valid([]byte(raw)) {
+		return toolCall, false
+	}
+	toolCall.Function.RawArguments = raw
+	if arguments, ok := cm.rescueArguments(toolCall.Function.RawArguments); ok {
+		toolCall.Function.Arguments = arguments
+	} else {
+		toolCall.Function.Arguments = json.RawMessage("{}")
+	}
+	return toolCall, true
+}
+
+// rescueArguments 按策略修复参数，策略不允许修复或无法修复时返回false
+func (cm *ConversationManager) rescueArguments(raw string) (json.RawMessage, bool) {
+	if cm.malformedArguments != MalformedArgumentsRepair {
+		return nil, false
+	}
+	return repairArguments(raw)
+}
+
+// handleMalformedArguments 处理无法修复的参数，toolCall的参数已经过checkToolArguments检查时才会处理，返回false表示参数有效
+func (cm *ConversationManager) handleMalformedArguments(ctx context.Context, toolCall general.ToolCall, info_chan chan general.Message) (bool, error) {
+	raw := toolCall.Function.RawArguments
+	if raw == "" {
+		return false, nil
+	}
+	if _, ok := cm.rescueArguments(raw); ok {
+		return false, nil
+	}
+	if cm.malformedArguments == MalformedArgumentsFail {
+		return true, fmt.Errorf("工具 %s 的参数不是有效的JSON: %s", toolCall.Function.Name, raw)
+	}
+	if len(raw) > maxRawArgumentsInResult {
+		raw = raw[:maxRawArgumentsInResult] + "..."
+	}
+	cm.appendToolResult(ctx, toolCall, cm.text(MsgMalformedArguments, toolCall.Function.Name, raw), info_chan)
+	return true, nil
+}
+
+// repairArguments 修复常见的参数格式问题：空参数、被序列化为字符串的JSON、markdown代码块、参数前后的文字和多余的逗号
+// 修复后必须是JSON对象
+func repairArguments(raw string) (json.RawMessage, bool) {
+	text := strings.TrimSpace(raw)
+	if text == "" {
+		return json.RawMessage("{}"), true
+	}
+	var unquoted string
+	if json.Unmarshal([]byte(text), &unquoted) == nil {
+		text = strings.TrimSpace(unquoted)
+	}
+	if match := reactFencePattern.FindStringSubmatch(text); match != nil {
+		text = match[1]
+	}
+	if start, end := strings.Index(text, "{"), strings.LastIndex(text, "}"); start >= 0 && end > start {
+		text = text[start : end+1]
+	}
+	text = removeTrailingCommas(text)
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &object); err != nil || object == nil {
+		return nil, false
+	}
+	return json.RawMessage(text), true
+}
+
+// removeTrailingCommas 删除对象和数组最后一个元素后的逗号，忽略字符串中的内容
+func removeTrailingCommas(text string) string {
+	var b strings.Builder
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if c == '"' {
+			inString = true
+		} else if c == ',' {
+			next := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if next != "" && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// AskUserToolName 内置提问工具的名称
+const AskUserToolName = "ask_user"
+
+// pendingQuestions ask_user工具等待回答的问题
+type pendingQuestions struct {
+	mu      sync.Mutex
+	answers map[string]chan string // 工具调用ID -> 回答通道
+}
+
+// SetAskUser 设置是否启用内置的ask_user工具
+// 启用后模型可以在需要澄清时向用户提问：工具循环暂停并通过事件通道发送EventQuestion事件，
+// 调用方通过AnswerQuestion提交回答后继续对话。需要先通过SetEventChannel设置事件通道或通过Subscribe订阅事件
+func (cm *ConversationManager) SetAskUser(enable bool) {
+	if !enable {
+		if cm.questions == nil {
+			return
+		}
+		cm.questions = nil
+		cm.removeTool(AskUserToolName)
+		return
+	}
+	if cm.questions != nil {
+		return
+	}
+
+	cm.questions = &pendingQuestions{answers: make(map[string]chan string)}
+	tool := general.Tool{
+		Type: "function",
+		Function: general.FunctionDefinition{
+			Name:        AskUserToolName,
+			Description: cm.text(MsgAskUserDescription),
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"question": map[string]interface{}{
+						"type":        "string",
+						"description": cm.text(MsgAskUserQuestion),
+					},
+				},
+				"required": []string{"question"},
+			},
+		},
+	}
+	cm.funcSchemas[AskUserToolName] = tool
+	cm.tools = append(cm.tools, tool)
+}
+
+// AnswerQuestion 回答EventQuestion事件中的问题，toolCallID为事件中ToolCall的ID
+func (cm *ConversationManager) AnswerQuestion(toolCallID string, answer string) error {
+	questions := cm.questions
+	if questions == nil {
+		return fmt.Errorf("未启用ask_user工具")
+	}
+
+	questions.mu.Lock()
+	defer questions.mu.Unlock()
+	ch, ok := questions.answers[toolCallID]
+	if !ok {
+		return fmt.Errorf("没有等待回答的问题: %s", toolCallID)
+	}
+	delete(questions.answers, toolCallID)
+	ch <- answer
+	return nil
+}
+
+// PendingQuestions 获取等待回答的问题对应的工具调用ID
+func (cm *ConversationManager) PendingQuestions() []string {
+	questions := cm.questions
+	if questions == nil {
+		return nil
+	}
+
+	questions.mu.Lock()
+	defer questions.mu.Unlock()
+	ids := make([]string, 0, len(questions.answers))
+	for id := range questions.answers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// askUser 执行ask_user工具调用：发送EventQuestion事件并等待回答，上下文取消时返回错误
+func (cm *ConversationManager) askUser(ctx context.Context, toolCall general.ToolCall) (string, error) {
+	var args struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal(toolCall.Function.Arguments, &args); err != nil {
+		// 兼容参数为JSON字符串的格式（DeepSeek格式）
+		var argsStr string
+		if err2 := json.Unmarshal(toolCall.Function.Arguments, &argsStr); err2 != nil || json.Unmarshal([]byte(argsStr), &args) != nil {
+			return cm.text(MsgParseArgumentsFailed, err), nil
+		}
+	}
+	question := strings.TrimSpace(args.Question)
+	if question == "" {
+		return cm.text(MsgAskUserEmptyQuestion), nil
+	}
+	if !cm.observed() {
+		return cm.text(MsgAskUserUnavailable), nil
+	}
+
+	id := toolCall.ID
+	if id == "" {
+		id = newMessageID()
+		toolCall.ID = id
+	}
+	ch := make(chan string, 1)
+	questions := cm.questions
+	questions.mu.Lock()
+	questions.answers[id] = ch
+	questions.mu.Unlock()
+
+	cm.emit(Event{Type: EventQuestion, Role: general.RoleAssistant, ToolCall: &toolCall, Question: question})
+
+	select {
+	case answer := <-ch:
+		return answer, nil
+	case <-ctx.Done():
+		questions.mu.Lock()
+		delete(questions.answers, id)
+		questions.mu.Unlock()
+		return "", fmt.Errorf("等待用户回答时上下文取消: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,154 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// 附件大小限制（字节）
+const (
+	MaxImageAttachmentSize    = 20 << 20
+	MaxDocumentAttachmentSize = 32 << 20
+	MaxAudioAttachmentSize    = 25 << 20
+)
+
+// audioFormats 音频MIME类型到音频格式的映射
+var audioFormats = map[string]string{
+	"audio/wav":   "wav",
+	"audio/wave":  "wav",
+	"audio/x-wav": "wav",
+	"audio/mpeg":  "mp3",
+	"audio/mp3":   "mp3",
+}
+
+// AttachFile 读取本地文件作为附件，随下一次Chat调用发送
+func (cm *ConversationManager) AttachFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cm.errorf(err, MsgErrReadAttachment, err)
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	return cm.attach(filepath.Base(path), data, mimeType)
+}
+
+// AttachBytes 添加内存中的数据作为附件，mimeType为空时根据数据内容推断
+func (cm *ConversationManager) AttachBytes(data []byte, mimeType string) error {
+	return cm.attach("", data, mimeType)
+}
+
+// ClearAttachments 清空尚未发送的附件
+func (cm *ConversationManager) ClearAttachments() {
+	cm.attachments = nil
+}
+
+// attach 根据MIME类型将附件转换为对应的内容项（图片、文档、音频或文本）
+func (cm *ConversationManager) attach(name string, data []byte, mimeType string) error {
+	if len(data) == 0 {
+		return cm.errorf(nil, MsgErrEmptyAttachment)
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+
+	var content general.Content
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		imageData, imageType, err := prepareImage(data, mimeType, cm.Locale())
+		if err != nil {
+			return err
+		}
+		content = general.Content{
+			Type: general.ContentTypeImageURL,
+			ImageURL: &general.ImageURL{
+				URL:    "data:" + imageType + ";base64," + base64.StdEncoding.EncodeToString(imageData),
+				Detail: cm.imageDetail(),
+			},
+		}
+
+	case strings.HasPrefix(mimeType, "audio/"):
+		format, ok := audioFormats[mimeType]
+		if !ok {
+			return cm.errorf(nil, MsgErrAudioFormat, mimeType)
+		}
+		if len(data) > MaxAudioAttachmentSize {
+			return cm.errorf(nil, MsgErrAudioTooLarge, len(data), MaxAudioAttachmentSize)
+		}
+		content = general.Content{
+			Type: general.ContentTypeAudio,
+			Audio: &general.Audio{
+				Data:   base64.StdEncoding.EncodeToString(data),
+				Format: format,
+			},
+		}
+
+	case mimeType == "application/pdf":
+		if len(data) > MaxDocumentAttachmentSize {
+			return cm.errorf(nil, MsgErrDocumentTooLarge, len(data), MaxDocumentAttachmentSize)
+		}
+		content = general.Content{
+			Type: general.ContentTypeDocument,
+			Document: &general.Document{
+				Name:     name,
+				MimeType: mimeType,
+				Data:     base64.StdEncoding.EncodeToString(data),
+			},
+		}
+
+	case strings.HasPrefix(mimeType, "text/") || mimeType == "application/json":
+		// 文本文件直接转换为文本内容，所有提供商都能处理
+		if len(data) > MaxDocumentAttachmentSize {
+			return cm.errorf(nil, MsgErrDocumentTooLarge, len(data), MaxDocumentAttachmentSize)
+		}
+		if !utf8.Valid(data) {
+			return cm.errorf(nil, MsgErrInvalidUTF8)
+		}
+		text := string(data)
+		if name != "" {
+			text = cm.text(MsgAttachmentFile, name, text)
+		}
+		content = general.Content{
+			Type: general.ContentTypeText,
+			Text: text,
+		}
+
+	default:
+		return cm.errorf(nil, MsgErrAttachmentType, mimeType)
+	}
+
+	cm.attachments = append(cm.attachments, content)
+	return nil
+}
+
+// prepareImage 校验图片格式和大小，超过大小限制时重新编码为JPEG
+func prepareImage(data []byte, mimeType string, locale Locale) ([]byte, string, error) {
+	if supportedImageTypes[mimeType] && len(data) <= MaxImageAttachmentSize {
+		return data, mimeType, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", localeErrorf(locale, nil, MsgErrImageFormat, mimeType)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", localeErrorf(locale, err, MsgErrImageConvert, err)
+	}
+	if buf.Len() > MaxImageAttachmentSize {
+		return nil, "", localeErrorf(locale, nil, MsgErrImageTooLarge, buf.Len(), MaxImageAttachmentSize)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
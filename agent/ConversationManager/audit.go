@@ -0,0 +1,384 @@
+package ConversationManager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// AuditEntryType 审计记录的类型
+type AuditEntryType string
+
+const (
+	AuditUserInput   AuditEntryType = "user_input"   // 用户输入
+	AuditModelOutput AuditEntryType = "model_output" // 模型输出，包括模型发起的工具调用
+	AuditToolResult  AuditEntryType = "tool_result"  // 工具调用的结果
+	AuditSystem      AuditEntryType = "system"       // 手动添加的系统消息
+)
+
+// AuditEntry 一条审计记录，Hash为前一条记录的Hash与本条记录内容的SHA-256（设置Key时为HMAC-SHA256），修改或删除中间的记录都会使之后的校验失败
+type AuditEntry struct {
+	Seq        int64              `json:"seq"`
+	Time       time.Time          `json:"time"`
+	SessionID  string             `json:"session_id"`
+	Turn       int                `json:"turn"`
+	Type       AuditEntryType     `json:"type"`
+	MessageID  string             `json:"message_id,omitempty"`
+	Content    string             `json:"content,omitempty"`
+	ToolCalls  []general.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string             `json:"tool_call_id,omitempty"`
+	ToolName   string             `json:"tool_name,omitempty"`
+	ToolArgs   json.RawMessage    `json:"tool_args,omitempty"`
+	PrevHash   string             `json:"prev_hash"`
+	Hash       string             `json:"hash"`
+}
+
+// AuditOptions 审计日志的密钥和锚点
+// 不设置Key时哈希链只能发现意外的损坏：能修改文件的人可以改写记录并重新计算所有哈希，删除末尾的记录也无法发现
+type AuditOptions struct {
+	// Key HMAC密钥，设置后哈希为HMAC-SHA256，没有密钥的人无法在修改记录后重新计算哈希；密钥应与日志文件分开保管
+	Key []byte
+	// Anchor 保存在日志之外的头部（见AuditLog.Anchor），设置后校验日志至少包含到Anchor.Seq的记录且该记录的哈希一致，
+	// 用于发现末尾记录被删除或整条链被重写
+	Anchor *AuditAnchor
+}
+
+// AuditAnchor 审计日志头部的序号和哈希，应定期保存到日志文件之外（如数据库、WORM存储或签名后发给审查方）
+type AuditAnchor struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// AuditLog 只追加的审计日志，记录用户输入、模型输出和工具调用，用于合规审查智能体的自主行为
+// 可以由多个会话共享，并发安全；指定文件时每条记录以一行JSON追加写入，内存中只保留序号和最后一条记录的哈希，
+// 读取记录时从文件流式读出，长期运行的服务中日志不会占用越来越多的内存
+type AuditLog struct {
+	mu       sync.Mutex
+	key      []byte
+	path     string
+	file     *os.File
+	size     int64        // 文件中完整记录所占的字节数，读取时只读到这里
+	closed   bool         // 文件已关闭，不再追加
+	entries  []AuditEntry // 不指定文件时保存在内存中的记录
+	seq      int64
+	lastHash string
+}
+
+// NewAuditLog 创建不带密钥的审计日志，见NewAuditLogWithOptions
+func NewAuditLog(path string) (*AuditLog, error) {
+	return NewAuditLogWithOptions(path, AuditOptions{})
+}
+
+// NewAuditLogWithOptions 创建审计日志，path为空时只保存在内存中
+// 文件已存在时按options流式校验已有的记录并在其后继续追加，哈希链不完整或与锚点不符时返回错误；
+// 崩溃时写了一半的最后一行被截掉
+func NewAuditLogWithOptions(path string, options AuditOptions) (*AuditLog, error) {
+	log := &AuditLog{key: options.Key, path: path}
+	if path == "" {
+		return log, nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	verifier := &auditVerifier{options: options}
+	size, err := scanAuditEntries(file, verifier.check)
+	if err == nil {
+		err = verifier.finish()
+	}
+	if err == nil {
+		// 去掉不完整的最后一行，之后的记录从新的一行开始
+		err = file.Truncate(size)
+	}
+	if err == nil && size > 0 {
+		// 最后一条记录完整但缺少换行符时补上
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, size-1); err == nil && last[0] != '\n' {
+			if _, err = file.Write([]byte{'\n'}); err == nil {
+				size++
+			}
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	log.seq, log.lastHash = verifier.prevSeq, verifier.prevHash
+	log.file, log.size = file, size
+	return log, nil
+}
+
+// Append 追加一条记录，填充序号、时间和哈希后返回
+func (l *AuditLog) Append(entry AuditEntry) (AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return entry, fmt.Errorf("审计日志已关闭")
+	}
+	entry.Seq = l.seq + 1
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.PrevHash = l.lastHash
+	hash, err := auditHash(entry, l.key)
+	if err != nil {
+		return entry, err
+	}
+	entry.Hash = hash
+	if l.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return entry, err
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			return entry, fmt.Errorf("写入审计日志失败: %w", err)
+		}
+		l.size += int64(len(line)) + 1
+	} else {
+		l.entries = append(l.entries, entry)
+	}
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+	return entry, nil
+}
+
+// Each 按顺序对每条记录调用fn，fn返回错误时停止并返回该错误
+// 指定文件时从文件流式读取调用时已写入的记录，不会一次加载到内存
+func (l *AuditLog) Each(fn func(entry AuditEntry) error) error {
+	l.mu.Lock()
+	path, size := l.path, l.size
+	entries := l.entries
+	l.mu.Unlock()
+	if path == "" {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// 另外打开文件读取，文件只追加，size之前的内容不会再变化
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	defer file.Close()
+	_, err = scanAuditEntries(io.NewSectionReader(file, 0, size), fn)
+	return err
+}
+
+// Entries 返回所有记录，指定文件时从文件读出；日志很大时使用Each或Export逐条处理
+func (l *AuditLog) Entries() ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := l.Each(func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// Export 以JSON Lines格式导出所有记录，导出的内容可以用VerifyAuditLog校验
+func (l *AuditLog) Export(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return l.Each(func(entry AuditEntry) error {
+		return encoder.Encode(entry)
+	})
+}
+
+// Verify 校验所有记录的哈希链
+func (l *AuditLog) Verify() error {
+	verifier := &auditVerifier{options: AuditOptions{Key: l.key}}
+	if err := l.Each(verifier.check); err != nil {
+		return err
+	}
+	return verifier.finish()
+}
+
+// Anchor 返回当前的头部，保存到日志之外后可以通过AuditOptions.Anchor发现末尾记录被删除
+func (l *AuditLog) Anchor() AuditAnchor {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return AuditAnchor{Seq: l.seq, Hash: l.lastHash}
+}
+
+// Close 关闭审计日志文件，之后Append返回错误，已写入的记录仍可以读取
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file, l.closed = nil, true
+	return err
+}
+
+// VerifyAuditLog 校验不带密钥的审计日志，见VerifyAuditLogWithOptions
+func VerifyAuditLog(r io.Reader) (int, error) {
+	return VerifyAuditLogWithOptions(r, AuditOptions{})
+}
+
+// VerifyAuditLogWithOptions 按options的密钥和锚点流式校验导出或写入文件的审计日志，返回记录数
+// 记录被修改、删除或重排时返回出错的位置；只有设置Anchor时才能发现末尾的记录被删除
+func VerifyAuditLogWithOptions(r io.Reader, options AuditOptions) (int, error) {
+	verifier := &auditVerifier{options: options}
+	if _, err := scanAuditEntries(r, verifier.check); err != nil {
+		return 0, err
+	}
+	if err := verifier.finish(); err != nil {
+		return 0, err
+	}
+	return int(verifier.prevSeq), nil
+}
+
+// SetAuditLog 设置会话的审计日志，为nil时不记录
+// 写入历史记录的用户输入、模型输出和工具结果都会追加到审计日志，包括之后因失败被回滚的消息
+func (cm *ConversationManager) SetAuditLog(log *AuditLog) {
+	cm.auditLog = log
+}
+
+// audit 将写入历史记录的消息追加到审计日志，写入失败时通过事件通道报告，不中断对话
+func (cm *ConversationManager) audit(message general.Message) {
+	if cm.auditLog == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:      message.CreatedAt,
+		SessionID: cm.sessionID,
+		Turn:      cm.turn,
+		MessageID: message.ID,
+		Content:   messageText(message),
+		ToolCalls: message.ToolCalls,
+	}
+	switch message.Role {
+	case general.RoleUser:
+		entry.Type = AuditUserInput
+	case general.RoleAssistant:
+		entry.Type = AuditModelOutput
+	case general.RoleTool:
+		entry.Type = AuditToolResult
+		for _, content := range message.Content {
+			if content.Type == general.ContentTypeToolRes {
+				entry.Content = content.Text
+				entry.ToolCallID = content.ToolID
+				break
+			}
+		}
+		if call, ok := cm.findToolCall(entry.ToolCallID); ok {
+			entry.ToolName = call.Function.Name
+			entry.ToolArgs = call.Function.Arguments
+		}
+	default:
+		entry.Type = AuditSystem
+	}
+	if _, err := cm.auditLog.Append(entry); err != nil {
+		cm.emit(Event{Type: EventError, Err: err})
+	}
+}
+
+// findToolCall 在历史记录中从后向前查找工具调用
+func (cm *ConversationManager) findToolCall(id string) (general.ToolCall, bool) {
+	if id == "" {
+		return general.ToolCall{}, false
+	}
+	for i := len(cm.history) - 1; i >= 0; i-- {
+		for _, call := range cm.history[i].ToolCalls {
+			if call.ID == id {
+				return call, true
+			}
+		}
+	}
+	return general.ToolCall{}, false
+}
+
+// auditHash 计算记录的哈希：前一条记录的Hash与不含Hash字段的记录JSON的SHA-256，key不为空时为HMAC-SHA256
+func auditHash(entry AuditEntry, key []byte) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	}
+	h.Write([]byte(entry.PrevHash))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// scanAuditEntries 逐条读取JSON Lines格式的记录并调用fn，忽略空行，返回完整的行所占的字节数
+// 没有换行符且无法解析的最后一行视为崩溃时写了一半，被忽略
+func scanAuditEntries(r io.Reader, fn func(entry AuditEntry) error) (int64, error) {
+	reader := bufio.NewReader(r)
+	var size int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		complete := err == nil
+		if text := bytes.TrimSpace(data); len(text) > 0 {
+			var entry AuditEntry
+			if jsonErr := json.Unmarshal(text, &entry); jsonErr != nil {
+				if !complete {
+					return size, nil
+				}
+				return 0, fmt.Errorf("第 %d 行不是有效的审计记录: %w", line, jsonErr)
+			}
+			if err := fn(entry); err != nil {
+				return 0, err
+			}
+		}
+		size += int64(len(data))
+		if !complete {
+			return size, nil
+		}
+	}
+}
+
+// auditVerifier 逐条校验记录的序号连续且哈希链完整，设置锚点时校验锚点处的记录
+type auditVerifier struct {
+	options  AuditOptions
+	prevHash string
+	prevSeq  int64
+}
+
+// check 校验下一条记录
+func (v *auditVerifier) check(entry AuditEntry) error {
+	if entry.Seq != v.prevSeq+1 {
+		return fmt.Errorf("审计记录 %d: 序号不连续，前一条为 %d", entry.Seq, v.prevSeq)
+	}
+	if entry.PrevHash != v.prevHash {
+		return fmt.Errorf("审计记录 %d: 与前一条记录的哈希不匹配", entry.Seq)
+	}
+	hash, err := auditHash(entry, v.options.Key)
+	if err != nil {
+		return err
+	}
+	if hash != entry.Hash {
+		return fmt.Errorf("审计记录 %d: 哈希不匹配，记录已被修改", entry.Seq)
+	}
+	if anchor := v.options.Anchor; anchor != nil && entry.Seq == anchor.Seq && entry.Hash != anchor.Hash {
+		return fmt.Errorf("审计记录 %d: 与锚点的哈希不匹配，日志已被重写", anchor.Seq)
+	}
+	v.prevHash, v.prevSeq = entry.Hash, entry.Seq
+	return nil
+}
+
+// finish 在所有记录校验完后检查日志至少包含到锚点的记录
+func (v *auditVerifier) finish() error {
+	if anchor := v.options.Anchor; anchor != nil && anchor.Seq > 0 && v.prevSeq < anchor.Seq {
+		return fmt.Errorf("审计日志只有 %d 条记录，锚点为 %d，末尾的记录已被删除", v.prevSeq, anchor.Seq)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAuditLog 创建带密钥的审计日志文件并写入contents中的每条记录，返回路径和关闭前的锚点
+func writeAuditLog(t *testing.T, key []byte, contents ...string) (string, AuditAnchor) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := NewAuditLogWithOptions(path, AuditOptions{Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range contents {
+		if _, err := log.Append(AuditEntry{Type: AuditUserInput, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	anchor := log.Anchor()
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, anchor
+}
+
+// editAuditLog 用edit处理日志文件的每一行后写回
+func editAuditLog(t *testing.T, path string, edit func(lines []string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(path, []byte(strings.Join(edit(lines), "")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLogDetectsTampering(t *testing.T) {
+	key := []byte("audit-key")
+	tests := []struct {
+		name string
+		edit func(lines []string) []string
+	}{
+		{"modified content", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], "transfer 10", "transfer 1000", 1)
+			return lines
+		}},
+		{"deleted entry", func(lines []string) []string {
+			return append(lines[:1:1], lines[2:]...)
+		}},
+		{"reordered entries", func(lines []string) []string {
+			lines[0], lines[1] = lines[1], lines[0]
+			return lines
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _ := writeAuditLog(t, key, "hello", "transfer 10", "bye")
+			editAuditLog(t, path, tt.edit)
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := VerifyAuditLogWithOptions(bytes.NewReader(data), AuditOptions{Key: key}); err == nil {
+				t.Error("VerifyAuditLogWithOptions accepted a tampered log")
+			}
+			if _, err := NewAuditLogWithOptions(path, AuditOptions{Key: key}); err == nil {
+				t.Error("NewAuditLogWithOptions reopened a tampered log")
+			}
+		})
+	}
+
+	// 没有密钥时无法伪造哈希：用其他密钥写出的日志校验失败
+	path, _ := writeAuditLog(t, []byte("forged"), "hello")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLogWithOptions(bytes.NewReader(data), AuditOptions{Key: key}); err == nil {
+		t.Error("log hashed with another key passed verification")
+	}
+}
+
+func TestAuditLogAnchorDetectsTruncation(t *testing.T) {
+	key := []byte("audit-key")
+	path, anchor := writeAuditLog(t, key, "one", "two", "three")
+	editAuditLog(t, path, func(lines []string) []string {
+		return lines[:2]
+	})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有锚点时删除末尾的记录无法发现
+	if n, err := VerifyAuditLogWithOptions(bytes.NewReader(data), AuditOptions{Key: key}); err != nil || n != 2 {
+		t.Fatalf("without anchor = %d, %v, want 2 entries", n, err)
+	}
+	if _, err := VerifyAuditLogWithOptions(bytes.NewReader(data), AuditOptions{Key: key, Anchor: &anchor}); err == nil {
+		t.Error("truncated log passed verification against the anchor")
+	}
+	if _, err := NewAuditLogWithOptions(path, AuditOptions{Key: key, Anchor: &anchor}); err == nil {
+		t.Error("NewAuditLogWithOptions reopened a truncated log")
+	}
+
+	// 整条链被重写时锚点处的哈希不一致
+	rewritten, _ := writeAuditLog(t, key, "one", "two", "changed")
+	data, err = os.ReadFile(rewritten)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLogWithOptions(bytes.NewReader(data), AuditOptions{Key: key, Anchor: &anchor}); err == nil {
+		t.Error("rewritten log passed verification against the anchor")
+	}
+}
+
+func TestAuditLogRecoversTornLastLine(t *testing.T) {
+	key := []byte("audit-key")
+	path, _ := writeAuditLog(t, key, "one", "two")
+	// 崩溃时最后一条记录只写了一半
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(`{"seq":3,"time":"2026-`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	log, err := NewAuditLogWithOptions(path, AuditOptions{Key: key})
+	if err != nil {
+		t.Fatalf("reopen after torn write: %v", err)
+	}
+	entry, err := log.Append(AuditEntry{Type: AuditUserInput, Content: "three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Seq != 3 {
+		t.Errorf("appended seq = %d, want 3", entry.Seq)
+	}
+	if err := log.Verify(); err != nil {
+		t.Errorf("Verify after recovery: %v", err)
+	}
+	log.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := VerifyAuditLogWithOptions(bytes.NewReader(data), AuditOptions{Key: key}); err != nil || n != 3 {
+		t.Errorf("verify file = %d, %v, want 3 entries", n, err)
+	}
+}
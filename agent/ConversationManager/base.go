@@ -1,7 +1,11 @@
 package ConversationManager
 
 import (
+	"context"
+	"encoding/json"
+	"log/slog"
 	"reflect"
+	"time"
 
 	"github.com/ccIisIaIcat/GoAgent/agent/general"
 )
@@ -21,9 +25,77 @@ type ConversationManager struct {
 	Temperature            float64             //单次对话中最大的温度
 	MaxHistoryTokens       int                 //最大历史记录token数量（用于截断）
 	EnableTruncation       bool                //是否启用历史截断
+	ServerTokenCounting    bool                //截断时使用提供商的服务端token计数（Anthropic、Google），不支持或失败时使用估算
+	KeepFirstTurns         int                 //截断时始终保留的开头对话轮数（如任务说明），0表示只保留最新的对话
+	CompressToolResults    int                 //早于最近多少轮对话的工具结果替换为摘要，0表示不压缩
+	RecoverToolErrors      bool                //工具调用失败时以错误结果返回给模型并继续对话，而不是中止并回滚
+	LenientArguments       bool                //转换工具参数时允许字符串和数字、布尔值之间的宽松转换（如"5"转换为int）
 	mcpManager             *MCPClientManager   // MCP客户端管理器
 	LastUsage              *general.Usage      // 最后一次调用的token使用量
 	TotalUsage             *general.Usage      // 累计token使用量
+
+	provider           general.Provider                            // 当前历史记录所适配的提供商
+	Extensions         map[string]interface{}                      // 提供商特有的扩展参数，随每次请求发送
+	ProviderOptions    map[general.Provider]map[string]interface{} // 按提供商指定的请求参数，只对对应提供商生效
+	EnableThinking     *bool                                       // 思考模式开关，为nil时使用提供商默认行为
+	AudioOutput        *general.AudioOutput                        // 音频输出参数，不为nil时同时请求文本和音频输出
+	ImageDetail        general.ImageDetail                         // 图片默认详细程度，为空时使用high
+	IncludeRawResponse bool                                        // 是否保留提供商返回的原始JSON
+	StrictTools        bool                                        // 以OpenAI的strict模式发送工具定义，生成的参数保证符合Schema
+	LastRawResponse    json.RawMessage                             // 最后一次调用提供商返回的原始JSON，需开启IncludeRawResponse
+	attachments        []general.Content                           // 待随下一次Chat发送的附件
+	events             chan Event                                  // 结构化事件通道
+	subscribers        *subscriberSet                              // 结构化事件的订阅
+	toolApprover       ToolApprover                                // 工具调用审批函数
+	streamReplies      bool                                        // 是否以流式请求模型，回复文本逐块通过TextDelta事件发送
+	replyStreamed      bool                                        // 最近一次回复的文本是否已通过TextDelta事件发送
+	delivery           *delivery                                   // info_chan和事件通道的投递策略
+	sessionID          string                                      // 会话ID
+	turn               int                                         // 已进行的Chat调用次数
+	ledger             *UsageLedger                                // 使用量账本
+	budgets            []*Budget                                   // token或费用预算
+	malformedArguments MalformedArgumentsPolicy                    // 工具参数不是有效的JSON时的处理策略
+
+	contentFilterHook ContentFilterHook // 内容被安全策略拦截时的回调
+	truncationHook    TruncationHook    // 历史截断时的回调
+	lifecycle         *lifecycle        // 进行中的对话和工具调用，用于Shutdown
+	runLog            *runLog           // 每次对话的请求、工具调用和截断记录，用于GenerateRunReport
+	tracer            *tracer           // 追踪导出器和进行中的对话的追踪
+	auditLog          *AuditLog         // 审计日志，为nil时不记录
+	journal           *Journal          // 历史日志，为nil时不记录
+	replay            *replayRecording  // 回放时使用的工具结果记录，为nil时不在回放
+
+	toolLimitPolicy    ToolLimitPolicy    // 函数调用次数超限时的处理策略
+	toolLimitConfirmer ToolLimitConfirmer // ToolLimitConfirm策略的确认函数
+	questions          *pendingQuestions  // ask_user工具等待回答的问题，为nil时未启用
+	checkpointSaver    CheckpointSaver    // 工具循环的检查点保存函数
+	ensembleJudge      *EnsembleTarget    // ChatEnsemble的评审模型，为nil时不评审
+	draftModel         *EnsembleTarget    // 草稿模型，为nil时不使用草稿模式
+	draftStats         DraftStats         // 草稿模式的统计
+	compressor         Compressor         // 工具结果和文本附件的压缩器，为nil时不压缩
+	compressTarget     int                // 压缩的目标token数
+	tokenCounter       TokenCounter       // token计数器，为nil时使用HeuristicTokenCounter
+	outputProcessors   []OutputProcessor  // 最终回复的后处理器
+	outputRetries      int                // 后处理失败时让模型重新回答的最大次数
+	reactMode          bool               // 是否使用ReAct文本协议代替原生函数调用
+	unknownToolReplier UnknownToolReplier // 生成未注册工具的工具结果，为nil时使用默认的提示
+	screenshotter      Screenshotter      // take_screenshot工具的截图函数，为nil时未启用
+	toolImages         []general.Content  // 本批工具调用产生的截图，所有工具结果之后加入对话
+	timeLocation       *time.Location     // 注入系统提示词的当前时间使用的时区，为nil时不注入
+	reminders          *reminderScheduler // schedule_reminder工具设置的提醒，为nil时未注册时间工具
+
+	responseFormat    *general.ResponseFormat // 结构化输出格式
+	structuredRetries int                     // 结构化输出未通过校验时的最大重试次数
+	duplicateTools    DuplicateToolPolicy     // 注册同名工具时的处理策略
+	toolGroups        map[string][]string     // 工具组名称到工具名称
+	toolProfiles      map[string][]string     // 工具配置名称到工具组名称
+	activeGroups      []string                // 本会话启用的工具组，为nil时发送所有工具
+	unknownToolPolicy UnknownToolPolicy       // 模型调用未注册的工具时的处理策略
+	toolAllowlist     map[string]bool         // 允许使用的工具，为nil时不限制
+	funcReturnNames   map[string][]string     // 函数多个返回值序列化为JSON对象时的名称
+	toolProxies       map[string]toolProxy    // 预编译的工具代理（如MCP工具），调用时代替反射
+	logger            *slog.Logger            // 日志记录器，为nil时使用slog.Default()
+	locale            Locale                  // 发送给模型的固定文本使用的语言，为空时使用英文
 }
 
 // NewConversationManager 创建新的对话管理器
@@ -35,11 +107,20 @@ func NewConversationManager(manager *general.AgentManager) *ConversationManager
 		registeredFuncs:        make(map[string]reflect.Value),
 		funcSchemas:            make(map[string]general.Tool),
 		funcParamNames:         make(map[string][]string),
+		toolProxies:            make(map[string]toolProxy),
 		MaxFunctionCallingNums: 15,
 		MaxTokens:              5000,
 		Temperature:            0.7,
 		MaxHistoryTokens:       100000, // 默认10000 token作为历史截断限制
 		EnableTruncation:       true,   // 默认启用截断
+		delivery:               newDelivery(),
+		subscribers:            &subscriberSet{},
+		sessionID:              newSessionID(),
+		ledger:                 NewUsageLedger(),
+		lifecycle:              newLifecycle(),
+		runLog:                 newRunLog(),
+		tracer:                 &tracer{},
+		outputRetries:          2,
 	}
 	// 初始化MCP管理器
 	cm.mcpManager = NewMCPClientManager(cm)
@@ -86,22 +167,114 @@ func (cm *ConversationManager) EnableHistoryTruncation(enable bool) {
 	cm.EnableTruncation = enable
 }
 
+// SetServerTokenCounting 设置截断时是否使用提供商的服务端token计数代替估算，每次截断检查会多一次计数请求
+func (cm *ConversationManager) SetServerTokenCounting(enable bool) {
+	cm.ServerTokenCounting = enable
+}
+
+// SetKeepFirstTurns 设置截断时始终保留的开头对话轮数，其余历史仍从最新的对话开始保留
+func (cm *ConversationManager) SetKeepFirstTurns(turns int) {
+	cm.KeepFirstTurns = turns
+}
+
+// SetLenientArguments 设置转换工具参数时是否允许宽松转换，避免模型把数字或布尔值写成字符串（如"5"、"true"）时工具调用失败
+func (cm *ConversationManager) SetLenientArguments(enable bool) {
+	cm.LenientArguments = enable
+}
+
+// SetEnableThinking 设置思考模式开关（如Qwen3的enable_thinking）
+func (cm *ConversationManager) SetEnableThinking(enable bool) {
+	cm.EnableThinking = &enable
+}
+
+// SetAudioOutput 设置音频输出（如OpenAI gpt-4o-audio-preview），voice为空时关闭音频输出
+func (cm *ConversationManager) SetAudioOutput(voice string, format string) {
+	if voice == "" {
+		cm.AudioOutput = nil
+		return
+	}
+	cm.AudioOutput = &general.AudioOutput{Voice: voice, Format: format}
+}
+
+// SetIncludeRawResponse 设置是否保留提供商返回的原始JSON，开启后可通过LastRawResponse读取
+func (cm *ConversationManager) SetIncludeRawResponse(include bool) {
+	cm.IncludeRawResponse = include
+}
+
+// SetExtension 设置提供商特有的扩展参数（如Qwen的enable_search），value为nil时删除该参数
+func (cm *ConversationManager) SetExtension(key string, value interface{}) {
+	if value == nil {
+		delete(cm.Extensions, key)
+		return
+	}
+	if cm.Extensions == nil {
+		cm.Extensions = make(map[string]interface{})
+	}
+	cm.Extensions[key] = value
+}
+
+// SetProviderOption 设置只对指定提供商生效的请求参数，会深度合并到请求体中并覆盖同名字段
+// value为nil时请求体中将删除该字段，通过ClearProviderOptions恢复默认
+func (cm *ConversationManager) SetProviderOption(provider general.Provider, key string, value interface{}) {
+	if cm.ProviderOptions == nil {
+		cm.ProviderOptions = make(map[general.Provider]map[string]interface{})
+	}
+	if cm.ProviderOptions[provider] == nil {
+		cm.ProviderOptions[provider] = make(map[string]interface{})
+	}
+	cm.ProviderOptions[provider][key] = value
+}
+
+// ClearProviderOptions 清除指定提供商的请求参数，provider为空时清除所有
+func (cm *ConversationManager) ClearProviderOptions(provider general.Provider) {
+	if provider == "" {
+		cm.ProviderOptions = nil
+		return
+	}
+	delete(cm.ProviderOptions, provider)
+}
+
 // AddMessage 添加消息到历史记录
 func (cm *ConversationManager) AddMessage(role general.MessageRole, content []general.Content) {
-	cm.history = append(cm.history, general.Message{
+	cm.appendMessage(context.Background(), general.Message{
 		Role:    role,
 		Content: content,
 	})
 }
 
-// AddFullMessage 添加完整的消息到历史记录（包括ToolCalls和Name）
+// AddFullMessage 添加完整的消息到历史记录（包括ToolCalls和Name），未设置ID和CreatedAt时自动填充
 func (cm *ConversationManager) AddFullMessage(message general.Message) {
+	cm.appendMessage(context.Background(), message)
+}
+
+// appendMessage 为消息填充ID和创建时间后添加到历史记录，返回填充后的消息
+func (cm *ConversationManager) appendMessage(ctx context.Context, message general.Message) general.Message {
+	stampMessage(&message)
 	cm.history = append(cm.history, message)
+	cm.audit(message)
+	cm.journalWrite(ctx, journalRecord{Op: journalAppend, Message: &message})
+	return message
+}
+
+// stampMessage 为未设置ID和创建时间的消息填充默认值
+func stampMessage(message *general.Message) {
+	if message.ID == "" {
+		message.ID = newMessageID()
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+}
+
+// newMessageID 生成消息ID
+func newMessageID() string {
+	return "msg_" + newSessionID()
 }
 
-// GetHistory 获取对话历史
+// GetHistory 获取对话历史的副本，对返回的切片追加或修改元素不会影响历史记录
+// 消息中的内容和工具调用仍与历史记录共享，需要修改其中的内容时使用CopyHistory
 func (cm *ConversationManager) GetHistory() []general.Message {
-	return cm.history
+	return append([]general.Message(nil), cm.history...)
 }
 
 // GetRegisteredTools 获取所有注册的工具
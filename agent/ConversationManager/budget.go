@@ -0,0 +1,170 @@
+package ConversationManager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ErrBudgetExceeded 超出预算，可以通过errors.Is判断，详细信息通过errors.As获取*BudgetExceededError
+var ErrBudgetExceeded = errors.New("超出预算")
+
+// ErrMissingPrice 预算设置了费用上限，但请求的模型没有价格，费用无法计算
+var ErrMissingPrice = errors.New("模型没有设置价格")
+
+// BudgetExceededError 超出预算的详细信息
+type BudgetExceededError struct {
+	Budget string  // 预算名称
+	Unit   string  // "tokens" 或 "cost"
+	Limit  float64 // 预算上限
+	Used   float64 // 已使用量
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("预算%s超出限制: %s已使用%.4g，上限%.4g", e.Budget, e.Unit, e.Used, e.Limit)
+}
+
+// Unwrap 使errors.Is(err, ErrBudgetExceeded)成立
+func (e *BudgetExceededError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// ModelPrice 模型价格（每百万token）
+type ModelPrice struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// Budget token或费用预算，并发安全
+// 同一个Budget可以添加到多个ConversationManager中，实现按用户等维度的共享预算
+type Budget struct {
+	Name      string
+	MaxTokens int     // token上限，0表示不限制
+	MaxCost   float64 // 费用上限，0表示不限制，需要通过SetPrice设置所用模型的价格，否则Chat返回ErrMissingPrice
+
+	mu         sync.Mutex
+	prices     map[string]ModelPrice
+	usedTokens int
+	usedCost   float64
+}
+
+// NewBudget 创建预算
+func NewBudget(name string, maxTokens int, maxCost float64) *Budget {
+	return &Budget{
+		Name:      name,
+		MaxTokens: maxTokens,
+		MaxCost:   maxCost,
+		prices:    make(map[string]ModelPrice),
+	}
+}
+
+// SetPrice 设置模型价格，未设置价格的模型费用按0计算
+func (b *Budget) SetPrice(model string, price ModelPrice) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.prices == nil {
+		b.prices = make(map[string]ModelPrice)
+	}
+	b.prices[model] = price
+}
+
+// CheckPrice 检查设置了费用上限的预算是否有模型的价格，没有时返回ErrMissingPrice
+// 没有价格的模型费用按0计算，费用上限永远不会触发；Chat和ChatEnsemble在请求前调用，model为空时不检查
+func (b *Budget) CheckPrice(model string) error {
+	if b.MaxCost <= 0 || model == "" {
+		return nil
+	}
+	if _, ok := b.price(model); !ok {
+		return fmt.Errorf("预算%s: %w: %s", b.Name, ErrMissingPrice, model)
+	}
+	return nil
+}
+
+// Charge 记录一次调用的使用量
+func (b *Budget) Charge(model string, usage general.Usage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.usedTokens += usage.TotalTokens
+	b.usedCost += b.prices[model].cost(usage)
+}
+
+// price 获取模型价格，未设置时返回false
+func (b *Budget) price(model string) (ModelPrice, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	price, ok := b.prices[model]
+	return price, ok
+}
+
+// cost 按价格计算一次调用的费用
+func (p ModelPrice) cost(usage general.Usage) float64 {
+	return float64(usage.PromptTokens)*p.PromptPerMillion/1e6 +
+		float64(usage.CompletionTokens)*p.CompletionPerMillion/1e6
+}
+
+// Check 检查预算是否已用完，已用完时返回*BudgetExceededError
+func (b *Budget) Check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.MaxTokens > 0 && b.usedTokens >= b.MaxTokens {
+		return &BudgetExceededError{Budget: b.Name, Unit: "tokens", Limit: float64(b.MaxTokens), Used: float64(b.usedTokens)}
+	}
+	if b.MaxCost > 0 && b.usedCost >= b.MaxCost {
+		return &BudgetExceededError{Budget: b.Name, Unit: "cost", Limit: b.MaxCost, Used: b.usedCost}
+	}
+	return nil
+}
+
+// Used 获取已使用的token数和费用
+func (b *Budget) Used() (int, float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usedTokens, b.usedCost
+}
+
+// Reset 清空已使用量
+func (b *Budget) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.usedTokens = 0
+	b.usedCost = 0
+}
+
+// AddBudget 添加预算，每次请求模型前检查所有预算，任一预算用完时Chat返回ErrBudgetExceeded
+func (cm *ConversationManager) AddBudget(budget *Budget) {
+	cm.budgets = append(cm.budgets, budget)
+}
+
+// ClearBudgets 移除所有预算
+func (cm *ConversationManager) ClearBudgets() {
+	cm.budgets = nil
+}
+
+// checkBudgets 检查所有预算
+func (cm *ConversationManager) checkBudgets() error {
+	for _, budget := range cm.budgets {
+		if err := budget.Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBudgetPrices 检查所有设置了费用上限的预算是否有模型的价格
+func (cm *ConversationManager) checkBudgetPrices(model string) error {
+	for _, budget := range cm.budgets {
+		if err := budget.CheckPrice(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chargeBudgets 将使用量计入所有预算
+func (cm *ConversationManager) chargeBudgets(model string, usage general.Usage) {
+	for _, budget := range cm.budgets {
+		budget.Charge(model, usage)
+	}
+}
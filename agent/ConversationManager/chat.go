@@ -3,15 +3,43 @@ package ConversationManager
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/ccIisIaIcat/GoAgent/agent/general"
 )
 
 // Chat 发送消息并处理回复，支持图片上传和函数调用
+// 结束原因为general.StopReason的取值，为兼容保持string类型
 func (cm *ConversationManager) Chat(ctx context.Context, provider general.Provider, model string, userMessage string, imageBase64s []string, info_chan chan general.Message) ([]general.Message, string, error, *general.Usage) {
-	// 在处理用户请求开始时进行历史截断（仅一次，在添加新消息之前）
-	cm.history = cm.truncateHistory(cm.history)
-	stop_reason := "success"
+	images := make([]ImageInput, 0, len(imageBase64s))
+	for _, imageBase64 := range imageBase64s {
+		images = append(images, ImageInput{Base64: imageBase64})
+	}
+	return cm.ChatWithImages(ctx, provider, model, userMessage, images, info_chan)
+}
+
+// chat 发送已构建好的用户消息内容并处理回复和函数调用，返回前发送TurnCompleted或Error事件
+// userMsg的Name为发言人，多人对话时用于区分不同用户
+func (cm *ConversationManager) chat(ctx context.Context, provider general.Provider, model string, userMsg general.Message, info_chan chan general.Message) (messages []general.Message, stopReason general.StopReason, err error, usage *general.Usage) {
+	// 登记进行中的对话，Shutdown时取消
+	ctx, endChat, err := cm.beginChat(ctx)
+	if err != nil {
+		cm.finishTurn(general.StopReasonError, err, nil)
+		return nil, general.StopReasonError, err, nil
+	}
+	defer endChat()
+	// 返回前投递完排队的消息，之后调用方可以关闭info_chan和事件通道
+	defer cm.flushDeliveries(info_chan)
+	// 结束事件在投递完成之前发送
+	defer func() {
+		cm.finishTurn(stopReason, err, usage)
+	}()
+
+	// 在处理用户请求开始时压缩旧的工具结果并进行历史截断（仅一次，在添加新消息之前）
+	cm.setHistory(ctx, cm.compressToolResults(cm.history))
+	cm.setHistory(ctx, cm.truncateHistory(ctx, provider, model, cm.history))
+	cm.provider = provider
+	cm.turn++
 
 	// 保存历史快照，用于失败时回滚（截断后）
 	historySnapshot := make([]general.Message, len(cm.history))
@@ -22,132 +50,217 @@ func (cm *ConversationManager) Chat(ctx context.Context, provider general.Provid
 	defer func() {
 		// 如果失败，回滚历史记录
 		if !success {
-			cm.history = historySnapshot
+			cm.restoreHistory(ctx, historySnapshot)
 		}
 	}()
 
-	// 构建消息内容
-	var content []general.Content
-
-	// 添加文本消息
-	if userMessage != "" {
-		content = append(content, general.Content{
-			Type: general.ContentTypeText,
-			Text: userMessage,
-		})
-	}
-
-	// 添加图片
-	for _, imageBase64 := range imageBase64s {
-		content = append(content, general.Content{
-			Type: general.ContentTypeImageURL,
-			ImageURL: &general.ImageURL{
-				URL:    "data:image/png;base64," + imageBase64,
-				Detail: general.DetailHigh,
-			},
-		})
-	}
-
 	// 只有当有内容时才添加用户消息到历史
-	if len(content) > 0 {
-		cm.AddMessage(general.RoleUser, content)
+	userMsg.Role = general.RoleUser
+	if len(userMsg.Content) > 0 {
+		userMsg = cm.appendMessage(ctx, userMsg)
 	}
 
 	// 向外部通道发送该消息
-	if info_chan != nil {
-		info_chan <- general.Message{
-			Role:    general.RoleUser,
-			Content: content,
-		}
+	cm.deliverInfo(info_chan, userMsg)
+	cm.emitMessage(userMsg)
+
+	cm.beginTrace(provider, model, userMsg)
+	stop_reason, err := cm.runToolLoop(ctx, provider, model, HistoryLength, 0, nil, info_chan)
+	cm.endTrace(HistoryLength, stop_reason, err)
+	if err != nil {
+		return nil, stop_reason, err, nil
 	}
+	// 执行成功，标记成功
+	success = true
+	return cm.historyView()[HistoryLength:], stop_reason, nil, cm.TotalUsage
+}
 
-	// 合并注册的工具和传入的工具
-	allTools := make([]general.Tool, 0, len(cm.tools))
-	allTools = append(allTools, cm.tools...)
+// runToolLoop 循环请求模型并执行工具调用，直到模型不再调用工具
+// startIndex为本轮开始前的历史长度，functionCallCount和pending用于从检查点恢复：pending为上次中断时尚未执行的工具调用
+func (cm *ConversationManager) runToolLoop(ctx context.Context, provider general.Provider, model string, startIndex int, functionCallCount int, pending []general.ToolCall, info_chan chan general.Message) (general.StopReason, error) {
+	// 只发送启用的工具组中的工具和未分组的工具
+	allTools := cm.activeTools(ctx)
+	// 上次中止的工具循环留下的截图不再发送
+	cm.toolImages = nil
 
-	// 初始化函数调用计数器
-	functionCallCount := 0
+	stop_reason := general.StopReasonSuccess
 	shouldExit := false
+	var pendingTools []string // 下一次请求中提交的工具结果对应的工具名称
+	contentFilterRetried := false
+	outputRetried := 0
+	retryStart := -1 // 第一次后处理失败时的历史长度，成功后移除失败的回复和反馈
 
 	// 循环处理对话和函数调用，直到没有更多函数调用
 	for !shouldExit {
-		// 使用当前的历史记录（已经截断过）
-
-		// 创建请求
-		req := &general.ChatRequest{
-			Messages:     cm.GetHistory(),
-			Tools:        allTools,
-			SystemPrompt: cm.systemPrompt,
-			MaxTokens:    cm.MaxTokens,
-			Temperature:  cm.Temperature,
-			Model:        model,
-		}
+		// 从检查点恢复时先执行上次未完成的工具调用，否则请求模型
+		if len(pending) == 0 {
+			// 创建请求，使用当前的历史记录（已经截断过）
+			req := &general.ChatRequest{
+				Messages:           cm.historyView(),
+				Tools:              allTools,
+				SystemPrompt:       cm.requestSystemPrompt(),
+				MaxTokens:          cm.MaxTokens,
+				Temperature:        cm.Temperature,
+				TemperatureSet:     true,
+				Model:              model,
+				Extensions:         cm.Extensions,
+				EnableThinking:     cm.EnableThinking,
+				IncludeRawResponse: cm.IncludeRawResponse,
+				ProviderOptions:    cm.ProviderOptions,
+				StrictTools:        cm.StrictTools,
+			}
+			if cm.AudioOutput != nil {
+				req.Modalities = []string{"text", "audio"}
+				req.Audio = cm.AudioOutput
+			}
+			if cm.responseFormat != nil {
+				req.ResponseFormat = cm.responseFormat
+				req.StructuredOutputRetries = cm.structuredRetries
+			}
+			if cm.reactMode {
+				applyReAct(req, cm.Locale())
+			}
 
-		// 发送请求
-		resp, err := cm.manager.Chat(ctx, provider, req)
-		if err != nil {
-			return nil, "", fmt.Errorf("chat failed: %w", err), nil
-		}
+			// 超出预算时不再请求模型
+			if err := cm.checkBudgetPrices(model); err != nil {
+				return general.StopReasonError, err
+			}
+			if err := cm.checkBudgets(); err != nil {
+				return general.StopReasonBudgetExceeded, err
+			}
 
-		// 跟踪token使用量
-		if cm.LastUsage == nil {
-			cm.LastUsage = &general.Usage{}
-		}
-		if cm.TotalUsage == nil {
-			cm.TotalUsage = &general.Usage{}
-		}
+			// 发送请求
+			requestStart := time.Now()
+			span := cm.startLLMSpan(provider, model, req)
+			resp, replyProvider, replyModel, err := cm.requestReply(ctx, provider, model, req)
+			cm.endLLMSpan(span, replyProvider, replyModel, resp, err)
+			if err != nil {
+				if ctx.Err() != nil {
+					return general.StopReasonCancelled, fmt.Errorf("chat failed: %w", err)
+				}
+				return general.StopReasonError, fmt.Errorf("chat failed: %w", err)
+			}
+
+			// 跟踪token使用量
+			if cm.LastUsage == nil {
+				cm.LastUsage = &general.Usage{}
+			}
+			if cm.TotalUsage == nil {
+				cm.TotalUsage = &general.Usage{}
+			}
 
-		// 更新最后一次使用量
-		*cm.LastUsage = resp.Usage
+			// 更新最后一次使用量
+			*cm.LastUsage = resp.Usage
+			cm.LastRawResponse = resp.RawResponse
 
-		// 累加到总使用量
-		cm.TotalUsage.PromptTokens += resp.Usage.PromptTokens
-		cm.TotalUsage.CompletionTokens += resp.Usage.CompletionTokens
-		cm.TotalUsage.TotalTokens += resp.Usage.TotalTokens
+			// 累加到总使用量
+			cm.TotalUsage.Add(resp.Usage)
+			cm.recordUsage(replyProvider, replyModel, resp.Usage, pendingTools)
+			cm.chargeBudgets(replyModel, resp.Usage)
+			cm.runLog.request(replyProvider, replyModel, time.Since(requestStart), resp.Usage, cm.requestCost(replyModel, resp.Usage))
 
-		// 添加助手回复到历史
-		if len(resp.Choices) > 0 {
-			cm.history = append(cm.history, resp.Choices[0].Message)
-			if info_chan != nil {
-				info_chan <- resp.Choices[0].Message
+			// 回复被提供商的安全策略拦截
+			if len(resp.Choices) > 0 && resp.Choices[0].NormalizedFinishReason == general.FinishReasonContentFilter {
+				if !contentFilterRetried && cm.retryAfterContentFilter(ctx, startIndex, resp.Choices[0].FinishReason) {
+					contentFilterRetried = true
+					pendingTools = nil
+					continue
+				}
+				stop_reason = general.StopReasonContentFilter
+				if msg := resp.Choices[0].Message; len(msg.Content) > 0 || len(msg.ToolCalls) > 0 {
+					msg = cm.appendMessage(ctx, msg)
+					cm.deliverInfo(info_chan, msg)
+					cm.emitMessage(msg)
+				}
+				break
+			}
+
+			if len(resp.Choices) == 0 {
+				break
+			}
+			if cm.reactMode {
+				resp.Choices[0] = parseReAct(resp.Choices[0], allTools)
+			}
+			// 修复无效的工具参数，保证加入历史后之后的请求可以正常发送
+			resp.Choices[0].Message = cm.checkToolArguments(resp.Choices[0].Message)
+
+			// 最终回复交给后处理器，失败时带着错误信息让模型重新回答
+			if len(resp.Choices[0].Message.ToolCalls) == 0 && len(cm.outputProcessors) > 0 {
+				processed, err := cm.processOutput(ctx, resp.Choices[0].Message)
+				if err != nil {
+					if outputRetried >= cm.outputRetries {
+						return general.StopReasonError, cm.errorf(err, MsgErrOutputProcessing, err)
+					}
+					outputRetried++
+					if retryStart < 0 {
+						retryStart = len(cm.history)
+					}
+					cm.appendMessage(ctx, resp.Choices[0].Message)
+					cm.appendMessage(ctx, cm.outputFeedback(err))
+					pendingTools = nil
+					continue
+				}
+				resp.Choices[0].Message = processed
+				if retryStart >= 0 {
+					cm.restoreHistory(ctx, cm.history[:retryStart])
+				}
 			}
 
+			// 添加助手回复到历史
+			assistantMsg := cm.appendMessage(ctx, resp.Choices[0].Message)
+			cm.deliverInfo(info_chan, assistantMsg)
+			cm.emitMessage(assistantMsg)
+
 			// 检查是否有函数调用
 			choice := resp.Choices[0]
 			if len(choice.Message.ToolCalls) == 0 {
 				// 没有函数调用，对话结束
+				if choice.NormalizedFinishReason == general.FinishReasonLength {
+					stop_reason = general.StopReasonTruncated
+				}
 				break
 			}
+			pending = choice.Message.ToolCalls
+			if err := cm.saveCheckpoint(ctx, provider, model, startIndex, functionCallCount, pending); err != nil {
+				return general.StopReasonError, err
+			}
+		}
 
-			// 处理所有函数调用
-			for _, toolCall := range choice.Message.ToolCalls {
-				functionCallCount++
+		// 处理所有函数调用
+		pendingTools = nil
+		for i, toolCall := range pending {
+			functionCallCount++
+			pendingTools = append(pendingTools, toolCall.Function.Name)
 
-				// 检查是否超过最大函数调用次数
-				if functionCallCount > cm.MaxFunctionCallingNums {
-					// 超过阈值，执行最后一次工具调用但不发送，直接退出循环
-					if err := cm.HandleToolCall(ctx, provider, toolCall, info_chan); err != nil {
-						stop_reason = "error"
-						return nil, stop_reason, fmt.Errorf("函数调用失败: %w", err), nil
-					}
-					// 设置退出标志，保持对话结构完整
-					shouldExit = true
-					stop_reason = "max_function_calling_nums"
-					break
-				}
-
-				if err := cm.HandleToolCall(ctx, provider, toolCall, info_chan); err != nil {
-					stop_reason = "error"
-					return nil, stop_reason, fmt.Errorf("函数调用失败: %w", err), nil
+			// 检查是否超过最大函数调用次数
+			if functionCallCount > cm.MaxFunctionCallingNums && !cm.confirmOverLimit(ctx, toolCall, functionCallCount) {
+				// 超过阈值，按ToolLimitPolicy处理本批次剩余的工具调用，结果不再发送，直接退出循环
+				if err := cm.handleOverLimit(ctx, provider, pending[i:], info_chan); err != nil {
+					return general.StopReasonError, cm.errorf(err, MsgErrToolCall, err)
 				}
+				// 设置退出标志，保持对话结构完整
+				shouldExit = true
+				stop_reason = general.StopReasonMaxFunctionCalls
+				break
 			}
 
-			// 继续下一轮对话处理函数调用结果
-		} else {
-			break
+			toolStart := time.Now()
+			span := cm.startToolSpan(toolCall)
+			err := cm.HandleToolCall(ctx, provider, toolCall, info_chan)
+			cm.endToolSpan(span, toolCall, err)
+			cm.runLog.toolCall(toolCall, time.Since(toolStart), err)
+			if err != nil && !cm.recoverToolError(ctx, toolCall, err, info_chan) {
+				return general.StopReasonError, cm.errorf(err, MsgErrToolCall, err)
+			}
+			if err := cm.saveCheckpoint(ctx, provider, model, startIndex, functionCallCount, pending[i+1:]); err != nil {
+				return general.StopReasonError, err
+			}
 		}
+		pending = nil
+		// 工具产生的截图在所有工具结果之后加入对话
+		cm.flushToolImages(ctx, info_chan)
+
+		// 继续下一轮对话处理函数调用结果
 	}
-	// 执行成功，标记成功
-	success = true
-	return cm.history[HistoryLength:], stop_reason, nil, cm.TotalUsage
+	return stop_reason, nil
 }
@@ -0,0 +1,128 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// Checkpoint 进行中的工具循环的状态，可以序列化为JSON持久化，用于中断后通过Resume从中断处继续
+type Checkpoint struct {
+	SessionID         string             `json:"session_id"`
+	Turn              int                `json:"turn"`
+	Provider          general.Provider   `json:"provider"`
+	Model             string             `json:"model"`
+	History           []general.Message  `json:"history"`                      // 截至检查点的完整历史，包含本轮已完成的工具结果
+	StartIndex        int                `json:"start_index"`                  // 本轮开始前的历史长度，History[StartIndex:]为本轮产生的消息
+	PendingToolCalls  []general.ToolCall `json:"pending_tool_calls,omitempty"` // 最后一条助手消息中尚未执行的工具调用
+	FunctionCallCount int                `json:"function_call_count"`          // 本轮已执行的函数调用次数
+	CreatedAt         time.Time          `json:"created_at"`
+}
+
+// CheckpointSaver 保存检查点的函数，返回错误时对话中止
+type CheckpointSaver func(ctx context.Context, checkpoint Checkpoint) error
+
+// SetCheckpointSaver 设置检查点保存函数，为nil时不保存
+// 工具循环在收到带工具调用的回复后、以及每个工具调用完成后保存一次检查点
+func (cm *ConversationManager) SetCheckpointSaver(saver CheckpointSaver) {
+	cm.checkpointSaver = saver
+}
+
+// FileCheckpointSaver 返回将检查点以JSON写入指定文件的保存函数，先写临时文件再重命名，中断时不会留下不完整的文件
+func FileCheckpointSaver(path string) CheckpointSaver {
+	return func(ctx context.Context, checkpoint Checkpoint) error {
+		data, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+}
+
+// LoadCheckpointFile 读取FileCheckpointSaver保存的检查点
+func LoadCheckpointFile(path string) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return checkpoint, fmt.Errorf("读取检查点失败: %w", err)
+	}
+	if isEncrypted(data) {
+		return checkpoint, fmt.Errorf("检查点 %s: %w，请使用LoadEncryptedCheckpointFile", path, ErrEncrypted)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("解析检查点失败: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint 保存当前工具循环的检查点
+func (cm *ConversationManager) saveCheckpoint(ctx context.Context, provider general.Provider, model string, startIndex int, functionCallCount int, pending []general.ToolCall) error {
+	if cm.checkpointSaver == nil {
+		return nil
+	}
+	checkpoint := Checkpoint{
+		SessionID:         cm.sessionID,
+		Turn:              cm.turn,
+		Provider:          provider,
+		Model:             model,
+		History:           append([]general.Message(nil), cm.history...),
+		StartIndex:        startIndex,
+		PendingToolCalls:  append([]general.ToolCall(nil), pending...),
+		FunctionCallCount: functionCallCount,
+		CreatedAt:         time.Now(),
+	}
+	if err := cm.checkpointSaver(ctx, checkpoint); err != nil {
+		return fmt.Errorf("保存检查点失败: %w", err)
+	}
+	return nil
+}
+
+// Resume 从检查点恢复中断的工具循环：先执行尚未完成的工具调用，再继续请求模型直到对话结束
+// 恢复时会用检查点替换当前的历史记录、会话ID和对话轮次，返回值与Chat相同，消息从本轮的用户消息开始
+func (cm *ConversationManager) Resume(ctx context.Context, checkpoint Checkpoint, info_chan chan general.Message) ([]general.Message, general.StopReason, error, *general.Usage) {
+	if checkpoint.StartIndex < 0 || checkpoint.StartIndex > len(checkpoint.History) {
+		return nil, general.StopReasonError, fmt.Errorf("检查点无效: 起始位置 %d 超出历史长度 %d", checkpoint.StartIndex, len(checkpoint.History)), nil
+	}
+
+	// 登记进行中的对话，Shutdown时取消
+	ctx, endChat, err := cm.beginChat(ctx)
+	if err != nil {
+		return nil, general.StopReasonError, err, nil
+	}
+	defer endChat()
+	// 返回前投递完排队的消息，之后调用方可以关闭info_chan
+	defer cm.flushDeliveries(info_chan)
+
+	previous := cm.history
+	success := false
+	defer func() {
+		// 如果失败，恢复调用前的历史记录，检查点仍可再次用于恢复
+		if !success {
+			cm.setHistory(context.WithoutCancel(ctx), previous)
+		}
+	}()
+
+	cm.setHistory(ctx, append([]general.Message(nil), checkpoint.History...))
+	cm.provider = checkpoint.Provider
+	cm.turn = checkpoint.Turn
+	if checkpoint.SessionID != "" {
+		cm.sessionID = checkpoint.SessionID
+	}
+
+	cm.beginTrace(checkpoint.Provider, checkpoint.Model, checkpoint.PendingToolCalls)
+	stop_reason, err := cm.runToolLoop(ctx, checkpoint.Provider, checkpoint.Model, checkpoint.StartIndex, checkpoint.FunctionCallCount, checkpoint.PendingToolCalls, info_chan)
+	cm.endTrace(checkpoint.StartIndex, stop_reason, err)
+	if err != nil {
+		return nil, stop_reason, err, nil
+	}
+	success = true
+	return cm.historyView()[checkpoint.StartIndex:], stop_reason, nil, cm.TotalUsage
+}
@@ -0,0 +1,85 @@
+package ConversationManager
+
+import (
+	"fmt"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// minElidedToolResultSize 小于该字节数的工具结果不压缩，摘要不会比原内容短多少
+const minElidedToolResultSize = 256
+
+// SetToolResultCompression 设置工具结果压缩：早于最近afterTurns轮对话的工具结果替换为摘要（如"[result elided, 14KB]"）
+// 工具调用和结果的对应关系保持不变，afterTurns为0时不压缩
+func (cm *ConversationManager) SetToolResultCompression(afterTurns int) {
+	cm.CompressToolResults = afterTurns
+}
+
+// compressToolResults 将早于最近CompressToolResults轮对话的工具结果替换为摘要，返回新的历史记录
+// 被修改的消息会复制一份，不影响历史快照和外部持有的消息
+func (cm *ConversationManager) compressToolResults(messages []general.Message) []general.Message {
+	if cm.CompressToolResults <= 0 || len(messages) == 0 {
+		return messages
+	}
+
+	units := cm.identifySafeUnits("", messages)
+	compressed := messages
+	copied := false
+	turns := 0
+	for i := len(units) - 1; i >= 0; i-- {
+		unit := units[i]
+		if turns >= cm.CompressToolResults {
+			for j := unit.StartIndex; j <= unit.EndIndex; j++ {
+				msg, changed := elideToolResults(messages[j])
+				if !changed {
+					continue
+				}
+				if !copied {
+					compressed = make([]general.Message, len(messages))
+					copy(compressed, messages)
+					copied = true
+				}
+				compressed[j] = msg
+			}
+		}
+		if unit.UnitType != "context" {
+			turns++
+		}
+	}
+	return compressed
+}
+
+// elideToolResults 将消息中较大的工具结果替换为摘要，返回新消息和是否有修改
+func elideToolResults(msg general.Message) (general.Message, bool) {
+	if msg.Role != general.RoleTool {
+		return msg, false
+	}
+	var content []general.Content
+	for i, c := range msg.Content {
+		if c.Type != general.ContentTypeToolRes || len(c.Text) < minElidedToolResultSize {
+			continue
+		}
+		if content == nil {
+			content = make([]general.Content, len(msg.Content))
+			copy(content, msg.Content)
+		}
+		content[i].Text = fmt.Sprintf("[result elided, %s]", formatSize(len(c.Text)))
+	}
+	if content == nil {
+		return msg, false
+	}
+	msg.Content = content
+	return msg, true
+}
+
+// formatSize 格式化字节数，如 812B、14KB、1.2MB
+func formatSize(size int) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%dB", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%dKB", (size+512)/1024)
+	default:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1024*1024))
+	}
+}
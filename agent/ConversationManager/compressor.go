@@ -0,0 +1,254 @@
+package ConversationManager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// Compressor 文本压缩器，将过长的工具结果或文档压缩到目标token数以内
+type Compressor interface {
+	Compress(ctx context.Context, text string, targetTokens int) (string, error)
+}
+
+// CompressorFunc 将函数适配为Compressor
+type CompressorFunc func(ctx context.Context, text string, targetTokens int) (string, error)
+
+// Compress 调用函数本身
+func (f CompressorFunc) Compress(ctx context.Context, text string, targetTokens int) (string, error) {
+	return f(ctx, text, targetTokens)
+}
+
+// SetPromptCompression 设置工具结果和文本附件的压缩，估算超过targetTokens的内容在加入历史前用compressor压缩
+// compressor为nil或targetTokens小于等于0时关闭压缩，压缩失败时保留原文
+func (cm *ConversationManager) SetPromptCompression(compressor Compressor, targetTokens int) {
+	if compressor == nil || targetTokens <= 0 {
+		cm.compressor = nil
+		cm.compressTarget = 0
+		return
+	}
+	cm.compressor = compressor
+	cm.compressTarget = targetTokens
+}
+
+// CompressText 用设置的压缩器压缩文本，用于在注入检索到的文档前手动压缩，未超过目标token数或未设置压缩器时原样返回
+func (cm *ConversationManager) CompressText(ctx context.Context, text string) string {
+	if cm.compressor == nil || cm.CalculateTokens(text) <= cm.compressTarget {
+		return text
+	}
+	compressed, err := cm.compressor.Compress(ctx, text, cm.compressTarget)
+	if err != nil || compressed == "" || cm.CalculateTokens(compressed) >= cm.CalculateTokens(text) {
+		return text
+	}
+	return cm.text(MsgCompressed, cm.CalculateTokens(text), compressed)
+}
+
+// compressAttachments 压缩待发送附件中的文本内容，返回新的切片
+func (cm *ConversationManager) compressAttachments(ctx context.Context, attachments []general.Content) []general.Content {
+	if cm.compressor == nil {
+		return attachments
+	}
+	result := make([]general.Content, len(attachments))
+	for i, content := range attachments {
+		if content.Type == general.ContentTypeText {
+			content.Text = cm.CompressText(ctx, content.Text)
+		}
+		result[i] = content
+	}
+	return result
+}
+
+// ExtractiveCompressor 抽取式压缩器：按词频为句子打分，保留得分最高的句子并保持原文顺序，不需要请求模型
+type ExtractiveCompressor struct{}
+
+// Compress 抽取得分最高的句子，使估算的token数不超过targetTokens
+func (ExtractiveCompressor) Compress(ctx context.Context, text string, targetTokens int) (string, error) {
+	sentences := splitSentences(text)
+	if len(sentences) == 0 {
+		return text, nil
+	}
+
+	// 统计词频，英文按单词、中文按单字计，重复的句子只统计和保留一次
+	freq := make(map[string]int)
+	words := make([][]string, len(sentences))
+	seen := make(map[string]bool)
+	for i, sentence := range sentences {
+		key := strings.TrimSpace(sentence)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		words[i] = sentenceWords(sentence)
+		for _, word := range words[i] {
+			freq[word]++
+		}
+	}
+
+	type scored struct {
+		index int
+		score float64
+	}
+	ranked := make([]scored, len(sentences))
+	for i := range sentences {
+		total := 0
+		for _, word := range words[i] {
+			total += freq[word]
+		}
+		score := 0.0
+		if len(words[i]) > 0 {
+			score = float64(total) / float64(len(words[i]))
+		}
+		// 开头的句子通常是概述
+		if i == 0 {
+			score *= 1.5
+		}
+		ranked[i] = scored{index: i, score: score}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	keep := make([]bool, len(sentences))
+	used := 0
+	for _, item := range ranked {
+		tokens := estimateTokens(sentences[item.index])
+		if len(words[item.index]) == 0 || used+tokens > targetTokens {
+			continue
+		}
+		keep[item.index] = true
+		used += tokens
+	}
+
+	var b strings.Builder
+	skipped := false
+	for i, sentence := range sentences {
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped && b.Len() > 0 {
+			b.WriteString("……")
+		}
+		skipped = false
+		b.WriteString(sentence)
+	}
+	if b.Len() == 0 {
+		// 没有句子能放下时截取开头
+		return truncateRunes(text, targetTokens*2), nil
+	}
+	return b.String(), nil
+}
+
+// ModelCompressor 使用模型（通常是便宜的小模型）对文本进行摘要式压缩
+type ModelCompressor struct {
+	manager  *general.AgentManager
+	provider general.Provider
+	model    string
+	locale   Locale // 压缩提示词使用的语言，为空时使用英文
+}
+
+// NewModelCompressor 创建使用指定提供商和模型的压缩器
+func NewModelCompressor(manager *general.AgentManager, provider general.Provider, model string) *ModelCompressor {
+	return &ModelCompressor{manager: manager, provider: provider, model: model}
+}
+
+// SetLocale 设置压缩提示词使用的语言，默认为英文
+func (c *ModelCompressor) SetLocale(locale Locale) {
+	c.locale = locale
+}
+
+// Compress 请求模型在保留关键事实的前提下将文本压缩到targetTokens以内
+func (c *ModelCompressor) Compress(ctx context.Context, text string, targetTokens int) (string, error) {
+	prompt := Localize(c.locale, MsgCompressPrompt, targetTokens, text)
+	req := &general.ChatRequest{
+		Model: c.model,
+		Messages: []general.Message{
+			{Role: general.RoleUser, Content: []general.Content{{Type: general.ContentTypeText, Text: prompt}}},
+		},
+		MaxTokens: targetTokens * 2,
+	}
+	resp, err := c.manager.Chat(ctx, c.provider, req)
+	if err != nil {
+		return "", fmt.Errorf("压缩请求失败: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("压缩请求没有返回内容")
+	}
+	return strings.TrimSpace(messageText(resp.Choices[0].Message)), nil
+}
+
+// splitSentences 按句末标点和换行切分句子，句子保留结尾的标点和空白
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		if i < start {
+			continue
+		}
+		end := false
+		switch r {
+		case '。', '！', '？', '；', '\n':
+			end = true
+		case '.', '!', '?', ';':
+			end = i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+		}
+		if !end {
+			continue
+		}
+		// 连续的空白归入当前句子
+		j := i + 1
+		for j < len(runes) && unicode.IsSpace(runes[j]) {
+			j++
+		}
+		if sentence := string(runes[start:j]); strings.TrimSpace(sentence) != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = j
+	}
+	if start < len(runes) {
+		if sentence := string(runes[start:]); strings.TrimSpace(sentence) != "" {
+			sentences = append(sentences, sentence)
+		}
+	}
+	return sentences
+}
+
+// sentenceWords 将句子切分为用于统计词频的词，英文和数字按连续字符、中日韩文字按单字
+func sentenceWords(sentence string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 1 {
+			words = append(words, strings.ToLower(string(current)))
+		}
+		current = current[:0]
+	}
+	for _, r := range sentence {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			current = append(current, r)
+		case unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, string(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// truncateRunes 截取文本开头的n个字符
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n])
+}
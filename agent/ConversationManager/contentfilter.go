@@ -0,0 +1,31 @@
+package ConversationManager
+
+import (
+	"context"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ContentFilterHook 内容被提供商安全策略拦截时的回调
+// 参数为本轮的用户消息和提供商返回的结束原因，返回处理后的用户消息和true时使用该消息自动重试一次
+type ContentFilterHook func(ctx context.Context, userMessage general.Message, finishReason string) (general.Message, bool)
+
+// SetContentFilterHook 设置内容过滤回调，为nil时被拦截的对话直接以content_filter结束
+func (cm *ConversationManager) SetContentFilterHook(hook ContentFilterHook) {
+	cm.contentFilterHook = hook
+}
+
+// retryAfterContentFilter 调用内容过滤回调，需要重试时用处理后的用户消息替换本轮的历史记录
+func (cm *ConversationManager) retryAfterContentFilter(ctx context.Context, userIndex int, finishReason string) bool {
+	if cm.contentFilterHook == nil || userIndex >= len(cm.history) || cm.history[userIndex].Role != general.RoleUser {
+		return false
+	}
+	sanitized, retry := cm.contentFilterHook(ctx, cm.history[userIndex], finishReason)
+	if !retry {
+		return false
+	}
+	sanitized.Role = general.RoleUser
+	cm.restoreHistory(ctx, cm.history[:userIndex])
+	cm.appendMessage(ctx, sanitized)
+	return true
+}
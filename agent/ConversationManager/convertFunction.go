@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 // convertReturnValueToString 将函数返回值安全转换为字符串
@@ -226,8 +229,171 @@ func ConvertInterfaceToType(value interface{}, targetType reflect.Type) (reflect
 		}
 		return reflect.Value{}, errors.New("无法转换为 float64 类型")
 
-	// 暂时不支持复合类型 (array, slice, map)，可以后续扩展
+	// 复合类型逐个转换元素（可变参数函数的最后一个参数也是切片）
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return convertComposite(value, targetType, ConvertInterfaceToType)
+
+	// 接口类型（如interface{}）直接保存JSON解析后的值
+	case reflect.Interface:
+		if !reflect.TypeOf(value).Implements(targetType) {
+			return reflect.Value{}, errors.New("无法转换为 " + targetType.String() + " 类型")
+		}
+		result := reflect.New(targetType).Elem()
+		result.Set(reflect.ValueOf(value))
+		return result, nil
+
 	default:
 		return reflect.Value{}, errors.New("不支持的类型转换: " + targetType.String())
 	}
 }
+
+// convertComposite 将JSON数组转换为切片或数组、JSON对象转换为键为字符串的map，元素使用convert转换
+func convertComposite(value interface{}, targetType reflect.Type, convert func(interface{}, reflect.Type) (reflect.Value, error)) (reflect.Value, error) {
+	switch targetType.Kind() {
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return reflect.Value{}, errors.New("无法转换为 " + targetType.String() + " 类型")
+		}
+		var result reflect.Value
+		if targetType.Kind() == reflect.Slice {
+			result = reflect.MakeSlice(targetType, len(items), len(items))
+		} else {
+			if len(items) > targetType.Len() {
+				return reflect.Value{}, fmt.Errorf("无法转换为 %s 类型: 元素数量 %d 超过长度", targetType.String(), len(items))
+			}
+			result = reflect.New(targetType).Elem()
+		}
+		for i, item := range items {
+			converted, err := convert(item, targetType.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("转换第 %d 个元素失败: %w", i, err)
+			}
+			result.Index(i).Set(converted.Convert(targetType.Elem()))
+		}
+		return result, nil
+
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok || targetType.Key().Kind() != reflect.String {
+			return reflect.Value{}, errors.New("无法转换为 " + targetType.String() + " 类型")
+		}
+		result := reflect.MakeMapWithSize(targetType, len(object))
+		for key, item := range object {
+			converted, err := convert(item, targetType.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("转换 %s 失败: %w", key, err)
+			}
+			result.SetMapIndex(reflect.ValueOf(key).Convert(targetType.Key()), converted.Convert(targetType.Elem()))
+		}
+		return result, nil
+	}
+	return reflect.Value{}, errors.New("不支持的类型转换: " + targetType.String())
+}
+
+// isVariadicParam 判断第i个参数是否为可变参数
+func isVariadicParam(fnType reflect.Type, i int) bool {
+	return fnType.IsVariadic() && i == fnType.NumIn()-1
+}
+
+// parameterSchema 生成参数的JSON Schema，数组类型包含items
+func parameterSchema(paramType reflect.Type, description string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":        ConvertToJSONSchemaType(paramType),
+		"description": description,
+	}
+	if paramType.Kind() == reflect.Array || paramType.Kind() == reflect.Slice {
+		schema["items"] = map[string]interface{}{
+			"type": ConvertToJSONSchemaType(paramType.Elem()),
+		}
+	}
+	return schema
+}
+
+// ConvertInterfaceToTypeLenient 与ConvertInterfaceToType相同，但允许模型常见的类型偏差：
+// 字符串形式的数字和布尔值（"5"、"2.5"、"true"、"yes"）、数字形式的布尔值（0、1）、数字和布尔值转换为字符串，
+// 字符串形式的数字转换为整数时小数部分必须为0（如"5.0"），超出范围时返回错误
+func ConvertInterfaceToTypeLenient(value interface{}, targetType reflect.Type) (reflect.Value, error) {
+	if converted, err := ConvertInterfaceToType(value, targetType); err == nil {
+		return converted, nil
+	}
+
+	switch targetType.Kind() {
+	case reflect.Bool:
+		switch v := value.(type) {
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "yes", "y", "on", "1":
+				return reflect.ValueOf(true), nil
+			case "false", "no", "n", "off", "0":
+				return reflect.ValueOf(false), nil
+			}
+		case float64:
+			if v == 0 || v == 1 {
+				return reflect.ValueOf(v == 1), nil
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("无法将 %v 转换为 bool 类型", value)
+
+	case reflect.String:
+		switch v := value.(type) {
+		case float64:
+			return reflect.ValueOf(strconv.FormatFloat(v, 'f', -1, 64)), nil
+		case bool:
+			return reflect.ValueOf(strconv.FormatBool(v)), nil
+		}
+		return reflect.Value{}, fmt.Errorf("无法将 %v 转换为 string 类型", value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		number, err := lenientNumber(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("无法转换为 %s 类型: %w", targetType.Kind(), err)
+		}
+		if number != math.Trunc(number) {
+			return reflect.Value{}, fmt.Errorf("无法转换为 %s 类型: %v 不是整数", targetType.Kind(), value)
+		}
+		result := reflect.New(targetType).Elem()
+		switch {
+		case targetType.Kind() >= reflect.Uint:
+			if number < 0 || result.OverflowUint(uint64(number)) {
+				return reflect.Value{}, fmt.Errorf("无法转换为 %s 类型: %v 超出范围", targetType.Kind(), value)
+			}
+			result.SetUint(uint64(number))
+		default:
+			if number < math.MinInt64 || number >= math.MaxInt64 || result.OverflowInt(int64(number)) {
+				return reflect.Value{}, fmt.Errorf("无法转换为 %s 类型: %v 超出范围", targetType.Kind(), value)
+			}
+			result.SetInt(int64(number))
+		}
+		return result, nil
+
+	case reflect.Float32, reflect.Float64:
+		number, err := lenientNumber(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("无法转换为 %s 类型: %w", targetType.Kind(), err)
+		}
+		result := reflect.New(targetType).Elem()
+		result.SetFloat(number)
+		return result, nil
+
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return convertComposite(value, targetType, ConvertInterfaceToTypeLenient)
+	}
+	return ConvertInterfaceToType(value, targetType)
+}
+
+// lenientNumber 读取数字或字符串形式的数字
+func lenientNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q 不是数字", v)
+		}
+		return number, nil
+	}
+	return 0, fmt.Errorf("%v 不是数字", value)
+}
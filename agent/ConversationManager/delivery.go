@@ -0,0 +1,231 @@
+package ConversationManager
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// DeliveryPolicy info_chan和事件通道的投递策略
+type DeliveryPolicy int
+
+const (
+	// DeliveryBuffer 默认策略，通道满时放入内部队列，由后台goroutine按顺序投递，不阻塞对话
+	// Chat返回前等待队列投递完成（最多DeliveryFlushTimeout），之后不再向通道发送，调用方可以安全地关闭info_chan
+	DeliveryBuffer DeliveryPolicy = iota
+	// DeliveryDrop 通道满时直接丢弃
+	DeliveryDrop
+	// DeliveryBlockWithTimeout 阻塞等待接收方，超过超时时间后丢弃
+	DeliveryBlockWithTimeout
+	// DeliveryBlock 一直阻塞直到接收方读取（旧版行为，接收方不读取时对话会卡住）
+	DeliveryBlock
+)
+
+const (
+	// defaultDeliveryTimeout DeliveryBlockWithTimeout未指定超时时间时的默认值
+	defaultDeliveryTimeout = time.Second
+	// DefaultDeliveryQueueLimit DeliveryBuffer下每个通道最多排队的消息数，超过时丢弃新消息
+	DefaultDeliveryQueueLimit = 1000
+	// DeliveryFlushTimeout Chat返回前等待队列投递完成的最长时间，超时后丢弃剩余的消息
+	DeliveryFlushTimeout = 5 * time.Second
+)
+
+// delivery 投递状态
+type delivery struct {
+	dropped atomic.Int64
+
+	mu         sync.Mutex
+	policy     DeliveryPolicy
+	timeout    time.Duration
+	queueLimit int
+	senders    map[interface{}]deliverySender // 通道 -> *queuedSender
+}
+
+// deliverySender 不同元素类型的投递队列的共同操作
+type deliverySender interface {
+	stop() int
+	finished() <-chan struct{}
+}
+
+// queuedSender 单个通道的缓冲投递队列
+type queuedSender[T any] struct {
+	ch      chan T
+	queue   []T
+	running bool
+	done    chan struct{} // 投递goroutine退出时关闭
+	stopped chan struct{} // 关闭后投递goroutine放弃正在发送的消息并退出
+}
+
+func newDelivery() *delivery {
+	return &delivery{
+		policy:     DeliveryBuffer,
+		queueLimit: DefaultDeliveryQueueLimit,
+		senders:    make(map[interface{}]deliverySender),
+	}
+}
+
+// SetDeliveryPolicy 设置info_chan和事件通道的投递策略，timeout仅对DeliveryBlockWithTimeout生效
+func (cm *ConversationManager) SetDeliveryPolicy(policy DeliveryPolicy, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultDeliveryTimeout
+	}
+	cm.delivery.mu.Lock()
+	defer cm.delivery.mu.Unlock()
+	cm.delivery.policy = policy
+	cm.delivery.timeout = timeout
+}
+
+// SetDeliveryQueueLimit 设置DeliveryBuffer下每个通道最多排队的消息数，小于等于0时使用DefaultDeliveryQueueLimit
+func (cm *ConversationManager) SetDeliveryQueueLimit(limit int) {
+	if limit <= 0 {
+		limit = DefaultDeliveryQueueLimit
+	}
+	cm.delivery.mu.Lock()
+	defer cm.delivery.mu.Unlock()
+	cm.delivery.queueLimit = limit
+}
+
+// DroppedDeliveries 获取因通道满、队列满或超时而被丢弃的消息和事件数量
+func (cm *ConversationManager) DroppedDeliveries() int64 {
+	return cm.delivery.dropped.Load()
+}
+
+// deliverInfo 按投递策略向info_chan发送消息
+func (cm *ConversationManager) deliverInfo(info_chan chan general.Message, msg general.Message) {
+	if info_chan == nil {
+		return
+	}
+	deliver(cm.delivery, info_chan, msg)
+}
+
+// flushDeliveries 在Chat返回前等待info_chan和事件通道的队列投递完成，超过DeliveryFlushTimeout时丢弃剩余的消息
+// 返回后不再有后台goroutine向这些通道发送
+func (cm *ConversationManager) flushDeliveries(info_chan chan general.Message) {
+	deadline := time.Now().Add(DeliveryFlushTimeout)
+	if info_chan != nil {
+		cm.delivery.flush(info_chan, deadline)
+	}
+	if cm.events != nil {
+		cm.delivery.flush(cm.events, deadline)
+	}
+}
+
+// deliver 按投递策略向通道发送数据
+func deliver[T any](d *delivery, ch chan T, value T) {
+	d.mu.Lock()
+	policy, timeout := d.policy, d.timeout
+	d.mu.Unlock()
+
+	switch policy {
+	case DeliveryBlock:
+		ch <- value
+	case DeliveryDrop:
+		select {
+		case ch <- value:
+		default:
+			d.dropped.Add(1)
+		}
+	case DeliveryBlockWithTimeout:
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case ch <- value:
+		case <-timer.C:
+			d.dropped.Add(1)
+		}
+	default:
+		enqueue(d, ch, value)
+	}
+}
+
+// enqueue 将数据放入通道的缓冲队列，必要时启动后台投递goroutine，队列已满时丢弃
+func enqueue[T any](d *delivery, ch chan T, value T) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sender, ok := d.senders[ch].(*queuedSender[T])
+	if !ok {
+		// 通道有空间且没有排队的消息时直接发送，不启动goroutine
+		select {
+		case ch <- value:
+			return
+		default:
+		}
+		sender = &queuedSender[T]{ch: ch, done: make(chan struct{}), stopped: make(chan struct{})}
+		d.senders[ch] = sender
+	}
+	if len(sender.queue) >= d.queueLimit {
+		d.dropped.Add(1)
+		return
+	}
+	sender.queue = append(sender.queue, value)
+	if !sender.running {
+		sender.running = true
+		go drain(d, sender)
+	}
+}
+
+// drain 按顺序投递队列中的数据，队列为空或被停止时退出并释放队列
+func drain[T any](d *delivery, sender *queuedSender[T]) {
+	defer close(sender.done)
+	for {
+		d.mu.Lock()
+		if len(sender.queue) == 0 {
+			sender.running = false
+			if d.senders[sender.ch] == sender {
+				delete(d.senders, sender.ch)
+			}
+			d.mu.Unlock()
+			return
+		}
+		value := sender.queue[0]
+		sender.queue = sender.queue[1:]
+		d.mu.Unlock()
+
+		select {
+		case sender.ch <- value:
+		case <-sender.stopped:
+			d.dropped.Add(1)
+			return
+		}
+	}
+}
+
+// flush 等待通道的队列投递完成，deadline之后丢弃剩余的消息并停止投递goroutine
+func (d *delivery) flush(ch interface{}, deadline time.Time) {
+	d.mu.Lock()
+	sender, ok := d.senders[ch]
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-sender.finished():
+		return
+	case <-timer.C:
+	}
+	d.mu.Lock()
+	if d.senders[ch] == sender {
+		delete(d.senders, ch)
+	}
+	d.dropped.Add(int64(sender.stop()))
+	d.mu.Unlock()
+	<-sender.finished()
+}
+
+// stop 清空队列并停止投递goroutine，返回丢弃的消息数，调用方持有锁
+func (s *queuedSender[T]) stop() int {
+	dropped := len(s.queue)
+	s.queue = nil
+	close(s.stopped)
+	return dropped
+}
+
+func (s *queuedSender[T]) finished() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,118 @@
+package ConversationManager
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// draftApproval 校验通过时强模型的回复
+const draftApproval = "APPROVE"
+
+// draftVerifyMaxTokens 校验请求的最大输出token数，只需要回复APPROVE或REJECT
+const draftVerifyMaxTokens = 64
+
+// DraftStats 草稿模式的统计
+type DraftStats struct {
+	Drafts   int // 生成的草稿数量
+	Approved int // 通过校验并直接使用的草稿数量
+}
+
+// SetDraftModel 设置草稿模型，开启两阶段模式：每次请求先由便宜的草稿模型生成回复（包括工具调用），
+// 再由Chat指定的强模型校验，校验通过时直接使用草稿，否则由强模型重新生成。provider为空时关闭草稿模式
+// 简单的轮次只需强模型读取上下文并输出很少的token，复杂的轮次仍由强模型回答
+func (cm *ConversationManager) SetDraftModel(provider general.Provider, model string) {
+	if provider == "" {
+		cm.draftModel = nil
+		return
+	}
+	cm.draftModel = &EnsembleTarget{Provider: provider, Model: model}
+}
+
+// GetDraftStats 获取草稿模式的统计
+func (cm *ConversationManager) GetDraftStats() DraftStats {
+	return cm.draftStats
+}
+
+// requestReply 请求模型回复，开启草稿模式时先尝试草稿，返回实际生成回复的提供商和模型
+func (cm *ConversationManager) requestReply(ctx context.Context, provider general.Provider, model string, req *general.ChatRequest) (*general.ChatResponse, general.Provider, string, error) {
+	cm.replyStreamed = false
+	if cm.canStreamReply(provider, req) {
+		resp, err := cm.streamReply(ctx, provider, req)
+		return resp, provider, model, err
+	}
+	if cm.draftModel != nil {
+		if resp, ok := cm.draftReply(ctx, provider, model, req); ok {
+			return resp, cm.draftModel.Provider, cm.draftModel.Model, nil
+		}
+	}
+	resp, err := cm.manager.Chat(ctx, provider, req)
+	return resp, provider, model, err
+}
+
+// draftReply 由草稿模型生成回复并交给强模型校验，草稿失败或未通过校验时返回false
+func (cm *ConversationManager) draftReply(ctx context.Context, provider general.Provider, model string, req *general.ChatRequest) (*general.ChatResponse, bool) {
+	draft := cm.draftModel
+	draftReq := *req
+	draftReq.Model = draft.Model
+	resp, err := cm.manager.Chat(ctx, draft.Provider, &draftReq)
+	if err != nil || len(resp.Choices) == 0 {
+		return nil, false
+	}
+	cm.draftStats.Drafts++
+
+	// 被拦截或被截断的草稿直接交给强模型
+	choice := resp.Choices[0]
+	if choice.NormalizedFinishReason == general.FinishReasonContentFilter || choice.NormalizedFinishReason == general.FinishReasonLength {
+		cm.recordExtraUsage(draft.Provider, draftReq.Model, resp.Usage)
+		return nil, false
+	}
+
+	if !cm.verifyDraft(ctx, provider, model, req, choice.Message) {
+		cm.recordExtraUsage(draft.Provider, draftReq.Model, resp.Usage)
+		return nil, false
+	}
+	cm.draftStats.Approved++
+	return resp, true
+}
+
+// verifyDraft 请求强模型校验草稿，只有明确回复APPROVE时才算通过
+func (cm *ConversationManager) verifyDraft(ctx context.Context, provider general.Provider, model string, req *general.ChatRequest, draft general.Message) bool {
+	messages := make([]general.Message, 0, len(req.Messages)+1)
+	messages = append(messages, req.Messages...)
+	messages = append(messages, general.Message{
+		Role:    general.RoleUser,
+		Content: []general.Content{{Type: general.ContentTypeText, Text: cm.draftVerifyPrompt(draft)}},
+	})
+
+	verifyReq := *req
+	verifyReq.Messages = messages
+	verifyReq.Model = model
+	verifyReq.MaxTokens = draftVerifyMaxTokens
+	verifyReq.Modalities = nil
+	verifyReq.Audio = nil
+	resp, err := cm.manager.Chat(ctx, provider, &verifyReq)
+	if err != nil || len(resp.Choices) == 0 {
+		return false
+	}
+	cm.recordExtraUsage(provider, verifyReq.Model, resp.Usage)
+
+	verdict := resp.Choices[0].Message
+	return len(verdict.ToolCalls) == 0 && strings.HasPrefix(strings.ToUpper(strings.TrimSpace(messageText(verdict))), draftApproval)
+}
+
+// draftVerifyPrompt 生成校验草稿的提示词
+func (cm *ConversationManager) draftVerifyPrompt(draft general.Message) string {
+	var b strings.Builder
+	b.WriteString(cm.text(MsgDraftReviewStart))
+	if text := messageText(draft); text != "" {
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+	for _, toolCall := range draft.ToolCalls {
+		b.WriteString(cm.text(MsgDraftToolCall, toolCall.Function.Name, string(toolCall.Function.Arguments)))
+	}
+	b.WriteString(cm.text(MsgDraftReviewEnd))
+	return b.String()
+}
@@ -0,0 +1,309 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrEncrypted 数据已加密，需要使用对应的Encryptor读取
+var ErrEncrypted = errors.New("数据已加密")
+
+// ErrNotEncrypted 要求加密的数据是明文，可能被替换过；从明文迁移时先用EncryptFile加密原文件
+var ErrNotEncrypted = errors.New("数据未加密")
+
+// 加密数据的格式标识：AES-GCM为magic + 4字节密钥ID + nonce + 密文；信封加密为magic + 2字节长度 + 加密的数据密钥 + nonce + 密文
+var (
+	aesGCMMagic   = []byte("GAE1")
+	envelopeMagic = []byte("GAE2")
+)
+
+// Encryptor 持久化历史（检查点等）的加密层
+type Encryptor interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// AESGCMEncryptor 使用调用方提供的密钥进行AES-GCM加密，支持密钥轮换
+type AESGCMEncryptor struct {
+	current  keyedAEAD
+	previous []keyedAEAD
+}
+
+// keyedAEAD 密钥及其ID（密钥SHA-256的前4字节，用于解密时选择密钥）
+type keyedAEAD struct {
+	id   [4]byte
+	aead cipher.AEAD
+}
+
+// NewAESGCMEncryptor 创建AES-GCM加密器，key为16、24或32字节（AES-128/192/256）
+// oldKeys为轮换前使用的密钥，只用于解密旧数据，新数据总是用key加密
+func NewAESGCMEncryptor(key []byte, oldKeys ...[]byte) (*AESGCMEncryptor, error) {
+	current, err := newKeyedAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	e := &AESGCMEncryptor{current: current}
+	for _, old := range oldKeys {
+		previous, err := newKeyedAEAD(old)
+		if err != nil {
+			return nil, fmt.Errorf("旧密钥无效: %w", err)
+		}
+		e.previous = append(e.previous, previous)
+	}
+	return e, nil
+}
+
+// Encrypt 加密数据
+func (e *AESGCMEncryptor) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(aesGCMMagic)+4+len(nonce)+len(plaintext)+e.current.aead.Overhead())
+	out = append(out, aesGCMMagic...)
+	out = append(out, e.current.id[:]...)
+	out = append(out, nonce...)
+	return e.current.aead.Seal(out, nonce, plaintext, aesGCMMagic), nil
+}
+
+// Decrypt 解密数据，按数据中的密钥ID选择当前密钥或旧密钥
+func (e *AESGCMEncryptor) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, aesGCMMagic) || len(ciphertext) < len(aesGCMMagic)+4 {
+		return nil, fmt.Errorf("不是AES-GCM加密的数据")
+	}
+	rest := ciphertext[len(aesGCMMagic):]
+	var id [4]byte
+	copy(id[:], rest[:4])
+	rest = rest[4:]
+	for _, key := range append([]keyedAEAD{e.current}, e.previous...) {
+		if key.id != id {
+			continue
+		}
+		nonceSize := key.aead.NonceSize()
+		if len(rest) < nonceSize {
+			return nil, fmt.Errorf("加密数据不完整")
+		}
+		plaintext, err := key.aead.Open(nil, rest[:nonceSize], rest[nonceSize:], aesGCMMagic)
+		if err != nil {
+			return nil, fmt.Errorf("解密失败: %w", err)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("没有匹配的密钥")
+}
+
+// newKeyedAEAD 创建AES-GCM
+func newKeyedAEAD(key []byte) (keyedAEAD, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return keyedAEAD{}, err
+	}
+	sum := sha256.Sum256(key)
+	var k keyedAEAD
+	copy(k.id[:], sum[:4])
+	k.aead = aead
+	return k, nil
+}
+
+// newGCM 创建AES-GCM，key为16、24或32字节
+func newGCM(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("AES密钥长度应为16、24或32字节，实际为%d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KMS 密钥管理服务的接入点，用于信封加密：数据由随机数据密钥加密，数据密钥由KMS的主密钥加密后与数据一起保存
+// 可以对接AWS KMS、阿里云KMS、Vault Transit等
+type KMS interface {
+	// GenerateDataKey 生成一个32字节的数据密钥，返回明文和被主密钥加密后的密文
+	GenerateDataKey(ctx context.Context) (plaintext, encrypted []byte, err error)
+	// DecryptDataKey 解密数据密钥
+	DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error)
+}
+
+// EnvelopeEncryptor 通过KMS进行信封加密，每次加密使用新的数据密钥，主密钥不离开KMS
+// 需要频繁加密时用CacheDataKey复用一个数据密钥
+type EnvelopeEncryptor struct {
+	kms KMS
+}
+
+// NewEnvelopeEncryptor 创建信封加密器
+func NewEnvelopeEncryptor(kms KMS) *EnvelopeEncryptor {
+	return &EnvelopeEncryptor{kms: kms}
+}
+
+// DataKeyCache 可以复用同一个数据密钥的加密器，Journal为每个日志获取一次，避免每条记录都生成新的数据密钥
+type DataKeyCache interface {
+	// CacheDataKey 返回复用同一个数据密钥的加密器，写出的数据仍可用原加密器解密
+	CacheDataKey(ctx context.Context) (Encryptor, error)
+}
+
+// CacheDataKey 通过KMS生成一个数据密钥，返回的加密器用它加密所有数据，只在本次调用时请求KMS
+func (e *EnvelopeEncryptor) CacheDataKey(ctx context.Context) (Encryptor, error) {
+	dataKey, encryptedKey, err := e.kms.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("生成数据密钥失败: %w", err)
+	}
+	return newCachedEnvelope(e, dataKey, encryptedKey)
+}
+
+// Encrypt 生成数据密钥并加密数据
+func (e *EnvelopeEncryptor) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dataKey, encryptedKey, err := e.kms.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("生成数据密钥失败: %w", err)
+	}
+	cached, err := newCachedEnvelope(e, dataKey, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return cached.Encrypt(ctx, plaintext)
+}
+
+// cachedEnvelope 用固定的数据密钥进行信封加密，格式与EnvelopeEncryptor相同
+type cachedEnvelope struct {
+	parent       *EnvelopeEncryptor
+	aead         cipher.AEAD
+	encryptedKey []byte
+}
+
+// newCachedEnvelope 用数据密钥的明文和密文创建加密器
+func newCachedEnvelope(parent *EnvelopeEncryptor, dataKey, encryptedKey []byte) (*cachedEnvelope, error) {
+	if len(encryptedKey) > 0xffff {
+		return nil, fmt.Errorf("加密的数据密钥过长")
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedEnvelope{parent: parent, aead: aead, encryptedKey: encryptedKey}, nil
+}
+
+// Encrypt 用缓存的数据密钥加密数据，不请求KMS
+func (c *cachedEnvelope) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(envelopeMagic)+2+len(c.encryptedKey)+len(nonce)+len(plaintext)+c.aead.Overhead())
+	out = append(out, envelopeMagic...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(c.encryptedKey)))
+	out = append(out, c.encryptedKey...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, plaintext, envelopeMagic), nil
+}
+
+// Decrypt 通过原加密器解密
+func (c *cachedEnvelope) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return c.parent.Decrypt(ctx, ciphertext)
+}
+
+// Decrypt 通过KMS解密数据密钥后解密数据
+func (e *EnvelopeEncryptor) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, envelopeMagic) || len(ciphertext) < len(envelopeMagic)+2 {
+		return nil, fmt.Errorf("不是信封加密的数据")
+	}
+	rest := ciphertext[len(envelopeMagic):]
+	keyLength := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if len(rest) < keyLength {
+		return nil, fmt.Errorf("加密数据不完整")
+	}
+	dataKey, err := e.kms.DecryptDataKey(ctx, rest[:keyLength])
+	if err != nil {
+		return nil, fmt.Errorf("解密数据密钥失败: %w", err)
+	}
+	rest = rest[keyLength:]
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("加密数据不完整")
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], envelopeMagic)
+	if err != nil {
+		return nil, fmt.Errorf("解密失败: %w", err)
+	}
+	return plaintext, nil
+}
+
+// isEncrypted 数据是否是本包加密的格式
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, aesGCMMagic) || bytes.HasPrefix(data, envelopeMagic)
+}
+
+// EncryptedFileCheckpointSaver 与FileCheckpointSaver相同，但写入前用encryptor加密，用LoadEncryptedCheckpointFile读取
+func EncryptedFileCheckpointSaver(path string, encryptor Encryptor) CheckpointSaver {
+	return func(ctx context.Context, checkpoint Checkpoint) error {
+		data, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		data, err = encryptor.Encrypt(ctx, data)
+		if err != nil {
+			return fmt.Errorf("加密检查点失败: %w", err)
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	}
+}
+
+// LoadEncryptedCheckpointFile 读取EncryptedFileCheckpointSaver保存的检查点，未加密的文件返回ErrNotEncrypted
+// 能写入文件的人可以换成带有任意待执行工具调用的明文检查点，因此不接受明文；从明文迁移时先用EncryptFile加密
+func LoadEncryptedCheckpointFile(ctx context.Context, path string, encryptor Encryptor) (Checkpoint, error) {
+	var checkpoint Checkpoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return checkpoint, fmt.Errorf("读取检查点失败: %w", err)
+	}
+	if !isEncrypted(data) {
+		return checkpoint, fmt.Errorf("检查点 %s: %w", path, ErrNotEncrypted)
+	}
+	if data, err = encryptor.Decrypt(ctx, data); err != nil {
+		return checkpoint, fmt.Errorf("解密检查点失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("解析检查点失败: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// EncryptFile 用encryptor原地加密明文的检查点或会话文件，已加密的文件保持不变
+// 用于从明文迁移：只对确认可信的文件调用一次，之后用LoadEncryptedCheckpointFile或LoadEncryptedHistory读取
+func EncryptFile(ctx context.Context, path string, encryptor Encryptor) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %w", err)
+	}
+	if isEncrypted(data) {
+		return nil
+	}
+	if data, err = encryptor.Encrypt(ctx, data); err != nil {
+		return fmt.Errorf("加密文件失败: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("加密文件失败: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,207 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// countingKMS 测试用KMS，主密钥为32字节的AES密钥，记录生成和解密数据密钥的次数
+type countingKMS struct {
+	master    *AESGCMEncryptor
+	generated int
+	decrypted int
+}
+
+func newCountingKMS(t *testing.T) *countingKMS {
+	t.Helper()
+	master, err := NewAESGCMEncryptor(randomKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingKMS{master: master}
+}
+
+func (k *countingKMS) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	k.generated++
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := k.master.Encrypt(ctx, key)
+	return key, encrypted, err
+}
+
+func (k *countingKMS) DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error) {
+	k.decrypted++
+	return k.master.Decrypt(ctx, encrypted)
+}
+
+func randomKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptedLoadersRejectPlaintext(t *testing.T) {
+	ctx := context.Background()
+	encryptor, err := NewAESGCMEncryptor(randomKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := []general.Message{textMessage(general.RoleUser, "hi"), textMessage(general.RoleAssistant, "hello")}
+	dir := t.TempDir()
+
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+	if err := FileCheckpointSaver(checkpointPath)(ctx, Checkpoint{History: history, StartIndex: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEncryptedCheckpointFile(ctx, checkpointPath, encryptor); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("LoadEncryptedCheckpointFile(plaintext) = %v, want ErrNotEncrypted", err)
+	}
+
+	cm := NewConversationManager(nil)
+	if err := cm.SetHistory(history); err != nil {
+		t.Fatal(err)
+	}
+	historyPath := filepath.Join(dir, "session.json")
+	if err := cm.SaveHistory(historyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConversationManager(nil).LoadEncryptedHistory(ctx, historyPath, encryptor); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("LoadEncryptedHistory(plaintext) = %v, want ErrNotEncrypted", err)
+	}
+
+	// EncryptFile迁移后可以读取
+	for _, path := range []string{checkpointPath, historyPath} {
+		if err := EncryptFile(ctx, path, encryptor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if checkpoint, err := LoadEncryptedCheckpointFile(ctx, checkpointPath, encryptor); err != nil || len(checkpoint.History) != 2 {
+		t.Errorf("LoadEncryptedCheckpointFile after EncryptFile = %d messages, %v", len(checkpoint.History), err)
+	}
+	restored := NewConversationManager(nil)
+	if err := restored.LoadEncryptedHistory(ctx, historyPath, encryptor); err != nil || len(restored.GetHistory()) != 2 {
+		t.Errorf("LoadEncryptedHistory after EncryptFile = %d messages, %v", len(restored.GetHistory()), err)
+	}
+
+	// 加密的日志中混入一行明文记录
+	journalPath := filepath.Join(dir, "journal.jsonl")
+	journal, err := NewEncryptedJournal(journalPath, encryptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.SetJournal(ctx, journal); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	file, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"snapshot","messages":[{"role":"user","content":[{"type":"text","text":"injected"}]}]}` + "\n")
+	file.Close()
+	if _, err := LoadEncryptedJournal(ctx, journalPath, encryptor); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("LoadEncryptedJournal(plaintext record) = %v, want ErrNotEncrypted", err)
+	}
+}
+
+func TestAESGCMKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := randomKey(t), randomKey(t)
+	old, err := NewAESGCMEncryptor(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldData, err := old.Encrypt(ctx, []byte("before rotation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewAESGCMEncryptor(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := rotated.Decrypt(ctx, oldData); err != nil || string(plaintext) != "before rotation" {
+		t.Fatalf("decrypt data written before rotation = %q, %v", plaintext, err)
+	}
+	newData, err := rotated.Encrypt(ctx, []byte("after rotation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新数据只用新密钥加密
+	if _, err := old.Decrypt(ctx, newData); err == nil {
+		t.Error("old key decrypted data written after rotation")
+	}
+	// 去掉旧密钥后旧数据无法解密
+	retired, err := NewAESGCMEncryptor(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.Decrypt(ctx, oldData); err == nil {
+		t.Error("retired key still decrypts old data")
+	}
+	if _, err := NewAESGCMEncryptor(newKey, []byte("short")); err == nil {
+		t.Error("invalid old key accepted")
+	}
+}
+
+func TestEncryptedJournalCachesDataKey(t *testing.T) {
+	ctx := context.Background()
+	kms := newCountingKMS(t)
+	encryptor := NewEnvelopeEncryptor(kms)
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := NewEncryptedJournal(path, encryptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	cm := NewConversationManager(nil)
+	if err := cm.SetJournal(ctx, journal); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		cm.AddMessage(general.RoleUser, []general.Content{{Type: general.ContentTypeText, Text: "secret message"}})
+	}
+	if kms.generated != 1 {
+		t.Errorf("generated %d data keys for one journal, want 1", kms.generated)
+	}
+	// 压缩时更换数据密钥
+	if err := cm.CompactJournal(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if kms.generated != 2 {
+		t.Errorf("generated %d data keys after compaction, want 2", kms.generated)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := cm.CompactJournal(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("CompactJournal(cancelled) = %v, want context.Canceled", err)
+	}
+
+	history, err := LoadEncryptedJournal(ctx, path, encryptor)
+	if err != nil || len(history) != 5 {
+		t.Fatalf("LoadEncryptedJournal = %d messages, %v", len(history), err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret message")) {
+		t.Error("journal contains plaintext")
+	}
+}
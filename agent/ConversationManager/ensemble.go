@@ -0,0 +1,217 @@
+package ConversationManager
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// EnsembleTarget 集成对话中的一个提供商和模型，Model为空时使用提供商的默认模型
+type EnsembleTarget struct {
+	Provider general.Provider
+	Model    string
+}
+
+// EnsembleCandidate 一个提供商给出的候选回答
+type EnsembleCandidate struct {
+	Provider general.Provider
+	Model    string
+	Message  general.Message // 候选回答，请求失败时为空
+	Usage    general.Usage
+	Latency  time.Duration
+	Err      error // 请求失败的原因
+}
+
+// EnsembleResult 集成对话的结果
+type EnsembleResult struct {
+	Candidates  []EnsembleCandidate // 按传入顺序排列的候选回答
+	Best        int                 // 写入历史记录的候选回答序号，所有请求都失败时为-1
+	Judged      bool                // Best是否由评审模型选出，为false时Best为第一个成功的候选回答
+	JudgeReason string              // 评审模型给出的理由
+}
+
+// judgeNumberPattern 评审回复中的候选编号
+var judgeNumberPattern = regexp.MustCompile(`\d+`)
+
+// SetEnsembleJudge 设置ChatEnsemble的评审模型，provider为空时不评审
+func (cm *ConversationManager) SetEnsembleJudge(provider general.Provider, model string) {
+	if provider == "" {
+		cm.ensembleJudge = nil
+		return
+	}
+	cm.ensembleJudge = &EnsembleTarget{Provider: provider, Model: model}
+}
+
+// ChatEnsemble 将同一个问题并发发送给多个提供商并返回所有候选回答，用于需要交叉验证的重要问题
+// 设置了评审模型时由评审模型选出最佳回答，否则使用第一个成功的回答；选中的回答和用户消息一起写入历史记录
+// 集成对话不发送工具定义，也不执行函数调用
+func (cm *ConversationManager) ChatEnsemble(ctx context.Context, targets []EnsembleTarget, userMessage string) (*EnsembleResult, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("至少需要一个提供商")
+	}
+
+	// 登记进行中的对话，Shutdown时取消
+	ctx, endChat, err := cm.beginChat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endChat()
+
+	for _, target := range targets {
+		if err := cm.checkBudgetPrices(target.Model); err != nil {
+			return nil, err
+		}
+	}
+	if err := cm.checkBudgets(); err != nil {
+		return nil, err
+	}
+
+	cm.setHistory(ctx, cm.compressToolResults(cm.history))
+	cm.setHistory(ctx, cm.truncateHistory(ctx, targets[0].Provider, targets[0].Model, cm.history))
+	cm.turn++
+
+	userMsg := general.Message{
+		Role:    general.RoleUser,
+		Content: []general.Content{{Type: general.ContentTypeText, Text: userMessage}},
+	}
+	stampMessage(&userMsg)
+	messages := make([]general.Message, 0, len(cm.history)+1)
+	messages = append(messages, cm.history...)
+	messages = append(messages, userMsg)
+
+	result := &EnsembleResult{Candidates: make([]EnsembleCandidate, len(targets)), Best: -1}
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target EnsembleTarget) {
+			defer wg.Done()
+			result.Candidates[i] = cm.askCandidate(ctx, target, messages)
+		}(i, target)
+	}
+	wg.Wait()
+
+	for i, candidate := range result.Candidates {
+		if candidate.Err != nil {
+			continue
+		}
+		cm.recordExtraUsage(candidate.Provider, candidate.Model, candidate.Usage)
+		if result.Best < 0 {
+			result.Best = i
+		}
+	}
+	if result.Best < 0 {
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("集成对话被取消: %w", ctx.Err())
+		}
+		return result, fmt.Errorf("所有提供商请求失败: %w", result.Candidates[0].Err)
+	}
+
+	if cm.ensembleJudge != nil && countSucceeded(result.Candidates) > 1 {
+		if best, reason, ok := cm.judgeCandidates(ctx, userMessage, result.Candidates); ok {
+			result.Best, result.JudgeReason, result.Judged = best, reason, true
+		}
+	}
+
+	// 将用户消息和选中的回答写入历史记录
+	cm.history = append(cm.history, userMsg)
+	cm.audit(userMsg)
+	cm.journalWrite(ctx, journalRecord{Op: journalAppend, Message: &userMsg})
+	cm.emitMessage(userMsg)
+	answer := cm.appendMessage(ctx, result.Candidates[result.Best].Message)
+	cm.emitMessage(answer)
+	result.Candidates[result.Best].Message = answer
+	return result, nil
+}
+
+// askCandidate 向单个提供商请求候选回答
+func (cm *ConversationManager) askCandidate(ctx context.Context, target EnsembleTarget, messages []general.Message) EnsembleCandidate {
+	candidate := EnsembleCandidate{Provider: target.Provider, Model: target.Model}
+	req := &general.ChatRequest{
+		Messages:        messages,
+		SystemPrompt:    cm.requestSystemPrompt(),
+		MaxTokens:       cm.MaxTokens,
+		Temperature:     cm.Temperature,
+		TemperatureSet:  true,
+		Model:           target.Model,
+		Extensions:      cm.Extensions,
+		EnableThinking:  cm.EnableThinking,
+		ProviderOptions: cm.ProviderOptions,
+	}
+	start := time.Now()
+	resp, err := cm.manager.Chat(ctx, target.Provider, req)
+	candidate.Latency = time.Since(start)
+	if err != nil {
+		candidate.Err = err
+		return candidate
+	}
+	if len(resp.Choices) == 0 {
+		candidate.Err = fmt.Errorf("提供商 %s 没有返回回答", target.Provider)
+		return candidate
+	}
+	candidate.Model = req.Model
+	candidate.Message = resp.Choices[0].Message
+	candidate.Usage = resp.Usage
+	return candidate
+}
+
+// judgeCandidates 请求评审模型选出最佳的候选回答，评审失败或回复无法解析时返回false
+func (cm *ConversationManager) judgeCandidates(ctx context.Context, question string, candidates []EnsembleCandidate) (int, string, bool) {
+	var prompt strings.Builder
+	prompt.WriteString(cm.text(MsgJudgeInstruction))
+	prompt.WriteString(cm.text(MsgJudgeQuestion, question))
+	for i, candidate := range candidates {
+		if candidate.Err != nil {
+			continue
+		}
+		prompt.WriteString(cm.text(MsgJudgeAnswer, i+1, messageText(candidate.Message)))
+	}
+
+	judge := cm.ensembleJudge
+	req := &general.ChatRequest{
+		Messages: []general.Message{
+			{Role: general.RoleUser, Content: []general.Content{{Type: general.ContentTypeText, Text: prompt.String()}}},
+		},
+		MaxTokens: cm.MaxTokens,
+		Model:     judge.Model,
+	}
+	resp, err := cm.manager.Chat(ctx, judge.Provider, req)
+	if err != nil || len(resp.Choices) == 0 {
+		return 0, "", false
+	}
+	cm.recordExtraUsage(judge.Provider, req.Model, resp.Usage)
+
+	reply := strings.TrimSpace(messageText(resp.Choices[0].Message))
+	first, rest, _ := strings.Cut(reply, "\n")
+	number, err := strconv.Atoi(judgeNumberPattern.FindString(first))
+	if err != nil || number < 1 || number > len(candidates) || candidates[number-1].Err != nil {
+		return 0, "", false
+	}
+	return number - 1, strings.TrimSpace(rest), true
+}
+
+// recordExtraUsage 记录工具循环之外的请求（如集成对话的候选和评审）的使用量
+func (cm *ConversationManager) recordExtraUsage(provider general.Provider, model string, usage general.Usage) {
+	if cm.TotalUsage == nil {
+		cm.TotalUsage = &general.Usage{}
+	}
+	cm.TotalUsage.Add(usage)
+	cm.recordUsage(provider, model, usage, nil)
+	cm.chargeBudgets(model, usage)
+}
+
+// countSucceeded 统计成功的候选回答数量
+func countSucceeded(candidates []EnsembleCandidate) int {
+	count := 0
+	for _, candidate := range candidates {
+		if candidate.Err == nil {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,121 @@
+package ConversationManager
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// EventType 对话事件类型
+type EventType string
+
+const (
+	EventMessageStarted   EventType = "message_started"    // 一条新消息开始（用户消息或助手回复）
+	EventTextDelta        EventType = "text_delta"         // 助手回复的文本增量，SetStreamReplies开启时逐块发送，否则为完整的回复文本
+	EventToolCallProposed EventType = "tool_call_proposed" // 模型提出了工具调用
+	EventToolCallApproved EventType = "tool_call_approved" // 工具调用通过审批，即将执行
+	EventToolResult       EventType = "tool_result"        // 工具执行结果
+	EventQuestion         EventType = "question"           // 模型通过ask_user工具向用户提问，需调用AnswerQuestion回答
+	EventTurnCompleted    EventType = "turn_completed"     // 本轮对话结束
+	EventReminder         EventType = "reminder"           // schedule_reminder工具设置的提醒到期
+	EventToolPanic        EventType = "tool_panic"         // 工具执行时发生panic，已转换为错误结果
+	EventError            EventType = "error"              // 对话出错
+)
+
+// Event 对话过程中的结构化事件，用于前端渲染进度
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Role       general.MessageRole
+	Message    *general.Message   // MessageStarted时为完整消息
+	Text       string             // TextDelta时为新增的文本，按顺序拼接得到回复文本
+	ToolCall   *general.ToolCall  // ToolCallProposed、ToolCallApproved、ToolResult、Question时为对应的工具调用
+	ToolResult string             // ToolResult时为工具返回内容
+	Question   string             // Question时为向用户提出的问题
+	StopReason general.StopReason // TurnCompleted和Error时为结束原因
+	Usage      *general.Usage     // TurnCompleted时为累计使用量
+	Err        error              // Error时为错误信息，ToolPanic时为*ToolPanicError
+	Stack      string             // ToolPanic时为panic的调用栈
+	Reminder   *Reminder          // Reminder时为到期的提醒
+}
+
+// ToolApprover 工具调用审批函数，返回false时拒绝执行该工具
+type ToolApprover func(ctx context.Context, toolCall general.ToolCall) bool
+
+// SetEventChannel 设置结构化事件通道，为nil时不发送事件；需要多个接收方时使用Subscribe
+func (cm *ConversationManager) SetEventChannel(events chan Event) {
+	cm.events = events
+}
+
+// SetToolApprover 设置工具调用审批函数，为nil时自动批准所有工具调用
+func (cm *ConversationManager) SetToolApprover(approver ToolApprover) {
+	cm.toolApprover = approver
+}
+
+// emit 向事件通道和所有订阅发送事件
+func (cm *ConversationManager) emit(event Event) {
+	if !cm.observed() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if cm.events != nil {
+		deliver(cm.delivery, cm.events, event)
+	}
+	cm.subscribers.publish(event)
+}
+
+// observed 判断是否设置了事件通道或有订阅
+func (cm *ConversationManager) observed() bool {
+	return cm.events != nil || cm.subscribers.active()
+}
+
+// emitMessage 为一条完整消息发送MessageStarted、TextDelta和ToolCallProposed事件
+func (cm *ConversationManager) emitMessage(msg general.Message) {
+	if !cm.observed() {
+		return
+	}
+	cm.emit(Event{Type: EventMessageStarted, Role: msg.Role, Message: &msg})
+	if msg.Role != general.RoleAssistant {
+		return
+	}
+	// 流式请求时文本已逐块发送
+	if text := messageText(msg); text != "" && !cm.replyStreamed {
+		cm.emit(Event{Type: EventTextDelta, Role: msg.Role, Text: text})
+	}
+	for i := range msg.ToolCalls {
+		cm.emit(Event{Type: EventToolCallProposed, Role: msg.Role, ToolCall: &msg.ToolCalls[i]})
+	}
+}
+
+// finishTurn 根据对话结果发送TurnCompleted或Error事件
+func (cm *ConversationManager) finishTurn(stopReason general.StopReason, err error, usage *general.Usage) {
+	if err != nil {
+		cm.emit(Event{Type: EventError, StopReason: stopReason, Err: err})
+		return
+	}
+	cm.emit(Event{Type: EventTurnCompleted, StopReason: stopReason, Usage: usage})
+}
+
+// approveToolCall 审批工具调用，通过时发送ToolCallApproved事件
+func (cm *ConversationManager) approveToolCall(ctx context.Context, toolCall general.ToolCall) bool {
+	if cm.toolApprover != nil && !cm.toolApprover(ctx, toolCall) {
+		return false
+	}
+	cm.emit(Event{Type: EventToolCallApproved, Role: general.RoleAssistant, ToolCall: &toolCall})
+	return true
+}
+
+// messageText 拼接消息中的文本内容
+func messageText(msg general.Message) string {
+	var parts []string
+	for _, content := range msg.Content {
+		if content.Type == general.ContentTypeText && content.Text != "" {
+			parts = append(parts, content.Text)
+		}
+	}
+	return strings.Join(parts, "")
+}
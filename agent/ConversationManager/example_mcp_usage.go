@@ -1,7 +1,9 @@
 package ConversationManager
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/ccIisIaIcat/GoAgent/agent/general"
 )
@@ -12,10 +14,12 @@ func ExampleMCPUsage() {
 	var manager *general.AgentManager // 假设已经初始化
 	cm := NewConversationManager(manager)
 
-	// 确保关闭时清理MCP连接
+	// 确保关闭时取消进行中的对话并清理MCP连接
 	defer func() {
-		if err := cm.CloseMCP(); err != nil {
-			log.Printf("关闭MCP连接失败: %v", err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := cm.Shutdown(ctx); err != nil {
+			log.Printf("关闭对话管理器失败: %v", err)
 		}
 	}()
 
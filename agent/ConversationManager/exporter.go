@@ -0,0 +1,19 @@
+package ConversationManager
+
+import (
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ExportOpenAIMessages 将当前的历史记录和系统提示词导出为OpenAI Chat Completions的messages数组
+// 历史记录先按OpenAI的约束迁移（工具调用ID、悬空的工具调用等），不修改会话本身，可以直接用curl发送
+func (cm *ConversationManager) ExportOpenAIMessages() ([]byte, error) {
+	history, systemPrompt := cm.migrateHistory(cm.history, general.ProviderOpenAI)
+	return general.ExportOpenAIMessages(systemPrompt, history)
+}
+
+// ExportAnthropicMessages 将当前的历史记录和系统提示词导出为Anthropic Messages API请求体中的system和messages字段
+// 历史中的system消息合并到system字段，其余迁移与SwitchProvider相同，不修改会话本身
+func (cm *ConversationManager) ExportAnthropicMessages() ([]byte, error) {
+	history, systemPrompt := cm.migrateHistory(cm.history, general.ProviderAnthropic)
+	return general.ExportAnthropicMessages(systemPrompt, history)
+}
@@ -3,12 +3,26 @@ package ConversationManager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime/debug"
+	"strings"
 
 	"github.com/ccIisIaIcat/GoAgent/agent/general"
 )
 
+// contextType context.Context的反射类型
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// contextParams 函数的第一个参数为context.Context时返回1，否则返回0
+func contextParams(fnType reflect.Type) int {
+	if fnType.NumIn() > 0 && fnType.In(0) == contextType {
+		return 1
+	}
+	return 0
+}
+
 // RegisterFunction 注册函数
 func (cm *ConversationManager) RegisterFunctionSimple(name, description string, fn interface{}) error {
 	fnValue := reflect.ValueOf(fn)
@@ -19,25 +33,26 @@ func (cm *ConversationManager) RegisterFunctionSimple(name, description string,
 		return fmt.Errorf("注册的对象不是函数类型")
 	}
 
-	// 验证参数类型
-	numParams := fnType.NumIn()
+	// 验证参数类型，第一个参数为context.Context时传入工具调用的ctx，不作为工具参数
+	offset := contextParams(fnType)
+	numParams := fnType.NumIn() - offset
 	properties := make(map[string]interface{})
 	required := make([]string, 0)
 	paramNames := make([]string, numParams)
 
 	for i := 0; i < numParams; i++ {
-		paramType := fnType.In(i)
+		paramType := fnType.In(i + offset)
 		if !IsValidParameterType(paramType) {
 			return fmt.Errorf("参数 %d 类型 %s 不受支持", i, paramType.String())
 		}
 
 		paramName := fmt.Sprintf("param%d", i)
 		paramNames[i] = paramName
-		properties[paramName] = map[string]interface{}{
-			"type":        ConvertToJSONSchemaType(paramType),
-			"description": fmt.Sprintf("参数 %d (%s)", i, paramType.String()),
+		properties[paramName] = parameterSchema(paramType, cm.text(MsgParamDescription, i, paramType.String()))
+		// 可变参数可以省略
+		if !isVariadicParam(fnType, i+offset) {
+			required = append(required, paramName)
 		}
-		required = append(required, paramName)
 	}
 
 	// 验证返回值类型
@@ -63,15 +78,13 @@ func (cm *ConversationManager) RegisterFunctionSimple(name, description string,
 		},
 	}
 
-	// 保存函数和工具定义
-	cm.registeredFuncs[name] = fnValue
-	cm.funcSchemas[name] = tool
-	cm.funcParamNames[name] = paramNames
-	cm.tools = append(cm.tools, tool)
-
-	return nil
+	// 保存函数和工具定义，按DuplicateToolPolicy处理同名工具
+	_, err := cm.registerTool(tool, fnValue, paramNames)
+	return err
 }
 
+// RegisterFunction 注册函数，paramNames和paraDescriptions按顺序对应fn的参数
+// fn的第一个参数为context.Context时传入工具调用的ctx，对话被取消或Shutdown时随之取消，该参数不计入paramNames
 func (cm *ConversationManager) RegisterFunction(name, description string, fn interface{}, paramNames, paraDescriptions []string) error {
 	fnValue := reflect.ValueOf(fn)
 	fnType := fnValue.Type()
@@ -80,8 +93,9 @@ func (cm *ConversationManager) RegisterFunction(name, description string, fn int
 	if fnType.Kind() != reflect.Func {
 		return fmt.Errorf("注册的对象不是函数类型")
 	}
-	// 验证参数类型
-	numParams := fnType.NumIn()
+	// 验证参数类型，第一个参数为context.Context时传入工具调用的ctx，不计入paramNames
+	offset := contextParams(fnType)
+	numParams := fnType.NumIn() - offset
 	properties := make(map[string]interface{})
 	required := make([]string, 0)
 
@@ -90,31 +104,17 @@ func (cm *ConversationManager) RegisterFunction(name, description string, fn int
 	}
 
 	for i := 0; i < numParams; i++ {
-		paramType := fnType.In(i)
+		paramType := fnType.In(i + offset)
 		if !IsValidParameterType(paramType) {
 			return fmt.Errorf("参数 %d 类型 %s 不受支持", i, paramType.String())
 		}
 		paramName := paramNames[i]
-		schemaProperty := map[string]interface{}{
-			"type":        ConvertToJSONSchemaType(paramType),
-			"description": paraDescriptions[i],
+		// 数组类型包含items属性
+		properties[paramName] = parameterSchema(paramType, paraDescriptions[i])
+		// 可变参数可以省略
+		if !isVariadicParam(fnType, i+offset) {
+			required = append(required, paramName)
 		}
-		
-		// 如果是数组类型，添加items属性
-		if paramType.Kind() == reflect.Array || paramType.Kind() == reflect.Slice {
-			if paramType.Elem() != nil {
-				schemaProperty["items"] = map[string]interface{}{
-					"type": ConvertToJSONSchemaType(paramType.Elem()),
-				}
-			} else {
-				schemaProperty["items"] = map[string]interface{}{
-					"type": "string",
-				}
-			}
-		}
-		
-		properties[paramName] = schemaProperty
-		required = append(required, paramName)
 	}
 
 	// 验证返回值类型
@@ -140,13 +140,9 @@ func (cm *ConversationManager) RegisterFunction(name, description string, fn int
 		},
 	}
 
-	// 保存函数和工具定义
-	cm.registeredFuncs[name] = fnValue
-	cm.funcSchemas[name] = tool
-	cm.funcParamNames[name] = paramNames
-	cm.tools = append(cm.tools, tool)
-
-	return nil
+	// 保存函数和工具定义，按DuplicateToolPolicy处理同名工具
+	_, err := cm.registerTool(tool, fnValue, paramNames)
+	return err
 }
 
 func (cm *ConversationManager) ModifyFunctionParaDescription(name string, paraNames, paraDescriptions []string) error {
@@ -155,7 +151,8 @@ func (cm *ConversationManager) ModifyFunctionParaDescription(name string, paraNa
 		return fmt.Errorf("未找到注册的函数: %s", name)
 	}
 	fnType := fnValue.Type()
-	numParams := fnType.NumIn()
+	offset := contextParams(fnType)
+	numParams := fnType.NumIn() - offset
 
 	// 验证参数数量是否匹配
 	if numParams != len(paraNames) || numParams != len(paraDescriptions) {
@@ -174,15 +171,14 @@ func (cm *ConversationManager) ModifyFunctionParaDescription(name string, paraNa
 	required := make([]string, 0)
 
 	for i := 0; i < numParams; i++ {
-		paramType := fnType.In(i)
+		paramType := fnType.In(i + offset)
 		paramName := paraNames[i]
 		paramDescription := paraDescriptions[i]
 
-		properties[paramName] = map[string]interface{}{
-			"type":        ConvertToJSONSchemaType(paramType),
-			"description": paramDescription,
+		properties[paramName] = parameterSchema(paramType, paramDescription)
+		if !isVariadicParam(fnType, i+offset) {
+			required = append(required, paramName)
 		}
-		required = append(required, paramName)
 	}
 
 	// 更新工具定义
@@ -206,8 +202,68 @@ func (cm *ConversationManager) ModifyFunctionParaDescription(name string, paraNa
 	return nil
 }
 
+// SetFunctionReturnNames 设置函数的返回值名称，函数有多个错误以外的返回值时以这些名称为键序列化为JSON对象，
+// 未设置时使用result0、result1等名称
+func (cm *ConversationManager) SetFunctionReturnNames(name string, returnNames []string) error {
+	fnValue, exists := cm.registeredFuncs[name]
+	if !exists {
+		return fmt.Errorf("未找到注册的函数: %s", name)
+	}
+	fnType := fnValue.Type()
+	numReturns := fnType.NumOut()
+	if numReturns > 0 && fnType.Out(numReturns-1).Implements(reflect.TypeOf((*error)(nil)).Elem()) {
+		numReturns--
+	}
+	if numReturns != len(returnNames) {
+		return fmt.Errorf("返回值数量不匹配: 函数有 %d 个返回值，但提供了 %d 个名称", numReturns, len(returnNames))
+	}
+	if cm.funcReturnNames == nil {
+		cm.funcReturnNames = make(map[string][]string)
+	}
+	cm.funcReturnNames[name] = append([]string(nil), returnNames...)
+	return nil
+}
+
+// returnValuesJSON 将多个返回值按返回值名称序列化为JSON对象，保持返回值的顺序
+func (cm *ConversationManager) returnValuesJSON(name string, values []reflect.Value) string {
+	names := cm.funcReturnNames[name]
+	var b strings.Builder
+	b.WriteString("{")
+	for i, value := range values {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key := fmt.Sprintf("result%d", i)
+		if len(names) == len(values) {
+			key = names[i]
+		}
+		keyJSON, _ := json.Marshal(key)
+		b.Write(keyJSON)
+		b.WriteString(":")
+		valueJSON, err := json.Marshal(value.Interface())
+		if err != nil {
+			valueJSON, _ = json.Marshal(ConvertReturnValueToString(value))
+		}
+		b.Write(valueJSON)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
 // CallRegisteredFunction 调用已注册的函数
 func (cm *ConversationManager) CallRegisteredFunction(name string, arguments json.RawMessage) (string, error) {
+	return cm.callRegisteredFunction(context.Background(), name, arguments)
+}
+
+// callRegisteredFunction 调用已注册的函数，ctx传给预编译的代理（MCP、OpenAPI和gRPC工具），用于取消其发出的请求
+// 函数或代理panic时返回*ToolPanicError，不会中断整个进程
+func (cm *ConversationManager) callRegisteredFunction(ctx context.Context, name string, arguments json.RawMessage) (result string, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			result, err = "", &ToolPanicError{Tool: name, Value: value, Stack: string(debug.Stack())}
+		}
+	}()
+
 	// 检查函数是否存在
 	fnValue, exists := cm.registeredFuncs[name]
 	if !exists {
@@ -223,25 +279,34 @@ func (cm *ConversationManager) CallRegisteredFunction(name string, arguments jso
 		var argsStr string
 		if err2 := json.Unmarshal(arguments, &argsStr); err2 == nil {
 			if err3 := json.Unmarshal([]byte(argsStr), &params); err3 != nil {
-				return "", fmt.Errorf("解析参数失败: %w", err)
+				return "", cm.errorf(err, MsgParseArgumentsFailed, err)
 			}
 		} else {
-			return "", fmt.Errorf("解析参数失败: %w", err)
+			return "", cm.errorf(err, MsgParseArgumentsFailed, err)
 		}
 	}
 
+	// 预编译的代理直接使用解析后的参数
+	if proxy, exists := cm.toolProxies[name]; exists {
+		return proxy(ctx, params, cm.LenientArguments)
+	}
+
 	// 获取注册时保存的参数名称
 	savedParamNames, exists := cm.funcParamNames[name]
 	if !exists {
 		return "", fmt.Errorf("未找到函数 %s 的参数名称信息", name)
 	}
 
-	// 准备函数参数
+	// 准备函数参数，第一个参数为context.Context时传入工具调用的ctx
 	numIn := fnType.NumIn()
 	args := make([]reflect.Value, numIn)
+	offset := contextParams(fnType)
+	if offset > 0 {
+		args[0] = reflect.ValueOf(&ctx).Elem()
+	}
 
-	for i := 0; i < numIn; i++ {
-		paramName := savedParamNames[i]
+	for i := offset; i < numIn; i++ {
+		paramName := savedParamNames[i-offset]
 		paramType := fnType.In(i)
 
 		paramValue, exists := params[paramName]
@@ -250,73 +315,128 @@ func (cm *ConversationManager) CallRegisteredFunction(name string, arguments jso
 			args[i] = reflect.Zero(paramType)
 		} else {
 			// 转换参数类型
-			convertedValue, err := ConvertInterfaceToType(paramValue, paramType)
+			convert := ConvertInterfaceToType
+			if cm.LenientArguments {
+				convert = ConvertInterfaceToTypeLenient
+			}
+			convertedValue, err := convert(paramValue, paramType)
 			if err != nil {
-				return "", fmt.Errorf("转换参数 %s 失败: %w", paramName, err)
+				return "", cm.errorf(err, MsgConvertArgumentFailed, paramName, err)
 			}
 			args[i] = convertedValue
 		}
 	}
 
-	// 调用函数
-	results := fnValue.Call(args)
+	// 调用函数，可变参数函数的最后一个参数已经是切片
+	var results []reflect.Value
+	if fnType.IsVariadic() {
+		results = fnValue.CallSlice(args)
+	} else {
+		results = fnValue.Call(args)
+	}
 
 	// 处理返回值
 	if len(results) == 0 {
-		return "函数执行完成", nil
+		return cm.text(MsgFunctionDone), nil
 	}
 
-	// 如果有多个返回值，拼接所有返回值
-	var resultParts []string
+	// 收集错误以外的返回值
+	var values []reflect.Value
 	for i, result := range results {
-		resultStr := ConvertReturnValueToString(result)
 		if i == len(results)-1 && result.Type().Implements(reflect.TypeOf((*error)(nil)).Elem()) {
 			// 如果最后一个返回值是错误类型且不为nil
 			if !result.IsNil() {
-				return "", fmt.Errorf("函数执行错误: %s", resultStr)
+				return "", errors.New(cm.text(MsgFunctionError, ConvertReturnValueToString(result)))
 			}
 			// 如果错误为nil，跳过这个返回值
 			continue
 		}
-		resultParts = append(resultParts, resultStr)
+		values = append(values, result)
 	}
 
-	if len(resultParts) == 0 {
-		return "函数执行完成", nil
+	if len(values) == 0 {
+		return cm.text(MsgFunctionDone), nil
+	}
+	if len(values) == 1 {
+		return cm.text(MsgFunctionReturned, ConvertReturnValueToString(values[0])), nil
 	}
 
-	return fmt.Sprintf("函数返回: %s", resultParts[0]), nil
+	// 多个返回值序列化为JSON对象
+	return cm.text(MsgFunctionReturned, cm.returnValuesJSON(name, values)), nil
 }
 
 // HandleToolCall 处理工具调用（支持注册的函数）
 func (cm *ConversationManager) HandleToolCall(ctx context.Context, provider general.Provider, toolCall general.ToolCall, info_chan chan general.Message) error {
-	// 检查是否是注册的函数
-	if _, exists := cm.registeredFuncs[toolCall.Function.Name]; exists {
-		result, err := cm.CallRegisteredFunction(toolCall.Function.Name, toolCall.Function.Arguments)
+	// 登记进行中的工具调用，Shutdown时等待其结束
+	endTool, err := cm.beginTool()
+	if err != nil {
+		return err
+	}
+	defer endTool()
+
+	// 无法修复的参数按MalformedArgumentsPolicy处理
+	if handled, err := cm.handleMalformedArguments(ctx, toolCall, info_chan); handled || err != nil {
+		return err
+	}
+
+	// 不在允许列表中的工具
+	if !cm.toolAllowed(toolCall.Function.Name) {
+		cm.appendToolResult(ctx, toolCall, cm.text(MsgToolUnavailable, toolCall.Function.Name), info_chan)
+		return nil
+	}
+
+	// 回放时使用记录中的结果，不执行工具
+	if cm.replay != nil {
+		cm.replayToolCall(ctx, toolCall, info_chan)
+		return nil
+	}
+
+	// 内置的ask_user工具
+	if toolCall.Function.Name == AskUserToolName && cm.questions != nil {
+		result, err := cm.askUser(ctx, toolCall)
 		if err != nil {
-			result = fmt.Sprintf("函数执行错误: %v", err)
+			return err
 		}
+		cm.appendToolResult(ctx, toolCall, result, info_chan)
+		return nil
+	}
 
-		// 添加工具结果到历史
-		cm.AddMessage(general.RoleTool, []general.Content{
-			{
-				Type:   general.ContentTypeToolRes,
-				Text:   result,
-				ToolID: toolCall.ID,
-			},
-		})
-		if info_chan != nil {
-			info_chan <- general.Message{
-				Role:    general.RoleTool,
-				Content: []general.Content{{Type: general.ContentTypeToolRes, Text: result, ToolID: toolCall.ID}},
+	// 内置的take_screenshot工具
+	if toolCall.Function.Name == ScreenshotToolName && cm.screenshotter != nil {
+		result := cm.text(MsgToolRejected)
+		if cm.approveToolCall(ctx, toolCall) {
+			result = cm.takeScreenshot(ctx, toolCall)
+		}
+		cm.appendToolResult(ctx, toolCall, result, info_chan)
+		return nil
+	}
+
+	// 检查是否是注册的函数
+	if _, exists := cm.registeredFuncs[toolCall.Function.Name]; exists {
+		result := cm.text(MsgToolRejected)
+		if cm.approveToolCall(ctx, toolCall) {
+			var err error
+			result, err = cm.callRegisteredFunction(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+			if err != nil {
+				result = cm.text(MsgFunctionError, err)
+				cm.runLog.toolFailed(toolCall.ID, err)
+				var panicErr *ToolPanicError
+				if errors.As(err, &panicErr) {
+					cm.reportToolPanic(toolCall, panicErr)
+				}
+			} else {
+				result = cm.CompressText(ctx, result)
 			}
 		}
 
+		// 添加工具结果到历史
+		cm.appendToolResult(ctx, toolCall, result, info_chan)
+
 		return nil
 	}
 
-	// 如果不是注册的函数，返回错误
-	return fmt.Errorf("未找到函数: %s", toolCall.Function.Name)
+	// 如果不是注册的函数，按UnknownToolPolicy处理
+	return cm.handleUnknownTool(ctx, toolCall, info_chan)
 }
 
 // hasToolCalls 检查消息是否包含工具调用
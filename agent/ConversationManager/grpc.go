@@ -0,0 +1,498 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// GRPCConfig 通过服务端反射从gRPC服务生成工具的配置
+type GRPCConfig struct {
+	Target      string                      // 服务地址，如https://localhost:50051，没有协议时使用https
+	Services    []string                    // 只注册这些服务（全名，如helloworld.Greeter），为空时注册反射服务以外的所有服务
+	Methods     []string                    // 只注册这些方法（如helloworld.Greeter/SayHello或生成的工具名称），为空时注册所选服务的所有方法
+	Prefix      string                      // 工具名称前缀
+	Group       string                      // 工具加入的工具组，为空时不分组
+	Metadata    map[string]string           // 每个调用附加的元数据
+	Credentials general.CredentialsProvider // 认证凭据，作为Bearer令牌放在authorization元数据中
+	HTTPClient  *http.Client                // 发送请求的客户端，必须支持HTTP/2；为nil时使用默认客户端，只支持TLS
+	Timeout     time.Duration               // 每个调用的超时时间，为0时为30秒
+}
+
+// gRPC服务端反射服务的全名，先尝试v1，服务端不支持时使用v1alpha
+var grpcReflectionServices = []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+
+// grpcStatusUnimplemented gRPC状态码：方法未实现
+const grpcStatusUnimplemented = 12
+
+// maxGRPCResponseSize 读取响应的最大字节数
+const maxGRPCResponseSize = 4 << 20
+
+// grpcStatusError 服务端返回的非OK状态
+type grpcStatusError struct {
+	code    int
+	message string
+}
+
+func (e *grpcStatusError) Error() string {
+	return fmt.Sprintf("gRPC状态 %d: %s", e.code, e.message)
+}
+
+// grpcToolset 由同一个服务端生成的工具共享的连接信息和描述符
+type grpcToolset struct {
+	target   string
+	config   GRPCConfig
+	client   *http.Client
+	registry *protoRegistry
+	locale   Locale // 工具描述使用的语言
+}
+
+// grpcMethodTool 方法对应的工具
+type grpcMethodTool struct {
+	tool       general.Tool
+	path       string // 请求路径：/Service/Method
+	method     protoMethod
+	paramNames []string
+}
+
+// RegisterGRPC 通过服务端反射获取gRPC服务的描述符，将选中的方法注册为工具，调用工具时发送对应的gRPC请求
+// 工具名称为服务名加方法名（如Greeter_SayHello），请求消息的字段作为同名的工具参数，响应消息转换为JSON对象，
+// 服务端流式方法的所有响应合并为JSON数组，客户端流式和双向流式方法不注册。
+// 标准库只在TLS上支持HTTP/2，明文（h2c）服务需要通过HTTPClient传入支持h2c的客户端。
+// 返回注册的工具名称，注册中遇到错误时停止，已注册的工具不会撤销
+func (cm *ConversationManager) RegisterGRPC(config *GRPCConfig) ([]string, error) {
+	if config == nil || config.Target == "" {
+		return nil, fmt.Errorf("gRPC服务地址不能为空")
+	}
+	toolset := &grpcToolset{
+		target:   strings.TrimRight(config.Target, "/"),
+		config:   *config,
+		client:   config.HTTPClient,
+		registry: newProtoRegistry(),
+		locale:   cm.Locale(),
+	}
+	if !strings.HasPrefix(toolset.target, "http://") && !strings.HasPrefix(toolset.target, "https://") {
+		toolset.target = "https://" + toolset.target
+	}
+	if toolset.client == nil {
+		toolset.client = &http.Client{}
+	}
+	if toolset.config.Timeout <= 0 {
+		toolset.config.Timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolset.config.Timeout)
+	defer cancel()
+
+	services := config.Services
+	if len(services) == 0 {
+		listed, err := toolset.listServices(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range listed {
+			if !strings.HasPrefix(name, "grpc.reflection.") {
+				services = append(services, name)
+			}
+		}
+		sort.Strings(services)
+	}
+	for _, service := range services {
+		if err := toolset.loadSymbol(ctx, service); err != nil {
+			return nil, err
+		}
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range config.Methods {
+		selected[strings.TrimPrefix(name, "/")] = true
+	}
+
+	// 先生成所有工具，再按服务和方法的顺序注册
+	var tools []grpcMethodTool
+	for _, serviceName := range services {
+		service, ok := toolset.registry.services[serviceName]
+		if !ok {
+			return nil, fmt.Errorf("服务端没有服务 %s", serviceName)
+		}
+		for _, method := range service.methods {
+			if method.clientStreaming {
+				continue
+			}
+			name := grpcToolName(config.Prefix, service.fullName, method.name)
+			fullName := service.fullName + "/" + method.name
+			if len(selected) > 0 && !selected[fullName] && !selected[service.fullName+"."+method.name] && !selected[name] {
+				continue
+			}
+			tools = append(tools, toolset.buildTool(name, service.fullName, method))
+		}
+	}
+	if len(tools) == 0 {
+		return nil, fmt.Errorf("服务端没有可注册的方法")
+	}
+
+	var registered []string
+	for _, t := range tools {
+		name, err := cm.registerTool(t.tool, toolset.proxyFunction(t), t.paramNames)
+		if err != nil {
+			return registered, fmt.Errorf("注册方法 %s 失败: %w", t.path, err)
+		}
+		cm.toolProxies[name] = toolset.compiledProxy(cm, t)
+		if config.Group != "" {
+			cm.AddToolsToGroup(config.Group, name)
+		}
+		registered = append(registered, name)
+	}
+	return registered, nil
+}
+
+// grpcToolName 生成工具名称：服务的短名称加方法名
+func grpcToolName(prefix, service, method string) string {
+	if i := strings.LastIndex(service, "."); i >= 0 {
+		service = service[i+1:]
+	}
+	name := strings.Trim(openAPIToolNameInvalid.ReplaceAllString(service+"_"+method, "_"), "_")
+	return prefix + name
+}
+
+// buildTool 生成方法的工具定义，参数为请求消息的顶层字段
+func (t *grpcToolset) buildTool(name, service string, method protoMethod) grpcMethodTool {
+	schema := t.registry.messageSchema(method.inputType, 0)
+	properties, _ := schema["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+	required, _ := schema["required"].([]string)
+	if required == nil {
+		required = []string{}
+	}
+
+	var paramNames []string
+	if message, ok := t.registry.messages[method.inputType]; ok {
+		for _, field := range message.fields {
+			paramNames = append(paramNames, field.name)
+		}
+	}
+
+	description := Localize(t.locale, MsgGRPCMethod, service, method.name)
+	if method.serverStreaming {
+		description += Localize(t.locale, MsgGRPCServerStreaming)
+	}
+	return grpcMethodTool{
+		tool: general.Tool{
+			Type: "function",
+			Function: general.FunctionDefinition{
+				Name:        name,
+				Description: description,
+				Parameters: map[string]interface{}{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				},
+			},
+		},
+		path:       "/" + service + "/" + method.name,
+		method:     method,
+		paramNames: paramNames,
+	}
+}
+
+// proxyFunction 生成工具的函数，每个参数都是interface{}，未传的参数为nil
+func (t *grpcToolset) proxyFunction(mt grpcMethodTool) reflect.Value {
+	in := make([]reflect.Type, len(mt.paramNames))
+	for i := range in {
+		in[i] = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	out := []reflect.Type{reflect.TypeOf(""), reflect.TypeOf((*error)(nil)).Elem()}
+	funcType := reflect.FuncOf(in, out, false)
+
+	return reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+		values := make(map[string]interface{}, len(args))
+		for i, arg := range args {
+			if value := arg.Interface(); value != nil {
+				values[mt.paramNames[i]] = value
+			}
+		}
+		result, err := t.call(context.Background(), mt, values)
+		errValue := reflect.Zero(out[1])
+		if err != nil {
+			errValue = reflect.ValueOf(err)
+		}
+		return []reflect.Value{reflect.ValueOf(result), errValue}
+	})
+}
+
+// compiledProxy 生成工具的预编译代理，使用对话的上下文调用方法，未传或为null的参数不发送
+func (t *grpcToolset) compiledProxy(cm *ConversationManager, mt grpcMethodTool) toolProxy {
+	return func(ctx context.Context, params map[string]interface{}, lenient bool) (string, error) {
+		values := make(map[string]interface{}, len(mt.paramNames))
+		for _, name := range mt.paramNames {
+			if value := params[name]; value != nil {
+				values[name] = value
+			}
+		}
+		return cm.proxyResult(t.call(ctx, mt, values))
+	}
+}
+
+// call 编码请求消息并调用方法，返回JSON格式的响应
+func (t *grpcToolset) call(ctx context.Context, mt grpcMethodTool, args map[string]interface{}) (string, error) {
+	request, err := t.registry.encodeMessage(mt.method.inputType, args)
+	if err != nil {
+		return "", fmt.Errorf("编码请求失败: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+	responses, err := t.invoke(ctx, mt.path, request)
+	if err != nil {
+		return "", err
+	}
+
+	decoded := make([]interface{}, 0, len(responses))
+	for _, response := range responses {
+		message, err := t.registry.decodeMessage(mt.method.outputType, response)
+		if err != nil {
+			return "", fmt.Errorf("解码响应失败: %w", err)
+		}
+		decoded = append(decoded, message)
+	}
+	var result interface{} = decoded
+	if !mt.method.serverStreaming {
+		if len(decoded) != 1 {
+			return "", fmt.Errorf("一元方法返回了 %d 个响应", len(decoded))
+		}
+		result = decoded[0]
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("序列化响应失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// invoke 发送一个请求消息并读取所有响应消息，状态不是OK时返回*grpcStatusError
+func (t *grpcToolset) invoke(ctx context.Context, path string, request []byte) ([][]byte, error) {
+	// 消息前缀：1字节压缩标志和4字节大端长度
+	body := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(request)))
+	body = append(body, request...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.target+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(time.Until(deadline).Milliseconds(), 10)+"m")
+	}
+	for key, value := range t.config.Metadata {
+		req.Header.Set(key, value)
+	}
+	if t.config.Credentials != nil {
+		key, err := t.config.Credentials.APIKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("获取认证凭据失败: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		return nil, fmt.Errorf("服务端没有使用HTTP/2（%s），明文服务需要支持h2c的HTTPClient", resp.Proto)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxGRPCResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	// 只有状态没有消息的响应把状态放在响应头中
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "" && status != "0" {
+		code, _ := strconv.Atoi(status)
+		if unescaped, err := url.PathUnescape(message); err == nil {
+			message = unescaped
+		}
+		return nil, &grpcStatusError{code: code, message: message}
+	}
+
+	var messages [][]byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errors.New("响应消息格式错误")
+		}
+		if data[0] != 0 {
+			return nil, errors.New("不支持压缩的响应消息")
+		}
+		length := binary.BigEndian.Uint32(data[1:5])
+		if uint64(len(data)-5) < uint64(length) {
+			return nil, errors.New("响应消息不完整")
+		}
+		messages = append(messages, data[5:5+length])
+		data = data[5+length:]
+	}
+	return messages, nil
+}
+
+// reflection 向反射服务发送一个请求，返回响应中的字段；v1不可用时改用v1alpha
+func (t *grpcToolset) reflection(ctx context.Context, request []byte) ([]protoWireField, error) {
+	var lastErr error
+	for _, service := range grpcReflectionServices {
+		responses, err := t.invoke(ctx, "/"+service+"/ServerReflectionInfo", request)
+		if err != nil {
+			var statusErr *grpcStatusError
+			if errors.As(err, &statusErr) && statusErr.code == grpcStatusUnimplemented {
+				lastErr = err
+				continue
+			}
+			return nil, fmt.Errorf("调用反射服务失败: %w", err)
+		}
+		if len(responses) == 0 {
+			return nil, fmt.Errorf("反射服务没有返回响应")
+		}
+		fields, err := parseProtoFields(responses[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			// ServerReflectionResponse.error_response
+			if f.number == 7 {
+				errorFields, err := parseProtoFields(f.bytes)
+				if err != nil {
+					return nil, err
+				}
+				statusErr := &grpcStatusError{}
+				for _, ef := range errorFields {
+					switch ef.number {
+					case 1:
+						statusErr.code = int(int32(ef.varint))
+					case 2:
+						statusErr.message = string(ef.bytes)
+					}
+				}
+				return nil, fmt.Errorf("反射服务返回错误: %w", statusErr)
+			}
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("服务端没有开启反射: %w", lastErr)
+}
+
+// listServices 列出服务端的所有服务
+func (t *grpcToolset) listServices(ctx context.Context) ([]string, error) {
+	// ServerReflectionRequest.list_services
+	fields, err := t.reflection(ctx, appendProtoBytes(nil, 7, nil))
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, f := range fields {
+		if f.number != 6 {
+			continue
+		}
+		// ListServiceResponse.service
+		listFields, err := parseProtoFields(f.bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, lf := range listFields {
+			if lf.number != 1 {
+				continue
+			}
+			serviceFields, err := parseProtoFields(lf.bytes)
+			if err != nil {
+				return nil, err
+			}
+			for _, sf := range serviceFields {
+				if sf.number == 1 {
+					services = append(services, string(sf.bytes))
+				}
+			}
+		}
+	}
+	return services, nil
+}
+
+// loadSymbol 加载定义了symbol的文件及其依赖
+func (t *grpcToolset) loadSymbol(ctx context.Context, symbol string) error {
+	// ServerReflectionRequest.file_containing_symbol
+	pending, err := t.loadFiles(ctx, appendProtoBytes(nil, 4, []byte(symbol)))
+	if err != nil {
+		return err
+	}
+	// 服务端通常会一起返回依赖，没有返回的依赖按文件名逐个获取
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if t.registry.files[name] {
+			continue
+		}
+		// ServerReflectionRequest.file_by_filename
+		dependencies, err := t.loadFiles(ctx, appendProtoBytes(nil, 3, []byte(name)))
+		if err != nil {
+			return err
+		}
+		pending = append(pending, dependencies...)
+	}
+	return nil
+}
+
+// loadFiles 解析反射服务返回的文件描述符，返回尚未加载的依赖
+func (t *grpcToolset) loadFiles(ctx context.Context, request []byte) ([]string, error) {
+	fields, err := t.reflection(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var dependencies []string
+	for _, f := range fields {
+		// ServerReflectionResponse.file_descriptor_response
+		if f.number != 4 {
+			continue
+		}
+		fileFields, err := parseProtoFields(f.bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, ff := range fileFields {
+			if ff.number != 1 {
+				continue
+			}
+			_, deps, err := t.registry.addFile(ff.bytes)
+			if err != nil {
+				return nil, fmt.Errorf("解析文件描述符失败: %w", err)
+			}
+			dependencies = append(dependencies, deps...)
+		}
+	}
+	var missing []string
+	for _, name := range dependencies {
+		if !t.registry.files[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
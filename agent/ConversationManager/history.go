@@ -0,0 +1,188 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// HistoryError SetHistory校验失败的原因
+type HistoryError struct {
+	Index  int    // 出错的消息下标
+	Reason string // 错误原因
+}
+
+func (e *HistoryError) Error() string {
+	return fmt.Sprintf("历史记录第 %d 条消息无效: %s", e.Index, e.Reason)
+}
+
+// CopyHistory 返回历史记录的深拷贝，消息中的内容、工具调用和参数都不与历史记录共享，可以任意修改
+func (cm *ConversationManager) CopyHistory() []general.Message {
+	return copyMessages(cm.history)
+}
+
+// SetHistory 校验后用messages的深拷贝替换历史记录，未设置ID和创建时间的消息会被填充
+// 校验角色、工具调用ID的唯一性和参数、每个工具结果都对应前一条助手消息中的工具调用、每个工具调用都有结果；
+// 校验失败时返回*HistoryError，历史记录不变。对话进行中时不能替换
+func (cm *ConversationManager) SetHistory(messages []general.Message) error {
+	if cm.lifecycle.busy() {
+		return fmt.Errorf("对话进行中，不能替换历史记录")
+	}
+	if err := validateHistory(messages); err != nil {
+		return err
+	}
+	history := copyMessages(messages)
+	for i := range history {
+		stampMessage(&history[i])
+	}
+	cm.setHistory(context.Background(), history)
+	return nil
+}
+
+// historyView 返回历史记录的只读视图，容量与长度相同，持有者追加时不会写入历史记录的底层数组
+func (cm *ConversationManager) historyView() []general.Message {
+	return cm.history[:len(cm.history):len(cm.history)]
+}
+
+// validateHistory 校验历史记录的结构
+func validateHistory(messages []general.Message) error {
+	seen := make(map[string]bool) // 所有工具调用ID
+	var pending []general.ToolCall
+	pendingIndex := -1
+	answered := make(map[string]bool)
+
+	// closePending 工具结果序列结束时检查前一条助手消息的工具调用是否都有结果
+	closePending := func() error {
+		for _, toolCall := range pending {
+			if !answered[toolCall.ID] {
+				return &HistoryError{Index: pendingIndex, Reason: fmt.Sprintf("工具调用 %s 没有结果", toolCall.ID)}
+			}
+		}
+		pending = nil
+		return nil
+	}
+
+	for i, message := range messages {
+		switch message.Role {
+		case general.RoleTool:
+			if len(message.Content) == 0 {
+				return &HistoryError{Index: i, Reason: "工具消息没有内容"}
+			}
+			for _, content := range message.Content {
+				if content.Type != general.ContentTypeToolRes {
+					continue
+				}
+				if !callsContain(pending, content.ToolID) {
+					return &HistoryError{Index: i, Reason: fmt.Sprintf("工具结果 %s 没有对应的工具调用", content.ToolID)}
+				}
+				if answered[content.ToolID] {
+					return &HistoryError{Index: i, Reason: fmt.Sprintf("工具调用 %s 有多个结果", content.ToolID)}
+				}
+				answered[content.ToolID] = true
+			}
+			continue
+
+		case general.RoleSystem, general.RoleUser, general.RoleAssistant:
+			if err := closePending(); err != nil {
+				return err
+			}
+
+		default:
+			return &HistoryError{Index: i, Reason: fmt.Sprintf("未知的角色 %q", message.Role)}
+		}
+
+		if message.Role != general.RoleAssistant {
+			if len(message.ToolCalls) > 0 {
+				return &HistoryError{Index: i, Reason: "只有助手消息可以包含工具调用"}
+			}
+			if len(message.Content) == 0 {
+				return &HistoryError{Index: i, Reason: "消息没有内容"}
+			}
+			continue
+		}
+		for _, toolCall := range message.ToolCalls {
+			if toolCall.ID == "" {
+				return &HistoryError{Index: i, Reason: "工具调用缺少ID"}
+			}
+			if seen[toolCall.ID] {
+				return &HistoryError{Index: i, Reason: fmt.Sprintf("工具调用ID %s 重复", toolCall.ID)}
+			}
+			if toolCall.Function.Name == "" {
+				return &HistoryError{Index: i, Reason: fmt.Sprintf("工具调用 %s 缺少函数名称", toolCall.ID)}
+			}
+			if len(toolCall.Function.Arguments) > 0 && !json.Valid(toolCall.Function.Arguments) {
+				return &HistoryError{Index: i, Reason: fmt.Sprintf("工具调用 %s 的参数不是有效的JSON", toolCall.ID)}
+			}
+			seen[toolCall.ID] = true
+		}
+		pending, pendingIndex = message.ToolCalls, i
+	}
+	return closePending()
+}
+
+// callsContain 判断工具调用中是否有指定ID
+func callsContain(toolCalls []general.ToolCall, id string) bool {
+	for _, toolCall := range toolCalls {
+		if toolCall.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// copyMessages 深拷贝消息列表
+func copyMessages(messages []general.Message) []general.Message {
+	if messages == nil {
+		return nil
+	}
+	copied := make([]general.Message, len(messages))
+	for i, message := range messages {
+		copied[i] = copyMessage(message)
+	}
+	return copied
+}
+
+// copyMessage 深拷贝一条消息
+func copyMessage(message general.Message) general.Message {
+	if message.Content != nil {
+		contents := make([]general.Content, len(message.Content))
+		for i, content := range message.Content {
+			if content.ImageURL != nil {
+				imageURL := *content.ImageURL
+				content.ImageURL = &imageURL
+			}
+			if content.ToolCall != nil {
+				toolCall := copyToolCall(*content.ToolCall)
+				content.ToolCall = &toolCall
+			}
+			if content.Audio != nil {
+				audio := *content.Audio
+				content.Audio = &audio
+			}
+			if content.Document != nil {
+				document := *content.Document
+				content.Document = &document
+			}
+			contents[i] = content
+		}
+		message.Content = contents
+	}
+	if message.ToolCalls != nil {
+		toolCalls := make([]general.ToolCall, len(message.ToolCalls))
+		for i, toolCall := range message.ToolCalls {
+			toolCalls[i] = copyToolCall(toolCall)
+		}
+		message.ToolCalls = toolCalls
+	}
+	return message
+}
+
+// copyToolCall 深拷贝工具调用的参数
+func copyToolCall(toolCall general.ToolCall) general.ToolCall {
+	if toolCall.Function.Arguments != nil {
+		toolCall.Function.Arguments = append(json.RawMessage(nil), toolCall.Function.Arguments...)
+	}
+	return toolCall
+}
@@ -0,0 +1,206 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/base64"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ImageInput 图片输入，Base64、Data、Path、URL四选一，Detail为空时使用cm.ImageDetail
+type ImageInput struct {
+	Base64   string              // base64编码的图片数据
+	Data     []byte              // 原始图片数据
+	MimeType string              // 图片MIME类型，为空时根据数据或文件扩展名推断
+	Path     string              // 本地图片文件路径
+	URL      string              // 远程图片地址或data URL
+	Detail   general.ImageDetail // 图片详细程度，影响识别精度和token消耗
+}
+
+// supportedImageTypes 支持的图片MIME类型
+var supportedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// 图片token估算参数（参考OpenAI的计费方式）
+const (
+	imageBaseTokens    = 85   // 每张图片的基础token
+	imageTileTokens    = 170  // 高精度模式下每个512x512分块的token
+	imageDefaultTokens = 765  // 无法获取尺寸时按1024x1024高精度估算
+	imageMaxSide       = 2048 // 高精度模式下图片先缩放到2048x2048以内
+	imageShortSide     = 768  // 再将短边缩放到768
+	imageTileSize      = 512
+)
+
+// SetImageDetail 设置图片默认详细程度（默认为high）
+func (cm *ConversationManager) SetImageDetail(detail general.ImageDetail) {
+	cm.ImageDetail = detail
+}
+
+// ChatWithImages 发送消息并处理回复，可以为每张图片单独指定详细程度，结束原因与Chat相同
+func (cm *ConversationManager) ChatWithImages(ctx context.Context, provider general.Provider, model string, userMessage string, images []ImageInput, info_chan chan general.Message) ([]general.Message, string, error, *general.Usage) {
+	messages, stopReason, err, usage := cm.chatWithImages(ctx, provider, model, "", userMessage, images, info_chan)
+	return messages, string(stopReason), err, usage
+}
+
+// chatWithImages 构建用户消息内容后发送，speaker为发言人，为空时不标记
+func (cm *ConversationManager) chatWithImages(ctx context.Context, provider general.Provider, model string, speaker string, userMessage string, images []ImageInput, info_chan chan general.Message) ([]general.Message, general.StopReason, error, *general.Usage) {
+	var content []general.Content
+
+	// 添加文本消息
+	if userMessage != "" {
+		content = append(content, general.Content{
+			Type: general.ContentTypeText,
+			Text: userMessage,
+		})
+	}
+
+	// 添加图片
+	for i, img := range images {
+		url, err := img.toURL(cm.Locale())
+		if err != nil {
+			err = cm.errorf(err, MsgErrImage, i+1, err)
+			cm.finishTurn("", err, nil)
+			cm.flushDeliveries(info_chan)
+			return nil, "", err, nil
+		}
+		detail := img.Detail
+		if detail == "" {
+			detail = cm.imageDetail()
+		}
+		content = append(content, general.Content{
+			Type: general.ContentTypeImageURL,
+			ImageURL: &general.ImageURL{
+				URL:    url,
+				Detail: detail,
+			},
+		})
+	}
+
+	// 添加通过AttachFile/AttachBytes准备的附件，发送成功后清空
+	content = append(content, cm.compressAttachments(ctx, cm.attachments)...)
+	userMsg := general.Message{Role: general.RoleUser, Name: speaker, Content: content}
+	messages, stopReason, err, usage := cm.chat(ctx, provider, model, userMsg, info_chan)
+	if err == nil {
+		cm.attachments = nil
+	}
+	return messages, stopReason, err, usage
+}
+
+// toURL 将图片输入转换为远程URL或带正确MIME类型的data URL
+func (img ImageInput) toURL(locale Locale) (string, error) {
+	switch {
+	case img.URL != "":
+		return img.URL, nil
+	case img.Path != "":
+		data, err := os.ReadFile(img.Path)
+		if err != nil {
+			return "", localeErrorf(locale, err, MsgErrReadImage, err)
+		}
+		mimeType := img.MimeType
+		if mimeType == "" {
+			mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(img.Path)))
+		}
+		return buildImageDataURL(data, mimeType, locale)
+	case len(img.Data) > 0:
+		return buildImageDataURL(img.Data, img.MimeType, locale)
+	case img.Base64 != "":
+		mimeType := img.MimeType
+		if mimeType == "" {
+			// 只解码头部用于识别格式
+			head := make([]byte, 512)
+			n, _ := io.ReadFull(base64.NewDecoder(base64.StdEncoding, strings.NewReader(img.Base64)), head)
+			mimeType = http.DetectContentType(head[:n])
+			if !supportedImageTypes[mimeType] {
+				// 无法识别时保持原有的png行为
+				mimeType = "image/png"
+			}
+		}
+		return "data:" + mimeType + ";base64," + img.Base64, nil
+	default:
+		return "", localeErrorf(locale, nil, MsgErrEmptyImage)
+	}
+}
+
+// buildImageDataURL 将图片数据编码为data URL，mimeType为空时根据数据内容推断
+func buildImageDataURL(data []byte, mimeType string, locale Locale) (string, error) {
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if !supportedImageTypes[mimeType] {
+		return "", localeErrorf(locale, nil, MsgErrImageFormat, mimeType)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// imageDetail 获取默认图片详细程度
+func (cm *ConversationManager) imageDetail() general.ImageDetail {
+	if cm.ImageDetail == "" {
+		return general.DetailHigh
+	}
+	return cm.ImageDetail
+}
+
+// estimateImageTokens 估算单张图片的token数量
+// 低精度固定为85 token；高精度按512x512分块计算，无法获取尺寸时使用默认估算
+func estimateImageTokens(img *general.ImageURL) int {
+	if img == nil {
+		return 0
+	}
+	if img.Detail == general.DetailLow {
+		return imageBaseTokens
+	}
+
+	width, height, ok := imageSize(img.URL)
+	if !ok {
+		return imageDefaultTokens
+	}
+
+	// 缩放到2048x2048以内
+	if width > imageMaxSide || height > imageMaxSide {
+		scale := float64(imageMaxSide) / float64(max(width, height))
+		width = int(float64(width) * scale)
+		height = int(float64(height) * scale)
+	}
+	// 短边缩放到768
+	if shortSide := min(width, height); shortSide > imageShortSide {
+		scale := float64(imageShortSide) / float64(shortSide)
+		width = int(float64(width) * scale)
+		height = int(float64(height) * scale)
+	}
+
+	tilesX := (width + imageTileSize - 1) / imageTileSize
+	tilesY := (height + imageTileSize - 1) / imageTileSize
+	return imageBaseTokens + imageTileTokens*tilesX*tilesY
+}
+
+// imageSize 从data URL中读取图片尺寸，只解码图片头部
+func imageSize(url string) (int, int, bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return 0, 0, false
+	}
+	idx := strings.Index(url, ";base64,")
+	if idx < 0 {
+		return 0, 0, false
+	}
+
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(url[idx+len(";base64,"):]))
+	config, _, err := image.DecodeConfig(decoder)
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
@@ -0,0 +1,414 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// openAIImportMessage OpenAI Chat Completions格式的消息，content可以是字符串、内容数组或null
+type openAIImportMessage struct {
+	Role             string                 `json:"role"`
+	Content          json.RawMessage        `json:"content"`
+	Name             string                 `json:"name"`
+	ToolCalls        []openAIImportToolCall `json:"tool_calls"`
+	ToolCallID       string                 `json:"tool_call_id"`
+	FunctionCall     *openAIImportFunction  `json:"function_call"` // 旧版的函数调用，没有ID
+	ReasoningContent string                 `json:"reasoning_content"`
+	Audio            *struct {
+		ID         string `json:"id"`
+		Transcript string `json:"transcript"`
+	} `json:"audio"`
+}
+
+type openAIImportToolCall struct {
+	ID       string               `json:"id"`
+	Type     string               `json:"type"`
+	Function openAIImportFunction `json:"function"`
+}
+
+type openAIImportFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"` // JSON字符串形式的参数
+}
+
+// openAIImportPart OpenAI的多模态内容项
+type openAIImportPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageURL *struct {
+		URL    string `json:"url"`
+		Detail string `json:"detail"`
+	} `json:"image_url"`
+	InputAudio *struct {
+		Data   string `json:"data"`
+		Format string `json:"format"`
+	} `json:"input_audio"`
+	File *struct {
+		Filename string `json:"filename"`
+		FileData string `json:"file_data"`
+	} `json:"file"`
+}
+
+// ImportOpenAIMessages 将OpenAI Chat Completions格式的消息转换为历史记录，用于迁移已有的对话
+// data可以是消息数组，也可以是带messages字段的请求体；developer消息视为system消息，
+// 旧版的function_call和function角色的消息转换为工具调用和工具结果。
+// 返回的消息没有ID和创建时间，通过SetHistory设置时校验并填充
+func ImportOpenAIMessages(data []byte) ([]general.Message, error) {
+	var messages []openAIImportMessage
+	if err := decodeImportMessages(data, &messages, nil); err != nil {
+		return nil, fmt.Errorf("解析OpenAI消息失败: %w", err)
+	}
+
+	history := make([]general.Message, 0, len(messages))
+	legacyCalls := make(map[string][]string) // 旧版函数调用按函数名记录尚未应答的调用ID
+	for i, msg := range messages {
+		content, err := openAIImportContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("导入第 %d 条消息失败: %w", i, err)
+		}
+
+		switch msg.Role {
+		case "system", "developer":
+			history = append(history, general.Message{Role: general.RoleSystem, Content: content})
+
+		case "user":
+			history = append(history, general.Message{Role: general.RoleUser, Name: msg.Name, Content: content})
+
+		case "assistant":
+			imported := general.Message{
+				Role:             general.RoleAssistant,
+				Name:             msg.Name,
+				Content:          content,
+				ReasoningContent: msg.ReasoningContent,
+			}
+			if msg.Audio != nil && msg.Audio.ID != "" {
+				imported.Content = append(imported.Content, general.Content{
+					Type:  general.ContentTypeAudio,
+					Audio: &general.Audio{ID: msg.Audio.ID, Transcript: msg.Audio.Transcript},
+				})
+			}
+			for _, toolCall := range msg.ToolCalls {
+				appendImportedToolCall(&imported, toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments)
+			}
+			if msg.FunctionCall != nil {
+				id := fmt.Sprintf("call_legacy_%d", i)
+				legacyCalls[msg.FunctionCall.Name] = append(legacyCalls[msg.FunctionCall.Name], id)
+				appendImportedToolCall(&imported, id, msg.FunctionCall.Name, msg.FunctionCall.Arguments)
+			}
+			history = append(history, imported)
+
+		case "tool", "function":
+			id := msg.ToolCallID
+			if msg.Role == "function" {
+				pending := legacyCalls[msg.Name]
+				if len(pending) == 0 {
+					return nil, fmt.Errorf("导入第 %d 条消息失败: 函数 %s 的结果没有对应的调用", i, msg.Name)
+				}
+				id, legacyCalls[msg.Name] = pending[0], pending[1:]
+			}
+			history = append(history, importedToolResult(id, contentText(content)))
+
+		default:
+			return nil, fmt.Errorf("导入第 %d 条消息失败: 未知的角色 %q", i, msg.Role)
+		}
+	}
+	return history, nil
+}
+
+// openAIImportContent 转换OpenAI的消息内容，空文本被去掉
+func openAIImportContent(raw json.RawMessage) ([]general.Content, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return textContent(text), nil
+	}
+
+	var parts []openAIImportPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("内容格式无效: %w", err)
+	}
+	var content []general.Content
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			content = append(content, textContent(part.Text)...)
+		case "refusal":
+			content = append(content, textContent(part.Refusal)...)
+		case "image_url":
+			if part.ImageURL == nil {
+				return nil, fmt.Errorf("image_url内容缺少image_url字段")
+			}
+			content = append(content, general.Content{
+				Type:     general.ContentTypeImageURL,
+				ImageURL: &general.ImageURL{URL: part.ImageURL.URL, Detail: general.ImageDetail(part.ImageURL.Detail)},
+			})
+		case "input_audio":
+			if part.InputAudio == nil {
+				return nil, fmt.Errorf("input_audio内容缺少input_audio字段")
+			}
+			content = append(content, general.Content{
+				Type:  general.ContentTypeAudio,
+				Audio: &general.Audio{Data: part.InputAudio.Data, Format: part.InputAudio.Format},
+			})
+		case "file":
+			if part.File == nil {
+				return nil, fmt.Errorf("file内容缺少file字段")
+			}
+			mimeType, data, ok := parseDataURL(part.File.FileData)
+			if !ok {
+				return nil, fmt.Errorf("文件 %s 不是base64编码的data URL，不能导入", part.File.Filename)
+			}
+			content = append(content, general.Content{
+				Type:     general.ContentTypeDocument,
+				Document: &general.Document{Name: part.File.Filename, MimeType: mimeType, Data: data},
+			})
+		default:
+			return nil, fmt.Errorf("不支持的内容类型 %q", part.Type)
+		}
+	}
+	return content, nil
+}
+
+// anthropicImportMessage Anthropic Messages API格式的消息，content可以是字符串或内容块数组
+type anthropicImportMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// anthropicImportBlock Anthropic的内容块
+type anthropicImportBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"` // 工具结果，可以是字符串或内容块数组
+	Title     string          `json:"title"`
+	Source    *struct {
+		Type      string `json:"type"` // base64、url或text
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+		URL       string `json:"url"`
+	} `json:"source"`
+}
+
+// ImportAnthropicMessages 将Anthropic Messages API格式的对话转换为历史记录，用于迁移已有的对话
+// data可以是消息数组，也可以是带messages和system字段的请求体，system转换为第一条system消息；
+// tool_use转换为助手消息的工具调用，user消息中的tool_result拆分为单独的工具消息，thinking转换为思考内容。
+// 返回的消息没有ID和创建时间，通过SetHistory设置时校验并填充
+func ImportAnthropicMessages(data []byte) ([]general.Message, error) {
+	var messages []anthropicImportMessage
+	var system json.RawMessage
+	if err := decodeImportMessages(data, &messages, &system); err != nil {
+		return nil, fmt.Errorf("解析Anthropic消息失败: %w", err)
+	}
+
+	var history []general.Message
+	if len(bytes.TrimSpace(system)) > 0 && string(bytes.TrimSpace(system)) != "null" {
+		blocks, err := anthropicImportBlocks(system)
+		if err != nil {
+			return nil, fmt.Errorf("导入system失败: %w", err)
+		}
+		var parts []string
+		for _, block := range blocks {
+			if block.Type == "text" && block.Text != "" {
+				parts = append(parts, block.Text)
+			}
+		}
+		if len(parts) > 0 {
+			history = append(history, general.Message{Role: general.RoleSystem, Content: textContent(strings.Join(parts, "\n\n"))})
+		}
+	}
+
+	for i, msg := range messages {
+		blocks, err := anthropicImportBlocks(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("导入第 %d 条消息失败: %w", i, err)
+		}
+
+		var role general.MessageRole
+		switch msg.Role {
+		case "user":
+			role = general.RoleUser
+		case "assistant":
+			role = general.RoleAssistant
+		default:
+			return nil, fmt.Errorf("导入第 %d 条消息失败: 未知的角色 %q", i, msg.Role)
+		}
+
+		imported := general.Message{Role: role}
+		var reasoning []string
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				imported.Content = append(imported.Content, textContent(block.Text)...)
+			case "thinking":
+				reasoning = append(reasoning, block.Thinking)
+			case "redacted_thinking":
+				// 加密的思考内容不能还原，跳过
+			case "tool_use":
+				if role != general.RoleAssistant {
+					return nil, fmt.Errorf("导入第 %d 条消息失败: tool_use只能出现在assistant消息中", i)
+				}
+				appendImportedToolCall(&imported, block.ID, block.Name, block.Input)
+			case "tool_result":
+				// 工具结果在OpenAI格式和本项目中是单独的工具消息，放在该条user消息的其余内容之前
+				resultBlocks, err := anthropicImportBlocks(block.Content)
+				if err != nil {
+					return nil, fmt.Errorf("导入第 %d 条消息的工具结果失败: %w", i, err)
+				}
+				var texts []string
+				for _, result := range resultBlocks {
+					if result.Type == "text" {
+						texts = append(texts, result.Text)
+					}
+				}
+				history = append(history, importedToolResult(block.ToolUseID, strings.Join(texts, "\n")))
+			case "image", "document":
+				content, err := anthropicImportSource(block)
+				if err != nil {
+					return nil, fmt.Errorf("导入第 %d 条消息失败: %w", i, err)
+				}
+				imported.Content = append(imported.Content, content)
+			default:
+				return nil, fmt.Errorf("导入第 %d 条消息失败: 不支持的内容块类型 %q", i, block.Type)
+			}
+		}
+		imported.ReasoningContent = strings.Join(reasoning, "\n")
+		if len(imported.Content) > 0 || len(imported.ToolCalls) > 0 {
+			history = append(history, imported)
+		}
+	}
+	return history, nil
+}
+
+// anthropicImportBlocks 解析内容块数组，字符串内容视为一个文本块
+func anthropicImportBlocks(raw json.RawMessage) ([]anthropicImportBlock, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []anthropicImportBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicImportBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, fmt.Errorf("内容格式无效: %w", err)
+	}
+	return blocks, nil
+}
+
+// anthropicImportSource 转换图片和文档内容块，文本来源的文档转换为文本
+func anthropicImportSource(block anthropicImportBlock) (general.Content, error) {
+	source := block.Source
+	if source == nil {
+		return general.Content{}, fmt.Errorf("%s内容块缺少source字段", block.Type)
+	}
+	switch {
+	case block.Type == "image" && source.Type == "base64":
+		return general.Content{
+			Type:     general.ContentTypeImageURL,
+			ImageURL: &general.ImageURL{URL: "data:" + source.MediaType + ";base64," + source.Data},
+		}, nil
+	case block.Type == "image" && source.Type == "url":
+		return general.Content{Type: general.ContentTypeImageURL, ImageURL: &general.ImageURL{URL: source.URL}}, nil
+	case block.Type == "document" && source.Type == "base64":
+		return general.Content{
+			Type:     general.ContentTypeDocument,
+			Document: &general.Document{Name: block.Title, MimeType: source.MediaType, Data: source.Data},
+		}, nil
+	case block.Type == "document" && source.Type == "text":
+		return general.Content{Type: general.ContentTypeText, Text: source.Data}, nil
+	}
+	return general.Content{}, fmt.Errorf("不支持来源类型为 %q 的%s内容块", source.Type, block.Type)
+}
+
+// decodeImportMessages 解析消息数组或带messages字段的对象，system不为nil时同时取出system字段
+func decodeImportMessages(data []byte, messages interface{}, system *json.RawMessage) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, messages)
+	}
+	var envelope struct {
+		Messages json.RawMessage `json:"messages"`
+		System   json.RawMessage `json:"system"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if len(envelope.Messages) == 0 {
+		return fmt.Errorf("缺少messages字段")
+	}
+	if system != nil {
+		*system = envelope.System
+	}
+	return json.Unmarshal(envelope.Messages, messages)
+}
+
+// appendImportedToolCall 添加工具调用，与提供商的响应一样同时记录在ToolCalls和内容中
+func appendImportedToolCall(msg *general.Message, id, name string, arguments json.RawMessage) {
+	call := general.ToolCall{
+		ID:   id,
+		Type: "function",
+		Function: general.FunctionCall{
+			Name:      name,
+			Arguments: normalizeArguments(arguments),
+		},
+	}
+	msg.ToolCalls = append(msg.ToolCalls, call)
+	contentCall := call
+	msg.Content = append(msg.Content, general.Content{Type: general.ContentTypeTool, ToolCall: &contentCall})
+}
+
+// importedToolResult 创建工具结果消息
+func importedToolResult(toolID, text string) general.Message {
+	return general.Message{
+		Role:    general.RoleTool,
+		Content: []general.Content{{Type: general.ContentTypeToolRes, Text: text, ToolID: toolID}},
+	}
+}
+
+// textContent 将非空文本转换为文本内容
+func textContent(text string) []general.Content {
+	if text == "" {
+		return nil
+	}
+	return []general.Content{{Type: general.ContentTypeText, Text: text}}
+}
+
+// contentText 拼接内容中的文本
+func contentText(content []general.Content) string {
+	var texts []string
+	for _, c := range content {
+		if c.Type == general.ContentTypeText {
+			texts = append(texts, c.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// parseDataURL 解析base64编码的data URL，返回MIME类型和数据
+func parseDataURL(url string) (string, string, bool) {
+	header, data, ok := strings.Cut(url, ",")
+	if !ok || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64"), data, true
+}
@@ -0,0 +1,312 @@
+package ConversationManager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// DefaultJournalCompactThreshold 日志中的记录数达到该值时压缩为一个快照
+const DefaultJournalCompactThreshold = 1000
+
+// journalOp 日志记录的操作类型
+type journalOp string
+
+const (
+	journalAppend   journalOp = "append"   // 追加一条消息
+	journalTruncate journalOp = "truncate" // 历史记录回滚到Length条消息
+	journalSnapshot journalOp = "snapshot" // 完整的历史记录，替换之前的所有内容
+)
+
+// journalRecord 日志中的一条记录，每条记录占一行JSON
+type journalRecord struct {
+	Op       journalOp         `json:"op"`
+	Message  *general.Message  `json:"message,omitempty"`
+	Length   int               `json:"length,omitempty"`
+	Messages []general.Message `json:"messages,omitempty"`
+}
+
+// Journal 只追加的历史记录日志，每轮对话只写入新增的消息，不重写整个历史记录，适合持久化长会话
+// 失败回滚写入截断记录，压缩、截断、迁移等改写历史记录的操作写入完整快照；
+// 记录数达到压缩阈值时将日志重写为一个快照，避免日志无限增长。用LoadJournal读取，加密的日志用LoadEncryptedJournal读取
+type Journal struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	records   int // 日志中的记录数
+	threshold int
+	encryptor Encryptor // 不为nil时每条记录加密后以Base64写入一行
+	recordKey Encryptor // encryptor支持DataKeyCache时缓存的数据密钥，压缩时更换
+}
+
+// NewJournal 创建写入指定文件的日志，文件中原有的记录在SetJournal时被当前历史记录的快照替换
+// 继续之前的会话时先用LoadJournal读取历史记录并通过SetHistory恢复，再设置日志
+func NewJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开历史日志失败: %w", err)
+	}
+	return &Journal{path: path, file: file, threshold: DefaultJournalCompactThreshold}, nil
+}
+
+// NewEncryptedJournal 与NewJournal相同，但每条记录用encryptor加密后写入，用LoadEncryptedJournal读取
+// 从明文日志迁移时先用LoadJournal读取历史记录并恢复，再设置加密的日志，设置时整个文件被重写为加密的快照
+func NewEncryptedJournal(path string, encryptor Encryptor) (*Journal, error) {
+	journal, err := NewJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	journal.encryptor = encryptor
+	return journal, nil
+}
+
+// SetCompactThreshold 设置压缩阈值，日志中的记录数达到该值时重写为一个快照，<=0时不自动压缩
+func (j *Journal) SetCompactThreshold(records int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.threshold = records
+}
+
+// Close 关闭日志文件，之后的写入返回错误
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// write 追加一条记录，记录数达到阈值时以history为快照压缩日志
+func (j *Journal) write(ctx context.Context, record journalRecord, history []general.Message) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return fmt.Errorf("历史日志已关闭")
+	}
+	if j.threshold > 0 && j.records+1 >= j.threshold {
+		return j.compact(ctx, history)
+	}
+	line, err := j.encode(ctx, record)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(line); err != nil {
+		return fmt.Errorf("写入历史日志失败: %w", err)
+	}
+	j.records++
+	return nil
+}
+
+// encode 将记录编码为一行，设置了encryptor时加密后以Base64编码
+func (j *Journal) encode(ctx context.Context, record journalRecord) ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if j.encryptor != nil {
+		encryptor, err := j.recordEncryptor(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("加密历史日志失败: %w", err)
+		}
+		encrypted, err := encryptor.Encrypt(ctx, line)
+		if err != nil {
+			return nil, fmt.Errorf("加密历史日志失败: %w", err)
+		}
+		line = base64.StdEncoding.AppendEncode(nil, encrypted)
+	}
+	return append(line, '\n'), nil
+}
+
+// recordEncryptor 返回加密记录使用的加密器，encryptor支持DataKeyCache时整个日志复用一个数据密钥
+func (j *Journal) recordEncryptor(ctx context.Context) (Encryptor, error) {
+	if j.recordKey != nil {
+		return j.recordKey, nil
+	}
+	cache, ok := j.encryptor.(DataKeyCache)
+	if !ok {
+		return j.encryptor, nil
+	}
+	encryptor, err := cache.CacheDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	j.recordKey = encryptor
+	return encryptor, nil
+}
+
+// compact 将日志重写为history的快照，先写临时文件再重命名，中断时原日志保持不变
+// 重写后的日志使用新的数据密钥
+func (j *Journal) compact(ctx context.Context, history []general.Message) error {
+	j.recordKey = nil
+	line, err := j.encode(ctx, journalRecord{Op: journalSnapshot, Messages: history})
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, line, 0o600); err != nil {
+		return fmt.Errorf("压缩历史日志失败: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("压缩历史日志失败: %w", err)
+	}
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("打开历史日志失败: %w", err)
+	}
+	j.file.Close()
+	j.file = file
+	j.records = 1
+	return nil
+}
+
+// LoadJournal 读取日志并按顺序应用其中的记录，返回日志记录的历史记录
+// 写入时中断导致的不完整的最后一行被忽略；加密的日志返回ErrEncrypted
+func LoadJournal(path string) ([]general.Message, error) {
+	return loadJournal(context.Background(), path, nil)
+}
+
+// LoadEncryptedJournal 读取NewEncryptedJournal写入的日志，未加密的记录返回ErrNotEncrypted
+func LoadEncryptedJournal(ctx context.Context, path string, encryptor Encryptor) ([]general.Message, error) {
+	return loadJournal(ctx, path, encryptor)
+}
+
+// loadJournal 读取日志，encryptor不为nil时每条记录都必须是加密的
+func loadJournal(ctx context.Context, path string, encryptor Encryptor) ([]general.Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取历史日志失败: %w", err)
+	}
+	defer file.Close()
+
+	var history []general.Message
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, fmt.Errorf("读取历史日志失败: %w", readErr)
+		}
+		complete := readErr == nil
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var record journalRecord
+			if err := decodeJournalRecord(ctx, line, encryptor, &record); err != nil {
+				if !complete && !errors.Is(err, ErrEncrypted) && !errors.Is(err, ErrNotEncrypted) {
+					break
+				}
+				return nil, fmt.Errorf("历史日志第 %d 行无效: %w", lineNo, err)
+			}
+			switch record.Op {
+			case journalAppend:
+				if record.Message != nil {
+					history = append(history, *record.Message)
+				}
+			case journalTruncate:
+				if record.Length > len(history) {
+					return nil, fmt.Errorf("历史日志第 %d 行截断到 %d 条消息，但只有 %d 条", lineNo, record.Length, len(history))
+				}
+				history = history[:record.Length]
+			case journalSnapshot:
+				history = record.Messages
+			default:
+				return nil, fmt.Errorf("历史日志第 %d 行的操作 %q 未知", lineNo, record.Op)
+			}
+		}
+		if !complete {
+			return history, nil
+		}
+	}
+	return history, nil
+}
+
+// decodeJournalRecord 解析一行记录，encryptor不为nil时先Base64解码并解密
+func decodeJournalRecord(ctx context.Context, line []byte, encryptor Encryptor, record *journalRecord) error {
+	// 明文记录是JSON对象，加密记录是Base64
+	plaintext := line[0] == '{'
+	if encryptor == nil {
+		if !plaintext {
+			return fmt.Errorf("%w，请使用LoadEncryptedJournal", ErrEncrypted)
+		}
+		return json.Unmarshal(line, record)
+	}
+	if plaintext {
+		return ErrNotEncrypted
+	}
+	encrypted, err := base64.StdEncoding.AppendDecode(nil, line)
+	if err != nil {
+		return err
+	}
+	data, err := encryptor.Decrypt(ctx, encrypted)
+	if err != nil {
+		return fmt.Errorf("解密失败: %w", err)
+	}
+	return json.Unmarshal(data, record)
+}
+
+// SetJournal 设置会话的历史日志，为nil时不记录；设置时日志被重写为当前历史记录的快照
+// 之后的记录在对话中写入，加密时使用对话的ctx
+func (cm *ConversationManager) SetJournal(ctx context.Context, journal *Journal) error {
+	cm.journal = journal
+	if journal == nil {
+		return nil
+	}
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	if journal.file == nil {
+		return fmt.Errorf("历史日志已关闭")
+	}
+	return journal.compact(ctx, cm.history)
+}
+
+// CompactJournal 立即将历史日志重写为当前历史记录的快照
+func (cm *ConversationManager) CompactJournal(ctx context.Context) error {
+	if cm.journal == nil {
+		return nil
+	}
+	cm.journal.mu.Lock()
+	defer cm.journal.mu.Unlock()
+	if cm.journal.file == nil {
+		return fmt.Errorf("历史日志已关闭")
+	}
+	return cm.journal.compact(ctx, cm.history)
+}
+
+// journalWrite 写入日志记录，写入失败时通过事件通道报告，不中断对话
+func (cm *ConversationManager) journalWrite(ctx context.Context, record journalRecord) {
+	if cm.journal == nil {
+		return
+	}
+	if err := cm.journal.write(ctx, record, cm.history); err != nil {
+		cm.emit(Event{Type: EventError, Err: err})
+	}
+}
+
+// setHistory 用messages替换历史记录并写入快照，messages与当前历史记录是同一个切片时不写入
+func (cm *ConversationManager) setHistory(ctx context.Context, messages []general.Message) {
+	if len(messages) == len(cm.history) && (len(messages) == 0 || &messages[0] == &cm.history[0]) {
+		return
+	}
+	cm.history = messages
+	cm.journalWrite(ctx, journalRecord{Op: journalSnapshot, Messages: messages})
+}
+
+// restoreHistory 失败时将历史记录恢复为之前的前缀，日志中只写入截断记录
+func (cm *ConversationManager) restoreHistory(ctx context.Context, prefix []general.Message) {
+	if len(prefix) == len(cm.history) {
+		cm.history = prefix
+		return
+	}
+	cm.history = prefix
+	// 回滚通常发生在ctx取消之后，截断记录仍需写入，否则日志中留下已回滚的消息
+	cm.journalWrite(context.WithoutCancel(ctx), journalRecord{Op: journalTruncate, Length: len(prefix)})
+}
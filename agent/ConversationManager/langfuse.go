@@ -0,0 +1,221 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LangfuseConfig Langfuse的连接配置，可以从YAML文件读取
+// 值为${NAME}时从环境变量NAME读取；Host、PublicKey和SecretKey为空时分别读取LANGFUSE_HOST、LANGFUSE_PUBLIC_KEY和LANGFUSE_SECRET_KEY
+type LangfuseConfig struct {
+	Host        string   `yaml:"Host,omitempty"` // 默认https://cloud.langfuse.com，自部署时为服务地址
+	PublicKey   string   `yaml:"PublicKey,omitempty"`
+	SecretKey   string   `yaml:"SecretKey,omitempty"`
+	TraceName   string   `yaml:"TraceName,omitempty"`   // 追踪名称，为空时为GoAgent
+	Release     string   `yaml:"Release,omitempty"`     // 应用的版本，用于在Langfuse中按版本对比
+	Environment string   `yaml:"Environment,omitempty"` // 环境，如production、staging
+	Tags        []string `yaml:"Tags,omitempty"`
+}
+
+// LoadLangfuseConfig 从YAML文件读取Langfuse配置
+func LoadLangfuseConfig(path string) (*LangfuseConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取Langfuse配置文件失败: %w", err)
+	}
+	return ParseLangfuseConfig(data)
+}
+
+// ParseLangfuseConfig 解析YAML格式的Langfuse配置
+func ParseLangfuseConfig(data []byte) (*LangfuseConfig, error) {
+	var config LangfuseConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("解析Langfuse配置失败: %w", err)
+	}
+	return &config, nil
+}
+
+// LangfuseScore 对一次对话的评分，如用户反馈或自动评估的结果
+type LangfuseScore struct {
+	Name    string
+	Value   float64
+	Comment string
+}
+
+// LangfuseExporter 通过Langfuse的ingestion接口导出追踪：每次对话为一个trace，
+// 对话本身和工具调用为span，模型请求为带模型名和token用量的generation
+type LangfuseExporter struct {
+	config     LangfuseConfig
+	HTTPClient *http.Client // 为nil时使用http.DefaultClient
+	// Scorer 可选，导出追踪时计算评分并一同上传，如按结束原因或工具错误打分
+	Scorer func(trace *Trace) []LangfuseScore
+}
+
+// NewLangfuseExporter 创建Langfuse追踪导出器，通过AddTraceExporter添加到会话
+func NewLangfuseExporter(config LangfuseConfig) (*LangfuseExporter, error) {
+	config.Host = expandLangfuseValue(config.Host, "LANGFUSE_HOST")
+	config.PublicKey = expandLangfuseValue(config.PublicKey, "LANGFUSE_PUBLIC_KEY")
+	config.SecretKey = expandLangfuseValue(config.SecretKey, "LANGFUSE_SECRET_KEY")
+	if config.PublicKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("Langfuse的PublicKey和SecretKey不能为空")
+	}
+	if config.Host == "" {
+		config.Host = "https://cloud.langfuse.com"
+	}
+	config.Host = strings.TrimRight(config.Host, "/")
+	if config.TraceName == "" {
+		config.TraceName = "GoAgent"
+	}
+	return &LangfuseExporter{config: config}, nil
+}
+
+// ExportTrace 上传追踪、其中的所有观测和Scorer计算的评分
+func (e *LangfuseExporter) ExportTrace(ctx context.Context, trace *Trace) error {
+	root := trace.Spans[0]
+	events := []map[string]interface{}{e.event("trace-create", trace.Start, map[string]interface{}{
+		"id":          trace.ID,
+		"timestamp":   trace.Start.UTC().Format(time.RFC3339Nano),
+		"name":        e.config.TraceName,
+		"sessionId":   trace.SessionID,
+		"input":       traceMessages(root.Input),
+		"output":      traceMessages(root.Output),
+		"metadata":    map[string]interface{}{"turn": trace.Turn, "provider": root.Provider, "model": root.Model},
+		"release":     e.config.Release,
+		"environment": e.config.Environment,
+		"tags":        e.config.Tags,
+	})}
+
+	for _, span := range trace.Spans {
+		body := map[string]interface{}{
+			"id":          span.ID,
+			"traceId":     trace.ID,
+			"name":        span.Name,
+			"startTime":   span.Start.UTC().Format(time.RFC3339Nano),
+			"endTime":     span.End.UTC().Format(time.RFC3339Nano),
+			"metadata":    span.Metadata,
+			"environment": e.config.Environment,
+		}
+		if span.ParentID != "" {
+			body["parentObservationId"] = span.ParentID
+		}
+		if span.Error != "" {
+			body["level"] = "ERROR"
+			body["statusMessage"] = span.Error
+		}
+
+		eventType := "span-create"
+		switch span.Kind {
+		case SpanKindLLM:
+			eventType = "generation-create"
+			body["model"] = span.Model
+			body["input"] = traceMessages(span.Input)
+			body["output"] = traceMessages(span.Output)
+			body["metadata"] = map[string]interface{}{"provider": span.Provider}
+			if span.Usage != nil {
+				body["usage"] = map[string]interface{}{
+					"input":  span.Usage.PromptTokens,
+					"output": span.Usage.CompletionTokens,
+					"total":  span.Usage.TotalTokens,
+					"unit":   "TOKENS",
+				}
+			}
+		case SpanKindTool:
+			body["input"] = spanJSON(span.Input)
+			body["output"] = span.Output
+		default:
+			body["input"] = traceMessages(span.Input)
+			body["output"] = traceMessages(span.Output)
+		}
+		events = append(events, e.event(eventType, span.Start, body))
+	}
+
+	if e.Scorer != nil {
+		for _, score := range e.Scorer(trace) {
+			events = append(events, e.scoreEvent(trace.ID, score))
+		}
+	}
+	return e.ingest(ctx, events)
+}
+
+// Score 给一次对话打分，traceID可以通过ConversationManager.LastTraceID获取
+func (e *LangfuseExporter) Score(ctx context.Context, traceID string, score LangfuseScore) error {
+	if traceID == "" {
+		return fmt.Errorf("追踪ID不能为空")
+	}
+	if score.Name == "" {
+		return fmt.Errorf("评分名称不能为空")
+	}
+	return e.ingest(ctx, []map[string]interface{}{e.scoreEvent(traceID, score)})
+}
+
+// scoreEvent 构造评分事件
+func (e *LangfuseExporter) scoreEvent(traceID string, score LangfuseScore) map[string]interface{} {
+	body := map[string]interface{}{
+		"id":       traceUUID(newTraceID()),
+		"traceId":  traceID,
+		"name":     score.Name,
+		"value":    score.Value,
+		"dataType": "NUMERIC",
+	}
+	if score.Comment != "" {
+		body["comment"] = score.Comment
+	}
+	if e.config.Environment != "" {
+		body["environment"] = e.config.Environment
+	}
+	return e.event("score-create", time.Now(), body)
+}
+
+// event 构造一个ingestion事件
+func (e *LangfuseExporter) event(eventType string, timestamp time.Time, body map[string]interface{}) map[string]interface{} {
+	for key, value := range body {
+		if value == nil || value == "" {
+			delete(body, key)
+		}
+	}
+	return map[string]interface{}{
+		"id":        traceUUID(newTraceID()),
+		"type":      eventType,
+		"timestamp": timestamp.UTC().Format(time.RFC3339Nano),
+		"body":      body,
+	}
+}
+
+// ingest 批量上传事件，Langfuse对部分失败的批次返回207，此时返回第一个失败事件的错误
+func (e *LangfuseExporter) ingest(ctx context.Context, events []map[string]interface{}) error {
+	auth := base64.StdEncoding.EncodeToString([]byte(e.config.PublicKey + ":" + e.config.SecretKey))
+	headers := map[string]string{"Authorization": "Basic " + auth}
+	var result struct {
+		Errors []struct {
+			ID      string `json:"id"`
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := postTraceJSON(ctx, e.HTTPClient, e.config.Host+"/api/public/ingestion", headers, map[string]interface{}{"batch": events}, &result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		first := result.Errors[0]
+		return fmt.Errorf("Langfuse拒绝了 %d 个事件，第一个 (%d): %s", len(result.Errors), first.Status, first.Message)
+	}
+	return nil
+}
+
+// expandLangfuseValue 值为${NAME}时读取环境变量NAME，为空时读取环境变量fallback
+func expandLangfuseValue(value, fallback string) string {
+	if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+		return os.Getenv(value[2 : len(value)-1])
+	}
+	if value == "" {
+		return os.Getenv(fallback)
+	}
+	return value
+}
@@ -0,0 +1,261 @@
+package ConversationManager
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// UsageRecord 一次模型调用的使用量记录
+type UsageRecord struct {
+	Time      time.Time        `json:"time"`
+	SessionID string           `json:"session_id"`
+	Turn      int              `json:"turn"` // 会话中第几次Chat调用，从1开始
+	Provider  general.Provider `json:"provider"`
+	Model     string           `json:"model"`
+	// Tools 本次调用提交的工具结果对应的工具名称，用于按工具统计函数调用带来的额外消耗
+	Tools []string      `json:"tools,omitempty"`
+	Usage general.Usage `json:"usage"`
+}
+
+// UsageFilter 使用量查询条件，零值字段不参与过滤
+type UsageFilter struct {
+	SessionID string
+	Provider  general.Provider
+	Model     string
+	Tool      string
+	Since     time.Time
+	Until     time.Time
+}
+
+// UsageLedger 使用量账本，可以在多个ConversationManager之间共享，按会话、提供商、模型、工具汇总
+type UsageLedger struct {
+	mu      sync.Mutex
+	records []UsageRecord
+}
+
+// NewUsageLedger 创建使用量账本
+func NewUsageLedger() *UsageLedger {
+	return &UsageLedger{}
+}
+
+// Record 添加一条使用量记录
+func (l *UsageLedger) Record(record UsageRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, record)
+}
+
+// Query 查询满足条件的使用量记录
+func (l *UsageLedger) Query(filter UsageFilter) []UsageRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result []UsageRecord
+	for _, record := range l.records {
+		if filter.match(record) {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// Total 汇总满足条件的使用量
+func (l *UsageLedger) Total(filter UsageFilter) general.Usage {
+	var total general.Usage
+	for _, record := range l.Query(filter) {
+		total.Add(record.Usage)
+	}
+	return total
+}
+
+// BySession 按会话汇总使用量
+func (l *UsageLedger) BySession() map[string]general.Usage {
+	return l.groupBy(func(record UsageRecord) []string { return []string{record.SessionID} })
+}
+
+// ByProvider 按提供商汇总使用量
+func (l *UsageLedger) ByProvider() map[string]general.Usage {
+	return l.groupBy(func(record UsageRecord) []string { return []string{string(record.Provider)} })
+}
+
+// ByModel 按模型汇总使用量
+func (l *UsageLedger) ByModel() map[string]general.Usage {
+	return l.groupBy(func(record UsageRecord) []string { return []string{record.Model} })
+}
+
+// ByTool 按工具汇总使用量，一次调用提交了多个工具的结果时，使用量会计入每个工具
+func (l *UsageLedger) ByTool() map[string]general.Usage {
+	return l.groupBy(func(record UsageRecord) []string { return record.Tools })
+}
+
+// groupBy 按keys返回的分组汇总使用量
+func (l *UsageLedger) groupBy(keys func(record UsageRecord) []string) map[string]general.Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make(map[string]general.Usage)
+	for _, record := range l.records {
+		for _, key := range keys(record) {
+			usage := result[key]
+			usage.Add(record.Usage)
+			result[key] = usage
+		}
+	}
+	return result
+}
+
+// ExportJSON 以JSON数组格式导出所有记录
+func (l *UsageLedger) ExportJSON(w io.Writer) error {
+	records := l.Query(UsageFilter{})
+	if records == nil {
+		records = []UsageRecord{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// ImportJSON 从ExportJSON导出的数据中恢复记录，追加到当前账本
+func (l *UsageLedger) ImportJSON(r io.Reader) error {
+	var records []UsageRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return fmt.Errorf("解析使用量记录失败: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, records...)
+	return nil
+}
+
+// ExportCSV 以CSV格式导出所有记录，扩展统计项按名称排序后作为额外的列
+func (l *UsageLedger) ExportCSV(w io.Writer) error {
+	records := l.Query(UsageFilter{})
+
+	extensionSet := make(map[string]bool)
+	for _, record := range records {
+		for key := range record.Usage.Extensions {
+			extensionSet[key] = true
+		}
+	}
+	extensions := make([]string, 0, len(extensionSet))
+	for key := range extensionSet {
+		extensions = append(extensions, key)
+	}
+	sort.Strings(extensions)
+
+	writer := csv.NewWriter(w)
+	header := []string{"time", "session_id", "turn", "provider", "model", "tools", "prompt_tokens", "completion_tokens", "total_tokens"}
+	if err := writer.Write(append(header, extensions...)); err != nil {
+		return err
+	}
+	for _, record := range records {
+		row := []string{
+			record.Time.Format(time.RFC3339),
+			record.SessionID,
+			strconv.Itoa(record.Turn),
+			string(record.Provider),
+			record.Model,
+			strings.Join(record.Tools, ";"),
+			strconv.Itoa(record.Usage.PromptTokens),
+			strconv.Itoa(record.Usage.CompletionTokens),
+			strconv.Itoa(record.Usage.TotalTokens),
+		}
+		for _, key := range extensions {
+			row = append(row, strconv.Itoa(record.Usage.Extensions[key]))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// match 判断记录是否满足查询条件
+func (f UsageFilter) match(record UsageRecord) bool {
+	if f.SessionID != "" && record.SessionID != f.SessionID {
+		return false
+	}
+	if f.Provider != "" && record.Provider != f.Provider {
+		return false
+	}
+	if f.Model != "" && record.Model != f.Model {
+		return false
+	}
+	if f.Tool != "" && !containsString(record.Tools, f.Tool) {
+		return false
+	}
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && record.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSessionID 获取会话ID
+func (cm *ConversationManager) GetSessionID() string {
+	return cm.sessionID
+}
+
+// SetSessionID 设置会话ID，用于在共享账本中区分不同会话
+func (cm *ConversationManager) SetSessionID(id string) {
+	cm.sessionID = id
+}
+
+// GetUsageLedger 获取使用量账本
+func (cm *ConversationManager) GetUsageLedger() *UsageLedger {
+	return cm.ledger
+}
+
+// SetUsageLedger 设置使用量账本，多个ConversationManager可以共享同一个账本
+func (cm *ConversationManager) SetUsageLedger(ledger *UsageLedger) {
+	cm.ledger = ledger
+}
+
+// recordUsage 记录一次模型调用的使用量
+func (cm *ConversationManager) recordUsage(provider general.Provider, model string, usage general.Usage, tools []string) {
+	if cm.ledger == nil {
+		return
+	}
+	cm.ledger.Record(UsageRecord{
+		Time:      time.Now(),
+		SessionID: cm.sessionID,
+		Turn:      cm.turn,
+		Provider:  provider,
+		Model:     model,
+		Tools:     tools,
+		Usage:     usage,
+	})
+}
+
+// newSessionID 生成随机会话ID
+func newSessionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,36 @@
+package ConversationManager
+
+import (
+	"log/slog"
+)
+
+// SetLogger 设置日志记录器，MCP服务器的连接、工具注册和工具调用等日志按级别和结构化字段通过它输出
+// 为nil时使用slog.Default()，默认输出到标准log包；不需要日志时可以传入级别较高或输出到io.Discard的记录器
+func (cm *ConversationManager) SetLogger(logger *slog.Logger) {
+	cm.logger = logger
+}
+
+// Logger 返回使用的日志记录器
+func (cm *ConversationManager) Logger() *slog.Logger {
+	if cm.logger == nil {
+		return slog.Default()
+	}
+	return cm.logger
+}
+
+// log 返回MCP管理器使用的日志记录器，带有component=mcp字段
+func (m *MCPClientManager) log() *slog.Logger {
+	logger := slog.Default()
+	if m.cm != nil {
+		logger = m.cm.Logger()
+	}
+	return logger.With("component", "mcp")
+}
+
+// text 返回消息在所属会话语言中的文本，没有所属会话时使用英文
+func (m *MCPClientManager) text(key MessageKey, args ...interface{}) string {
+	if m.cm != nil {
+		return m.cm.text(key, args...)
+	}
+	return Localize(LocaleEnglish, key, args...)
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"path/filepath"
 )
 
@@ -18,6 +17,10 @@ type MCPConfig struct {
 type MCPServerSettings struct {
 	Command string   `json:"command"`
 	Args    []string `json:"args,omitempty"`
+	Group   string   `json:"group,omitempty"`
+	// ToolTimeoutMS、ToolTimeoutsMS与MCPServerConfig中的同名字段相同
+	ToolTimeoutMS  int            `json:"tool_timeout_ms,omitempty"`
+	ToolTimeoutsMS map[string]int `json:"tool_timeouts_ms,omitempty"`
 }
 
 // LoadMCPConfig 从文件加载MCP配置并注册服务
@@ -45,7 +48,7 @@ func (cm *ConversationManager) LoadMCPConfig(configPath string) error {
 	for _, serverConfig := range config.Servers {
 		if err := cm.AddMCPServer(&serverConfig); err != nil {
 			errors = append(errors, fmt.Errorf("连接服务器 %s 失败: %w", serverConfig.Name, err))
-			log.Printf("连接MCP服务器失败 %s: %v", serverConfig.Name, err)
+			cm.mcpManager.log().Warn("mcp server connection failed", "server", serverConfig.Name, "error", err)
 		} else {
 			successCount++
 		}
@@ -58,18 +61,22 @@ func (cm *ConversationManager) LoadMCPConfig(configPath string) error {
 			Command:   []string{settings.Command},
 			Args:      settings.Args,
 			Transport: "stdio",
+			Group:     settings.Group,
+
+			ToolTimeoutMS:  settings.ToolTimeoutMS,
+			ToolTimeoutsMS: settings.ToolTimeoutsMS,
 		}
 
 		if err := cm.AddMCPServer(&serverConfig); err != nil {
 			errors = append(errors, fmt.Errorf("连接服务器 %s 失败: %w", serverName, err))
-			log.Printf("连接MCP服务器失败 %s: %v", serverName, err)
+			cm.mcpManager.log().Warn("mcp server connection failed", "server", serverName, "error", err)
 		} else {
 			successCount++
 		}
 	}
 
 	totalServers := len(config.Servers) + len(config.McpServers)
-	log.Printf("成功连接 %d/%d 个MCP服务器", successCount, totalServers)
+	cm.mcpManager.log().Info("mcp servers loaded", "connected", successCount, "total", totalServers)
 
 	if len(errors) > 0 && successCount == 0 {
 		return fmt.Errorf("所有MCP服务器连接失败: %v", errors)
@@ -197,7 +204,7 @@ func (cm *ConversationManager) LoadMCPConfigFromBytes(data []byte) error {
 	// 注册所有服务器
 	for _, serverConfig := range config.Servers {
 		if err := cm.AddMCPServer(&serverConfig); err != nil {
-			log.Printf("连接MCP服务器失败 %s: %v", serverConfig.Name, err)
+			cm.mcpManager.log().Warn("mcp server connection failed", "server", serverConfig.Name, "error", err)
 		}
 	}
 
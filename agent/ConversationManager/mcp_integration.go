@@ -3,12 +3,14 @@ package ConversationManager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/ccIisIaIcat/GoAgent/agent/general"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -32,6 +34,8 @@ type MCPToolInfo struct {
 	Description string         `json:"description"`
 	ServerName  string         `json:"server_name"`
 	InputSchema map[string]any `json:"input_schema,omitempty"`
+
+	timeout time.Duration // 每次调用的超时时间，为0时只受调用方上下文控制
 }
 
 // MCPParamInfo MCP工具参数信息
@@ -50,6 +54,24 @@ type MCPServerConfig struct {
 	Address   string            `json:"address,omitempty"`
 	Transport string            `json:"transport"` // "stdio", "tcp"
 	Env       map[string]string `json:"env,omitempty"`
+	Group     string            `json:"group,omitempty"` // 服务器的工具加入的工具组，为空时不分组
+	// ToolTimeoutMS 每次工具调用的超时时间（毫秒），为0时不限制，只在对话取消或管理器关闭时取消
+	// 卡住的MCP服务器超时后工具调用返回错误，对话继续进行
+	ToolTimeoutMS int `json:"tool_timeout_ms,omitempty"`
+	// ToolTimeoutsMS 按工具名（服务器返回的原始名称）单独设置的超时时间（毫秒），优先于ToolTimeoutMS，为0时该工具不限制
+	ToolTimeoutsMS map[string]int `json:"tool_timeouts_ms,omitempty"`
+}
+
+// toolTimeout 返回工具的调用超时时间
+func (c *MCPServerConfig) toolTimeout(toolName string) time.Duration {
+	ms, ok := c.ToolTimeoutsMS[toolName]
+	if !ok {
+		ms = c.ToolTimeoutMS
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
 }
 
 // NewMCPClientManager 创建MCP客户端管理器
@@ -130,6 +152,8 @@ func (m *MCPClientManager) AddServer(config *MCPServerConfig) error {
 	}
 
 	// 注册工具
+	logger := m.log().With("server", config.Name)
+	registered := 0
 	for _, tool := range toolsResult.Tools {
 		var inputSchema map[string]any
 		if tool.InputSchema != nil {
@@ -146,6 +170,7 @@ func (m *MCPClientManager) AddServer(config *MCPServerConfig) error {
 			Description: tool.Description,
 			ServerName:  config.Name,
 			InputSchema: inputSchema,
+			timeout:     config.toolTimeout(tool.Name),
 		}
 
 		// 构造唯一的工具名称（添加服务器前缀避免冲突）
@@ -153,16 +178,21 @@ func (m *MCPClientManager) AddServer(config *MCPServerConfig) error {
 
 		// 注册到ConversationManager
 		if err := m.registerToolToConversationManager(uniqueToolName, toolInfo); err != nil {
-			log.Printf("注册工具 %s 失败: %v", uniqueToolName, err)
+			logger.Warn("mcp tool registration failed", "tool", tool.Name, "error", err)
 			continue
 		}
+		logger.Debug("mcp tool registered", "tool", tool.Name, "name", uniqueToolName)
+		registered++
 
 		m.tools[uniqueToolName] = toolInfo
+		if config.Group != "" {
+			m.cm.AddToolsToGroup(config.Group, uniqueToolName)
+		}
 	}
 
 	m.clients[config.Name] = client
 	m.sessions[config.Name] = session
-	log.Printf("成功连接MCP服务器 %s，注册了 %d 个工具", config.Name, len(toolsResult.Tools))
+	logger.Info("mcp server connected", "tools", registered, "listed", len(toolsResult.Tools))
 	return nil
 }
 
@@ -185,11 +215,11 @@ func (m *MCPClientManager) RemoveServer(serverName string) error {
 	for toolName, toolInfo := range m.tools {
 		if toolInfo.ServerName == serverName {
 			delete(m.tools, toolName)
-			// TODO: 从ConversationManager中移除工具
+			m.cm.removeTool(toolName)
 		}
 	}
 
-	log.Printf("已移除MCP服务器: %s", serverName)
+	m.log().Info("mcp server removed", "server", serverName)
 	return nil
 }
 
@@ -205,8 +235,13 @@ func (m *MCPClientManager) GetRegisteredTools() map[string]*MCPToolInfo {
 	return result
 }
 
-// CallTool 调用MCP工具
+// CallTool 调用MCP工具，使用管理器的上下文，只在关闭管理器时取消
 func (m *MCPClientManager) CallTool(toolName string, arguments map[string]interface{}) (string, error) {
+	return m.CallToolWithContext(m.ctx, toolName, arguments)
+}
+
+// CallToolWithContext 调用MCP工具，ctx被取消、管理器关闭或超过服务器配置的超时时间时取消调用
+func (m *MCPClientManager) CallToolWithContext(ctx context.Context, toolName string, arguments map[string]interface{}) (string, error) {
 	m.mu.RLock()
 	toolInfo, exists := m.tools[toolName]
 	if !exists {
@@ -221,11 +256,31 @@ func (m *MCPClientManager) CallTool(toolName string, arguments map[string]interf
 	}
 	m.mu.RUnlock()
 
+	// 管理器关闭时同样取消调用
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(m.ctx, cancel)
+	defer stop()
+	callCtx := ctx
+	if toolInfo.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		callCtx, cancelTimeout = context.WithTimeout(ctx, toolInfo.timeout)
+		defer cancelTimeout()
+	}
+
 	// 调用MCP工具
-	result, err := session.CallTool(m.ctx, &mcp.CallToolParams{
+	start := time.Now()
+	result, err := session.CallTool(callCtx, &mcp.CallToolParams{
 		Name:      toolInfo.ToolName,
 		Arguments: arguments,
 	})
+	if logger := m.log(); logger.Enabled(ctx, slog.LevelDebug) {
+		logger.DebugContext(ctx, "mcp tool call", "server", toolInfo.ServerName, "tool", toolInfo.ToolName,
+			"duration", time.Since(start), "error", err)
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("调用MCP工具 %s 超时(%s): %w", toolName, toolInfo.timeout, err)
+	}
 	if err != nil {
 		return "", fmt.Errorf("调用MCP工具失败: %w", err)
 	}
@@ -239,7 +294,7 @@ func (m *MCPClientManager) CallTool(toolName string, arguments map[string]interf
 	}
 
 	if resultText == "" {
-		resultText = "工具执行完成"
+		resultText = m.text(MsgToolDone)
 	}
 
 	return resultText, nil
@@ -522,12 +577,12 @@ func (m *MCPClientManager) registerToolToConversationManager(toolName string, to
 		paramDescriptions[i] = param.Description
 	}
 
-	// 手动创建工具定义以确保schema正确
-	return m.registerMCPToolManually(toolName, toolInfo, params, proxyFunc)
+	// 手动创建工具定义以确保schema正确，调用时使用预编译的代理，代理函数只用于类型信息
+	return m.registerMCPToolManually(toolName, toolInfo, params, proxyFunc, m.compileMCPProxy(toolName, params))
 }
 
 // registerMCPToolManually 手动注册MCP工具，确保schema正确
-func (m *MCPClientManager) registerMCPToolManually(toolName string, toolInfo *MCPToolInfo, params []MCPParamInfo, proxyFunc reflect.Value) error {
+func (m *MCPClientManager) registerMCPToolManually(toolName string, toolInfo *MCPToolInfo, params []MCPParamInfo, proxyFunc reflect.Value, proxy toolProxy) error {
 	// 构建参数properties和required列表
 	properties := make(map[string]interface{})
 	required := make([]string, 0)
@@ -559,11 +614,11 @@ func (m *MCPClientManager) registerMCPToolManually(toolName string, toolInfo *MC
 		paramNames[i] = param.Name
 	}
 	
-	// 保存函数和工具定义
-	m.cm.registeredFuncs[toolName] = proxyFunc
-	m.cm.funcSchemas[toolName] = tool
-	m.cm.funcParamNames[toolName] = paramNames
-	m.cm.tools = append(m.cm.tools, tool)
-	
+	// 保存函数和工具定义，按DuplicateToolPolicy处理同名工具
+	name, err := m.cm.registerTool(tool, proxyFunc, paramNames)
+	if err != nil {
+		return err
+	}
+	m.cm.toolProxies[name] = proxy
 	return nil
 }
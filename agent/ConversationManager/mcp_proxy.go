@@ -0,0 +1,147 @@
+package ConversationManager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// toolProxy 预编译的工具代理，直接接收解析后的参数，调用时不经过reflect.Value，返回值与CallRegisteredFunction相同
+// ctx为发起工具调用的对话的上下文，对话被取消时代理发出的请求也随之取消
+type toolProxy func(ctx context.Context, params map[string]interface{}, lenient bool) (string, error)
+
+// proxyResult 将代理调用的结果转换为与反射调用返回(string, error)的函数相同的格式
+func (cm *ConversationManager) proxyResult(result string, err error) (string, error) {
+	if err != nil {
+		return "", errors.New(cm.text(MsgFunctionError, "ERROR: "+err.Error()))
+	}
+	return cm.text(MsgFunctionReturned, result), nil
+}
+
+// mcpParamConverter 预编译的参数转换器，结果与ConvertInterfaceToType转换为同一类型的结果相同
+type mcpParamConverter func(value interface{}) (interface{}, error)
+
+// mcpCompiledParam 预编译的MCP工具参数
+type mcpCompiledParam struct {
+	name     string
+	required bool
+	goType   reflect.Type
+	zero     interface{}
+	convert  mcpParamConverter
+}
+
+// compileMCPProxy 根据解析后的schema为MCP工具编译代理，每个参数的转换器只在注册时生成一次
+// 必需参数缺失时与反射调用一样传入零值，可选参数只在模型提供时传入
+func (m *MCPClientManager) compileMCPProxy(toolName string, params []MCPParamInfo) toolProxy {
+	compiled := make([]mcpCompiledParam, len(params))
+	for i, param := range params {
+		compiled[i] = mcpCompiledParam{
+			name:     param.Name,
+			required: param.Required,
+			goType:   param.Type,
+			zero:     reflect.Zero(param.Type).Interface(),
+			convert:  compileMCPParamConverter(param.Type),
+		}
+	}
+
+	return func(ctx context.Context, params map[string]interface{}, lenient bool) (string, error) {
+		arguments := make(map[string]interface{}, len(compiled))
+		for _, param := range compiled {
+			value, exists := params[param.name]
+			if !exists {
+				if param.required {
+					arguments[param.name] = param.zero
+				}
+				continue
+			}
+			converted, err := param.convert(value)
+			if err != nil && lenient {
+				// 宽松转换只在严格转换失败时使用，不在常见路径上
+				var result reflect.Value
+				if result, err = ConvertInterfaceToTypeLenient(value, param.goType); err == nil {
+					converted = result.Interface()
+				}
+			}
+			if err != nil {
+				return "", m.cm.errorf(err, MsgConvertArgumentFailed, param.name, err)
+			}
+			arguments[param.name] = converted
+		}
+		return m.cm.proxyResult(m.CallToolWithContext(ctx, toolName, arguments))
+	}
+}
+
+// compileMCPParamConverter 为jsonSchemaTypeToGoType返回的类型生成转换器
+func compileMCPParamConverter(goType reflect.Type) mcpParamConverter {
+	switch goType {
+	case reflect.TypeOf(false):
+		return func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case nil:
+				return false, nil
+			case bool:
+				return v, nil
+			}
+			return nil, errors.New("无法转换为 bool 类型")
+		}
+	case reflect.TypeOf(0):
+		return func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case nil:
+				return 0, nil
+			case float64:
+				return int(v), nil
+			}
+			return nil, errors.New("无法转换为 int 类型")
+		}
+	case reflect.TypeOf(float64(0)):
+		return func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case nil:
+				return float64(0), nil
+			case float64:
+				return v, nil
+			}
+			return nil, errors.New("无法转换为 float64 类型")
+		}
+	case reflect.TypeOf(""):
+		return func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case nil:
+				return "", nil
+			case string:
+				return v, nil
+			}
+			return nil, errors.New("无法转换为 string 类型")
+		}
+	case reflect.TypeOf([]interface{}{}):
+		// []interface{}的元素不需要转换
+		return func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case nil:
+				return []interface{}(nil), nil
+			case []interface{}:
+				return v, nil
+			}
+			return nil, errors.New("无法转换为 []interface {} 类型")
+		}
+	case reflect.TypeOf(map[string]interface{}{}):
+		return func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case nil:
+				return map[string]interface{}(nil), nil
+			case map[string]interface{}:
+				return v, nil
+			}
+			return nil, errors.New("无法转换为 map[string]interface {} 类型")
+		}
+	}
+	// 其他类型使用通用的反射转换
+	return func(value interface{}) (interface{}, error) {
+		result, err := ConvertInterfaceToType(value, goType)
+		if err != nil {
+			return nil, err
+		}
+		return result.Interface(), nil
+	}
+}
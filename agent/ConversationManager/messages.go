@@ -0,0 +1,408 @@
+package ConversationManager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Locale 发送给模型的固定文本（工具结果、反馈、内置工具的描述、评审提示词等）使用的语言
+type Locale string
+
+const (
+	LocaleEnglish Locale = "en" // 默认
+	LocaleChinese Locale = "zh"
+)
+
+// MessageKey 消息目录中的一条消息，带参数的消息按fmt格式化
+type MessageKey string
+
+// 函数调用的结果
+const (
+	MsgFunctionDone          MessageKey = "function_done"           // 函数没有返回值
+	MsgFunctionReturned      MessageKey = "function_returned"       // 参数：返回值
+	MsgFunctionError         MessageKey = "function_error"          // 参数：错误
+	MsgParseArgumentsFailed  MessageKey = "parse_arguments_failed"  // 参数：错误
+	MsgConvertArgumentFailed MessageKey = "convert_argument_failed" // 参数：参数名、错误
+	MsgParamDescription      MessageKey = "param_description"       // RegisterFunctionSimple的参数描述，参数：序号、类型
+)
+
+// 工具调用被拦截或没有执行时的结果
+const (
+	MsgToolUnavailable         MessageKey = "tool_unavailable"          // 参数：工具名
+	MsgToolRejected            MessageKey = "tool_rejected"             // 审批拒绝
+	MsgToolNotExecuted         MessageKey = "tool_not_executed"         // 切换提供商时为悬空的工具调用补充的结果
+	MsgToolDone                MessageKey = "tool_done"                 // MCP工具没有返回文本
+	MsgToolCallFailed          MessageKey = "tool_call_failed"          // RecoverToolErrors，参数：错误
+	MsgToolLimitSkipped        MessageKey = "tool_limit_skipped"        // 函数调用次数超限
+	MsgMalformedArguments      MessageKey = "malformed_arguments"       // 参数：工具名、收到的参数
+	MsgUnknownTool             MessageKey = "unknown_tool"              // 参数：工具名、可用的工具
+	MsgUnknownToolNoTools      MessageKey = "unknown_tool_no_tools"     // 参数：工具名
+	MsgUnknownToolSuggestion   MessageKey = "unknown_tool_suggestion"   // 参数：工具名、建议的工具、可用的工具
+	MsgReplayResultUnavailable MessageKey = "replay_result_unavailable" // 参数：工具名
+)
+
+// 内置工具
+const (
+	MsgAskUserDescription    MessageKey = "ask_user_description"
+	MsgAskUserQuestion       MessageKey = "ask_user_question"
+	MsgAskUserEmptyQuestion  MessageKey = "ask_user_empty_question"
+	MsgAskUserUnavailable    MessageKey = "ask_user_unavailable"
+	MsgScreenshotDescription MessageKey = "screenshot_description"
+	MsgScreenshotTarget      MessageKey = "screenshot_target"
+	MsgScreenshotFailed      MessageKey = "screenshot_failed"     // 参数：错误
+	MsgScreenshotCaption     MessageKey = "screenshot_caption"    // 参数：工具名、调用ID
+	MsgScreenshotTakenSize   MessageKey = "screenshot_taken_size" // 参数：宽、高
+	MsgScreenshotTaken       MessageKey = "screenshot_taken"
+	MsgCurrentTime           MessageKey = "current_time" // 注入系统提示词，参数：时间、星期、时区
+	MsgTimeFormat            MessageKey = "time_format"  // 参数：时间、星期、时区
+	MsgWeekdays              MessageKey = "weekdays"     // 从星期日开始，逗号分隔
+	MsgCurrentTimeTool       MessageKey = "current_time_tool"
+	MsgTimezoneParam         MessageKey = "timezone_param"
+	MsgConvertTimeTool       MessageKey = "convert_time_tool"
+	MsgConvertTimeTime       MessageKey = "convert_time_time"
+	MsgConvertTimeFrom       MessageKey = "convert_time_from"
+	MsgConvertTimeTo         MessageKey = "convert_time_to"
+	MsgScheduleReminderTool  MessageKey = "schedule_reminder_tool"
+	MsgReminderMessage       MessageKey = "reminder_message"
+	MsgReminderAt            MessageKey = "reminder_at"
+	MsgReminderDelay         MessageKey = "reminder_delay"
+	MsgReminderCron          MessageKey = "reminder_cron"
+	MsgCancelReminderTool    MessageKey = "cancel_reminder_tool"
+	MsgCancelReminderID      MessageKey = "cancel_reminder_id"
+	MsgReminderSet           MessageKey = "reminder_set"           // 参数：提醒ID、时间
+	MsgRecurringReminderSet  MessageKey = "recurring_reminder_set" // 参数：提醒ID、下一次时间
+	MsgReminderCancelled     MessageKey = "reminder_cancelled"     // 参数：提醒ID
+)
+
+// 从OpenAPI文档和gRPC服务生成的工具
+const (
+	MsgRequestBody         MessageKey = "request_body"          // 文档中没有描述的请求体参数
+	MsgGRPCMethod          MessageKey = "grpc_method"           // 参数：服务名、方法名
+	MsgGRPCServerStreaming MessageKey = "grpc_server_streaming" // 追加在服务端流式方法的描述后
+)
+
+// 提示词
+const (
+	MsgAttachmentFile   MessageKey = "attachment_file"    // 文本附件，参数：文件名、内容
+	MsgCompressed       MessageKey = "compressed"         // 参数：原文token数、压缩后的内容
+	MsgCompressPrompt   MessageKey = "compress_prompt"    // 参数：目标token数、原文
+	MsgDraftReviewStart MessageKey = "draft_review_start" // 草稿校验
+	MsgDraftToolCall    MessageKey = "draft_tool_call"    // 参数：工具名、参数
+	MsgDraftReviewEnd   MessageKey = "draft_review_end"
+	MsgJudgeInstruction MessageKey = "judge_instruction" // 多模型评审
+	MsgJudgeQuestion    MessageKey = "judge_question"    // 参数：问题
+	MsgJudgeAnswer      MessageKey = "judge_answer"      // 参数：编号、回答
+	MsgOutputFeedback   MessageKey = "output_feedback"   // 后处理失败，参数：错误
+	MsgReActIntro       MessageKey = "react_intro"
+	MsgReActTools       MessageKey = "react_tools"
+	MsgReActToolLine    MessageKey = "react_tool_line" // 参数：工具名、描述、参数Schema
+	MsgReActThought     MessageKey = "react_thought"
+	MsgReActAction      MessageKey = "react_action"
+	MsgReActActionInput MessageKey = "react_action_input"
+	MsgReActObservation MessageKey = "react_observation"
+	MsgReActRepeat      MessageKey = "react_repeat"
+	MsgReActDone        MessageKey = "react_done"
+	MsgReActFinalAnswer MessageKey = "react_final_answer"
+)
+
+// 返回给调用方的错误
+const (
+	MsgErrOutputProcessing  MessageKey = "err_output_processing"   // 参数：错误
+	MsgErrToolCall          MessageKey = "err_tool_call"           // 参数：错误
+	MsgErrImage             MessageKey = "err_image"               // 参数：序号、错误
+	MsgErrReadImage         MessageKey = "err_read_image"          // 参数：错误
+	MsgErrEmptyImage        MessageKey = "err_empty_image"         //
+	MsgErrImageFormat       MessageKey = "err_image_format"        // 参数：MIME类型
+	MsgErrImageConvert      MessageKey = "err_image_convert"       // 参数：错误
+	MsgErrImageTooLarge     MessageKey = "err_image_too_large"     // 参数：大小、上限
+	MsgErrReadAttachment    MessageKey = "err_read_attachment"     // 参数：错误
+	MsgErrEmptyAttachment   MessageKey = "err_empty_attachment"    //
+	MsgErrAudioFormat       MessageKey = "err_audio_format"        // 参数：MIME类型
+	MsgErrAudioTooLarge     MessageKey = "err_audio_too_large"     // 参数：大小、上限
+	MsgErrDocumentTooLarge  MessageKey = "err_document_too_large"  // 参数：大小、上限
+	MsgErrInvalidUTF8       MessageKey = "err_invalid_utf8"        //
+	MsgErrAttachmentType    MessageKey = "err_attachment_type"     // 参数：MIME类型
+	MsgErrEmptyToolGroup    MessageKey = "err_empty_tool_group"    //
+	MsgErrToolNotRegistered MessageKey = "err_tool_not_registered" // 参数：工具名
+	MsgErrUnknownToolGroup  MessageKey = "err_unknown_tool_group"  // 参数：工具组
+	MsgErrDuplicateTool     MessageKey = "err_duplicate_tool"      // 参数：工具名
+)
+
+// messageCatalogs 各语言的消息，缺少的消息使用英文
+var messageCatalogs = map[Locale]map[MessageKey]string{
+	LocaleEnglish: {
+		MsgFunctionDone:          "Function completed",
+		MsgFunctionReturned:      "Function returned: %s",
+		MsgFunctionError:         "Function error: %v",
+		MsgParseArgumentsFailed:  "Failed to parse arguments: %v",
+		MsgConvertArgumentFailed: "Failed to convert argument %s: %v",
+		MsgParamDescription:      "Parameter %d (%s)",
+
+		MsgToolUnavailable:         "Tool %s is not available",
+		MsgToolRejected:            "Tool call rejected",
+		MsgToolNotExecuted:         "Tool was not executed",
+		MsgToolDone:                "Tool completed",
+		MsgToolCallFailed:          "Tool call failed: %v",
+		MsgToolLimitSkipped:        "Tool call limit reached, not executed",
+		MsgMalformedArguments:      "Tool not executed: the arguments are not a valid JSON object. Call %s again with a valid JSON object. Received arguments: %s",
+		MsgUnknownTool:             "Unknown tool: %s. Available tools: %s",
+		MsgUnknownToolNoTools:      "Unknown tool: %s. No tools are available, answer directly",
+		MsgUnknownToolSuggestion:   "Unknown tool: %s. Did you mean %s? Available tools: %s",
+		MsgReplayResultUnavailable: "The result of tool %s is not available",
+
+		MsgAskUserDescription:    "Ask the user a question and wait for the answer. Use it only when information required to finish the task is missing and cannot be obtained with other tools",
+		MsgAskUserQuestion:       "The question to ask the user",
+		MsgAskUserEmptyQuestion:  "The question must not be empty",
+		MsgAskUserUnavailable:    "The user cannot be asked right now, continue with the information you have",
+		MsgScreenshotDescription: "Take a screenshot of the screen or a web page. The screenshot is added to the conversation as an image, so you can look at the interface before deciding the next step",
+		MsgScreenshotTarget:      "URL of the web page to capture, empty for the desktop",
+		MsgScreenshotFailed:      "Screenshot failed: %v",
+		MsgScreenshotCaption:     "Screenshot from %s (call ID %s):",
+		MsgScreenshotTakenSize:   "Screenshot taken (%dx%d), the image is in the next message",
+		MsgScreenshotTaken:       "Screenshot taken, the image is in the next message",
+		MsgCurrentTime:           "Current time: %s %s (%s)",
+		MsgTimeFormat:            "%s %s (%s)",
+		MsgWeekdays:              "Sunday,Monday,Tuesday,Wednesday,Thursday,Friday,Saturday",
+		MsgCurrentTimeTool:       "Get the current date, time and weekday",
+		MsgTimezoneParam:         "IANA time zone name, such as Asia/Shanghai or America/New_York. Empty for the default time zone",
+		MsgConvertTimeTool:       "Convert a time from one time zone to another",
+		MsgConvertTimeTime:       "The time to convert, such as 2024-05-01 09:00. from is ignored when it has a time zone offset (RFC3339)",
+		MsgConvertTimeFrom:       "Source time zone, empty for the default time zone",
+		MsgConvertTimeTo:         "Target time zone",
+		MsgScheduleReminderTool:  "Set a reminder that notifies the user when it is due. Set exactly one of at, delay and cron",
+		MsgReminderMessage:       "Reminder text",
+		MsgReminderAt:            "Reminder time, such as 2024-05-01 09:00, in the default time zone",
+		MsgReminderDelay:         "Delay from now, such as 10m or 1h30m",
+		MsgReminderCron:          "Cron expression for a recurring reminder (minute hour day month weekday), such as 0 9 * * 1-5",
+		MsgCancelReminderTool:    "Cancel a reminder",
+		MsgCancelReminderID:      "Reminder ID returned by schedule_reminder",
+		MsgReminderSet:           "Reminder %s set for %s",
+		MsgRecurringReminderSet:  "Recurring reminder %s set, next reminder at %s",
+		MsgReminderCancelled:     "Reminder %s cancelled",
+
+		MsgRequestBody:         "Request body",
+		MsgGRPCMethod:          "gRPC method %s/%s",
+		MsgGRPCServerStreaming: " (server streaming, returns an array of all responses)",
+
+		MsgAttachmentFile:   "Contents of file %s:\n%s",
+		MsgCompressed:       "[Content compressed, originally about %d tokens]\n%s",
+		MsgCompressPrompt:   "Compress the following content to about %d tokens. Keep all key facts, numbers, names and conclusions, remove repetition and irrelevant content, and output only the compressed content.\n\n%s",
+		MsgDraftReviewStart: "Review the next reply that another model drafted for the conversation above. Do not execute its tool calls.\n\n<draft>\n",
+		MsgDraftToolCall:    "Call tool %s with arguments %s\n",
+		MsgDraftReviewEnd:   "</draft>\n\nIf the draft is correct and complete and its tool calls are reasonable, reply only APPROVE; otherwise reply only REJECT.",
+		MsgJudgeInstruction: "Below are several candidate answers to the same question. Choose the most accurate and complete one.\nOn the first line reply only with the number of the best answer (such as 2), then briefly explain why from the second line on.\n\n",
+		MsgJudgeQuestion:    "Question:\n%s\n",
+		MsgJudgeAnswer:      "\nAnswer %d:\n%s\n",
+		MsgOutputFeedback:   "Your reply does not meet the requirements: %v\nPlease fix it and give the complete reply again.",
+		MsgReActIntro:       "Solve the problem step by step using the following format.\n\n",
+		MsgReActTools:       "You can use the following tools:\n",
+		MsgReActToolLine:    "- %s: %s Parameters: %s\n",
+		MsgReActThought:     " think about what to do next\n",
+		MsgReActAction:      " the name of the tool to use\n",
+		MsgReActActionInput: " the tool arguments, a JSON object\n",
+		MsgReActObservation: " the result of the tool (provided by the system, do not write it yourself)\n",
+		MsgReActRepeat:      "... (Thought/Action/Action Input/Observation can repeat several times. Output only one Action at a time, then stop after Action Input and wait for the Observation)\n",
+		MsgReActDone:        " I now know the final answer\n",
+		MsgReActFinalAnswer: " the final answer to the original question",
+
+		MsgErrOutputProcessing:  "output processing failed: %v",
+		MsgErrToolCall:          "function call failed: %v",
+		MsgErrImage:             "image %d failed: %v",
+		MsgErrReadImage:         "failed to read image file: %v",
+		MsgErrEmptyImage:        "image is empty",
+		MsgErrImageFormat:       "unsupported image format: %s",
+		MsgErrImageConvert:      "failed to convert image: %v",
+		MsgErrImageTooLarge:     "image is %d bytes, over the limit of %d bytes",
+		MsgErrReadAttachment:    "failed to read attachment: %v",
+		MsgErrEmptyAttachment:   "attachment is empty",
+		MsgErrAudioFormat:       "unsupported audio format: %s",
+		MsgErrAudioTooLarge:     "audio is %d bytes, over the limit of %d bytes",
+		MsgErrDocumentTooLarge:  "document is %d bytes, over the limit of %d bytes",
+		MsgErrInvalidUTF8:       "text attachment is not valid UTF-8",
+		MsgErrAttachmentType:    "unsupported attachment type: %s",
+		MsgErrEmptyToolGroup:    "tool group name must not be empty",
+		MsgErrToolNotRegistered: "tool %s is not registered",
+		MsgErrUnknownToolGroup:  "tool group %s is not defined",
+		MsgErrDuplicateTool:     "tool %s is already registered",
+	},
+	LocaleChinese: {
+		MsgFunctionDone:          "函数执行完成",
+		MsgFunctionReturned:      "函数返回: %s",
+		MsgFunctionError:         "函数执行错误: %v",
+		MsgParseArgumentsFailed:  "解析参数失败: %v",
+		MsgConvertArgumentFailed: "转换参数 %s 失败: %v",
+		MsgParamDescription:      "参数 %d (%s)",
+
+		MsgToolUnavailable:         "工具 %s 不可用",
+		MsgToolRejected:            "工具调用被拒绝",
+		MsgToolNotExecuted:         "工具未执行",
+		MsgToolDone:                "工具执行完成",
+		MsgToolCallFailed:          "工具调用失败: %v",
+		MsgToolLimitSkipped:        "工具调用次数已达上限，未执行",
+		MsgMalformedArguments:      "工具未执行: 参数不是有效的JSON对象，请使用有效的JSON对象重新调用 %s。收到的参数: %s",
+		MsgUnknownTool:             "未知的工具: %s，可用的工具有: %s",
+		MsgUnknownToolNoTools:      "未知的工具: %s，当前没有可用的工具，请直接回答",
+		MsgUnknownToolSuggestion:   "未知的工具: %s，你是否想调用 %s？可用的工具有: %s",
+		MsgReplayResultUnavailable: "工具 %s 的结果不可用",
+
+		MsgAskUserDescription:    "向用户提出一个问题并等待回答，仅在缺少完成任务所必需的信息、且无法通过其他工具获得时使用",
+		MsgAskUserQuestion:       "要向用户提出的问题",
+		MsgAskUserEmptyQuestion:  "问题不能为空",
+		MsgAskUserUnavailable:    "当前无法向用户提问，请根据已有信息继续",
+		MsgScreenshotDescription: "截取屏幕或网页的截图，截图会作为图片加入对话，用于查看界面后决定下一步操作",
+		MsgScreenshotTarget:      "要截图的网页地址，截取桌面时留空",
+		MsgScreenshotFailed:      "截图失败: %v",
+		MsgScreenshotCaption:     "%s（调用ID %s）的截图：",
+		MsgScreenshotTakenSize:   "截图成功（%dx%d），图片见下一条消息",
+		MsgScreenshotTaken:       "截图成功，图片见下一条消息",
+		MsgCurrentTime:           "当前时间: %s %s（%s）",
+		MsgTimeFormat:            "%s %s（%s）",
+		MsgWeekdays:              "星期日,星期一,星期二,星期三,星期四,星期五,星期六",
+		MsgCurrentTimeTool:       "获取当前的日期、时间和星期",
+		MsgTimezoneParam:         "IANA时区名称，如Asia/Shanghai、America/New_York，为空时使用默认时区",
+		MsgConvertTimeTool:       "将时间从一个时区转换到另一个时区",
+		MsgConvertTimeTime:       "要转换的时间，如2024-05-01 09:00，带时区偏移（RFC3339）时忽略from",
+		MsgConvertTimeFrom:       "原时区，为空时使用默认时区",
+		MsgConvertTimeTo:         "目标时区",
+		MsgScheduleReminderTool:  "设置一个提醒，到期时通知用户。at、delay和cron三选一",
+		MsgReminderMessage:       "提醒内容",
+		MsgReminderAt:            "提醒时间，如2024-05-01 09:00，按默认时区解析",
+		MsgReminderDelay:         "从现在起的延迟，如10m、1h30m",
+		MsgReminderCron:          "重复提醒的cron表达式（分 时 日 月 星期），如0 9 * * 1-5",
+		MsgCancelReminderTool:    "取消一个已设置的提醒",
+		MsgCancelReminderID:      "schedule_reminder返回的提醒ID",
+		MsgReminderSet:           "已设置提醒 %s，将于 %s 提醒",
+		MsgRecurringReminderSet:  "已设置重复提醒 %s，下一次提醒时间为 %s",
+		MsgReminderCancelled:     "已取消提醒 %s",
+
+		MsgRequestBody:         "请求体",
+		MsgGRPCMethod:          "gRPC方法 %s/%s",
+		MsgGRPCServerStreaming: "（服务端流式，返回所有响应的数组）",
+
+		MsgAttachmentFile:   "文件 %s 的内容:\n%s",
+		MsgCompressed:       "[内容已压缩，原文约%d token]\n%s",
+		MsgCompressPrompt:   "请将以下内容压缩到约%d个token以内。保留所有关键事实、数字、名称和结论，删除重复和无关的内容，只输出压缩后的内容。\n\n%s",
+		MsgDraftReviewStart: "请审核另一个模型为上面的对话起草的下一条回复，不要执行其中的工具调用。\n\n<草稿>\n",
+		MsgDraftToolCall:    "调用工具 %s，参数 %s\n",
+		MsgDraftReviewEnd:   "</草稿>\n\n如果草稿正确、完整且工具调用合理，只回复 APPROVE；否则只回复 REJECT。",
+		MsgJudgeInstruction: "以下是针对同一个问题的多个候选回答，请选出最准确、最完整的一个。\n第一行只回复最佳回答的编号（如 2），第二行起简要说明理由。\n\n",
+		MsgJudgeQuestion:    "问题：\n%s\n",
+		MsgJudgeAnswer:      "\n回答 %d：\n%s\n",
+		MsgOutputFeedback:   "你的回复不符合要求: %v\n请修正后重新给出完整的回复。",
+		MsgReActIntro:       "请按照以下格式逐步解决问题。\n\n",
+		MsgReActTools:       "你可以使用以下工具：\n",
+		MsgReActToolLine:    "- %s: %s 参数: %s\n",
+		MsgReActThought:     " 思考下一步该做什么\n",
+		MsgReActAction:      " 要使用的工具名称\n",
+		MsgReActActionInput: " 工具参数，一个JSON对象\n",
+		MsgReActObservation: " 工具的结果（由系统提供，不要自己编写）\n",
+		MsgReActRepeat:      "……（Thought/Action/Action Input/Observation可以重复多次，每次只输出一个Action，输出Action Input后停止并等待Observation）\n",
+		MsgReActDone:        " 我已经知道最终答案了\n",
+		MsgReActFinalAnswer: " 对原始问题的最终回答",
+
+		MsgErrOutputProcessing:  "回复后处理失败: %v",
+		MsgErrToolCall:          "函数调用失败: %v",
+		MsgErrImage:             "第%d张图片处理失败: %v",
+		MsgErrReadImage:         "读取图片文件失败: %v",
+		MsgErrEmptyImage:        "图片内容为空",
+		MsgErrImageFormat:       "不支持的图片格式: %s",
+		MsgErrImageConvert:      "图片转换失败: %v",
+		MsgErrImageTooLarge:     "图片大小%d字节超过限制%d字节",
+		MsgErrReadAttachment:    "读取附件失败: %v",
+		MsgErrEmptyAttachment:   "附件内容为空",
+		MsgErrAudioFormat:       "不支持的音频格式: %s",
+		MsgErrAudioTooLarge:     "音频大小%d字节超过限制%d字节",
+		MsgErrDocumentTooLarge:  "文档大小%d字节超过限制%d字节",
+		MsgErrInvalidUTF8:       "文本附件不是有效的UTF-8编码",
+		MsgErrAttachmentType:    "不支持的附件类型: %s",
+		MsgErrEmptyToolGroup:    "工具组名称不能为空",
+		MsgErrToolNotRegistered: "未找到注册的工具: %s",
+		MsgErrUnknownToolGroup:  "未定义的工具组: %s",
+		MsgErrDuplicateTool:     "工具 %s 已注册",
+	},
+}
+
+// catalogMu 保护messageCatalogs
+var catalogMu sync.RWMutex
+
+// RegisterMessages 添加一种语言或覆盖已有语言中的消息，未提供的消息保持不变，新语言中缺少的消息使用英文
+// 带参数的消息需要保持参数的顺序和格式动词
+func RegisterMessages(locale Locale, messages map[MessageKey]string) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog := messageCatalogs[locale]
+	if catalog == nil {
+		catalog = make(map[MessageKey]string, len(messages))
+		messageCatalogs[locale] = catalog
+	}
+	for key, text := range messages {
+		catalog[key] = text
+	}
+}
+
+// Localize 返回消息在指定语言中的文本，有参数时按fmt格式化；语言中没有该消息时使用英文
+func Localize(locale Locale, key MessageKey, args ...interface{}) string {
+	catalogMu.RLock()
+	text, ok := messageCatalogs[locale][key]
+	if !ok {
+		text, ok = messageCatalogs[LocaleEnglish][key]
+	}
+	catalogMu.RUnlock()
+	if !ok {
+		text = string(key)
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// SetLocale 设置发送给模型的固定文本和返回的错误使用的语言，默认为英文
+// 内置工具（ask_user、take_screenshot、时间工具）的描述在注册时确定，需要在启用这些工具之前设置
+func (cm *ConversationManager) SetLocale(locale Locale) {
+	cm.locale = locale
+}
+
+// Locale 返回使用的语言
+func (cm *ConversationManager) Locale() Locale {
+	if cm.locale == "" {
+		return LocaleEnglish
+	}
+	return cm.locale
+}
+
+// text 返回消息在本会话语言中的文本
+func (cm *ConversationManager) text(key MessageKey, args ...interface{}) string {
+	return Localize(cm.Locale(), key, args...)
+}
+
+// messageError 本地化的错误消息，保留原始错误用于errors.Is和errors.As
+type messageError struct {
+	text string
+	err  error
+}
+
+func (e *messageError) Error() string { return e.text }
+
+func (e *messageError) Unwrap() error { return e.err }
+
+// errorf 返回本地化消息作为文本、包装err的错误，err为nil时不包装
+func (cm *ConversationManager) errorf(err error, key MessageKey, args ...interface{}) error {
+	return localeErrorf(cm.Locale(), err, key, args...)
+}
+
+// localeErrorf 与errorf相同，用于不属于会话的函数
+func localeErrorf(locale Locale, err error, key MessageKey, args ...interface{}) error {
+	return &messageError{text: Localize(locale, key, args...), err: err}
+}
+
+// weekdayName 返回星期在指定语言中的名称
+func weekdayName(locale Locale, weekday time.Weekday) string {
+	names := strings.Split(Localize(locale, MsgWeekdays), ",")
+	if int(weekday) < len(names) {
+		return strings.TrimSpace(names[weekday])
+	}
+	return weekday.String()
+}
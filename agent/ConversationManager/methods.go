@@ -0,0 +1,141 @@
+package ConversationManager
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 方法的工具标签，写在接收者结构体的空白字段上，例如：
+//
+//	type WeatherService struct {
+//		_ struct{} `tool:"Forecast" description:"查询天气预报" params:"city,days" descriptions:"城市名称,预报天数"`
+//	}
+//
+// Go的反射无法获取方法的参数名称，params按顺序给出参数名称，descriptions按顺序给出参数描述，均以逗号分隔
+const (
+	methodToolTag         = "tool"
+	methodDescriptionTag  = "description"
+	methodParamsTag       = "params"
+	methodDescriptionsTag = "descriptions"
+)
+
+// methodTag 接收者结构体上某个方法的工具标签
+type methodTag struct {
+	description       string
+	paramNames        []string
+	paramDescriptions []string
+}
+
+// RegisterMethod 将接收者的导出方法注册为工具，工具名称为方法名，调用时绑定该接收者，无需编写包装函数
+// paramNames为nil时从接收者的工具标签中读取参数名称和描述，没有标签时使用param0、param1等名称；description为空时使用标签中的描述
+// 指针接收者的方法需要传入指针
+func (cm *ConversationManager) RegisterMethod(receiver interface{}, methodName, description string, paramNames, paramDescriptions []string) error {
+	method, err := receiverMethod(receiver, methodName)
+	if err != nil {
+		return err
+	}
+
+	if tag, ok := methodTags(receiver)[methodName]; ok {
+		if description == "" {
+			description = tag.description
+		}
+		if paramNames == nil {
+			paramNames, paramDescriptions = tag.paramNames, tag.paramDescriptions
+		}
+	}
+	if paramNames == nil {
+		err = cm.RegisterFunctionSimple(methodName, description, method.Interface())
+	} else {
+		if paramDescriptions == nil {
+			paramDescriptions = make([]string, len(paramNames))
+		}
+		err = cm.RegisterFunction(methodName, description, method.Interface(), paramNames, paramDescriptions)
+	}
+	if err != nil {
+		return fmt.Errorf("注册方法 %s 失败: %w", methodName, err)
+	}
+	return nil
+}
+
+// RegisterMethods 将接收者上所有带工具标签的方法注册为工具，返回注册的方法名称
+// 注册前检查所有标签对应的方法都存在；注册中遇到错误时停止，已注册的方法不会撤销
+func (cm *ConversationManager) RegisterMethods(receiver interface{}) ([]string, error) {
+	tags := methodTags(receiver)
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("类型 %T 没有方法的工具标签", receiver)
+	}
+	for name := range tags {
+		if _, err := receiverMethod(receiver, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// 按方法的顺序（方法名的字典序）注册，保持工具顺序稳定
+	receiverType := reflect.TypeOf(receiver)
+	var registered []string
+	for i := 0; i < receiverType.NumMethod(); i++ {
+		name := receiverType.Method(i).Name
+		if _, ok := tags[name]; !ok {
+			continue
+		}
+		if err := cm.RegisterMethod(receiver, name, "", nil, nil); err != nil {
+			return registered, err
+		}
+		registered = append(registered, name)
+	}
+	return registered, nil
+}
+
+// receiverMethod 获取绑定了接收者的方法
+func receiverMethod(receiver interface{}, methodName string) (reflect.Value, error) {
+	if receiver == nil {
+		return reflect.Value{}, fmt.Errorf("接收者不能为nil")
+	}
+	method := reflect.ValueOf(receiver).MethodByName(methodName)
+	if !method.IsValid() {
+		if _, ok := reflect.PointerTo(reflect.TypeOf(receiver)).MethodByName(methodName); ok {
+			return reflect.Value{}, fmt.Errorf("方法 %s 的接收者是指针，请传入 *%T", methodName, receiver)
+		}
+		return reflect.Value{}, fmt.Errorf("类型 %T 没有导出的方法 %s", receiver, methodName)
+	}
+	return method, nil
+}
+
+// methodTags 读取接收者结构体上的工具标签，键为方法名
+func methodTags(receiver interface{}) map[string]methodTag {
+	t := reflect.TypeOf(receiver)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	tags := make(map[string]methodTag)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get(methodToolTag)
+		if name == "" {
+			continue
+		}
+		tags[name] = methodTag{
+			description:       field.Tag.Get(methodDescriptionTag),
+			paramNames:        splitTagList(field.Tag.Get(methodParamsTag)),
+			paramDescriptions: splitTagList(field.Tag.Get(methodDescriptionsTag)),
+		}
+	}
+	return tags
+}
+
+// splitTagList 按逗号拆分标签值，空值返回nil
+func splitTagList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
@@ -0,0 +1,283 @@
+package ConversationManager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// anthropicToolIDPattern Anthropic要求工具调用ID只包含字母、数字、下划线和连字符
+var anthropicToolIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// SwitchProvider 将现有历史记录迁移为目标提供商可以直接接受的形式
+// 会处理工具调用ID格式、历史中的system消息、字符串化的函数参数、悬空的工具调用等差异
+func (cm *ConversationManager) SwitchProvider(provider general.Provider) error {
+	if cm.manager != nil {
+		if _, err := cm.manager.GetProvider(provider); err != nil {
+			return fmt.Errorf("切换提供商失败: %w", err)
+		}
+	}
+
+	history, systemPrompt := cm.migrateHistory(cm.history, provider)
+	cm.setHistory(context.Background(), history)
+	cm.systemPrompt = systemPrompt
+	cm.provider = provider
+	return nil
+}
+
+// GetCurrentProvider 获取当前历史记录所适配的提供商
+func (cm *ConversationManager) GetCurrentProvider() general.Provider {
+	return cm.provider
+}
+
+// migrateHistory 按目标提供商的约束重写历史记录，返回重写后的历史记录和合并了历史中system消息的系统提示词
+func (cm *ConversationManager) migrateHistory(messages []general.Message, provider general.Provider) ([]general.Message, string) {
+	// 自定义名称的提供商（如Ollama）按其客户端类型迁移
+	if cm.manager != nil {
+		provider = cm.manager.ProviderType(provider)
+	}
+	idMapping := make(map[string]string)
+	mapID := func(id string) string {
+		if newID, ok := idMapping[id]; ok {
+			return newID
+		}
+		newID := id
+		if !isValidToolCallID(provider, id) {
+			newID = migrateToolCallID(id)
+		}
+		idMapping[id] = newID
+		return newID
+	}
+	// 没有ID的工具调用按消息序号和调用序号生成ID，没有ID的工具结果按顺序对应上一条消息中这些调用
+	var unanswered []string
+
+	var systemParts []string
+	migrated := make([]general.Message, 0, len(messages))
+
+	for i, msg := range messages {
+		// Anthropic和Google不接受历史中的system消息，合并到系统提示词中
+		if msg.Role == general.RoleSystem && !supportsSystemMessages(provider) {
+			for _, content := range msg.Content {
+				if content.Type == general.ContentTypeText && strings.TrimSpace(content.Text) != "" {
+					systemParts = append(systemParts, content.Text)
+				}
+			}
+			continue
+		}
+
+		newMsg := general.Message{
+			Role:      msg.Role,
+			Name:      msg.Name,
+			ID:        msg.ID,
+			CreatedAt: msg.CreatedAt,
+		}
+
+		var generated []string // 本条消息中没有ID的工具调用生成的ID
+		generate := func(callIndex int) string {
+			id := migrateToolCallID(fmt.Sprintf("%d:%d", i, callIndex))
+			if !containsString(generated, id) {
+				generated = append(generated, id)
+			}
+			return id
+		}
+		toolContents := 0
+		for j, content := range msg.Content {
+			switch content.Type {
+			case general.ContentTypeText:
+				// 去掉空文本，避免部分提供商拒绝空内容
+				if content.Text == "" {
+					continue
+				}
+			case general.ContentTypeTool:
+				if content.ToolCall != nil {
+					toolCall := *content.ToolCall
+					if toolCall.ID == "" {
+						toolCall.ID = generate(toolContents)
+					} else {
+						toolCall.ID = mapID(toolCall.ID)
+					}
+					toolContents++
+					toolCall.Function.Arguments = normalizeArguments(toolCall.Function.Arguments)
+					content.ToolCall = &toolCall
+				}
+			case general.ContentTypeToolRes:
+				if content.ToolID != "" {
+					content.ToolID = mapID(content.ToolID)
+				} else if len(unanswered) > 0 {
+					content.ToolID = unanswered[0]
+					unanswered = unanswered[1:]
+				} else {
+					// 没有对应的调用，之后作为悬空的工具结果处理
+					content.ToolID = migrateToolCallID(fmt.Sprintf("%d:%d", i, j))
+				}
+			}
+			newMsg.Content = append(newMsg.Content, content)
+		}
+
+		for k, toolCall := range msg.ToolCalls {
+			if toolCall.ID == "" {
+				toolCall.ID = generate(k)
+			} else {
+				toolCall.ID = mapID(toolCall.ID)
+			}
+			toolCall.Function.Arguments = normalizeArguments(toolCall.Function.Arguments)
+			if toolCall.Type == "" {
+				toolCall.Type = "function"
+			}
+			newMsg.ToolCalls = append(newMsg.ToolCalls, toolCall)
+		}
+		if toolContents > 0 || len(msg.ToolCalls) > 0 {
+			unanswered = generated
+		}
+
+		migrated = append(migrated, newMsg)
+	}
+
+	systemPrompt := cm.systemPrompt
+	if len(systemParts) > 0 {
+		if systemPrompt != "" {
+			systemParts = append([]string{systemPrompt}, systemParts...)
+		}
+		systemPrompt = strings.Join(systemParts, "\n\n")
+	}
+
+	return repairToolPairs(migrated, cm.text(MsgToolNotExecuted)), systemPrompt
+}
+
+// repairToolPairs 修复工具调用与工具结果的配对关系
+// 为缺少结果的工具调用补充内容为placeholder的结果，并移除找不到对应调用的孤立工具结果
+func repairToolPairs(messages []general.Message, placeholder string) []general.Message {
+	calledIDs := make(map[string]bool)
+	for _, msg := range messages {
+		for _, toolCall := range msg.ToolCalls {
+			calledIDs[toolCall.ID] = true
+		}
+	}
+
+	result := make([]general.Message, 0, len(messages))
+	var pending []general.ToolCall
+	answered := make(map[string]bool)
+
+	// flush 在工具结果序列结束时为未应答的调用补充占位结果
+	flush := func() {
+		var missing []general.ToolCall
+		for _, toolCall := range pending {
+			if !answered[toolCall.ID] {
+				missing = append(missing, toolCall)
+			}
+		}
+		result = append(result, placeholderToolResults(missing, placeholder)...)
+		pending = nil
+	}
+
+	for _, msg := range messages {
+		if msg.Role == general.RoleTool {
+			var kept []general.Content
+			for _, content := range msg.Content {
+				if content.Type == general.ContentTypeToolRes {
+					if !calledIDs[content.ToolID] {
+						continue
+					}
+					answered[content.ToolID] = true
+				}
+				kept = append(kept, content)
+			}
+			if len(kept) > 0 {
+				msg.Content = kept
+				result = append(result, msg)
+			}
+			continue
+		}
+
+		flush()
+		result = append(result, msg)
+		if msg.Role == general.RoleAssistant {
+			pending = msg.ToolCalls
+		}
+	}
+	flush()
+
+	return result
+}
+
+// placeholderToolResults 为未执行的工具调用生成占位结果
+func placeholderToolResults(toolCalls []general.ToolCall, text string) []general.Message {
+	results := make([]general.Message, 0, len(toolCalls))
+	for _, toolCall := range toolCalls {
+		results = append(results, general.Message{
+			Role:      general.RoleTool,
+			ID:        newMessageID(),
+			CreatedAt: time.Now(),
+			Content: []general.Content{
+				{
+					Type:   general.ContentTypeToolRes,
+					Text:   text,
+					ToolID: toolCall.ID,
+				},
+			},
+		})
+	}
+	return results
+}
+
+// supportsSystemMessages 判断提供商是否接受历史记录中的system消息
+func supportsSystemMessages(provider general.Provider) bool {
+	switch provider {
+	case general.ProviderAnthropic, general.ProviderGoogle:
+		return false
+	default:
+		return true
+	}
+}
+
+// isValidToolCallID 判断工具调用ID是否满足目标提供商的格式要求
+func isValidToolCallID(provider general.Provider, id string) bool {
+	if id == "" {
+		return false
+	}
+	switch provider {
+	case general.ProviderAnthropic:
+		return anthropicToolIDPattern.MatchString(id)
+	case general.ProviderOpenAI, general.ProviderDeepSeek, general.ProviderQwen:
+		return len(id) <= 40
+	default:
+		return true
+	}
+}
+
+// migrateToolCallID 生成兼容所有提供商的工具调用ID，相同的旧ID总是映射到相同的新ID
+// 旧ID为空时由调用方传入消息序号和调用序号，避免多个没有ID的工具调用得到相同的ID
+func migrateToolCallID(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return "call_" + hex.EncodeToString(hash[:])[:32]
+}
+
+// normalizeArguments 将字符串化的函数参数（DeepSeek格式）还原为JSON对象
+func normalizeArguments(arguments json.RawMessage) json.RawMessage {
+	trimmed := strings.TrimSpace(string(arguments))
+	if trimmed == "" || trimmed == "null" {
+		return json.RawMessage("{}")
+	}
+	if trimmed[0] != '"' {
+		return arguments
+	}
+
+	var argsStr string
+	if err := json.Unmarshal([]byte(trimmed), &argsStr); err != nil {
+		return arguments
+	}
+	if strings.TrimSpace(argsStr) == "" {
+		return json.RawMessage("{}")
+	}
+	if !json.Valid([]byte(argsStr)) {
+		return arguments
+	}
+	return json.RawMessage(argsStr)
+}
@@ -0,0 +1,36 @@
+package ConversationManager
+
+import (
+	"testing"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+func TestMigrateEmptyToolCallIDs(t *testing.T) {
+	call := toolCallMessage("")
+	call.ToolCalls = append(call.ToolCalls, general.ToolCall{Type: "function", Function: general.FunctionCall{Name: "lookup", Arguments: []byte(`{}`)}})
+	messages := []general.Message{
+		textMessage(general.RoleUser, "q"),
+		call,
+		toolResultMessage(""),
+		toolResultMessage(""),
+		toolCallMessage(""),
+		toolResultMessage(""),
+	}
+
+	cm := NewConversationManager(nil)
+	migrated, _ := cm.migrateHistory(messages, general.ProviderAnthropic)
+	if len(migrated) != len(messages) {
+		t.Fatalf("migrated %d messages, want %d", len(migrated), len(messages))
+	}
+	first, second, third := migrated[1].ToolCalls[0].ID, migrated[1].ToolCalls[1].ID, migrated[4].ToolCalls[0].ID
+	if first == second || first == third || second == third {
+		t.Fatalf("tool call IDs collide: %s, %s, %s", first, second, third)
+	}
+	// 工具结果按顺序对应前一条消息中的调用
+	for index, want := range map[int]string{2: first, 3: second, 5: third} {
+		if got := migrated[index].Content[0].ToolID; got != want {
+			t.Errorf("result %d paired with %s, want %s", index, got, want)
+		}
+	}
+}
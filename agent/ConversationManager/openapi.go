@@ -0,0 +1,683 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+	"gopkg.in/yaml.v2"
+)
+
+// OpenAPIConfig 从OpenAPI（Swagger）文档生成工具的配置
+type OpenAPIConfig struct {
+	BaseURL     string                      // 服务地址，为空时使用文档中的servers（Swagger 2.0为schemes、host和basePath）
+	Prefix      string                      // 工具名称前缀
+	Operations  []string                    // 只注册这些操作（operationId或生成的工具名称），为空时注册所有操作
+	Group       string                      // 工具加入的工具组，为空时不分组
+	Headers     map[string]string           // 每个请求附加的请求头
+	Credentials general.CredentialsProvider // 认证凭据，按文档的securitySchemes发送，文档没有定义时作为Bearer令牌发送
+	HTTPClient  *http.Client                // 发送请求的客户端，为nil时使用30秒超时的客户端
+}
+
+// openAPIMethods 按顺序检查的HTTP方法
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// openAPIToolNameInvalid 工具名称中不允许的字符和连续的下划线，替换为一个下划线
+var openAPIToolNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// maxOpenAPIRefDepth 展开$ref的最大深度，超过后用不带约束的对象代替
+const maxOpenAPIRefDepth = 8
+
+// maxOpenAPIResponseSize 读取响应的最大字节数
+const maxOpenAPIResponseSize = 4 << 20
+
+// openAPIBodyParam 请求体在工具参数中的名称
+const openAPIBodyParam = "body"
+
+// openAPIOperation 一个OpenAPI操作
+type openAPIOperation struct {
+	method     string
+	path       string
+	parameters []openAPIParameter
+	hasBody    bool
+}
+
+// openAPIParameter 路径、查询或请求头参数
+type openAPIParameter struct {
+	name string
+	in   string // path、query、header
+}
+
+// openAPISecurity 文档中定义的认证方式
+type openAPISecurity struct {
+	kind string // bearer、basic、apiKey
+	in   string // apiKey的位置：header、query、cookie
+	name string // apiKey的名称
+}
+
+// openAPIToolset 由同一个文档生成的工具共享的请求参数
+type openAPIToolset struct {
+	baseURL  string
+	config   OpenAPIConfig
+	security openAPISecurity
+	client   *http.Client
+}
+
+// RegisterOpenAPIFile 读取OpenAPI文档文件并注册其中的操作，见RegisterOpenAPI
+func (cm *ConversationManager) RegisterOpenAPIFile(path string, config *OpenAPIConfig) ([]string, error) {
+	spec, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取OpenAPI文档失败: %w", err)
+	}
+	return cm.RegisterOpenAPI(spec, config)
+}
+
+// RegisterOpenAPI 将OpenAPI 3.x或Swagger 2.0文档（JSON或YAML）中的每个操作注册为工具，调用工具时发送对应的HTTP请求
+// 工具名称为operationId（没有时由方法和路径生成），路径、查询和请求头参数作为同名的工具参数，JSON请求体作为body参数；
+// 本地$ref会展开。返回注册的工具名称，注册中遇到错误时停止，已注册的工具不会撤销
+func (cm *ConversationManager) RegisterOpenAPI(spec []byte, config *OpenAPIConfig) ([]string, error) {
+	if config == nil {
+		config = &OpenAPIConfig{}
+	}
+	doc, err := parseOpenAPIDocument(spec)
+	if err != nil {
+		return nil, err
+	}
+	if doc["openapi"] == nil && doc["swagger"] == nil {
+		return nil, fmt.Errorf("不是OpenAPI或Swagger文档")
+	}
+
+	toolset := &openAPIToolset{
+		baseURL:  config.BaseURL,
+		config:   *config,
+		security: openAPISecurityScheme(doc),
+		client:   config.HTTPClient,
+	}
+	if toolset.baseURL == "" {
+		toolset.baseURL = openAPIServerURL(doc)
+	}
+	if !strings.HasPrefix(toolset.baseURL, "http://") && !strings.HasPrefix(toolset.baseURL, "https://") {
+		return nil, fmt.Errorf("文档中没有完整的服务地址，请设置BaseURL")
+	}
+	if toolset.client == nil {
+		toolset.client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range config.Operations {
+		selected[name] = true
+	}
+
+	// 先生成所有工具，再按路径和方法的顺序注册
+	paths, _ := doc["paths"].(map[string]interface{})
+	pathNames := make([]string, 0, len(paths))
+	for path := range paths {
+		pathNames = append(pathNames, path)
+	}
+	sort.Strings(pathNames)
+
+	type openAPITool struct {
+		tool       general.Tool
+		operation  *openAPIOperation
+		paramNames []string
+	}
+	var tools []openAPITool
+	for _, path := range pathNames {
+		item, ok := resolveOpenAPIRef(paths[path], doc, 0).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			operationID, _ := operation["operationId"].(string)
+			name := openAPIToolName(config.Prefix, operationID, method, path)
+			if len(selected) > 0 && !selected[operationID] && !selected[name] {
+				continue
+			}
+			tool, op, paramNames := buildOpenAPITool(doc, name, method, path, item, operation, cm.Locale())
+			tools = append(tools, openAPITool{tool: tool, operation: op, paramNames: paramNames})
+		}
+	}
+	if len(tools) == 0 {
+		return nil, fmt.Errorf("文档中没有可注册的操作")
+	}
+
+	var registered []string
+	for _, t := range tools {
+		name, err := cm.registerTool(t.tool, toolset.proxyFunction(t.operation, t.paramNames), t.paramNames)
+		if err != nil {
+			return registered, fmt.Errorf("注册操作 %s 失败: %w", t.tool.Function.Name, err)
+		}
+		cm.toolProxies[name] = toolset.compiledProxy(cm, t.operation, t.paramNames)
+		if config.Group != "" {
+			cm.AddToolsToGroup(config.Group, name)
+		}
+		registered = append(registered, name)
+	}
+	return registered, nil
+}
+
+// parseOpenAPIDocument 解析JSON或YAML格式的文档
+func parseOpenAPIDocument(spec []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if trimmed := bytes.TrimSpace(spec); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("解析OpenAPI文档失败: %w", err)
+		}
+		return doc, nil
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(spec, &raw); err != nil {
+		return nil, fmt.Errorf("解析OpenAPI文档失败: %w", err)
+	}
+	doc, ok := normalizeYAMLValue(raw).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("解析OpenAPI文档失败: 顶层不是对象")
+	}
+	return doc, nil
+}
+
+// normalizeYAMLValue 将yaml.v2解析出的map[interface{}]interface{}转换为map[string]interface{}
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = normalizeYAMLValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalizeYAMLValue(item)
+		}
+		return result
+	case int:
+		return float64(v)
+	}
+	return value
+}
+
+// openAPIServerURL 文档中的服务地址：OpenAPI 3.x的第一个servers（变量使用默认值），Swagger 2.0的schemes、host和basePath
+func openAPIServerURL(doc map[string]interface{}) string {
+	if servers, ok := doc["servers"].([]interface{}); ok && len(servers) > 0 {
+		server, _ := servers[0].(map[string]interface{})
+		serverURL, _ := server["url"].(string)
+		variables, _ := server["variables"].(map[string]interface{})
+		for name, value := range variables {
+			variable, _ := value.(map[string]interface{})
+			if def, ok := variable["default"].(string); ok {
+				serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", def)
+			}
+		}
+		return serverURL
+	}
+	host, _ := doc["host"].(string)
+	if host == "" {
+		return ""
+	}
+	scheme := "https"
+	if schemes, ok := doc["schemes"].([]interface{}); ok && len(schemes) > 0 {
+		if s, ok := schemes[0].(string); ok {
+			scheme = s
+		}
+	}
+	basePath, _ := doc["basePath"].(string)
+	return scheme + "://" + host + basePath
+}
+
+// openAPISecurityScheme 选择文档使用的认证方式：优先使用顶层security中的第一个，否则使用按名称排序的第一个定义
+func openAPISecurityScheme(doc map[string]interface{}) openAPISecurity {
+	schemes, _ := doc["securityDefinitions"].(map[string]interface{})
+	if components, ok := doc["components"].(map[string]interface{}); ok {
+		schemes, _ = components["securitySchemes"].(map[string]interface{})
+	}
+	if len(schemes) == 0 {
+		return openAPISecurity{kind: "bearer"}
+	}
+
+	var name string
+	if security, ok := doc["security"].([]interface{}); ok && len(security) > 0 {
+		if requirement, ok := security[0].(map[string]interface{}); ok {
+			for key := range requirement {
+				if _, exists := schemes[key]; exists && (name == "" || key < name) {
+					name = key
+				}
+			}
+		}
+	}
+	if name == "" {
+		for key := range schemes {
+			if name == "" || key < name {
+				name = key
+			}
+		}
+	}
+
+	scheme, _ := resolveOpenAPIRef(schemes[name], doc, 0).(map[string]interface{})
+	schemeType, _ := scheme["type"].(string)
+	switch schemeType {
+	case "apiKey":
+		in, _ := scheme["in"].(string)
+		keyName, _ := scheme["name"].(string)
+		return openAPISecurity{kind: "apiKey", in: in, name: keyName}
+	case "basic":
+		return openAPISecurity{kind: "basic"}
+	case "http":
+		if s, _ := scheme["scheme"].(string); strings.EqualFold(s, "basic") {
+			return openAPISecurity{kind: "basic"}
+		}
+	}
+	return openAPISecurity{kind: "bearer"}
+}
+
+// openAPIToolName 生成工具名称
+func openAPIToolName(prefix, operationID, method, path string) string {
+	name := operationID
+	if name == "" {
+		name = method + "_" + path
+	}
+	name = strings.Trim(openAPIToolNameInvalid.ReplaceAllString(name, "_"), "_")
+	return prefix + name
+}
+
+// buildOpenAPITool 生成操作的工具定义，返回工具、请求信息和参数名称，文档中没有的描述使用locale
+func buildOpenAPITool(doc map[string]interface{}, name, method, path string, item, operation map[string]interface{}, locale Locale) (general.Tool, *openAPIOperation, []string) {
+	op := &openAPIOperation{method: strings.ToUpper(method), path: path}
+	properties := make(map[string]interface{})
+	var required, paramNames []string
+
+	// 路径级别的参数可以被操作级别的同名参数覆盖
+	parameters := make(map[string]map[string]interface{})
+	var order []string
+	for _, list := range []interface{}{item["parameters"], operation["parameters"]} {
+		values, _ := list.([]interface{})
+		for _, value := range values {
+			parameter, ok := resolveOpenAPIRef(value, doc, 0).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			paramName, _ := parameter["name"].(string)
+			in, _ := parameter["in"].(string)
+			key := in + ":" + paramName
+			if _, exists := parameters[key]; !exists {
+				order = append(order, key)
+			}
+			parameters[key] = parameter
+		}
+	}
+
+	for _, key := range order {
+		parameter := parameters[key]
+		paramName, _ := parameter["name"].(string)
+		in, _ := parameter["in"].(string)
+		switch in {
+		case "path", "query", "header":
+			schema, _ := resolveOpenAPIRef(parameter["schema"], doc, 0).(map[string]interface{})
+			if schema == nil {
+				// Swagger 2.0的参数类型直接写在参数上
+				schema = make(map[string]interface{})
+				for _, field := range []string{"type", "format", "items", "enum", "default", "minimum", "maximum"} {
+					if value, ok := parameter[field]; ok {
+						schema[field] = resolveOpenAPIRef(value, doc, 0)
+					}
+				}
+				if schema["type"] == nil {
+					schema["type"] = "string"
+				}
+			} else {
+				schema = copyOpenAPISchema(schema)
+			}
+			if description, ok := parameter["description"].(string); ok && description != "" {
+				schema["description"] = description
+			}
+			properties[paramName] = schema
+			paramNames = append(paramNames, paramName)
+			op.parameters = append(op.parameters, openAPIParameter{name: paramName, in: in})
+			if requiredParam, _ := parameter["required"].(bool); requiredParam || in == "path" {
+				required = append(required, paramName)
+			}
+		case "body":
+			// Swagger 2.0的请求体
+			schema, _ := resolveOpenAPIRef(parameter["schema"], doc, 0).(map[string]interface{})
+			properties[openAPIBodyParam] = openAPIBodySchema(schema, parameter["description"], locale)
+			op.hasBody = true
+			if requiredBody, _ := parameter["required"].(bool); requiredBody {
+				required = append(required, openAPIBodyParam)
+			}
+		}
+	}
+
+	// OpenAPI 3.x的请求体，只支持JSON
+	if requestBody, ok := resolveOpenAPIRef(operation["requestBody"], doc, 0).(map[string]interface{}); ok {
+		content, _ := requestBody["content"].(map[string]interface{})
+		var media map[string]interface{}
+		for contentType, value := range content {
+			if contentType == "application/json" || (media == nil && strings.Contains(contentType, "json")) {
+				media, _ = value.(map[string]interface{})
+			}
+		}
+		if media != nil {
+			schema, _ := resolveOpenAPIRef(media["schema"], doc, 0).(map[string]interface{})
+			properties[openAPIBodyParam] = openAPIBodySchema(schema, requestBody["description"], locale)
+			op.hasBody = true
+			if requiredBody, _ := requestBody["required"].(bool); requiredBody {
+				required = append(required, openAPIBodyParam)
+			}
+		}
+	}
+	if op.hasBody {
+		paramNames = append(paramNames, openAPIBodyParam)
+	}
+
+	var descriptions []string
+	for _, field := range []string{"summary", "description"} {
+		if text, ok := operation[field].(string); ok && strings.TrimSpace(text) != "" {
+			descriptions = append(descriptions, strings.TrimSpace(text))
+		}
+	}
+	if len(descriptions) == 0 {
+		descriptions = append(descriptions, op.method+" "+path)
+	}
+	if required == nil {
+		required = []string{}
+	}
+
+	tool := general.Tool{
+		Type: "function",
+		Function: general.FunctionDefinition{
+			Name:        name,
+			Description: strings.Join(descriptions, "\n"),
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		},
+	}
+	return tool, op, paramNames
+}
+
+// openAPIBodySchema 请求体参数的Schema
+func openAPIBodySchema(schema map[string]interface{}, description interface{}, locale Locale) map[string]interface{} {
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object"}
+	} else {
+		schema = copyOpenAPISchema(schema)
+	}
+	if text, ok := description.(string); ok && text != "" {
+		schema["description"] = text
+	} else if schema["description"] == nil {
+		schema["description"] = Localize(locale, MsgRequestBody)
+	}
+	return schema
+}
+
+// copyOpenAPISchema 复制Schema的顶层，避免修改文档中共享的定义
+func copyOpenAPISchema(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(schema)+1)
+	for key, value := range schema {
+		result[key] = value
+	}
+	return result
+}
+
+// resolveOpenAPIRef 递归展开本地$ref（#/components/...或#/definitions/...），并删除x-开头的扩展字段
+func resolveOpenAPIRef(value interface{}, doc map[string]interface{}, depth int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if depth >= maxOpenAPIRefDepth || !strings.HasPrefix(ref, "#/") {
+				return map[string]interface{}{"type": "object"}
+			}
+			var target interface{} = doc
+			for _, part := range strings.Split(ref[2:], "/") {
+				part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+				object, ok := target.(map[string]interface{})
+				if !ok {
+					return map[string]interface{}{"type": "object"}
+				}
+				target = object[part]
+			}
+			if target == nil {
+				return map[string]interface{}{"type": "object"}
+			}
+			return resolveOpenAPIRef(target, doc, depth+1)
+		}
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if strings.HasPrefix(key, "x-") {
+				continue
+			}
+			result[key] = resolveOpenAPIRef(item, doc, depth)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = resolveOpenAPIRef(item, doc, depth)
+		}
+		return result
+	}
+	return value
+}
+
+// proxyFunction 生成工具的函数，每个参数都是interface{}，未传的参数为nil
+func (t *openAPIToolset) proxyFunction(op *openAPIOperation, paramNames []string) reflect.Value {
+	in := make([]reflect.Type, len(paramNames))
+	for i := range in {
+		in[i] = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	out := []reflect.Type{reflect.TypeOf(""), reflect.TypeOf((*error)(nil)).Elem()}
+	funcType := reflect.FuncOf(in, out, false)
+
+	return reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+		values := make(map[string]interface{}, len(args))
+		for i, arg := range args {
+			if value := arg.Interface(); value != nil {
+				values[paramNames[i]] = value
+			}
+		}
+		result, err := t.call(context.Background(), op, values)
+		errValue := reflect.Zero(out[1])
+		if err != nil {
+			errValue = reflect.ValueOf(err)
+		}
+		return []reflect.Value{reflect.ValueOf(result), errValue}
+	})
+}
+
+// validPathSegment 判断路径参数的值不为空，且不包含"."或".."段
+func validPathSegment(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// checkOpenAPIURL 确认请求地址没有离开baseURL：主机相同，路径在baseURL的路径之下且不含"."和".."段
+func checkOpenAPIURL(baseURL, requestURL string) error {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("接口地址无效: %w", err)
+	}
+	target, err := url.Parse(requestURL)
+	if err != nil {
+		return fmt.Errorf("请求地址无效: %w", err)
+	}
+	for _, segment := range strings.Split(target.EscapedPath(), "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("请求路径不能包含%q: %s", segment, target.Path)
+		}
+	}
+	basePath := strings.TrimRight(base.EscapedPath(), "/") + "/"
+	if target.Scheme != base.Scheme || target.Host != base.Host || !strings.HasPrefix(target.EscapedPath()+"/", basePath) {
+		return fmt.Errorf("请求地址 %s 不在接口地址 %s 之下", requestURL, baseURL)
+	}
+	return nil
+}
+
+// compiledProxy 生成工具的预编译代理，使用对话的上下文发送请求，未传或为null的参数不发送
+func (t *openAPIToolset) compiledProxy(cm *ConversationManager, op *openAPIOperation, paramNames []string) toolProxy {
+	return func(ctx context.Context, params map[string]interface{}, lenient bool) (string, error) {
+		values := make(map[string]interface{}, len(paramNames))
+		for _, name := range paramNames {
+			if value := params[name]; value != nil {
+				values[name] = value
+			}
+		}
+		return cm.proxyResult(t.call(ctx, op, values))
+	}
+}
+
+// call 发送操作对应的HTTP请求，返回响应内容，状态码不是2xx或3xx时返回错误
+func (t *openAPIToolset) call(ctx context.Context, op *openAPIOperation, args map[string]interface{}) (string, error) {
+	path := op.path
+	query := url.Values{}
+	header := http.Header{}
+	for _, parameter := range op.parameters {
+		value, ok := args[parameter.name]
+		if !ok {
+			continue
+		}
+		switch parameter.in {
+		case "path":
+			// PathEscape不转义"."，模型传入".."时会跳出操作的路径，访问同一主机上的其他接口；
+			// 部分服务端会解码%2F，值中以"/"或"\"分隔的"."和".."同样拒绝
+			segment := openAPIValue(value)
+			if !validPathSegment(segment) {
+				return "", fmt.Errorf("路径参数 %s 的值无效: %q", parameter.name, segment)
+			}
+			path = strings.ReplaceAll(path, "{"+parameter.name+"}", url.PathEscape(segment))
+		case "query":
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					query.Add(parameter.name, openAPIValue(item))
+				}
+			} else {
+				query.Add(parameter.name, openAPIValue(value))
+			}
+		case "header":
+			header.Set(parameter.name, openAPIValue(value))
+		}
+	}
+	if start := strings.Index(path, "{"); start >= 0 {
+		return "", fmt.Errorf("缺少路径参数: %s", path[start:])
+	}
+
+	var body io.Reader
+	if value, ok := args[openAPIBodyParam]; ok && op.hasBody {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("序列化请求体失败: %w", err)
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+	for key, value := range t.config.Headers {
+		header.Set(key, value)
+	}
+	if err := t.authorize(ctx, header, query); err != nil {
+		return "", err
+	}
+
+	requestURL := strings.TrimRight(t.baseURL, "/") + path
+	if err := checkOpenAPIURL(t.baseURL, requestURL); err != nil {
+		return "", err
+	}
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, op.method, requestURL, body)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOpenAPIResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("读取响应失败: %w", err)
+	}
+	text := strings.TrimSpace(string(data))
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, text)
+	}
+	if text == "" {
+		return fmt.Sprintf("HTTP %d", resp.StatusCode), nil
+	}
+	return text, nil
+}
+
+// authorize 按文档的认证方式附加凭据
+func (t *openAPIToolset) authorize(ctx context.Context, header http.Header, query url.Values) error {
+	if t.config.Credentials == nil {
+		return nil
+	}
+	key, err := t.config.Credentials.APIKey(ctx)
+	if err != nil {
+		return fmt.Errorf("获取认证凭据失败: %w", err)
+	}
+	switch t.security.kind {
+	case "basic":
+		// 凭据格式为user:password
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(key)))
+	case "apiKey":
+		switch t.security.in {
+		case "query":
+			query.Set(t.security.name, key)
+		case "cookie":
+			header.Add("Cookie", t.security.name+"="+key)
+		default:
+			header.Set(t.security.name, key)
+		}
+	default:
+		header.Set("Authorization", "Bearer "+key)
+	}
+	return nil
+}
+
+// openAPIValue 将参数值转换为路径、查询或请求头中的字符串
+func openAPIValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
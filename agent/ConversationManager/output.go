@@ -0,0 +1,171 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// OutputProcessor 最终回复的后处理器，返回错误时将错误反馈给模型重新生成
+type OutputProcessor interface {
+	Process(ctx context.Context, text string) (string, error)
+}
+
+// OutputProcessorFunc 将函数适配为OutputProcessor
+type OutputProcessorFunc func(ctx context.Context, text string) (string, error)
+
+// Process 调用函数本身
+func (f OutputProcessorFunc) Process(ctx context.Context, text string) (string, error) {
+	return f(ctx, text)
+}
+
+// AddOutputProcessor 添加最终回复的后处理器，按添加顺序处理不包含工具调用的助手回复，处理结果写入历史并返回
+func (cm *ConversationManager) AddOutputProcessor(processor OutputProcessor) {
+	cm.outputProcessors = append(cm.outputProcessors, processor)
+}
+
+// ClearOutputProcessors 移除所有后处理器
+func (cm *ConversationManager) ClearOutputProcessors() {
+	cm.outputProcessors = nil
+}
+
+// SetOutputRetries 设置后处理失败时带着错误信息让模型重新回答的最大次数，超过后Chat返回错误，默认2次
+func (cm *ConversationManager) SetOutputRetries(retries int) {
+	cm.outputRetries = max(retries, 0)
+}
+
+// SetResponseFormat 设置结构化输出格式，为nil时输出普通文本
+// 最终回复未通过JSON或Schema校验时，带着校验问题让模型重新回答，最多retries次，仍失败时Chat返回general.StructuredOutputError
+func (cm *ConversationManager) SetResponseFormat(format *general.ResponseFormat, retries int) {
+	cm.responseFormat = format
+	cm.structuredRetries = max(retries, 0)
+}
+
+// processOutput 依次执行后处理器，返回文本内容替换为处理结果的消息
+func (cm *ConversationManager) processOutput(ctx context.Context, msg general.Message) (general.Message, error) {
+	text := messageText(msg)
+	for _, processor := range cm.outputProcessors {
+		var err error
+		if text, err = processor.Process(ctx, text); err != nil {
+			return msg, err
+		}
+	}
+
+	// 多个文本内容合并为一个，其他内容（如音频）保持不变
+	content := make([]general.Content, 0, len(msg.Content)+1)
+	replaced := false
+	for _, item := range msg.Content {
+		if item.Type != general.ContentTypeText {
+			content = append(content, item)
+			continue
+		}
+		if !replaced {
+			item.Text = text
+			content = append(content, item)
+			replaced = true
+		}
+	}
+	if !replaced && text != "" {
+		content = append(content, general.Content{Type: general.ContentTypeText, Text: text})
+	}
+	msg.Content = content
+	return msg, nil
+}
+
+// outputFeedback 后处理失败时发送给模型的反馈消息
+func (cm *ConversationManager) outputFeedback(err error) general.Message {
+	return general.Message{
+		Role: general.RoleUser,
+		Content: []general.Content{{
+			Type: general.ContentTypeText,
+			Text: cm.text(MsgOutputFeedback, err),
+		}},
+	}
+}
+
+// fencePattern 匹配markdown代码块
+var fencePattern = regexp.MustCompile("(?s)```[a-zA-Z0-9_+-]*[ \t]*\r?\n(.*?)\r?\n?```")
+
+// StripMarkdownFences 去掉包裹整个回复的markdown代码块标记
+func StripMarkdownFences() OutputProcessor {
+	return OutputProcessorFunc(func(ctx context.Context, text string) (string, error) {
+		trimmed := strings.TrimSpace(text)
+		if match := fencePattern.FindStringSubmatchIndex(trimmed); match != nil && match[0] == 0 && match[1] == len(trimmed) {
+			return trimmed[match[2]:match[3]], nil
+		}
+		return text, nil
+	})
+}
+
+// ExtractJSON 从回复中提取第一个完整的JSON对象或数组（优先取代码块中的内容），找不到时返回错误
+func ExtractJSON() OutputProcessor {
+	return OutputProcessorFunc(func(ctx context.Context, text string) (string, error) {
+		candidates := []string{}
+		for _, match := range fencePattern.FindAllStringSubmatch(text, -1) {
+			candidates = append(candidates, match[1])
+		}
+		candidates = append(candidates, text)
+
+		for _, candidate := range candidates {
+			for i := 0; i < len(candidate); i++ {
+				if candidate[i] != '{' && candidate[i] != '[' {
+					continue
+				}
+				var raw json.RawMessage
+				if err := json.NewDecoder(strings.NewReader(candidate[i:])).Decode(&raw); err == nil {
+					return string(raw), nil
+				}
+			}
+		}
+		return "", fmt.Errorf("回复中没有找到有效的JSON，请只输出一个JSON对象")
+	})
+}
+
+// RegexReplace 将回复中匹配正则表达式的内容替换为repl，repl中可以使用$1等引用分组
+func RegexReplace(re *regexp.Regexp, repl string) OutputProcessor {
+	return OutputProcessorFunc(func(ctx context.Context, text string) (string, error) {
+		return re.ReplaceAllString(text, repl), nil
+	})
+}
+
+// languageScripts 语言代码对应的文字
+var languageScripts = map[string]struct {
+	name    string
+	scripts []*unicode.RangeTable
+}{
+	"zh": {"中文", []*unicode.RangeTable{unicode.Han}},
+	"ja": {"日语", []*unicode.RangeTable{unicode.Hiragana, unicode.Katakana, unicode.Han}},
+	"ko": {"韩语", []*unicode.RangeTable{unicode.Hangul}},
+	"ru": {"俄语", []*unicode.RangeTable{unicode.Cyrillic}},
+	"en": {"英语", []*unicode.RangeTable{unicode.Latin}},
+}
+
+// RequireLanguage 要求回复主要使用指定语言（zh、ja、ko、ru、en），按文字统计，代码和数字不计入
+// 指定语言的文字少于所有文字的一半时返回错误，让模型用指定语言重新回答
+func RequireLanguage(language string) OutputProcessor {
+	return OutputProcessorFunc(func(ctx context.Context, text string) (string, error) {
+		lang, ok := languageScripts[language]
+		if !ok {
+			return text, fmt.Errorf("不支持的语言: %s", language)
+		}
+		total, matched := 0, 0
+		for _, r := range fencePattern.ReplaceAllString(text, "") {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			total++
+			if unicode.In(r, lang.scripts...) {
+				matched++
+			}
+		}
+		if total > 0 && matched*2 < total {
+			return text, fmt.Errorf("请使用%s回答", lang.name)
+		}
+		return text, nil
+	})
+}
@@ -0,0 +1,24 @@
+package ConversationManager
+
+import (
+	"fmt"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ToolPanicError 注册的函数或工具代理执行时发生panic，对话继续，panic以错误结果返回给模型
+type ToolPanicError struct {
+	Tool  string      // 工具名称
+	Value interface{} // recover得到的值
+	Stack string      // panic时的调用栈
+}
+
+func (e *ToolPanicError) Error() string {
+	return fmt.Sprintf("函数 %s 执行时发生panic: %v", e.Tool, e.Value)
+}
+
+// reportToolPanic 记录工具的panic并发送ToolPanic事件，事件中带有调用栈
+func (cm *ConversationManager) reportToolPanic(toolCall general.ToolCall, err *ToolPanicError) {
+	cm.Logger().Error("tool panicked", "tool", err.Tool, "tool_call_id", toolCall.ID, "panic", fmt.Sprint(err.Value), "stack", err.Stack)
+	cm.emit(Event{Type: EventToolPanic, ToolCall: &toolCall, Err: err, Stack: err.Stack})
+}
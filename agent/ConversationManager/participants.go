@@ -0,0 +1,27 @@
+package ConversationManager
+
+import (
+	"context"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ChatAs 以指定发言人的身份发送消息，多个用户在同一对话中发言时模型可以区分是谁说的
+// 发言人保存在用户消息的Name中；OpenAI和DeepSeek以name字段发送，其他提供商在消息开头加上"[发言人]: "标签
+func (cm *ConversationManager) ChatAs(ctx context.Context, provider general.Provider, model string, speaker string, userMessage string, info_chan chan general.Message) ([]general.Message, general.StopReason, error, *general.Usage) {
+	return cm.chatWithImages(ctx, provider, model, speaker, userMessage, nil, info_chan)
+}
+
+// Participants 按首次发言的顺序返回历史中出现过的发言人，没有指定发言人的用户消息不计入
+func (cm *ConversationManager) Participants() []string {
+	seen := make(map[string]bool)
+	var participants []string
+	for _, msg := range cm.history {
+		if msg.Role != general.RoleUser || msg.Name == "" || seen[msg.Name] {
+			continue
+		}
+		seen[msg.Name] = true
+		participants = append(participants, msg.Name)
+	}
+	return participants
+}
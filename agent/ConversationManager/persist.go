@@ -0,0 +1,154 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// savedSessionVersion SaveHistory写入的格式版本，读取更高版本的文件时返回错误
+const savedSessionVersion = 1
+
+// SavedSession SaveHistory保存的会话状态，进程重启后通过LoadHistory恢复并继续对话
+// 注册的工具、MCP连接、回调等代码中的设置不保存，恢复前需要重新设置
+type SavedSession struct {
+	Version          int               `json:"version"`
+	SessionID        string            `json:"session_id"`
+	Turn             int               `json:"turn"`
+	Provider         general.Provider  `json:"provider,omitempty"` // 历史记录所适配的提供商
+	SystemPrompt     string            `json:"system_prompt,omitempty"`
+	History          []general.Message `json:"history"`
+	LastUsage        *general.Usage    `json:"last_usage,omitempty"`
+	TotalUsage       *general.Usage    `json:"total_usage,omitempty"`
+	ActiveToolGroups []string          `json:"active_tool_groups,omitempty"` // SetActiveToolGroups设置的工具组
+	SavedAt          time.Time         `json:"saved_at"`
+}
+
+// SaveHistory 将历史记录、系统提示词、使用量和工具组等会话状态以JSON保存到文件，先写临时文件再重命名
+func (cm *ConversationManager) SaveHistory(path string) error {
+	var buf bytes.Buffer
+	if err := cm.WriteHistory(&buf); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// LoadHistory 读取SaveHistory保存的会话状态并恢复，历史记录按SetHistory的规则校验，校验失败时会话不变
+func (cm *ConversationManager) LoadHistory(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取会话失败: %w", err)
+	}
+	defer file.Close()
+	return cm.ReadHistory(file)
+}
+
+// WriteHistory 将会话状态以JSON写入w，对话进行中时不能保存
+func (cm *ConversationManager) WriteHistory(w io.Writer) error {
+	if cm.lifecycle.busy() {
+		return fmt.Errorf("对话进行中，不能保存会话")
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(cm.savedSession())
+}
+
+// ReadHistory 从r读取WriteHistory写入的会话状态并恢复
+func (cm *ConversationManager) ReadHistory(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("读取会话失败: %w", err)
+	}
+	if isEncrypted(data) {
+		return fmt.Errorf("读取会话失败: %w，请使用LoadEncryptedHistory", ErrEncrypted)
+	}
+	return cm.restoreSession(data)
+}
+
+// SaveEncryptedHistory 与SaveHistory相同，但写入前用encryptor加密，用LoadEncryptedHistory读取
+func (cm *ConversationManager) SaveEncryptedHistory(ctx context.Context, path string, encryptor Encryptor) error {
+	var buf bytes.Buffer
+	if err := cm.WriteHistory(&buf); err != nil {
+		return err
+	}
+	data, err := encryptor.Encrypt(ctx, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("加密会话失败: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// LoadEncryptedHistory 读取SaveEncryptedHistory保存的会话状态并恢复，未加密的文件返回ErrNotEncrypted
+// 从明文迁移时先用EncryptFile加密原文件
+func (cm *ConversationManager) LoadEncryptedHistory(ctx context.Context, path string, encryptor Encryptor) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取会话失败: %w", err)
+	}
+	if !isEncrypted(data) {
+		return fmt.Errorf("会话 %s: %w", path, ErrNotEncrypted)
+	}
+	if data, err = encryptor.Decrypt(ctx, data); err != nil {
+		return fmt.Errorf("解密会话失败: %w", err)
+	}
+	return cm.restoreSession(data)
+}
+
+// savedSession 当前的会话状态
+func (cm *ConversationManager) savedSession() SavedSession {
+	return SavedSession{
+		Version:          savedSessionVersion,
+		SessionID:        cm.sessionID,
+		Turn:             cm.turn,
+		Provider:         cm.provider,
+		SystemPrompt:     cm.systemPrompt,
+		History:          cm.history,
+		LastUsage:        cm.LastUsage,
+		TotalUsage:       cm.TotalUsage,
+		ActiveToolGroups: cm.activeGroups,
+		SavedAt:          time.Now(),
+	}
+}
+
+// restoreSession 解析并恢复会话状态
+func (cm *ConversationManager) restoreSession(data []byte) error {
+	var saved SavedSession
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("解析会话失败: %w", err)
+	}
+	if saved.Version > savedSessionVersion {
+		return fmt.Errorf("会话的格式版本 %d 高于支持的版本 %d", saved.Version, savedSessionVersion)
+	}
+	if err := cm.SetHistory(saved.History); err != nil {
+		return err
+	}
+	if saved.SessionID != "" {
+		cm.sessionID = saved.SessionID
+	}
+	cm.turn = saved.Turn
+	cm.provider = saved.Provider
+	cm.systemPrompt = saved.SystemPrompt
+	cm.LastUsage = saved.LastUsage
+	cm.TotalUsage = saved.TotalUsage
+	// 工具组可能在恢复之后才定义，不在这里校验
+	cm.activeGroups = saved.ActiveToolGroups
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，中断时不会留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,885 @@
+package ConversationManager
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 不依赖protobuf库的最小实现：解析反射服务返回的FileDescriptorProto，
+// 根据描述符生成JSON Schema，并在JSON和protobuf二进制格式之间转换消息
+
+// protobuf的线路类型
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// FieldDescriptorProto中的字段类型
+const (
+	protoTypeDouble   = 1
+	protoTypeFloat    = 2
+	protoTypeInt64    = 3
+	protoTypeUint64   = 4
+	protoTypeInt32    = 5
+	protoTypeFixed64  = 6
+	protoTypeFixed32  = 7
+	protoTypeBool     = 8
+	protoTypeString   = 9
+	protoTypeGroup    = 10
+	protoTypeMessage  = 11
+	protoTypeBytes    = 12
+	protoTypeUint32   = 13
+	protoTypeEnum     = 14
+	protoTypeSfixed32 = 15
+	protoTypeSfixed64 = 16
+	protoTypeSint32   = 17
+	protoTypeSint64   = 18
+)
+
+// FieldDescriptorProto中的标签
+const (
+	protoLabelRequired = 2
+	protoLabelRepeated = 3
+)
+
+// maxProtoSchemaDepth 生成Schema时嵌套消息的最大深度，超过后用不带约束的对象代替，避免递归消息无限展开
+const maxProtoSchemaDepth = 8
+
+// protoWireField 解析出的一个字段
+type protoWireField struct {
+	number   int
+	wireType int
+	varint   uint64 // varint、fixed32和fixed64的值
+	bytes    []byte // 长度前缀的值
+}
+
+// protoField 消息中的字段
+type protoField struct {
+	name     string
+	jsonName string
+	number   int
+	label    int
+	typ      int
+	typeName string // 消息或枚举的全名，不带开头的点
+}
+
+// protoMessage 消息描述
+type protoMessage struct {
+	fullName string
+	fields   []*protoField
+	mapEntry bool
+}
+
+// protoEnumValue 枚举值
+type protoEnumValue struct {
+	name   string
+	number int32
+}
+
+// protoEnum 枚举描述
+type protoEnum struct {
+	fullName string
+	values   []protoEnumValue
+}
+
+// protoMethod 服务中的方法
+type protoMethod struct {
+	name            string
+	inputType       string
+	outputType      string
+	clientStreaming bool
+	serverStreaming bool
+}
+
+// protoService 服务描述
+type protoService struct {
+	fullName string
+	methods  []protoMethod
+}
+
+// protoRegistry 已解析的描述符，键为不带开头的点的全名
+type protoRegistry struct {
+	files    map[string]bool
+	messages map[string]*protoMessage
+	enums    map[string]*protoEnum
+	services map[string]*protoService
+}
+
+// newProtoRegistry 创建空的描述符集合
+func newProtoRegistry() *protoRegistry {
+	return &protoRegistry{
+		files:    make(map[string]bool),
+		messages: make(map[string]*protoMessage),
+		enums:    make(map[string]*protoEnum),
+		services: make(map[string]*protoService),
+	}
+}
+
+// appendProtoVarint 追加varint
+func appendProtoVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendProtoTag 追加字段编号和线路类型
+func appendProtoTag(b []byte, number int, wireType int) []byte {
+	return appendProtoVarint(b, uint64(number)<<3|uint64(wireType))
+}
+
+// appendProtoBytes 追加长度前缀的字段（字符串、字节和嵌套消息），空值也会写入
+func appendProtoBytes(b []byte, number int, value []byte) []byte {
+	b = appendProtoTag(b, number, protoWireBytes)
+	b = appendProtoVarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// parseProtoFields 解析消息中的所有字段，不支持已废弃的group
+func parseProtoFields(data []byte) ([]protoWireField, error) {
+	var fields []protoWireField
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("protobuf消息格式错误: 无效的字段标签")
+		}
+		data = data[n:]
+		field := protoWireField{number: int(tag >> 3), wireType: int(tag & 7)}
+		switch field.wireType {
+		case protoWireVarint:
+			field.varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errors.New("protobuf消息格式错误: 无效的varint")
+			}
+			data = data[n:]
+		case protoWireFixed64:
+			if len(data) < 8 {
+				return nil, errors.New("protobuf消息格式错误: fixed64长度不足")
+			}
+			field.varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoWireFixed32:
+			if len(data) < 4 {
+				return nil, errors.New("protobuf消息格式错误: fixed32长度不足")
+			}
+			field.varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case protoWireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, errors.New("protobuf消息格式错误: 长度超出消息")
+			}
+			field.bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("protobuf消息格式错误: 不支持的线路类型 %d", field.wireType)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// addFile 解析FileDescriptorProto并加入集合，返回依赖的文件名
+func (r *protoRegistry) addFile(data []byte) (string, []string, error) {
+	fields, err := parseProtoFields(data)
+	if err != nil {
+		return "", nil, err
+	}
+	var name, pkg string
+	var dependencies []string
+	for _, f := range fields {
+		switch f.number {
+		case 1:
+			name = string(f.bytes)
+		case 2:
+			pkg = string(f.bytes)
+		case 3:
+			dependencies = append(dependencies, string(f.bytes))
+		}
+	}
+	if r.files[name] {
+		return name, dependencies, nil
+	}
+	r.files[name] = true
+
+	for _, f := range fields {
+		switch f.number {
+		case 4:
+			if err := r.addMessage(pkg, f.bytes); err != nil {
+				return "", nil, err
+			}
+		case 5:
+			if err := r.addEnum(pkg, f.bytes); err != nil {
+				return "", nil, err
+			}
+		case 6:
+			if err := r.addService(pkg, f.bytes); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	return name, dependencies, nil
+}
+
+// protoFullName 拼接作用域和名称
+func protoFullName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// addMessage 解析DescriptorProto，包括嵌套的消息和枚举
+func (r *protoRegistry) addMessage(scope string, data []byte) error {
+	fields, err := parseProtoFields(data)
+	if err != nil {
+		return err
+	}
+	message := &protoMessage{}
+	for _, f := range fields {
+		if f.number == 1 {
+			message.fullName = protoFullName(scope, string(f.bytes))
+		}
+	}
+	for _, f := range fields {
+		switch f.number {
+		case 2:
+			field, err := parseProtoField(f.bytes)
+			if err != nil {
+				return err
+			}
+			message.fields = append(message.fields, field)
+		case 3:
+			if err := r.addMessage(message.fullName, f.bytes); err != nil {
+				return err
+			}
+		case 4:
+			if err := r.addEnum(message.fullName, f.bytes); err != nil {
+				return err
+			}
+		case 7:
+			// MessageOptions.map_entry
+			options, err := parseProtoFields(f.bytes)
+			if err != nil {
+				return err
+			}
+			for _, option := range options {
+				if option.number == 7 && option.varint != 0 {
+					message.mapEntry = true
+				}
+			}
+		}
+	}
+	r.messages[message.fullName] = message
+	return nil
+}
+
+// parseProtoField 解析FieldDescriptorProto
+func parseProtoField(data []byte) (*protoField, error) {
+	fields, err := parseProtoFields(data)
+	if err != nil {
+		return nil, err
+	}
+	field := &protoField{}
+	for _, f := range fields {
+		switch f.number {
+		case 1:
+			field.name = string(f.bytes)
+		case 3:
+			field.number = int(f.varint)
+		case 4:
+			field.label = int(f.varint)
+		case 5:
+			field.typ = int(f.varint)
+		case 6:
+			field.typeName = strings.TrimPrefix(string(f.bytes), ".")
+		case 10:
+			field.jsonName = string(f.bytes)
+		}
+	}
+	return field, nil
+}
+
+// addEnum 解析EnumDescriptorProto
+func (r *protoRegistry) addEnum(scope string, data []byte) error {
+	fields, err := parseProtoFields(data)
+	if err != nil {
+		return err
+	}
+	enum := &protoEnum{}
+	for _, f := range fields {
+		switch f.number {
+		case 1:
+			enum.fullName = protoFullName(scope, string(f.bytes))
+		case 2:
+			valueFields, err := parseProtoFields(f.bytes)
+			if err != nil {
+				return err
+			}
+			var value protoEnumValue
+			for _, vf := range valueFields {
+				switch vf.number {
+				case 1:
+					value.name = string(vf.bytes)
+				case 2:
+					value.number = int32(vf.varint)
+				}
+			}
+			enum.values = append(enum.values, value)
+		}
+	}
+	r.enums[enum.fullName] = enum
+	return nil
+}
+
+// addService 解析ServiceDescriptorProto
+func (r *protoRegistry) addService(pkg string, data []byte) error {
+	fields, err := parseProtoFields(data)
+	if err != nil {
+		return err
+	}
+	service := &protoService{}
+	for _, f := range fields {
+		switch f.number {
+		case 1:
+			service.fullName = protoFullName(pkg, string(f.bytes))
+		case 2:
+			methodFields, err := parseProtoFields(f.bytes)
+			if err != nil {
+				return err
+			}
+			var method protoMethod
+			for _, mf := range methodFields {
+				switch mf.number {
+				case 1:
+					method.name = string(mf.bytes)
+				case 2:
+					method.inputType = strings.TrimPrefix(string(mf.bytes), ".")
+				case 3:
+					method.outputType = strings.TrimPrefix(string(mf.bytes), ".")
+				case 5:
+					method.clientStreaming = mf.varint != 0
+				case 6:
+					method.serverStreaming = mf.varint != 0
+				}
+			}
+			service.methods = append(service.methods, method)
+		}
+	}
+	r.services[service.fullName] = service
+	return nil
+}
+
+// messageSchema 生成消息的JSON Schema，字段名使用proto中的名称
+func (r *protoRegistry) messageSchema(name string, depth int) map[string]interface{} {
+	message, ok := r.messages[name]
+	if !ok || depth >= maxProtoSchemaDepth {
+		return map[string]interface{}{"type": "object"}
+	}
+	properties := make(map[string]interface{}, len(message.fields))
+	required := []string{}
+	for _, field := range message.fields {
+		properties[field.name] = r.fieldSchema(field, depth)
+		if field.label == protoLabelRequired {
+			required = append(required, field.name)
+		}
+	}
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fieldSchema 生成字段的JSON Schema
+func (r *protoRegistry) fieldSchema(field *protoField, depth int) map[string]interface{} {
+	if field.label == protoLabelRepeated {
+		// map字段编码为key和value的重复消息
+		if entry, ok := r.messages[field.typeName]; ok && entry.mapEntry && len(entry.fields) == 2 {
+			return map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": r.singleFieldSchema(entry.fields[1], depth+1),
+			}
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": r.singleFieldSchema(field, depth),
+		}
+	}
+	return r.singleFieldSchema(field, depth)
+}
+
+// singleFieldSchema 生成字段单个值的JSON Schema
+func (r *protoRegistry) singleFieldSchema(field *protoField, depth int) map[string]interface{} {
+	switch field.typ {
+	case protoTypeDouble, protoTypeFloat:
+		return map[string]interface{}{"type": "number"}
+	case protoTypeInt64, protoTypeUint64, protoTypeInt32, protoTypeFixed64, protoTypeFixed32,
+		protoTypeUint32, protoTypeSfixed32, protoTypeSfixed64, protoTypeSint32, protoTypeSint64:
+		return map[string]interface{}{"type": "integer"}
+	case protoTypeBool:
+		return map[string]interface{}{"type": "boolean"}
+	case protoTypeBytes:
+		return map[string]interface{}{"type": "string", "description": "base64编码的字节"}
+	case protoTypeEnum:
+		schema := map[string]interface{}{"type": "string"}
+		if enum, ok := r.enums[field.typeName]; ok {
+			names := make([]interface{}, len(enum.values))
+			for i, value := range enum.values {
+				names[i] = value.name
+			}
+			schema["enum"] = names
+		}
+		return schema
+	case protoTypeMessage:
+		return r.messageSchema(field.typeName, depth+1)
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// encodeMessage 将JSON对象编码为protobuf消息，字段名可以使用proto中的名称或json_name
+func (r *protoRegistry) encodeMessage(name string, value map[string]interface{}) ([]byte, error) {
+	message, ok := r.messages[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的消息类型: %s", name)
+	}
+	byName := make(map[string]*protoField, len(message.fields)*2)
+	for _, field := range message.fields {
+		byName[field.name] = field
+		if field.jsonName != "" {
+			byName[field.jsonName] = field
+		}
+	}
+
+	// 按字段名排序，保证编码结果稳定
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b []byte
+	for _, key := range keys {
+		item := value[key]
+		if item == nil {
+			continue
+		}
+		field, ok := byName[key]
+		if !ok {
+			return nil, fmt.Errorf("%s 没有字段 %s", name, key)
+		}
+		var err error
+		if b, err = r.encodeField(b, field, item); err != nil {
+			return nil, fmt.Errorf("字段 %s: %w", key, err)
+		}
+	}
+	return b, nil
+}
+
+// encodeField 编码字段，重复字段不使用packed编码（解析器必须同时接受两种编码）
+func (r *protoRegistry) encodeField(b []byte, field *protoField, value interface{}) ([]byte, error) {
+	if field.label != protoLabelRepeated {
+		return r.encodeValue(b, field, value)
+	}
+
+	if entry, ok := r.messages[field.typeName]; ok && entry.mapEntry && len(entry.fields) == 2 {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("需要JSON对象")
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// JSON对象的键都是字符串，数字和布尔类型的键由encodeValue从字符串解析
+			var entryBytes []byte
+			var err error
+			if entryBytes, err = r.encodeValue(entryBytes, entry.fields[0], key); err != nil {
+				return nil, fmt.Errorf("键 %s: %w", key, err)
+			}
+			if object[key] != nil {
+				if entryBytes, err = r.encodeValue(entryBytes, entry.fields[1], object[key]); err != nil {
+					return nil, fmt.Errorf("键 %s: %w", key, err)
+				}
+			}
+			b = appendProtoBytes(b, field.number, entryBytes)
+		}
+		return b, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+	for i, item := range list {
+		var err error
+		if b, err = r.encodeValue(b, field, item); err != nil {
+			return nil, fmt.Errorf("第 %d 个元素: %w", i, err)
+		}
+	}
+	return b, nil
+}
+
+// encodeValue 编码字段的单个值
+func (r *protoRegistry) encodeValue(b []byte, field *protoField, value interface{}) ([]byte, error) {
+	switch field.typ {
+	case protoTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("需要字符串")
+		}
+		return appendProtoBytes(b, field.number, []byte(s)), nil
+
+	case protoTypeBytes:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("需要base64字符串")
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if data, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return nil, errors.New("需要base64字符串")
+			}
+		}
+		return appendProtoBytes(b, field.number, data), nil
+
+	case protoTypeMessage:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("需要JSON对象")
+		}
+		data, err := r.encodeMessage(field.typeName, object)
+		if err != nil {
+			return nil, err
+		}
+		return appendProtoBytes(b, field.number, data), nil
+
+	case protoTypeBool:
+		v, ok := value.(bool)
+		if !ok {
+			if s, isString := value.(string); isString {
+				parsed, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, errors.New("需要布尔值")
+				}
+				v = parsed
+			} else {
+				return nil, errors.New("需要布尔值")
+			}
+		}
+		var n uint64
+		if v {
+			n = 1
+		}
+		return appendProtoVarint(appendProtoTag(b, field.number, protoWireVarint), n), nil
+
+	case protoTypeEnum:
+		number, err := r.enumNumber(field.typeName, value)
+		if err != nil {
+			return nil, err
+		}
+		return appendProtoVarint(appendProtoTag(b, field.number, protoWireVarint), uint64(int64(number))), nil
+
+	case protoTypeDouble:
+		f, err := protoFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		b = appendProtoTag(b, field.number, protoWireFixed64)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), nil
+
+	case protoTypeFloat:
+		f, err := protoFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		b = appendProtoTag(b, field.number, protoWireFixed32)
+		return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(f))), nil
+
+	case protoTypeInt32, protoTypeInt64, protoTypeSint32, protoTypeSint64, protoTypeSfixed32, protoTypeSfixed64:
+		bits := 64
+		if field.typ == protoTypeInt32 || field.typ == protoTypeSint32 || field.typ == protoTypeSfixed32 {
+			bits = 32
+		}
+		n, err := protoInt(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch field.typ {
+		case protoTypeSint32, protoTypeSint64:
+			return appendProtoVarint(appendProtoTag(b, field.number, protoWireVarint), uint64(n<<1)^uint64(n>>63)), nil
+		case protoTypeSfixed32:
+			return binary.LittleEndian.AppendUint32(appendProtoTag(b, field.number, protoWireFixed32), uint32(int32(n))), nil
+		case protoTypeSfixed64:
+			return binary.LittleEndian.AppendUint64(appendProtoTag(b, field.number, protoWireFixed64), uint64(n)), nil
+		}
+		return appendProtoVarint(appendProtoTag(b, field.number, protoWireVarint), uint64(n)), nil
+
+	case protoTypeUint32, protoTypeUint64, protoTypeFixed32, protoTypeFixed64:
+		bits := 64
+		if field.typ == protoTypeUint32 || field.typ == protoTypeFixed32 {
+			bits = 32
+		}
+		n, err := protoUint(value, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch field.typ {
+		case protoTypeFixed32:
+			return binary.LittleEndian.AppendUint32(appendProtoTag(b, field.number, protoWireFixed32), uint32(n)), nil
+		case protoTypeFixed64:
+			return binary.LittleEndian.AppendUint64(appendProtoTag(b, field.number, protoWireFixed64), n), nil
+		}
+		return appendProtoVarint(appendProtoTag(b, field.number, protoWireVarint), n), nil
+	}
+	return nil, fmt.Errorf("不支持的字段类型 %d", field.typ)
+}
+
+// enumNumber 将枚举名称或编号转换为编号
+func (r *protoRegistry) enumNumber(name string, value interface{}) (int32, error) {
+	switch v := value.(type) {
+	case string:
+		if enum, ok := r.enums[name]; ok {
+			for _, enumValue := range enum.values {
+				if enumValue.name == v {
+					return enumValue.number, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("%s 没有枚举值 %s", name, v)
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt32 || v > math.MaxInt32 {
+			return 0, errors.New("枚举编号必须是32位整数")
+		}
+		return int32(v), nil
+	}
+	return 0, errors.New("需要枚举名称或编号")
+}
+
+// protoFloat 读取数字或字符串形式的数字
+func protoFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, errors.New("需要数字")
+		}
+		return f, nil
+	}
+	return 0, errors.New("需要数字")
+}
+
+// protoInt 读取有符号整数，64位整数也可以写成字符串以避免精度损失
+func protoInt(value interface{}, bits int) (int64, error) {
+	var n int64
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, errors.New("需要整数")
+		}
+		n = int64(v)
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errors.New("需要整数")
+		}
+		n = parsed
+	default:
+		return 0, errors.New("需要整数")
+	}
+	if bits == 32 && (n < math.MinInt32 || n > math.MaxInt32) {
+		return 0, errors.New("超出32位整数范围")
+	}
+	return n, nil
+}
+
+// protoUint 读取无符号整数
+func protoUint(value interface{}, bits int) (uint64, error) {
+	var n uint64
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+			return 0, errors.New("需要非负整数")
+		}
+		n = uint64(v)
+	case string:
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, errors.New("需要非负整数")
+		}
+		n = parsed
+	default:
+		return 0, errors.New("需要非负整数")
+	}
+	if bits == 32 && n > math.MaxUint32 {
+		return 0, errors.New("超出32位整数范围")
+	}
+	return n, nil
+}
+
+// decodeMessage 将protobuf消息解码为JSON对象，字段名使用proto中的名称，未知字段忽略
+func (r *protoRegistry) decodeMessage(name string, data []byte) (map[string]interface{}, error) {
+	message, ok := r.messages[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的消息类型: %s", name)
+	}
+	byNumber := make(map[int]*protoField, len(message.fields))
+	for _, field := range message.fields {
+		byNumber[field.number] = field
+	}
+
+	wireFields, err := parseProtoFields(data)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	for _, wf := range wireFields {
+		field, ok := byNumber[wf.number]
+		if !ok {
+			continue
+		}
+		if field.label != protoLabelRepeated {
+			value, err := r.decodeValue(field, wf)
+			if err != nil {
+				return nil, fmt.Errorf("字段 %s: %w", field.name, err)
+			}
+			result[field.name] = value
+			continue
+		}
+
+		if entry, ok := r.messages[field.typeName]; ok && entry.mapEntry && len(entry.fields) == 2 {
+			decoded, err := r.decodeMessage(entry.fullName, wf.bytes)
+			if err != nil {
+				return nil, fmt.Errorf("字段 %s: %w", field.name, err)
+			}
+			object, _ := result[field.name].(map[string]interface{})
+			if object == nil {
+				object = make(map[string]interface{})
+				result[field.name] = object
+			}
+			object[fmt.Sprint(decoded[entry.fields[0].name])] = decoded[entry.fields[1].name]
+			continue
+		}
+
+		list, _ := result[field.name].([]interface{})
+		values, err := r.decodeRepeated(field, wf)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %w", field.name, err)
+		}
+		result[field.name] = append(list, values...)
+	}
+	return result, nil
+}
+
+// decodeRepeated 解码重复字段的一个或多个值，数字类型可能使用packed编码
+func (r *protoRegistry) decodeRepeated(field *protoField, wf protoWireField) ([]interface{}, error) {
+	packable := field.typ != protoTypeString && field.typ != protoTypeBytes && field.typ != protoTypeMessage
+	if !packable || wf.wireType != protoWireBytes {
+		value, err := r.decodeValue(field, wf)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+
+	var values []interface{}
+	data := wf.bytes
+	for len(data) > 0 {
+		item := protoWireField{number: wf.number}
+		switch field.typ {
+		case protoTypeDouble, protoTypeFixed64, protoTypeSfixed64:
+			if len(data) < 8 {
+				return nil, errors.New("packed字段长度错误")
+			}
+			item.wireType, item.varint = protoWireFixed64, binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case protoTypeFloat, protoTypeFixed32, protoTypeSfixed32:
+			if len(data) < 4 {
+				return nil, errors.New("packed字段长度错误")
+			}
+			item.wireType, item.varint = protoWireFixed32, uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errors.New("packed字段格式错误")
+			}
+			item.wireType, item.varint = protoWireVarint, v
+			data = data[n:]
+		}
+		value, err := r.decodeValue(field, item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// decodeValue 解码字段的单个值
+func (r *protoRegistry) decodeValue(field *protoField, wf protoWireField) (interface{}, error) {
+	switch field.typ {
+	case protoTypeString:
+		return string(wf.bytes), nil
+	case protoTypeBytes:
+		return base64.StdEncoding.EncodeToString(wf.bytes), nil
+	case protoTypeMessage:
+		return r.decodeMessage(field.typeName, wf.bytes)
+	case protoTypeBool:
+		return wf.varint != 0, nil
+	case protoTypeEnum:
+		number := int32(wf.varint)
+		if enum, ok := r.enums[field.typeName]; ok {
+			for _, value := range enum.values {
+				if value.number == number {
+					return value.name, nil
+				}
+			}
+		}
+		return number, nil
+	case protoTypeDouble:
+		return protoJSONFloat(math.Float64frombits(wf.varint)), nil
+	case protoTypeFloat:
+		return protoJSONFloat(float64(math.Float32frombits(uint32(wf.varint)))), nil
+	case protoTypeInt32, protoTypeSfixed32:
+		return int32(wf.varint), nil
+	case protoTypeInt64, protoTypeSfixed64:
+		return int64(wf.varint), nil
+	case protoTypeSint32, protoTypeSint64:
+		return int64(wf.varint>>1) ^ -int64(wf.varint&1), nil
+	case protoTypeUint32, protoTypeFixed32:
+		return uint32(wf.varint), nil
+	case protoTypeUint64, protoTypeFixed64:
+		return wf.varint, nil
+	}
+	return nil, fmt.Errorf("不支持的字段类型 %d", field.typ)
+}
+
+// protoJSONFloat JSON无法表示NaN和无穷大，按proto3 JSON映射转换为字符串
+func protoJSONFloat(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return f
+}
@@ -0,0 +1,202 @@
+package ConversationManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ReAct协议中的字段
+const (
+	reactThought     = "Thought:"
+	reactAction      = "Action:"
+	reactActionInput = "Action Input:"
+	reactObservation = "Observation:"
+	reactFinalAnswer = "Final Answer:"
+)
+
+// reactFencePattern 匹配包裹Action Input的markdown代码块
+var reactFencePattern = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+
+// SetReActMode 设置是否使用ReAct（Thought/Action/Observation）文本协议代替原生函数调用
+// 开启后不发送工具定义，而是在系统提示词中描述已注册的工具，从回复文本中解析Action并以Observation返回结果，
+// 适用于使用ReAct协议效果更好的模型。Thought写入消息的ReasoningContent，Final Answer作为回复文本
+func (cm *ConversationManager) SetReActMode(enable bool) {
+	cm.reactMode = enable
+}
+
+// applyReAct 将请求转换为ReAct协议：工具写入系统提示词，历史中的工具调用和结果转换为Action和Observation文本
+// 协议的关键字不随语言变化，只有说明文字使用locale
+func applyReAct(req *general.ChatRequest, locale Locale) {
+	if req.SystemPrompt != "" {
+		req.SystemPrompt += "\n\n"
+	}
+	req.SystemPrompt += reactPrompt(req.Tools, locale)
+	req.Tools = nil
+
+	messages := make([]general.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == general.RoleAssistant && len(msg.ToolCalls) > 0:
+			var b strings.Builder
+			thought := strings.TrimSpace(msg.ReasoningContent)
+			if thought == "" {
+				thought = strings.TrimSpace(messageText(msg))
+			}
+			if thought != "" {
+				fmt.Fprintf(&b, "%s %s\n", reactThought, thought)
+			}
+			for _, toolCall := range msg.ToolCalls {
+				fmt.Fprintf(&b, "%s %s\n%s %s\n", reactAction, toolCall.Function.Name, reactActionInput, string(toolCall.Function.Arguments))
+			}
+			messages = append(messages, general.Message{
+				Role:    general.RoleAssistant,
+				Content: []general.Content{{Type: general.ContentTypeText, Text: strings.TrimSpace(b.String())}},
+			})
+
+		case msg.Role == general.RoleTool:
+			// 连续的工具结果合并为一条用户消息
+			var parts []string
+			for _, content := range msg.Content {
+				parts = append(parts, reactObservation+" "+content.Text)
+			}
+			text := strings.Join(parts, "\n")
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == general.RoleUser && strings.HasPrefix(messageText(messages[last]), reactObservation) {
+				messages[last].Content = []general.Content{{Type: general.ContentTypeText, Text: messageText(messages[last]) + "\n" + text}}
+				continue
+			}
+			messages = append(messages, general.Message{
+				Role:    general.RoleUser,
+				Content: []general.Content{{Type: general.ContentTypeText, Text: text}},
+			})
+
+		default:
+			messages = append(messages, msg)
+		}
+	}
+	req.Messages = messages
+}
+
+// reactPrompt 生成描述ReAct协议和可用工具的系统提示词
+func reactPrompt(tools []general.Tool, locale Locale) string {
+	var b strings.Builder
+	b.WriteString(Localize(locale, MsgReActIntro))
+	if len(tools) > 0 {
+		b.WriteString(Localize(locale, MsgReActTools))
+		for _, tool := range tools {
+			parameters, _ := json.Marshal(tool.Function.Parameters)
+			b.WriteString(Localize(locale, MsgReActToolLine, tool.Function.Name, tool.Function.Description, string(parameters)))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(reactThought + Localize(locale, MsgReActThought))
+	if len(tools) > 0 {
+		b.WriteString(reactAction + Localize(locale, MsgReActAction))
+		b.WriteString(reactActionInput + Localize(locale, MsgReActActionInput))
+		b.WriteString(reactObservation + Localize(locale, MsgReActObservation))
+		b.WriteString(Localize(locale, MsgReActRepeat))
+		b.WriteString(reactThought + Localize(locale, MsgReActDone))
+	}
+	b.WriteString(reactFinalAnswer + Localize(locale, MsgReActFinalAnswer))
+	return b.String()
+}
+
+// parseReAct 解析ReAct格式的回复：Action转换为工具调用，Final Answer作为回复文本，Thought写入ReasoningContent
+// 回复中既没有Action也没有Final Answer时，整个回复作为最终回答
+func parseReAct(choice general.Choice, tools []general.Tool) general.Choice {
+	msg := choice.Message
+	text := strings.TrimSpace(messageText(msg))
+	// 模型自己编写的Observation及之后的内容丢弃
+	if index := strings.Index(text, "\n"+reactObservation); index >= 0 {
+		text = strings.TrimSpace(text[:index])
+	}
+
+	actionIndex := strings.Index(text, reactAction)
+	answerIndex := strings.Index(text, reactFinalAnswer)
+	var thought, answer string
+	var toolCall *general.ToolCall
+	switch {
+	case actionIndex >= 0 && (answerIndex < 0 || actionIndex < answerIndex):
+		thought = text[:actionIndex]
+		toolCall = parseReActAction(text[actionIndex:], tools)
+		if toolCall == nil {
+			answer = text
+		}
+	case answerIndex >= 0:
+		thought = text[:answerIndex]
+		answer = strings.TrimSpace(text[answerIndex+len(reactFinalAnswer):])
+	default:
+		answer = text
+	}
+	if thought = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(thought), reactThought)); thought != "" {
+		msg.ReasoningContent = thought
+	}
+
+	// 保留文本之外的内容（如音频）
+	content := make([]general.Content, 0, len(msg.Content))
+	for _, item := range msg.Content {
+		if item.Type != general.ContentTypeText {
+			content = append(content, item)
+		}
+	}
+	if toolCall != nil {
+		msg.ToolCalls = append(msg.ToolCalls, *toolCall)
+		choice.NormalizedFinishReason = general.FinishReasonToolCalls
+	} else if answer != "" {
+		content = append(content, general.Content{Type: general.ContentTypeText, Text: answer})
+	}
+	msg.Content = content
+	choice.Message = msg
+	return choice
+}
+
+// parseReActAction 解析Action和Action Input，Action Input不是JSON对象且工具只有一个参数时作为该参数的值
+func parseReActAction(text string, tools []general.Tool) *general.ToolCall {
+	rest := strings.TrimPrefix(text, reactAction)
+	name, input, _ := strings.Cut(rest, reactActionInput)
+	name = strings.TrimSpace(name)
+	if line, _, ok := strings.Cut(name, "\n"); ok {
+		name = strings.TrimSpace(line)
+	}
+	if name == "" {
+		return nil
+	}
+
+	input = strings.TrimSpace(input)
+	if match := reactFencePattern.FindStringSubmatch(input); match != nil {
+		input = match[1]
+	}
+	arguments := json.RawMessage("{}")
+	var object map[string]interface{}
+	switch {
+	case input == "":
+	case json.Unmarshal([]byte(input), &object) == nil:
+		arguments = json.RawMessage(input)
+	default:
+		arguments, _ = json.Marshal(map[string]string{reactSingleParameter(name, tools): input})
+	}
+	return &general.ToolCall{
+		ID:       "call_" + newSessionID(),
+		Type:     "function",
+		Function: general.FunctionCall{Name: name, Arguments: arguments},
+	}
+}
+
+// reactSingleParameter 获取只有一个参数的工具的参数名，否则返回input
+func reactSingleParameter(name string, tools []general.Tool) string {
+	for _, tool := range tools {
+		if tool.Function.Name != name {
+			continue
+		}
+		properties, _ := tool.Function.Parameters["properties"].(map[string]interface{})
+		if len(properties) == 1 {
+			for parameter := range properties {
+				return parameter
+			}
+		}
+	}
+	return "input"
+}
@@ -0,0 +1,23 @@
+package ConversationManager
+
+import (
+	"context"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// SetToolErrorRecovery 设置工具调用失败时是否继续对话
+// 开启后失败的工具调用（如ask_user提问失败）以错误结果返回给模型，由模型决定如何处理，已完成的工具调用不会丢失；
+// 只有请求模型失败或上下文被取消时才中止对话并回滚历史
+func (cm *ConversationManager) SetToolErrorRecovery(enable bool) {
+	cm.RecoverToolErrors = enable
+}
+
+// recoverToolError 开启RecoverToolErrors时将工具调用的错误记录为工具结果，返回false表示需要中止对话
+func (cm *ConversationManager) recoverToolError(ctx context.Context, toolCall general.ToolCall, err error, info_chan chan general.Message) bool {
+	if !cm.RecoverToolErrors || ctx.Err() != nil {
+		return false
+	}
+	cm.appendToolResult(ctx, toolCall, cm.text(MsgToolCallFailed, err), info_chan)
+	return true
+}
@@ -0,0 +1,188 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ReplayTurn 回放中的一轮对话
+type ReplayTurn struct {
+	UserMessage  general.Message    // 记录中的用户消息，回放时原样发送
+	Original     []general.Message  // 记录中本轮模型和工具产生的消息
+	Replayed     []general.Message  // 回放时本轮模型和工具产生的消息，失败时为空
+	StopReason   general.StopReason // 回放的结束原因
+	Err          error              // 回放本轮时的错误，不影响之后的轮次
+	Usage        general.Usage      // 回放本轮使用的token
+	Cost         float64            // 回放本轮的费用，按预算中设置的模型价格计算
+	MissingTools []general.ToolCall // 回放时模型发起的、记录中没有对应结果的工具调用
+}
+
+// ReplayResult 回放的结果
+type ReplayResult struct {
+	Provider   general.Provider
+	Model      string
+	Turns      []ReplayTurn
+	Transcript []general.Message // 回放得到的完整历史
+	Usage      general.Usage     // 回放使用的token总量
+	Cost       float64           // 回放的总费用
+}
+
+// replayRecording 记录中的工具结果，回放时代替真实的工具调用
+type replayRecording struct {
+	results []recordedToolResult
+	missing []general.ToolCall // 当前轮次中没有找到记录的工具调用
+}
+
+// recordedToolResult 记录中的一个工具调用及其结果
+type recordedToolResult struct {
+	name      string
+	arguments string // 规范化后的参数JSON
+	result    string
+	used      bool
+}
+
+// Replay 用指定的提供商和模型（可以与录制时不同）重新执行保存的对话记录，用于比较不同模型或提示词版本的行为
+// 记录中的每条用户消息依次作为一轮对话发送，模型发起的工具调用不会真正执行，而是使用记录中的结果：
+// 优先匹配工具名和参数都相同的调用，其次按顺序使用同名工具尚未使用的结果，都没有时告诉模型结果不可用并记入MissingTools
+// 回放使用当前会话的系统提示词、工具定义和其他设置，期间不保存检查点、不写审计日志，结束后恢复原来的历史记录，不能与Chat同时调用
+func (cm *ConversationManager) Replay(ctx context.Context, provider general.Provider, model string, transcript []general.Message) (*ReplayResult, error) {
+	turns := splitReplayTurns(transcript)
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("对话记录中没有用户消息")
+	}
+	if cm.replay != nil {
+		return nil, fmt.Errorf("已有进行中的回放")
+	}
+
+	// 回放的消息不是真实发生的对话，不保存检查点，也不写入审计日志和历史日志
+	previousHistory, previousTurn, previousProvider := cm.history, cm.turn, cm.provider
+	checkpointSaver, auditLog, journal := cm.checkpointSaver, cm.auditLog, cm.journal
+	cm.history = make([]general.Message, 0, len(transcript))
+	cm.checkpointSaver, cm.auditLog, cm.journal = nil, nil, nil
+	cm.replay = newReplayRecording(transcript)
+	defer func() {
+		cm.history, cm.turn, cm.provider = previousHistory, previousTurn, previousProvider
+		cm.checkpointSaver, cm.auditLog, cm.journal = checkpointSaver, auditLog, journal
+		cm.replay = nil
+	}()
+
+	result := &ReplayResult{Provider: provider, Model: model}
+	for i := range turns {
+		turn := &turns[i]
+		if err := ctx.Err(); err != nil {
+			turn.Err = err
+			result.Turns = append(result.Turns, *turn)
+			continue
+		}
+		reported := cm.runLog.turnCount()
+		cm.replay.missing = nil
+		messages, stopReason, err, _ := cm.chat(ctx, provider, model, turn.UserMessage, nil)
+		turn.StopReason, turn.Err = stopReason, err
+		if err == nil && len(messages) > 0 {
+			turn.Replayed = append([]general.Message(nil), messages[1:]...)
+		}
+		if report, ok := cm.runLog.turnAt(reported); ok {
+			turn.Usage, turn.Cost = report.Usage, report.Cost
+		}
+		turn.MissingTools = cm.replay.missing
+		result.Usage.Add(turn.Usage)
+		result.Cost += turn.Cost
+		result.Turns = append(result.Turns, *turn)
+	}
+	result.Transcript = append([]general.Message(nil), cm.history...)
+	return result, nil
+}
+
+// splitReplayTurns 将对话记录按用户消息拆分为轮次
+// 紧跟在工具结果之后的用户消息（如截图）属于同一轮的工具循环，不作为新的一轮
+func splitReplayTurns(transcript []general.Message) []ReplayTurn {
+	var turns []ReplayTurn
+	var previous *general.Message
+	for i := range transcript {
+		message := transcript[i]
+		if message.Role == general.RoleSystem {
+			continue
+		}
+		startsTurn := message.Role == general.RoleUser && (previous == nil || previous.Role != general.RoleTool)
+		previous = &transcript[i]
+		if startsTurn {
+			turns = append(turns, ReplayTurn{UserMessage: message})
+			continue
+		}
+		if len(turns) > 0 {
+			turns[len(turns)-1].Original = append(turns[len(turns)-1].Original, message)
+		}
+	}
+	return turns
+}
+
+// newReplayRecording 收集对话记录中的工具调用结果
+func newReplayRecording(transcript []general.Message) *replayRecording {
+	calls := make(map[string]general.ToolCall)
+	recording := &replayRecording{}
+	for _, message := range transcript {
+		for _, call := range message.ToolCalls {
+			calls[call.ID] = call
+		}
+		if message.Role != general.RoleTool {
+			continue
+		}
+		for _, content := range message.Content {
+			if content.Type != general.ContentTypeToolRes {
+				continue
+			}
+			call, ok := calls[content.ToolID]
+			if !ok {
+				continue
+			}
+			recording.results = append(recording.results, recordedToolResult{
+				name:      call.Function.Name,
+				arguments: canonicalArguments(call.Function.Arguments),
+				result:    content.Text,
+			})
+		}
+	}
+	return recording
+}
+
+// result 返回工具调用在记录中的结果
+func (r *replayRecording) result(toolCall general.ToolCall) (string, bool) {
+	arguments := canonicalArguments(toolCall.Function.Arguments)
+	for _, exact := range []bool{true, false} {
+		for i := range r.results {
+			recorded := &r.results[i]
+			if recorded.used || recorded.name != toolCall.Function.Name || (exact && recorded.arguments != arguments) {
+				continue
+			}
+			recorded.used = true
+			return recorded.result, true
+		}
+	}
+	r.missing = append(r.missing, toolCall)
+	return "", false
+}
+
+// replayToolCall 回放时以记录中的结果代替工具调用
+func (cm *ConversationManager) replayToolCall(ctx context.Context, toolCall general.ToolCall, info_chan chan general.Message) {
+	result, ok := cm.replay.result(toolCall)
+	if !ok {
+		result = cm.text(MsgReplayResultUnavailable, toolCall.Function.Name)
+	}
+	cm.appendToolResult(ctx, toolCall, result, info_chan)
+}
+
+// canonicalArguments 将参数JSON规范化（对象的键排序、去除空白），用于比较两次调用的参数是否相同
+func canonicalArguments(arguments json.RawMessage) string {
+	var value interface{}
+	if err := json.Unmarshal(normalizeArguments(arguments), &value); err != nil {
+		return string(arguments)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return string(arguments)
+	}
+	return string(data)
+}
@@ -0,0 +1,325 @@
+package ConversationManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// RunReport 会话的运行报告，用于事后分析智能体的行为
+type RunReport struct {
+	SessionID   string            `json:"session_id"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	Turns       []TurnReport      `json:"turns"`
+	Usage       general.Usage     `json:"usage"`
+	Cost        float64           `json:"cost"` // 按预算中设置的模型价格计算，未设置价格的模型按0计算
+	Requests    int               `json:"requests"`
+	ToolCalls   int               `json:"tool_calls"`
+	Tools       []ToolStats       `json:"tools,omitempty"` // 按调用次数从多到少排列
+	Truncations []TruncationEvent `json:"truncations,omitempty"`
+	Errors      []string          `json:"errors,omitempty"`
+}
+
+// TurnReport 一次Chat调用（或从检查点恢复）的统计
+type TurnReport struct {
+	Turn       int                `json:"turn"`
+	Start      time.Time          `json:"start"`
+	LatencyMS  int64              `json:"latency_ms"`
+	Provider   general.Provider   `json:"provider"`
+	Model      string             `json:"model"`
+	Requests   []RequestReport    `json:"requests"`
+	ToolCalls  []ToolCallReport   `json:"tool_calls,omitempty"`
+	Usage      general.Usage      `json:"usage"`
+	Cost       float64            `json:"cost"`
+	StopReason general.StopReason `json:"stop_reason"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// RequestReport 一次模型请求的统计
+type RequestReport struct {
+	Provider  general.Provider `json:"provider"`
+	Model     string           `json:"model"`
+	LatencyMS int64            `json:"latency_ms"`
+	Usage     general.Usage    `json:"usage"`
+}
+
+// ToolCallReport 一次工具调用的统计
+type ToolCallReport struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ToolStats 按工具汇总的调用统计
+type ToolStats struct {
+	Name           string `json:"name"`
+	Calls          int    `json:"calls"`
+	Errors         int    `json:"errors"`
+	TotalLatencyMS int64  `json:"total_latency_ms"`
+}
+
+// TruncationEvent 一次实际丢弃了消息的历史截断
+type TruncationEvent struct {
+	Turn            int              `json:"turn"` // 截断发生在第几次Chat调用开始时
+	Time            time.Time        `json:"time"`
+	Reason          TruncationReason `json:"reason"`
+	TokensBefore    int              `json:"tokens_before"`
+	TokensAfter     int              `json:"tokens_after"`
+	DroppedMessages int              `json:"dropped_messages"`
+}
+
+// runLog 会话的运行记录
+type runLog struct {
+	mu          sync.Mutex
+	start       time.Time
+	turns       []TurnReport
+	truncations []TruncationEvent
+	current     int               // 进行中的对话在turns中的索引，没有时为-1
+	failures    map[string]string // 工具调用ID到函数返回的错误，这些错误作为工具结果返回给模型，不会中止对话
+}
+
+func newRunLog() *runLog {
+	return &runLog{start: time.Now(), current: -1}
+}
+
+// GenerateRunReport 生成会话的运行报告：每次对话的轮次、使用的工具、token、费用、延迟、截断和错误
+func (cm *ConversationManager) GenerateRunReport() *RunReport {
+	l := cm.runLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := &RunReport{SessionID: cm.sessionID, Start: l.start, End: time.Now()}
+	report.Turns = make([]TurnReport, len(l.turns))
+	tools := make(map[string]*ToolStats)
+	for i, turn := range l.turns {
+		turn.Requests = append([]RequestReport(nil), turn.Requests...)
+		turn.ToolCalls = append([]ToolCallReport(nil), turn.ToolCalls...)
+		report.Turns[i] = turn
+
+		report.Usage.Add(turn.Usage)
+		report.Cost += turn.Cost
+		report.Requests += len(turn.Requests)
+		report.ToolCalls += len(turn.ToolCalls)
+		for _, call := range turn.ToolCalls {
+			stats := tools[call.Name]
+			if stats == nil {
+				stats = &ToolStats{Name: call.Name}
+				tools[call.Name] = stats
+			}
+			stats.Calls++
+			stats.TotalLatencyMS += call.LatencyMS
+			if call.Error != "" {
+				stats.Errors++
+				report.Errors = append(report.Errors, fmt.Sprintf("第%d轮 工具 %s: %s", turn.Turn, call.Name, call.Error))
+			}
+		}
+		if turn.Error != "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("第%d轮: %s", turn.Turn, turn.Error))
+		}
+	}
+	for _, stats := range tools {
+		report.Tools = append(report.Tools, *stats)
+	}
+	sort.Slice(report.Tools, func(i, j int) bool {
+		if report.Tools[i].Calls != report.Tools[j].Calls {
+			return report.Tools[i].Calls > report.Tools[j].Calls
+		}
+		return report.Tools[i].Name < report.Tools[j].Name
+	})
+	report.Truncations = append([]TruncationEvent(nil), l.truncations...)
+	return report
+}
+
+// ResetRunReport 清空运行记录，之后的报告从现在开始统计
+func (cm *ConversationManager) ResetRunReport() {
+	l := cm.runLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.start = time.Now()
+	l.turns = nil
+	l.truncations = nil
+	l.current = -1
+	l.failures = nil
+}
+
+// JSON 以缩进的JSON格式输出报告
+func (r *RunReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Markdown 以Markdown格式输出报告
+func (r *RunReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# 运行报告 %s\n\n", r.SessionID)
+	fmt.Fprintf(&b, "- 时间: %s - %s\n", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- 对话: %d 轮，模型请求 %d 次，工具调用 %d 次\n", len(r.Turns), r.Requests, r.ToolCalls)
+	fmt.Fprintf(&b, "- Token: 输入 %d，输出 %d，合计 %d\n", r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens)
+	fmt.Fprintf(&b, "- 费用: %.6f\n", r.Cost)
+
+	if len(r.Turns) > 0 {
+		b.WriteString("\n## 对话\n\n")
+		b.WriteString("| 轮次 | 模型 | 请求 | 工具调用 | Token | 费用 | 延迟(ms) | 结束原因 |\n")
+		b.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- |\n")
+		for _, turn := range r.Turns {
+			fmt.Fprintf(&b, "| %d | %s/%s | %d | %d | %d | %.6f | %d | %s |\n",
+				turn.Turn, turn.Provider, turn.Model, len(turn.Requests), len(turn.ToolCalls),
+				turn.Usage.TotalTokens, turn.Cost, turn.LatencyMS, turn.StopReason)
+		}
+	}
+	if len(r.Tools) > 0 {
+		b.WriteString("\n## 工具\n\n")
+		b.WriteString("| 工具 | 调用 | 失败 | 平均延迟(ms) |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, tool := range r.Tools {
+			fmt.Fprintf(&b, "| %s | %d | %d | %d |\n", tool.Name, tool.Calls, tool.Errors, tool.TotalLatencyMS/int64(tool.Calls))
+		}
+	}
+	if len(r.Truncations) > 0 {
+		b.WriteString("\n## 历史截断\n\n")
+		for _, event := range r.Truncations {
+			fmt.Fprintf(&b, "- 第%d轮: %s，丢弃 %d 条消息，token %d -> %d\n",
+				event.Turn, event.Reason, event.DroppedMessages, event.TokensBefore, event.TokensAfter)
+		}
+	}
+	if len(r.Errors) > 0 {
+		b.WriteString("\n## 错误\n\n")
+		for _, err := range r.Errors {
+			fmt.Fprintf(&b, "- %s\n", strings.ReplaceAll(err, "\n", " "))
+		}
+	}
+	return b.String()
+}
+
+// beginTurn 开始记录一次对话
+func (l *runLog) beginTurn(turn int, provider general.Provider, model string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.turns = append(l.turns, TurnReport{Turn: turn, Start: time.Now(), Provider: provider, Model: model})
+	l.current = len(l.turns) - 1
+}
+
+// endTurn 结束记录进行中的对话
+func (l *runLog) endTurn(stopReason general.StopReason, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current < 0 {
+		return
+	}
+	turn := &l.turns[l.current]
+	turn.LatencyMS = time.Since(turn.Start).Milliseconds()
+	turn.StopReason = stopReason
+	if err != nil {
+		turn.Error = err.Error()
+	}
+	l.current = -1
+	l.failures = nil
+}
+
+// lastTurnUsage 返回最近一次对话的使用量
+func (l *runLog) lastTurnUsage() general.Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.turns) == 0 {
+		return general.Usage{}
+	}
+	return l.turns[len(l.turns)-1].Usage
+}
+
+// turnCount 返回已记录的对话数
+func (l *runLog) turnCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.turns)
+}
+
+// turnAt 返回第i次对话的记录，不存在时返回false
+func (l *runLog) turnAt(i int) (TurnReport, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i < 0 || i >= len(l.turns) {
+		return TurnReport{}, false
+	}
+	return l.turns[i], true
+}
+
+// request 记录一次模型请求，cost为按预算价格计算的费用
+func (l *runLog) request(provider general.Provider, model string, latency time.Duration, usage general.Usage, cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current < 0 {
+		return
+	}
+	turn := &l.turns[l.current]
+	turn.Requests = append(turn.Requests, RequestReport{Provider: provider, Model: model, LatencyMS: latency.Milliseconds(), Usage: usage})
+	turn.Usage.Add(usage)
+	turn.Cost += cost
+}
+
+// toolFailed 记录函数返回的错误，在toolCall时计入该工具调用
+func (l *runLog) toolFailed(id string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current < 0 {
+		return
+	}
+	if l.failures == nil {
+		l.failures = make(map[string]string)
+	}
+	l.failures[id] = err.Error()
+}
+
+// toolFailure 返回函数返回的错误，没有时为空
+func (l *runLog) toolFailure(id string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failures[id]
+}
+
+// toolCall 记录一次工具调用，err为HandleToolCall返回的错误
+func (l *runLog) toolCall(toolCall general.ToolCall, latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current < 0 {
+		return
+	}
+	call := ToolCallReport{ID: toolCall.ID, Name: toolCall.Function.Name, LatencyMS: latency.Milliseconds()}
+	if err != nil {
+		call.Error = err.Error()
+	} else if failure, ok := l.failures[toolCall.ID]; ok {
+		call.Error = failure
+	}
+	delete(l.failures, toolCall.ID)
+	turn := &l.turns[l.current]
+	turn.ToolCalls = append(turn.ToolCalls, call)
+}
+
+// truncation 记录一次实际丢弃了消息的历史截断
+func (l *runLog) truncation(turn int, report TruncationReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.truncations = append(l.truncations, TruncationEvent{
+		Turn:            turn,
+		Time:            time.Now(),
+		Reason:          report.Reason,
+		TokensBefore:    report.TokensBefore,
+		TokensAfter:     report.TokensAfter,
+		DroppedMessages: report.DroppedMessages,
+	})
+}
+
+// requestCost 按第一个设置了该模型价格的预算计算一次请求的费用
+func (cm *ConversationManager) requestCost(model string, usage general.Usage) float64 {
+	for _, budget := range cm.budgets {
+		if price, ok := budget.price(model); ok {
+			return price.cost(usage)
+		}
+	}
+	return 0
+}
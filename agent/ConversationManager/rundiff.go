@@ -0,0 +1,290 @@
+package ConversationManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// Run 用于比较的一次运行
+type Run struct {
+	Name       string
+	Transcript []general.Message // 对话记录，如GetHistory的返回值
+	// Report 运行报告，提供token和费用，可以为nil
+	// 报告中的对话数与记录中的轮数相同时逐轮比较token和费用，否则只比较总量
+	Report *RunReport
+}
+
+// ToolCallChange 工具调用在两次运行之间的变化
+type ToolCallChange string
+
+const (
+	ToolCallSame    ToolCallChange = "same"    // 两次运行中工具名和参数都相同
+	ToolCallChanged ToolCallChange = "changed" // 调用了同一个工具但参数不同
+	ToolCallAdded   ToolCallChange = "added"   // 只在第二次运行中调用
+	ToolCallRemoved ToolCallChange = "removed" // 只在第一次运行中调用
+)
+
+// ToolCallDiff 一个工具调用的比较结果
+type ToolCallDiff struct {
+	Change     ToolCallChange  `json:"change"`
+	Name       string          `json:"name"`
+	ArgumentsA json.RawMessage `json:"arguments_a,omitempty"`
+	ArgumentsB json.RawMessage `json:"arguments_b,omitempty"`
+}
+
+// UsageDelta 两次运行的token和费用，差值为B减A
+type UsageDelta struct {
+	A                general.Usage `json:"a"`
+	B                general.Usage `json:"b"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	TotalTokens      int           `json:"total_tokens"`
+	CostA            float64       `json:"cost_a"`
+	CostB            float64       `json:"cost_b"`
+	Cost             float64       `json:"cost"`
+}
+
+// TurnDiff 一轮对话的比较结果
+type TurnDiff struct {
+	Turn          int            `json:"turn"` // 从1开始
+	UserMessage   string         `json:"user_message"`
+	UserChanged   bool           `json:"user_changed,omitempty"` // 两次运行的用户消息不同
+	OnlyIn        string         `json:"only_in,omitempty"`      // 只存在于一次运行中时为该运行的名称
+	AnswerA       string         `json:"answer_a"`
+	AnswerB       string         `json:"answer_b"`
+	AnswerChanged bool           `json:"answer_changed"`
+	ToolCalls     []ToolCallDiff `json:"tool_calls,omitempty"`
+	Diverged      bool           `json:"diverged"` // 回答或工具调用不同
+	Usage         *UsageDelta    `json:"usage,omitempty"`
+}
+
+// RunDiff 两次运行的结构化比较结果，用于验证提示词或提供商的修改
+type RunDiff struct {
+	A              string     `json:"a"`
+	B              string     `json:"b"`
+	Turns          []TurnDiff `json:"turns"`
+	DivergentTurns []int      `json:"divergent_turns,omitempty"` // 出现分歧的轮次（从1开始）
+	Usage          UsageDelta `json:"usage"`
+}
+
+// CompareRuns 逐轮比较两次运行：最终回答、工具调用，以及token和费用的差异
+// 轮次按用户消息划分并按顺序对齐，工具调用先匹配工具名和参数都相同的调用，再按顺序匹配同名工具的调用
+func CompareRuns(a, b Run) *RunDiff {
+	if a.Name == "" {
+		a.Name = "A"
+	}
+	if b.Name == "" {
+		b.Name = "B"
+	}
+	diff := &RunDiff{A: a.Name, B: b.Name}
+	turnsA, turnsB := splitReplayTurns(a.Transcript), splitReplayTurns(b.Transcript)
+	reportsA, reportsB := alignedTurnReports(a.Report, len(turnsA)), alignedTurnReports(b.Report, len(turnsB))
+
+	for i := 0; i < len(turnsA) || i < len(turnsB); i++ {
+		turn := TurnDiff{Turn: i + 1}
+		var callsA, callsB []general.ToolCall
+		if i < len(turnsA) {
+			turn.UserMessage = messageText(turnsA[i].UserMessage)
+			turn.AnswerA = finalAnswer(turnsA[i].Original)
+			callsA = turnToolCalls(turnsA[i].Original)
+		} else {
+			turn.OnlyIn = b.Name
+		}
+		if i < len(turnsB) {
+			user := messageText(turnsB[i].UserMessage)
+			if turn.OnlyIn == "" && i < len(turnsA) && user != turn.UserMessage {
+				turn.UserChanged = true
+			}
+			if i >= len(turnsA) {
+				turn.UserMessage = user
+			}
+			turn.AnswerB = finalAnswer(turnsB[i].Original)
+			callsB = turnToolCalls(turnsB[i].Original)
+		} else {
+			turn.OnlyIn = a.Name
+		}
+		turn.AnswerChanged = strings.TrimSpace(turn.AnswerA) != strings.TrimSpace(turn.AnswerB)
+		turn.ToolCalls = diffToolCalls(callsA, callsB)
+		turn.Diverged = turn.OnlyIn != "" || turn.UserChanged || turn.AnswerChanged
+		for _, call := range turn.ToolCalls {
+			if call.Change != ToolCallSame {
+				turn.Diverged = true
+			}
+		}
+		if reportsA != nil && reportsB != nil && i < len(reportsA) && i < len(reportsB) {
+			usage := newUsageDelta(reportsA[i].Usage, reportsB[i].Usage, reportsA[i].Cost, reportsB[i].Cost)
+			turn.Usage = &usage
+		}
+		if turn.Diverged {
+			diff.DivergentTurns = append(diff.DivergentTurns, turn.Turn)
+		}
+		diff.Turns = append(diff.Turns, turn)
+	}
+
+	var usageA, usageB general.Usage
+	var costA, costB float64
+	if a.Report != nil {
+		usageA, costA = a.Report.Usage, a.Report.Cost
+	}
+	if b.Report != nil {
+		usageB, costB = b.Report.Usage, b.Report.Cost
+	}
+	diff.Usage = newUsageDelta(usageA, usageB, costA, costB)
+	return diff
+}
+
+// Run 将回放结果转换为可以与原始运行比较的Run
+func (r *ReplayResult) Run(name string) Run {
+	report := &RunReport{Usage: r.Usage, Cost: r.Cost}
+	for i, turn := range r.Turns {
+		turnReport := TurnReport{Turn: i + 1, Provider: r.Provider, Model: r.Model, Usage: turn.Usage, Cost: turn.Cost, StopReason: turn.StopReason}
+		if turn.Err != nil {
+			turnReport.Error = turn.Err.Error()
+		}
+		report.Turns = append(report.Turns, turnReport)
+	}
+	// 按轮次重建记录，失败的轮次不在回放得到的历史中，这里保留为没有回答的一轮，与原始运行逐轮对齐
+	var transcript []general.Message
+	for _, turn := range r.Turns {
+		transcript = append(transcript, turn.UserMessage)
+		transcript = append(transcript, turn.Replayed...)
+	}
+	return Run{Name: name, Transcript: transcript, Report: report}
+}
+
+// JSON 以缩进的JSON格式输出比较结果
+func (d *RunDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Markdown 以Markdown格式输出比较结果，只列出出现分歧的轮次
+func (d *RunDiff) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# 运行比较 %s / %s\n\n", d.A, d.B)
+	fmt.Fprintf(&b, "- 对话: %d 轮，%d 轮出现分歧\n", len(d.Turns), len(d.DivergentTurns))
+	fmt.Fprintf(&b, "- Token: %d -> %d (%+d)\n", d.Usage.A.TotalTokens, d.Usage.B.TotalTokens, d.Usage.TotalTokens)
+	fmt.Fprintf(&b, "- 费用: %.6f -> %.6f (%+.6f)\n", d.Usage.CostA, d.Usage.CostB, d.Usage.Cost)
+
+	for _, turn := range d.Turns {
+		if !turn.Diverged {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## 第%d轮\n\n", turn.Turn)
+		fmt.Fprintf(&b, "- 用户: %s\n", oneLine(turn.UserMessage))
+		if turn.OnlyIn != "" {
+			fmt.Fprintf(&b, "- 只存在于 %s\n", turn.OnlyIn)
+		}
+		if turn.UserChanged {
+			b.WriteString("- 用户消息不同\n")
+		}
+		if turn.AnswerChanged {
+			fmt.Fprintf(&b, "- %s: %s\n", d.A, oneLine(turn.AnswerA))
+			fmt.Fprintf(&b, "- %s: %s\n", d.B, oneLine(turn.AnswerB))
+		}
+		for _, call := range turn.ToolCalls {
+			switch call.Change {
+			case ToolCallChanged:
+				fmt.Fprintf(&b, "- 工具 %s 参数不同: %s -> %s\n", call.Name, call.ArgumentsA, call.ArgumentsB)
+			case ToolCallAdded:
+				fmt.Fprintf(&b, "- 新增工具调用 %s: %s\n", call.Name, call.ArgumentsB)
+			case ToolCallRemoved:
+				fmt.Fprintf(&b, "- 缺少工具调用 %s: %s\n", call.Name, call.ArgumentsA)
+			}
+		}
+		if turn.Usage != nil {
+			fmt.Fprintf(&b, "- Token: %d -> %d (%+d)\n", turn.Usage.A.TotalTokens, turn.Usage.B.TotalTokens, turn.Usage.TotalTokens)
+		}
+	}
+	return b.String()
+}
+
+// alignedTurnReports 报告中的对话数与记录的轮数相同时返回逐轮的报告，否则返回nil
+func alignedTurnReports(report *RunReport, turns int) []TurnReport {
+	if report == nil || len(report.Turns) != turns {
+		return nil
+	}
+	return report.Turns
+}
+
+// finalAnswer 返回一轮对话中最后一条助手消息的文本
+func finalAnswer(messages []general.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == general.RoleAssistant {
+			return messageText(messages[i])
+		}
+	}
+	return ""
+}
+
+// turnToolCalls 返回一轮对话中按顺序发起的工具调用
+func turnToolCalls(messages []general.Message) []general.ToolCall {
+	var calls []general.ToolCall
+	for _, message := range messages {
+		calls = append(calls, message.ToolCalls...)
+	}
+	return calls
+}
+
+// diffToolCalls 比较两组工具调用，结果按第一组的顺序排列，之后是只在第二组中出现的调用
+func diffToolCalls(a, b []general.ToolCall) []ToolCallDiff {
+	diffs := make([]ToolCallDiff, len(a))
+	matched := make([]bool, len(a))
+	used := make([]bool, len(b))
+	// 先匹配工具名和参数都相同的调用，再按顺序匹配同名工具
+	for _, exact := range []bool{true, false} {
+		for i, callA := range a {
+			if matched[i] {
+				continue
+			}
+			for j, callB := range b {
+				if used[j] || callA.Function.Name != callB.Function.Name {
+					continue
+				}
+				same := canonicalArguments(callA.Function.Arguments) == canonicalArguments(callB.Function.Arguments)
+				if exact && !same {
+					continue
+				}
+				change := ToolCallSame
+				if !same {
+					change = ToolCallChanged
+				}
+				diffs[i] = ToolCallDiff{Change: change, Name: callA.Function.Name, ArgumentsA: callA.Function.Arguments, ArgumentsB: callB.Function.Arguments}
+				matched[i], used[j] = true, true
+				break
+			}
+		}
+	}
+	for i, callA := range a {
+		if !matched[i] {
+			diffs[i] = ToolCallDiff{Change: ToolCallRemoved, Name: callA.Function.Name, ArgumentsA: callA.Function.Arguments}
+		}
+	}
+	for j, callB := range b {
+		if !used[j] {
+			diffs = append(diffs, ToolCallDiff{Change: ToolCallAdded, Name: callB.Function.Name, ArgumentsB: callB.Function.Arguments})
+		}
+	}
+	return diffs
+}
+
+// newUsageDelta 计算两次运行的token和费用差异
+func newUsageDelta(a, b general.Usage, costA, costB float64) UsageDelta {
+	return UsageDelta{
+		A:                a,
+		B:                b,
+		PromptTokens:     b.PromptTokens - a.PromptTokens,
+		CompletionTokens: b.CompletionTokens - a.CompletionTokens,
+		TotalTokens:      b.TotalTokens - a.TotalTokens,
+		CostA:            costA,
+		CostB:            costB,
+		Cost:             costB - costA,
+	}
+}
+
+// oneLine 将文本中的换行替换为空格，用于Markdown列表
+func oneLine(text string) string {
+	return strings.ReplaceAll(text, "\n", " ")
+}
@@ -0,0 +1,208 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ScreenshotToolName 内置截图工具的名称
+const ScreenshotToolName = "take_screenshot"
+
+// Screenshotter 截图函数，target为模型传入的网页地址（截取桌面时为空），返回PNG或JPEG图片数据
+type Screenshotter func(ctx context.Context, target string) ([]byte, error)
+
+// SetScreenshotTool 启用内置的take_screenshot工具，screenshotter为nil时禁用
+// 截图不能作为工具结果发送给大部分提供商，因此工具结果只包含说明，截图在本批工具调用全部完成后
+// 以一条用户消息的图片内容加入对话，模型需要支持图片输入。description为空时使用默认描述
+func (cm *ConversationManager) SetScreenshotTool(screenshotter Screenshotter, description string) {
+	if screenshotter == nil {
+		if cm.screenshotter != nil {
+			cm.screenshotter = nil
+			cm.removeTool(ScreenshotToolName)
+		}
+		return
+	}
+	if description == "" {
+		description = cm.text(MsgScreenshotDescription)
+	}
+	tool := general.Tool{
+		Type: "function",
+		Function: general.FunctionDefinition{
+			Name:        ScreenshotToolName,
+			Description: description,
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"target": map[string]interface{}{
+						"type":        "string",
+						"description": cm.text(MsgScreenshotTarget),
+					},
+				},
+				"required": []string{},
+			},
+		},
+	}
+	if cm.screenshotter != nil {
+		cm.removeTool(ScreenshotToolName)
+	}
+	cm.screenshotter = screenshotter
+	cm.funcSchemas[ScreenshotToolName] = tool
+	cm.tools = append(cm.tools, tool)
+}
+
+// takeScreenshot 执行take_screenshot工具调用，截图暂存到toolImages，返回工具结果
+func (cm *ConversationManager) takeScreenshot(ctx context.Context, toolCall general.ToolCall) string {
+	var args struct {
+		Target string `json:"target"`
+	}
+	if err := json.Unmarshal(toolCall.Function.Arguments, &args); err != nil {
+		// 兼容参数为JSON字符串的格式（DeepSeek格式）
+		var argsStr string
+		if err2 := json.Unmarshal(toolCall.Function.Arguments, &argsStr); err2 != nil || json.Unmarshal([]byte(argsStr), &args) != nil {
+			return cm.text(MsgParseArgumentsFailed, err)
+		}
+	}
+
+	data, err := cm.screenshotter(ctx, strings.TrimSpace(args.Target))
+	if err != nil {
+		return cm.text(MsgScreenshotFailed, err)
+	}
+	url, err := buildImageDataURL(data, "", cm.Locale())
+	if err != nil {
+		return cm.text(MsgScreenshotFailed, err)
+	}
+	cm.toolImages = append(cm.toolImages,
+		general.Content{Type: general.ContentTypeText, Text: cm.text(MsgScreenshotCaption, ScreenshotToolName, toolCall.ID)},
+		general.Content{Type: general.ContentTypeImageURL, ImageURL: &general.ImageURL{URL: url, Detail: cm.imageDetail()}},
+	)
+
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return cm.text(MsgScreenshotTakenSize, config.Width, config.Height)
+	}
+	return cm.text(MsgScreenshotTaken)
+}
+
+// flushToolImages 将本批工具调用产生的截图作为一条用户消息加入历史
+// 必须在所有工具结果之后加入，OpenAI等提供商要求工具结果紧跟在工具调用之后
+func (cm *ConversationManager) flushToolImages(ctx context.Context, info_chan chan general.Message) {
+	if len(cm.toolImages) == 0 {
+		return
+	}
+	msg := cm.appendMessage(ctx, general.Message{Role: general.RoleUser, Content: cm.toolImages})
+	cm.toolImages = nil
+	cm.deliverInfo(info_chan, msg)
+	cm.emitMessage(msg)
+}
+
+// DesktopScreenshotter 使用系统自带的命令截取整个桌面：macOS使用screencapture，Windows使用PowerShell，
+// Linux依次尝试grim、gnome-screenshot、scrot和ImageMagick的import
+func DesktopScreenshotter() Screenshotter {
+	return func(ctx context.Context, target string) ([]byte, error) {
+		if target != "" {
+			return nil, fmt.Errorf("桌面截图不支持指定网页地址")
+		}
+		return captureToFile(func(path string) (*exec.Cmd, error) {
+			switch runtime.GOOS {
+			case "darwin":
+				return exec.CommandContext(ctx, "screencapture", "-x", "-t", "png", path), nil
+			case "windows":
+				script := "Add-Type -AssemblyName System.Windows.Forms,System.Drawing;" +
+					"$b=[System.Windows.Forms.SystemInformation]::VirtualScreen;" +
+					"$bmp=New-Object System.Drawing.Bitmap $b.Width,$b.Height;" +
+					"$g=[System.Drawing.Graphics]::FromImage($bmp);" +
+					"$g.CopyFromScreen($b.Left,$b.Top,0,0,$bmp.Size);" +
+					"$bmp.Save('" + strings.ReplaceAll(path, "'", "''") + "',[System.Drawing.Imaging.ImageFormat]::Png)"
+				return exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script), nil
+			}
+			commands := [][]string{
+				{"grim", path},
+				{"gnome-screenshot", "-f", path},
+				{"scrot", "-o", path},
+				{"import", "-window", "root", path},
+			}
+			for _, command := range commands {
+				if _, err := exec.LookPath(command[0]); err == nil {
+					return exec.CommandContext(ctx, command[0], command[1:]...), nil
+				}
+			}
+			return nil, fmt.Errorf("没有找到截图命令（grim、gnome-screenshot、scrot或import）")
+		})
+	}
+}
+
+// BrowserScreenshotter 使用无头Chrome（或Chromium、Edge）截取网页，browser为空时在PATH中查找，
+// width和height为窗口大小，为0时使用1280x800
+func BrowserScreenshotter(browser string, width, height int) Screenshotter {
+	if width <= 0 || height <= 0 {
+		width, height = 1280, 800
+	}
+	return func(ctx context.Context, target string) ([]byte, error) {
+		if target == "" {
+			return nil, fmt.Errorf("需要网页地址")
+		}
+		path := browser
+		if path == "" {
+			path = findBrowser()
+			if path == "" {
+				return nil, fmt.Errorf("没有找到Chrome、Chromium或Edge")
+			}
+		}
+		return captureToFile(func(file string) (*exec.Cmd, error) {
+			return exec.CommandContext(ctx, path, "--headless=new", "--disable-gpu", "--hide-scrollbars",
+				"--screenshot="+file, fmt.Sprintf("--window-size=%d,%d", width, height), target), nil
+		})
+	}
+}
+
+// findBrowser 在PATH和常见安装位置中查找Chrome、Chromium或Edge
+func findBrowser() string {
+	for _, name := range []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser", "chrome", "msedge", "microsoft-edge"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	for _, path := range []string{
+		"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		"/Applications/Chromium.app/Contents/MacOS/Chromium",
+		`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+		`C:\Program Files (x86)\Microsoft\Edge\Application\msedge.exe`,
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// captureToFile 在临时目录中执行截图命令并读取生成的图片
+func captureToFile(command func(path string) (*exec.Cmd, error)) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "screenshot")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "screenshot.png")
+	cmd, err := command(path)
+	if err != nil {
+		return nil, err
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("截图命令执行失败: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取截图失败: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,146 @@
+package ConversationManager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Flusher 关闭时需要持久化数据的组件（如历史存储、日志导出）
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// FlusherFunc 将函数适配为Flusher
+type FlusherFunc func(ctx context.Context) error
+
+// Flush 调用函数本身
+func (f FlusherFunc) Flush(ctx context.Context) error {
+	return f(ctx)
+}
+
+// lifecycle 进行中的对话和工具调用，用于优雅关闭
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	active   int                        // 进行中的对话和工具调用数量
+	nextID   int                        // 下一个对话的编号
+	cancels  map[int]context.CancelFunc // 进行中对话的取消函数
+	idle     chan struct{}              // 关闭后active归零时关闭
+	flushers []Flusher                  // 关闭时需要刷新的组件
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{cancels: make(map[int]context.CancelFunc)}
+}
+
+// RegisterFlusher 注册关闭时需要刷新的组件，Shutdown时按注册顺序刷新
+func (cm *ConversationManager) RegisterFlusher(flusher Flusher) {
+	cm.lifecycle.mu.Lock()
+	defer cm.lifecycle.mu.Unlock()
+	cm.lifecycle.flushers = append(cm.lifecycle.flushers, flusher)
+}
+
+// beginChat 登记一次对话，返回Shutdown时会被取消的上下文和结束时调用的函数，已关闭时返回错误
+func (cm *ConversationManager) beginChat(ctx context.Context) (context.Context, func(), error) {
+	l := cm.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, nil, fmt.Errorf("对话管理器已关闭")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	id := l.nextID
+	l.nextID++
+	l.cancels[id] = cancel
+	l.active++
+	return ctx, func() {
+		cancel()
+		l.mu.Lock()
+		delete(l.cancels, id)
+		l.mu.Unlock()
+		l.done()
+	}, nil
+}
+
+// beginTool 登记一次工具调用，返回结束时调用的函数，已关闭时返回错误
+func (cm *ConversationManager) beginTool() (func(), error) {
+	l := cm.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, fmt.Errorf("对话管理器已关闭，拒绝执行工具")
+	}
+	l.active++
+	return l.done, nil
+}
+
+// busy 是否有进行中的对话或工具调用
+func (l *lifecycle) busy() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active > 0
+}
+
+// done 结束一次对话或工具调用，关闭后全部结束时通知Shutdown
+func (l *lifecycle) done() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.closed && l.active == 0 && l.idle != nil {
+		close(l.idle)
+		l.idle = nil
+	}
+}
+
+// Shutdown 优雅关闭对话管理器：拒绝新的对话和工具调用，取消进行中的对话，
+// 在ctx截止前等待正在执行的工具结束，然后取消未到期的提醒、等待追踪导出、刷新注册的Flusher并关闭MCP连接
+// 等待超时时仍会刷新和关闭，并返回超时错误；重复调用时只等待，不再刷新和关闭
+func (cm *ConversationManager) Shutdown(ctx context.Context) error {
+	l := cm.lifecycle
+	l.mu.Lock()
+	first := !l.closed
+	l.closed = true
+	idle := make(chan struct{})
+	if l.active == 0 {
+		close(idle)
+	} else {
+		if l.idle == nil {
+			l.idle = make(chan struct{})
+		}
+		idle = l.idle
+	}
+	for _, cancel := range l.cancels {
+		cancel()
+	}
+	flushers := l.flushers
+	l.mu.Unlock()
+
+	var errs []error
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("等待进行中的对话和工具调用结束超时: %w", ctx.Err()))
+	}
+	if !first {
+		return errors.Join(errs...)
+	}
+	if cm.reminders != nil {
+		cm.reminders.stop()
+	}
+
+	if err := cm.FlushTraces(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for _, flusher := range flushers {
+		if err := flusher.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("刷新数据失败: %w", err))
+		}
+	}
+	if err := cm.CloseMCP(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
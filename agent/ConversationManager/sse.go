@@ -0,0 +1,244 @@
+package ConversationManager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSE的默认配置
+const (
+	defaultSSEBuffer    = 1000
+	defaultSSEHeartbeat = 15 * time.Second
+	defaultSSERetry     = 3 * time.Second
+)
+
+// SSEConfig 事件流的配置
+type SSEConfig struct {
+	Buffer    int           // 保留用于断线续传的最近事件数量，默认1000
+	Heartbeat time.Duration // 心跳间隔，防止代理因空闲断开连接，默认15秒
+	Retry     time.Duration // 建议浏览器断线后的重连间隔，默认3秒
+}
+
+// EventStream 通过Server-Sent Events向网页前端推送一个会话的结构化事件，实现http.Handler
+// 每个事件带有递增的ID，浏览器断线重连时通过Last-Event-ID（或lastEventId查询参数）续传错过的事件
+type EventStream struct {
+	config SSEConfig
+
+	mu      sync.Mutex
+	events  []sseEvent
+	nextID  int64
+	changed chan struct{} // 有新事件时关闭并替换，用于唤醒等待的连接
+	closed  bool
+	done    chan struct{}
+	sub     *Subscription
+}
+
+// sseEvent 带ID的事件
+type sseEvent struct {
+	id    int64
+	event Event
+}
+
+// NewEventStream 创建会话的SSE事件流，通过Subscribe订阅会话的事件，不影响事件通道和其他订阅
+// 事件在没有连接时也会保留最近的Buffer个，供之后连接的前端续传
+func (cm *ConversationManager) NewEventStream(config SSEConfig) *EventStream {
+	if config.Buffer <= 0 {
+		config.Buffer = defaultSSEBuffer
+	}
+	if config.Heartbeat <= 0 {
+		config.Heartbeat = defaultSSEHeartbeat
+	}
+	if config.Retry <= 0 {
+		config.Retry = defaultSSERetry
+	}
+	s := &EventStream{
+		config:  config,
+		nextID:  1,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		sub:     cm.Subscribe(0),
+	}
+	go s.receive(s.sub.Events())
+	return s
+}
+
+// Close 结束所有连接并取消订阅，之后的连接返回503
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	s.sub.Close()
+}
+
+// LastEventID 返回最近一个事件的ID，没有事件时为0
+func (s *EventStream) LastEventID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextID - 1
+}
+
+// receive 从订阅读取事件并保存，取消订阅后退出
+func (s *EventStream) receive(events <-chan Event) {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			s.events = append(s.events, sseEvent{id: s.nextID, event: event})
+			s.nextID++
+			if len(s.events) > s.config.Buffer {
+				s.events = append(s.events[:0:0], s.events[len(s.events)-s.config.Buffer:]...)
+			}
+			close(s.changed)
+			s.changed = make(chan struct{})
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// since 返回ID大于lastID的事件、等待新事件的通道，以及lastID之后的事件是否已有部分被丢弃
+func (s *EventStream) since(lastID int64) ([]sseEvent, chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gap := lastID >= s.nextID || (len(s.events) > 0 && lastID < s.events[0].id-1)
+	var pending []sseEvent
+	for _, event := range s.events {
+		if event.id > lastID {
+			pending = append(pending, event)
+		}
+	}
+	return pending, s.changed, gap
+}
+
+// ServeHTTP 以text/event-stream推送事件，查询参数types可以只订阅部分事件类型（逗号分隔）
+// 续传时错过的事件已超出缓冲区（或服务重启后ID不连续）时，先发送一个reset事件，前端应重新加载历史
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持流式响应", http.StatusInternalServerError)
+		return
+	}
+	select {
+	case <-s.done:
+		http.Error(w, "事件流已关闭", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	lastID := int64(0)
+	resuming := false
+	lastHeader := r.Header.Get("Last-Event-ID")
+	if lastHeader == "" {
+		lastHeader = r.URL.Query().Get("lastEventId")
+	}
+	if lastHeader != "" {
+		if id, err := strconv.ParseInt(lastHeader, 10, 64); err == nil && id >= 0 {
+			lastID = id
+			resuming = true
+		}
+	}
+	if !resuming {
+		// 新连接只接收之后的事件
+		lastID = s.LastEventID()
+	}
+	var types map[EventType]bool
+	if filter := r.URL.Query().Get("types"); filter != "" {
+		types = make(map[EventType]bool)
+		for _, name := range strings.Split(filter, ",") {
+			types[EventType(strings.TrimSpace(name))] = true
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", s.config.Retry.Milliseconds())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(s.config.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		pending, changed, gap := s.since(lastID)
+		if gap && resuming {
+			fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {\"last_event_id\":%d}\n\n", s.LastEventID(), lastID)
+			lastID = s.LastEventID()
+			pending = nil
+		}
+		resuming = false
+		for _, event := range pending {
+			lastID = event.id
+			if types != nil && !types[event.event.Type] {
+				continue
+			}
+			data, err := json.Marshal(eventJSON(event.event))
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.event.Type, data)
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// eventJSON 将事件转换为前端使用的JSON对象，省略空字段
+func eventJSON(event Event) map[string]interface{} {
+	data := map[string]interface{}{"type": event.Type, "time": event.Time}
+	if event.Role != "" {
+		data["role"] = event.Role
+	}
+	if event.Message != nil {
+		data["message"] = event.Message
+	}
+	if event.Text != "" {
+		data["text"] = event.Text
+	}
+	if event.ToolCall != nil {
+		data["tool_call"] = event.ToolCall
+	}
+	if event.ToolResult != "" {
+		data["tool_result"] = event.ToolResult
+	}
+	if event.Question != "" {
+		data["question"] = event.Question
+	}
+	if event.StopReason != "" {
+		data["stop_reason"] = event.StopReason
+	}
+	if event.Usage != nil {
+		data["usage"] = event.Usage
+	}
+	if event.Err != nil {
+		data["error"] = event.Err.Error()
+	}
+	if event.Reminder != nil {
+		data["reminder"] = event.Reminder
+	}
+	return data
+}
@@ -0,0 +1,137 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ErrStreamIncomplete 流式回复在结束原因到达之前中断
+var ErrStreamIncomplete = errors.New("stream ended before the reply finished")
+
+// SetStreamReplies 设置是否以流式请求模型，开启且有事件接收方时，助手回复的文本逐块通过TextDelta事件发送
+// 草稿模式、结构化输出、音频输出和模拟函数调用不支持流式请求，这些请求仍使用普通请求
+func (cm *ConversationManager) SetStreamReplies(enabled bool) {
+	cm.streamReplies = enabled
+}
+
+// canStreamReply 判断本次请求是否使用流式请求
+func (cm *ConversationManager) canStreamReply(provider general.Provider, req *general.ChatRequest) bool {
+	if !cm.streamReplies || !cm.observed() || cm.draftModel != nil {
+		return false
+	}
+	if req.ResponseFormat != nil || len(req.Modalities) > 0 || req.EmulateTools {
+		return false
+	}
+	return !cm.manager.EmulatesTools(provider)
+}
+
+// streamReply 以流式请求模型，每个文本块发送一个TextDelta事件，结束后拼接为完整的回复
+func (cm *ConversationManager) streamReply(ctx context.Context, provider general.Provider, req *general.ChatRequest) (*general.ChatResponse, error) {
+	chunks, err := cm.manager.ChatStream(ctx, provider, req)
+	if err != nil {
+		return nil, err
+	}
+	return collectStream(ctx, chunks, func(text string) {
+		cm.replyStreamed = true
+		cm.emit(Event{Type: EventTextDelta, Role: general.RoleAssistant, Text: text})
+	})
+}
+
+// collectStream 读取所有数据块并拼接为ChatResponse，onText在收到回答文本时调用
+// 通道在结束原因之前关闭时返回ErrStreamIncomplete，ctx已取消时返回ctx的错误
+func collectStream(ctx context.Context, chunks <-chan *general.StreamChunk, onText func(text string)) (*general.ChatResponse, error) {
+	resp := &general.ChatResponse{Object: "chat.completion", Created: time.Now()}
+	choice := general.Choice{Message: general.Message{Role: general.RoleAssistant}}
+	var text, reasoning []byte
+	calls := map[int]*general.ToolCall{}
+	arguments := map[int][]byte{}
+
+	for chunk := range chunks {
+		if chunk.ID != "" {
+			resp.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		if chunk.Delta != "" {
+			text = append(text, chunk.Delta...)
+			onText(chunk.Delta)
+		}
+		reasoning = append(reasoning, chunk.ReasoningDelta...)
+		for _, delta := range chunk.ToolCalls {
+			call, ok := calls[delta.Index]
+			if !ok {
+				call = &general.ToolCall{Type: "function"}
+				calls[delta.Index] = call
+			}
+			if delta.ID != "" {
+				call.ID = delta.ID
+			}
+			if delta.Name != "" {
+				call.Function.Name = delta.Name
+			}
+			arguments[delta.Index] = append(arguments[delta.Index], delta.ArgumentsDelta...)
+		}
+		if chunk.FinishReason != "" {
+			choice.FinishReason = chunk.FinishReason
+			choice.NormalizedFinishReason = chunk.NormalizedFinishReason
+		}
+		if chunk.Usage != nil {
+			mergeStreamUsage(&resp.Usage, *chunk.Usage)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if choice.FinishReason == "" {
+		return nil, ErrStreamIncomplete
+	}
+
+	if len(text) > 0 {
+		choice.Message.Content = []general.Content{{Type: general.ContentTypeText, Text: string(text)}}
+	}
+	choice.Message.ReasoningContent = string(reasoning)
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		call := calls[index]
+		call.Function.Arguments = json.RawMessage(arguments[index])
+		choice.Message.ToolCalls = append(choice.Message.ToolCalls, *call)
+		// 与非流式的转换结果一致，工具调用同时加入内容
+		contentCall := *call
+		choice.Message.Content = append(choice.Message.Content, general.Content{Type: general.ContentTypeTool, ToolCall: &contentCall})
+	}
+	resp.Choices = []general.Choice{choice}
+	return resp, nil
+}
+
+// mergeStreamUsage 合并数据块中的使用统计，后到的非零值覆盖之前的值
+// 部分提供商在不同的块中分别报告输入和输出token，总数不小于两者之和
+func mergeStreamUsage(usage *general.Usage, chunk general.Usage) {
+	if chunk.PromptTokens > 0 {
+		usage.PromptTokens = chunk.PromptTokens
+	}
+	if chunk.CompletionTokens > 0 {
+		usage.CompletionTokens = chunk.CompletionTokens
+	}
+	if chunk.TotalTokens > usage.TotalTokens {
+		usage.TotalTokens = chunk.TotalTokens
+	}
+	if sum := usage.PromptTokens + usage.CompletionTokens; usage.TotalTokens < sum {
+		usage.TotalTokens = sum
+	}
+	for key, value := range chunk.Extensions {
+		if usage.Extensions == nil {
+			usage.Extensions = map[string]int{}
+		}
+		usage.Extensions[key] = value
+	}
+}
@@ -0,0 +1,104 @@
+package ConversationManager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// streamServer 兼容OpenAI接口的流式测试服务，第一次请求返回工具调用，之后分块返回最终回复
+func streamServer() *httptest.Server {
+	requests := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"id":"s1","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Let me check. "}}]}`,
+			`{"id":"s1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"tick","arguments":"{\"n\":"}}]}}]}`,
+			`{"id":"s1","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}}]}`,
+			`{"id":"s1","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		}
+		if requests > 1 {
+			events = []string{
+				`{"id":"s2","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+				`{"id":"s2","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+				`{"id":"s2","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			}
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestStreamRepliesEmitsDeltas(t *testing.T) {
+	server := streamServer()
+	defer server.Close()
+
+	manager := general.NewAgentManager()
+	if err := manager.AddProvider(&general.ProviderConfig{Provider: general.ProviderOpenAI, APIKey: "test", BaseURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	cm := NewConversationManager(manager)
+	cm.SetStreamReplies(true)
+	events := make(chan Event, 64)
+	cm.SetEventChannel(events)
+	var args string
+	if err := cm.RegisterFunction("tick", "count a call", func(n int) string {
+		args = fmt.Sprint(n)
+		return "ok"
+	}, []string{"n"}, []string{"number"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stopReason, err, usage := cm.Chat(context.Background(), general.ProviderOpenAI, "gpt-4o", "go", nil, nil)
+	if err != nil || general.StopReason(stopReason) != general.StopReasonSuccess {
+		t.Fatalf("Chat = %s, %v", stopReason, err)
+	}
+	close(events)
+
+	var deltas []string
+	for event := range events {
+		if event.Type == EventTextDelta {
+			deltas = append(deltas, event.Text)
+		}
+	}
+	if got := strings.Join(deltas, "|"); got != "Let me check. |Hel|lo" {
+		t.Errorf("deltas = %q", got)
+	}
+	if args != "1" {
+		t.Errorf("tool called with %q, want 1", args)
+	}
+	if usage == nil || usage.TotalTokens != 5 {
+		t.Errorf("usage = %+v, want 5 total tokens", usage)
+	}
+	// 流式回复中的工具调用与非流式一样也出现在内容中
+	for _, msg := range cm.history {
+		if len(msg.ToolCalls) == 0 {
+			continue
+		}
+		content := msg.Content[len(msg.Content)-1]
+		if content.Type != general.ContentTypeTool || content.ToolCall == nil || content.ToolCall.ID != msg.ToolCalls[0].ID {
+			t.Errorf("tool call missing from content: %+v", msg.Content)
+		}
+	}
+	last := cm.history[len(cm.history)-1]
+	if messageText(last) != "Hello" {
+		t.Errorf("final reply = %q, want Hello", messageText(last))
+	}
+}
+
+func TestCollectStreamIncomplete(t *testing.T) {
+	chunks := make(chan *general.StreamChunk, 1)
+	chunks <- &general.StreamChunk{Delta: "partial"}
+	close(chunks)
+	if _, err := collectStream(context.Background(), chunks, func(string) {}); err != ErrStreamIncomplete {
+		t.Fatalf("err = %v, want ErrStreamIncomplete", err)
+	}
+}
@@ -0,0 +1,142 @@
+package ConversationManager
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Subscription 对话事件流的只读订阅，每个订阅有独立的缓冲，读取慢的订阅方不影响对话和其他订阅方
+// 日志、界面和持久化可以各自订阅，互不抢占事件
+type Subscription struct {
+	events  chan Event
+	limit   int
+	dropped atomic.Int64
+	remove  func(*Subscription)
+
+	mu     sync.Mutex
+	queue  []Event
+	closed bool
+	wake   chan struct{} // 有新事件时唤醒投递goroutine
+	done   chan struct{}
+}
+
+// subscriberSet 会话的所有订阅，事件可能由提醒等后台goroutine发送，需要加锁
+type subscriberSet struct {
+	mu   sync.RWMutex
+	subs []*Subscription
+}
+
+// Subscribe 订阅会话的结构化事件，每个订阅都收到全部事件，与SetEventChannel设置的通道同时生效
+// buffer为订阅方尚未读取的事件的最大数量，超过时丢弃该订阅的新事件；buffer<=0时不限制，不丢失事件
+// 不再需要时调用Close取消订阅，Events返回的通道随之关闭
+func (cm *ConversationManager) Subscribe(buffer int) *Subscription {
+	s := &Subscription{
+		events: make(chan Event),
+		limit:  buffer,
+		remove: cm.subscribers.remove,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	cm.subscribers.mu.Lock()
+	cm.subscribers.subs = append(cm.subscribers.subs, s)
+	cm.subscribers.mu.Unlock()
+	go s.pump()
+	return s
+}
+
+// Events 返回只读的事件通道，取消订阅后关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped 返回因超过buffer而丢弃的事件数量
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close 取消订阅，尚未读取的事件被丢弃，可以重复调用
+func (s *Subscription) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.queue = nil
+	s.mu.Unlock()
+	s.remove(s)
+	close(s.done)
+}
+
+// publish 将事件放入订阅的队列，不会阻塞
+func (s *Subscription) publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.limit > 0 && len(s.queue) >= s.limit {
+		s.dropped.Add(1)
+		return
+	}
+	s.queue = append(s.queue, event)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump 按顺序将队列中的事件投递给订阅方，取消订阅后关闭事件通道
+func (s *Subscription) pump() {
+	defer close(s.events)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		event := s.queue[0]
+		s.queue[0] = Event{}
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// remove 移除已取消的订阅
+func (set *subscriberSet) remove(s *Subscription) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	for i, sub := range set.subs {
+		if sub == s {
+			set.subs = append(set.subs[:i:i], set.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// publish 将事件发送给所有订阅
+func (set *subscriberSet) publish(event Event) {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	for _, s := range set.subs {
+		s.publish(event)
+	}
+}
+
+// active 判断是否有订阅
+func (set *subscriberSet) active() bool {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	return len(set.subs) > 0
+}
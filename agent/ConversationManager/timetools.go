@@ -0,0 +1,462 @@
+package ConversationManager
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内置时间工具的名称
+const (
+	CurrentTimeToolName      = "get_current_time"
+	ConvertTimeToolName      = "convert_timezone"
+	ScheduleReminderToolName = "schedule_reminder"
+	CancelReminderToolName   = "cancel_reminder"
+)
+
+// timeLayouts 解析模型传入的不带时区的时间时尝试的格式
+var timeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Reminder schedule_reminder工具设置的提醒
+type Reminder struct {
+	ID      string
+	Message string
+	At      time.Time // 下一次提醒的时间
+	Cron    string    // 重复提醒的cron表达式，一次性提醒为空
+}
+
+// ReminderFunc 提醒到期时的回调，在单独的goroutine中调用
+type ReminderFunc func(reminder Reminder)
+
+// reminderScheduler 管理提醒的定时器
+type reminderScheduler struct {
+	mu       sync.Mutex
+	location *time.Location
+	locale   Locale // 工具结果使用的语言
+	notify   func(reminder Reminder)
+	nextID   int
+	entries  map[string]*reminderEntry
+	stopped  bool
+}
+
+// reminderEntry 一个提醒及其定时器
+type reminderEntry struct {
+	reminder Reminder
+	schedule *cronSchedule
+	timer    *time.Timer
+}
+
+// SetTimeAwareness 在每次请求的系统提示词中注入当前时间，避免模型臆测日期，location为nil时不注入
+// 系统提示词中的{{now}}、{{date}}、{{weekday}}和{{timezone}}会被替换为对应的值，
+// 没有这些占位符时在系统提示词末尾追加一行当前时间
+func (cm *ConversationManager) SetTimeAwareness(location *time.Location) {
+	cm.timeLocation = location
+}
+
+// requestSystemPrompt 返回发送给提供商的系统提示词，启用时间感知时注入当前时间
+func (cm *ConversationManager) requestSystemPrompt() string {
+	if cm.timeLocation == nil {
+		return cm.systemPrompt
+	}
+	now := time.Now().In(cm.timeLocation)
+	replacer := strings.NewReplacer(
+		"{{now}}", now.Format("2006-01-02 15:04"),
+		"{{date}}", now.Format("2006-01-02"),
+		"{{weekday}}", weekdayName(cm.Locale(), now.Weekday()),
+		"{{timezone}}", cm.timeLocation.String(),
+	)
+	prompt := replacer.Replace(cm.systemPrompt)
+	if prompt != cm.systemPrompt {
+		return prompt
+	}
+	line := cm.text(MsgCurrentTime, now.Format("2006-01-02 15:04"), weekdayName(cm.Locale(), now.Weekday()), cm.timeLocation)
+	if prompt == "" {
+		return line
+	}
+	return prompt + "\n\n" + line
+}
+
+// RegisterTimeTools 注册get_current_time、convert_timezone、schedule_reminder和cancel_reminder工具，返回注册的工具名称
+// location为模型未指定时区时使用的时区，为nil时使用本地时区；提醒到期时调用onReminder并发送Reminder事件，
+// onReminder为nil时只发送事件。Shutdown时取消所有未到期的提醒
+func (cm *ConversationManager) RegisterTimeTools(location *time.Location, onReminder ReminderFunc) ([]string, error) {
+	if location == nil {
+		location = time.Local
+	}
+	if cm.reminders != nil {
+		return nil, fmt.Errorf("时间工具已注册")
+	}
+	scheduler := &reminderScheduler{
+		location: location,
+		locale:   cm.Locale(),
+		entries:  make(map[string]*reminderEntry),
+		notify: func(reminder Reminder) {
+			if onReminder != nil {
+				onReminder(reminder)
+			}
+			cm.emit(Event{Type: EventReminder, Text: reminder.Message, Reminder: &reminder})
+		},
+	}
+
+	var registered []string
+	register := func(name, description string, fn interface{}, paramNames, paramDescriptions []string) error {
+		if err := cm.RegisterFunction(name, description, fn, paramNames, paramDescriptions); err != nil {
+			return fmt.Errorf("注册工具 %s 失败: %w", name, err)
+		}
+		registered = append(registered, name)
+		return nil
+	}
+	if err := register(CurrentTimeToolName, cm.text(MsgCurrentTimeTool), scheduler.currentTime,
+		[]string{"timezone"},
+		[]string{cm.text(MsgTimezoneParam)}); err != nil {
+		return registered, err
+	}
+	if err := register(ConvertTimeToolName, cm.text(MsgConvertTimeTool), scheduler.convertTime,
+		[]string{"time", "from", "to"},
+		[]string{cm.text(MsgConvertTimeTime), cm.text(MsgConvertTimeFrom), cm.text(MsgConvertTimeTo)}); err != nil {
+		return registered, err
+	}
+	if err := register(ScheduleReminderToolName, cm.text(MsgScheduleReminderTool), scheduler.schedule,
+		[]string{"message", "at", "delay", "cron"},
+		[]string{cm.text(MsgReminderMessage), cm.text(MsgReminderAt), cm.text(MsgReminderDelay), cm.text(MsgReminderCron)}); err != nil {
+		return registered, err
+	}
+	if err := register(CancelReminderToolName, cm.text(MsgCancelReminderTool), scheduler.cancel,
+		[]string{"id"},
+		[]string{cm.text(MsgCancelReminderID)}); err != nil {
+		return registered, err
+	}
+	cm.reminders = scheduler
+	return registered, nil
+}
+
+// Reminders 返回未到期的提醒，按提醒时间排序
+func (cm *ConversationManager) Reminders() []Reminder {
+	if cm.reminders == nil {
+		return nil
+	}
+	return cm.reminders.list()
+}
+
+// CancelReminder 取消提醒，提醒不存在时返回错误
+func (cm *ConversationManager) CancelReminder(id string) error {
+	if cm.reminders == nil {
+		return fmt.Errorf("提醒 %s 不存在", id)
+	}
+	_, err := cm.reminders.cancel(id)
+	return err
+}
+
+// loadLocation 解析时区名称，为空时使用默认时区
+func (s *reminderScheduler) loadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return s.location, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区 %q，请使用IANA时区名称，如Asia/Shanghai", name)
+	}
+	return location, nil
+}
+
+// currentTime 执行get_current_time工具
+func (s *reminderScheduler) currentTime(timezone string) (string, error) {
+	location, err := s.loadLocation(timezone)
+	if err != nil {
+		return "", err
+	}
+	return s.formatTime(time.Now().In(location)), nil
+}
+
+// convertTime 执行convert_timezone工具
+func (s *reminderScheduler) convertTime(value, from, to string) (string, error) {
+	fromLocation, err := s.loadLocation(from)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(to) == "" {
+		return "", fmt.Errorf("目标时区不能为空")
+	}
+	toLocation, err := s.loadLocation(to)
+	if err != nil {
+		return "", err
+	}
+	t, err := parseTimeIn(value, fromLocation)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s => %s", s.formatTime(t), s.formatTime(t.In(toLocation))), nil
+}
+
+// schedule 执行schedule_reminder工具
+func (s *reminderScheduler) schedule(message, at, delay, cron string) (string, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return "", fmt.Errorf("提醒内容不能为空")
+	}
+	at, delay, cron = strings.TrimSpace(at), strings.TrimSpace(delay), strings.TrimSpace(cron)
+	set := 0
+	for _, value := range []string{at, delay, cron} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", fmt.Errorf("at、delay和cron必须且只能设置一个")
+	}
+
+	now := time.Now().In(s.location)
+	reminder := Reminder{Message: message, Cron: cron}
+	var schedule *cronSchedule
+	switch {
+	case at != "":
+		t, err := parseTimeIn(at, s.location)
+		if err != nil {
+			return "", err
+		}
+		if !t.After(now) {
+			return "", fmt.Errorf("提醒时间 %s 已经过去，当前时间为 %s", s.formatTime(t), s.formatTime(now))
+		}
+		reminder.At = t
+	case delay != "":
+		d, err := time.ParseDuration(delay)
+		if err != nil || d <= 0 {
+			return "", fmt.Errorf("无效的延迟 %q，应为正的时长，如10m、1h30m", delay)
+		}
+		reminder.At = now.Add(d)
+	default:
+		var err error
+		if schedule, err = parseCron(cron); err != nil {
+			return "", err
+		}
+		reminder.At = schedule.next(now)
+		if reminder.At.IsZero() {
+			return "", fmt.Errorf("cron表达式 %q 在未来五年内没有匹配的时间", cron)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return "", fmt.Errorf("对话管理器已关闭，不能设置提醒")
+	}
+	s.nextID++
+	reminder.ID = "r" + strconv.Itoa(s.nextID)
+	entry := &reminderEntry{reminder: reminder, schedule: schedule}
+	s.entries[reminder.ID] = entry
+	s.arm(entry)
+
+	if cron != "" {
+		return Localize(s.locale, MsgRecurringReminderSet, reminder.ID, s.formatTime(reminder.At)), nil
+	}
+	return Localize(s.locale, MsgReminderSet, reminder.ID, s.formatTime(reminder.At)), nil
+}
+
+// arm 为提醒启动定时器，调用时需持有锁
+func (s *reminderScheduler) arm(entry *reminderEntry) {
+	entry.timer = time.AfterFunc(time.Until(entry.reminder.At), func() {
+		s.mu.Lock()
+		if s.stopped || s.entries[entry.reminder.ID] != entry {
+			s.mu.Unlock()
+			return
+		}
+		reminder := entry.reminder
+		if entry.schedule == nil {
+			delete(s.entries, reminder.ID)
+		} else if next := entry.schedule.next(reminder.At); next.IsZero() {
+			delete(s.entries, reminder.ID)
+		} else {
+			entry.reminder.At = next
+			s.arm(entry)
+		}
+		s.mu.Unlock()
+		s.notify(reminder)
+	})
+}
+
+// cancel 执行cancel_reminder工具
+func (s *reminderScheduler) cancel(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id = strings.TrimSpace(id)
+	entry, ok := s.entries[id]
+	if !ok {
+		return "", fmt.Errorf("提醒 %s 不存在", id)
+	}
+	entry.timer.Stop()
+	delete(s.entries, id)
+	return Localize(s.locale, MsgReminderCancelled, id), nil
+}
+
+// list 返回未到期的提醒
+func (s *reminderScheduler) list() []Reminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reminders := make([]Reminder, 0, len(s.entries))
+	for _, entry := range s.entries {
+		reminders = append(reminders, entry.reminder)
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].At.Before(reminders[j].At) })
+	return reminders
+}
+
+// stop 取消所有提醒，之后不能再设置提醒
+func (s *reminderScheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for id, entry := range s.entries {
+		entry.timer.Stop()
+		delete(s.entries, id)
+	}
+}
+
+// formatTime 格式化为带星期和时区的时间
+func (s *reminderScheduler) formatTime(t time.Time) string {
+	return Localize(s.locale, MsgTimeFormat, t.Format(time.RFC3339), weekdayName(s.locale, t.Weekday()), t.Location())
+}
+
+// parseTimeIn 解析时间，没有时区偏移时按location解析，只有时刻（如15:04）时为今天
+func parseTimeIn(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", value, location); err == nil {
+		now := time.Now().In(location)
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, location), nil
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q，请使用2006-01-02 15:04或RFC3339格式", value)
+}
+
+// cronSchedule 解析后的五段cron表达式，每段为允许值的位图
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	dayAny, weekdayAny                bool // 日和星期是否为*，都不是*时任一匹配即可
+}
+
+// cronMacros cron表达式的简写
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// parseCron 解析五段cron表达式（分 时 日 月 星期），支持*、列表、范围和步长，星期的7也表示星期日
+func parseCron(spec string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("无效的cron表达式 %q，需要5段：分 时 日 月 星期", spec)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("无效的cron表达式 %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute: bits[0], hour: bits[1], day: bits[2], month: bits[3], weekday: bits[4],
+		dayAny: fields[2] == "*", weekdayAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField 解析cron表达式的一段
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("无效的步长 %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bound := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bound[0])
+			end, err2 = strconv.Atoi(bound[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("无效的范围 %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("无效的值 %q", part)
+			}
+			start = n
+			if step == 1 {
+				end = n
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q 超出范围 %d-%d", part, min, max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matchDay 判断日期是否匹配日和星期两段
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	day := s.day&(1<<uint(t.Day())) != 0
+	weekday := s.weekday&(1<<uint(t.Weekday())) != 0
+	if s.dayAny || s.weekdayAny {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// next 返回after之后的下一个匹配时间，未来五年内没有时返回零值
+func (s *cronSchedule) next(after time.Time) time.Time {
+	location := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1, 0, 0, location)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, location)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
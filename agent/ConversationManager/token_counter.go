@@ -0,0 +1,129 @@
+package ConversationManager
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// TokenCounter 计算文本的token数，用于历史截断、CompressText和CountTokens
+// model为本次请求的模型，CalculateTokens等不指定模型的调用传入空字符串
+type TokenCounter interface {
+	CountTokens(model string, text string) int
+}
+
+// TokenCounterFunc 函数形式的TokenCounter
+type TokenCounterFunc func(model string, text string) int
+
+// CountTokens 调用函数本身
+func (f TokenCounterFunc) CountTokens(model string, text string) int {
+	return f(model, text)
+}
+
+// HeuristicTokenCounter 默认的估算：非ASCII字符（如中文）每个约1个token，ASCII文本每4个字符约1个token
+// 不依赖词表，对所有模型使用同一规则，误差通常在30%以内
+type HeuristicTokenCounter struct{}
+
+// CountTokens 估算文本的token数
+func (HeuristicTokenCounter) CountTokens(model string, text string) int {
+	return estimateTokens(text)
+}
+
+// TiktokenEncoder tiktoken编码器，github.com/pkoukk/tiktoken-go的*tiktoken.Tiktoken满足该接口
+type TiktokenEncoder interface {
+	Encode(text string, allowedSpecial []string, disallowedSpecial []string) []int
+}
+
+// TiktokenCounter 按模型使用tiktoken编码器精确计数，没有对应编码器的模型使用fallback
+// 本包不依赖tiktoken的实现，编码器由调用方创建后通过SetEncoder注册，可以在多个会话之间共享
+type TiktokenCounter struct {
+	mu       sync.RWMutex
+	encoders map[string]TiktokenEncoder
+	fallback TokenCounter
+}
+
+// NewTiktokenCounter 创建按模型计数的TiktokenCounter，fallback为nil时使用HeuristicTokenCounter
+func NewTiktokenCounter(fallback TokenCounter) *TiktokenCounter {
+	if fallback == nil {
+		fallback = HeuristicTokenCounter{}
+	}
+	return &TiktokenCounter{encoders: make(map[string]TiktokenEncoder), fallback: fallback}
+}
+
+// SetEncoder 为模型设置编码器，model按前缀匹配并优先使用最长的前缀（如"gpt-4o"也用于"gpt-4o-mini"）
+// model为空字符串时作为所有模型的默认编码器，encoder为nil时移除
+func (c *TiktokenCounter) SetEncoder(model string, encoder TiktokenEncoder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if encoder == nil {
+		delete(c.encoders, model)
+		return
+	}
+	c.encoders[model] = encoder
+}
+
+// CountTokens 使用模型对应的编码器计数，特殊token（如<|endoftext|>）按普通文本编码
+func (c *TiktokenCounter) CountTokens(model string, text string) int {
+	if text == "" {
+		return 0
+	}
+	if encoder := c.encoder(model); encoder != nil {
+		return len(encoder.Encode(text, nil, nil))
+	}
+	return c.fallback.CountTokens(model, text)
+}
+
+// encoder 查找前缀最长的编码器
+func (c *TiktokenCounter) encoder(model string) TiktokenEncoder {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var found TiktokenEncoder
+	longest := -1
+	for prefix, encoder := range c.encoders {
+		if len(prefix) > longest && strings.HasPrefix(model, prefix) {
+			found, longest = encoder, len(prefix)
+		}
+	}
+	return found
+}
+
+// SetTokenCounter 设置token计数器，为nil时使用HeuristicTokenCounter
+// 开启ServerTokenCounting时，截断仍按服务端的总数校准各部分的计数
+func (cm *ConversationManager) SetTokenCounter(counter TokenCounter) {
+	cm.tokenCounter = counter
+}
+
+// CountTokens 使用设置的计数器计算文本在model下的token数
+func (cm *ConversationManager) CountTokens(model string, text string) int {
+	if text == "" {
+		return 0
+	}
+	if cm.tokenCounter == nil {
+		return estimateTokens(text)
+	}
+	return cm.tokenCounter.CountTokens(model, text)
+}
+
+// CountMessageTokens 计算消息在model下的token数，图片按尺寸估算，每个工具调用另加约50个token
+func (cm *ConversationManager) CountMessageTokens(model string, messages []general.Message) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += cm.calculateMessageTokens(model, msg)
+	}
+	return tokens
+}
+
+// estimateTokens 粗略估算文本的token数，规则见HeuristicTokenCounter
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, char := range text {
+		if char < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4
+}
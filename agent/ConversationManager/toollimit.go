@@ -0,0 +1,64 @@
+package ConversationManager
+
+import (
+	"context"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// ToolLimitPolicy 函数调用次数超过MaxFunctionCallingNums时的处理策略
+type ToolLimitPolicy int
+
+const (
+	// ToolLimitExecute 默认策略，执行超限的那次工具调用并记录结果，然后结束对话（结果不会再发送给模型）
+	ToolLimitExecute ToolLimitPolicy = iota
+	// ToolLimitSkip 不执行超限的工具调用，记录未执行的结果后结束对话
+	ToolLimitSkip
+	// ToolLimitConfirm 每次超限时调用确认函数，同意时执行并继续对话，拒绝或未设置确认函数时按ToolLimitSkip处理
+	ToolLimitConfirm
+)
+
+// ToolLimitConfirmer 超限时的确认函数，count为包括本次在内的函数调用次数，返回true时执行并继续对话
+type ToolLimitConfirmer func(ctx context.Context, toolCall general.ToolCall, count int) bool
+
+// SetToolLimitPolicy 设置函数调用次数超限时的处理策略，confirmer只在ToolLimitConfirm时使用
+func (cm *ConversationManager) SetToolLimitPolicy(policy ToolLimitPolicy, confirmer ToolLimitConfirmer) {
+	cm.toolLimitPolicy = policy
+	cm.toolLimitConfirmer = confirmer
+}
+
+// confirmOverLimit 超限时询问是否继续执行，只有ToolLimitConfirm且确认函数同意时返回true
+func (cm *ConversationManager) confirmOverLimit(ctx context.Context, toolCall general.ToolCall, count int) bool {
+	return cm.toolLimitPolicy == ToolLimitConfirm && cm.toolLimitConfirmer != nil && cm.toolLimitConfirmer(ctx, toolCall, count)
+}
+
+// handleOverLimit 按策略处理超限的工具调用，toolCalls为本批次中从超限那次开始的剩余调用
+// 剩余的调用都会记录未执行的结果，保持工具调用和结果的配对完整
+func (cm *ConversationManager) handleOverLimit(ctx context.Context, provider general.Provider, toolCalls []general.ToolCall, info_chan chan general.Message) error {
+	for i, toolCall := range toolCalls {
+		if i == 0 && cm.toolLimitPolicy == ToolLimitExecute {
+			if err := cm.HandleToolCall(ctx, provider, toolCall, info_chan); err != nil && !cm.recoverToolError(ctx, toolCall, err, info_chan) {
+				return err
+			}
+			continue
+		}
+		cm.appendToolResult(ctx, toolCall, cm.text(MsgToolLimitSkipped), info_chan)
+	}
+	return nil
+}
+
+// appendToolResult 将工具结果添加到历史，并发送到info_chan和事件通道
+func (cm *ConversationManager) appendToolResult(ctx context.Context, toolCall general.ToolCall, result string, info_chan chan general.Message) {
+	toolMsg := cm.appendMessage(ctx, general.Message{
+		Role: general.RoleTool,
+		Content: []general.Content{
+			{
+				Type:   general.ContentTypeToolRes,
+				Text:   result,
+				ToolID: toolCall.ID,
+			},
+		},
+	})
+	cm.deliverInfo(info_chan, toolMsg)
+	cm.emit(Event{Type: EventToolResult, Role: general.RoleTool, ToolCall: &toolCall, ToolResult: result})
+}
@@ -0,0 +1,159 @@
+package ConversationManager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// scriptedServer 兼容OpenAI接口的测试服务，第i次请求返回batches[i]个工具调用，之后返回最终回复
+type scriptedServer struct {
+	mu       sync.Mutex
+	batches  []int
+	requests int
+	nextID   int
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := map[string]interface{}{"role": "assistant", "content": "done"}
+	finishReason := "stop"
+	if s.requests < len(s.batches) {
+		var toolCalls []map[string]interface{}
+		for i := 0; i < s.batches[s.requests]; i++ {
+			s.nextID++
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       fmt.Sprintf("call_%d", s.nextID),
+				"type":     "function",
+				"function": map[string]string{"name": "tick", "arguments": "{}"},
+			})
+		}
+		message = map[string]interface{}{"role": "assistant", "content": nil, "tool_calls": toolCalls}
+		finishReason = "tool_calls"
+	}
+	s.requests++
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      "chatcmpl-test",
+		"object":  "chat.completion",
+		"model":   "gpt-4o",
+		"choices": []map[string]interface{}{{"index": 0, "message": message, "finish_reason": finishReason}},
+		"usage":   map[string]int{"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2},
+	})
+}
+
+// toolLimitRun 一次Chat的结果
+type toolLimitRun struct {
+	stopReason general.StopReason
+	executed   int // tick实际执行的次数
+	requests   int // 发送给模型的请求数
+	skipped    int // 记录为超限未执行的工具结果数
+	calls      int // 历史中的工具调用数
+	results    int // 历史中的工具结果数
+}
+
+func runToolLimit(t *testing.T, max int, batches []int, policy ToolLimitPolicy, confirmer ToolLimitConfirmer) toolLimitRun {
+	t.Helper()
+	script := &scriptedServer{batches: batches}
+	server := httptest.NewServer(script)
+	defer server.Close()
+
+	manager := general.NewAgentManager()
+	if err := manager.AddProvider(&general.ProviderConfig{Provider: general.ProviderOpenAI, APIKey: "test", BaseURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	cm := NewConversationManager(manager)
+	cm.SetMaxFunctionCallingNums(max)
+	cm.SetToolLimitPolicy(policy, confirmer)
+	run := toolLimitRun{}
+	if err := cm.RegisterFunctionSimple("tick", "count a call", func() string {
+		run.executed++
+		return "ok"
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stopReason, err, _ := cm.Chat(context.Background(), general.ProviderOpenAI, "gpt-4o", "go", nil, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	run.stopReason = general.StopReason(stopReason)
+	run.requests = script.requests
+	for _, msg := range cm.history {
+		run.calls += len(msg.ToolCalls)
+		if msg.Role == general.RoleTool {
+			run.results++
+			if msg.Content[0].Text == cm.text(MsgToolLimitSkipped) {
+				run.skipped++
+			}
+		}
+	}
+	return run
+}
+
+func TestToolLimitBoundary(t *testing.T) {
+	approve := func(ctx context.Context, toolCall general.ToolCall, count int) bool { return true }
+	deny := func(ctx context.Context, toolCall general.ToolCall, count int) bool { return false }
+
+	tests := []struct {
+		name      string
+		batches   []int
+		policy    ToolLimitPolicy
+		confirmer ToolLimitConfirmer
+		want      toolLimitRun
+	}{
+		// 恰好MaxFunctionCallingNums次，所有策略都正常结束
+		{"execute at limit", []int{1, 1}, ToolLimitExecute, nil, toolLimitRun{stopReason: general.StopReasonSuccess, executed: 2, requests: 3}},
+		{"skip at limit", []int{1, 1}, ToolLimitSkip, nil, toolLimitRun{stopReason: general.StopReasonSuccess, executed: 2, requests: 3}},
+		{"confirm at limit", []int{1, 1}, ToolLimitConfirm, deny, toolLimitRun{stopReason: general.StopReasonSuccess, executed: 2, requests: 3}},
+
+		// 第N+1次调用
+		{"execute over limit", []int{1, 1, 1}, ToolLimitExecute, nil, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 3, requests: 3}},
+		{"skip over limit", []int{1, 1, 1}, ToolLimitSkip, nil, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 2, requests: 3, skipped: 1}},
+		{"confirm approved over limit", []int{1, 1, 1}, ToolLimitConfirm, approve, toolLimitRun{stopReason: general.StopReasonSuccess, executed: 3, requests: 4}},
+		{"confirm denied over limit", []int{1, 1, 1}, ToolLimitConfirm, deny, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 2, requests: 3, skipped: 1}},
+		{"confirm without confirmer", []int{1, 1, 1}, ToolLimitConfirm, nil, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 2, requests: 3, skipped: 1}},
+
+		// 一个批次中途越过上限，剩余的调用都有结果
+		{"execute batch crossing limit", []int{4}, ToolLimitExecute, nil, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 3, requests: 1, skipped: 1}},
+		{"skip batch crossing limit", []int{4}, ToolLimitSkip, nil, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 2, requests: 1, skipped: 2}},
+		{"confirm approved batch crossing limit", []int{4}, ToolLimitConfirm, approve, toolLimitRun{stopReason: general.StopReasonSuccess, executed: 4, requests: 2}},
+		{"confirm denied batch crossing limit", []int{4}, ToolLimitConfirm, deny, toolLimitRun{stopReason: general.StopReasonMaxFunctionCalls, executed: 2, requests: 1, skipped: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runToolLimit(t, 2, tt.batches, tt.policy, tt.confirmer)
+			if got.calls != got.results {
+				t.Errorf("%d tool calls but %d results", got.calls, got.results)
+			}
+			got.calls, got.results = 0, 0
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolLimitConfirmCount(t *testing.T) {
+	var counts []int
+	confirmer := func(ctx context.Context, toolCall general.ToolCall, count int) bool {
+		counts = append(counts, count)
+		return len(counts) < 2
+	}
+	got := runToolLimit(t, 2, []int{1, 3}, ToolLimitConfirm, confirmer)
+	// 第3次调用同意，第4次拒绝
+	if fmt.Sprint(counts) != "[3 4]" {
+		t.Errorf("confirmer counts = %v, want [3 4]", counts)
+	}
+	if got.executed != 3 || got.skipped != 1 || got.stopReason != general.StopReasonMaxFunctionCalls {
+		t.Errorf("got %+v", got)
+	}
+}
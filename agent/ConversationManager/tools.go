@@ -0,0 +1,249 @@
+package ConversationManager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// DuplicateToolPolicy 注册同名工具时的处理策略
+type DuplicateToolPolicy int
+
+const (
+	// DuplicateToolReject 默认策略，拒绝注册并返回*DuplicateToolError
+	DuplicateToolReject DuplicateToolPolicy = iota
+	// DuplicateToolReplace 用新的工具替换已注册的同名工具
+	DuplicateToolReplace
+	// DuplicateToolRename 为新的工具添加序号后缀（如search_2），两个工具都保留，实际名称可通过ListToolNames获取
+	DuplicateToolRename
+)
+
+// DuplicateToolError 注册的工具与已注册的工具同名
+type DuplicateToolError struct {
+	Name   string
+	locale Locale
+}
+
+func (e *DuplicateToolError) Error() string {
+	return Localize(e.locale, MsgErrDuplicateTool, e.Name)
+}
+
+// SetDuplicateToolPolicy 设置注册同名工具（包括MCP工具）时的处理策略
+func (cm *ConversationManager) SetDuplicateToolPolicy(policy DuplicateToolPolicy) {
+	cm.duplicateTools = policy
+}
+
+// HasTool 判断是否已注册指定名称的工具（包括MCP工具和内置的ask_user工具）
+func (cm *ConversationManager) HasTool(name string) bool {
+	_, exists := cm.funcSchemas[name]
+	return exists
+}
+
+// ListToolNames 按注册顺序列出所有工具的名称
+func (cm *ConversationManager) ListToolNames() []string {
+	names := make([]string, 0, len(cm.tools))
+	for _, tool := range cm.tools {
+		names = append(names, tool.Function.Name)
+	}
+	return names
+}
+
+// registerTool 保存工具定义和函数，按DuplicateToolPolicy处理同名工具，返回实际注册的名称
+func (cm *ConversationManager) registerTool(tool general.Tool, fn reflect.Value, paramNames []string) (string, error) {
+	name := tool.Function.Name
+	if cm.HasTool(name) {
+		switch cm.duplicateTools {
+		case DuplicateToolReplace:
+			// 保持工具原来的顺序
+			cm.registeredFuncs[name] = fn
+			cm.funcSchemas[name] = tool
+			cm.funcParamNames[name] = paramNames
+			delete(cm.funcReturnNames, name)
+			delete(cm.toolProxies, name)
+			for i := range cm.tools {
+				if cm.tools[i].Function.Name == name {
+					cm.tools[i] = tool
+				}
+			}
+			return name, nil
+		case DuplicateToolRename:
+			for i := 2; cm.HasTool(name); i++ {
+				name = fmt.Sprintf("%s_%d", tool.Function.Name, i)
+			}
+			tool.Function.Name = name
+		default:
+			return "", &DuplicateToolError{Name: name, locale: cm.Locale()}
+		}
+	}
+
+	cm.registeredFuncs[name] = fn
+	cm.funcSchemas[name] = tool
+	cm.funcParamNames[name] = paramNames
+	cm.tools = append(cm.tools, tool)
+	return name, nil
+}
+
+// removeTool 移除工具定义和函数
+func (cm *ConversationManager) removeTool(name string) {
+	delete(cm.registeredFuncs, name)
+	delete(cm.funcSchemas, name)
+	delete(cm.funcParamNames, name)
+	delete(cm.funcReturnNames, name)
+	delete(cm.toolProxies, name)
+	cm.removeFromToolGroups(name)
+	for i, tool := range cm.tools {
+		if tool.Function.Name == name {
+			cm.tools = append(cm.tools[:i:i], cm.tools[i+1:]...)
+			break
+		}
+	}
+}
+
+// toolGroupsKey WithToolGroups在context中保存工具组的键
+type toolGroupsKey struct{}
+
+// AddToolsToGroup 将已注册的工具加入工具组（如filesystem、web、db），一个工具可以属于多个组
+// 设置了启用的工具组时只发送这些组中的工具，未加入任何组的工具总是发送
+func (cm *ConversationManager) AddToolsToGroup(group string, names ...string) error {
+	if group == "" {
+		return cm.errorf(nil, MsgErrEmptyToolGroup)
+	}
+	for _, name := range names {
+		if !cm.HasTool(name) {
+			return cm.errorf(nil, MsgErrToolNotRegistered, name)
+		}
+	}
+	if cm.toolGroups == nil {
+		cm.toolGroups = make(map[string][]string)
+	}
+	for _, name := range names {
+		if !containsString(cm.toolGroups[group], name) {
+			cm.toolGroups[group] = append(cm.toolGroups[group], name)
+		}
+	}
+	return nil
+}
+
+// ToolGroups 获取所有工具组及其中的工具名称
+func (cm *ConversationManager) ToolGroups() map[string][]string {
+	groups := make(map[string][]string, len(cm.toolGroups))
+	for group, names := range cm.toolGroups {
+		groups[group] = append([]string(nil), names...)
+	}
+	return groups
+}
+
+// DefineToolProfile 定义工具配置，即一组工具组的组合（如research包含web和db），可以代替组名使用
+func (cm *ConversationManager) DefineToolProfile(profile string, groups ...string) {
+	if cm.toolProfiles == nil {
+		cm.toolProfiles = make(map[string][]string)
+	}
+	cm.toolProfiles[profile] = append([]string(nil), groups...)
+}
+
+// SetActiveToolGroups 设置本会话启用的工具组或工具配置，不传参数时恢复为发送所有工具
+func (cm *ConversationManager) SetActiveToolGroups(groups ...string) error {
+	if len(groups) == 0 {
+		cm.activeGroups = nil
+		return nil
+	}
+	for _, group := range cm.expandToolGroups(groups) {
+		if _, exists := cm.toolGroups[group]; !exists {
+			return cm.errorf(nil, MsgErrUnknownToolGroup, group)
+		}
+	}
+	cm.activeGroups = append([]string(nil), groups...)
+	return nil
+}
+
+// WithToolGroups 返回只在本次Chat中启用指定工具组或工具配置的context，优先于SetActiveToolGroups的设置
+func WithToolGroups(ctx context.Context, groups ...string) context.Context {
+	return context.WithValue(ctx, toolGroupsKey{}, groups)
+}
+
+// activeTools 获取本次请求发送的工具：启用的工具组中的工具和未分组的工具，未设置启用的工具组时发送所有工具
+func (cm *ConversationManager) activeTools(ctx context.Context) []general.Tool {
+	groups := cm.activeGroups
+	if callGroups, ok := ctx.Value(toolGroupsKey{}).([]string); ok {
+		groups = callGroups
+	}
+	if groups == nil {
+		return cm.allowedTools(cm.tools)
+	}
+
+	enabled := make(map[string]bool)
+	for _, group := range cm.expandToolGroups(groups) {
+		for _, name := range cm.toolGroups[group] {
+			enabled[name] = true
+		}
+	}
+	grouped := make(map[string]bool)
+	for _, names := range cm.toolGroups {
+		for _, name := range names {
+			grouped[name] = true
+		}
+	}
+	tools := make([]general.Tool, 0, len(cm.tools))
+	for _, tool := range cm.tools {
+		if enabled[tool.Function.Name] || !grouped[tool.Function.Name] {
+			tools = append(tools, tool)
+		}
+	}
+	return cm.allowedTools(tools)
+}
+
+// SetToolAllowlist 只允许使用列出的工具（包括MCP工具和内置工具），其他工具不发送给模型，模型仍然调用时返回工具不可用
+// 与工具组同时生效，用于按租户或用户限制可用的工具；不传参数时取消限制
+func (cm *ConversationManager) SetToolAllowlist(names ...string) {
+	if len(names) == 0 {
+		cm.toolAllowlist = nil
+		return
+	}
+	cm.toolAllowlist = make(map[string]bool, len(names))
+	for _, name := range names {
+		cm.toolAllowlist[name] = true
+	}
+}
+
+// toolAllowed 工具是否在允许列表中
+func (cm *ConversationManager) toolAllowed(name string) bool {
+	return cm.toolAllowlist == nil || cm.toolAllowlist[name]
+}
+
+// allowedTools 返回tools中允许使用的工具的副本
+func (cm *ConversationManager) allowedTools(tools []general.Tool) []general.Tool {
+	allowed := make([]general.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if cm.toolAllowed(tool.Function.Name) {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
+
+// expandToolGroups 将工具配置展开为工具组
+func (cm *ConversationManager) expandToolGroups(names []string) []string {
+	var groups []string
+	for _, name := range names {
+		if profile, ok := cm.toolProfiles[name]; ok {
+			groups = append(groups, profile...)
+		} else {
+			groups = append(groups, name)
+		}
+	}
+	return groups
+}
+
+// removeFromToolGroups 从所有工具组中移除工具
+func (cm *ConversationManager) removeFromToolGroups(name string) {
+	for group, names := range cm.toolGroups {
+		for i, existing := range names {
+			if existing == name {
+				cm.toolGroups[group] = append(names[:i:i], names[i+1:]...)
+				break
+			}
+		}
+	}
+}
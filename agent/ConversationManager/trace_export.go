@@ -0,0 +1,301 @@
+package ConversationManager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// JSONTraceExporter 将每次对话的追踪以一行JSON写入io.Writer，可以导入本地的追踪查看工具
+type JSONTraceExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONTraceExporter 创建写入w的JSON Lines追踪导出器
+func NewJSONTraceExporter(w io.Writer) *JSONTraceExporter {
+	return &JSONTraceExporter{w: w}
+}
+
+// ExportTrace 写入一行JSON
+func (e *JSONTraceExporter) ExportTrace(ctx context.Context, trace *Trace) error {
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// LangSmithExporter 通过LangSmith的/runs/batch接口导出追踪，对话、模型请求和工具调用分别为chain、llm和tool类型的run
+type LangSmithExporter struct {
+	APIKey     string
+	Project    string       // 项目名称，为空时为default
+	Endpoint   string       // 接口地址，为空时为https://api.smith.langchain.com
+	HTTPClient *http.Client // 为nil时使用http.DefaultClient
+}
+
+// NewLangSmithExporter 创建LangSmith追踪导出器
+func NewLangSmithExporter(apiKey, project string) *LangSmithExporter {
+	return &LangSmithExporter{APIKey: apiKey, Project: project}
+}
+
+// ExportTrace 以一次批量请求上传追踪中的所有run
+func (e *LangSmithExporter) ExportTrace(ctx context.Context, trace *Trace) error {
+	endpoint := strings.TrimRight(e.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://api.smith.langchain.com"
+	}
+	project := e.Project
+	if project == "" {
+		project = "default"
+	}
+
+	root := trace.Spans[0]
+	rootOrder := langSmithDottedOrder(root)
+	runs := make([]map[string]interface{}, 0, len(trace.Spans))
+	for _, span := range trace.Spans {
+		run := map[string]interface{}{
+			"id":           traceUUID(span.ID),
+			"trace_id":     traceUUID(root.ID),
+			"name":         span.Name,
+			"start_time":   span.Start.UTC().Format(time.RFC3339Nano),
+			"end_time":     span.End.UTC().Format(time.RFC3339Nano),
+			"session_name": project,
+			"dotted_order": rootOrder,
+		}
+		metadata := map[string]interface{}{"session_id": trace.SessionID, "turn": trace.Turn}
+		for key, value := range span.Metadata {
+			metadata[key] = value
+		}
+		if span.Provider != "" {
+			metadata["ls_provider"] = span.Provider
+		}
+		if span.Model != "" {
+			metadata["ls_model_name"] = span.Model
+		}
+		run["extra"] = map[string]interface{}{"metadata": metadata}
+		if span.Error != "" {
+			run["error"] = span.Error
+		}
+
+		switch span.Kind {
+		case SpanKindLLM:
+			run["run_type"] = "llm"
+			run["inputs"] = map[string]interface{}{"messages": traceMessages(span.Input)}
+			outputs := map[string]interface{}{"messages": traceMessages(span.Output)}
+			if span.Usage != nil {
+				outputs["usage_metadata"] = map[string]interface{}{
+					"input_tokens":  span.Usage.PromptTokens,
+					"output_tokens": span.Usage.CompletionTokens,
+					"total_tokens":  span.Usage.TotalTokens,
+				}
+			}
+			run["outputs"] = outputs
+		case SpanKindTool:
+			run["run_type"] = "tool"
+			run["inputs"] = map[string]interface{}{"input": spanJSON(span.Input)}
+			run["outputs"] = map[string]interface{}{"output": span.Output}
+		default:
+			run["run_type"] = "chain"
+			run["inputs"] = map[string]interface{}{"input": traceMessages(span.Input)}
+			run["outputs"] = map[string]interface{}{"messages": traceMessages(span.Output)}
+		}
+		if span.ParentID != "" {
+			run["parent_run_id"] = traceUUID(span.ParentID)
+			run["dotted_order"] = rootOrder + "." + langSmithDottedOrder(span)
+		}
+		runs = append(runs, run)
+	}
+
+	headers := map[string]string{"x-api-key": e.APIKey}
+	return postTraceJSON(ctx, e.HTTPClient, endpoint+"/runs/batch", headers, map[string]interface{}{"post": runs}, nil)
+}
+
+// langSmithDottedOrder LangSmith用于排序和表示层级的run标识：开始时间（微秒）加run ID
+func langSmithDottedOrder(span Span) string {
+	start := span.Start.UTC()
+	return fmt.Sprintf("%s%06dZ%s", start.Format("20060102T150405"), start.Nanosecond()/1000, traceUUID(span.ID))
+}
+
+// OpenAITraceExporter 以OpenAI Agents SDK的追踪格式上传到OpenAI的Traces界面，
+// 对话、模型请求和工具调用分别为agent、generation和function类型的span
+type OpenAITraceExporter struct {
+	APIKey       string
+	BaseURL      string       // 接口地址，为空时为https://api.openai.com/v1
+	WorkflowName string       // 追踪的工作流名称，为空时为GoAgent
+	HTTPClient   *http.Client // 为nil时使用http.DefaultClient
+}
+
+// NewOpenAITraceExporter 创建OpenAI追踪导出器
+func NewOpenAITraceExporter(apiKey, workflowName string) *OpenAITraceExporter {
+	return &OpenAITraceExporter{APIKey: apiKey, WorkflowName: workflowName}
+}
+
+// ExportTrace 上传追踪和其中的所有span
+func (e *OpenAITraceExporter) ExportTrace(ctx context.Context, trace *Trace) error {
+	baseURL := strings.TrimRight(e.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	workflow := e.WorkflowName
+	if workflow == "" {
+		workflow = "GoAgent"
+	}
+
+	traceID := "trace_" + trace.ID
+	items := []map[string]interface{}{{
+		"object":        "trace",
+		"id":            traceID,
+		"workflow_name": workflow,
+		"group_id":      trace.SessionID,
+		"metadata":      map[string]interface{}{"turn": fmt.Sprint(trace.Turn)},
+	}}
+	var tools []string
+	for _, span := range trace.Spans {
+		if span.Kind == SpanKindTool && !containsString(tools, span.Name) {
+			tools = append(tools, span.Name)
+		}
+	}
+	for _, span := range trace.Spans {
+		item := map[string]interface{}{
+			"object":     "trace.span",
+			"id":         openAISpanID(span.ID),
+			"trace_id":   traceID,
+			"parent_id":  nil,
+			"started_at": span.Start.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+			"ended_at":   span.End.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		}
+		if span.ParentID != "" {
+			item["parent_id"] = openAISpanID(span.ParentID)
+		}
+		if span.Error != "" {
+			item["error"] = map[string]interface{}{"message": span.Error, "data": nil}
+		}
+
+		switch span.Kind {
+		case SpanKindLLM:
+			data := map[string]interface{}{
+				"type":   "generation",
+				"input":  traceMessages(span.Input),
+				"output": traceMessages(span.Output),
+				"model":  span.Model,
+			}
+			if span.Usage != nil {
+				data["usage"] = map[string]interface{}{"input_tokens": span.Usage.PromptTokens, "output_tokens": span.Usage.CompletionTokens}
+			}
+			item["span_data"] = data
+		case SpanKindTool:
+			input, _ := span.Input.(json.RawMessage)
+			output, _ := span.Output.(string)
+			item["span_data"] = map[string]interface{}{"type": "function", "name": span.Name, "input": string(input), "output": output}
+		default:
+			item["span_data"] = map[string]interface{}{"type": "agent", "name": workflow, "tools": tools, "handoffs": []string{}, "output_type": "str"}
+		}
+		items = append(items, item)
+	}
+
+	headers := map[string]string{"Authorization": "Bearer " + e.APIKey, "OpenAI-Beta": "traces=v1"}
+	return postTraceJSON(ctx, e.HTTPClient, baseURL+"/traces/ingest", headers, map[string]interface{}{"data": items}, nil)
+}
+
+// openAISpanID OpenAI追踪的span ID格式：span_加24位十六进制
+func openAISpanID(id string) string {
+	if len(id) > 24 {
+		id = id[:24]
+	}
+	return "span_" + id
+}
+
+// traceMessages 将span中的消息转换为OpenAI Chat格式的消息列表，便于追踪界面渲染，其他值原样返回
+func traceMessages(value interface{}) interface{} {
+	var messages []general.Message
+	switch v := value.(type) {
+	case general.Message:
+		messages = []general.Message{v}
+	case []general.Message:
+		messages = v
+	case []general.Content:
+		messages = []general.Message{{Role: general.RoleUser, Content: v}}
+	default:
+		return spanJSON(value)
+	}
+
+	result := make([]map[string]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		item := map[string]interface{}{"role": msg.Role}
+		if msg.Name != "" {
+			item["name"] = msg.Name
+		}
+		var texts []string
+		for _, content := range msg.Content {
+			switch content.Type {
+			case general.ContentTypeText, general.ContentTypeToolRes:
+				texts = append(texts, content.Text)
+			case general.ContentTypeImageURL:
+				texts = append(texts, "[图片]")
+			}
+			if content.Type == general.ContentTypeToolRes {
+				item["tool_call_id"] = content.ToolID
+			}
+		}
+		item["content"] = strings.Join(texts, "\n")
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]map[string]interface{}, 0, len(msg.ToolCalls))
+			for _, call := range msg.ToolCalls {
+				calls = append(calls, map[string]interface{}{
+					"id":       call.ID,
+					"type":     "function",
+					"function": map[string]interface{}{"name": call.Function.Name, "arguments": string(call.Function.Arguments)},
+				})
+			}
+			item["tool_calls"] = calls
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// postTraceJSON 以JSON发送追踪数据，状态码不是2xx时返回包含响应内容的错误，out不为nil时解析响应
+func postTraceJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("序列化追踪失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("上传追踪失败 (%d): %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("解析追踪上传响应失败: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package ConversationManager
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// SpanKind span的类型
+type SpanKind string
+
+const (
+	SpanKindAgent SpanKind = "agent" // 一次对话，是追踪的根span
+	SpanKindLLM   SpanKind = "llm"   // 一次模型请求
+	SpanKindTool  SpanKind = "tool"  // 一次工具调用
+)
+
+// Span 追踪中的一个步骤
+type Span struct {
+	ID       string                 `json:"id"`
+	ParentID string                 `json:"parent_id,omitempty"`
+	Kind     SpanKind               `json:"kind"`
+	Name     string                 `json:"name"`
+	Start    time.Time              `json:"start"`
+	End      time.Time              `json:"end"`
+	Input    interface{}            `json:"input,omitempty"`  // 对话为用户消息，模型请求为请求的消息，工具调用为参数
+	Output   interface{}            `json:"output,omitempty"` // 对话为本轮新增的消息，模型请求为回复消息，工具调用为结果
+	Error    string                 `json:"error,omitempty"`
+	Provider general.Provider       `json:"provider,omitempty"`
+	Model    string                 `json:"model,omitempty"`
+	Usage    *general.Usage         `json:"usage,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Trace 一次对话的追踪，Spans[0]为对话的根span，其余span的ParentID指向根span
+type Trace struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Turn      int       `json:"turn"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Spans     []Span    `json:"spans"`
+}
+
+// TraceExporter 追踪导出器，每次对话结束后在后台调用
+type TraceExporter interface {
+	ExportTrace(ctx context.Context, trace *Trace) error
+}
+
+// TraceExporterFunc 将函数适配为TraceExporter
+type TraceExporterFunc func(ctx context.Context, trace *Trace) error
+
+// ExportTrace 调用函数本身
+func (f TraceExporterFunc) ExportTrace(ctx context.Context, trace *Trace) error {
+	return f(ctx, trace)
+}
+
+// traceExportTimeout 单个导出器导出一次追踪的超时时间
+const traceExportTimeout = 30 * time.Second
+
+// tracer 收集进行中的对话的span
+type tracer struct {
+	mu        sync.Mutex
+	exporters []TraceExporter
+	trace     *Trace         // 进行中的追踪，未设置导出器时为nil
+	last      string         // 最近一次结束的追踪的ID
+	exports   sync.WaitGroup // 后台进行中的导出
+}
+
+// AddTraceExporter 添加追踪导出器，每次对话（Chat或从检查点恢复）结束后在后台导出该对话的模型请求和工具调用
+// 导出失败只记录日志，不影响对话；Shutdown和FlushTraces会等待进行中的导出
+func (cm *ConversationManager) AddTraceExporter(exporter TraceExporter) {
+	cm.tracer.mu.Lock()
+	defer cm.tracer.mu.Unlock()
+	cm.tracer.exporters = append(cm.tracer.exporters, exporter)
+}
+
+// ClearTraceExporters 移除所有追踪导出器
+func (cm *ConversationManager) ClearTraceExporters() {
+	cm.tracer.mu.Lock()
+	defer cm.tracer.mu.Unlock()
+	cm.tracer.exporters = nil
+}
+
+// FlushTraces 等待后台进行中的追踪导出完成
+func (cm *ConversationManager) FlushTraces(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		cm.tracer.exports.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("等待追踪导出超时: %w", ctx.Err())
+	}
+}
+
+// LastTraceID 返回最近一次导出的追踪的ID，用于之后给该次对话打分（如LangfuseExporter.Score），没有时为空
+func (cm *ConversationManager) LastTraceID() string {
+	cm.tracer.mu.Lock()
+	defer cm.tracer.mu.Unlock()
+	return cm.tracer.last
+}
+
+// begin 开始一次对话的追踪，没有导出器时不记录
+func (t *tracer) begin(sessionID string, turn int, provider general.Provider, model string, input interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.exporters) == 0 {
+		t.trace = nil
+		return
+	}
+	now := time.Now()
+	t.trace = &Trace{ID: newTraceID(), SessionID: sessionID, Turn: turn, Start: now}
+	t.trace.Spans = append(t.trace.Spans, Span{
+		ID:       newTraceID(),
+		Kind:     SpanKindAgent,
+		Name:     fmt.Sprintf("对话 %d", turn),
+		Start:    now,
+		Input:    input,
+		Provider: provider,
+		Model:    model,
+	})
+}
+
+// startSpan 开始一个子span，返回其索引，没有进行中的追踪时返回-1
+func (t *tracer) startSpan(kind SpanKind, name string, provider general.Provider, model string, input interface{}) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.trace == nil {
+		return -1
+	}
+	t.trace.Spans = append(t.trace.Spans, Span{
+		ID:       newTraceID(),
+		ParentID: t.trace.Spans[0].ID,
+		Kind:     kind,
+		Name:     name,
+		Start:    time.Now(),
+		Input:    input,
+		Provider: provider,
+		Model:    model,
+	})
+	return len(t.trace.Spans) - 1
+}
+
+// endSpan 结束子span
+func (t *tracer) endSpan(index int, output interface{}, usage *general.Usage, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.trace == nil || index < 0 || index >= len(t.trace.Spans) {
+		return
+	}
+	span := &t.trace.Spans[index]
+	span.End = time.Now()
+	span.Output = output
+	span.Usage = usage
+	if err != nil {
+		span.Error = err.Error()
+	}
+}
+
+// end 结束对话的追踪并在后台交给所有导出器
+func (t *tracer) end(output interface{}, usage *general.Usage, stopReason general.StopReason, err error) {
+	t.mu.Lock()
+	trace := t.trace
+	exporters := append([]TraceExporter(nil), t.exporters...)
+	t.trace = nil
+	if trace != nil {
+		t.last = trace.ID
+	}
+	t.mu.Unlock()
+	if trace == nil {
+		return
+	}
+
+	trace.End = time.Now()
+	root := &trace.Spans[0]
+	root.End = trace.End
+	root.Output = output
+	root.Usage = usage
+	root.Metadata = map[string]interface{}{"stop_reason": stopReason}
+	if err != nil {
+		root.Error = err.Error()
+	}
+	for _, exporter := range exporters {
+		t.exports.Add(1)
+		go func(exporter TraceExporter) {
+			defer t.exports.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+			defer cancel()
+			if err := exporter.ExportTrace(ctx, trace); err != nil {
+				log.Printf("导出追踪 %s 失败: %v", trace.ID, err)
+			}
+		}(exporter)
+	}
+}
+
+// beginTrace 开始记录一次对话的运行记录和追踪
+func (cm *ConversationManager) beginTrace(provider general.Provider, model string, input interface{}) {
+	cm.runLog.beginTurn(cm.turn, provider, model)
+	cm.tracer.begin(cm.sessionID, cm.turn, provider, model, input)
+}
+
+// endTrace 结束记录一次对话，startIndex为本轮开始前的历史长度
+func (cm *ConversationManager) endTrace(startIndex int, stopReason general.StopReason, err error) {
+	cm.runLog.endTurn(stopReason, err)
+	if !cm.tracer.active() {
+		return
+	}
+	var output []general.Message
+	if startIndex >= 0 && startIndex <= len(cm.history) {
+		output = append(output, cm.history[startIndex:]...)
+	}
+	usage := cm.runLog.lastTurnUsage()
+	cm.tracer.end(output, &usage, stopReason, err)
+}
+
+// startLLMSpan 开始记录一次模型请求，输入为系统提示词和请求的消息
+func (cm *ConversationManager) startLLMSpan(provider general.Provider, model string, req *general.ChatRequest) int {
+	if !cm.tracer.active() {
+		return -1
+	}
+	messages := make([]general.Message, 0, len(req.Messages)+1)
+	if req.SystemPrompt != "" {
+		messages = append(messages, general.Message{
+			Role:    general.RoleSystem,
+			Content: []general.Content{{Type: general.ContentTypeText, Text: req.SystemPrompt}},
+		})
+	}
+	messages = append(messages, req.Messages...)
+	return cm.tracer.startSpan(SpanKindLLM, string(provider)+"/"+model, provider, model, messages)
+}
+
+// endLLMSpan 结束记录模型请求，输出为回复消息
+func (cm *ConversationManager) endLLMSpan(index int, provider general.Provider, model string, resp *general.ChatResponse, err error) {
+	if index < 0 {
+		return
+	}
+	var output interface{}
+	var usage *general.Usage
+	if resp != nil {
+		if len(resp.Choices) > 0 {
+			output = resp.Choices[0].Message
+		}
+		usage = &resp.Usage
+	}
+	cm.tracer.mu.Lock()
+	if trace := cm.tracer.trace; trace != nil && index < len(trace.Spans) {
+		// 回退到草稿模型或备用模型时，记录实际回复的提供商和模型
+		trace.Spans[index].Provider = provider
+		trace.Spans[index].Model = model
+	}
+	cm.tracer.mu.Unlock()
+	cm.tracer.endSpan(index, output, usage, err)
+}
+
+// startToolSpan 开始记录一次工具调用，输入为工具参数
+func (cm *ConversationManager) startToolSpan(toolCall general.ToolCall) int {
+	if !cm.tracer.active() {
+		return -1
+	}
+	return cm.tracer.startSpan(SpanKindTool, toolCall.Function.Name, "", "", toolCall.Function.Arguments)
+}
+
+// endToolSpan 结束记录工具调用，输出为加入历史的工具结果
+func (cm *ConversationManager) endToolSpan(index int, toolCall general.ToolCall, err error) {
+	if index < 0 {
+		return
+	}
+	if failure := cm.runLog.toolFailure(toolCall.ID); err == nil && failure != "" {
+		err = errors.New(failure)
+	}
+	cm.tracer.endSpan(index, cm.toolResultFor(toolCall.ID), nil, err)
+}
+
+// active 是否有进行中的追踪
+func (t *tracer) active() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.trace != nil
+}
+
+// toolResultFor 在本轮历史中查找工具调用的结果
+func (cm *ConversationManager) toolResultFor(toolCallID string) string {
+	for i := len(cm.history) - 1; i >= 0; i-- {
+		if cm.history[i].Role != general.RoleTool {
+			continue
+		}
+		for _, content := range cm.history[i].Content {
+			if content.Type == general.ContentTypeToolRes && content.ToolID == toolCallID {
+				return content.Text
+			}
+		}
+	}
+	return ""
+}
+
+// newTraceID 生成32位十六进制的随机ID，可以按UUID格式使用
+func newTraceID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	buf[6] = buf[6]&0x0f | 0x40 // UUID版本4
+	buf[8] = buf[8]&0x3f | 0x80 // RFC 4122变体
+	return hex.EncodeToString(buf)
+}
+
+// traceUUID 将32位十六进制ID格式化为带连字符的UUID
+func traceUUID(id string) string {
+	if len(id) != 32 {
+		return id
+	}
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:32]
+}
+
+// spanJSON 将span的输入或输出转换为JSON值，字符串和消息列表以外的值原样返回
+func spanJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.RawMessage:
+		var decoded interface{}
+		if json.Unmarshal(v, &decoded) == nil {
+			return decoded
+		}
+		return string(v)
+	case error:
+		return v.Error()
+	}
+	return value
+}
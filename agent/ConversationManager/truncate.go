@@ -1,109 +1,76 @@
 package ConversationManager
 
-import "github.com/ccIisIaIcat/GoAgent/agent/general"
+import (
+	"context"
+	"math"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
 
 // SafeUnit 安全截断单元
 type SafeUnit struct {
 	StartIndex int    // 单元开始的消息索引
 	EndIndex   int    // 单元结束的消息索引
 	TokenCount int    // 单元的token数量
-	UnitType   string // "dialog" 或 "tool_sequence"
+	UnitType   string // "dialog"、"tool_sequence" 或 "context"
 }
 
-// identifySafeUnits 识别安全截断单元
-func (cm *ConversationManager) identifySafeUnits(messages []general.Message) []SafeUnit {
-	if len(messages) == 0 {
-		return []SafeUnit{}
-	}
-
+// identifySafeUnits 识别安全截断单元，每条消息恰好属于一个单元
+// 以用户消息开始的单元包含到下一条用户消息之前的所有消息，其中有工具调用时为tool_sequence，否则为dialog
+// 不以用户消息开始的消息（历史开头的助手/系统消息、通过AddFullMessage注入的没有用户消息的历史）组成context单元，
+// 每条助手或系统消息开始一个新单元，工具结果始终与前面的工具调用在同一单元中
+func (cm *ConversationManager) identifySafeUnits(model string, messages []general.Message) []SafeUnit {
 	units := []SafeUnit{}
-	i := 0
-
-	for i < len(messages) {
-		if messages[i].Role == general.RoleUser {
-			unit := SafeUnit{
-				StartIndex: i,
-				UnitType:   "dialog",
+	for i := 0; i < len(messages); {
+		unit := SafeUnit{StartIndex: i, UnitType: "context"}
+		userStarted := messages[i].Role == general.RoleUser
+
+		end := i + 1
+		for end < len(messages) {
+			role := messages[end].Role
+			if role == general.RoleUser || !userStarted && role != general.RoleTool {
+				break
 			}
+			end++
+		}
+		unit.EndIndex = end - 1
 
-			// 寻找这个user消息对应的完整回复序列
-			i++ // 移到下一条消息
-
-			// 查找assistant回复
-			for i < len(messages) {
-				if messages[i].Role == general.RoleAssistant {
-					// 检查是否有工具调用
-					if cm.hasToolCalls(messages[i]) {
-						// 这是一个工具调用序列的开始
-						unit.UnitType = "tool_sequence"
-
-						// 继续寻找工具结果和最终回复
-						i = cm.findEndOfToolSequence(messages, i)
-					}
-
-					unit.EndIndex = i
-					break
-				} else if messages[i].Role == general.RoleTool {
-					// 遇到工具结果，继续寻找assistant的最终回复
-					i++
-				} else {
-					// 遇到其他角色或下一个user消息，结束当前单元
-					i--
-					unit.EndIndex = i
+		if userStarted {
+			unit.UnitType = "dialog"
+			for _, msg := range messages[unit.StartIndex:end] {
+				if cm.hasToolCalls(msg) {
+					unit.UnitType = "tool_sequence"
 					break
 				}
 			}
-
-			// 如果没找到对应的assistant回复，设置结束位置
-			if i >= len(messages) {
-				unit.EndIndex = len(messages) - 1
-			}
-
-			// 计算单元token数
-			unit.TokenCount = cm.CalculateUnitTokens(messages[unit.StartIndex : unit.EndIndex+1])
-			units = append(units, unit)
 		}
-		i++
+
+		// 计算单元token数
+		unit.TokenCount = cm.CountMessageTokens(model, messages[unit.StartIndex:end])
+		units = append(units, unit)
+		i = end
 	}
 
 	return units
 }
 
-// findEndOfToolSequence 寻找工具调用序列的结束位置
-func (cm *ConversationManager) findEndOfToolSequence(messages []general.Message, startIndex int) int {
-	i := startIndex + 1
-
-	for i < len(messages) {
-		switch messages[i].Role {
-		case general.RoleTool:
-			// 工具结果，继续寻找
-			i++
-		case general.RoleAssistant:
-			// 检查这个assistant消息是否还有工具调用
-			if cm.hasToolCalls(messages[i]) {
-				// 还有工具调用，继续
-				i++
-			} else {
-				// 没有工具调用，这是最终回复
-				return i
-			}
-		default:
-			// 遇到user或其他角色，工具序列结束
-			return i - 1
+// canStartHistory 判断截断后的历史能否从该单元开始
+// 有普通对话单元时只从dialog开始；没有时（如只有助手和工具消息的历史）可以从不以工具结果开头的单元开始
+func canStartHistory(messages []general.Message, units []SafeUnit, unit SafeUnit) bool {
+	if unit.UnitType == "dialog" {
+		return true
+	}
+	for _, u := range units {
+		if u.UnitType == "dialog" {
+			return false
 		}
 	}
-
-	// 到达消息末尾
-	return len(messages) - 1
+	return messages[unit.StartIndex].Role != general.RoleTool
 }
 
-// calculateUnitTokens 计算单元的token数量
+// CalculateUnitTokens 计算单元的token数量，不指定模型，见CountMessageTokens
 func (cm *ConversationManager) CalculateUnitTokens(messages []general.Message) int {
-	totalTokens := 0
-	for _, msg := range messages {
-		totalTokens += cm.calculateMessageTokens(msg)
-	}
-	return totalTokens
+	return cm.CountMessageTokens("", messages)
 }
 
 // selectUnitsFromEnd 从后往前选择单元，直到接近token限制
@@ -132,82 +99,224 @@ func (cm *ConversationManager) selectUnitsFromEnd(units []SafeUnit, maxTokens in
 	return selected
 }
 
+// TruncationReason 截断检查的结果原因
+type TruncationReason string
+
+const (
+	TruncationDisabled            TruncationReason = "disabled"               // 未启用截断或历史为空
+	TruncationUnderThreshold      TruncationReason = "under_threshold"        // token数未超过阈值，不截断
+	TruncationOverThreshold       TruncationReason = "over_threshold"         // token数超过阈值，丢弃最旧的单元
+	TruncationSystemPromptTooLong TruncationReason = "system_prompt_too_long" // 系统提示词占满了可用token，丢弃全部历史
+	TruncationNoUnitFits          TruncationReason = "no_unit_fits"           // 最新的单元也超过可用token数，丢弃KeepFirstTurns之外的全部历史
+	TruncationNoDialogStart       TruncationReason = "no_dialog_start"        // 可保留的单元中没有以普通对话开始的，丢弃KeepFirstTurns之外的全部历史
+	TruncationPinned              TruncationReason = "pinned"                 // 超过阈值，但所有单元都属于KeepFirstTurns保留的对话
+)
+
+// TruncationReport 历史截断的预览或结果
+type TruncationReport struct {
+	Reason          TruncationReason
+	TokensBefore    int        // 截断前历史记录和系统提示词的token数
+	TokensAfter     int        // 截断后历史记录和系统提示词的token数
+	Threshold       int        // 触发截断的token数（MaxHistoryTokens的80%）
+	DroppedUnits    []SafeUnit // 被丢弃的单元，索引基于截断前的历史记录
+	PinnedUnits     []SafeUnit // 按KeepFirstTurns始终保留的开头单元
+	DroppedMessages int        // 被丢弃的消息数量
+}
+
+// Truncated 是否会丢弃消息
+func (r TruncationReport) Truncated() bool {
+	return r.DroppedMessages > 0
+}
+
+// TruncationHook 历史即将被截断时的回调，可用于提醒用户上下文将丢失
+type TruncationHook func(report TruncationReport)
+
+// OnTruncation 设置历史截断回调，只在实际丢弃消息时调用，为nil时不回调
+func (cm *ConversationManager) OnTruncation(hook TruncationHook) {
+	cm.truncationHook = hook
+}
+
+// PreviewTruncation 预览下一次Chat开始时的截断结果，不修改历史记录
+// provider和model用于开启ServerTokenCounting时的服务端计数，与即将调用Chat的参数一致时结果相同
+func (cm *ConversationManager) PreviewTruncation(ctx context.Context, provider general.Provider, model string) TruncationReport {
+	report, _ := cm.planTruncation(ctx, provider, model, cm.history)
+	return report
+}
+
 // truncateHistory 截断历史记录
-func (cm *ConversationManager) truncateHistory(messages []general.Message) []general.Message {
-	if !cm.EnableTruncation || len(messages) == 0 {
+func (cm *ConversationManager) truncateHistory(ctx context.Context, provider general.Provider, model string, messages []general.Message) []general.Message {
+	report, kept := cm.planTruncation(ctx, provider, model, messages)
+	if !report.Truncated() {
 		return messages
 	}
+	cm.runLog.truncation(cm.turn+1, report)
+	if cm.truncationHook != nil {
+		cm.truncationHook(report)
+	}
+	return kept
+}
+
+// planTruncation 计算截断方案，返回截断报告和截断后保留的消息
+func (cm *ConversationManager) planTruncation(ctx context.Context, provider general.Provider, model string, messages []general.Message) (TruncationReport, []general.Message) {
+	report := TruncationReport{Reason: TruncationDisabled}
+	if !cm.EnableTruncation || len(messages) == 0 {
+		return report, messages
+	}
 
 	// 计算当前历史记录的token数
-	currentTokens := cm.CalculateUnitTokens(messages)
-	systemTokens := cm.CalculateTokens(cm.systemPrompt)
+	currentTokens := cm.CountMessageTokens(model, messages)
+	systemTokens := cm.CountTokens(model, cm.requestSystemPrompt())
 	totalCurrentTokens := currentTokens + systemTokens
 
+	// 使用服务端计数时，按实际总数与估算总数的比例校准各部分的估算值
+	scale := 1.0
+	if serverTokens, ok := cm.countServerTokens(ctx, provider, model, messages); ok && totalCurrentTokens > 0 {
+		scale = float64(serverTokens) / float64(totalCurrentTokens)
+		systemTokens = scaleTokens(systemTokens, scale)
+		totalCurrentTokens = serverTokens
+	}
+
 	// 计算阈值（80%的MaxHistoryTokens）
-	threshold := int(float64(cm.MaxHistoryTokens) * 0.8)
+	report.Threshold = int(float64(cm.MaxHistoryTokens) * 0.8)
+	report.TokensBefore = totalCurrentTokens
+	report.TokensAfter = totalCurrentTokens
 
 	// 如果当前token数未达到阈值，不需要截断
-	if totalCurrentTokens <= threshold {
-		return messages
+	if totalCurrentTokens <= report.Threshold {
+		report.Reason = TruncationUnderThreshold
+		return report, messages
+	}
+
+	// 识别安全单元
+	units := cm.identifySafeUnits(model, messages)
+	for i := range units {
+		units[i].TokenCount = scaleTokens(units[i].TokenCount, scale)
 	}
 
 	// 需要截断，计算可用token数（预留500 token缓冲）
 	availableTokens := cm.MaxHistoryTokens - systemTokens - 500
 
-	if availableTokens <= 0 {
-		return []general.Message{} // 系统提示词太长，返回空历史
+	// 开头的KeepFirstTurns轮对话始终保留，只在其余单元中截断
+	pinned, pinnedTokens := cm.pinnedUnits(units, availableTokens)
+	pinnedEnd := 0
+	if pinned > 0 {
+		pinnedEnd = units[pinned-1].EndIndex + 1
+	}
+	report.PinnedUnits = units[:pinned]
+	recent := units[pinned:]
+
+	// 丢弃保留单元之后的全部历史
+	dropRecent := func(reason TruncationReason) (TruncationReport, []general.Message) {
+		report.Reason = reason
+		report.TokensAfter = systemTokens + pinnedTokens
+		report.DroppedUnits = recent
+		report.DroppedMessages = len(messages) - pinnedEnd
+		return report, messages[:pinnedEnd]
 	}
 
-	// 识别安全单元
-	units := cm.identifySafeUnits(messages)
-	if len(units) == 0 {
-		return messages // 没有识别到安全单元，返回原消息
+	if availableTokens <= 0 {
+		return dropRecent(TruncationSystemPromptTooLong) // 系统提示词太长，返回空历史
+	}
+	if len(recent) == 0 {
+		report.Reason = TruncationPinned
+		return report, messages
 	}
 
 	// 从后往前选择单元（保留最新的对话）
-	selectedUnits := cm.selectUnitsFromEnd(units, availableTokens)
+	selectedUnits := cm.selectUnitsFromEnd(recent, availableTokens-pinnedTokens)
 	if len(selectedUnits) == 0 {
-		return []general.Message{} // 没有选择到任何单元，返回空历史
+		return dropRecent(TruncationNoUnitFits) // 没有选择到任何单元，返回空历史
 	}
 
 	// 确保从一个完整的用户消息开始（没有函数调用的用户问题）
-	for len(selectedUnits) > 0 && selectedUnits[0].UnitType != "dialog" {
+	for len(selectedUnits) > 0 && !canStartHistory(messages, units, selectedUnits[0]) {
 		selectedUnits = selectedUnits[1:] // 移除第一个单元
 	}
 
 	if len(selectedUnits) == 0 {
-		return []general.Message{} // 没有合适的起始单元
+		return dropRecent(TruncationNoDialogStart) // 没有合适的起始单元
 	}
 
-	// 返回截断后的消息（移除最旧的消息，保留最新的）
 	startIndex := selectedUnits[0].StartIndex
-	return messages[startIndex:]
+	report.Reason = TruncationOverThreshold
+	report.TokensAfter = systemTokens + pinnedTokens
+	for _, unit := range recent {
+		if unit.StartIndex < startIndex {
+			report.DroppedUnits = append(report.DroppedUnits, unit)
+		} else {
+			report.TokensAfter += unit.TokenCount
+		}
+	}
+	report.DroppedMessages = startIndex - pinnedEnd
+
+	// 移除最旧的消息，保留开头的单元和最新的对话
+	if pinnedEnd == 0 {
+		return report, messages[startIndex:]
+	}
+	kept := make([]general.Message, 0, pinnedEnd+len(messages)-startIndex)
+	kept = append(kept, messages[:pinnedEnd]...)
+	return report, append(kept, messages[startIndex:]...)
+}
+
+// pinnedUnits 返回按KeepFirstTurns始终保留的开头单元数量和token数，包括第一轮之前的context单元
+// 这些单元超过可用token数时不再保留，按普通单元截断
+func (cm *ConversationManager) pinnedUnits(units []SafeUnit, availableTokens int) (int, int) {
+	if cm.KeepFirstTurns <= 0 {
+		return 0, 0
+	}
+	count, tokens, turns := 0, 0, 0
+	for _, unit := range units {
+		if turns == cm.KeepFirstTurns {
+			break
+		}
+		count++
+		tokens += unit.TokenCount
+		if unit.UnitType != "context" {
+			turns++
+		}
+	}
+	if tokens > availableTokens {
+		return 0, 0
+	}
+	return count, tokens
+}
+
+// countServerTokens 使用提供商的服务端接口计算历史记录和系统提示词的token数，未开启或失败时返回false
+func (cm *ConversationManager) countServerTokens(ctx context.Context, provider general.Provider, model string, messages []general.Message) (int, bool) {
+	if !cm.ServerTokenCounting || cm.manager == nil || !cm.manager.SupportsTokenCounting(provider) {
+		return 0, false
+	}
+	tokens, err := cm.manager.CountTokens(ctx, provider, &general.ChatRequest{
+		Messages:     messages,
+		SystemPrompt: cm.requestSystemPrompt(),
+		Model:        model,
+	})
+	if err != nil || tokens <= 0 {
+		return 0, false
+	}
+	return tokens, true
+}
+
+// scaleTokens 按比例调整估算的token数，向上取整
+func scaleTokens(tokens int, scale float64) int {
+	return int(math.Ceil(float64(tokens) * scale))
 }
 
 // calculateMessageTokens 计算消息的token数量
-func (cm *ConversationManager) calculateMessageTokens(msg general.Message) int {
+func (cm *ConversationManager) calculateMessageTokens(model string, msg general.Message) int {
 	tokens := 0
 	for _, content := range msg.Content {
-		tokens += cm.CalculateTokens(content.Text)
+		tokens += cm.CountTokens(model, content.Text)
+		if content.Type == general.ContentTypeImageURL || content.Type == general.ContentTypeImageB64 {
+			tokens += estimateImageTokens(content.ImageURL)
+		}
 	}
 	// 为工具调用添加额外的token估算
 	tokens += len(msg.ToolCalls) * 50 // 每个工具调用大约50个token
 	return tokens
 }
 
-// calculateTokens 简单的token估算（每个字符约0.5个token，英文单词约1个token）
+// CalculateTokens 计算文本的token数，不指定模型，见CountTokens
 func (cm *ConversationManager) CalculateTokens(text string) int {
-	if text == "" {
-		return 0
-	}
-	// 简单估算：中文字符1个token，英文单词按空格分割估算
-	tokens := 0
-	for _, char := range text {
-		if char > 127 {
-			tokens++ // 中文字符
-		} else {
-			tokens++ // 英文字符，简化处理
-		}
-	}
-	return tokens / 2 // 粗略估算
+	return cm.CountTokens("", text)
 }
@@ -0,0 +1,181 @@
+package ConversationManager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+func textMessage(role general.MessageRole, text string) general.Message {
+	return general.Message{Role: role, Content: []general.Content{{Type: general.ContentTypeText, Text: text}}}
+}
+
+func toolCallMessage(id string) general.Message {
+	msg := textMessage(general.RoleAssistant, "call "+id)
+	msg.ToolCalls = []general.ToolCall{{ID: id, Type: "function", Function: general.FunctionCall{Name: "lookup", Arguments: []byte(`{}`)}}}
+	return msg
+}
+
+func toolResultMessage(id string) general.Message {
+	return general.Message{Role: general.RoleTool, Content: []general.Content{{Type: general.ContentTypeToolRes, Text: "result " + id, ToolID: id}}}
+}
+
+// unitSpan 单元的起止索引和类型，用于比较
+type unitSpan struct {
+	Start, End int
+	Type       string
+}
+
+func spans(units []SafeUnit) []unitSpan {
+	result := make([]unitSpan, len(units))
+	for i, unit := range units {
+		result[i] = unitSpan{unit.StartIndex, unit.EndIndex, unit.UnitType}
+	}
+	return result
+}
+
+func TestIdentifySafeUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []general.Message
+		want     []unitSpan
+	}{
+		{
+			name: "leading assistant and system messages",
+			messages: []general.Message{
+				textMessage(general.RoleAssistant, "welcome"),
+				textMessage(general.RoleSystem, "note"),
+				textMessage(general.RoleUser, "hi"),
+				textMessage(general.RoleAssistant, "hello"),
+			},
+			want: []unitSpan{{0, 0, "context"}, {1, 1, "context"}, {2, 3, "dialog"}},
+		},
+		{
+			name: "tool only history",
+			messages: []general.Message{
+				toolCallMessage("a"),
+				toolResultMessage("a"),
+				toolResultMessage("a2"),
+				toolCallMessage("b"),
+				toolResultMessage("b"),
+				textMessage(general.RoleAssistant, "done"),
+			},
+			want: []unitSpan{{0, 2, "context"}, {3, 4, "context"}, {5, 5, "context"}},
+		},
+		{
+			name: "orphaned tool results before the first turn",
+			messages: []general.Message{
+				toolResultMessage("x"),
+				toolResultMessage("y"),
+				textMessage(general.RoleUser, "q"),
+				toolCallMessage("c"),
+				toolResultMessage("c"),
+				textMessage(general.RoleAssistant, "a"),
+				textMessage(general.RoleUser, "q2"),
+			},
+			want: []unitSpan{{0, 1, "context"}, {2, 5, "tool_sequence"}, {6, 6, "dialog"}},
+		},
+		{
+			name: "system message inside a user turn",
+			messages: []general.Message{
+				textMessage(general.RoleUser, "q"),
+				textMessage(general.RoleSystem, "reminder"),
+				textMessage(general.RoleAssistant, "a"),
+			},
+			want: []unitSpan{{0, 2, "dialog"}},
+		},
+	}
+
+	cm := NewConversationManager(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units := cm.identifySafeUnits("", tt.messages)
+			if got := spans(units); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("units = %v, want %v", got, tt.want)
+			}
+			// 每条消息恰好属于一个单元
+			next := 0
+			for _, unit := range units {
+				if unit.StartIndex != next {
+					t.Fatalf("unit starts at %d, want %d", unit.StartIndex, next)
+				}
+				next = unit.EndIndex + 1
+			}
+			if next != len(tt.messages) {
+				t.Fatalf("units cover %d messages, want %d", next, len(tt.messages))
+			}
+		})
+	}
+}
+
+func TestCanStartHistory(t *testing.T) {
+	cm := NewConversationManager(nil)
+
+	// 没有dialog单元时，以工具结果开头的单元不能作为起点
+	orphaned := []general.Message{toolResultMessage("x"), toolCallMessage("a"), toolResultMessage("a")}
+	units := cm.identifySafeUnits("", orphaned)
+	if canStartHistory(orphaned, units, units[0]) {
+		t.Errorf("history starting with an orphaned tool result was accepted")
+	}
+	if !canStartHistory(orphaned, units, units[1]) {
+		t.Errorf("tool call unit was rejected in a history without dialogs")
+	}
+
+	// 有dialog单元时只从dialog开始
+	mixed := []general.Message{textMessage(general.RoleAssistant, "welcome"), textMessage(general.RoleUser, "q"), textMessage(general.RoleAssistant, "a")}
+	units = cm.identifySafeUnits("", mixed)
+	if canStartHistory(mixed, units, units[0]) {
+		t.Errorf("context unit was accepted although a dialog exists")
+	}
+	if !canStartHistory(mixed, units, units[1]) {
+		t.Errorf("dialog unit was rejected")
+	}
+}
+
+func TestTruncateToolOnlyHistory(t *testing.T) {
+	cm := NewConversationManager(nil)
+	// 每段文本200个token，每个工具调用另加50个
+	cm.SetTokenCounter(TokenCounterFunc(func(model, text string) int { return 200 }))
+	cm.MaxHistoryTokens = 1200
+
+	messages := []general.Message{
+		toolCallMessage("a"),
+		toolResultMessage("a"),
+		toolCallMessage("b"),
+		toolResultMessage("b"),
+		textMessage(general.RoleAssistant, "done"),
+	}
+	report, kept := cm.planTruncation(context.Background(), "", "", messages)
+	if report.Reason != TruncationOverThreshold {
+		t.Fatalf("reason = %s, want %s", report.Reason, TruncationOverThreshold)
+	}
+	if report.DroppedMessages != 2 || len(kept) != 3 {
+		t.Fatalf("dropped %d, kept %d messages, want 2 and 3", report.DroppedMessages, len(kept))
+	}
+	// 保留的工具调用与其结果在一起，历史不以工具结果开头
+	if kept[0].Role != general.RoleAssistant || len(kept[0].ToolCalls) != 1 || kept[1].Role != general.RoleTool {
+		t.Fatalf("kept history does not start with a complete tool call: %+v", kept[:2])
+	}
+}
+
+func TestTruncateDropsOrphanedToolResults(t *testing.T) {
+	cm := NewConversationManager(nil)
+	cm.SetTokenCounter(TokenCounterFunc(func(model, text string) int { return 200 }))
+	cm.MaxHistoryTokens = 900
+
+	messages := []general.Message{
+		toolResultMessage("x"),
+		toolResultMessage("y"),
+		textMessage(general.RoleUser, "q"),
+		textMessage(general.RoleAssistant, "a"),
+	}
+	report, kept := cm.planTruncation(context.Background(), "", "", messages)
+	if report.Reason != TruncationOverThreshold {
+		t.Fatalf("reason = %s, want %s", report.Reason, TruncationOverThreshold)
+	}
+	if len(kept) != 2 || kept[0].Role != general.RoleUser {
+		t.Fatalf("kept = %+v, want the last dialog", kept)
+	}
+}
@@ -0,0 +1,67 @@
+package ConversationManager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// UnknownToolPolicy 模型调用了未注册的工具时的处理策略
+type UnknownToolPolicy int
+
+const (
+	// UnknownToolReply 默认策略，以工具结果告诉模型工具不存在并列出可用的工具，由模型自行纠正
+	UnknownToolReply UnknownToolPolicy = iota
+	// UnknownToolAbort 返回错误并中止对话（开启RecoverToolErrors时错误作为工具结果返回）
+	UnknownToolAbort
+)
+
+// UnknownToolReplier 生成未注册工具的工具结果，available为本次请求中可用的工具名称
+type UnknownToolReplier func(ctx context.Context, toolCall general.ToolCall, available []string) string
+
+// SetUnknownToolPolicy 设置模型调用未注册的工具时的处理策略，replier只在UnknownToolReply时使用，为nil时使用默认的提示
+func (cm *ConversationManager) SetUnknownToolPolicy(policy UnknownToolPolicy, replier UnknownToolReplier) {
+	cm.unknownToolPolicy = policy
+	cm.unknownToolReplier = replier
+}
+
+// handleUnknownTool 按策略处理未注册的工具调用
+func (cm *ConversationManager) handleUnknownTool(ctx context.Context, toolCall general.ToolCall, info_chan chan general.Message) error {
+	if cm.unknownToolPolicy == UnknownToolAbort {
+		return fmt.Errorf("未找到函数: %s", toolCall.Function.Name)
+	}
+
+	tools := cm.activeTools(ctx)
+	available := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		available = append(available, tool.Function.Name)
+	}
+	var result string
+	if cm.unknownToolReplier != nil {
+		result = cm.unknownToolReplier(ctx, toolCall, available)
+	} else {
+		result = cm.unknownToolResult(toolCall.Function.Name, available)
+	}
+	cm.appendToolResult(ctx, toolCall, result, info_chan)
+	return nil
+}
+
+// unknownToolResult 默认的未注册工具提示，名称只有大小写或分隔符不同时给出建议
+func (cm *ConversationManager) unknownToolResult(name string, available []string) string {
+	if len(available) == 0 {
+		return cm.text(MsgUnknownToolNoTools, name)
+	}
+	for _, candidate := range available {
+		if normalizeToolName(candidate) == normalizeToolName(name) {
+			return cm.text(MsgUnknownToolSuggestion, name, candidate, strings.Join(available, ", "))
+		}
+	}
+	return cm.text(MsgUnknownTool, name, strings.Join(available, ", "))
+}
+
+// normalizeToolName 忽略大小写和分隔符，用于匹配模型写错的工具名称
+func normalizeToolName(name string) string {
+	return strings.NewReplacer("_", "", "-", "", ".", "", " ", "").Replace(strings.ToLower(name))
+}
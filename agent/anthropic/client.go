@@ -2,13 +2,17 @@ package anthropic
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/payload"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
 // Config Anthropic配置
@@ -16,8 +20,19 @@ type Config struct {
 	APIKey  string
 	BaseURL string
 	Model   string
+	// Headers 可选，附加到每个请求的HTTP头（如组织ID、网关鉴权），同名时覆盖默认请求头
+	Headers map[string]string
+	// Credentials 可选，每次请求时获取API密钥，设置后优先于APIKey，用于在不重建客户端的情况下轮换密钥
+	Credentials func(ctx context.Context) (string, error)
+	// HTTPClient 可选，发送请求使用的HTTP客户端，多个客户端共享同一个时可以复用连接池，为nil时使用新建的默认客户端
+	HTTPClient *http.Client
+	// Retry 可选，限流、服务端错误和网络错误时的重试策略，为nil时不重试
+	Retry *RetryPolicy
 }
 
+// RetryPolicy HTTP请求的重试策略，退避时间翻倍并遵守Retry-After
+type RetryPolicy = retry.Policy
+
 // Client Anthropic客户端
 type Client struct {
 	config     *Config
@@ -33,9 +48,13 @@ func NewClient(config *Config) *Client {
 		config.Model = "claude-sonnet-4-20250514"
 	}
 	
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
 		config:     config,
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 	}
 }
 
@@ -44,8 +63,20 @@ func (c *Client) GetProvider() string {
 	return "anthropic"
 }
 
+// applyHeaders 设置配置中的自定义请求头
+func (c *Client) applyHeaders(httpReq *http.Request) {
+	for key, value := range c.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
+
+// do 按重试策略发送请求
+func (c *Client) do(httpReq *http.Request) (*http.Response, error) {
+	return c.config.Retry.Do(c.httpClient, httpReq)
+}
+
 // ValidateRequest 验证请求参数
-func (c *Client) ValidateRequest(req interface{}) error {
+func (c *Client) ValidateRequest(req *unified.ChatRequest) error {
 	// Anthropic要求max_tokens必须设置
 	anthropicReq, err := ToAnthropicRequest(req)
 	if err != nil {
@@ -58,7 +89,13 @@ func (c *Client) ValidateRequest(req interface{}) error {
 }
 
 // Chat 发送聊天请求
-func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error) {
+func (c *Client) Chat(ctx context.Context, req *unified.ChatRequest) (_ *unified.ChatResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	anthropicReq, err := ToAnthropicRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to anthropic request failed: %w", err)
@@ -72,21 +109,24 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 		anthropicReq.MaxTokens = 4096
 	}
 	
-	reqBody, err := json.Marshal(anthropicReq)
+	reqBody, err := payload.JSON(anthropicReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v1/messages", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v1/messages", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", c.config.APIKey)
+	httpReq.Header.Set("x-api-key", apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -94,19 +134,38 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 	
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
 	var anthropicResp AnthropicChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+	if !anthropicReq.IncludeRawResponse {
+		// 不需要原始响应时直接从响应体流式解码，不缓存整个响应
+		if err := payload.DecodeJSON(resp.Body, &anthropicResp); err != nil {
+			return nil, fmt.Errorf("decode response failed: %w", err)
+		}
+		return FromAnthropicResponse(&anthropicResp), nil
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %w", err)
+	}
+	if err := json.Unmarshal(bodyBytes, &anthropicResp); err != nil {
 		return nil, fmt.Errorf("decode response failed: %w", err)
 	}
-	
-	return FromAnthropicResponse(&anthropicResp), nil
+	commonResp := FromAnthropicResponse(&anthropicResp)
+	commonResp.RawResponse = bodyBytes
+	return commonResp, nil
 }
 
 // ChatStream 发送流式聊天请求
-func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interface{}, error) {
+func (c *Client) ChatStream(ctx context.Context, req *unified.ChatRequest) (_ <-chan AnthropicStreamEvent, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	anthropicReq, err := ToAnthropicRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to anthropic request failed: %w", err)
@@ -123,22 +182,25 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 		anthropicReq.MaxTokens = 4096
 	}
 	
-	reqBody, err := json.Marshal(anthropicReq)
+	reqBody, err := payload.JSON(anthropicReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v1/messages", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v1/messages", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", c.config.APIKey)
+	httpReq.Header.Set("x-api-key", apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("Accept", "text/event-stream")
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -146,10 +208,10 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
-	ch := make(chan interface{}, 10)
+	ch := make(chan AnthropicStreamEvent, 10)
 	
 	go func() {
 		defer resp.Body.Close()
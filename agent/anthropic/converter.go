@@ -2,87 +2,37 @@ package anthropic
 
 import (
 	"encoding/json"
-	"fmt"
 	"strings"
 	"time"
-)
-
-// ToAnthropicRequest 将统一请求转换为Anthropic请求
-func ToAnthropicRequest(req interface{}) (*AnthropicChatRequest, error) {
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
-	}
 
-	var commonReq struct {
-		Model    string `json:"model"`
-		Messages []struct {
-			Role    string `json:"role"`
-			Content []struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ImageURL *struct {
-					URL    string `json:"url"`
-					Detail string `json:"detail,omitempty"`
-				} `json:"image_url,omitempty"`
-				ToolCall *struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-				ToolID string `json:"tool_id,omitempty"`
-			} `json:"content"`
-			Name      string `json:"name,omitempty"`
-			ToolCalls []struct {
-				ID       string `json:"id"`
-				Type     string `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			} `json:"tool_calls,omitempty"`
-		} `json:"messages"`
-		Tools []struct {
-			Type     string `json:"type"`
-			Function struct {
-				Name        string                 `json:"name"`
-				Description string                 `json:"description"`
-				Parameters  map[string]interface{} `json:"parameters"`
-			} `json:"function"`
-		} `json:"tools,omitempty"`
-		MaxTokens    int     `json:"max_tokens,omitempty"`
-		Temperature  float64 `json:"temperature,omitempty"`
-		Stream       bool    `json:"stream,omitempty"`
-		SystemPrompt string  `json:"system_prompt,omitempty"`
-	}
-
-	if err := json.Unmarshal(reqBytes, &commonReq); err != nil {
-		return nil, fmt.Errorf("unmarshal to common request failed: %w", err)
-	}
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/schema"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
+)
 
+// ToAnthropicRequest 将统一请求转换为Anthropic请求，不修改req
+func ToAnthropicRequest(req *unified.ChatRequest) (*AnthropicChatRequest, error) {
 	anthropicReq := &AnthropicChatRequest{
-		Model:     commonReq.Model,
-		MaxTokens: commonReq.MaxTokens,
-		Stream:    commonReq.Stream,
-		System:    commonReq.SystemPrompt,
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		Stream:    req.Stream,
+		System:    req.SystemPrompt,
 	}
 
-	if commonReq.Temperature != 0 {
-		anthropicReq.Temperature = &commonReq.Temperature
+	if req.HasTemperature() {
+		temperature := req.Temperature
+		anthropicReq.Temperature = &temperature
 	}
+	anthropicReq.TopP = req.TopP
 
 	// 转换消息
-	for _, msg := range commonReq.Messages {
+	for _, msg := range req.Messages {
 		// Anthropic不支持system角色的消息在messages中，跳过
 		if msg.Role == "system" {
 			continue
 		}
 
 		// 处理工具角色，将其转换为user角色
-		role := msg.Role
+		role := string(msg.Role)
 		if role == "tool" {
 			role = "user"
 		}
@@ -101,9 +51,16 @@ func ToAnthropicRequest(req interface{}) (*AnthropicChatRequest, error) {
 				})
 			case "image_url":
 				if content.ImageURL != nil {
-					// Anthropic需要base64编码的图片，这里需要下载并编码
-					// 简化处理，假设URL是data URL
-					if strings.HasPrefix(content.ImageURL.URL, "data:image/") {
+					// data URL转换为base64来源，远程图片直接使用URL来源
+					if strings.HasPrefix(content.ImageURL.URL, "http://") || strings.HasPrefix(content.ImageURL.URL, "https://") {
+						anthropicMsg.Content = append(anthropicMsg.Content, AnthropicContent{
+							Type: "image",
+							Source: &AnthropicImageSource{
+								Type: "url",
+								URL:  content.ImageURL.URL,
+							},
+						})
+					} else if strings.HasPrefix(content.ImageURL.URL, "data:image/") {
 						parts := strings.Split(content.ImageURL.URL, ",")
 						if len(parts) == 2 {
 							mediaType := strings.Split(strings.Split(parts[0], ":")[1], ";")[0]
@@ -118,6 +75,17 @@ func ToAnthropicRequest(req interface{}) (*AnthropicChatRequest, error) {
 						}
 					}
 				}
+			case "document":
+				if content.Document != nil {
+					anthropicMsg.Content = append(anthropicMsg.Content, AnthropicContent{
+						Type: "document",
+						Source: &AnthropicImageSource{
+							Type:      "base64",
+							MediaType: content.Document.MimeType,
+							Data:      content.Document.Data,
+						},
+					})
+				}
 			case "image_base64":
 				if content.ImageURL != nil {
 					anthropicMsg.Content = append(anthropicMsg.Content, AnthropicContent{
@@ -148,7 +116,7 @@ func ToAnthropicRequest(req interface{}) (*AnthropicChatRequest, error) {
 				// 确保工具结果文本不为空
 				resultText := content.Text
 				if resultText == "" {
-					resultText = "函数执行完成"
+					resultText = "Function completed"
 				}
 				anthropicMsg.Content = append(anthropicMsg.Content, AnthropicContent{
 					Type:      "tool_result",
@@ -209,67 +177,37 @@ func ToAnthropicRequest(req interface{}) (*AnthropicChatRequest, error) {
 		anthropicReq.Messages = append(anthropicReq.Messages, anthropicMsg)
 	}
 
+	// 预填充：最后一条assistant消息作为回复的开头
+	if req.Prefill != "" {
+		anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
+			Role:    "assistant",
+			Content: []AnthropicContent{{Type: "text", Text: req.Prefill}},
+		})
+	}
+
 	// 转换工具定义
-	for _, tool := range commonReq.Tools {
+	for _, tool := range req.Tools {
 		anthropicReq.Tools = append(anthropicReq.Tools, AnthropicTool{
 			Name:        tool.Function.Name,
 			Description: tool.Function.Description,
-			InputSchema: tool.Function.Parameters,
+			InputSchema: schema.Sanitize(tool.Function.Parameters),
 		})
 	}
 
+	anthropicReq.IncludeRawResponse = req.IncludeRawResponse
+	anthropicReq.ProviderOptions = req.ProviderOptions["anthropic"]
+
 	return anthropicReq, nil
 }
 
 // FromAnthropicResponse 将Anthropic响应转换为统一响应
-func FromAnthropicResponse(resp *AnthropicChatResponse) interface{} {
-	commonResp := struct {
-		ID      string    `json:"id"`
-		Object  string    `json:"object"`
-		Created time.Time `json:"created"`
-		Model   string    `json:"model"`
-		Choices []struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role    string `json:"role"`
-				Content []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string `json:"id"`
-						Type     string `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
-	}{
+func FromAnthropicResponse(resp *AnthropicChatResponse) *unified.ChatResponse {
+	commonResp := &unified.ChatResponse{
 		ID:      resp.ID,
 		Object:  "chat.completion",
 		Created: time.Now(),
 		Model:   resp.Model,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: unified.Usage{
 			PromptTokens:     resp.Usage.InputTokens,
 			CompletionTokens: resp.Usage.OutputTokens,
 			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
@@ -277,111 +215,35 @@ func FromAnthropicResponse(resp *AnthropicChatResponse) interface{} {
 	}
 
 	// 创建单个选择
-	choice := struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content []struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			} `json:"content"`
-			ToolCalls []struct {
-				ID       string `json:"id"`
-				Type     string `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			} `json:"tool_calls,omitempty"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-	}{
+	choice := unified.Choice{
 		Index:        0,
 		FinishReason: resp.StopReason,
 	}
-
-	choice.Message.Role = resp.Role
+	choice.Message.Role = unified.MessageRole(resp.Role)
 
 	// 处理内容
 	for _, content := range resp.Content {
 		switch content.Type {
 		case "text":
-			choice.Message.Content = append(choice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "text",
+			choice.Message.Content = append(choice.Message.Content, unified.Content{
+				Type: unified.ContentTypeText,
 				Text: content.Text,
 			})
 		case "tool_use":
-			// 添加到工具调用列表
-			choice.Message.ToolCalls = append(choice.Message.ToolCalls, struct {
-				ID       string `json:"id"`
-				Type     string `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			}{
+			// 添加到工具调用列表，同时添加到内容中
+			call := unified.ToolCall{
 				ID:   content.ID,
 				Type: "function",
-				Function: struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				}{
+				Function: unified.FunctionCall{
 					Name:      content.Name,
 					Arguments: content.Input,
 				},
-			})
-
-			// 同时添加到内容中
-			choice.Message.Content = append(choice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "tool_call",
-				ToolCall: &struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				}{
-					ID:   content.ID,
-					Type: "function",
-					Function: struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					}{
-						Name:      content.Name,
-						Arguments: content.Input,
-					},
-				},
+			}
+			choice.Message.ToolCalls = append(choice.Message.ToolCalls, call)
+			contentCall := call
+			choice.Message.Content = append(choice.Message.Content, unified.Content{
+				Type:     unified.ContentTypeTool,
+				ToolCall: &contentCall,
 			})
 		}
 	}
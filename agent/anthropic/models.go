@@ -0,0 +1,84 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+)
+
+// AnthropicModel Anthropic模型列表中的模型
+type AnthropicModel struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"` // RFC 3339格式
+}
+
+// AnthropicModelList Anthropic模型列表响应（分页）
+type AnthropicModelList struct {
+	Data    []AnthropicModel `json:"data"`
+	HasMore bool             `json:"has_more"`
+	FirstID string           `json:"first_id,omitempty"`
+	LastID  string           `json:"last_id,omitempty"`
+}
+
+// ListModels 列出当前API密钥可用的模型，自动翻页
+func (c *Client) ListModels(ctx context.Context) (_ []AnthropicModel, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	var models []AnthropicModel
+	afterID := ""
+	for {
+		query := url.Values{"limit": {"1000"}}
+		if afterID != "" {
+			query.Set("after_id", afterID)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", c.config.BaseURL+"/v1/models?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("create http request failed: %w", err)
+		}
+
+		httpReq.Header.Set("x-api-key", apiKey)
+		httpReq.Header.Set("anthropic-version", "2023-06-01")
+		c.applyHeaders(httpReq)
+
+		page, err := c.listModelsPage(httpReq)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, page.Data...)
+		if !page.HasMore || page.LastID == "" {
+			return models, nil
+		}
+		afterID = page.LastID
+	}
+}
+
+// listModelsPage 请求一页模型列表
+func (c *Client) listModelsPage(httpReq *http.Request) (*AnthropicModelList, error) {
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var page AnthropicModelList
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decode response failed: %w", err)
+	}
+	return &page, nil
+}
@@ -0,0 +1,81 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
+)
+
+// AnthropicCountTokensRequest Anthropic token计数请求，只包含影响输入token数的字段
+type AnthropicCountTokensRequest struct {
+	Model    string             `json:"model"`
+	Messages []AnthropicMessage `json:"messages"`
+	Tools    []AnthropicTool    `json:"tools,omitempty"`
+	System   string             `json:"system,omitempty"`
+}
+
+// AnthropicCountTokensResponse Anthropic token计数响应
+type AnthropicCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// CountTokens 调用服务端接口计算请求的输入token数，不会生成回复也不计费
+func (c *Client) CountTokens(ctx context.Context, req *unified.ChatRequest) (_ int, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	anthropicReq, err := ToAnthropicRequest(req)
+	if err != nil {
+		return 0, fmt.Errorf("convert to anthropic request failed: %w", err)
+	}
+	countReq := AnthropicCountTokensRequest{
+		Model:    anthropicReq.Model,
+		Messages: anthropicReq.Messages,
+		Tools:    anthropicReq.Tools,
+		System:   anthropicReq.System,
+	}
+	if countReq.Model == "" {
+		countReq.Model = c.config.Model
+	}
+
+	reqBody, err := json.Marshal(countReq)
+	if err != nil {
+		return 0, fmt.Errorf("marshal request failed: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/v1/messages/count_tokens", bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, fmt.Errorf("create http request failed: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	c.applyHeaders(httpReq)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var countResp AnthropicCountTokensResponse
+	if err := json.NewDecoder(resp.Body).Decode(&countResp); err != nil {
+		return 0, fmt.Errorf("decode response failed: %w", err)
+	}
+	return countResp.InputTokens, nil
+}
@@ -1,6 +1,10 @@
 package anthropic
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
 
 // AnthropicMessage Anthropic的消息结构
 type AnthropicMessage struct {
@@ -22,9 +26,10 @@ type AnthropicContent struct {
 
 // AnthropicImageSource Anthropic的图片源结构
 type AnthropicImageSource struct {
-	Type      string `json:"type"`      // "base64"
-	MediaType string `json:"media_type"` // "image/jpeg", "image/png", etc.
-	Data      string `json:"data"`       // base64 encoded image
+	Type      string `json:"type"`                 // "base64" 或 "url"
+	MediaType string `json:"media_type,omitempty"` // "image/jpeg", "image/png", etc.
+	Data      string `json:"data,omitempty"`       // base64 encoded image
+	URL       string `json:"url,omitempty"`        // 远程图片地址（type为url时使用）
 }
 
 // AnthropicTool Anthropic的工具定义结构
@@ -41,8 +46,74 @@ type AnthropicChatRequest struct {
 	Tools       []AnthropicTool    `json:"tools,omitempty"`
 	MaxTokens   int                `json:"max_tokens"`
 	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
 	System      string             `json:"system,omitempty"`
 	Stream      bool               `json:"stream,omitempty"`
+
+	// IncludeRawResponse 是否在响应中保留提供商返回的原始JSON，不参与序列化
+	IncludeRawResponse bool `json:"-"`
+
+	// ProviderOptions 提供商特有的请求参数，序列化时深度合并到请求体中，优先级高于已建模的字段
+	ProviderOptions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON 序列化请求，并将ProviderOptions中的字段合并到请求体中
+func (r AnthropicChatRequest) MarshalJSON() ([]byte, error) {
+	type alias AnthropicChatRequest
+	data, err := json.Marshal(alias(r))
+	if err != nil {
+		return nil, err
+	}
+	return mergeProviderOptions(data, r.ProviderOptions)
+}
+
+// mergeProviderOptions 将ProviderOptions深度合并到序列化后的请求体中
+// 同名字段以ProviderOptions为准，两边都是对象时合并子字段，值为nil时删除该字段
+func mergeProviderOptions(data []byte, options map[string]interface{}) ([]byte, error) {
+	if len(options) == 0 {
+		return data, nil
+	}
+
+	var body map[string]interface{}
+	if err := decodeJSONObject(data, &body); err != nil {
+		return nil, err
+	}
+	// 先序列化一次，使结构体等类型的值统一为map，便于深度合并
+	optionBytes, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provider options failed: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := decodeJSONObject(optionBytes, &normalized); err != nil {
+		return nil, err
+	}
+
+	mergeJSONObject(body, normalized)
+	return json.Marshal(body)
+}
+
+// mergeJSONObject 递归合并JSON对象
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			mergeJSONObject(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decodeJSONObject 解析JSON对象，数字保留为json.Number以免大整数丢失精度
+func decodeJSONObject(data []byte, v *map[string]interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
 }
 
 // AnthropicUsage Anthropic的使用统计结构
@@ -68,6 +139,7 @@ type AnthropicStreamEvent struct {
 	Type    string          `json:"type"`
 	Message json.RawMessage `json:"message,omitempty"`
 	Index   int             `json:"index,omitempty"`
+	ContentBlock json.RawMessage `json:"content_block,omitempty"`
 	Delta   json.RawMessage `json:"delta,omitempty"`
 	Usage   *AnthropicUsage `json:"usage,omitempty"`
 }
@@ -76,6 +148,8 @@ type AnthropicStreamEvent struct {
 type AnthropicStreamDelta struct {
 	Type         string `json:"type,omitempty"`
 	Text         string `json:"text,omitempty"`
+	Thinking     string `json:"thinking,omitempty"`
+	PartialJSON  string `json:"partial_json,omitempty"`
 	StopReason   string `json:"stop_reason,omitempty"`
 	StopSequence string `json:"stop_sequence,omitempty"`
 }
\ No newline at end of file
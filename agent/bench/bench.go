@@ -0,0 +1,340 @@
+// Package bench 测量已配置的提供商的首token延迟（TTFT）、生成速度（tokens/s）和错误率，
+// 支持设置并发数，结果以可比较的报告（Markdown、JSON、CSV）输出
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// 默认配置
+const (
+	defaultPrompt      = "请用大约200字介绍一下你自己。"
+	defaultMaxTokens   = 256
+	defaultRequests    = 10
+	defaultConcurrency = 1
+)
+
+// Target 被测的提供商和模型
+type Target struct {
+	Provider general.Provider
+	Model    string // 为空时使用提供商配置中的模型
+	Name     string // 报告中的名称，为空时为"提供商/模型"
+}
+
+// Config 测试配置
+type Config struct {
+	Targets     []Target      // 为空时测试AgentManager中的所有提供商
+	Prompt      string        // 每次请求发送的用户消息，为空时使用默认提示词
+	MaxTokens   int           // 每次请求的最大输出token数，默认256
+	Requests    int           // 每个目标的请求数，默认10
+	Concurrency int           // 每个目标的并发请求数，默认1
+	Stream      bool          // 使用流式请求，用于测量首token延迟；为false时TTFT等于完整的响应时间
+	Timeout     time.Duration // 单次请求的超时时间，0表示不限制
+	Warmup      int           // 每个目标正式测试前的预热请求数，不计入结果
+}
+
+// Stats 一组耗时的统计，单位为毫秒
+type Stats struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Result 一个目标的测试结果
+type Result struct {
+	Name             string           `json:"name"`
+	Provider         general.Provider `json:"provider"`
+	Model            string           `json:"model"`
+	Requests         int              `json:"requests"`
+	Errors           int              `json:"errors"`
+	ErrorRate        float64          `json:"error_rate"`
+	TTFT             Stats            `json:"ttft_ms"`           // 首token延迟，只统计成功的请求
+	Latency          Stats            `json:"latency_ms"`        // 完整的响应时间，只统计成功的请求
+	TokensPerSecond  float64          `json:"tokens_per_second"` // 单个请求的平均生成速度，流式时不包括首token之前的等待
+	Throughput       float64          `json:"throughput"`        // 所有请求的输出token总数除以总耗时，反映并发下的总吞吐量
+	CompletionTokens int              `json:"completion_tokens"`
+	EstimatedTokens  bool             `json:"estimated_tokens,omitempty"` // 提供商没有返回使用量，输出token数按文本长度估算
+	DurationMS       int64            `json:"duration_ms"`
+	ErrorSamples     []string         `json:"error_samples,omitempty"` // 不同的错误信息，最多5条
+}
+
+// Report 测试报告
+type Report struct {
+	Start       time.Time `json:"start"`
+	DurationMS  int64     `json:"duration_ms"`
+	Requests    int       `json:"requests"`
+	Concurrency int       `json:"concurrency"`
+	Stream      bool      `json:"stream"`
+	MaxTokens   int       `json:"max_tokens"`
+	Results     []Result  `json:"results"`
+}
+
+// sample 单次请求的测量结果
+type sample struct {
+	ttft      time.Duration
+	latency   time.Duration
+	tokens    int
+	estimated bool
+	err       error
+}
+
+// maxErrorSamples 每个目标保留的不同错误信息数
+const maxErrorSamples = 5
+
+// Run 依次测试每个目标，同一目标的请求按Concurrency并发发送，不同目标之间不并发，避免相互影响
+func Run(ctx context.Context, manager *general.AgentManager, config Config) (*Report, error) {
+	if config.Prompt == "" {
+		config.Prompt = defaultPrompt
+	}
+	if config.MaxTokens <= 0 {
+		config.MaxTokens = defaultMaxTokens
+	}
+	if config.Requests <= 0 {
+		config.Requests = defaultRequests
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultConcurrency
+	}
+	targets := config.Targets
+	if len(targets) == 0 {
+		for _, provider := range manager.ListProviders() {
+			targets = append(targets, Target{Provider: provider})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("没有可测试的提供商")
+	}
+
+	report := &Report{
+		Start:       time.Now(),
+		Requests:    config.Requests,
+		Concurrency: config.Concurrency,
+		Stream:      config.Stream,
+		MaxTokens:   config.MaxTokens,
+	}
+	for _, target := range targets {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, runTarget(ctx, manager, config, target))
+	}
+	report.DurationMS = time.Since(report.Start).Milliseconds()
+	return report, nil
+}
+
+// runTarget 测试一个目标
+func runTarget(ctx context.Context, manager *general.AgentManager, config Config, target Target) Result {
+	name := target.Name
+	if name == "" {
+		name = string(target.Provider)
+		if target.Model != "" {
+			name += "/" + target.Model
+		}
+	}
+	for i := 0; i < config.Warmup; i++ {
+		measure(ctx, manager, config, target)
+	}
+
+	samples := make([]sample, config.Requests)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < config.Concurrency && w < config.Requests; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				samples[i] = measure(ctx, manager, config, target)
+			}
+		}()
+	}
+	for i := range samples {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := summarize(samples, time.Since(start))
+	result.Name, result.Provider, result.Model = name, target.Provider, target.Model
+	return result
+}
+
+// measure 发送一次请求并测量
+func measure(ctx context.Context, manager *general.AgentManager, config Config, target Target) sample {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+	req := &general.ChatRequest{
+		Model: target.Model,
+		Messages: []general.Message{
+			{Role: general.RoleUser, Content: []general.Content{{Type: general.ContentTypeText, Text: config.Prompt}}},
+		},
+		MaxTokens: config.MaxTokens,
+	}
+	if config.Stream {
+		return measureStream(ctx, manager, target.Provider, req)
+	}
+
+	start := time.Now()
+	resp, err := manager.Chat(ctx, target.Provider, req)
+	latency := time.Since(start)
+	if err != nil {
+		return sample{err: err}
+	}
+	s := sample{ttft: latency, latency: latency, tokens: resp.Usage.CompletionTokens}
+	if s.tokens == 0 && len(resp.Choices) > 0 {
+		s.tokens, s.estimated = estimateTokens(responseText(resp)), true
+	}
+	return s
+}
+
+// measureStream 发送一次流式请求，收到第一个数据块的时间为首token延迟
+func measureStream(ctx context.Context, manager *general.AgentManager, provider general.Provider, req *general.ChatRequest) sample {
+	req.Stream = true
+	start := time.Now()
+	chunks, err := manager.ChatStream(ctx, provider, req)
+	if err != nil {
+		return sample{err: err}
+	}
+	var s sample
+	var text string
+	for chunk := range chunks {
+		if s.ttft == 0 {
+			s.ttft = time.Since(start)
+		}
+		text += chunk.Delta
+		if chunk.Usage != nil && chunk.Usage.CompletionTokens > 0 {
+			s.tokens = chunk.Usage.CompletionTokens
+		}
+	}
+	s.latency = time.Since(start)
+	if err := ctx.Err(); err != nil {
+		return sample{err: err}
+	}
+	if s.ttft == 0 {
+		return sample{err: fmt.Errorf("流式响应没有返回数据")}
+	}
+	if s.tokens == 0 {
+		s.tokens, s.estimated = estimateTokens(text), true
+	}
+	return s
+}
+
+// summarize 汇总一个目标的测量结果
+func summarize(samples []sample, duration time.Duration) Result {
+	result := Result{Requests: len(samples), DurationMS: duration.Milliseconds()}
+	var ttfts, latencies []time.Duration
+	var rates []float64
+	seen := make(map[string]bool)
+	for _, s := range samples {
+		if s.err != nil {
+			result.Errors++
+			if message := s.err.Error(); !seen[message] && len(result.ErrorSamples) < maxErrorSamples {
+				seen[message] = true
+				result.ErrorSamples = append(result.ErrorSamples, message)
+			}
+			continue
+		}
+		ttfts = append(ttfts, s.ttft)
+		latencies = append(latencies, s.latency)
+		result.CompletionTokens += s.tokens
+		result.EstimatedTokens = result.EstimatedTokens || s.estimated
+		// 流式时生成速度不包括首token之前的等待
+		generation := s.latency
+		if s.ttft < s.latency {
+			generation = s.latency - s.ttft
+		}
+		if generation > 0 && s.tokens > 0 {
+			rates = append(rates, float64(s.tokens)/generation.Seconds())
+		}
+	}
+	if result.Requests > 0 {
+		result.ErrorRate = float64(result.Errors) / float64(result.Requests)
+	}
+	result.TTFT = newStats(ttfts)
+	result.Latency = newStats(latencies)
+	result.TokensPerSecond = mean(rates)
+	if duration > 0 {
+		result.Throughput = float64(result.CompletionTokens) / duration.Seconds()
+	}
+	return result
+}
+
+// newStats 计算耗时的平均值和分位数
+func newStats(durations []time.Duration) Stats {
+	if len(durations) == 0 {
+		return Stats{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return Stats{
+		Mean: milliseconds(total / time.Duration(len(sorted))),
+		P50:  milliseconds(percentile(sorted, 0.50)),
+		P90:  milliseconds(percentile(sorted, 0.90)),
+		P99:  milliseconds(percentile(sorted, 0.99)),
+		Max:  milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+// percentile 返回已排序耗时的分位数（最近秩法）
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(p*float64(len(sorted))+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// milliseconds 将耗时转换为毫秒
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// mean 平均值，没有数据时为0
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// responseText 拼接响应中第一个选项的文本
+func responseText(resp *general.ChatResponse) string {
+	if resp == nil || len(resp.Choices) == 0 {
+		return ""
+	}
+	var text string
+	for _, content := range resp.Choices[0].Message.Content {
+		if content.Type == general.ContentTypeText {
+			text += content.Text
+		}
+	}
+	return text
+}
+
+// estimateTokens 提供商没有返回使用量时按文本长度粗略估算token数（与ConversationManager相同，每2个字符约1个token）
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text) / 2
+}
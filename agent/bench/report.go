@@ -0,0 +1,91 @@
+package bench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON 以缩进的JSON格式输出报告，便于保存后与其他测试结果比较
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Markdown 以Markdown表格输出报告，每个目标一行
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# 提供商基准测试\n\n")
+	fmt.Fprintf(&b, "- 时间: %s，耗时 %d ms\n", r.Start.Format(time.RFC3339), r.DurationMS)
+	mode := "非流式"
+	if r.Stream {
+		mode = "流式"
+	}
+	fmt.Fprintf(&b, "- 每个目标 %d 次请求，并发 %d，%s，最大输出 %d token\n\n", r.Requests, r.Concurrency, mode, r.MaxTokens)
+
+	b.WriteString("| 目标 | 成功/请求 | 错误率 | TTFT P50 | TTFT P90 | 延迟 P50 | 延迟 P99 | tokens/s | 吞吐量 |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- | --- |\n")
+	estimated := false
+	for _, result := range r.Results {
+		rate := fmt.Sprintf("%.1f", result.TokensPerSecond)
+		if result.EstimatedTokens {
+			rate += "*"
+			estimated = true
+		}
+		fmt.Fprintf(&b, "| %s | %d/%d | %.1f%% | %.0f | %.0f | %.0f | %.0f | %s | %.1f |\n",
+			result.Name, result.Requests-result.Errors, result.Requests, result.ErrorRate*100,
+			result.TTFT.P50, result.TTFT.P90, result.Latency.P50, result.Latency.P99, rate, result.Throughput)
+	}
+	b.WriteString("\n延迟单位为毫秒。")
+	if estimated {
+		b.WriteString("带*的目标没有返回使用量，token数按文本长度估算。")
+	}
+	b.WriteString("\n")
+
+	for _, result := range r.Results {
+		if len(result.ErrorSamples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s 的错误\n\n", result.Name)
+		for _, message := range result.ErrorSamples {
+			fmt.Fprintf(&b, "- %s\n", strings.ReplaceAll(message, "\n", " "))
+		}
+	}
+	return b.String()
+}
+
+// WriteCSV 以CSV格式输出报告，每个目标一行，便于在表格中汇总多次测试
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	header := []string{"start", "name", "provider", "model", "stream", "concurrency", "requests", "errors", "error_rate",
+		"ttft_mean_ms", "ttft_p50_ms", "ttft_p90_ms", "ttft_p99_ms",
+		"latency_mean_ms", "latency_p50_ms", "latency_p90_ms", "latency_p99_ms",
+		"tokens_per_second", "throughput", "completion_tokens", "estimated_tokens"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, result := range r.Results {
+		row := []string{
+			r.Start.Format(time.RFC3339), result.Name, string(result.Provider), result.Model,
+			strconv.FormatBool(r.Stream), strconv.Itoa(r.Concurrency),
+			strconv.Itoa(result.Requests), strconv.Itoa(result.Errors), formatFloat(result.ErrorRate),
+			formatFloat(result.TTFT.Mean), formatFloat(result.TTFT.P50), formatFloat(result.TTFT.P90), formatFloat(result.TTFT.P99),
+			formatFloat(result.Latency.Mean), formatFloat(result.Latency.P50), formatFloat(result.Latency.P90), formatFloat(result.Latency.P99),
+			formatFloat(result.TokensPerSecond), formatFloat(result.Throughput),
+			strconv.Itoa(result.CompletionTokens), strconv.FormatBool(result.EstimatedTokens),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatFloat 保留3位小数
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
@@ -0,0 +1,114 @@
+package deepseek
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
+)
+
+// betaBaseURL 获取Beta接口地址（前缀续写和FIM补全只在Beta接口上可用）
+func (c *Client) betaBaseURL() string {
+	if c.config.BetaBaseURL != "" {
+		return c.config.BetaBaseURL
+	}
+	base := strings.TrimSuffix(c.config.BaseURL, "/")
+	base = strings.TrimSuffix(base, "/v1")
+	return base + "/beta"
+}
+
+// chatCompletionsURL 根据请求选择对话接口地址，前缀续写请求使用Beta接口
+func (c *Client) chatCompletionsURL(req *DeepSeekChatRequest) string {
+	for _, msg := range req.Messages {
+		if msg.Prefix {
+			return c.betaBaseURL() + "/chat/completions"
+		}
+	}
+	return c.config.BaseURL + "/chat/completions"
+}
+
+// ChatPrefix 前缀续写：以prefix作为assistant回复的开头继续生成
+func (c *Client) ChatPrefix(ctx context.Context, req *unified.ChatRequest, prefix string) (*unified.ChatResponse, error) {
+	deepseekReq, err := c.toRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("convert to deepseek request failed: %w", err)
+	}
+
+	deepseekReq.Messages = append(deepseekReq.Messages, DeepSeekMessage{
+		Role:    "assistant",
+		Content: prefix,
+		Prefix:  true,
+	})
+	if deepseekReq.Model == "" {
+		deepseekReq.Model = c.config.Model
+	}
+
+	var deepseekResp DeepSeekChatResponse
+	if err := c.postJSON(ctx, c.chatCompletionsURL(deepseekReq), deepseekReq, &deepseekResp); err != nil {
+		return nil, err
+	}
+
+	return FromDeepSeekResponse(&deepseekResp), nil
+}
+
+// FIMCompletion FIM(Fill In the Middle)补全，根据prompt和suffix生成中间内容
+func (c *Client) FIMCompletion(ctx context.Context, req *DeepSeekFIMRequest) (*DeepSeekFIMResponse, error) {
+	if req.Prompt == "" {
+		return nil, fmt.Errorf("fim completion requires a prompt")
+	}
+	if req.Model == "" {
+		req.Model = c.config.Model
+	}
+
+	var fimResp DeepSeekFIMResponse
+	if err := c.postJSON(ctx, c.betaBaseURL()+"/completions", req, &fimResp); err != nil {
+		return nil, err
+	}
+	return &fimResp, nil
+}
+
+// postJSON 发送JSON请求并解析响应
+func (c *Client) postJSON(ctx context.Context, url string, body interface{}, out interface{}) (err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request failed: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("create http request failed: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	c.applyHeaders(httpReq)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return retry.NewStatusError(resp, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response failed: %w", err)
+	}
+	return nil
+}
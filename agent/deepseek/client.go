@@ -2,22 +2,40 @@ package deepseek
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/payload"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
 // Config DeepSeek配置
 type Config struct {
-	APIKey  string
-	BaseURL string
-	Model   string
+	APIKey      string
+	BaseURL     string
+	Model       string
+	BetaBaseURL string // 可选，Beta接口地址，默认根据BaseURL推导
+	// MergeSystemPrompt 为true时将系统提示词合并到第一条用户消息中，默认使用真正的system消息
+	MergeSystemPrompt bool
+	// Headers 可选，附加到每个请求的HTTP头（如组织ID、网关鉴权），同名时覆盖默认请求头
+	Headers map[string]string
+	// Credentials 可选，每次请求时获取API密钥，设置后优先于APIKey，用于在不重建客户端的情况下轮换密钥
+	Credentials func(ctx context.Context) (string, error)
+	// HTTPClient 可选，发送请求使用的HTTP客户端，多个客户端共享同一个时可以复用连接池，为nil时使用新建的默认客户端
+	HTTPClient *http.Client
+	// Retry 可选，限流、服务端错误和网络错误时的重试策略，为nil时不重试
+	Retry *RetryPolicy
 }
 
+// RetryPolicy HTTP请求的重试策略，退避时间翻倍并遵守Retry-After
+type RetryPolicy = retry.Policy
+
 // Client DeepSeek客户端
 type Client struct {
 	config     *Config
@@ -33,9 +51,13 @@ func NewClient(config *Config) *Client {
 		config.Model = "deepseek-chat"
 	}
 	
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
 		config:     config,
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 	}
 }
 
@@ -44,15 +66,33 @@ func (c *Client) GetProvider() string {
 	return "deepseek"
 }
 
+// applyHeaders 设置配置中的自定义请求头
+func (c *Client) applyHeaders(httpReq *http.Request) {
+	for key, value := range c.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
+
+// do 按重试策略发送请求
+func (c *Client) do(httpReq *http.Request) (*http.Response, error) {
+	return c.config.Retry.Do(c.httpClient, httpReq)
+}
+
 // ValidateRequest 验证请求参数
-func (c *Client) ValidateRequest(req interface{}) error {
+func (c *Client) ValidateRequest(req *unified.ChatRequest) error {
 	// 可以添加特定的验证逻辑
 	return nil
 }
 
 // Chat 发送聊天请求
-func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error) {
-	deepseekReq, err := ToDeepSeekRequest(req)
+func (c *Client) Chat(ctx context.Context, req *unified.ChatRequest) (_ *unified.ChatResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	deepseekReq, err := c.toRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to deepseek request failed: %w", err)
 	}
@@ -62,22 +102,25 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 		deepseekReq.Model = c.config.Model
 	}
 	
-	reqBody, err := json.Marshal(deepseekReq)
+	reqBody, err := payload.JSON(deepseekReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
 	// 调试输出已移除
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.chatCompletionsURL(deepseekReq), nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -85,20 +128,51 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 	
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 
 	var deepseekResp DeepSeekChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&deepseekResp); err != nil {
+	if !deepseekReq.IncludeRawResponse {
+		// 不需要原始响应时直接从响应体流式解码，不缓存整个响应
+		if err := payload.DecodeJSON(resp.Body, &deepseekResp); err != nil {
+			return nil, fmt.Errorf("decode response failed: %w", err)
+		}
+		return FromDeepSeekResponse(&deepseekResp), nil
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %w", err)
+	}
+	if err := json.Unmarshal(bodyBytes, &deepseekResp); err != nil {
 		return nil, fmt.Errorf("decode response failed: %w", err)
 	}
-	
-	return FromDeepSeekResponse(&deepseekResp), nil
+	commonResp := FromDeepSeekResponse(&deepseekResp)
+	commonResp.RawResponse = bodyBytes
+	return commonResp, nil
 }
 
-// ChatStream 发送流式聊天请求
-func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interface{}, error) {
+// toRequest 转换统一请求，并按配置处理系统提示词
+func (c *Client) toRequest(req *unified.ChatRequest) (*DeepSeekChatRequest, error) {
 	deepseekReq, err := ToDeepSeekRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.MergeSystemPrompt {
+		MergeSystemPrompt(deepseekReq)
+	}
+	return deepseekReq, nil
+}
+
+// ChatStream 发送流式聊天请求
+func (c *Client) ChatStream(ctx context.Context, req *unified.ChatRequest) (_ <-chan DeepSeekStreamResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	deepseekReq, err := c.toRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to deepseek request failed: %w", err)
 	}
@@ -111,21 +185,24 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 		deepseekReq.Model = c.config.Model
 	}
 	
-	reqBody, err := json.Marshal(deepseekReq)
+	reqBody, err := payload.JSON(deepseekReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.chatCompletionsURL(deepseekReq), nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Accept", "text/event-stream")
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -133,10 +210,10 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
-	ch := make(chan interface{}, 10)
+	ch := make(chan DeepSeekStreamResponse, 10)
 	
 	go func() {
 		defer resp.Body.Close()
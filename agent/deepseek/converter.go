@@ -5,82 +5,37 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/schema"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
-// ToDeepSeekRequest 将统一请求转换为DeepSeek请求
-func ToDeepSeekRequest(req interface{}) (*DeepSeekChatRequest, error) {
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
-	}
-	
-	var commonReq struct {
-		Model       string `json:"model"`
-		Messages    []struct {
-			Role     string `json:"role"`
-			Content  []struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ImageURL *struct {
-					URL    string `json:"url"`
-					Detail string `json:"detail,omitempty"`
-				} `json:"image_url,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-				ToolID string `json:"tool_id,omitempty"`
-			} `json:"content"`
-			Name      string `json:"name,omitempty"`
-			ToolCalls []struct {
-				ID       string          `json:"id"`
-				Type     string          `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			} `json:"tool_calls,omitempty"`
-		} `json:"messages"`
-		Tools       []struct {
-			Type     string `json:"type"`
-			Function struct {
-				Name        string                 `json:"name"`
-				Description string                 `json:"description"`
-				Parameters  map[string]interface{} `json:"parameters"`
-			} `json:"function"`
-		} `json:"tools,omitempty"`
-		MaxTokens    int     `json:"max_tokens,omitempty"`
-		Temperature  float64 `json:"temperature,omitempty"`
-		Stream       bool    `json:"stream,omitempty"`
-		SystemPrompt string  `json:"system_prompt,omitempty"`
-	}
-	
-	if err := json.Unmarshal(reqBytes, &commonReq); err != nil {
-		return nil, fmt.Errorf("unmarshal to common request failed: %w", err)
-	}
-	
+// ToDeepSeekRequest 将统一请求转换为DeepSeek请求，不修改req
+func ToDeepSeekRequest(req *unified.ChatRequest) (*DeepSeekChatRequest, error) {
 	deepseekReq := &DeepSeekChatRequest{
-		Model:       commonReq.Model,
-		MaxTokens:   commonReq.MaxTokens,
-		Temperature: commonReq.Temperature,
-		Stream:      commonReq.Stream,
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
 	}
 	
-	// DeepSeek不推荐使用系统消息，将系统提示词合并到第一条用户消息中
-	var systemPromptToMerge string
-	if commonReq.SystemPrompt != "" {
-		systemPromptToMerge = commonReq.SystemPrompt
+	if req.HasTemperature() {
+		temperature := req.Temperature
+		deepseekReq.Temperature = &temperature
+	}
+
+	// 系统提示词作为system消息放在最前面
+	if req.SystemPrompt != "" {
+		deepseekReq.Messages = append(deepseekReq.Messages, DeepSeekMessage{
+			Role:    "system",
+			Content: req.SystemPrompt,
+		})
 	}
 	
 	// 转换消息
-	isFirstUserMessage := true
-	for _, msg := range commonReq.Messages {
+	for _, msg := range req.Messages {
 		deepseekMsg := DeepSeekMessage{
-			Role: msg.Role,
+			Role: string(msg.Role),
 			Name: msg.Name,
 		}
 		
@@ -104,7 +59,7 @@ func ToDeepSeekRequest(req interface{}) (*DeepSeekChatRequest, error) {
 						Type: "image_url",
 						ImageURL: &DeepSeekImageURL{
 							URL:    content.ImageURL.URL,
-							Detail: content.ImageURL.Detail,
+							Detail: string(content.ImageURL.Detail),
 						},
 					})
 				}
@@ -126,15 +81,9 @@ func ToDeepSeekRequest(req interface{}) (*DeepSeekChatRequest, error) {
 			// 如果有图片内容，需要使用数组格式，但要包含文本内容
 			var allContents []DeepSeekContent
 			if len(textParts) > 0 {
-				textContent := strings.Join(textParts, " ")
-				// 如果是第一条用户消息且有系统提示词，合并它们
-				if isFirstUserMessage && msg.Role == "user" && systemPromptToMerge != "" {
-					textContent = systemPromptToMerge + "\n\n" + textContent
-					isFirstUserMessage = false
-				}
 				allContents = append(allContents, DeepSeekContent{
 					Type: "text",
-					Text: textContent,
+					Text: strings.Join(textParts, " "),
 				})
 			}
 			allContents = append(allContents, imageContents...)
@@ -142,21 +91,10 @@ func ToDeepSeekRequest(req interface{}) (*DeepSeekChatRequest, error) {
 		} else {
 			// 如果没有图片，content必须是字符串格式
 			if len(textParts) > 0 {
-				textContent := strings.Join(textParts, " ")
-				// 如果是第一条用户消息且有系统提示词，合并它们
-				if isFirstUserMessage && msg.Role == "user" && systemPromptToMerge != "" {
-					textContent = systemPromptToMerge + "\n\n" + textContent
-					isFirstUserMessage = false
-				}
-				deepseekMsg.Content = textContent
+				deepseekMsg.Content = strings.Join(textParts, " ")
 			} else {
 				// 处理空内容的情况
-				if isFirstUserMessage && msg.Role == "user" && systemPromptToMerge != "" {
-					deepseekMsg.Content = systemPromptToMerge
-					isFirstUserMessage = false
-				} else {
-					deepseekMsg.Content = ""
-				}
+				deepseekMsg.Content = ""
 			}
 		}
 		
@@ -203,189 +141,149 @@ func ToDeepSeekRequest(req interface{}) (*DeepSeekChatRequest, error) {
 		deepseekReq.Messages = append(deepseekReq.Messages, deepseekMsg)
 	}
 	
+	// 前缀续写：最后一条assistant消息作为回复的前缀
+	if req.PrefixCompletion {
+		last := len(deepseekReq.Messages) - 1
+		if last < 0 || deepseekReq.Messages[last].Role != "assistant" {
+			return nil, fmt.Errorf("prefix completion requires the last message to be an assistant message")
+		}
+		deepseekReq.Messages[last].Prefix = true
+	}
+	
+	// 预填充：以Prefill作为回复前缀续写
+	if req.Prefill != "" {
+		if req.PrefixCompletion {
+			return nil, fmt.Errorf("prefill and prefix completion cannot be used together")
+		}
+		deepseekReq.Messages = append(deepseekReq.Messages, DeepSeekMessage{
+			Role:    "assistant",
+			Content: req.Prefill,
+			Prefix:  true,
+		})
+	}
+	
 	// 转换工具定义
-	for _, tool := range commonReq.Tools {
+	for _, tool := range req.Tools {
 		deepseekReq.Tools = append(deepseekReq.Tools, DeepSeekTool{
 			Type: tool.Type,
 			Function: DeepSeekFunctionDefinition{
 				Name:        tool.Function.Name,
 				Description: tool.Function.Description,
-				Parameters:  tool.Function.Parameters,
+				Parameters:  schema.Sanitize(tool.Function.Parameters),
 			},
 		})
 	}
 	
+	// 结构化输出，DeepSeek只支持json_object，Schema由调用方写入提示词
+	if format := req.ResponseFormat; format != nil && format.Type != "" {
+		formatType := string(format.Type)
+		if formatType == "json_schema" {
+			formatType = "json_object"
+		}
+		deepseekReq.ResponseFormat = &DeepSeekResponseFormat{Type: formatType}
+	}
+
+	deepseekReq.IncludeRawResponse = req.IncludeRawResponse
+	deepseekReq.ProviderOptions = req.ProviderOptions["deepseek"]
+
 	return deepseekReq, nil
 }
 
 // FromDeepSeekResponse 将DeepSeek响应转换为统一响应
-func FromDeepSeekResponse(resp *DeepSeekChatResponse) interface{} {
-	commonResp := struct {
-		ID      string    `json:"id"`
-		Object  string    `json:"object"`
-		Created time.Time `json:"created"`
-		Model   string    `json:"model"`
-		Choices []struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role     string `json:"role"`
-				Content  []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string          `json:"id"`
-						Type     string          `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
-	}{
+func FromDeepSeekResponse(resp *DeepSeekChatResponse) *unified.ChatResponse {
+	commonResp := &unified.ChatResponse{
 		ID:      resp.ID,
 		Object:  resp.Object,
 		Created: time.Unix(resp.Created, 0),
 		Model:   resp.Model,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: unified.Usage{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
+			Extensions:       usageExtensions(resp.Usage),
 		},
 	}
-	
+
 	// 转换选择
 	for _, choice := range resp.Choices {
-		commonChoice := struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role     string `json:"role"`
-				Content  []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string          `json:"id"`
-						Type     string          `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		}{
+		commonChoice := unified.Choice{
 			Index:        choice.Index,
 			FinishReason: choice.FinishReason,
 		}
-		
-		// 处理消息内容
-		commonChoice.Message.Role = choice.Message.Role
-		
+		commonChoice.Message.Role = unified.MessageRole(choice.Message.Role)
+
 		// 如果是字符串内容
 		if textContent, ok := choice.Message.Content.(string); ok {
-			commonChoice.Message.Content = append(commonChoice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "text",
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type: unified.ContentTypeText,
 				Text: textContent,
 			})
 		}
-		
-		// 处理工具调用
+
+		// 处理工具调用，同时添加到内容中作为tool_call类型
 		for _, toolCall := range choice.Message.ToolCalls {
-			commonChoice.Message.ToolCalls = append(commonChoice.Message.ToolCalls, struct {
-				ID       string          `json:"id"`
-				Type     string          `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			}{
+			call := unified.ToolCall{
 				ID:   toolCall.ID,
 				Type: toolCall.Type,
-				Function: struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				}{
+				Function: unified.FunctionCall{
 					Name:      toolCall.Function.Name,
 					Arguments: toolCall.Function.Arguments,
 				},
-			})
-			
-			// 同时添加到内容中作为tool_call类型
-			commonChoice.Message.Content = append(commonChoice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "tool_call",
-				ToolCall: &struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				}{
-					ID:   toolCall.ID,
-					Type: toolCall.Type,
-					Function: struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					}{
-						Name:      toolCall.Function.Name,
-						Arguments: toolCall.Function.Arguments,
-					},
-				},
+			}
+			commonChoice.Message.ToolCalls = append(commonChoice.Message.ToolCalls, call)
+			contentCall := call
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type:     unified.ContentTypeTool,
+				ToolCall: &contentCall,
 			})
 		}
-		
+
 		commonResp.Choices = append(commonResp.Choices, commonChoice)
 	}
-	
+
 	return commonResp
-}
\ No newline at end of file
+}
+
+// usageExtensions 提取DeepSeek上下文缓存命中统计，用于精确计费
+func usageExtensions(usage DeepSeekUsage) map[string]int {
+	if usage.PromptCacheHitTokens == 0 && usage.PromptCacheMissTokens == 0 {
+		return nil
+	}
+	return map[string]int{
+		"prompt_cache_hit_tokens":  usage.PromptCacheHitTokens,
+		"prompt_cache_miss_tokens": usage.PromptCacheMissTokens,
+	}
+}
+
+// MergeSystemPrompt 将system消息合并到第一条用户消息中，兼容不支持system角色的旧版模型或代理
+func MergeSystemPrompt(req *DeepSeekChatRequest) {
+	if len(req.Messages) == 0 || req.Messages[0].Role != "system" {
+		return
+	}
+	systemPrompt, _ := req.Messages[0].Content.(string)
+	messages := req.Messages[1:]
+
+	for i := range messages {
+		if messages[i].Role != "user" {
+			continue
+		}
+		switch content := messages[i].Content.(type) {
+		case string:
+			if content == "" {
+				messages[i].Content = systemPrompt
+			} else {
+				messages[i].Content = systemPrompt + "\n\n" + content
+			}
+		case []DeepSeekContent:
+			merged := make([]DeepSeekContent, 0, len(content)+1)
+			merged = append(merged, DeepSeekContent{Type: "text", Text: systemPrompt})
+			if len(content) > 0 && content[0].Type == "text" {
+				merged[0].Text = systemPrompt + "\n\n" + content[0].Text
+				content = content[1:]
+			}
+			messages[i].Content = append(merged, content...)
+		}
+		req.Messages = messages
+		return
+	}
+}
@@ -0,0 +1,59 @@
+package deepseek
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+)
+
+// DeepSeekModel DeepSeek模型列表中的模型
+type DeepSeekModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object,omitempty"`
+	Created int64  `json:"created,omitempty"`
+	OwnedBy string `json:"owned_by,omitempty"`
+}
+
+// DeepSeekModelList DeepSeek模型列表响应
+type DeepSeekModelList struct {
+	Object string          `json:"object"`
+	Data   []DeepSeekModel `json:"data"`
+}
+
+// ListModels 列出当前API密钥可用的模型
+func (c *Client) ListModels(ctx context.Context) (_ []DeepSeekModel, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.config.BaseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create http request failed: %w", err)
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	c.applyHeaders(httpReq)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var list DeepSeekModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decode response failed: %w", err)
+	}
+	return list.Data, nil
+}
@@ -1,6 +1,10 @@
 package deepseek
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
 
 // DeepSeekMessage DeepSeek的消息结构(兼容OpenAI格式)
 type DeepSeekMessage struct {
@@ -9,6 +13,7 @@ type DeepSeekMessage struct {
 	Name      string          `json:"name,omitempty"`
 	ToolCalls []DeepSeekToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string         `json:"tool_call_id,omitempty"`
+	Prefix    bool            `json:"prefix,omitempty"` // 前缀续写(Beta)，仅用于最后一条assistant消息
 }
 
 // DeepSeekContent DeepSeek的内容结构(用于多模态)
@@ -26,6 +31,7 @@ type DeepSeekImageURL struct {
 
 // DeepSeekToolCall DeepSeek的工具调用结构
 type DeepSeekToolCall struct {
+	Index    *int              `json:"index,omitempty"` // 流式增量中工具调用的序号
 	ID       string            `json:"id"`
 	Type     string            `json:"type"`
 	Function DeepSeekFunctionCall `json:"function"`
@@ -56,15 +62,89 @@ type DeepSeekChatRequest struct {
 	Messages    []DeepSeekMessage `json:"messages"`
 	Tools       []DeepSeekTool    `json:"tools,omitempty"`
 	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	TopP        *float64        `json:"top_p,omitempty"`
 	Stream      bool            `json:"stream,omitempty"`
+	ResponseFormat *DeepSeekResponseFormat `json:"response_format,omitempty"`
+
+	// IncludeRawResponse 是否在响应中保留提供商返回的原始JSON，不参与序列化
+	IncludeRawResponse bool `json:"-"`
+
+	// ProviderOptions 提供商特有的请求参数，序列化时深度合并到请求体中，优先级高于已建模的字段
+	ProviderOptions map[string]interface{} `json:"-"`
+}
+
+// DeepSeekResponseFormat 结构化输出格式（text或json_object）
+type DeepSeekResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// MarshalJSON 序列化请求，并将ProviderOptions中的字段合并到请求体中
+func (r DeepSeekChatRequest) MarshalJSON() ([]byte, error) {
+	type alias DeepSeekChatRequest
+	data, err := json.Marshal(alias(r))
+	if err != nil {
+		return nil, err
+	}
+	return mergeProviderOptions(data, r.ProviderOptions)
+}
+
+// mergeProviderOptions 将ProviderOptions深度合并到序列化后的请求体中
+// 同名字段以ProviderOptions为准，两边都是对象时合并子字段，值为nil时删除该字段
+func mergeProviderOptions(data []byte, options map[string]interface{}) ([]byte, error) {
+	if len(options) == 0 {
+		return data, nil
+	}
+
+	var body map[string]interface{}
+	if err := decodeJSONObject(data, &body); err != nil {
+		return nil, err
+	}
+	// 先序列化一次，使结构体等类型的值统一为map，便于深度合并
+	optionBytes, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provider options failed: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := decodeJSONObject(optionBytes, &normalized); err != nil {
+		return nil, err
+	}
+
+	mergeJSONObject(body, normalized)
+	return json.Marshal(body)
+}
+
+// mergeJSONObject 递归合并JSON对象
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			mergeJSONObject(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decodeJSONObject 解析JSON对象，数字保留为json.Number以免大整数丢失精度
+func decodeJSONObject(data []byte, v *map[string]interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
 }
 
 // DeepSeekUsage DeepSeek的使用统计结构
 type DeepSeekUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens          int `json:"prompt_tokens"`
+	CompletionTokens      int `json:"completion_tokens"`
+	TotalTokens           int `json:"total_tokens"`
+	PromptCacheHitTokens  int `json:"prompt_cache_hit_tokens,omitempty"`  // 命中上下文缓存的输入token数
+	PromptCacheMissTokens int `json:"prompt_cache_miss_tokens,omitempty"` // 未命中上下文缓存的输入token数
 }
 
 // DeepSeekChoice DeepSeek的选择结构
@@ -88,6 +168,7 @@ type DeepSeekChatResponse struct {
 type DeepSeekDelta struct {
 	Role      string          `json:"role,omitempty"`
 	Content   string          `json:"content,omitempty"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 	ToolCalls []DeepSeekToolCall `json:"tool_calls,omitempty"`
 }
 
@@ -106,4 +187,32 @@ type DeepSeekStreamResponse struct {
 	Model   string               `json:"model"`
 	Choices []DeepSeekStreamChoice `json:"choices"`
 	Usage   *DeepSeekUsage         `json:"usage,omitempty"`
-}
\ No newline at end of file
+}
+
+// DeepSeekFIMRequest FIM(Fill In the Middle)补全请求结构(Beta)
+type DeepSeekFIMRequest struct {
+	Model       string   `json:"model"`
+	Prompt      string   `json:"prompt"`
+	Suffix      string   `json:"suffix,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Echo        bool     `json:"echo,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// DeepSeekFIMChoice FIM补全选择结构
+type DeepSeekFIMChoice struct {
+	Index        int    `json:"index"`
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// DeepSeekFIMResponse FIM补全响应结构
+type DeepSeekFIMResponse struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []DeepSeekFIMChoice `json:"choices"`
+	Usage   DeepSeekUsage       `json:"usage"`
+}
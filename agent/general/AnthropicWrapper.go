@@ -16,26 +16,17 @@ func (w *AnthropicProviderWrapper) Chat(ctx context.Context, req *ChatRequest) (
 	if err != nil {
 		return nil, err
 	}
-	return convertToUnifiedResponse(resp), nil
+	normalizeFinishReasons(resp, ProviderAnthropic)
+	return resp, nil
 }
 
-func (w *AnthropicProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatResponse, error) {
+func (w *AnthropicProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *StreamChunk, error) {
 	ch, err := w.client.ChatStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-
-	unifiedCh := make(chan *ChatResponse, 10)
-	go func() {
-		defer close(unifiedCh)
-		for resp := range ch {
-			if converted := convertToUnifiedResponse(resp); converted != nil {
-				unifiedCh <- converted
-			}
-		}
-	}()
-
-	return unifiedCh, nil
+	stream := &anthropicStream{}
+	return convertStream(ctx, ch, stream.convert), nil
 }
 
 func (w *AnthropicProviderWrapper) GetProvider() Provider {
@@ -45,3 +36,17 @@ func (w *AnthropicProviderWrapper) GetProvider() Provider {
 func (w *AnthropicProviderWrapper) ValidateRequest(req *ChatRequest) error {
 	return w.client.ValidateRequest(req)
 }
+
+// ListModels 列出可用的模型
+func (w *AnthropicProviderWrapper) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	models, err := w.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fromAnthropicModels(models), nil
+}
+
+// CountTokens 调用服务端接口计算请求的输入token数
+func (w *AnthropicProviderWrapper) CountTokens(ctx context.Context, req *ChatRequest) (int, error) {
+	return w.client.CountTokens(ctx, req)
+}
@@ -16,26 +16,16 @@ func (w *DeepSeekProviderWrapper) Chat(ctx context.Context, req *ChatRequest) (*
 	if err != nil {
 		return nil, err
 	}
-	return convertToUnifiedResponse(resp), nil
+	normalizeFinishReasons(resp, ProviderDeepSeek)
+	return resp, nil
 }
 
-func (w *DeepSeekProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatResponse, error) {
+func (w *DeepSeekProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *StreamChunk, error) {
 	ch, err := w.client.ChatStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-
-	unifiedCh := make(chan *ChatResponse, 10)
-	go func() {
-		defer close(unifiedCh)
-		for resp := range ch {
-			if converted := convertToUnifiedResponse(resp); converted != nil {
-				unifiedCh <- converted
-			}
-		}
-	}()
-
-	return unifiedCh, nil
+	return convertStream(ctx, ch, fromDeepSeekStream), nil
 }
 
 func (w *DeepSeekProviderWrapper) GetProvider() Provider {
@@ -45,3 +35,27 @@ func (w *DeepSeekProviderWrapper) GetProvider() Provider {
 func (w *DeepSeekProviderWrapper) ValidateRequest(req *ChatRequest) error {
 	return w.client.ValidateRequest(req)
 }
+
+// ListModels 列出可用的模型
+func (w *DeepSeekProviderWrapper) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	models, err := w.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fromDeepSeekModels(models), nil
+}
+
+// ChatPrefix 前缀续写(Beta)：以prefix作为assistant回复的开头继续生成
+func (w *DeepSeekProviderWrapper) ChatPrefix(ctx context.Context, req *ChatRequest, prefix string) (*ChatResponse, error) {
+	resp, err := w.client.ChatPrefix(ctx, req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	normalizeFinishReasons(resp, ProviderDeepSeek)
+	return resp, nil
+}
+
+// FIMCompletion FIM补全(Beta)，用于代码补全等根据前后文生成中间内容的场景
+func (w *DeepSeekProviderWrapper) FIMCompletion(ctx context.Context, req *deepseek.DeepSeekFIMRequest) (*deepseek.DeepSeekFIMResponse, error) {
+	return w.client.FIMCompletion(ctx, req)
+}
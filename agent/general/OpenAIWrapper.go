@@ -16,26 +16,16 @@ func (w *OpenAIProviderWrapper) Chat(ctx context.Context, req *ChatRequest) (*Ch
 	if err != nil {
 		return nil, err
 	}
-	return convertToUnifiedResponse(resp), nil
+	normalizeFinishReasons(resp, ProviderOpenAI)
+	return resp, nil
 }
 
-func (w *OpenAIProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatResponse, error) {
+func (w *OpenAIProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *StreamChunk, error) {
 	ch, err := w.client.ChatStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-
-	unifiedCh := make(chan *ChatResponse, 10)
-	go func() {
-		defer close(unifiedCh)
-		for resp := range ch {
-			if converted := convertToUnifiedResponse(resp); converted != nil {
-				unifiedCh <- converted
-			}
-		}
-	}()
-
-	return unifiedCh, nil
+	return convertStream(ctx, ch, fromOpenAIStream), nil
 }
 
 func (w *OpenAIProviderWrapper) GetProvider() Provider {
@@ -45,3 +35,12 @@ func (w *OpenAIProviderWrapper) GetProvider() Provider {
 func (w *OpenAIProviderWrapper) ValidateRequest(req *ChatRequest) error {
 	return w.client.ValidateRequest(req)
 }
+
+// ListModels 列出可用的模型
+func (w *OpenAIProviderWrapper) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	models, err := w.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fromOpenAIModels(models), nil
+}
@@ -2,15 +2,18 @@ package general
 
 import (
 	"context"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/qwen"
 )
 
 // QwenProviderWrapper Qwen提供商包装器
 type QwenProviderWrapper struct {
 	client interface {
-		Chat(ctx context.Context, req interface{}) (interface{}, error)
-		ChatStream(ctx context.Context, req interface{}) (<-chan interface{}, error)
+		Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+		ChatStream(ctx context.Context, req *ChatRequest) (<-chan qwen.QwenStreamResponse, error)
 		GetProvider() string
-		ValidateRequest(req interface{}) error
+		ValidateRequest(req *ChatRequest) error
+		ListModels(ctx context.Context) ([]qwen.QwenModel, error)
 	}
 }
 
@@ -21,32 +24,17 @@ func (w *QwenProviderWrapper) Chat(ctx context.Context, req *ChatRequest) (*Chat
 		return nil, err
 	}
 
-	// 转换为统一响应格式
-	return convertToUnifiedResponse(resp), nil
+	normalizeFinishReasons(resp, ProviderQwen)
+	return resp, nil
 }
 
 // ChatStream 发送流式聊天请求
-func (w *QwenProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatResponse, error) {
+func (w *QwenProviderWrapper) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *StreamChunk, error) {
 	ch, err := w.client.ChatStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-
-	// 创建转换通道
-	resultCh := make(chan *ChatResponse, 10)
-
-	go func() {
-		defer close(resultCh)
-		for resp := range ch {
-			// 转换为统一格式
-			converted := convertToUnifiedResponse(resp)
-			if converted != nil {
-				resultCh <- converted
-			}
-		}
-	}()
-
-	return resultCh, nil
+	return convertStream(ctx, ch, fromQwenStream), nil
 }
 
 // GetProvider 获取提供商名称
@@ -58,3 +46,12 @@ func (w *QwenProviderWrapper) GetProvider() Provider {
 func (w *QwenProviderWrapper) ValidateRequest(req *ChatRequest) error {
 	return w.client.ValidateRequest(req)
 }
+
+// ListModels 列出可用的模型
+func (w *QwenProviderWrapper) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	models, err := w.client.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fromQwenModels(models), nil
+}
@@ -0,0 +1,203 @@
+package general
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Capability 模型的一项能力，请求使用了模型不支持的能力时在发送前返回CapabilityError
+type Capability string
+
+const (
+	CapabilityVision    Capability = "vision"    // 图片输入
+	CapabilityAudio     Capability = "audio"     // 音频输入或输出
+	CapabilityDocuments Capability = "documents" // 文档（如PDF）输入
+	CapabilityTools     Capability = "tools"     // 原生函数调用，模拟函数调用不需要
+	CapabilityStreaming Capability = "streaming" // 流式输出，只支持批量接口的模型为false
+)
+
+// ModelCapabilities 模型支持的能力
+type ModelCapabilities struct {
+	Vision    bool `json:"vision"`
+	Audio     bool `json:"audio"`
+	Documents bool `json:"documents"`
+	Tools     bool `json:"tools"`
+	Streaming bool `json:"streaming"`
+}
+
+// Supports 判断是否支持指定能力，未知的能力视为支持
+func (c ModelCapabilities) Supports(capability Capability) bool {
+	switch capability {
+	case CapabilityVision:
+		return c.Vision
+	case CapabilityAudio:
+		return c.Audio
+	case CapabilityDocuments:
+		return c.Documents
+	case CapabilityTools:
+		return c.Tools
+	case CapabilityStreaming:
+		return c.Streaming
+	}
+	return true
+}
+
+// CapabilityError 请求使用了模型不支持的能力
+type CapabilityError struct {
+	Provider   Provider
+	Model      string
+	Capability Capability
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("model %s of provider %s does not support %s", e.Model, e.Provider, e.Capability)
+}
+
+// modelRegistry 按提供商和模型ID登记的模型信息
+type modelRegistry struct {
+	mu     sync.RWMutex
+	models map[Provider]map[string]ModelInfo
+}
+
+// RegisterModels 登记模型信息，同一提供商的同一模型后登记的覆盖先登记的
+// 登记了Capabilities的模型在请求发送前校验能力，未登记或Capabilities为nil的模型不校验
+func (m *AgentManager) RegisterModels(models ...ModelInfo) error {
+	for _, info := range models {
+		if info.Provider == "" || info.ID == "" {
+			return fmt.Errorf("model info requires provider and id (provider %q, id %q)", info.Provider, info.ID)
+		}
+	}
+	m.models.mu.Lock()
+	defer m.models.mu.Unlock()
+	if m.models.models == nil {
+		m.models.models = make(map[Provider]map[string]ModelInfo)
+	}
+	for _, info := range models {
+		if m.models.models[info.Provider] == nil {
+			m.models.models[info.Provider] = make(map[string]ModelInfo)
+		}
+		m.models.models[info.Provider][info.ID] = info
+	}
+	return nil
+}
+
+// LookupModel 返回登记的模型信息
+func (m *AgentManager) LookupModel(provider Provider, model string) (ModelInfo, bool) {
+	m.models.mu.RLock()
+	defer m.models.mu.RUnlock()
+	info, ok := m.models.models[provider][model]
+	return info, ok
+}
+
+// ValidateRequest 在发送前校验请求：检查登记的模型能力和大小限制，再由提供商校验请求参数
+// 请求使用了模型不支持的能力时返回*CapabilityError，超出大小限制时返回*SizeLimitError，stream表示是否作为流式请求发送
+// Chat和ChatStream在应用默认参数和模拟函数调用之后自动调用，这里可以用于提前检查
+func (m *AgentManager) ValidateRequest(provider Provider, req *ChatRequest, stream bool) error {
+	p, err := m.GetProvider(provider)
+	if err != nil {
+		return err
+	}
+	return m.validateRequest(provider, p, req, stream)
+}
+
+// SetAllowedModels 限制Chat和ChatStream只能使用这些模型，不传参数时取消限制
+// 在请求发送前检查，未指定模型的请求按提供商的默认模型检查
+func (m *AgentManager) SetAllowedModels(models ...string) {
+	if len(models) == 0 {
+		m.allowed = nil
+		return
+	}
+	m.allowed = make(map[string]bool, len(models))
+	for _, model := range models {
+		m.allowed[model] = true
+	}
+}
+
+// checkAllowedModel 检查模型是否在允许列表中
+func (m *AgentManager) checkAllowedModel(provider Provider, req *ChatRequest) error {
+	if len(m.allowed) == 0 {
+		return nil
+	}
+	model := req.Model
+	if model == "" {
+		model = getDefaultModel(provider)
+	}
+	if !m.allowed[model] {
+		return fmt.Errorf("model %s is not allowed", model)
+	}
+	return nil
+}
+
+// validateRequest 检查模型允许列表、模型能力、大小限制和提供商的请求校验
+func (m *AgentManager) validateRequest(provider Provider, p LLMProvider, req *ChatRequest, stream bool) error {
+	if err := m.checkAllowedModel(provider, req); err != nil {
+		return err
+	}
+	if err := m.checkCapabilities(provider, req, stream); err != nil {
+		return err
+	}
+	if err := m.checkSizeLimits(provider, req); err != nil {
+		return err
+	}
+	return p.ValidateRequest(req)
+}
+
+// checkCapabilities 检查请求使用的能力是否都被模型支持
+func (m *AgentManager) checkCapabilities(provider Provider, req *ChatRequest, stream bool) error {
+	info, ok := m.LookupModel(provider, req.Model)
+	if !ok || info.Capabilities == nil {
+		return nil
+	}
+	for _, capability := range requiredCapabilities(req, stream) {
+		if !info.Capabilities.Supports(capability) {
+			return &CapabilityError{Provider: provider, Model: req.Model, Capability: capability}
+		}
+	}
+	return nil
+}
+
+// requiredCapabilities 返回请求使用的能力
+func requiredCapabilities(req *ChatRequest, stream bool) []Capability {
+	var vision, audio, documents bool
+	for _, msg := range req.Messages {
+		for _, content := range msg.Content {
+			switch content.Type {
+			case ContentTypeImageURL, ContentTypeImageB64:
+				vision = true
+			case ContentTypeAudio:
+				// 助手消息中的音频是模型之前的输出，只在请求音频输出时需要支持
+				if msg.Role != RoleAssistant {
+					audio = true
+				}
+			case ContentTypeDocument:
+				documents = true
+			}
+		}
+	}
+	for _, modality := range req.Modalities {
+		if modality == "audio" {
+			audio = true
+		}
+	}
+	if req.Audio != nil {
+		audio = true
+	}
+
+	var required []Capability
+	if vision {
+		required = append(required, CapabilityVision)
+	}
+	if audio {
+		required = append(required, CapabilityAudio)
+	}
+	if documents {
+		required = append(required, CapabilityDocuments)
+	}
+	if len(req.Tools) > 0 {
+		required = append(required, CapabilityTools)
+	}
+	if stream {
+		required = append(required, CapabilityStreaming)
+	}
+	return required
+}
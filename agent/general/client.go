@@ -3,6 +3,7 @@ package general
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/ccIisIaIcat/GoAgent/agent/anthropic"
 	"github.com/ccIisIaIcat/GoAgent/agent/deepseek"
@@ -14,74 +15,147 @@ import (
 // ProviderConfig 提供商配置
 type ProviderConfig struct {
 	Provider Provider `json:"provider"`
-	APIKey   string   `json:"api_key"`
-	BaseURL  string   `json:"base_url,omitempty"`
-	Model    string   `json:"model,omitempty"`
+	// Type 客户端类型（openai、anthropic、google、deepseek、qwen），为空时与Provider相同
+	// 设置后可以用自定义名称注册兼容的服务，如Type为openai的Ollama、vLLM、OpenRouter
+	Type    Provider `json:"type,omitempty"`
+	APIKey  string   `json:"api_key"`
+	BaseURL string   `json:"base_url,omitempty"`
+	Model   string   `json:"model,omitempty"`
+	// MergeSystemPrompt 仅DeepSeek使用，为true时将系统提示词合并到第一条用户消息中
+	MergeSystemPrompt bool `json:"merge_system_prompt,omitempty"`
+	// Headers 附加到每个请求的HTTP头，如OpenAI-Organization、OpenRouter的HTTP-Referer/X-Title、企业网关鉴权
+	Headers map[string]string `json:"headers,omitempty"`
+	// Credentials API密钥提供者，设置后每次请求时获取密钥并优先于APIKey，用于密钥轮换
+	Credentials CredentialsProvider `json:"-"`
+	// Defaults 默认生成参数，请求中未设置的参数使用默认值
+	Defaults GenerationDefaults `json:"defaults,omitempty"`
+	// EmulateTools 为true时不发送原生工具定义，而是在系统提示词中描述工具并从回复文本中解析工具调用
+	// 用于不支持原生函数调用的本地或旧模型，对调用方透明
+	EmulateTools bool `json:"emulate_tools,omitempty"`
+	// Limits 请求和响应的大小限制，超出时在发送前返回SizeLimitError
+	Limits SizeLimits `json:"limits,omitempty"`
+	// HTTPClient 该提供商使用的HTTP客户端，为nil时使用AgentManager共享的客户端（见SetHTTPClient）
+	HTTPClient *http.Client `json:"-"`
+	// HTTPRetry 客户端内部的HTTP重试策略，为nil时不重试；设置后Defaults.Retry不再生效
+	HTTPRetry *HTTPRetryPolicy `json:"http_retry,omitempty"`
 }
 
 // AgentManager 智能体管理器
 type AgentManager struct {
-	PC        ProviderConfig
-	providers map[Provider]LLMProvider
+	PC         ProviderConfig
+	providers  map[Provider]LLMProvider
+	defaults   map[Provider]GenerationDefaults
+	types      map[Provider]Provider
+	emulated   map[Provider]bool       // 模拟函数调用的提供商
+	limits     map[Provider]SizeLimits // 提供商的大小限制
+	httpClient *http.Client            // 提供商共享的HTTP客户端，复用连接池
+	models     modelRegistry           // 登记的模型信息，用于在请求前校验模型能力
+	allowed    map[string]bool         // 允许使用的模型，为空时不限制
+	httpRetry  map[Provider]bool       // 设置了HTTPRetry的提供商，不再使用GenerationDefaults.Retry
 }
 
 // NewAgentManager 创建智能体管理器
 func NewAgentManager() *AgentManager {
 	return &AgentManager{
-		providers: make(map[Provider]LLMProvider),
+		providers:  make(map[Provider]LLMProvider),
+		defaults:   make(map[Provider]GenerationDefaults),
+		types:      make(map[Provider]Provider),
+		emulated:   make(map[Provider]bool),
+		limits:     make(map[Provider]SizeLimits),
+		httpRetry:  make(map[Provider]bool),
+		httpClient: NewHTTPClient(TransportConfig{}),
 	}
 }
 
 // AddProvider 添加提供商
 func (m *AgentManager) AddProvider(config *ProviderConfig) error {
-	switch config.Provider {
+	providerType := config.Type
+	if providerType == "" {
+		providerType = config.Provider
+	}
+
+	switch providerType {
 	case ProviderOpenAI:
 		client := openai.NewClient(&openai.Config{
-			APIKey:  config.APIKey,
-			BaseURL: config.BaseURL,
-			Model:   config.Model,
+			APIKey:      config.APIKey,
+			BaseURL:     config.BaseURL,
+			Model:       config.Model,
+			Headers:     config.Headers,
+			Credentials: credentialsFunc(config.Credentials),
+			HTTPClient:  m.httpClientFor(config),
+			Retry:       config.HTTPRetry,
 		})
-		m.providers[ProviderOpenAI] = &OpenAIProviderWrapper{client: client}
+		m.providers[config.Provider] = &OpenAIProviderWrapper{client: client}
 
 	case ProviderAnthropic:
 		client := anthropic.NewClient(&anthropic.Config{
-			APIKey:  config.APIKey,
-			BaseURL: config.BaseURL,
-			Model:   config.Model,
+			APIKey:      config.APIKey,
+			BaseURL:     config.BaseURL,
+			Model:       config.Model,
+			Headers:     config.Headers,
+			Credentials: credentialsFunc(config.Credentials),
+			HTTPClient:  m.httpClientFor(config),
+			Retry:       config.HTTPRetry,
 		})
-		m.providers[ProviderAnthropic] = &AnthropicProviderWrapper{client: client}
+		m.providers[config.Provider] = &AnthropicProviderWrapper{client: client}
 
 	case ProviderGoogle:
 		client := google.NewClient(&google.Config{
-			APIKey:  config.APIKey,
-			BaseURL: config.BaseURL,
-			Model:   config.Model,
+			APIKey:      config.APIKey,
+			BaseURL:     config.BaseURL,
+			Model:       config.Model,
+			Headers:     config.Headers,
+			Credentials: credentialsFunc(config.Credentials),
+			HTTPClient:  m.httpClientFor(config),
+			Retry:       config.HTTPRetry,
 		})
-		m.providers[ProviderGoogle] = &GoogleProviderWrapper{client: client}
+		m.providers[config.Provider] = &GoogleProviderWrapper{client: client}
 
 	case ProviderDeepSeek:
 		client := deepseek.NewClient(&deepseek.Config{
-			APIKey:  config.APIKey,
-			BaseURL: config.BaseURL,
-			Model:   config.Model,
+			APIKey:            config.APIKey,
+			BaseURL:           config.BaseURL,
+			Model:             config.Model,
+			Headers:           config.Headers,
+			Credentials:       credentialsFunc(config.Credentials),
+			MergeSystemPrompt: config.MergeSystemPrompt,
+			HTTPClient:        m.httpClientFor(config),
+			Retry:             config.HTTPRetry,
 		})
-		m.providers[ProviderDeepSeek] = &DeepSeekProviderWrapper{client: client}
+		m.providers[config.Provider] = &DeepSeekProviderWrapper{client: client}
 
 	case ProviderQwen:
 		client := qwen.NewClient(&qwen.Config{
-			APIKey:  config.APIKey,
-			BaseURL: config.BaseURL,
-			Model:   config.Model,
+			APIKey:      config.APIKey,
+			BaseURL:     config.BaseURL,
+			Model:       config.Model,
+			Headers:     config.Headers,
+			Credentials: credentialsFunc(config.Credentials),
+			HTTPClient:  m.httpClientFor(config),
+			Retry:       config.HTTPRetry,
 		})
-		m.providers[ProviderQwen] = &QwenProviderWrapper{client: client}
+		m.providers[config.Provider] = &QwenProviderWrapper{client: client}
 
 	default:
-		return fmt.Errorf("unsupported provider: %s", config.Provider)
+		return fmt.Errorf("unsupported provider: %s", providerType)
 	}
+	m.defaults[config.Provider] = config.Defaults
+	m.types[config.Provider] = providerType
+	m.emulated[config.Provider] = config.EmulateTools
+	m.limits[config.Provider] = config.Limits
+	m.httpRetry[config.Provider] = config.HTTPRetry != nil && config.HTTPRetry.MaxAttempts > 1
 
 	return nil
 }
 
+// ProviderType 获取提供商使用的客户端类型，自定义名称的提供商返回其Type，未注册时返回provider本身
+func (m *AgentManager) ProviderType(provider Provider) Provider {
+	if providerType, ok := m.types[provider]; ok {
+		return providerType
+	}
+	return provider
+}
+
 // GetProvider 获取提供商
 func (m *AgentManager) GetProvider(provider Provider) (LLMProvider, error) {
 	if p, exists := m.providers[provider]; exists {
@@ -97,34 +171,137 @@ func (m *AgentManager) Chat(ctx context.Context, provider Provider, req *ChatReq
 		return nil, err
 	}
 
-	// 对maxtokens进行检查
-	if req.MaxTokens == 0 {
-		req.MaxTokens = 3000
-	}
+	// 未设置的参数使用提供商的默认参数
+	defaults := m.defaults[provider]
+	req = defaults.applyDefaults(req)
+	m.resolveProviderOptions(provider, req)
 	// 对模型进行赋值
 	if req.Model == "" {
 		req.Model = getDefaultModel(provider)
 	}
 
-	if err := p.ValidateRequest(req); err != nil {
+	applyResponseFormat(m.ProviderType(provider), req)
+	var prefix string
+	if req, prefix, err = applyPrefill(m.ProviderType(provider), req); err != nil {
+		return nil, fmt.Errorf("validate request failed: %w", err)
+	}
+	req = applySpeakerNames(m.ProviderType(provider), req)
+
+	// 模拟函数调用时工具名称只出现在文本中，不需要别名
+	tools := req.Tools
+	emulate := m.emulateTools(provider, req)
+	var restore map[string]string
+	if emulate {
+		req = emulateToolsRequest(req)
+	} else {
+		req, restore = aliasToolNames(m.ProviderType(provider), req)
+	}
+
+	if err := m.validateRequest(provider, p, req, false); err != nil {
 		return nil, fmt.Errorf("validate request failed: %w", err)
 	}
 
-	return p.Chat(ctx, req)
+	// 只使用一层重试：客户端已按HTTPRetry重试时不再整体重试
+	retryPolicy := defaults.Retry
+	if m.httpRetry[provider] {
+		retryPolicy = nil
+	}
+	call := func(req *ChatRequest) (*ChatResponse, error) {
+		resp, err := retryPolicy.withRetry(ctx, func() (*ChatResponse, error) {
+			callCtx := ctx
+			if defaults.Timeout > 0 {
+				var cancel context.CancelFunc
+				callCtx, cancel = context.WithTimeout(ctx, defaults.Timeout)
+				defer cancel()
+			}
+			return p.Chat(callCtx, req)
+		})
+		if err == nil && emulate {
+			parseEmulatedToolCalls(resp, tools)
+		}
+		if err == nil {
+			restoreToolNames(resp, restore)
+			prependPrefill(resp, prefix)
+		}
+		return resp, err
+	}
+	if req.ResponseFormat.Structured() {
+		return m.chatStructured(ctx, call, req)
+	}
+	return call(req)
 }
 
-// ChatStream 发送流式聊天请求
-func (m *AgentManager) ChatStream(ctx context.Context, provider Provider, req *ChatRequest) (<-chan *ChatResponse, error) {
+// ChatStream 发送流式聊天请求，各提供商的流式事件统一转换为StreamChunk
+func (m *AgentManager) ChatStream(ctx context.Context, provider Provider, req *ChatRequest) (<-chan *StreamChunk, error) {
 	p, err := m.GetProvider(provider)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := p.ValidateRequest(req); err != nil {
+	// 流式请求同样使用默认参数，超时、重试和结构化输出校验不适用于流式请求
+	// 模拟函数调用时只转换请求，<tool_call>块保留在流式返回的文本中
+	req = m.defaults[provider].applyDefaults(req)
+	m.resolveProviderOptions(provider, req)
+	applyResponseFormat(m.ProviderType(provider), req)
+	var prefix string
+	if req, prefix, err = applyPrefill(m.ProviderType(provider), req); err != nil {
+		return nil, fmt.Errorf("validate request failed: %w", err)
+	}
+	req = applySpeakerNames(m.ProviderType(provider), req)
+	var restore map[string]string
+	if m.emulateTools(provider, req) {
+		req = emulateToolsRequest(req)
+	} else {
+		req, restore = aliasToolNames(m.ProviderType(provider), req)
+	}
+
+	if err := m.validateRequest(provider, p, req, true); err != nil {
 		return nil, fmt.Errorf("validate request failed: %w", err)
 	}
 
-	return p.ChatStream(ctx, req)
+	// 调用方放弃读取时通过streamCtx取消上游请求，提供商客户端的goroutine随之退出
+	streamCtx, cancel := context.WithCancel(ctx)
+	ch, err := p.ChatStream(streamCtx, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 先发送Prefill，再还原流式返回的工具调用名称
+	var first []*StreamChunk
+	if prefix != "" {
+		first = append(first, &StreamChunk{Model: req.Model, Delta: prefix})
+	}
+	return guardStream(streamCtx, cancel, ch, first, m.defaults[provider].StreamConsumerTimeout, func(chunk *StreamChunk) {
+		restoreChunkToolNames(chunk, restore)
+	}), nil
+}
+
+// EmulatesTools 判断提供商是否配置了模拟函数调用
+func (m *AgentManager) EmulatesTools(provider Provider) bool {
+	return m.emulated[provider]
+}
+
+// emulateTools 判断请求是否需要模拟函数调用
+func (m *AgentManager) emulateTools(provider Provider, req *ChatRequest) bool {
+	return req.EmulateTools || m.emulated[provider]
+}
+
+// resolveProviderOptions 自定义名称的提供商按名称读取ProviderOptions
+// converter按客户端类型读取参数，这里将名称对应的参数放到类型下，避免误用同类型其他提供商的参数
+func (m *AgentManager) resolveProviderOptions(provider Provider, req *ChatRequest) {
+	providerType := m.ProviderType(provider)
+	if providerType == provider || len(req.ProviderOptions) == 0 {
+		return
+	}
+	options := make(map[Provider]map[string]interface{}, len(req.ProviderOptions))
+	for key, value := range req.ProviderOptions {
+		options[key] = value
+	}
+	delete(options, providerType)
+	if named, ok := req.ProviderOptions[provider]; ok {
+		options[providerType] = named
+	}
+	req.ProviderOptions = options
 }
 
 // ListProviders 列出所有已注册的提供商
@@ -1,8 +1,13 @@
 package general
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -12,6 +17,18 @@ type APIConfig struct {
 	BaseUrl string `yaml:"BaseUrl"`
 	APIKey  string `yaml:"APIKey"`
 	Model   string `yaml:"Model,omitempty"` // 可选的模型名称
+	// MergeSystemPrompt 可选，仅DeepSeek使用，将系统提示词合并到第一条用户消息中
+	MergeSystemPrompt bool `yaml:"MergeSystemPrompt,omitempty"`
+	// Headers 可选，附加到每个请求的HTTP头
+	Headers map[string]string `yaml:"Headers,omitempty"`
+	// Defaults 可选，默认生成参数（温度、max_tokens、top_p、系统提示词、超时、重试）
+	Defaults GenerationDefaults `yaml:"Defaults,omitempty"`
+	// EmulateTools 可选，以文本模拟函数调用，用于不支持原生函数调用的本地或旧模型
+	EmulateTools bool `yaml:"EmulateTools,omitempty"`
+	// Limits 可选，请求和响应的大小限制（请求体字节数、图片数量、工具定义字节数、响应体字节数）
+	Limits SizeLimits `yaml:"Limits,omitempty"`
+	// HTTPRetry 可选，客户端内部对限流、服务端错误和网络错误的重试（最大次数、退避时间、状态码）
+	HTTPRetry *HTTPRetryPolicy `yaml:"HTTPRetry,omitempty"`
 }
 
 // LLMConfig 完整的LLM配置
@@ -23,28 +40,184 @@ type LLMConfig struct {
 		GoogleKey APIConfig `yaml:"GoogleKey"`
 		Qwen      APIConfig `yaml:"Qwen"`
 	} `yaml:"AgentAPIKey"`
+	// Providers 通用提供商列表，与AgentAPIKey中的固定配置等价，同一提供商同时出现时以列表为准
+	// 通过Name可以声明任意数量的兼容服务，如Type为openai的Ollama、vLLM、OpenRouter
+	Providers []ProviderEntry `yaml:"Providers,omitempty"`
+	// Profiles 命名配置（如dev、staging、prod），加载时选中的配置深度合并到顶层配置之上
+	Profiles map[string]LLMConfig `yaml:"Profiles,omitempty"`
 }
 
-// LoadConfig 从YAML文件加载配置
-func LoadConfig(filename string) (*LLMConfig, error) {
+// ProviderEntry 通用提供商列表中的一项
+type ProviderEntry struct {
+	Name      Provider `yaml:"Name,omitempty"` // 注册到AgentManager的名称，为空时使用Type
+	Type      Provider `yaml:"Type"`           // openai、anthropic、deepseek、google、qwen
+	APIConfig `yaml:",inline"`
+}
+
+// ProviderName 获取提供商注册名称
+func (e ProviderEntry) ProviderName() Provider {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Type
+}
+
+// LoadConfig 从配置文件加载配置，根据扩展名支持YAML（默认）、JSON（.json）和TOML（.toml）
+// profile可选，指定时将Profiles中对应的配置合并到顶层配置之上
+// 加载后校验配置，未知的键、缺失的必填字段等问题会一并返回
+func LoadConfig(filename string, profile ...string) (*LLMConfig, error) {
+	selected := ""
+	if len(profile) > 0 {
+		selected = profile[0]
+	}
+	config, problems, err := readConfigFile(filename, selected)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConfig(config, problems); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", filename, err)
+	}
+	return config, nil
+}
+
+// ParseConfig 解析并校验配置，format为yaml、json或toml，profile为空时只使用顶层配置
+func ParseConfig(data []byte, format string, profile string) (*LLMConfig, error) {
+	config, problems, err := decodeConfig(data, format, profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConfig(config, problems); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readConfigFile 读取并解析配置文件，返回未知键等问题但不校验必填字段
+func readConfigFile(filename string, profile string) (*LLMConfig, []string, error) {
 	// 检查文件是否存在
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return nil, fmt.Errorf("config file %s does not exist", filename)
+		return nil, nil, fmt.Errorf("config file %s does not exist", filename)
 	}
 
 	// 读取文件内容
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, problems, err := decodeConfig(data, configFormat(filename), profile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config file %s: %w", filename, err)
+	}
+	return config, problems, nil
+}
+
+// decodeConfig 解析配置并合并profile，返回未知键等问题
+func decodeConfig(data []byte, format string, profile string) (*LLMConfig, []string, error) {
+	var raw interface{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	case "toml":
+		table, err := parseTOML(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse TOML: %w", err)
+		}
+		raw = table
+	case "yaml", "yml", "":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported config format %q", format)
+	}
+
+	raw = normalizeConfigValue(raw)
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	problems := checkConfigKeys(raw, reflect.TypeOf(LLMConfig{}), "")
+	if table, ok := raw.(map[string]interface{}); ok {
+		merged, err := applyProfile(table, profile)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw = merged
 	}
 
-	// 解析YAML
+	// 统一转换为YAML后解析到结构体，YAML可以表示JSON和TOML的所有值
+	normalized, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to normalize config: %w", err)
+	}
 	var config LLMConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if err := yaml.Unmarshal(normalized, &config); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return &config, problems, nil
+}
+
+// validateConfig 校验配置，与解析阶段发现的问题一起返回
+func validateConfig(config *LLMConfig, problems []string) error {
+	if err := config.Validate(); err != nil {
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			return err
+		}
+		problems = append(problems, configErr.Problems...)
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// configFormat 根据文件扩展名判断配置格式
+func configFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	default:
+		return "yaml"
+	}
+}
+
+// LoadConfigFromEnv 从环境变量加载配置
+// 读取OPENAI_API_KEY、ANTHROPIC_API_KEY、DEEPSEEK_API_KEY、GOOGLE_API_KEY、DASHSCOPE_API_KEY
+// 以及对应的*_BASE_URL和*_MODEL，需要与YAML文件合并时使用LoadConfig后调用ApplyEnv
+func LoadConfigFromEnv() (*LLMConfig, error) {
+	config := &LLMConfig{}
+	config.ApplyEnv()
+	if len(config.ToProviderConfigs()) == 0 {
+		return nil, fmt.Errorf("no API key found in environment")
 	}
+	return config, nil
+}
 
-	return &config, nil
+// ApplyEnv 使用环境变量覆盖配置，未设置的环境变量保留原配置
+func (c *LLMConfig) ApplyEnv() {
+	applyEnv(&c.AgentAPIKey.OpenAI, "OPENAI")
+	applyEnv(&c.AgentAPIKey.Anthropic, "ANTHROPIC")
+	applyEnv(&c.AgentAPIKey.DeepSeek, "DEEPSEEK")
+	applyEnv(&c.AgentAPIKey.GoogleKey, "GOOGLE")
+	applyEnv(&c.AgentAPIKey.Qwen, "DASHSCOPE")
+}
+
+// applyEnv 读取prefix_API_KEY、prefix_BASE_URL、prefix_MODEL覆盖单个API配置
+func applyEnv(config *APIConfig, prefix string) {
+	if value := os.Getenv(prefix + "_API_KEY"); value != "" {
+		config.APIKey = value
+	}
+	if value := os.Getenv(prefix + "_BASE_URL"); value != "" {
+		config.BaseUrl = value
+	}
+	if value := os.Getenv(prefix + "_MODEL"); value != "" {
+		config.Model = value
+	}
 }
 
 // getDefaultModel 获取默认模型名称
@@ -76,10 +249,15 @@ func (c *LLMConfig) ToProviderConfigs() []*ProviderConfig {
 			model = getDefaultModel(ProviderOpenAI)
 		}
 		configs = append(configs, &ProviderConfig{
-			Provider: ProviderOpenAI,
-			APIKey:   c.AgentAPIKey.OpenAI.APIKey,
-			BaseURL:  c.AgentAPIKey.OpenAI.BaseUrl,
-			Model:    model,
+			Provider:     ProviderOpenAI,
+			APIKey:       c.AgentAPIKey.OpenAI.APIKey,
+			BaseURL:      c.AgentAPIKey.OpenAI.BaseUrl,
+			Model:        model,
+			Headers:      c.AgentAPIKey.OpenAI.Headers,
+			Defaults:     c.AgentAPIKey.OpenAI.Defaults,
+			EmulateTools: c.AgentAPIKey.OpenAI.EmulateTools,
+			Limits:       c.AgentAPIKey.OpenAI.Limits,
+			HTTPRetry:    c.AgentAPIKey.OpenAI.HTTPRetry,
 		})
 	}
 
@@ -90,10 +268,15 @@ func (c *LLMConfig) ToProviderConfigs() []*ProviderConfig {
 			model = getDefaultModel(ProviderAnthropic)
 		}
 		configs = append(configs, &ProviderConfig{
-			Provider: ProviderAnthropic,
-			APIKey:   c.AgentAPIKey.Anthropic.APIKey,
-			BaseURL:  c.AgentAPIKey.Anthropic.BaseUrl,
-			Model:    model,
+			Provider:     ProviderAnthropic,
+			APIKey:       c.AgentAPIKey.Anthropic.APIKey,
+			BaseURL:      c.AgentAPIKey.Anthropic.BaseUrl,
+			Model:        model,
+			Headers:      c.AgentAPIKey.Anthropic.Headers,
+			Defaults:     c.AgentAPIKey.Anthropic.Defaults,
+			EmulateTools: c.AgentAPIKey.Anthropic.EmulateTools,
+			Limits:       c.AgentAPIKey.Anthropic.Limits,
+			HTTPRetry:    c.AgentAPIKey.Anthropic.HTTPRetry,
 		})
 	}
 
@@ -104,10 +287,16 @@ func (c *LLMConfig) ToProviderConfigs() []*ProviderConfig {
 			model = getDefaultModel(ProviderDeepSeek)
 		}
 		configs = append(configs, &ProviderConfig{
-			Provider: ProviderDeepSeek,
-			APIKey:   c.AgentAPIKey.DeepSeek.APIKey,
-			BaseURL:  c.AgentAPIKey.DeepSeek.BaseUrl,
-			Model:    model,
+			Provider:          ProviderDeepSeek,
+			APIKey:            c.AgentAPIKey.DeepSeek.APIKey,
+			BaseURL:           c.AgentAPIKey.DeepSeek.BaseUrl,
+			Model:             model,
+			Headers:           c.AgentAPIKey.DeepSeek.Headers,
+			Defaults:          c.AgentAPIKey.DeepSeek.Defaults,
+			EmulateTools:      c.AgentAPIKey.DeepSeek.EmulateTools,
+			Limits:            c.AgentAPIKey.DeepSeek.Limits,
+			HTTPRetry:         c.AgentAPIKey.DeepSeek.HTTPRetry,
+			MergeSystemPrompt: c.AgentAPIKey.DeepSeek.MergeSystemPrompt,
 		})
 	}
 
@@ -118,10 +307,15 @@ func (c *LLMConfig) ToProviderConfigs() []*ProviderConfig {
 			model = getDefaultModel(ProviderGoogle)
 		}
 		configs = append(configs, &ProviderConfig{
-			Provider: ProviderGoogle,
-			APIKey:   c.AgentAPIKey.GoogleKey.APIKey,
-			BaseURL:  c.AgentAPIKey.GoogleKey.BaseUrl,
-			Model:    model,
+			Provider:     ProviderGoogle,
+			APIKey:       c.AgentAPIKey.GoogleKey.APIKey,
+			BaseURL:      c.AgentAPIKey.GoogleKey.BaseUrl,
+			Model:        model,
+			Headers:      c.AgentAPIKey.GoogleKey.Headers,
+			Defaults:     c.AgentAPIKey.GoogleKey.Defaults,
+			EmulateTools: c.AgentAPIKey.GoogleKey.EmulateTools,
+			Limits:       c.AgentAPIKey.GoogleKey.Limits,
+			HTTPRetry:    c.AgentAPIKey.GoogleKey.HTTPRetry,
 		})
 	}
 
@@ -132,10 +326,37 @@ func (c *LLMConfig) ToProviderConfigs() []*ProviderConfig {
 			model = getDefaultModel(ProviderQwen)
 		}
 		configs = append(configs, &ProviderConfig{
-			Provider: ProviderQwen,
-			APIKey:   c.AgentAPIKey.Qwen.APIKey,
-			BaseURL:  c.AgentAPIKey.Qwen.BaseUrl,
-			Model:    model,
+			Provider:     ProviderQwen,
+			APIKey:       c.AgentAPIKey.Qwen.APIKey,
+			BaseURL:      c.AgentAPIKey.Qwen.BaseUrl,
+			Model:        model,
+			Headers:      c.AgentAPIKey.Qwen.Headers,
+			Defaults:     c.AgentAPIKey.Qwen.Defaults,
+			EmulateTools: c.AgentAPIKey.Qwen.EmulateTools,
+			Limits:       c.AgentAPIKey.Qwen.Limits,
+			HTTPRetry:    c.AgentAPIKey.Qwen.HTTPRetry,
+		})
+	}
+
+	// 通用提供商列表
+	// 列表中的提供商总是启用，本地部署的服务（如Ollama）可以不设置密钥
+	for _, entry := range c.Providers {
+		model := entry.Model
+		if model == "" {
+			model = getDefaultModel(entry.Type)
+		}
+		configs = append(configs, &ProviderConfig{
+			Provider:          entry.ProviderName(),
+			Type:              entry.Type,
+			APIKey:            entry.APIKey,
+			BaseURL:           entry.BaseUrl,
+			Model:             model,
+			MergeSystemPrompt: entry.MergeSystemPrompt,
+			Headers:           entry.Headers,
+			Defaults:          entry.Defaults,
+			EmulateTools:      entry.EmulateTools,
+			Limits:            entry.Limits,
+			HTTPRetry:         entry.HTTPRetry,
 		})
 	}
 
@@ -0,0 +1,165 @@
+package general
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// applyProfile 将Profiles中选中的配置深度合并到顶层配置之上，并移除Profiles
+func applyProfile(table map[string]interface{}, profile string) (map[string]interface{}, error) {
+	profiles, _ := table["Profiles"].(map[string]interface{})
+	delete(table, "Profiles")
+	if profile == "" {
+		return table, nil
+	}
+
+	selected, ok := profiles[profile].(map[string]interface{})
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("profile %q not found (available: %s)", profile, strings.Join(names, ", "))
+	}
+	delete(selected, "Profiles")
+	mergeConfigTable(table, selected)
+	return table, nil
+}
+
+// mergeConfigTable 递归合并配置，两边都是表时合并子项，否则以src为准（列表整体替换）
+func mergeConfigTable(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcTable, srcIsTable := value.(map[string]interface{})
+		dstTable, dstIsTable := dst[key].(map[string]interface{})
+		if srcIsTable && dstIsTable {
+			mergeConfigTable(dstTable, srcTable)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// Merge 用other中非零值的字段覆盖当前配置，用于在代码中覆盖文件和环境变量的配置
+// Providers按名称合并，Headers按键合并
+func (c *LLMConfig) Merge(other *LLMConfig) {
+	if other == nil {
+		return
+	}
+	mergeAPIConfig(&c.AgentAPIKey.OpenAI, other.AgentAPIKey.OpenAI)
+	mergeAPIConfig(&c.AgentAPIKey.Anthropic, other.AgentAPIKey.Anthropic)
+	mergeAPIConfig(&c.AgentAPIKey.DeepSeek, other.AgentAPIKey.DeepSeek)
+	mergeAPIConfig(&c.AgentAPIKey.GoogleKey, other.AgentAPIKey.GoogleKey)
+	mergeAPIConfig(&c.AgentAPIKey.Qwen, other.AgentAPIKey.Qwen)
+
+	for _, entry := range other.Providers {
+		merged := false
+		for i := range c.Providers {
+			if c.Providers[i].ProviderName() == entry.ProviderName() {
+				mergeAPIConfig(&c.Providers[i].APIConfig, entry.APIConfig)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			c.Providers = append(c.Providers, entry)
+		}
+	}
+}
+
+// mergeAPIConfig 用src中非零值的字段覆盖dst
+func mergeAPIConfig(dst *APIConfig, src APIConfig) {
+	if src.BaseUrl != "" {
+		dst.BaseUrl = src.BaseUrl
+	}
+	if src.APIKey != "" {
+		dst.APIKey = src.APIKey
+	}
+	if src.Model != "" {
+		dst.Model = src.Model
+	}
+	if src.MergeSystemPrompt {
+		dst.MergeSystemPrompt = true
+	}
+	if src.EmulateTools {
+		dst.EmulateTools = true
+	}
+	for key, value := range src.Headers {
+		if dst.Headers == nil {
+			dst.Headers = make(map[string]string)
+		}
+		dst.Headers[key] = value
+	}
+	mergeGenerationDefaults(&dst.Defaults, src.Defaults)
+	mergeSizeLimits(&dst.Limits, src.Limits)
+	if src.HTTPRetry != nil {
+		dst.HTTPRetry = src.HTTPRetry
+	}
+}
+
+// mergeSizeLimits 用src中非零值的限制覆盖dst
+func mergeSizeLimits(dst *SizeLimits, src SizeLimits) {
+	if src.MaxRequestBytes != 0 {
+		dst.MaxRequestBytes = src.MaxRequestBytes
+	}
+	if src.MaxResponseBytes != 0 {
+		dst.MaxResponseBytes = src.MaxResponseBytes
+	}
+	if src.MaxImages != 0 {
+		dst.MaxImages = src.MaxImages
+	}
+	if src.MaxToolSchemaBytes != 0 {
+		dst.MaxToolSchemaBytes = src.MaxToolSchemaBytes
+	}
+}
+
+// mergeGenerationDefaults 用src中非零值的默认参数覆盖dst
+func mergeGenerationDefaults(dst *GenerationDefaults, src GenerationDefaults) {
+	if src.Temperature != 0 {
+		dst.Temperature = src.Temperature
+	}
+	if src.MaxTokens != 0 {
+		dst.MaxTokens = src.MaxTokens
+	}
+	if src.TopP != nil {
+		dst.TopP = src.TopP
+	}
+	if src.SystemPrompt != "" {
+		dst.SystemPrompt = src.SystemPrompt
+	}
+	if src.Timeout != 0 {
+		dst.Timeout = src.Timeout
+	}
+	if src.Retry != nil {
+		dst.Retry = src.Retry
+	}
+	if src.StreamConsumerTimeout != 0 {
+		dst.StreamConsumerTimeout = src.StreamConsumerTimeout
+	}
+}
+
+// LoadLayeredConfig 按 文件（含profile）< 环境变量 < 代码 的顺序加载配置
+// filename为空时跳过文件，overrides为nil时跳过代码覆盖，合并完成后统一校验
+func LoadLayeredConfig(filename string, profile string, overrides *LLMConfig) (*LLMConfig, error) {
+	config := &LLMConfig{}
+	var problems []string
+	if filename != "" {
+		loaded, fileProblems, err := readConfigFile(filename, profile)
+		if err != nil {
+			return nil, err
+		}
+		config, problems = loaded, fileProblems
+	} else if profile != "" {
+		return nil, fmt.Errorf("profile %q requires a config file", profile)
+	}
+
+	// 必填字段可能由环境变量或代码提供，合并完成后再校验
+	config.ApplyEnv()
+	config.Merge(overrides)
+
+	if err := validateConfig(config, problems); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
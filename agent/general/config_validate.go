@@ -0,0 +1,261 @@
+package general
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigError 配置校验错误，包含所有发现的问题
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// knownProviders 配置中可以使用的提供商类型
+var knownProviders = []Provider{ProviderOpenAI, ProviderAnthropic, ProviderDeepSeek, ProviderGoogle, ProviderQwen}
+
+// Validate 校验配置，检查缺失的必填字段和无效的提供商类型
+func (c *LLMConfig) Validate() error {
+	var problems []string
+
+	fixed := []struct {
+		name   string
+		config APIConfig
+	}{
+		{"AgentAPIKey.OpenAI", c.AgentAPIKey.OpenAI},
+		{"AgentAPIKey.Anthropic", c.AgentAPIKey.Anthropic},
+		{"AgentAPIKey.DeepSeek", c.AgentAPIKey.DeepSeek},
+		{"AgentAPIKey.GoogleKey", c.AgentAPIKey.GoogleKey},
+		{"AgentAPIKey.Qwen", c.AgentAPIKey.Qwen},
+	}
+	for _, item := range fixed {
+		// 只填写了地址或模型时多半是漏填了密钥
+		if item.config.APIKey == "" && (item.config.BaseUrl != "" || item.config.Model != "") {
+			problems = append(problems, fmt.Sprintf("%s.APIKey is required when BaseUrl or Model is set", item.name))
+		}
+	}
+
+	seen := make(map[Provider]int)
+	for i, entry := range c.Providers {
+		path := fmt.Sprintf("Providers[%d]", i)
+		switch {
+		case entry.Type == "":
+			problems = append(problems, fmt.Sprintf("%s.Type is required (one of %s)", path, providerNames()))
+		case !isKnownProvider(entry.Type):
+			problems = append(problems, fmt.Sprintf("%s.Type %q is not supported (one of %s)", path, entry.Type, providerNames()))
+		}
+		if name := entry.ProviderName(); name != "" {
+			if first, ok := seen[name]; ok {
+				problems = append(problems, fmt.Sprintf("%s: provider %q is already declared in Providers[%d], set a different Name", path, name, first))
+			}
+			seen[name] = i
+		}
+		// 自定义地址的服务（如Ollama）可以不需要密钥
+		if entry.APIKey == "" && entry.BaseUrl == "" {
+			problems = append(problems, fmt.Sprintf("%s.APIKey is required unless BaseUrl points to a service without authentication", path))
+		}
+		if entry.Name != "" && entry.Name != entry.Type && entry.Model == "" {
+			problems = append(problems, fmt.Sprintf("%s.Model is required for custom provider %q", path, entry.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// isKnownProvider 判断是否为支持的提供商类型
+func isKnownProvider(provider Provider) bool {
+	for _, known := range knownProviders {
+		if provider == known {
+			return true
+		}
+	}
+	return false
+}
+
+// providerNames 返回支持的提供商类型列表，用于错误提示
+func providerNames() string {
+	names := make([]string, len(knownProviders))
+	for i, provider := range knownProviders {
+		names[i] = string(provider)
+	}
+	return strings.Join(names, ", ")
+}
+
+// normalizeConfigValue 将YAML解析出的map[interface{}]interface{}统一为map[string]interface{}
+func normalizeConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = normalizeConfigValue(item)
+		}
+		return result
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeConfigValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeConfigValue(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// checkConfigKeys 根据结构体的yaml标签检查未知的键，返回带路径的问题描述
+func checkConfigKeys(value interface{}, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			if value == nil {
+				return nil
+			}
+			return []string{fmt.Sprintf("%s must be a table, got %T", displayPath(path), value)}
+		}
+		fields := configFields(t)
+		var problems []string
+		for _, key := range sortedKeys(table) {
+			field, ok := fields[key]
+			if !ok {
+				problem := fmt.Sprintf("unknown key %s", joinPath(path, key))
+				if suggestion := suggestKey(key, fields); suggestion != "" {
+					problem += fmt.Sprintf(" (did you mean %s?)", suggestion)
+				}
+				problems = append(problems, problem)
+				continue
+			}
+			problems = append(problems, checkConfigKeys(table[key], field, joinPath(path, key))...)
+		}
+		return problems
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			if value == nil {
+				return nil
+			}
+			return []string{fmt.Sprintf("%s must be a list, got %T", displayPath(path), value)}
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems, checkConfigKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case reflect.Map:
+		// 只检查值为结构体的map（如Profiles），Headers等自由键值对不检查
+		table, ok := value.(map[string]interface{})
+		if !ok || t.Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		var problems []string
+		for _, key := range sortedKeys(table) {
+			problems = append(problems, checkConfigKeys(table[key], t.Elem(), joinPath(path, key))...)
+		}
+		return problems
+	default:
+		return nil
+	}
+}
+
+// sortedKeys 返回排序后的键，使问题按固定顺序报告
+func sortedKeys(table map[string]interface{}) []string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configFields 返回结构体yaml键名到字段类型的映射，展开inline字段
+func configFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(options, "inline") {
+			for key, fieldType := range configFields(field.Type) {
+				fields[key] = fieldType
+			}
+			continue
+		}
+		if name == "" {
+			// yaml.v2默认使用小写的字段名
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// suggestKey 为拼写错误的键找到最相近的有效键
+func suggestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for candidate := range fields {
+		if strings.EqualFold(candidate, key) {
+			return candidate
+		}
+		if distance := editDistance(strings.ToLower(key), strings.ToLower(candidate)); distance < bestDistance ||
+			distance == bestDistance && best != "" && candidate < best {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance 计算两个字符串的编辑距离
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "config"
+	}
+	return path
+}
@@ -0,0 +1,165 @@
+package general
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialsProvider API密钥提供者，每次请求时调用，用于在不重建客户端的情况下轮换密钥
+type CredentialsProvider interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// StaticCredentials 固定的API密钥
+type StaticCredentials string
+
+// APIKey 返回固定的API密钥
+func (s StaticCredentials) APIKey(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// EnvCredentials 从环境变量读取API密钥，值为环境变量名，每次请求时重新读取
+type EnvCredentials string
+
+// APIKey 读取环境变量中的API密钥
+func (e EnvCredentials) APIKey(ctx context.Context) (string, error) {
+	key := strings.TrimSpace(os.Getenv(string(e)))
+	if key == "" {
+		return "", fmt.Errorf("environment variable %s is empty", string(e))
+	}
+	return key, nil
+}
+
+// FileCredentials 从文件读取API密钥，值为文件路径，每次请求时重新读取，适合挂载的密钥文件
+type FileCredentials string
+
+// APIKey 读取文件中的API密钥
+func (f FileCredentials) APIKey(ctx context.Context) (string, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("failed to read api key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("api key file %s is empty", string(f))
+	}
+	return key, nil
+}
+
+// CredentialsFunc 回调函数形式的API密钥提供者
+type CredentialsFunc func(ctx context.Context) (string, error)
+
+// APIKey 调用回调函数获取API密钥
+func (fn CredentialsFunc) APIKey(ctx context.Context) (string, error) {
+	return fn(ctx)
+}
+
+// VaultCredentials 从HashiCorp Vault的KV引擎读取API密钥，支持KV v1和v2，读取结果在TTL内缓存
+type VaultCredentials struct {
+	Address    string        // Vault地址，为空时使用环境变量VAULT_ADDR
+	Token      string        // Vault令牌，为空时使用环境变量VAULT_TOKEN
+	Path       string        // 密钥路径，如secret/data/llm（KV v2）或secret/llm（KV v1）
+	Field      string        // 密钥字段名
+	TTL        time.Duration // 缓存时间，0表示每次请求都读取
+	HTTPClient *http.Client  // 为nil时使用http.DefaultClient
+
+	mu      sync.Mutex
+	cached  string
+	expires time.Time
+}
+
+// NewVaultCredentials 创建Vault密钥提供者，默认缓存5分钟
+func NewVaultCredentials(address, token, path, field string) *VaultCredentials {
+	return &VaultCredentials{
+		Address: address,
+		Token:   token,
+		Path:    path,
+		Field:   field,
+		TTL:     5 * time.Minute,
+	}
+}
+
+// APIKey 从Vault读取API密钥
+func (v *VaultCredentials) APIKey(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.cached != "" && time.Now().Before(v.expires) {
+		return v.cached, nil
+	}
+
+	key, err := v.read(ctx)
+	if err != nil {
+		return "", err
+	}
+	v.cached = key
+	v.expires = time.Now().Add(v.TTL)
+	return key, nil
+}
+
+// read 请求Vault读取密钥
+func (v *VaultCredentials) read(ctx context.Context) (string, error) {
+	address := v.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if address == "" {
+		return "", fmt.Errorf("vault address is not configured")
+	}
+
+	url := strings.TrimRight(address, "/") + "/v1/" + strings.TrimLeft(v.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault request failed with status %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	// KV v2的数据嵌套在data.data中
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	key, _ := data[v.Field].(string)
+	if key == "" {
+		return "", fmt.Errorf("field %s not found in vault secret %s", v.Field, v.Path)
+	}
+	return key, nil
+}
+
+// credentialsFunc 将CredentialsProvider转换为提供商客户端使用的回调函数
+func credentialsFunc(provider CredentialsProvider) func(ctx context.Context) (string, error) {
+	if provider == nil {
+		return nil
+	}
+	return provider.APIKey
+}
@@ -0,0 +1,119 @@
+package general
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+)
+
+// DefaultMaxTokens 请求和提供商默认参数都未设置max_tokens时使用的值
+const DefaultMaxTokens = 3000
+
+// DefaultStreamConsumerTimeout 未设置StreamConsumerTimeout时，流式请求等待调用方读取的最长时间
+const DefaultStreamConsumerTimeout = time.Minute
+
+// GenerationDefaults 提供商的默认生成参数，请求中未设置的参数使用默认值
+type GenerationDefaults struct {
+	Temperature  float64       `yaml:"Temperature,omitempty" json:"temperature,omitempty"`
+	MaxTokens    int           `yaml:"MaxTokens,omitempty" json:"max_tokens,omitempty"`
+	TopP         *float64      `yaml:"TopP,omitempty" json:"top_p,omitempty"`
+	SystemPrompt string        `yaml:"SystemPrompt,omitempty" json:"system_prompt,omitempty"`
+	Timeout      time.Duration `yaml:"Timeout,omitempty" json:"timeout,omitempty"` // 单次请求超时，如30s，0表示不限制
+	Retry        *RetryPolicy  `yaml:"Retry,omitempty" json:"retry,omitempty"`     // 请求遇到临时性错误时的重试策略，为nil时不重试；提供商设置了HTTPRetry时不使用
+	// StreamConsumerTimeout 流式请求中调用方停止读取超过该时间时视为已放弃，取消上游请求并关闭通道
+	// 0使用DefaultStreamConsumerTimeout，小于0时不限制
+	StreamConsumerTimeout time.Duration `yaml:"StreamConsumerTimeout,omitempty" json:"stream_consumer_timeout,omitempty"`
+}
+
+// RetryPolicy 请求失败时的重试策略，只重试限流（429）、服务端错误（5xx）和超时、连接断开等临时性的网络错误，参数错误和鉴权失败等直接返回
+// 响应头中有Retry-After时按其等待，超过MaxBackoff时不再重试。提供商设置了HTTPRetry时只使用HTTPRetry，避免两层重试的次数相乘
+type RetryPolicy struct {
+	MaxAttempts int           `yaml:"MaxAttempts" json:"max_attempts"`                   // 最大尝试次数（含首次请求），小于等于1时不重试
+	Backoff     time.Duration `yaml:"Backoff,omitempty" json:"backoff,omitempty"`        // 首次重试前的等待时间，之后每次翻倍，默认1s
+	MaxBackoff  time.Duration `yaml:"MaxBackoff,omitempty" json:"max_backoff,omitempty"` // 等待时间上限，0表示不限制
+}
+
+// HTTPRetryPolicy 提供商客户端内部的HTTP重试策略，只重试限流（429）、服务端错误（5xx）和临时性的网络错误，遵守Retry-After
+// 与RetryPolicy不同，重试发生在单次HTTP请求内部，不重新转换请求，流式请求在开始接收数据前同样重试
+// 设置了HTTPRetry的提供商忽略GenerationDefaults.Retry
+type HTTPRetryPolicy = retry.Policy
+
+// SetDefaults 设置提供商的默认生成参数
+func (m *AgentManager) SetDefaults(provider Provider, defaults GenerationDefaults) {
+	m.defaults[provider] = defaults
+}
+
+// GetDefaults 获取提供商的默认生成参数
+func (m *AgentManager) GetDefaults(provider Provider) GenerationDefaults {
+	return m.defaults[provider]
+}
+
+// applyDefaults 返回为未设置的参数填充了默认值的请求副本，不修改req
+// Temperature只有在请求未设置（HasTemperature为false）时才使用默认值，显式设置的0保持不变
+func (d GenerationDefaults) applyDefaults(req *ChatRequest) *ChatRequest {
+	result := *req
+	if result.MaxTokens == 0 {
+		result.MaxTokens = d.MaxTokens
+	}
+	if result.MaxTokens == 0 {
+		result.MaxTokens = DefaultMaxTokens
+	}
+	if !result.HasTemperature() {
+		result.Temperature = d.Temperature
+	}
+	if result.TopP == nil && d.TopP != nil {
+		topP := *d.TopP
+		result.TopP = &topP
+	}
+	if result.SystemPrompt == "" {
+		result.SystemPrompt = d.SystemPrompt
+	}
+	return &result
+}
+
+// withRetry 按重试策略执行请求，只重试临时性错误，上下文取消时立即返回
+func (p *RetryPolicy) withRetry(ctx context.Context, call func() (*ChatResponse, error)) (*ChatResponse, error) {
+	attempts := 1
+	backoff := time.Second
+	if p != nil {
+		attempts = max(p.MaxAttempts, 1)
+		if p.Backoff > 0 {
+			backoff = p.Backoff
+		}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		resp, err := call()
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if attempt == attempts || ctx.Err() != nil || !retry.Transient(err) {
+			break
+		}
+		wait := backoff
+		var statusErr *retry.StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if p.MaxBackoff > 0 && statusErr.RetryAfter > p.MaxBackoff {
+				break
+			}
+			wait = statusErr.RetryAfter
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, lastErr
+		case <-timer.C:
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,209 @@
+package general
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// emulatedToolCallPattern 匹配回复中的<tool_call>块，模型在结束标签前停止输出时匹配到文本末尾
+var emulatedToolCallPattern = regexp.MustCompile(`(?s)<tool_call>\s*(.*?)\s*(?:</tool_call>|$)`)
+
+// emulatedToolCall 模型以文本输出的工具调用
+type emulatedToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// emulateToolsRequest 生成模拟函数调用的请求：工具定义写入系统提示词，
+// 历史中的工具调用和工具结果转换为文本，不修改原请求的消息
+func emulateToolsRequest(req *ChatRequest) *ChatRequest {
+	emulated := *req
+	emulated.Tools = nil
+	if len(req.Tools) > 0 {
+		if emulated.SystemPrompt != "" {
+			emulated.SystemPrompt += "\n\n"
+		}
+		emulated.SystemPrompt += emulatedToolsPrompt(req.Tools)
+	}
+
+	toolNames := make(map[string]string)
+	messages := make([]Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == RoleAssistant && len(msg.ToolCalls) > 0:
+			var b strings.Builder
+			if text := strings.TrimSpace(messageText(msg)); text != "" {
+				b.WriteString(text)
+				b.WriteString("\n")
+			}
+			for _, toolCall := range msg.ToolCalls {
+				toolNames[toolCall.ID] = toolCall.Function.Name
+				b.WriteString(formatEmulatedToolCall(toolCall))
+			}
+			content := make([]Content, 0, len(msg.Content)+1)
+			for _, item := range msg.Content {
+				if item.Type != ContentTypeText && item.Type != ContentTypeTool {
+					content = append(content, item)
+				}
+			}
+			msg.Content = append(content, Content{Type: ContentTypeText, Text: strings.TrimSpace(b.String())})
+			msg.ToolCalls = nil
+			messages = append(messages, msg)
+
+		case msg.Role == RoleTool:
+			// 连续的工具结果合并为一条用户消息
+			var text string
+			for _, item := range msg.Content {
+				name := toolNames[item.ToolID]
+				if name == "" {
+					name = msg.Name
+				}
+				text += fmt.Sprintf("<tool_result name=%q>\n%s\n</tool_result>\n", name, item.Text)
+			}
+			text = strings.TrimSpace(text)
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == RoleUser && isEmulatedToolResult(messages[last]) {
+				messages[last].Content[0].Text += "\n" + text
+				continue
+			}
+			messages = append(messages, Message{
+				Role:    RoleUser,
+				Content: []Content{{Type: ContentTypeText, Text: text}},
+			})
+
+		default:
+			messages = append(messages, msg)
+		}
+	}
+	emulated.Messages = messages
+	return &emulated
+}
+
+// emulatedToolsPrompt 生成描述工具和调用格式的系统提示词
+func emulatedToolsPrompt(tools []Tool) string {
+	var b strings.Builder
+	b.WriteString("你可以调用以下工具：\n<tools>\n")
+	for _, tool := range tools {
+		definition, err := json.Marshal(tool.Function)
+		if err != nil {
+			continue
+		}
+		b.Write(definition)
+		b.WriteString("\n")
+	}
+	b.WriteString("</tools>\n\n")
+	b.WriteString("需要调用工具时，按以下格式输出，每个调用一个块，可以连续输出多个块，输出后停止并等待工具结果：\n")
+	b.WriteString("<tool_call>\n{\"name\": \"工具名称\", \"arguments\": {\"参数名\": \"参数值\"}}\n</tool_call>\n")
+	b.WriteString("工具结果会以<tool_result>块的形式提供给你。不需要调用工具时直接回答，不要输出<tool_call>块。")
+	return b.String()
+}
+
+// formatEmulatedToolCall 将工具调用格式化为<tool_call>块
+func formatEmulatedToolCall(toolCall ToolCall) string {
+	arguments := toolCall.Function.Arguments
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	call, err := json.Marshal(emulatedToolCall{Name: toolCall.Function.Name, Arguments: arguments})
+	if err != nil {
+		call, _ = json.Marshal(emulatedToolCall{Name: toolCall.Function.Name, Arguments: json.RawMessage("{}")})
+	}
+	return "<tool_call>\n" + string(call) + "\n</tool_call>\n"
+}
+
+// isEmulatedToolResult 判断消息是否是由工具结果转换而来的用户消息
+func isEmulatedToolResult(msg Message) bool {
+	return len(msg.Content) == 1 && strings.HasPrefix(msg.Content[0].Text, "<tool_result ")
+}
+
+// parseEmulatedToolCalls 从回复文本中解析<tool_call>块，解析出的调用写入Message.ToolCalls并从文本中移除
+// 没有<tool_call>块时，整个回复是调用已知工具的JSON对象也视为工具调用
+func parseEmulatedToolCalls(resp *ChatResponse, tools []Tool) {
+	known := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		known[tool.Function.Name] = true
+	}
+
+	for i := range resp.Choices {
+		msg := &resp.Choices[i].Message
+		text := messageText(*msg)
+
+		var toolCalls []ToolCall
+		remaining := emulatedToolCallPattern.ReplaceAllStringFunc(text, func(block string) string {
+			match := emulatedToolCallPattern.FindStringSubmatch(block)
+			if toolCall, ok := decodeEmulatedToolCall(match[1]); ok {
+				toolCalls = append(toolCalls, toolCall)
+				return ""
+			}
+			return block
+		})
+		if len(toolCalls) == 0 {
+			if toolCall, ok := decodeEmulatedToolCall(text); ok && known[toolCall.Function.Name] {
+				toolCalls = append(toolCalls, toolCall)
+				remaining = ""
+			}
+		}
+		if len(toolCalls) == 0 {
+			continue
+		}
+
+		content := make([]Content, 0, len(msg.Content))
+		for _, item := range msg.Content {
+			if item.Type != ContentTypeText {
+				content = append(content, item)
+			}
+		}
+		if remaining = strings.TrimSpace(remaining); remaining != "" {
+			content = append(content, Content{Type: ContentTypeText, Text: remaining})
+		}
+		msg.Content = content
+		msg.ToolCalls = append(msg.ToolCalls, toolCalls...)
+		resp.Choices[i].FinishReason = string(FinishReasonToolCalls)
+		resp.Choices[i].NormalizedFinishReason = FinishReasonToolCalls
+	}
+}
+
+// decodeEmulatedToolCall 解析一个工具调用JSON对象，参数为字符串化的JSON时还原为对象
+func decodeEmulatedToolCall(text string) (ToolCall, bool) {
+	var call emulatedToolCall
+	if err := json.Unmarshal([]byte(unwrapJSONFence(text)), &call); err != nil || call.Name == "" {
+		return ToolCall{}, false
+	}
+
+	arguments := call.Arguments
+	var encoded string
+	if json.Unmarshal(arguments, &encoded) == nil && json.Valid([]byte(encoded)) {
+		arguments = json.RawMessage(encoded)
+	}
+	if trimmed := strings.TrimSpace(string(arguments)); trimmed == "" || trimmed == "null" {
+		arguments = json.RawMessage("{}")
+	}
+	return ToolCall{
+		ID:       newEmulatedToolCallID(),
+		Type:     "function",
+		Function: FunctionCall{Name: call.Name, Arguments: arguments},
+	}, true
+}
+
+// newEmulatedToolCallID 生成模拟工具调用的ID，长度符合所有提供商的限制
+func newEmulatedToolCallID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "call_emulated"
+	}
+	return "call_" + hex.EncodeToString(buf)
+}
+
+// messageText 拼接消息中的文本内容
+func messageText(msg Message) string {
+	var parts []string
+	for _, content := range msg.Content {
+		if content.Type == ContentTypeText {
+			parts = append(parts, content.Text)
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,42 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/anthropic"
+	"github.com/ccIisIaIcat/GoAgent/agent/openai"
+)
+
+// ExportOpenAIMessages 将消息转换为OpenAI Chat Completions的messages数组，systemPrompt不为空时作为第一条system消息
+// 转换与发送请求时相同，结果可以直接放入请求体，用于curl调试或提供给提供商的技术支持
+func ExportOpenAIMessages(systemPrompt string, messages []Message) ([]byte, error) {
+	req := applySpeakerNames(ProviderOpenAI, &ChatRequest{SystemPrompt: systemPrompt, Messages: messages})
+	openaiReq, err := openai.ToOpenAIRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("convert messages failed: %w", err)
+	}
+	exported := openaiReq.Messages
+	if exported == nil {
+		exported = []openai.OpenAIMessage{}
+	}
+	return json.MarshalIndent(exported, "", "  ")
+}
+
+// ExportAnthropicMessages 将消息转换为Anthropic Messages API请求体中的system和messages字段
+// 转换与发送请求时相同，加上model和max_tokens即为完整的请求体
+func ExportAnthropicMessages(systemPrompt string, messages []Message) ([]byte, error) {
+	req := applySpeakerNames(ProviderAnthropic, &ChatRequest{SystemPrompt: systemPrompt, Messages: messages})
+	anthropicReq, err := anthropic.ToAnthropicRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("convert messages failed: %w", err)
+	}
+	payload := struct {
+		System   string                       `json:"system,omitempty"`
+		Messages []anthropic.AnthropicMessage `json:"messages"`
+	}{System: anthropicReq.System, Messages: anthropicReq.Messages}
+	if payload.Messages == nil {
+		payload.Messages = []anthropic.AnthropicMessage{}
+	}
+	return json.MarshalIndent(payload, "", "  ")
+}
@@ -0,0 +1,77 @@
+package general
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	finishReasonMu sync.RWMutex
+	// finishReasons 原始结束原因（小写）到归一化结束原因的映射
+	finishReasons = map[string]FinishReason{
+		"stop":               FinishReasonStop, // OpenAI、DeepSeek、Qwen、Google(STOP)
+		"end_turn":           FinishReasonStop, // Anthropic
+		"stop_sequence":      FinishReasonStop, // Anthropic
+		"length":             FinishReasonLength,
+		"max_tokens":         FinishReasonLength, // Anthropic、Google(MAX_TOKENS)
+		"tool_calls":         FinishReasonToolCalls,
+		"function_call":      FinishReasonToolCalls,
+		"tool_use":           FinishReasonToolCalls, // Anthropic
+		"content_filter":     FinishReasonContentFilter,
+		"refusal":            FinishReasonContentFilter, // Anthropic
+		"safety":             FinishReasonContentFilter, // Google
+		"recitation":         FinishReasonContentFilter, // Google
+		"blocklist":          FinishReasonContentFilter, // Google
+		"prohibited_content": FinishReasonContentFilter, // Google
+		"spii":               FinishReasonContentFilter, // Google
+		"image_safety":       FinishReasonContentFilter, // Google
+	}
+	// providerFinishReasons 提供商特有的映射，优先于通用映射
+	providerFinishReasons = map[Provider]map[string]FinishReason{}
+)
+
+// RegisterFinishReason 注册原始结束原因的归一化映射，provider为空时对所有提供商生效
+func RegisterFinishReason(provider Provider, raw string, reason FinishReason) {
+	finishReasonMu.Lock()
+	defer finishReasonMu.Unlock()
+
+	raw = strings.ToLower(raw)
+	if provider == "" {
+		finishReasons[raw] = reason
+		return
+	}
+	if providerFinishReasons[provider] == nil {
+		providerFinishReasons[provider] = make(map[string]FinishReason)
+	}
+	providerFinishReasons[provider][raw] = reason
+}
+
+// NormalizeFinishReason 将提供商的原始结束原因归一化，原始值为空时返回空（如流式响应的中间分片）
+func NormalizeFinishReason(provider Provider, raw string) FinishReason {
+	if raw == "" {
+		return ""
+	}
+	finishReasonMu.RLock()
+	defer finishReasonMu.RUnlock()
+
+	raw = strings.ToLower(raw)
+	if reason, ok := providerFinishReasons[provider][raw]; ok {
+		return reason
+	}
+	if reason, ok := finishReasons[raw]; ok {
+		return reason
+	}
+	return FinishReasonOther
+}
+
+// IsContentFilterReason 判断结束原因是否表示内容被提供商的安全策略拦截
+func IsContentFilterReason(reason string) bool {
+	return NormalizeFinishReason("", reason) == FinishReasonContentFilter
+}
+
+// normalizeFinishReasons 填充响应中每个候选回复的归一化结束原因
+func normalizeFinishReasons(resp *ChatResponse, provider Provider) {
+	for i := range resp.Choices {
+		resp.Choices[i].NormalizedFinishReason = NormalizeFinishReason(provider, resp.Choices[i].FinishReason)
+	}
+}
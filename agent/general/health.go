@@ -0,0 +1,81 @@
+package general
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthStatus 提供商健康检查结果
+type HealthStatus struct {
+	Provider Provider      `json:"provider"`
+	Healthy  bool          `json:"healthy"`
+	Latency  time.Duration `json:"latency"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// HealthCheck 并发探测所有已注册的提供商，用于启动校验和就绪探针
+// 每个提供商发送一次只生成1个token的请求，不使用默认参数中的重试策略，结果按提供商名称排序
+func (m *AgentManager) HealthCheck(ctx context.Context) []HealthStatus {
+	providers := m.ListProviders()
+	statuses := make([]HealthStatus, len(providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider Provider) {
+			defer wg.Done()
+			statuses[i] = m.probe(ctx, provider)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Provider < statuses[j].Provider
+	})
+	return statuses
+}
+
+// probe 探测单个提供商
+func (m *AgentManager) probe(ctx context.Context, provider Provider) HealthStatus {
+	status := HealthStatus{Provider: provider}
+	p, err := m.GetProvider(provider)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	if timeout := m.defaults[provider].Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 不指定模型，使用提供商配置中的模型
+	req := &ChatRequest{
+		Messages: []Message{
+			{Role: RoleUser, Content: []Content{{Type: ContentTypeText, Text: "ping"}}},
+		},
+		MaxTokens: 1,
+	}
+	start := time.Now()
+	_, err = p.Chat(ctx, req)
+	status.Latency = time.Since(start)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Healthy = true
+	return status
+}
+
+// AllHealthy 判断健康检查结果是否全部正常
+func AllHealthy(statuses []HealthStatus) bool {
+	for _, status := range statuses {
+		if !status.Healthy {
+			return false
+		}
+	}
+	return true
+}
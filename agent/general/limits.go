@@ -0,0 +1,142 @@
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SizeLimits 请求和响应的大小限制，零值字段不限制
+// 提供商对过大的请求通常只返回难以理解的400错误，设置限制后在发送前返回SizeLimitError
+type SizeLimits struct {
+	MaxRequestBytes    int `yaml:"MaxRequestBytes,omitempty" json:"max_request_bytes,omitempty"`        // 发送给提供商的请求体的最大字节数
+	MaxResponseBytes   int `yaml:"MaxResponseBytes,omitempty" json:"max_response_bytes,omitempty"`      // 响应体的最大字节数，流式响应按整个流计算
+	MaxImages          int `yaml:"MaxImages,omitempty" json:"max_images,omitempty"`                     // 一次请求中图片的最大数量
+	MaxToolSchemaBytes int `yaml:"MaxToolSchemaBytes,omitempty" json:"max_tool_schema_bytes,omitempty"` // 所有工具定义序列化为JSON后的最大字节数
+}
+
+// SizeLimit 超出的大小限制
+type SizeLimit string
+
+const (
+	LimitRequestBytes    SizeLimit = "request bytes"
+	LimitResponseBytes   SizeLimit = "response bytes"
+	LimitImages          SizeLimit = "images"
+	LimitToolSchemaBytes SizeLimit = "tool schema bytes"
+)
+
+// SizeLimitError 请求或响应超出了SizeLimits中的限制，这类错误不会重试
+type SizeLimitError struct {
+	Provider Provider
+	Limit    SizeLimit
+	Size     int    // 实际大小，响应超限时为超限前已读取的字节数
+	Max      int    // 限制
+	Tool     string // 工具定义超限时最大的工具
+}
+
+func (e *SizeLimitError) Error() string {
+	msg := fmt.Sprintf("provider %s: %s %d exceeds limit %d", e.Provider, e.Limit, e.Size, e.Max)
+	if e.Tool != "" {
+		msg += fmt.Sprintf(" (largest tool %s)", e.Tool)
+	}
+	return msg
+}
+
+// checkSizeLimits 检查请求中的图片数量和工具定义大小，请求体的大小在发送时由limitTransport检查
+func (m *AgentManager) checkSizeLimits(provider Provider, req *ChatRequest) error {
+	limits := m.limits[provider]
+	if limits.MaxImages > 0 {
+		images := 0
+		for _, msg := range req.Messages {
+			for _, content := range msg.Content {
+				if content.Type == ContentTypeImageURL || content.Type == ContentTypeImageB64 {
+					images++
+				}
+			}
+		}
+		if images > limits.MaxImages {
+			return &SizeLimitError{Provider: provider, Limit: LimitImages, Size: images, Max: limits.MaxImages}
+		}
+	}
+	if limits.MaxToolSchemaBytes > 0 && len(req.Tools) > 0 {
+		total, largest, largestName := 0, 0, ""
+		for _, tool := range req.Tools {
+			data, err := json.Marshal(tool)
+			if err != nil {
+				return fmt.Errorf("marshal tool %s failed: %w", tool.Function.Name, err)
+			}
+			total += len(data)
+			if len(data) > largest {
+				largest, largestName = len(data), tool.Function.Name
+			}
+		}
+		if total > limits.MaxToolSchemaBytes {
+			return &SizeLimitError{Provider: provider, Limit: LimitToolSchemaBytes, Size: total, Max: limits.MaxToolSchemaBytes, Tool: largestName}
+		}
+	}
+	return nil
+}
+
+// limitTransport 检查请求体和响应体大小的Transport
+type limitTransport struct {
+	base     http.RoundTripper
+	provider Provider
+	limits   SizeLimits
+}
+
+// withSizeLimits 设置了请求体或响应体大小限制时返回使用limitTransport的客户端副本
+func withSizeLimits(client *http.Client, provider Provider, limits SizeLimits) *http.Client {
+	if limits.MaxRequestBytes <= 0 && limits.MaxResponseBytes <= 0 {
+		return client
+	}
+	limited := *client
+	limited.Transport = &limitTransport{base: client.Transport, provider: provider, limits: limits}
+	return &limited
+}
+
+// RoundTrip 请求体超限时不发送请求，响应体在读取超过限制时返回错误
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if max := t.limits.MaxRequestBytes; max > 0 && req.ContentLength > int64(max) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &SizeLimitError{Provider: t.provider, Limit: LimitRequestBytes, Size: int(req.ContentLength), Max: max}
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || t.limits.MaxResponseBytes <= 0 {
+		return resp, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, provider: t.provider, max: t.limits.MaxResponseBytes}
+	return resp, nil
+}
+
+// limitedBody 读取超过max字节时返回SizeLimitError的响应体
+type limitedBody struct {
+	io.ReadCloser
+	provider Provider
+	max      int
+	read     int
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read >= b.max {
+		// 已读到限制时再读一个字节，判断响应是否恰好在限制处结束
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n == 0 {
+			return 0, err
+		}
+		return 0, &SizeLimitError{Provider: b.provider, Limit: LimitResponseBytes, Size: b.read + n, Max: b.max}
+	}
+	if remaining := b.max - b.read; len(p) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += n
+	return n, err
+}
@@ -0,0 +1,120 @@
+package general
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/anthropic"
+	"github.com/ccIisIaIcat/GoAgent/agent/deepseek"
+	"github.com/ccIisIaIcat/GoAgent/agent/google"
+	"github.com/ccIisIaIcat/GoAgent/agent/openai"
+	"github.com/ccIisIaIcat/GoAgent/agent/qwen"
+)
+
+// ModelInfo 提供商可用模型的信息，提供商未返回的字段为零值
+type ModelInfo struct {
+	ID               string   `json:"id"`
+	Provider         Provider `json:"provider"`
+	DisplayName      string   `json:"display_name,omitempty"`
+	OwnedBy          string   `json:"owned_by,omitempty"`
+	Created          int64    `json:"created,omitempty"` // Unix时间戳（秒）
+	InputTokenLimit  int      `json:"input_token_limit,omitempty"`
+	OutputTokenLimit int      `json:"output_token_limit,omitempty"`
+	// Capabilities 模型支持的能力，为nil时未知，登记后不校验能力（见RegisterModels）
+	Capabilities *ModelCapabilities `json:"capabilities,omitempty"`
+}
+
+// ModelLister 支持列出可用模型的提供商
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// ListModels 列出提供商可用的模型，按ID排序，可用于填充模型选择列表
+func (m *AgentManager) ListModels(ctx context.Context, provider Provider) ([]ModelInfo, error) {
+	p, err := m.GetProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := p.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support listing models", provider)
+	}
+
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list models failed: %w", err)
+	}
+	// 自定义名称的提供商使用注册时的名称
+	for i := range models {
+		models[i].Provider = provider
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+	return models, nil
+}
+
+// ValidateModel 检查模型是否在提供商的模型列表中，用于启动时校验配置的模型名称
+func (m *AgentManager) ValidateModel(ctx context.Context, provider Provider, model string) error {
+	models, err := m.ListModels(ctx, provider)
+	if err != nil {
+		return err
+	}
+	for _, info := range models {
+		if info.ID == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q is not available for provider %s", model, provider)
+}
+
+func fromOpenAIModels(models []openai.OpenAIModel) []ModelInfo {
+	infos := make([]ModelInfo, len(models))
+	for i, model := range models {
+		infos[i] = ModelInfo{ID: model.ID, Provider: ProviderOpenAI, OwnedBy: model.OwnedBy, Created: model.Created}
+	}
+	return infos
+}
+
+func fromDeepSeekModels(models []deepseek.DeepSeekModel) []ModelInfo {
+	infos := make([]ModelInfo, len(models))
+	for i, model := range models {
+		infos[i] = ModelInfo{ID: model.ID, Provider: ProviderDeepSeek, OwnedBy: model.OwnedBy, Created: model.Created}
+	}
+	return infos
+}
+
+func fromQwenModels(models []qwen.QwenModel) []ModelInfo {
+	infos := make([]ModelInfo, len(models))
+	for i, model := range models {
+		infos[i] = ModelInfo{ID: model.ID, Provider: ProviderQwen, OwnedBy: model.OwnedBy, Created: model.Created}
+	}
+	return infos
+}
+
+func fromAnthropicModels(models []anthropic.AnthropicModel) []ModelInfo {
+	infos := make([]ModelInfo, len(models))
+	for i, model := range models {
+		infos[i] = ModelInfo{ID: model.ID, Provider: ProviderAnthropic, DisplayName: model.DisplayName}
+		if created, err := time.Parse(time.RFC3339, model.CreatedAt); err == nil {
+			infos[i].Created = created.Unix()
+		}
+	}
+	return infos
+}
+
+func fromGoogleModels(models []google.GoogleModel) []ModelInfo {
+	infos := make([]ModelInfo, len(models))
+	for i, model := range models {
+		infos[i] = ModelInfo{
+			ID:               model.ID(),
+			Provider:         ProviderGoogle,
+			DisplayName:      model.DisplayName,
+			InputTokenLimit:  model.InputTokenLimit,
+			OutputTokenLimit: model.OutputTokenLimit,
+		}
+	}
+	return infos
+}
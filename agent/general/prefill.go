@@ -0,0 +1,51 @@
+package general
+
+import (
+	"fmt"
+	"strings"
+)
+
+// applyPrefill 检查提供商是否支持Prefill，返回需要拼接到回复开头的前缀
+// Anthropic不接受以空白结尾的assistant消息，发送前去掉末尾的空白，回复开头拼接的也是去掉空白后的前缀
+func applyPrefill(providerType Provider, req *ChatRequest) (*ChatRequest, string, error) {
+	if req.Prefill == "" {
+		return req, "", nil
+	}
+	switch providerType {
+	case ProviderAnthropic:
+		trimmed := strings.TrimRight(req.Prefill, " \t\r\n")
+		if trimmed == "" {
+			return nil, "", fmt.Errorf("prefill must not be only whitespace for provider %s", providerType)
+		}
+		if trimmed != req.Prefill {
+			copied := *req
+			copied.Prefill = trimmed
+			req = &copied
+		}
+	case ProviderDeepSeek, ProviderQwen:
+	default:
+		return nil, "", fmt.Errorf("prefill is not supported by provider type %s", providerType)
+	}
+	return req, req.Prefill, nil
+}
+
+// prependPrefill 将前缀拼接到每个候选回复的文本开头，提供商返回的只是前缀之后的内容
+func prependPrefill(resp *ChatResponse, prefix string) {
+	if resp == nil || prefix == "" {
+		return
+	}
+	for i := range resp.Choices {
+		prependText(&resp.Choices[i].Message, prefix)
+	}
+}
+
+// prependText 将文本拼接到消息第一个文本内容的开头，没有文本内容时插入一个
+func prependText(msg *Message, prefix string) {
+	for i, content := range msg.Content {
+		if content.Type == ContentTypeText {
+			msg.Content[i].Text = prefix + content.Text
+			return
+		}
+	}
+	msg.Content = append([]Content{{Type: ContentTypeText, Text: prefix}}, msg.Content...)
+}
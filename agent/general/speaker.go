@@ -0,0 +1,50 @@
+package general
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// speakerLabelFormat 不支持name字段的提供商在用户消息文本开头加上的发言人标签
+const speakerLabelFormat = "[%s]: "
+
+// nativeNamePattern OpenAI兼容接口接受的name字段格式
+var nativeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// SpeakerLabel 返回不支持name字段时加在用户消息开头的发言人标签，如"[alice]: "
+func SpeakerLabel(name string) string {
+	return fmt.Sprintf(speakerLabelFormat, name)
+}
+
+// applySpeakerNames 按提供商处理用户消息的Name字段，多个用户参与同一对话时让模型区分发言人
+// OpenAI和DeepSeek原生支持name字段，名称符合格式时原样发送；其他提供商忽略name字段，
+// 名称不符合格式时也无法原样发送，这两种情况去掉Name并在消息文本开头加上发言人标签
+// 需要修改时复制请求和消息，不修改调用方的数据
+func applySpeakerNames(providerType Provider, req *ChatRequest) *ChatRequest {
+	native := providerType == ProviderOpenAI || providerType == ProviderDeepSeek
+	var messages []Message
+	for i, msg := range req.Messages {
+		if msg.Role != RoleUser || msg.Name == "" {
+			continue
+		}
+		if native && nativeNamePattern.MatchString(msg.Name) {
+			continue
+		}
+		if messages == nil {
+			messages = make([]Message, len(req.Messages))
+			copy(messages, req.Messages)
+		}
+		labeled := msg
+		labeled.Name = ""
+		labeled.Content = make([]Content, len(msg.Content))
+		copy(labeled.Content, msg.Content)
+		prependText(&labeled, SpeakerLabel(msg.Name))
+		messages[i] = labeled
+	}
+	if messages == nil {
+		return req
+	}
+	copied := *req
+	copied.Messages = messages
+	return &copied
+}
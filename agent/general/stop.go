@@ -0,0 +1,14 @@
+package general
+
+// StopReason ConversationManager中一轮对话（一次Chat调用）的结束原因
+type StopReason string
+
+const (
+	StopReasonSuccess          StopReason = "success"                   // 模型给出了最终回复，正常结束
+	StopReasonTruncated        StopReason = "truncated"                 // 最终回复达到MaxTokens被截断，内容可能不完整
+	StopReasonMaxFunctionCalls StopReason = "max_function_calling_nums" // 函数调用次数超过MaxFunctionCallingNums
+	StopReasonBudgetExceeded   StopReason = "budget_exceeded"           // 超出token或费用预算，未继续请求模型
+	StopReasonContentFilter    StopReason = "content_filter"            // 回复被提供商的安全策略拦截
+	StopReasonCancelled        StopReason = "cancelled"                 // 上下文被取消或超时（包括Shutdown取消进行中的对话）
+	StopReasonError            StopReason = "error"                     // 请求模型或执行工具失败
+)
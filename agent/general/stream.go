@@ -0,0 +1,346 @@
+package general
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/anthropic"
+	"github.com/ccIisIaIcat/GoAgent/agent/deepseek"
+	"github.com/ccIisIaIcat/GoAgent/agent/google"
+	"github.com/ccIisIaIcat/GoAgent/agent/openai"
+	"github.com/ccIisIaIcat/GoAgent/agent/qwen"
+)
+
+// StreamChunk 流式响应的一个增量数据块，各提供商的流式事件都转换为这个结构
+// 按顺序拼接所有块的Delta得到完整的回答文本，工具调用按ToolCallDelta.Index拼接
+type StreamChunk struct {
+	ID             string          `json:"id,omitempty"`
+	Model          string          `json:"model,omitempty"`
+	Delta          string          `json:"delta,omitempty"`           // 新增的回答文本
+	ReasoningDelta string          `json:"reasoning_delta,omitempty"` // 新增的思考内容
+	ToolCalls      []ToolCallDelta `json:"tool_calls,omitempty"`
+	// FinishReason 提供商返回的原始结束原因，只在最后的块中设置
+	FinishReason           string       `json:"finish_reason,omitempty"`
+	NormalizedFinishReason FinishReason `json:"normalized_finish_reason,omitempty"`
+	// Usage 使用统计，只在提供商返回统计的块中设置，可能只包含输入或输出的部分
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// ToolCallDelta 工具调用的增量，ID和Name在该工具调用的第一个增量中设置，之后的增量只有参数片段
+type ToolCallDelta struct {
+	Index          int    `json:"index"` // 工具调用在本次回复中的序号
+	ID             string `json:"id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	ArgumentsDelta string `json:"arguments_delta,omitempty"` // 参数JSON的片段
+}
+
+// empty 判断数据块是否不包含任何内容，这样的块不发送给调用方
+func (c *StreamChunk) empty() bool {
+	return c.Delta == "" && c.ReasoningDelta == "" && len(c.ToolCalls) == 0 && c.FinishReason == "" && c.Usage == nil
+}
+
+// convertStream 将提供商客户端返回的流式事件逐个转换为StreamChunk，转换结果为nil或不包含内容的事件被跳过
+func convertStream[T any](ctx context.Context, events <-chan T, convert func(event T) *StreamChunk) <-chan *StreamChunk {
+	chunks := make(chan *StreamChunk, 10)
+	go func() {
+		defer close(chunks)
+		for event := range events {
+			chunk := convert(event)
+			if chunk == nil || chunk.empty() {
+				continue
+			}
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				// 继续读取直到客户端关闭通道，避免客户端的goroutine阻塞
+				for range events {
+				}
+				return
+			}
+		}
+	}()
+	return chunks
+}
+
+// guardStream 将数据块转发给调用方，first在上游的数据块之前发送，transform在发送前修改数据块
+// 缓冲区已满且调用方超过timeout未读取时视为已放弃：取消上游请求、读完剩余的数据块并关闭通道，避免goroutine和连接泄漏
+func guardStream(ctx context.Context, cancel context.CancelFunc, chunks <-chan *StreamChunk, first []*StreamChunk, timeout time.Duration, transform func(chunk *StreamChunk)) <-chan *StreamChunk {
+	if timeout == 0 {
+		timeout = DefaultStreamConsumerTimeout
+	}
+	out := make(chan *StreamChunk, 10)
+	go func() {
+		defer close(out)
+		defer func() {
+			cancel()
+			// 上游在取消后关闭通道，读完剩余的数据块使其goroutine退出
+			for range chunks {
+			}
+		}()
+
+		var timer *time.Timer
+		if timeout > 0 {
+			timer = time.NewTimer(timeout)
+			defer timer.Stop()
+		}
+		send := func(chunk *StreamChunk) bool {
+			var expired <-chan time.Time
+			if timer != nil {
+				timer.Reset(timeout)
+				expired = timer.C
+			}
+			select {
+			case out <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			case <-expired:
+				return false
+			}
+		}
+
+		for _, chunk := range first {
+			if !send(chunk) {
+				return
+			}
+		}
+		for chunk := range chunks {
+			transform(chunk)
+			if !send(chunk) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// fromOpenAIStream 转换OpenAI的流式响应，只使用第一个候选回复
+func fromOpenAIStream(resp openai.OpenAIStreamResponse) *StreamChunk {
+	chunk := &StreamChunk{ID: resp.ID, Model: resp.Model}
+	if resp.Usage != nil {
+		chunk.Usage = &Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens, TotalTokens: resp.Usage.TotalTokens}
+	}
+	if len(resp.Choices) == 0 {
+		return chunk
+	}
+	choice := resp.Choices[0]
+	chunk.Delta = choice.Delta.Content
+	for i, toolCall := range choice.Delta.ToolCalls {
+		chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+			Index:          deltaIndex(toolCall.Index, i),
+			ID:             toolCall.ID,
+			Name:           toolCall.Function.Name,
+			ArgumentsDelta: toolCall.Function.Arguments,
+		})
+	}
+	if choice.FinishReason != nil {
+		chunk.setFinishReason(ProviderOpenAI, *choice.FinishReason)
+	}
+	return chunk
+}
+
+// fromDeepSeekStream 转换DeepSeek的流式响应，思考模型的reasoning_content作为思考内容
+func fromDeepSeekStream(resp deepseek.DeepSeekStreamResponse) *StreamChunk {
+	chunk := &StreamChunk{ID: resp.ID, Model: resp.Model}
+	if resp.Usage != nil {
+		chunk.Usage = &Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens, TotalTokens: resp.Usage.TotalTokens}
+		if resp.Usage.PromptCacheHitTokens > 0 || resp.Usage.PromptCacheMissTokens > 0 {
+			chunk.Usage.Extensions = map[string]int{
+				UsagePromptCacheHitTokens:  resp.Usage.PromptCacheHitTokens,
+				UsagePromptCacheMissTokens: resp.Usage.PromptCacheMissTokens,
+			}
+		}
+	}
+	if len(resp.Choices) == 0 {
+		return chunk
+	}
+	choice := resp.Choices[0]
+	chunk.Delta = choice.Delta.Content
+	chunk.ReasoningDelta = choice.Delta.ReasoningContent
+	for i, toolCall := range choice.Delta.ToolCalls {
+		chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+			Index:          deltaIndex(toolCall.Index, i),
+			ID:             toolCall.ID,
+			Name:           toolCall.Function.Name,
+			ArgumentsDelta: rawArgumentsDelta(toolCall.Function.Arguments),
+		})
+	}
+	if choice.FinishReason != nil {
+		chunk.setFinishReason(ProviderDeepSeek, *choice.FinishReason)
+	}
+	return chunk
+}
+
+// fromQwenStream 转换Qwen的流式响应，<think>标签内的文本已由客户端移到reasoning_content
+func fromQwenStream(resp qwen.QwenStreamResponse) *StreamChunk {
+	chunk := &StreamChunk{ID: resp.Id, Model: resp.Model}
+	if resp.Usage != nil {
+		chunk.Usage = &Usage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens, TotalTokens: resp.Usage.TotalTokens}
+	}
+	if len(resp.Choices) == 0 {
+		return chunk
+	}
+	choice := resp.Choices[0]
+	chunk.Delta = choice.Delta.Content
+	chunk.ReasoningDelta = choice.Delta.ReasoningContent
+	for i, toolCall := range choice.Delta.ToolCalls {
+		chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+			Index:          deltaIndex(toolCall.Index, i),
+			ID:             toolCall.Id,
+			Name:           toolCall.Function.Name,
+			ArgumentsDelta: toolCall.Function.Arguments,
+		})
+	}
+	if choice.FinishReason != nil {
+		chunk.setFinishReason(ProviderQwen, *choice.FinishReason)
+	}
+	return chunk
+}
+
+// googleStream 转换Google的流式响应，Google每次返回完整的函数调用，按出现顺序编号
+// 工具调用ID由流开始时生成的前缀加序号组成，同一块中的多个调用不会得到相同的ID
+type googleStream struct {
+	idPrefix  string
+	toolCalls int
+}
+
+func newGoogleStream() *googleStream {
+	return &googleStream{idPrefix: google.ToolCallIDPrefix()}
+}
+
+func (s *googleStream) convert(resp google.GoogleStreamResponse) *StreamChunk {
+	chunk := &StreamChunk{}
+	if resp.UsageMetadata != nil {
+		chunk.Usage = &Usage{
+			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
+		}
+	}
+	if len(resp.Candidates) == 0 {
+		return chunk
+	}
+	candidate := resp.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		chunk.Delta += part.Text
+		if part.FunctionCall == nil {
+			continue
+		}
+		args, err := json.Marshal(part.FunctionCall.Args)
+		if err != nil || part.FunctionCall.Args == nil {
+			args = []byte("{}")
+		}
+		chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+			Index:          s.toolCalls,
+			ID:             fmt.Sprintf("%s_%d", s.idPrefix, s.toolCalls),
+			Name:           part.FunctionCall.Name,
+			ArgumentsDelta: string(args),
+		})
+		s.toolCalls++
+	}
+	if candidate.FinishReason != "" {
+		chunk.setFinishReason(ProviderGoogle, candidate.FinishReason)
+	}
+	return chunk
+}
+
+// anthropicStream 转换Anthropic的流式事件
+// 消息ID和模型只在message_start中返回，工具调用按内容块序号返回，需要在整个流中记录
+type anthropicStream struct {
+	id        string
+	model     string
+	toolCalls map[int]int // 内容块序号到工具调用序号
+}
+
+func (s *anthropicStream) convert(event anthropic.AnthropicStreamEvent) *StreamChunk {
+	switch event.Type {
+	case "message_start":
+		var message anthropic.AnthropicChatResponse
+		if err := json.Unmarshal(event.Message, &message); err != nil {
+			return nil
+		}
+		s.id, s.model = message.ID, message.Model
+		return s.chunk(&StreamChunk{Usage: anthropicStreamUsage(message.Usage)})
+	case "content_block_start":
+		var block anthropic.AnthropicContent
+		if err := json.Unmarshal(event.ContentBlock, &block); err != nil || block.Type != "tool_use" {
+			return nil
+		}
+		if s.toolCalls == nil {
+			s.toolCalls = make(map[int]int)
+		}
+		index := len(s.toolCalls)
+		s.toolCalls[event.Index] = index
+		return s.chunk(&StreamChunk{ToolCalls: []ToolCallDelta{{Index: index, ID: block.ID, Name: block.Name}}})
+	case "content_block_delta":
+		var delta anthropic.AnthropicStreamDelta
+		if err := json.Unmarshal(event.Delta, &delta); err != nil {
+			return nil
+		}
+		switch delta.Type {
+		case "text_delta":
+			return s.chunk(&StreamChunk{Delta: delta.Text})
+		case "thinking_delta":
+			return s.chunk(&StreamChunk{ReasoningDelta: delta.Thinking})
+		case "input_json_delta":
+			index, ok := s.toolCalls[event.Index]
+			if !ok {
+				return nil
+			}
+			return s.chunk(&StreamChunk{ToolCalls: []ToolCallDelta{{Index: index, ArgumentsDelta: delta.PartialJSON}}})
+		}
+	case "message_delta":
+		var delta anthropic.AnthropicStreamDelta
+		if err := json.Unmarshal(event.Delta, &delta); err != nil {
+			return nil
+		}
+		chunk := &StreamChunk{}
+		if event.Usage != nil {
+			chunk.Usage = anthropicStreamUsage(*event.Usage)
+		}
+		if delta.StopReason != "" {
+			chunk.setFinishReason(ProviderAnthropic, delta.StopReason)
+		}
+		return s.chunk(chunk)
+	}
+	return nil
+}
+
+// chunk 填充消息ID和模型
+func (s *anthropicStream) chunk(chunk *StreamChunk) *StreamChunk {
+	chunk.ID, chunk.Model = s.id, s.model
+	return chunk
+}
+
+// anthropicStreamUsage message_start只包含输入token，message_delta只包含输出token
+func anthropicStreamUsage(usage anthropic.AnthropicUsage) *Usage {
+	if usage.InputTokens == 0 && usage.OutputTokens == 0 {
+		return nil
+	}
+	return &Usage{PromptTokens: usage.InputTokens, CompletionTokens: usage.OutputTokens, TotalTokens: usage.InputTokens + usage.OutputTokens}
+}
+
+// setFinishReason 设置原始和归一化的结束原因
+func (c *StreamChunk) setFinishReason(provider Provider, reason string) {
+	c.FinishReason = reason
+	c.NormalizedFinishReason = NormalizeFinishReason(provider, reason)
+}
+
+// deltaIndex 返回增量中的工具调用序号，提供商没有返回时使用在增量中的位置
+func deltaIndex(index *int, position int) int {
+	if index != nil {
+		return *index
+	}
+	return position
+}
+
+// rawArgumentsDelta 流式参数片段是JSON字符串，取出其中的文本
+func rawArgumentsDelta(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(raw)
+}
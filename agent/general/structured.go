@@ -0,0 +1,361 @@
+package general
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// StructuredOutputError 结构化输出在重试后仍未通过校验
+type StructuredOutputError struct {
+	Attempts int      // 请求次数（含首次请求）
+	Problems []string // 最后一次回复的校验问题
+	Output   string   // 最后一次回复的文本
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("structured output invalid after %d attempt(s):\n  - %s", e.Attempts, strings.Join(e.Problems, "\n  - "))
+}
+
+// nativeSchemaProviders 原生支持json_schema的提供商类型
+var nativeSchemaProviders = map[Provider]bool{ProviderOpenAI: true, ProviderGoogle: true}
+
+// applyResponseFormat 为不能原生约束输出格式的提供商在系统提示词中说明格式
+// json_object模式下OpenAI兼容接口要求提示词中包含"JSON"，因此所有提供商都会附上说明
+func applyResponseFormat(providerType Provider, req *ChatRequest) {
+	format := req.ResponseFormat
+	if !format.Structured() {
+		return
+	}
+	if format.Type == ResponseFormatJSONSchema && nativeSchemaProviders[providerType] {
+		return
+	}
+
+	instruction := "请只输出一个JSON对象，不要输出其他内容。"
+	if format.Type == ResponseFormatJSONSchema && format.Schema != nil {
+		if schema, err := json.Marshal(format.Schema); err == nil {
+			instruction += "\n输出必须符合以下JSON Schema：\n" + string(schema)
+		}
+	}
+	if req.SystemPrompt != "" {
+		req.SystemPrompt += "\n\n"
+	}
+	req.SystemPrompt += instruction
+}
+
+// chatStructured 发送结构化输出请求并校验回复，未通过校验时带着校验问题让模型重新回答
+// 返回的Usage为所有请求的累计使用量
+func (m *AgentManager) chatStructured(ctx context.Context, call func(req *ChatRequest) (*ChatResponse, error), req *ChatRequest) (*ChatResponse, error) {
+	attemptReq := *req
+	var usage Usage
+	for attempt := 1; ; attempt++ {
+		resp, err := call(&attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		usage.Add(resp.Usage)
+
+		problems, output := validateStructuredOutput(resp, req.ResponseFormat)
+		if len(problems) == 0 {
+			resp.Usage = usage
+			return resp, nil
+		}
+		if attempt > req.StructuredOutputRetries || ctx.Err() != nil {
+			return nil, &StructuredOutputError{Attempts: attempt, Problems: problems, Output: output}
+		}
+
+		// 在新的切片上追加不合格的回复和校验问题，不修改调用方的消息
+		messages := make([]Message, 0, len(attemptReq.Messages)+2)
+		messages = append(messages, attemptReq.Messages...)
+		messages = append(messages, resp.Choices[0].Message, Message{
+			Role: RoleUser,
+			Content: []Content{{
+				Type: ContentTypeText,
+				Text: "你的回复没有通过格式校验:\n- " + strings.Join(problems, "\n- ") + "\n请修正后只输出符合要求的JSON。",
+			}},
+		})
+		attemptReq.Messages = messages
+	}
+}
+
+// validateStructuredOutput 校验回复是否为符合格式的JSON，包含工具调用的回复不校验
+func validateStructuredOutput(resp *ChatResponse, format *ResponseFormat) ([]string, string) {
+	if len(resp.Choices) == 0 {
+		return []string{"response has no choices"}, ""
+	}
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) > 0 {
+		return nil, ""
+	}
+
+	output := messageText(msg)
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(unwrapJSONFence(output)), &value); err != nil {
+		return []string{fmt.Sprintf("output is not valid JSON: %v", err)}, output
+	}
+	if format.Type == ResponseFormatJSONObject {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return []string{fmt.Sprintf("output must be a JSON object, got %s", jsonTypeName(value))}, output
+		}
+		return nil, output
+	}
+	return ValidateJSONSchema(value, format.Schema), output
+}
+
+// jsonFencePattern 包裹整个回复的markdown代码块
+var jsonFencePattern = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*\\n(.*?)\\n?```$")
+
+// unwrapJSONFence 去掉包裹JSON的markdown代码块标记
+func unwrapJSONFence(text string) string {
+	text = strings.TrimSpace(text)
+	if match := jsonFencePattern.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+	return text
+}
+
+// ValidateJSONSchema 用JSON Schema的常用子集校验已解析的JSON值，返回带路径的问题描述
+// 支持type、enum、const、properties、required、additionalProperties、items、min/maxItems、
+// min/maxLength、pattern、minimum、maximum、anyOf、oneOf和allOf
+func ValidateJSONSchema(value interface{}, schema map[string]interface{}) []string {
+	return validateSchema(value, schema, "$")
+}
+
+func validateSchema(value interface{}, schema map[string]interface{}, path string) []string {
+	if schema == nil {
+		return nil
+	}
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !matchesAnyType(value, types) {
+		addf("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(value))
+		return problems
+	}
+	if enum, ok := schemaValues(schema["enum"]); ok && !containsJSONValue(enum, value) {
+		addf("value %s is not one of %s", compactJSON(value), compactJSON(enum))
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		addf("value must be %s", compactJSON(constant))
+	}
+
+	for _, key := range []string{"anyOf", "oneOf"} {
+		options := schemaList(schema[key])
+		if len(options) == 0 {
+			continue
+		}
+		matched := 0
+		for _, option := range options {
+			if len(validateSchema(value, option, path)) == 0 {
+				matched++
+			}
+		}
+		if matched == 0 {
+			addf("value does not match any schema in %s", key)
+		} else if key == "oneOf" && matched > 1 {
+			addf("value matches %d schemas in oneOf, expected exactly one", matched)
+		}
+	}
+	for _, option := range schemaList(schema["allOf"]) {
+		problems = append(problems, validateSchema(value, option, path)...)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				addf("missing required property %q", name)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propertySchema, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(v[key], propertySchema, path+"."+key)...)
+				continue
+			}
+			if _, ok := properties[key]; ok {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					addf("unexpected property %q", key)
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateSchema(v[key], additional, path+"."+key)...)
+			}
+		}
+	case []interface{}:
+		if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < min {
+			addf("expected at least %v items, got %d", min, len(v))
+		}
+		if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > max {
+			addf("expected at most %v items, got %d", max, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema["minLength"]); ok && length < min {
+			addf("expected at least %v characters", min)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && length > max {
+			addf("expected at most %v characters", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				addf("value %q does not match pattern %s", v, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema["minimum"]); ok && v < min {
+			addf("value %v is less than minimum %v", v, min)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && v > max {
+			addf("value %v is greater than maximum %v", v, max)
+		}
+	}
+	return problems
+}
+
+// schemaTypes 读取type字段，支持字符串和字符串数组
+func schemaTypes(value interface{}) []string {
+	if single, ok := value.(string); ok {
+		return []string{single}
+	}
+	return schemaStrings(value)
+}
+
+// schemaStrings 读取字符串数组，兼容[]string和[]interface{}
+func schemaStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// schemaValues 读取enum等值列表，兼容Go代码中构造的[]string
+func schemaValues(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = item
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// schemaList 读取anyOf等子Schema列表，兼容[]map[string]interface{}和[]interface{}
+func schemaList(value interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		return v
+	case []interface{}:
+		result := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if schema, ok := item.(map[string]interface{}); ok {
+				result = append(result, schema)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// schemaNumber 读取数值字段，兼容Go代码中构造的int和JSON解析出的float64
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// matchesAnyType 判断值是否属于任一JSON类型
+func matchesAnyType(value interface{}, types []string) bool {
+	actual := jsonTypeName(value)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeName 返回已解析JSON值的类型名称，整数值返回integer
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// containsJSONValue 判断值是否在列表中
+func containsJSONValue(values []interface{}, value interface{}) bool {
+	for _, item := range values {
+		if jsonEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonEqual 按JSON序列化结果比较两个值，使int和float64等价
+func jsonEqual(a, b interface{}) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
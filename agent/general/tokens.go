@@ -0,0 +1,43 @@
+package general
+
+import (
+	"context"
+	"fmt"
+)
+
+// TokenCountingProvider 支持服务端token计数的提供商（Anthropic count_tokens、Gemini countTokens）
+type TokenCountingProvider interface {
+	CountTokens(ctx context.Context, req *ChatRequest) (int, error)
+}
+
+// CountTokens 调用提供商的token计数接口，返回请求的输入token数
+// 计数时使用与Chat相同的默认参数（如默认系统提示词），不修改传入的请求
+func (m *AgentManager) CountTokens(ctx context.Context, provider Provider, req *ChatRequest) (int, error) {
+	p, err := m.GetProvider(provider)
+	if err != nil {
+		return 0, err
+	}
+	counter, ok := p.(TokenCountingProvider)
+	if !ok {
+		return 0, fmt.Errorf("provider %s does not support token counting", provider)
+	}
+
+	countReq := m.defaults[provider].applyDefaults(req)
+	m.resolveProviderOptions(provider, countReq)
+
+	tokens, err := counter.CountTokens(ctx, countReq)
+	if err != nil {
+		return 0, fmt.Errorf("count tokens failed: %w", err)
+	}
+	return tokens, nil
+}
+
+// SupportsTokenCounting 判断提供商是否支持服务端token计数
+func (m *AgentManager) SupportsTokenCounting(provider Provider) bool {
+	p, err := m.GetProvider(provider)
+	if err != nil {
+		return false
+	}
+	_, ok := p.(TokenCountingProvider)
+	return ok
+}
@@ -0,0 +1,485 @@
+package general
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML 解析TOML文档，支持配置文件常用的子集：
+// 表、表数组、点分键、字符串（含多行）、整数、浮点数、布尔值、数组和内联表，不支持日期时间
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: string(data), line: 1, root: make(map[string]interface{})}
+	p.current = p.root
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.root, nil
+}
+
+// tomlParser TOML解析器
+type tomlParser struct {
+	src     string
+	pos     int
+	line    int
+	root    map[string]interface{}
+	current map[string]interface{}
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) advance() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace 跳过空格和制表符
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.advance()
+	}
+}
+
+// skipBlank 跳过空白、换行和注释
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.advance()
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.advance()
+	}
+}
+
+// expectLineEnd 一条语句之后只允许空白和注释
+func (p *tomlParser) expectLineEnd() error {
+	p.skipSpace()
+	if p.peek() == '#' {
+		p.skipComment()
+	}
+	if p.peek() == '\r' {
+		p.advance()
+	}
+	if !p.eof() && p.peek() != '\n' {
+		return p.errorf("unexpected %q after value", p.peek())
+	}
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil
+		}
+		if p.peek() == '[' {
+			if err := p.parseTableHeader(); err != nil {
+				return err
+			}
+		} else if err := p.parseKeyValue(p.current); err != nil {
+			return err
+		}
+		if err := p.expectLineEnd(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseTableHeader 解析[table]或[[array.of.tables]]
+func (p *tomlParser) parseTableHeader() error {
+	p.advance()
+	isArray := p.peek() == '['
+	if isArray {
+		p.advance()
+	}
+	p.skipSpace()
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	closing := "]"
+	if isArray {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], closing) {
+		return p.errorf("expected %s", closing)
+	}
+	p.pos += len(closing)
+
+	table := p.root
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, key); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	if isArray {
+		existing, ok := table[last]
+		if !ok {
+			existing = []interface{}{}
+		}
+		array, ok := existing.([]interface{})
+		if !ok {
+			return p.errorf("key %s is already defined and is not an array of tables", last)
+		}
+		next := make(map[string]interface{})
+		table[last] = append(array, next)
+		p.current = next
+		return nil
+	}
+	next, err := p.descend(table, last)
+	if err != nil {
+		return err
+	}
+	p.current = next
+	return nil
+}
+
+// descend 进入子表，不存在时创建；子表为表数组时进入最后一个元素
+func (p *tomlParser) descend(table map[string]interface{}, key string) (map[string]interface{}, error) {
+	switch value := table[key].(type) {
+	case nil:
+		next := make(map[string]interface{})
+		table[key] = next
+		return next, nil
+	case map[string]interface{}:
+		return value, nil
+	case []interface{}:
+		if len(value) > 0 {
+			if next, ok := value[len(value)-1].(map[string]interface{}); ok {
+				return next, nil
+			}
+		}
+	}
+	return nil, p.errorf("key %s is already defined and is not a table", key)
+}
+
+// parseKeyValue 解析key = value并写入table
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return p.errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.advance()
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = p.descend(table, key); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return p.errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	table[last] = value
+	return nil
+}
+
+// parseKey 解析裸键、引号键和点分键
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var key string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case c == '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.advance()
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected key, found %q", p.peek())
+			}
+			key = p.src[start:p.pos]
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.advance()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue 解析值
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return p.parseMultilineString(`"""`, true)
+		}
+		return p.parseBasicString()
+	case c == '\'':
+		if strings.HasPrefix(p.src[p.pos:], `'''`) {
+			return p.parseMultilineString(`'''`, false)
+		}
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	case strings.HasPrefix(p.src[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.src[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	default:
+		return p.parseNumber()
+	}
+}
+
+// parseBasicString 解析双引号字符串
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.advance()
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.advance()
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// parseEscape 解析转义序列
+func (p *tomlParser) parseEscape(sb *strings.Builder) error {
+	if p.eof() {
+		return p.errorf("unterminated escape sequence")
+	}
+	c := p.advance()
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		p.pos += size
+		sb.WriteRune(rune(code))
+	default:
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+// parseLiteralString 解析单引号字符串，不处理转义
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.advance()
+	start := p.pos
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		if p.advance() == '\'' {
+			return p.src[start : p.pos-1], nil
+		}
+	}
+}
+
+// parseMultilineString 解析多行字符串，紧跟开头引号的换行会被忽略
+func (p *tomlParser) parseMultilineString(delim string, escapes bool) (string, error) {
+	p.pos += len(delim)
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.advance()
+	}
+	if p.peek() == '\n' {
+		p.advance()
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated multi-line string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delim) {
+			p.pos += len(delim)
+			return sb.String(), nil
+		}
+		c := p.advance()
+		if escapes && c == '\\' {
+			// 行尾反斜杠会去掉换行及下一行开头的空白
+			if p.peek() == '\n' || strings.HasPrefix(p.src[p.pos:], "\r\n") {
+				p.skipBlankNoComment()
+				continue
+			}
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+}
+
+func (p *tomlParser) skipBlankNoComment() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+		p.advance()
+	}
+}
+
+// parseArray 解析数组，允许跨行和末尾逗号
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	p.advance()
+	array := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.advance()
+			return array, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.advance()
+		case ']':
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+// parseInlineTable 解析单行内联表
+func (p *tomlParser) parseInlineTable() (map[string]interface{}, error) {
+	p.advance()
+	table := make(map[string]interface{})
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.advance()
+		return table, nil
+	}
+	for {
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.advance()
+		case '}':
+			p.advance()
+			return table, nil
+		default:
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// parseNumber 解析整数和浮点数
+func (p *tomlParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte("+-_.0123456789abcdefABCDEFxXoOinINT:", p.peek()) >= 0 {
+		p.advance()
+	}
+	text := p.src[start:p.pos]
+	if text == "" {
+		return nil, p.errorf("expected value, found %q", p.peek())
+	}
+	if strings.ContainsAny(text, ":T") {
+		return nil, p.errorf("date-time values are not supported: %s", text)
+	}
+	switch strings.TrimLeft(text, "+-") {
+	case "inf":
+		if strings.HasPrefix(text, "-") {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %s", text)
+}
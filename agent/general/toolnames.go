@@ -0,0 +1,189 @@
+package general
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// toolNameRule 提供商对工具名称的限制
+type toolNameRule struct {
+	maxLength int
+	invalid   *regexp.Regexp // 连续的不允许的字符
+	first     *regexp.Regexp // 首字符必须满足的规则，为nil时不限制
+}
+
+// openAIToolNameInvalid OpenAI兼容接口和Anthropic只允许字母、数字、下划线和连字符
+var openAIToolNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// toolNameRules 各客户端类型的工具名称限制
+var toolNameRules = map[Provider]toolNameRule{
+	ProviderOpenAI:    {maxLength: 64, invalid: openAIToolNameInvalid},
+	ProviderAnthropic: {maxLength: 64, invalid: openAIToolNameInvalid},
+	ProviderDeepSeek:  {maxLength: 64, invalid: openAIToolNameInvalid},
+	ProviderQwen:      {maxLength: 64, invalid: openAIToolNameInvalid},
+	// Gemini还允许点和冒号，但必须以字母或下划线开头
+	ProviderGoogle: {maxLength: 64, invalid: regexp.MustCompile(`[^a-zA-Z0-9_.:-]+`), first: regexp.MustCompile(`^[a-zA-Z_]`)},
+}
+
+// valid 判断名称是否符合限制
+func (r toolNameRule) valid(name string) bool {
+	return len(name) <= r.maxLength && !r.invalid.MatchString(name) && (r.first == nil || r.first.MatchString(name))
+}
+
+// alias 将名称转换为符合限制的别名，hashed为true时总是附加原名称的哈希，用于避免截断或替换后重名
+// 包含非ASCII字符（如中文）的名称替换后几乎不剩可读内容，总是附加哈希
+func (r toolNameRule) alias(name string, hashed bool) string {
+	hashed = hashed || strings.IndexFunc(name, func(c rune) bool { return c >= utf8.RuneSelf }) >= 0
+	alias := r.invalid.ReplaceAllString(name, "_")
+	if r.first != nil && !r.first.MatchString(alias) {
+		alias = "_" + alias
+	}
+	if !hashed && len(alias) <= r.maxLength {
+		return alias
+	}
+	hash := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(hash[:])[:8]
+	if len(alias) > r.maxLength-len(suffix) {
+		alias = alias[:r.maxLength-len(suffix)]
+	}
+	return alias + suffix
+}
+
+// aliasToolNames 将请求中不符合提供商限制的工具名称（如MCP工具的server.tool、过长或包含中文的名称）替换为别名
+// 工具定义和历史中的工具调用使用相同的别名，别名由原名称确定，多轮对话中保持不变
+// 返回的请求是副本，返回的映射为别名到原名称，所有名称都符合限制时原样返回请求和nil
+func aliasToolNames(providerType Provider, req *ChatRequest) (*ChatRequest, map[string]string) {
+	rule, ok := toolNameRules[providerType]
+	if !ok {
+		return req, nil
+	}
+
+	var names []string
+	for _, tool := range req.Tools {
+		names = append(names, tool.Function.Name)
+	}
+	for _, msg := range req.Messages {
+		for _, toolCall := range msg.ToolCalls {
+			names = append(names, toolCall.Function.Name)
+		}
+		for _, content := range msg.Content {
+			if content.ToolCall != nil {
+				names = append(names, content.ToolCall.Function.Name)
+			}
+		}
+	}
+
+	// 先保留所有合法的名称，再为不合法的名称分配不重复的别名
+	used := make(map[string]string)
+	for _, name := range names {
+		if rule.valid(name) {
+			used[name] = name
+		}
+	}
+	aliases := make(map[string]string) // 原名称到别名
+	for _, name := range names {
+		if _, ok := aliases[name]; ok || rule.valid(name) {
+			continue
+		}
+		alias := rule.alias(name, false)
+		if original, taken := used[alias]; taken && original != name {
+			alias = rule.alias(name, true)
+		}
+		used[alias] = name
+		aliases[name] = alias
+	}
+	if len(aliases) == 0 {
+		return req, nil
+	}
+
+	aliased := *req
+	aliased.Tools = make([]Tool, len(req.Tools))
+	for i, tool := range req.Tools {
+		if alias, ok := aliases[tool.Function.Name]; ok {
+			tool.Function.Name = alias
+		}
+		aliased.Tools[i] = tool
+	}
+	aliased.Messages = make([]Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		if alias, ok := aliases[msg.Name]; ok && msg.Role == RoleTool {
+			msg.Name = alias
+		}
+		msg.ToolCalls = renameToolCalls(msg.ToolCalls, aliases)
+		msg.Content = renameContentToolCalls(msg.Content, aliases)
+		aliased.Messages[i] = msg
+	}
+
+	restore := make(map[string]string, len(aliases))
+	for name, alias := range aliases {
+		restore[alias] = name
+	}
+	return &aliased, restore
+}
+
+// restoreToolNames 将回复中工具调用的别名还原为原名称
+func restoreToolNames(resp *ChatResponse, restore map[string]string) {
+	if resp == nil || len(restore) == 0 {
+		return
+	}
+	for i := range resp.Choices {
+		msg := &resp.Choices[i].Message
+		msg.ToolCalls = renameToolCalls(msg.ToolCalls, restore)
+		msg.Content = renameContentToolCalls(msg.Content, restore)
+	}
+}
+
+// restoreChunkToolNames 将流式数据块中工具调用的别名还原为原始名称
+func restoreChunkToolNames(chunk *StreamChunk, restore map[string]string) {
+	for i, toolCall := range chunk.ToolCalls {
+		if name, ok := restore[toolCall.Name]; ok {
+			chunk.ToolCalls[i].Name = name
+		}
+	}
+}
+
+// renameToolCalls 按映射重命名工具调用，有改动时返回新的切片
+func renameToolCalls(toolCalls []ToolCall, names map[string]string) []ToolCall {
+	var renamed []ToolCall
+	for i, toolCall := range toolCalls {
+		name, ok := names[toolCall.Function.Name]
+		if !ok {
+			continue
+		}
+		if renamed == nil {
+			renamed = append([]ToolCall(nil), toolCalls...)
+		}
+		renamed[i].Function.Name = name
+	}
+	if renamed == nil {
+		return toolCalls
+	}
+	return renamed
+}
+
+// renameContentToolCalls 按映射重命名内容中的工具调用，有改动时返回新的切片
+func renameContentToolCalls(contents []Content, names map[string]string) []Content {
+	var renamed []Content
+	for i, content := range contents {
+		if content.ToolCall == nil {
+			continue
+		}
+		name, ok := names[content.ToolCall.Function.Name]
+		if !ok {
+			continue
+		}
+		if renamed == nil {
+			renamed = append([]Content(nil), contents...)
+		}
+		toolCall := *content.ToolCall
+		toolCall.Function.Name = name
+		renamed[i].ToolCall = &toolCall
+	}
+	if renamed == nil {
+		return contents
+	}
+	return renamed
+}
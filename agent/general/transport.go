@@ -0,0 +1,96 @@
+package general
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig HTTP连接池配置，零值字段使用默认值
+type TransportConfig struct {
+	MaxIdleConns          int           // 所有主机的最大空闲连接数，默认200
+	MaxIdleConnsPerHost   int           // 每个主机的最大空闲连接数，默认64（net/http默认只有2，高并发时会频繁新建连接）
+	MaxConnsPerHost       int           // 每个主机的最大连接数，0表示不限制
+	IdleConnTimeout       time.Duration // 空闲连接的保留时间，默认90秒
+	KeepAlive             time.Duration // TCP keep-alive间隔，默认30秒
+	DialTimeout           time.Duration // 建立连接的超时时间，默认30秒
+	TLSHandshakeTimeout   time.Duration // TLS握手的超时时间，默认10秒
+	ResponseHeaderTimeout time.Duration // 等待响应头的超时时间，0表示不限制（模型生成较慢时不宜设置过短）
+	DisableHTTP2          bool          // 禁用HTTP/2，只使用HTTP/1.1
+}
+
+// 连接池的默认配置
+const (
+	defaultMaxIdleConns        = 200
+	defaultMaxIdleConnsPerHost = 64
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultDialTimeout         = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// NewTransport 按配置创建HTTP Transport，默认启用HTTP/2和keep-alive，并提高每个主机的空闲连接数
+func NewTransport(config TransportConfig) *http.Transport {
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = defaultMaxIdleConns
+	}
+	if config.MaxIdleConnsPerHost <= 0 {
+		config.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if config.IdleConnTimeout <= 0 {
+		config.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = defaultKeepAlive
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaultDialTimeout
+	}
+	if config.TLSHandshakeTimeout <= 0 {
+		config.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	dialer := &net.Dialer{Timeout: config.DialTimeout, KeepAlive: config.KeepAlive}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if config.DisableHTTP2 {
+		// 非nil的空TLSNextProto禁用HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
+
+// NewHTTPClient 使用NewTransport创建HTTP客户端，不设置整体超时，流式响应不会被中断，请求超时通过context控制
+func NewHTTPClient(config TransportConfig) *http.Client {
+	return &http.Client{Transport: NewTransport(config)}
+}
+
+// SetHTTPClient 设置之后添加的提供商共享的HTTP客户端，已添加的提供商不受影响
+// 默认所有提供商共享一个使用NewTransport默认配置的客户端；ProviderConfig.HTTPClient可以为单个提供商单独指定
+func (m *AgentManager) SetHTTPClient(client *http.Client) {
+	m.httpClient = client
+}
+
+// HTTPClient 返回提供商共享的HTTP客户端
+func (m *AgentManager) HTTPClient() *http.Client {
+	return m.httpClient
+}
+
+// httpClientFor 返回提供商使用的HTTP客户端
+func (m *AgentManager) httpClientFor(config *ProviderConfig) *http.Client {
+	client := m.httpClient
+	if config.HTTPClient != nil {
+		client = config.HTTPClient
+	}
+	return withSizeLimits(client, config.Provider, config.Limits)
+}
@@ -2,13 +2,17 @@ package google
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/payload"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
 // Config Google配置
@@ -16,8 +20,19 @@ type Config struct {
 	APIKey  string
 	BaseURL string
 	Model   string
+	// Headers 可选，附加到每个请求的HTTP头（如组织ID、网关鉴权），同名时覆盖默认请求头
+	Headers map[string]string
+	// Credentials 可选，每次请求时获取API密钥，设置后优先于APIKey，用于在不重建客户端的情况下轮换密钥
+	Credentials func(ctx context.Context) (string, error)
+	// HTTPClient 可选，发送请求使用的HTTP客户端，多个客户端共享同一个时可以复用连接池，为nil时使用新建的默认客户端
+	HTTPClient *http.Client
+	// Retry 可选，限流、服务端错误和网络错误时的重试策略，为nil时不重试
+	Retry *RetryPolicy
 }
 
+// RetryPolicy HTTP请求的重试策略，退避时间翻倍并遵守Retry-After
+type RetryPolicy = retry.Policy
+
 // Client Google客户端
 type Client struct {
 	config     *Config
@@ -33,9 +48,13 @@ func NewClient(config *Config) *Client {
 		config.Model = "gemini-2.5-flash"
 	}
 
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
 		config:     config,
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 	}
 }
 
@@ -44,23 +63,42 @@ func (c *Client) GetProvider() string {
 	return "google"
 }
 
+// applyHeaders 设置配置中的自定义请求头
+func (c *Client) applyHeaders(httpReq *http.Request) {
+	for key, value := range c.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
+
+// do 按重试策略发送请求
+func (c *Client) do(httpReq *http.Request) (*http.Response, error) {
+	return c.config.Retry.Do(c.httpClient, httpReq)
+}
+
 // ValidateRequest 验证请求参数
-func (c *Client) ValidateRequest(req interface{}) error {
+func (c *Client) ValidateRequest(req *unified.ChatRequest) error {
 	// 可以添加特定的验证逻辑
 	return nil
 }
 
 // Chat 发送聊天请求
-func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error) {
+func (c *Client) Chat(ctx context.Context, req *unified.ChatRequest) (_ *unified.ChatResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	googleReq, err := ToGoogleRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to google request failed: %w", err)
 	}
 
-	reqBody, err := json.Marshal(googleReq)
+	reqBody, err := payload.JSON(googleReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 
 	// 检查是否是代理地址
 	var url string
@@ -69,21 +107,23 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 		url = fmt.Sprintf("%s/v1beta/models/%s:generateContent", c.config.BaseURL, c.config.Model)
 	} else {
 		// 官方Google API路径
-		url = fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.config.BaseURL, c.config.Model, c.config.APIKey)
+		url = fmt.Sprintf("%s/models/%s:generateContent?key=%s", c.config.BaseURL, c.config.Model, apiKey)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	// 如果是代理地址，设置Authorization header
 	if strings.Contains(c.config.BaseURL, "openai-proxy.org") {
-		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	}
+	c.applyHeaders(httpReq)
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -91,50 +131,68 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
+
+	var googleResp GoogleGenerateContentResponse
+	if !googleReq.IncludeRawResponse {
+		// 不需要原始响应时直接从响应体流式解码，不缓存整个响应
+		if err := payload.DecodeJSON(resp.Body, &googleResp); err != nil {
+			return nil, fmt.Errorf("decode response failed: %w", err)
+		}
+		return FromGoogleResponse(&googleResp), nil
+	}
+
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read response body failed: %w", err)
 	}
-
-	var googleResp GoogleGenerateContentResponse
 	if err := json.Unmarshal(bodyBytes, &googleResp); err != nil {
 		return nil, fmt.Errorf("decode response failed: %w", err)
 	}
-
-	return FromGoogleResponse(&googleResp), nil
+	commonResp := FromGoogleResponse(&googleResp)
+	commonResp.RawResponse = bodyBytes
+	return commonResp, nil
 }
 
 // ChatStream 发送流式聊天请求
-func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interface{}, error) {
+func (c *Client) ChatStream(ctx context.Context, req *unified.ChatRequest) (_ <-chan GoogleStreamResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	googleReq, err := ToGoogleRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to google request failed: %w", err)
 	}
 
-	reqBody, err := json.Marshal(googleReq)
+	reqBody, err := payload.JSON(googleReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 
-	// 检查是否是代理地址
+	// 检查是否是代理地址，alt=sse让每个分片作为一条SSE事件返回，否则返回的是跨多行的JSON数组
 	var url string
 	if strings.Contains(c.config.BaseURL, "openai-proxy.org") {
 		// 代理服务器使用REST协议
-		url = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent", c.config.BaseURL, c.config.Model)
+		url = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", c.config.BaseURL, c.config.Model)
 	} else {
 		// 官方Google API路径
-		url = fmt.Sprintf("%s/models/%s:streamGenerateContent?key=%s", c.config.BaseURL, c.config.Model, c.config.APIKey)
+		url = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse&key=%s", c.config.BaseURL, c.config.Model, apiKey)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	c.applyHeaders(httpReq)
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -142,10 +200,10 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 
-	ch := make(chan interface{}, 10)
+	ch := make(chan GoogleStreamResponse, 10)
 
 	go func() {
 		defer resp.Body.Close()
@@ -153,8 +211,8 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 
 		scanner := bufio.NewScanner(resp.Body)
 		for scanner.Scan() {
-			line := scanner.Text()
-			line = strings.TrimSpace(line)
+			line := strings.TrimSpace(scanner.Text())
+			line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 
 			if line == "" || !strings.HasPrefix(line, "{") {
 				continue
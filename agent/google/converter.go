@@ -3,103 +3,67 @@ package google
 import (
 	"encoding/json"
 	"fmt"
+	"mime"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
-)
-
-// ToGoogleRequest 将统一请求转换为Google请求
-func ToGoogleRequest(req interface{}) (*GoogleGenerateContentRequest, error) {
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
-	}
-
-	var commonReq struct {
-		Model    string `json:"model"`
-		Messages []struct {
-			Role    string `json:"role"`
-			Content []struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ImageURL *struct {
-					URL    string `json:"url"`
-					Detail string `json:"detail,omitempty"`
-				} `json:"image_url,omitempty"`
-				ToolCall *struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-				ToolID string `json:"tool_id,omitempty"`
-			} `json:"content"`
-			Name      string `json:"name,omitempty"`
-			ToolCalls []struct {
-				ID       string `json:"id"`
-				Type     string `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			} `json:"tool_calls,omitempty"`
-		} `json:"messages"`
-		Tools []struct {
-			Type     string `json:"type"`
-			Function struct {
-				Name        string                 `json:"name"`
-				Description string                 `json:"description"`
-				Parameters  map[string]interface{} `json:"parameters"`
-			} `json:"function"`
-		} `json:"tools,omitempty"`
-		MaxTokens    int     `json:"max_tokens,omitempty"`
-		Temperature  float64 `json:"temperature,omitempty"`
-		Stream       bool    `json:"stream,omitempty"`
-		SystemPrompt string  `json:"system_prompt,omitempty"`
-	}
 
-	if err := json.Unmarshal(reqBytes, &commonReq); err != nil {
-		return nil, fmt.Errorf("unmarshal to common request failed: %w", err)
-	}
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
+)
 
+// ToGoogleRequest 将统一请求转换为Google请求，不修改req
+func ToGoogleRequest(req *unified.ChatRequest) (*GoogleGenerateContentRequest, error) {
 	googleReq := &GoogleGenerateContentRequest{}
 
 	// 构建工具调用ID到函数名的映射，用于后面的函数响应
 	toolCallMap := make(map[string]string)
 
 	// 设置系统指令
-	if commonReq.SystemPrompt != "" {
+	if req.SystemPrompt != "" {
 		googleReq.SystemInstruction = &GoogleContent{
 			Role: "system",
 			Parts: []GooglePart{
-				{Text: commonReq.SystemPrompt},
+				{Text: req.SystemPrompt},
 			},
 		}
 	}
 
 	// 设置生成配置
-	if commonReq.Temperature != 0 || commonReq.MaxTokens != 0 {
-		googleReq.GenerationConfig = &GoogleGenerationConfig{}
-		if commonReq.Temperature != 0 {
-			googleReq.GenerationConfig.Temperature = &commonReq.Temperature
+	if req.HasTemperature() || req.MaxTokens != 0 || req.TopP != nil {
+		googleReq.GenerationConfig = &GoogleGenerationConfig{TopP: req.TopP}
+		if req.HasTemperature() {
+			temperature := req.Temperature
+			googleReq.GenerationConfig.Temperature = &temperature
 		}
-		if commonReq.MaxTokens != 0 {
-			googleReq.GenerationConfig.MaxOutputTokens = &commonReq.MaxTokens
+		if req.MaxTokens != 0 {
+			maxTokens := req.MaxTokens
+			googleReq.GenerationConfig.MaxOutputTokens = &maxTokens
+		}
+	}
+
+	// 结构化输出
+	if format := req.ResponseFormat; format != nil && (format.Type == "json_object" || format.Type == "json_schema") {
+		if googleReq.GenerationConfig == nil {
+			googleReq.GenerationConfig = &GoogleGenerationConfig{}
+		}
+		googleReq.GenerationConfig.ResponseMimeType = "application/json"
+		if format.Type == "json_schema" {
+			googleReq.GenerationConfig.ResponseJSONSchema = format.Schema
 		}
 	}
 
 	// 首先遍历所有消息，构建工具调用映射
-	for _, msg := range commonReq.Messages {
+	for _, msg := range req.Messages {
 		for _, toolCall := range msg.ToolCalls {
 			toolCallMap[toolCall.ID] = toolCall.Function.Name
 		}
 	}
 
 	// 转换消息
-	for _, msg := range commonReq.Messages {
+	for _, msg := range req.Messages {
 		// Google API中用户角色是"user"，助手角色是"model"
-		role := msg.Role
+		role := string(msg.Role)
 		if role == "assistant" {
 			role = "model"
 		} else if role == "system" {
@@ -131,6 +95,23 @@ func ToGoogleRequest(req interface{}) (*GoogleGenerateContentRequest, error) {
 							},
 						})
 					}
+				} else if content.ImageURL != nil && content.ImageURL.URL != "" {
+					// 远程图片通过fileUri引用
+					googleContent.Parts = append(googleContent.Parts, GooglePart{
+						FileData: &GoogleFileData{
+							MimeType: imageMimeTypeFromURL(content.ImageURL.URL),
+							FileURI:  content.ImageURL.URL,
+						},
+					})
+				}
+			case "document":
+				if content.Document != nil {
+					googleContent.Parts = append(googleContent.Parts, GooglePart{
+						InlineData: &GoogleInlineData{
+							MimeType: content.Document.MimeType,
+							Data:     content.Document.Data,
+						},
+					})
 				}
 			case "image_base64":
 				if content.ImageURL != nil {
@@ -208,70 +189,40 @@ func ToGoogleRequest(req interface{}) (*GoogleGenerateContentRequest, error) {
 	}
 
 	// 转换工具定义
-	if len(commonReq.Tools) > 0 {
+	if len(req.Tools) > 0 {
 		tool := GoogleTool{}
-		for _, t := range commonReq.Tools {
+		for _, t := range req.Tools {
 			tool.FunctionDeclarations = append(tool.FunctionDeclarations, GoogleFunctionDeclaration{
 				Name:        t.Function.Name,
 				Description: t.Function.Description,
-				Parameters:  t.Function.Parameters,
+				Parameters:  sanitizeSchema(t.Function.Parameters),
 			})
 		}
 		googleReq.Tools = append(googleReq.Tools, tool)
 	}
 
+	googleReq.IncludeRawResponse = req.IncludeRawResponse
+	googleReq.ProviderOptions = req.ProviderOptions["google"]
+
 	return googleReq, nil
 }
 
+// toolCallSeq 区分同一时刻开始的响应
+var toolCallSeq atomic.Uint64
+
+// ToolCallIDPrefix 生成一次响应中工具调用ID的前缀，Google不返回工具调用ID，同一响应中的调用在前缀后加序号区分
+func ToolCallIDPrefix() string {
+	return fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), toolCallSeq.Add(1))
+}
+
 // FromGoogleResponse 将Google响应转换为统一响应
-func FromGoogleResponse(resp *GoogleGenerateContentResponse) interface{} {
-	commonResp := struct {
-		ID      string    `json:"id"`
-		Object  string    `json:"object"`
-		Created time.Time `json:"created"`
-		Model   string    `json:"model"`
-		Choices []struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role    string `json:"role"`
-				Content []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string `json:"id"`
-						Type     string `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
-	}{
+func FromGoogleResponse(resp *GoogleGenerateContentResponse) *unified.ChatResponse {
+	commonResp := &unified.ChatResponse{
 		ID:      fmt.Sprintf("google-%d", time.Now().Unix()),
 		Object:  "chat.completion",
 		Created: time.Now(),
 		Model:   "gemini", // 默认模型名
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: unified.Usage{
 			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
 			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
 			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
@@ -279,119 +230,44 @@ func FromGoogleResponse(resp *GoogleGenerateContentResponse) interface{} {
 	}
 
 	// 转换候选响应
+	idPrefix := ToolCallIDPrefix()
 	for _, candidate := range resp.Candidates {
-		choice := struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role    string `json:"role"`
-				Content []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string `json:"id"`
-						Type     string `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		}{
+		choice := unified.Choice{
 			Index:        candidate.Index,
 			FinishReason: candidate.FinishReason,
 		}
 
 		// Google的model角色转换为assistant
-		choice.Message.Role = "assistant"
+		choice.Message.Role = unified.RoleAssistant
 
 		// 处理内容部分
+		toolCalls := 0
 		for _, part := range candidate.Content.Parts {
 			if part.Text != "" {
-				choice.Message.Content = append(choice.Message.Content, struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string `json:"id"`
-						Type     string `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				}{
-					Type: "text",
+				choice.Message.Content = append(choice.Message.Content, unified.Content{
+					Type: unified.ContentTypeText,
 					Text: part.Text,
 				})
 			}
 
 			if part.FunctionCall != nil {
-				// 生成工具调用ID
-				toolCallID := fmt.Sprintf("call_%d", time.Now().UnixNano())
-
 				argsBytes, _ := json.Marshal(part.FunctionCall.Args)
 
-				// 添加到工具调用列表
-				choice.Message.ToolCalls = append(choice.Message.ToolCalls, struct {
-					ID       string `json:"id"`
-					Type     string `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				}{
-					ID:   toolCallID,
+				// 生成工具调用ID，添加到工具调用列表，同时添加到内容中
+				call := unified.ToolCall{
+					ID:   fmt.Sprintf("%s_%d", idPrefix, toolCalls),
 					Type: "function",
-					Function: struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					}{
+					Function: unified.FunctionCall{
 						Name:      part.FunctionCall.Name,
 						Arguments: argsBytes,
 					},
-				})
-
-				// 同时添加到内容中
-				choice.Message.Content = append(choice.Message.Content, struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string `json:"id"`
-						Type     string `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				}{
-					Type: "tool_call",
-					ToolCall: &struct {
-						ID       string `json:"id"`
-						Type     string `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					}{
-						ID:   toolCallID,
-						Type: "function",
-						Function: struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						}{
-							Name:      part.FunctionCall.Name,
-							Arguments: argsBytes,
-						},
-					},
+				}
+				toolCalls++
+				choice.Message.ToolCalls = append(choice.Message.ToolCalls, call)
+				contentCall := call
+				choice.Message.Content = append(choice.Message.Content, unified.Content{
+					Type:     unified.ContentTypeTool,
+					ToolCall: &contentCall,
 				})
 			}
 		}
@@ -401,3 +277,14 @@ func FromGoogleResponse(resp *GoogleGenerateContentResponse) interface{} {
 
 	return commonResp
 }
+
+// imageMimeTypeFromURL 根据URL的扩展名推断图片MIME类型，无法识别时默认为image/jpeg
+func imageMimeTypeFromURL(url string) string {
+	if idx := strings.IndexAny(url, "?#"); idx >= 0 {
+		url = url[:idx]
+	}
+	if mimeType := mime.TypeByExtension(path.Ext(url)); strings.HasPrefix(mimeType, "image/") {
+		return mimeType
+	}
+	return "image/jpeg"
+}
@@ -0,0 +1,103 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+)
+
+// GoogleModel Google模型列表中的模型
+type GoogleModel struct {
+	Name                       string   `json:"name"` // 格式为 models/{model}
+	BaseModelID                string   `json:"baseModelId,omitempty"`
+	Version                    string   `json:"version,omitempty"`
+	DisplayName                string   `json:"displayName,omitempty"`
+	Description                string   `json:"description,omitempty"`
+	InputTokenLimit            int      `json:"inputTokenLimit,omitempty"`
+	OutputTokenLimit           int      `json:"outputTokenLimit,omitempty"`
+	SupportedGenerationMethods []string `json:"supportedGenerationMethods,omitempty"`
+}
+
+// ID 返回去掉 models/ 前缀的模型名称，与请求中使用的模型名称一致
+func (m GoogleModel) ID() string {
+	return strings.TrimPrefix(m.Name, "models/")
+}
+
+// GoogleModelList Google模型列表响应（分页）
+type GoogleModelList struct {
+	Models        []GoogleModel `json:"models"`
+	NextPageToken string        `json:"nextPageToken,omitempty"`
+}
+
+// ListModels 列出当前API密钥可用的模型，自动翻页
+func (c *Client) ListModels(ctx context.Context) (_ []GoogleModel, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	// 代理地址使用Authorization header，官方API使用key参数
+	proxy := strings.Contains(c.config.BaseURL, "openai-proxy.org")
+	endpoint := c.config.BaseURL + "/models"
+	if proxy {
+		endpoint = c.config.BaseURL + "/v1beta/models"
+	}
+
+	var models []GoogleModel
+	pageToken := ""
+	for {
+		query := url.Values{"pageSize": {"1000"}}
+		if !proxy {
+			query.Set("key", apiKey)
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("create http request failed: %w", err)
+		}
+
+		if proxy {
+			httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		c.applyHeaders(httpReq)
+
+		page, err := c.listModelsPage(httpReq)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, page.Models...)
+		if page.NextPageToken == "" {
+			return models, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// listModelsPage 请求一页模型列表
+func (c *Client) listModelsPage(httpReq *http.Request) (*GoogleModelList, error) {
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var page GoogleModelList
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decode response failed: %w", err)
+	}
+	return &page, nil
+}
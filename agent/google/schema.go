@@ -0,0 +1,273 @@
+package google
+
+// geminiSchemaKeys Gemini函数参数Schema（OpenAPI 3.0子集）支持的关键字
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true,
+	"enum": true, "items": true, "minItems": true, "maxItems": true,
+	"properties": true, "required": true, "minProperties": true, "maxProperties": true,
+	"minLength": true, "maxLength": true, "pattern": true, "example": true,
+	"anyOf": true, "propertyOrdering": true, "default": true, "minimum": true, "maximum": true,
+}
+
+// maxSchemaRefDepth 展开$ref的最大深度，超过后用不带约束的对象代替，避免递归Schema无限展开
+const maxSchemaRefDepth = 8
+
+// sanitizeSchema 将JSON Schema转换为Gemini接受的形式，返回新的Schema，不修改原Schema
+// MCP服务器常用的$schema、additionalProperties、const、oneOf、allOf、$ref等关键字Gemini会拒绝：
+// $ref在本地$defs/definitions中展开，oneOf改为anyOf，allOf合并，const改为单值enum，
+// ["string", "null"]形式的type改为type加nullable，其他不支持的关键字直接删除
+// 没有属性的参数对象返回nil，函数声明中不发送parameters
+func sanitizeSchema(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	defs := map[string]interface{}{}
+	for _, key := range []string{"definitions", "$defs"} {
+		if values, ok := schema[key].(map[string]interface{}); ok {
+			for name, value := range values {
+				defs[name] = value
+			}
+		}
+	}
+	result := sanitizeSchemaNode(schema, defs, 0)
+	if properties, ok := result["properties"].(map[string]interface{}); !ok || len(properties) == 0 {
+		return nil
+	}
+	return result
+}
+
+// sanitizeSchemaNode 转换一个Schema节点
+func sanitizeSchemaNode(schema map[string]interface{}, defs map[string]interface{}, depth int) map[string]interface{} {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved := resolveSchemaRef(ref, defs)
+		if resolved == nil || depth >= maxSchemaRefDepth {
+			return map[string]interface{}{"type": "object"}
+		}
+		merged := make(map[string]interface{}, len(resolved)+len(schema))
+		for key, value := range resolved {
+			merged[key] = value
+		}
+		for key, value := range schema {
+			if key != "$ref" {
+				merged[key] = value
+			}
+		}
+		return sanitizeSchemaNode(merged, defs, depth+1)
+	}
+
+	// allOf合并到当前节点
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		merged := make(map[string]interface{}, len(schema))
+		for key, value := range schema {
+			if key != "allOf" {
+				merged[key] = value
+			}
+		}
+		for _, item := range allOf {
+			if sub, ok := item.(map[string]interface{}); ok {
+				mergeSchema(merged, sanitizeSchemaNode(sub, defs, depth))
+			}
+		}
+		schema = merged
+	}
+
+	result := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		switch key {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				result["type"] = t
+			case []interface{}:
+				for _, item := range t {
+					if item == "null" {
+						result["nullable"] = true
+					} else if name, ok := item.(string); ok && result["type"] == nil {
+						result["type"] = name
+					}
+				}
+			case []string:
+				for _, name := range t {
+					if name == "null" {
+						result["nullable"] = true
+					} else if result["type"] == nil {
+						result["type"] = name
+					}
+				}
+			}
+		case "const":
+			// Gemini只接受字符串枚举
+			if s, ok := value.(string); ok {
+				result["enum"] = []interface{}{s}
+			}
+		case "oneOf", "anyOf":
+			list, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			var variants []interface{}
+			for _, item := range list {
+				sub, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				// {"type": "null"}分支改为nullable
+				if sub["type"] == "null" && len(sub) == 1 {
+					result["nullable"] = true
+					continue
+				}
+				variants = append(variants, sanitizeSchemaNode(sub, defs, depth))
+			}
+			// 只有枚举值的分支（如oneOf中的多个const）合并为一个字符串枚举
+			if enum, ok := mergeEnumVariants(variants); ok {
+				result["type"] = "string"
+				result["enum"] = enum
+				continue
+			}
+			if len(variants) == 1 {
+				for subKey, subValue := range variants[0].(map[string]interface{}) {
+					if _, exists := result[subKey]; !exists {
+						result[subKey] = subValue
+					}
+				}
+			} else if len(variants) > 1 {
+				result["anyOf"] = variants
+			}
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			sanitized := make(map[string]interface{}, len(properties))
+			for name, property := range properties {
+				if sub, ok := property.(map[string]interface{}); ok {
+					sanitized[name] = sanitizeSchemaNode(sub, defs, depth)
+				}
+			}
+			result["properties"] = sanitized
+		case "items":
+			if sub, ok := value.(map[string]interface{}); ok {
+				result["items"] = sanitizeSchemaNode(sub, defs, depth)
+			}
+		case "enum":
+			// Gemini只接受字符串枚举
+			if values, ok := value.([]interface{}); ok {
+				enum := make([]interface{}, 0, len(values))
+				for _, item := range values {
+					if s, ok := item.(string); ok {
+						enum = append(enum, s)
+					}
+				}
+				if len(enum) == len(values) {
+					result["enum"] = enum
+				}
+			} else if _, ok := value.([]string); ok {
+				result["enum"] = value
+			}
+		default:
+			if geminiSchemaKeys[key] {
+				result[key] = value
+			}
+		}
+	}
+
+	if _, ok := result["enum"]; ok && result["type"] != nil && result["type"] != "string" {
+		delete(result, "enum")
+	}
+	// required中只保留存在的属性，合并allOf后可能有重复
+	if required, ok := result["required"]; ok {
+		properties, _ := result["properties"].(map[string]interface{})
+		var names []interface{}
+		seen := make(map[string]bool)
+		for _, name := range schemaNames(required) {
+			if _, exists := properties[name]; exists && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			result["required"] = names
+		} else {
+			delete(result, "required")
+		}
+	}
+	return result
+}
+
+// mergeEnumVariants 所有分支都只有字符串枚举时返回合并后的枚举值
+func mergeEnumVariants(variants []interface{}) ([]interface{}, bool) {
+	if len(variants) < 2 {
+		return nil, false
+	}
+	var enum []interface{}
+	for _, variant := range variants {
+		sub := variant.(map[string]interface{})
+		values, ok := sub["enum"].([]interface{})
+		if !ok || (len(sub) != 1 && !(len(sub) == 2 && sub["type"] == "string")) {
+			return nil, false
+		}
+		enum = append(enum, values...)
+	}
+	return enum, true
+}
+
+// resolveSchemaRef 在本地定义中查找#/$defs/name或#/definitions/name
+func resolveSchemaRef(ref string, defs map[string]interface{}) map[string]interface{} {
+	for _, prefix := range []string{"#/$defs/", "#/definitions/"} {
+		if len(ref) > len(prefix) && ref[:len(prefix)] == prefix {
+			resolved, _ := defs[ref[len(prefix):]].(map[string]interface{})
+			return resolved
+		}
+	}
+	return nil
+}
+
+// mergeSchema 将src合并到dst，properties和required取并集，其他关键字dst中已有时保留dst的值
+func mergeSchema(dst, src map[string]interface{}) {
+	for key, value := range src {
+		switch key {
+		case "properties":
+			properties, _ := dst["properties"].(map[string]interface{})
+			merged := make(map[string]interface{}, len(properties))
+			for name, property := range properties {
+				merged[name] = property
+			}
+			if srcProperties, ok := value.(map[string]interface{}); ok {
+				for name, property := range srcProperties {
+					merged[name] = property
+				}
+			}
+			dst["properties"] = merged
+		case "required":
+			var names []interface{}
+			for _, name := range schemaNames(dst["required"]) {
+				names = append(names, name)
+			}
+			for _, name := range schemaNames(value) {
+				names = append(names, name)
+			}
+			dst["required"] = names
+		default:
+			if _, exists := dst[key]; !exists {
+				dst[key] = value
+			}
+		}
+	}
+}
+
+// schemaNames 读取字符串列表，兼容[]string和[]interface{}
+func schemaNames(value interface{}) []string {
+	switch names := value.(type) {
+	case []string:
+		return names
+	case []interface{}:
+		result := make([]string, 0, len(names))
+		for _, item := range names {
+			if name, ok := item.(string); ok {
+				result = append(result, name)
+			}
+		}
+		return result
+	}
+	return nil
+}
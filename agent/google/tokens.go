@@ -0,0 +1,89 @@
+package google
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
+)
+
+// GoogleCountTokensRequest Google token计数请求，包装完整的生成请求以计入系统指令和工具
+type GoogleCountTokensRequest struct {
+	GenerateContentRequest json.RawMessage `json:"generateContentRequest"`
+}
+
+// GoogleCountTokensResponse Google token计数响应
+type GoogleCountTokensResponse struct {
+	TotalTokens             int `json:"totalTokens"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+}
+
+// CountTokens 调用服务端接口计算请求的输入token数，不会生成回复也不计费
+func (c *Client) CountTokens(ctx context.Context, req *unified.ChatRequest) (_ int, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
+	googleReq, err := ToGoogleRequest(req)
+	if err != nil {
+		return 0, fmt.Errorf("convert to google request failed: %w", err)
+	}
+
+	generateReq, err := json.Marshal(googleReq)
+	if err != nil {
+		return 0, fmt.Errorf("marshal request failed: %w", err)
+	}
+	// generateContentRequest中必须指定模型
+	generateReq, err = mergeProviderOptions(generateReq, map[string]interface{}{"model": "models/" + c.config.Model})
+	if err != nil {
+		return 0, fmt.Errorf("marshal request failed: %w", err)
+	}
+	reqBody, err := json.Marshal(GoogleCountTokensRequest{GenerateContentRequest: generateReq})
+	if err != nil {
+		return 0, fmt.Errorf("marshal request failed: %w", err)
+	}
+
+	// 代理地址使用Authorization header，官方API使用key参数
+	proxy := strings.Contains(c.config.BaseURL, "openai-proxy.org")
+	var url string
+	if proxy {
+		url = fmt.Sprintf("%s/v1beta/models/%s:countTokens", c.config.BaseURL, c.config.Model)
+	} else {
+		url = fmt.Sprintf("%s/models/%s:countTokens?key=%s", c.config.BaseURL, c.config.Model, apiKey)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, fmt.Errorf("create http request failed: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if proxy {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	c.applyHeaders(httpReq)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var countResp GoogleCountTokensResponse
+	if err := json.NewDecoder(resp.Body).Decode(&countResp); err != nil {
+		return 0, fmt.Errorf("decode response failed: %w", err)
+	}
+	return countResp.TotalTokens, nil
+}
@@ -1,5 +1,11 @@
 package google
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
 // GoogleContent Google的内容结构
 type GoogleContent struct {
 	Role  string       `json:"role"`
@@ -10,6 +16,7 @@ type GoogleContent struct {
 type GooglePart struct {
 	Text             string                  `json:"text,omitempty"`
 	InlineData       *GoogleInlineData       `json:"inlineData,omitempty"`
+	FileData         *GoogleFileData         `json:"fileData,omitempty"`
 	FunctionCall     *GoogleFunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse *GoogleFunctionResponse `json:"functionResponse,omitempty"`
 }
@@ -20,6 +27,12 @@ type GoogleInlineData struct {
 	Data     string `json:"data"` // base64 encoded
 }
 
+// GoogleFileData Google的文件引用结构(用于通过URI引用的图片)
+type GoogleFileData struct {
+	MimeType string `json:"mimeType"`
+	FileURI  string `json:"fileUri"`
+}
+
 // GoogleFunctionCall Google的函数调用结构
 type GoogleFunctionCall struct {
 	Name string                 `json:"name"`
@@ -41,13 +54,17 @@ type GoogleTool struct {
 type GoogleFunctionDeclaration struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
-	Parameters  map[string]interface{} `json:"parameters"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
 }
 
 // GoogleGenerationConfig 生成配置结构
 type GoogleGenerationConfig struct {
 	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
 	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+
+	ResponseMimeType   string                 `json:"responseMimeType,omitempty"`   // 结构化输出时为application/json
+	ResponseJSONSchema map[string]interface{} `json:"responseJsonSchema,omitempty"` // 输出需要符合的JSON Schema
 }
 
 // GoogleGenerateContentRequest Google的内容生成请求结构
@@ -56,6 +73,71 @@ type GoogleGenerateContentRequest struct {
 	Tools             []GoogleTool            `json:"tools,omitempty"`
 	SystemInstruction *GoogleContent          `json:"systemInstruction,omitempty"`
 	GenerationConfig  *GoogleGenerationConfig `json:"generationConfig,omitempty"`
+
+	// IncludeRawResponse 是否在响应中保留提供商返回的原始JSON，不参与序列化
+	IncludeRawResponse bool `json:"-"`
+
+	// ProviderOptions 提供商特有的请求参数，序列化时深度合并到请求体中，优先级高于已建模的字段
+	ProviderOptions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON 序列化请求，并将ProviderOptions中的字段合并到请求体中
+func (r GoogleGenerateContentRequest) MarshalJSON() ([]byte, error) {
+	type alias GoogleGenerateContentRequest
+	data, err := json.Marshal(alias(r))
+	if err != nil {
+		return nil, err
+	}
+	return mergeProviderOptions(data, r.ProviderOptions)
+}
+
+// mergeProviderOptions 将ProviderOptions深度合并到序列化后的请求体中
+// 同名字段以ProviderOptions为准，两边都是对象时合并子字段，值为nil时删除该字段
+func mergeProviderOptions(data []byte, options map[string]interface{}) ([]byte, error) {
+	if len(options) == 0 {
+		return data, nil
+	}
+
+	var body map[string]interface{}
+	if err := decodeJSONObject(data, &body); err != nil {
+		return nil, err
+	}
+	// 先序列化一次，使结构体等类型的值统一为map，便于深度合并
+	optionBytes, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provider options failed: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := decodeJSONObject(optionBytes, &normalized); err != nil {
+		return nil, err
+	}
+
+	mergeJSONObject(body, normalized)
+	return json.Marshal(body)
+}
+
+// mergeJSONObject 递归合并JSON对象
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			mergeJSONObject(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decodeJSONObject 解析JSON对象，数字保留为json.Number以免大整数丢失精度
+func decodeJSONObject(data []byte, v *map[string]interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
 }
 
 // GoogleUsageMetadata Google的使用统计结构
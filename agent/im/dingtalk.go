@@ -0,0 +1,160 @@
+package im
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dingTalkMaxSkew 回调时间戳与本地时间允许的最大差距。签名不覆盖请求体，
+// 捕获的签名在此窗口内可被重放，按钉钉文档限制为几分钟
+const dingTalkMaxSkew = 5 * time.Minute
+
+// dingTalkWebhookHosts 允许的sessionWebhook域名，防止伪造回调把回复发往任意地址
+var dingTalkWebhookHosts = map[string]bool{
+	"oapi.dingtalk.com": true,
+	"api.dingtalk.com":  true,
+}
+
+// DingTalkConfig 钉钉企业内部机器人的配置
+type DingTalkConfig struct {
+	AppSecret  string       // 机器人的AppSecret，用于校验回调签名
+	AtSender   bool         // 群聊中回复时@提问的用户
+	HTTPClient *http.Client // 为nil时使用http.DefaultClient
+}
+
+// DingTalk 钉钉适配器，接收机器人的HTTP回调，通过回调中的sessionWebhook回复
+type DingTalk struct {
+	config DingTalkConfig
+}
+
+// NewDingTalk 创建钉钉适配器
+func NewDingTalk(config DingTalkConfig) (*DingTalk, error) {
+	if config.AppSecret == "" {
+		return nil, fmt.Errorf("钉钉的AppSecret不能为空")
+	}
+	return &DingTalk{config: config}, nil
+}
+
+// Name 平台名称
+func (d *DingTalk) Name() string {
+	return "dingtalk"
+}
+
+// Parse 校验签名并解析机器人回调
+func (d *DingTalk) Parse(r *http.Request, body []byte) (*Callback, error) {
+	timestamp := r.Header.Get("timestamp")
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("缺少时间戳")
+	}
+	if skew := time.Since(time.UnixMilli(millis)); skew > dingTalkMaxSkew || skew < -dingTalkMaxSkew {
+		return nil, fmt.Errorf("时间戳过期")
+	}
+	if subtle.ConstantTimeCompare([]byte(d.sign(timestamp)), []byte(r.Header.Get("sign"))) != 1 {
+		return nil, fmt.Errorf("签名错误")
+	}
+
+	var callback struct {
+		MsgID   string `json:"msgId"`
+		MsgType string `json:"msgtype"`
+		Text    struct {
+			Content string `json:"content"`
+		} `json:"text"`
+		ConversationID   string `json:"conversationId"`
+		ConversationType string `json:"conversationType"`
+		SenderStaffID    string `json:"senderStaffId"`
+		SenderID         string `json:"senderId"`
+		SenderNick       string `json:"senderNick"`
+		SessionWebhook   string `json:"sessionWebhook"`
+	}
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, fmt.Errorf("解析回调失败: %w", err)
+	}
+	if callback.MsgType != "text" || callback.SessionWebhook == "" {
+		return &Callback{}, nil
+	}
+	if err := checkDingTalkWebhook(callback.SessionWebhook); err != nil {
+		return nil, err
+	}
+	userID := callback.SenderStaffID
+	if userID == "" {
+		userID = callback.SenderID
+	}
+	return &Callback{Message: &Incoming{
+		MessageID:      callback.MsgID,
+		ConversationID: callback.ConversationID,
+		Group:          callback.ConversationType == "2",
+		UserID:         userID,
+		UserName:       callback.SenderNick,
+		Text:           strings.TrimSpace(callback.Text.Content),
+		replyTarget:    callback.SessionWebhook,
+	}}, nil
+}
+
+// Reply 以文本回复到会话
+func (d *DingTalk) Reply(ctx context.Context, msg *Incoming, text string) error {
+	body := map[string]interface{}{"msgtype": "text", "text": map[string]string{"content": text}}
+	if d.config.AtSender && msg.Group && msg.UserID != "" {
+		body["at"] = map[string]interface{}{"atUserIds": []string{msg.UserID}}
+	}
+	return d.send(ctx, msg, body)
+}
+
+// SendCard 以Markdown消息发送卡片
+func (d *DingTalk) SendCard(ctx context.Context, msg *Incoming, card Card) error {
+	text := "#### " + card.Title
+	if card.Text != "" {
+		text += "\n\n" + card.Text
+	}
+	return d.send(ctx, msg, map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": card.Title, "text": text},
+	})
+}
+
+// send 向回调中的sessionWebhook发送消息
+func (d *DingTalk) send(ctx context.Context, msg *Incoming, body interface{}) error {
+	if msg.replyTarget == "" {
+		return fmt.Errorf("消息没有sessionWebhook")
+	}
+	if err := checkDingTalkWebhook(msg.replyTarget); err != nil {
+		return err
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postJSON(ctx, d.config.HTTPClient, msg.replyTarget, nil, body, &result); err != nil {
+		return fmt.Errorf("钉钉发送消息失败: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("钉钉发送消息失败 (%d): %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// sign 回调签名：以AppSecret为密钥对"时间戳\nAppSecret"做HMAC-SHA256后Base64编码
+func (d *DingTalk) sign(timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(d.config.AppSecret))
+	mac.Write([]byte(timestamp + "\n" + d.config.AppSecret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkDingTalkWebhook 要求sessionWebhook为钉钉域名下的https地址
+func checkDingTalkWebhook(webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil || u.Scheme != "https" || u.User != nil || !dingTalkWebhookHosts[strings.ToLower(u.Hostname())] || (u.Port() != "" && u.Port() != "443") {
+		return fmt.Errorf("sessionWebhook不是钉钉地址")
+	}
+	return nil
+}
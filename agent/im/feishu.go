@@ -0,0 +1,241 @@
+package im
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeishuConfig 飞书（Lark）自建应用机器人的配置
+type FeishuConfig struct {
+	AppID             string
+	AppSecret         string
+	VerificationToken string       // 事件订阅的Verification Token，设置时校验回调中的token
+	EncryptKey        string       // 事件订阅的Encrypt Key，设置时解密回调并要求签名，与VerificationToken至少设置一个
+	BaseURL           string       // 开放平台地址，默认https://open.feishu.cn，Lark为https://open.larksuite.com
+	HTTPClient        *http.Client // 为nil时使用http.DefaultClient
+}
+
+// Feishu 飞书适配器，接收im.message.receive_v1事件，通过消息回复接口回复原消息
+type Feishu struct {
+	config FeishuConfig
+	token  accessToken
+}
+
+// feishuMaxSkew 回调时间戳与本地时间允许的最大差距
+const feishuMaxSkew = 5 * time.Minute
+
+// feishuMention 飞书消息文本中@用户的占位符
+var feishuMention = regexp.MustCompile(`@_user_\d+`)
+
+// NewFeishu 创建飞书适配器
+func NewFeishu(config FeishuConfig) (*Feishu, error) {
+	if config.AppID == "" || config.AppSecret == "" {
+		return nil, fmt.Errorf("飞书的AppID和AppSecret不能为空")
+	}
+	// 两者都未设置时任何人都能伪造回调驱动智能体和工具
+	if config.EncryptKey == "" && config.VerificationToken == "" {
+		return nil, fmt.Errorf("飞书的EncryptKey和VerificationToken至少设置一个")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "https://open.feishu.cn"
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &Feishu{config: config}, nil
+}
+
+// Name 平台名称
+func (f *Feishu) Name() string {
+	return "feishu"
+}
+
+// Parse 解析事件回调，处理URL验证和加密事件
+func (f *Feishu) Parse(r *http.Request, body []byte) (*Callback, error) {
+	if f.config.EncryptKey != "" {
+		// 设置了Encrypt Key时必须有签名，时间戳包含在签名中，防止重放
+		timestamp := r.Header.Get("X-Lark-Request-Timestamp")
+		if err := checkFeishuTimestamp(timestamp, time.Second); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(timestamp + r.Header.Get("X-Lark-Request-Nonce") + f.config.EncryptKey + string(body)))
+		if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(r.Header.Get("X-Lark-Signature"))) != 1 {
+			return nil, fmt.Errorf("签名错误")
+		}
+		var encrypted struct {
+			Encrypt string `json:"encrypt"`
+		}
+		if err := json.Unmarshal(body, &encrypted); err != nil || encrypted.Encrypt == "" {
+			return nil, fmt.Errorf("回调未加密")
+		}
+		decrypted, err := f.decrypt(encrypted.Encrypt)
+		if err != nil {
+			return nil, fmt.Errorf("解密回调失败: %w", err)
+		}
+		body = decrypted
+	}
+
+	var event struct {
+		Type      string `json:"type"`
+		Token     string `json:"token"`
+		Challenge string `json:"challenge"`
+		Header    struct {
+			EventID    string `json:"event_id"`
+			EventType  string `json:"event_type"`
+			Token      string `json:"token"`
+			CreateTime string `json:"create_time"` // 事件创建的毫秒时间戳
+		} `json:"header"`
+		Event struct {
+			Sender struct {
+				SenderID struct {
+					OpenID string `json:"open_id"`
+				} `json:"sender_id"`
+				SenderType string `json:"sender_type"`
+			} `json:"sender"`
+			Message struct {
+				MessageID   string `json:"message_id"`
+				ChatID      string `json:"chat_id"`
+				ChatType    string `json:"chat_type"`
+				MessageType string `json:"message_type"`
+				Content     string `json:"content"`
+			} `json:"message"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("解析回调失败: %w", err)
+	}
+
+	if event.Type == "url_verification" {
+		if err := f.checkToken(event.Token); err != nil {
+			return nil, err
+		}
+		response, _ := json.Marshal(map[string]string{"challenge": event.Challenge})
+		return &Callback{Response: response}, nil
+	}
+	if err := f.checkToken(event.Header.Token); err != nil {
+		return nil, err
+	}
+	message := event.Event.Message
+	if event.Header.EventType != "im.message.receive_v1" || message.MessageType != "text" || event.Event.Sender.SenderType == "app" {
+		return &Callback{}, nil
+	}
+	// 未加密时签名不可用，用事件中的创建时间拒绝过期的回调
+	if f.config.EncryptKey == "" {
+		if err := checkFeishuTimestamp(event.Header.CreateTime, time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+	var content struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(message.Content), &content); err != nil {
+		return nil, fmt.Errorf("解析消息内容失败: %w", err)
+	}
+	return &Callback{Message: &Incoming{
+		MessageID:      message.MessageID,
+		ConversationID: message.ChatID,
+		Group:          message.ChatType == "group",
+		UserID:         event.Event.Sender.SenderID.OpenID,
+		Text:           strings.TrimSpace(feishuMention.ReplaceAllString(content.Text, "")),
+	}}, nil
+}
+
+// Reply 以文本回复原消息
+func (f *Feishu) Reply(ctx context.Context, msg *Incoming, text string) error {
+	content, _ := json.Marshal(map[string]string{"text": text})
+	return f.reply(ctx, msg, "text", string(content))
+}
+
+// SendCard 以消息卡片回复原消息
+func (f *Feishu) SendCard(ctx context.Context, msg *Incoming, card Card) error {
+	elements := []interface{}{}
+	if card.Text != "" {
+		elements = append(elements, map[string]interface{}{"tag": "markdown", "content": card.Text})
+	}
+	content, _ := json.Marshal(map[string]interface{}{
+		"config":   map[string]interface{}{"wide_screen_mode": true},
+		"header":   map[string]interface{}{"title": map[string]string{"tag": "plain_text", "content": card.Title}, "template": "blue"},
+		"elements": elements,
+	})
+	return f.reply(ctx, msg, "interactive", string(content))
+}
+
+// reply 调用消息回复接口
+func (f *Feishu) reply(ctx context.Context, msg *Incoming, msgType, content string) error {
+	token, err := f.token.get(func() (string, int, error) { return f.fetchToken(ctx) })
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	url := f.config.BaseURL + "/open-apis/im/v1/messages/" + msg.MessageID + "/reply"
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	if err := postJSON(ctx, f.config.HTTPClient, url, headers, map[string]string{"msg_type": msgType, "content": content}, &result); err != nil {
+		return fmt.Errorf("飞书回复消息失败: %w", err)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("飞书回复消息失败 (%d): %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// fetchToken 获取tenant_access_token
+func (f *Feishu) fetchToken(ctx context.Context) (string, int, error) {
+	var result struct {
+		Code              int    `json:"code"`
+		Msg               string `json:"msg"`
+		TenantAccessToken string `json:"tenant_access_token"`
+		Expire            int    `json:"expire"`
+	}
+	body := map[string]string{"app_id": f.config.AppID, "app_secret": f.config.AppSecret}
+	if err := postJSON(ctx, f.config.HTTPClient, f.config.BaseURL+"/open-apis/auth/v3/tenant_access_token/internal", nil, body, &result); err != nil {
+		return "", 0, fmt.Errorf("获取飞书访问令牌失败: %w", err)
+	}
+	if result.Code != 0 {
+		return "", 0, fmt.Errorf("获取飞书访问令牌失败 (%d): %s", result.Code, result.Msg)
+	}
+	return result.TenantAccessToken, result.Expire, nil
+}
+
+// checkToken 校验Verification Token
+func (f *Feishu) checkToken(token string) error {
+	if f.config.VerificationToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(f.config.VerificationToken)) != 1 {
+		return fmt.Errorf("Verification Token错误")
+	}
+	return nil
+}
+
+// checkFeishuTimestamp 校验时间戳与本地时间的差距，unit为时间戳的单位
+func checkFeishuTimestamp(timestamp string, unit time.Duration) error {
+	value, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("时间戳无效: %q", timestamp)
+	}
+	if skew := time.Since(time.Unix(0, value*int64(unit))); skew > feishuMaxSkew || skew < -feishuMaxSkew {
+		return fmt.Errorf("时间戳已过期")
+	}
+	return nil
+}
+
+// decrypt 解密事件：密钥为Encrypt Key的SHA-256，密文前16字节为IV
+func (f *Feishu) decrypt(encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 {
+		return nil, fmt.Errorf("密文长度错误")
+	}
+	key := sha256.Sum256([]byte(f.config.EncryptKey))
+	return decryptCBC(key[:], data[:16], data[16:])
+}
@@ -0,0 +1,501 @@
+// Package im 将企业即时通讯（飞书、钉钉、企业微信）的机器人回调接入会话：
+// 回调中的消息按会话（单聊或群聊）映射到ConversationManager，智能体的回复和工具调用进度发回原会话
+package im
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// defaultTimeout 单次对话的默认超时时间
+const defaultTimeout = 5 * time.Minute
+
+// maxCallbackSize 回调请求体的最大字节数
+const maxCallbackSize = 1 << 20
+
+// progressWait 回复前等待进度卡片发送完的最长时间
+const progressWait = 10 * time.Second
+
+// seenCapacity 用于去重的最近消息ID数量，平台在超时未收到响应时会重发回调
+const seenCapacity = 1024
+
+// 会话回收的默认配置
+const (
+	defaultSessionTTL  = 24 * time.Hour
+	defaultMaxSessions = 10000
+)
+
+// defaultErrorReply 对话出错时默认回复的文本，错误详情只写入日志
+const defaultErrorReply = "抱歉，处理消息时出错了，请稍后再试。"
+
+// Incoming 从回调中解析出的一条用户消息
+type Incoming struct {
+	MessageID      string
+	ConversationID string // 单聊为用户所在的会话，群聊为群ID
+	Group          bool
+	UserID         string
+	UserName       string
+	Text           string // 已去除@机器人的部分
+
+	replyTarget string // 平台回复所需的额外信息，如钉钉的sessionWebhook
+}
+
+// Callback 回调的解析结果
+type Callback struct {
+	Response    []byte    // 需要直接写回平台的响应内容，如URL验证的challenge
+	ContentType string    // Response的类型，为空时为application/json
+	Message     *Incoming // 收到的用户消息，不是消息事件（或不支持的消息类型）时为nil
+}
+
+// Card 发送到会话中的卡片，用于展示工具调用进度等状态
+type Card struct {
+	Title string
+	Text  string // Markdown文本
+}
+
+// Platform 即时通讯平台的适配器
+type Platform interface {
+	// Name 平台名称，用作会话键的前缀
+	Name() string
+	// Parse 校验并解析回调请求，body为已读取的请求体
+	Parse(r *http.Request, body []byte) (*Callback, error)
+	// Reply 向消息所在的会话回复文本
+	Reply(ctx context.Context, msg *Incoming, text string) error
+	// SendCard 向消息所在的会话发送卡片
+	SendCard(ctx context.Context, msg *Incoming, card Card) error
+}
+
+// Config 机器人的配置
+type Config struct {
+	Provider general.Provider
+	Model    string
+	// NewSession 为新的会话创建ConversationManager，key为"平台名称:会话ID"，
+	// 可以在这里设置系统提示词、注册工具，或用key从存储中恢复历史
+	NewSession func(key string) (*ConversationManager.ConversationManager, error)
+	// ToolProgress 为true时每次调用工具前向会话发送进度卡片，通过Subscribe订阅会话的事件
+	ToolProgress bool
+	Timeout      time.Duration // 单次对话的超时时间，默认5分钟
+	// ErrorReply 对话出错时回复的文本，为空时使用通用的提示；错误详情只写入日志，不发给用户
+	ErrorReply string
+	// SessionTTL 会话空闲超过该时间后被回收，之后的消息重新调用NewSession，默认24小时
+	SessionTTL time.Duration
+	// MaxSessions 最多保留的会话数，超过时回收最久未使用的空闲会话，默认10000
+	MaxSessions int
+}
+
+// Bot 接收平台回调并驱动会话的机器人，实现http.Handler
+// 回调在校验后立即返回，对话在后台进行；同一会话的消息按顺序处理
+type Bot struct {
+	platform Platform
+	config   Config
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	seen     map[string]bool
+	seenList []string
+	running  sync.WaitGroup
+}
+
+// session 一个会话及其进行中的消息
+type session struct {
+	cm      *ConversationManager.ConversationManager
+	turn    sync.Mutex // 串行处理同一会话的消息
+	mu      sync.Mutex
+	current *Incoming     // 正在处理的消息，工具进度卡片发送到它所在的会话
+	turnEnd chan struct{} // 进度转发处理完本轮结束事件时发出，保证进度卡片先于回复发送
+
+	progress *ConversationManager.Subscription // ToolProgress的事件订阅，回收时关闭
+	active   int                               // 正在处理和等待处理的消息数，不为0时不回收，受Bot.mu保护
+	lastUsed time.Time                         // 最后一条消息处理完的时间，受Bot.mu保护
+}
+
+// NewBot 创建机器人
+func NewBot(platform Platform, config Config) (*Bot, error) {
+	if platform == nil {
+		return nil, fmt.Errorf("平台不能为空")
+	}
+	if config.NewSession == nil {
+		return nil, fmt.Errorf("NewSession不能为空")
+	}
+	if config.Provider == "" || config.Model == "" {
+		return nil, fmt.Errorf("Provider和Model不能为空")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.ErrorReply == "" {
+		config.ErrorReply = defaultErrorReply
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = defaultSessionTTL
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = defaultMaxSessions
+	}
+	return &Bot{
+		platform: platform,
+		config:   config,
+		sessions: make(map[string]*session),
+		seen:     make(map[string]bool),
+	}, nil
+}
+
+// ServeHTTP 处理平台的回调请求
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackSize))
+	if err != nil {
+		http.Error(w, "读取请求失败", http.StatusBadRequest)
+		return
+	}
+	callback, err := b.platform.Parse(r, body)
+	if err != nil {
+		log.Printf("%s回调校验失败: %v", b.platform.Name(), err)
+		// 不向调用方说明校验失败的原因
+		http.Error(w, "回调校验失败", http.StatusUnauthorized)
+		return
+	}
+
+	if callback.Message != nil && callback.Message.Text != "" && b.markSeen(callback.Message.MessageID) {
+		b.running.Add(1)
+		go func(msg *Incoming) {
+			defer b.running.Done()
+			b.handle(msg)
+		}(callback.Message)
+	}
+
+	contentType := callback.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	response := callback.Response
+	if response == nil {
+		response = []byte("{}")
+	}
+	w.Write(response)
+}
+
+// Session 返回会话键对应的ConversationManager，会话不存在时返回nil
+func (b *Bot) Session(key string) *ConversationManager.ConversationManager {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s := b.sessions[key]; s != nil {
+		return s.cm
+	}
+	return nil
+}
+
+// Wait 等待后台进行中的对话全部结束，用于退出前
+func (b *Bot) Wait() {
+	b.running.Wait()
+}
+
+// handle 在会话中处理一条消息并回复
+func (b *Bot) handle(msg *Incoming) {
+	key := b.platform.Name() + ":" + msg.ConversationID
+	s, err := b.session(key)
+	if err != nil {
+		log.Printf("创建会话 %s 失败: %v", key, err)
+		return
+	}
+	defer b.release(s)
+
+	s.turn.Lock()
+	defer s.turn.Unlock()
+	s.mu.Lock()
+	s.current = msg
+	s.mu.Unlock()
+	select {
+	case <-s.turnEnd:
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.Timeout)
+	defer cancel()
+	messages, _, err, _ := s.cm.Chat(ctx, b.config.Provider, b.config.Model, msg.Text, nil, nil)
+	if b.config.ToolProgress {
+		select {
+		case <-s.turnEnd:
+		case <-time.After(progressWait):
+		}
+	}
+	reply := lastAssistantText(messages)
+	if err != nil {
+		log.Printf("处理%s消息 %s 失败: %v", b.platform.Name(), msg.MessageID, err)
+		reply = b.config.ErrorReply
+	}
+	if reply == "" {
+		return
+	}
+	if err := b.platform.Reply(ctx, msg, reply); err != nil {
+		log.Printf("回复%s消息 %s 失败: %v", b.platform.Name(), msg.MessageID, err)
+	}
+}
+
+// session 返回会话并登记一条进行中的消息，不存在时创建；处理完后调用release
+func (b *Bot) session(key string) (*session, error) {
+	if s := b.acquire(key); s != nil {
+		return s, nil
+	}
+
+	// NewSession由调用方提供，可能较慢（如启动MCP服务），不持有锁调用
+	cm, err := b.config.NewSession(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建期间同一会话的其他消息可能已创建了会话，重新检查
+	b.mu.Lock()
+	if s := b.sessions[key]; s != nil {
+		s.active++
+		b.mu.Unlock()
+		// 丢弃的会话可能已在NewSession中启动了MCP服务等资源
+		cm.Shutdown(context.Background())
+		return s, nil
+	}
+	defer b.mu.Unlock()
+	b.evict(time.Now())
+	s := &session{cm: cm, turnEnd: make(chan struct{}, 1), active: 1}
+	if b.config.ToolProgress {
+		s.progress = cm.Subscribe(0)
+		go b.forwardProgress(s, s.progress.Events())
+	}
+	b.sessions[key] = s
+	return s, nil
+}
+
+// acquire 返回已有的会话并登记一条正在处理的消息，会话不存在时返回nil
+func (b *Bot) acquire(key string) *session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.sessions[key]
+	if s != nil {
+		s.active++
+	}
+	return s
+}
+
+// release 结束一条消息的处理，记录会话的使用时间
+func (b *Bot) release(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.active--
+	s.lastUsed = time.Now()
+}
+
+// evict 回收空闲超过SessionTTL的会话，会话数仍达到MaxSessions时回收最久未使用的空闲会话，调用方持有锁
+func (b *Bot) evict(now time.Time) {
+	var idle []string
+	for key, s := range b.sessions {
+		if s.active > 0 {
+			continue
+		}
+		if now.Sub(s.lastUsed) > b.config.SessionTTL {
+			b.remove(key)
+			continue
+		}
+		idle = append(idle, key)
+	}
+	if len(b.sessions) < b.config.MaxSessions {
+		return
+	}
+	sort.Slice(idle, func(i, j int) bool {
+		return b.sessions[idle[i]].lastUsed.Before(b.sessions[idle[j]].lastUsed)
+	})
+	for _, key := range idle {
+		if len(b.sessions) < b.config.MaxSessions {
+			return
+		}
+		b.remove(key)
+	}
+}
+
+// remove 移除会话并停止转发其进度，调用方持有锁
+func (b *Bot) remove(key string) {
+	if s := b.sessions[key]; s.progress != nil {
+		s.progress.Close()
+	}
+	delete(b.sessions, key)
+}
+
+// forwardProgress 将工具调用事件作为进度卡片发送到正在处理的消息所在的会话
+func (b *Bot) forwardProgress(s *session, events <-chan ConversationManager.Event) {
+	for event := range events {
+		if event.Type == ConversationManager.EventTurnCompleted || event.Type == ConversationManager.EventError {
+			select {
+			case s.turnEnd <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		if event.Type != ConversationManager.EventToolCallApproved || event.ToolCall == nil {
+			continue
+		}
+		s.mu.Lock()
+		msg := s.current
+		s.mu.Unlock()
+		if msg == nil {
+			continue
+		}
+		card := Card{Title: "正在调用工具 " + event.ToolCall.Function.Name, Text: toolArguments(event.ToolCall.Function.Arguments)}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := b.platform.SendCard(ctx, msg, card); err != nil {
+			log.Printf("发送%s工具进度失败: %v", b.platform.Name(), err)
+		}
+		cancel()
+	}
+}
+
+// markSeen 记录消息ID，已处理过时返回false
+func (b *Bot) markSeen(id string) bool {
+	if id == "" {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.seen[id] {
+		return false
+	}
+	b.seen[id] = true
+	b.seenList = append(b.seenList, id)
+	if len(b.seenList) > seenCapacity {
+		delete(b.seen, b.seenList[0])
+		b.seenList = b.seenList[1:]
+	}
+	return true
+}
+
+// lastAssistantText 返回最后一条助手消息的文本
+func lastAssistantText(messages []general.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != general.RoleAssistant {
+			continue
+		}
+		var texts []string
+		for _, content := range messages[i].Content {
+			if content.Type == general.ContentTypeText && content.Text != "" {
+				texts = append(texts, content.Text)
+			}
+		}
+		if len(texts) > 0 {
+			return strings.Join(texts, "\n")
+		}
+	}
+	return ""
+}
+
+// toolArguments 将工具参数格式化为卡片中的代码块，过长时截断
+func toolArguments(arguments json.RawMessage) string {
+	text := string(arguments)
+	var value interface{}
+	if json.Unmarshal(arguments, &value) == nil {
+		if indented, err := json.MarshalIndent(value, "", "  "); err == nil {
+			text = string(indented)
+		}
+	}
+	if runes := []rune(text); len(runes) > 500 {
+		text = string(runes[:500]) + "…"
+	}
+	if text == "" || text == "{}" || text == "null" {
+		return ""
+	}
+	return "```\n" + text + "\n```"
+}
+
+// postJSON 发送JSON请求并解析响应，状态码不是2xx时返回错误
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return doRequest(client, req, out)
+}
+
+// doRequest 发送请求并解析JSON响应
+func doRequest(client *http.Client, req *http.Request, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCallbackSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("请求失败 (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
+
+// accessToken 缓存平台的访问令牌，在过期前一分钟刷新
+type accessToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// get 返回缓存的令牌，过期时调用fetch获取新令牌，fetch返回令牌和有效期（秒）
+func (t *accessToken) get(fetch func() (string, int, error)) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	token, expiresIn, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	t.expires = time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute)
+	return token, nil
+}
+
+// decryptCBC AES-CBC解密并去除PKCS#7填充
+func decryptCBC(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("密文长度错误")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > 32 || padding > len(plaintext) {
+		return nil, fmt.Errorf("填充错误")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
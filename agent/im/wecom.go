@@ -0,0 +1,196 @@
+package im
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// WeComConfig 企业微信自建应用的配置
+type WeComConfig struct {
+	CorpID         string
+	CorpSecret     string // 应用的Secret，用于获取access_token发送消息
+	AgentID        int
+	Token          string       // 接收消息的Token，用于校验签名
+	EncodingAESKey string       // 接收消息的EncodingAESKey，用于解密回调
+	BaseURL        string       // 接口地址，默认https://qyapi.weixin.qq.com
+	HTTPClient     *http.Client // 为nil时使用http.DefaultClient
+}
+
+// WeCom 企业微信适配器，接收应用的加密消息回调，通过应用消息接口回复给发送者
+type WeCom struct {
+	config WeComConfig
+	aesKey []byte
+	token  accessToken
+}
+
+// NewWeCom 创建企业微信适配器
+func NewWeCom(config WeComConfig) (*WeCom, error) {
+	if config.CorpID == "" || config.CorpSecret == "" || config.Token == "" {
+		return nil, fmt.Errorf("企业微信的CorpID、CorpSecret和Token不能为空")
+	}
+	aesKey, err := base64.StdEncoding.DecodeString(config.EncodingAESKey + "=")
+	if err != nil || len(aesKey) != 32 {
+		return nil, fmt.Errorf("企业微信的EncodingAESKey应为43个字符")
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = "https://qyapi.weixin.qq.com"
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	return &WeCom{config: config, aesKey: aesKey}, nil
+}
+
+// Name 平台名称
+func (w *WeCom) Name() string {
+	return "wecom"
+}
+
+// Parse 处理回调地址验证（GET）和消息回调（POST）
+func (w *WeCom) Parse(r *http.Request, body []byte) (*Callback, error) {
+	query := r.URL.Query()
+	if r.Method == http.MethodGet {
+		echo, err := w.open(query, query.Get("echostr"))
+		if err != nil {
+			return nil, err
+		}
+		return &Callback{Response: echo, ContentType: "text/plain; charset=utf-8"}, nil
+	}
+
+	var envelope struct {
+		Encrypt string `xml:"Encrypt"`
+	}
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("解析回调失败: %w", err)
+	}
+	plaintext, err := w.open(query, envelope.Encrypt)
+	if err != nil {
+		return nil, err
+	}
+	var message struct {
+		FromUserName string `xml:"FromUserName"`
+		MsgType      string `xml:"MsgType"`
+		Content      string `xml:"Content"`
+		MsgID        string `xml:"MsgId"`
+	}
+	if err := xml.Unmarshal(plaintext, &message); err != nil {
+		return nil, fmt.Errorf("解析消息失败: %w", err)
+	}
+	callback := &Callback{Response: []byte{}, ContentType: "text/plain; charset=utf-8"}
+	if message.MsgType == "text" {
+		callback.Message = &Incoming{
+			MessageID:      message.MsgID,
+			ConversationID: message.FromUserName,
+			UserID:         message.FromUserName,
+			Text:           strings.TrimSpace(message.Content),
+		}
+	}
+	return callback, nil
+}
+
+// Reply 以应用消息发送文本给消息的发送者
+func (w *WeCom) Reply(ctx context.Context, msg *Incoming, text string) error {
+	return w.send(ctx, msg, "text", map[string]string{"content": text})
+}
+
+// SendCard 以Markdown应用消息发送卡片
+func (w *WeCom) SendCard(ctx context.Context, msg *Incoming, card Card) error {
+	content := "**" + card.Title + "**"
+	if card.Text != "" {
+		content += "\n" + card.Text
+	}
+	return w.send(ctx, msg, "markdown", map[string]string{"content": content})
+}
+
+// send 调用应用消息发送接口
+func (w *WeCom) send(ctx context.Context, msg *Incoming, msgType string, content interface{}) error {
+	token, err := w.token.get(func() (string, int, error) { return w.fetchToken(ctx) })
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{"touser": msg.UserID, "msgtype": msgType, "agentid": w.config.AgentID, msgType: content}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postJSON(ctx, w.config.HTTPClient, w.config.BaseURL+"/cgi-bin/message/send?access_token="+url.QueryEscape(token), nil, body, &result); err != nil {
+		return fmt.Errorf("企业微信发送消息失败: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("企业微信发送消息失败 (%d): %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// fetchToken 获取access_token
+func (w *WeCom) fetchToken(ctx context.Context) (string, int, error) {
+	endpoint := w.config.BaseURL + "/cgi-bin/gettoken?corpid=" + url.QueryEscape(w.config.CorpID) + "&corpsecret=" + url.QueryEscape(w.config.CorpSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	var result struct {
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doRequest(w.config.HTTPClient, req, &result); err != nil {
+		return "", 0, fmt.Errorf("获取企业微信访问令牌失败: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return "", 0, fmt.Errorf("获取企业微信访问令牌失败 (%d): %s", result.ErrCode, result.ErrMsg)
+	}
+	return result.AccessToken, result.ExpiresIn, nil
+}
+
+// open 校验签名并解密回调内容
+func (w *WeCom) open(query url.Values, encrypted string) ([]byte, error) {
+	if encrypted == "" {
+		return nil, fmt.Errorf("回调内容为空")
+	}
+	signature := w.signature(query.Get("timestamp"), query.Get("nonce"), encrypted)
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(query.Get("msg_signature"))) != 1 {
+		return nil, fmt.Errorf("签名错误")
+	}
+	return w.decrypt(encrypted)
+}
+
+// signature 消息签名：Token、时间戳、随机数和密文排序拼接后的SHA-1
+func (w *WeCom) signature(timestamp, nonce, encrypted string) string {
+	parts := []string{w.config.Token, timestamp, nonce, encrypted}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// decrypt 解密回调内容：16字节随机数 + 4字节消息长度 + 消息 + CorpID
+func (w *WeCom) decrypt(encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("解密回调失败: %w", err)
+	}
+	plaintext, err := decryptCBC(w.aesKey, w.aesKey[:16], data)
+	if err != nil {
+		return nil, fmt.Errorf("解密回调失败: %w", err)
+	}
+	if len(plaintext) < 20 {
+		return nil, fmt.Errorf("解密回调失败: 内容过短")
+	}
+	length := int(binary.BigEndian.Uint32(plaintext[16:20]))
+	if 20+length > len(plaintext) {
+		return nil, fmt.Errorf("解密回调失败: 长度错误")
+	}
+	if receiver := string(plaintext[20+length:]); receiver != w.config.CorpID {
+		return nil, fmt.Errorf("回调的CorpID %q 不匹配", receiver)
+	}
+	return plaintext[20 : 20+length], nil
+}
@@ -0,0 +1,42 @@
+// Package credential 提供商客户端共享的API密钥获取和错误信息中的密钥隐藏
+package credential
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// APIKey 获取本次请求使用的API密钥，source不为nil时每次请求重新获取，以支持密钥轮换，否则使用固定的key
+func APIKey(ctx context.Context, key string, source func(ctx context.Context) (string, error)) (string, error) {
+	if source == nil {
+		return key, nil
+	}
+	key, err := source(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get api key failed: %w", err)
+	}
+	return key, nil
+}
+
+// redactedError 隐藏了API密钥的错误，Unwrap保留原始错误以便errors.Is/As判断
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Redact 将错误信息中的API密钥替换为[REDACTED]
+func Redact(err error, apiKey string) error {
+	if err == nil || apiKey == "" || !strings.Contains(err.Error(), apiKey) {
+		return err
+	}
+	return &redactedError{msg: strings.ReplaceAll(err.Error(), apiKey, "[REDACTED]"), err: err}
+}
@@ -0,0 +1,98 @@
+// Package payload 提供商客户端共享的请求体和响应体处理：请求体编码到池化的缓冲区，响应体直接流式解码，
+// 减少大请求（如多模态的base64图片和文档）在每次调用时的内存分配和复制
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledSize 超过该大小的缓冲区用完后不放回池中，避免偶尔的超大请求长期占用内存
+const maxPooledSize = 32 << 20
+
+// buffers 请求体缓冲池
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// Body 编码到池化缓冲区的请求体，请求结束后调用Release归还缓冲区
+// Transport可能在Do返回后仍在读取请求体（或通过GetBody重新读取），缓冲区在所有读取者关闭且调用了Release之后才归还
+type Body struct {
+	buf  *bytes.Buffer
+	refs int32
+}
+
+// JSON 将v编码为JSON请求体
+func JSON(v interface{}) (*Body, error) {
+	buf := buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		buffers.Put(buf)
+		return nil, err
+	}
+	// 去掉Encode追加的换行，与json.Marshal的结果一致
+	buf.Truncate(buf.Len() - 1)
+	return &Body{buf: buf, refs: 1}, nil
+}
+
+// Bytes 返回编码后的内容，只在Release之前有效
+func (b *Body) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Attach 将请求体设置到请求上，包括ContentLength和用于重试的GetBody
+func (b *Body) Attach(req *http.Request) {
+	req.Body = b.reader()
+	req.ContentLength = int64(b.buf.Len())
+	req.GetBody = func() (io.ReadCloser, error) {
+		return b.reader(), nil
+	}
+}
+
+// Release 调用方不再使用请求体，所有读取者关闭后缓冲区归还到池中
+func (b *Body) Release() {
+	b.release()
+}
+
+// reader 返回一个新的读取者，关闭时释放引用
+func (b *Body) reader() io.ReadCloser {
+	atomic.AddInt32(&b.refs, 1)
+	return &bodyReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}
+}
+
+// release 释放一个引用，最后一个引用释放时归还缓冲区
+func (b *Body) release() {
+	if atomic.AddInt32(&b.refs, -1) != 0 {
+		return
+	}
+	if b.buf.Cap() <= maxPooledSize {
+		buffers.Put(b.buf)
+	}
+	b.buf = nil
+}
+
+// bodyReader 请求体的一个读取者
+type bodyReader struct {
+	*bytes.Reader
+	body   *Body
+	closed int32
+}
+
+// Close 释放读取者的引用，重复调用无效
+func (r *bodyReader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.body.release()
+	}
+	return nil
+}
+
+// DecodeJSON 从响应体流式解码JSON，不先读入整个响应，解码后读完剩余内容以便连接可以复用
+func DecodeJSON(r io.Reader, v interface{}) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return err
+	}
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
@@ -0,0 +1,145 @@
+// Package retry 提供商客户端共享的HTTP重试：对限流、服务端错误和临时性的网络错误按指数退避重试，并遵守Retry-After
+// 重试发生在单次HTTP请求内部，成功时调用方不会感知，失败时返回最后一次的响应或错误
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// DefaultStatuses 未设置RetryOnStatus时重试的状态码
+var DefaultStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Policy HTTP请求的重试策略，为nil时不重试
+type Policy struct {
+	MaxAttempts   int           `yaml:"MaxAttempts" json:"max_attempts"`                          // 最大尝试次数（含首次请求），小于等于1时不重试
+	Backoff       time.Duration `yaml:"Backoff,omitempty" json:"backoff,omitempty"`               // 首次重试前的等待时间，之后每次翻倍，默认1s
+	MaxBackoff    time.Duration `yaml:"MaxBackoff,omitempty" json:"max_backoff,omitempty"`        // 等待时间上限，0表示不限制；Retry-After超过上限时不再重试
+	RetryOnStatus []int         `yaml:"RetryOnStatus,omitempty" json:"retry_on_status,omitempty"` // 需要重试的状态码，为空时使用DefaultStatuses
+}
+
+// Do 发送请求，响应的状态码需要重试或发生临时性的网络错误（见Transient）时按策略重试，请求的上下文取消时立即返回
+// 重试时通过req.GetBody重新读取请求体，没有GetBody的带请求体的请求不重试
+// 响应头中有Retry-After时按其等待，否则按指数退避等待；重试用完时返回最后一次的响应，由调用方按状态码处理
+func (p *Policy) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if p == nil || p.MaxAttempts <= 1 || (req.Body != nil && req.GetBody == nil) {
+		return client.Do(req)
+	}
+	ctx := req.Context()
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(attemptReq)
+		if attempt == p.MaxAttempts || ctx.Err() != nil || (err == nil && !p.retryable(resp.StatusCode)) || (err != nil && !Transient(err)) {
+			return resp, err
+		}
+
+		wait := backoff
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if p.MaxBackoff > 0 && retryAfter > p.MaxBackoff {
+					return resp, nil
+				}
+				wait = retryAfter
+			}
+			// 读完并关闭响应体，连接可以复用
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err == nil {
+				err = ctx.Err()
+			}
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+
+		attemptReq = req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+	}
+}
+
+// retryable 判断状态码是否需要重试
+func (p *Policy) retryable(status int) bool {
+	statuses := p.RetryOnStatus
+	if len(statuses) == 0 {
+		statuses = DefaultStatuses
+	}
+	return slices.Contains(statuses, status)
+}
+
+// parseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// StatusError 提供商接口返回的非200响应
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // 响应头中的Retry-After，没有时为0
+}
+
+// NewStatusError 由响应和已读出的响应体创建StatusError
+func NewStatusError(resp *http.Response, body []byte) *StatusError {
+	retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"))
+	return &StatusError{StatusCode: resp.StatusCode, Body: string(body), RetryAfter: retryAfter}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("api request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Transient 判断错误是否是临时性的，重试可能成功：限流（429）、服务端错误（5xx）、超时、连接被重置或拒绝，以及响应中途断开
+// 参数错误、鉴权失败（400/401/403等）、请求校验失败，以及DNS解析失败、证书错误、地址格式错误等网络错误不是临时性的
+func Transient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF)
+}
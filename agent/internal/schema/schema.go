@@ -0,0 +1,21 @@
+// Package schema 提供商客户端共享的工具参数Schema处理，Gemini的Schema差异较大，由google包单独转换
+package schema
+
+// Sanitize 将工具参数Schema转换为OpenAI兼容接口和Anthropic接受的形式，返回新的Schema，不修改原Schema
+// 参数必须是type为object的Schema：为nil时使用空对象，缺少type时补充object，缺少properties时补充空属性，
+// 删除MCP服务器常带的$schema和$id
+func Sanitize(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(schema)+2)
+	for key, value := range schema {
+		if key != "$schema" && key != "$id" {
+			result[key] = value
+		}
+	}
+	if _, ok := result["type"]; !ok {
+		result["type"] = "object"
+	}
+	if _, ok := result["properties"]; !ok && result["type"] == "object" {
+		result["properties"] = map[string]interface{}{}
+	}
+	return result
+}
@@ -2,13 +2,17 @@ package openai
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/payload"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
 // Config OpenAI配置
@@ -16,8 +20,19 @@ type Config struct {
 	APIKey  string
 	BaseURL string
 	Model   string
+	// Headers 可选，附加到每个请求的HTTP头（如组织ID、网关鉴权），同名时覆盖默认请求头
+	Headers map[string]string
+	// Credentials 可选，每次请求时获取API密钥，设置后优先于APIKey，用于在不重建客户端的情况下轮换密钥
+	Credentials func(ctx context.Context) (string, error)
+	// HTTPClient 可选，发送请求使用的HTTP客户端，多个客户端共享同一个时可以复用连接池，为nil时使用新建的默认客户端
+	HTTPClient *http.Client
+	// Retry 可选，限流、服务端错误和网络错误时的重试策略，为nil时不重试
+	Retry *RetryPolicy
 }
 
+// RetryPolicy HTTP请求的重试策略，退避时间翻倍并遵守Retry-After
+type RetryPolicy = retry.Policy
+
 // Client OpenAI客户端
 type Client struct {
 	config     *Config
@@ -33,9 +48,13 @@ func NewClient(config *Config) *Client {
 		config.Model = "gpt-4o"
 	}
 	
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
 		config:     config,
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 	}
 }
 
@@ -44,14 +63,32 @@ func (c *Client) GetProvider() string {
 	return "openai"
 }
 
+// applyHeaders 设置配置中的自定义请求头
+func (c *Client) applyHeaders(httpReq *http.Request) {
+	for key, value := range c.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
+
+// do 按重试策略发送请求
+func (c *Client) do(httpReq *http.Request) (*http.Response, error) {
+	return c.config.Retry.Do(c.httpClient, httpReq)
+}
+
 // ValidateRequest 验证请求参数
-func (c *Client) ValidateRequest(req interface{}) error {
+func (c *Client) ValidateRequest(req *unified.ChatRequest) error {
 	// 可以添加特定的验证逻辑
 	return nil
 }
 
 // Chat 发送聊天请求
-func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error) {
+func (c *Client) Chat(ctx context.Context, req *unified.ChatRequest) (_ *unified.ChatResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	openaiReq, err := ToOpenAIRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to openai request failed: %w", err)
@@ -90,20 +127,23 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 		}
 	}
 	
-	reqBody, err := json.Marshal(openaiReq)
+	reqBody, err := payload.JSON(openaiReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -111,19 +151,38 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 	
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
 	var openaiResp OpenAIChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openaiResp); err != nil {
+	if !openaiReq.IncludeRawResponse {
+		// 不需要原始响应时直接从响应体流式解码，不缓存整个响应
+		if err := payload.DecodeJSON(resp.Body, &openaiResp); err != nil {
+			return nil, fmt.Errorf("decode response failed: %w", err)
+		}
+		return FromOpenAIResponse(&openaiResp), nil
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %w", err)
+	}
+	if err := json.Unmarshal(bodyBytes, &openaiResp); err != nil {
 		return nil, fmt.Errorf("decode response failed: %w", err)
 	}
-	
-	return FromOpenAIResponse(&openaiResp), nil
+	commonResp := FromOpenAIResponse(&openaiResp)
+	commonResp.RawResponse = bodyBytes
+	return commonResp, nil
 }
 
 // ChatStream 发送流式聊天请求
-func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interface{}, error) {
+func (c *Client) ChatStream(ctx context.Context, req *unified.ChatRequest) (_ <-chan OpenAIStreamResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	openaiReq, err := ToOpenAIRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to openai request failed: %w", err)
@@ -144,21 +203,24 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 		}
 	}
 	
-	reqBody, err := json.Marshal(openaiReq)
+	reqBody, err := payload.JSON(openaiReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Accept", "text/event-stream")
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -166,10 +228,10 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
-	ch := make(chan interface{}, 10)
+	ch := make(chan OpenAIStreamResponse, 10)
 	
 	go func() {
 		defer resp.Body.Close()
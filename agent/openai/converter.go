@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/schema"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
 // truncateToolCallID 确保工具调用ID符合OpenAI的长度限制(40字符)
@@ -24,100 +27,53 @@ func truncateToolCallID(id string) string {
 	return "call_" + hashStr // call_ + 32 = 37字符，符合40字符限制
 }
 
-// ToOpenAIRequest 将统一请求转换为OpenAI请求
-func ToOpenAIRequest(req interface{}) (*OpenAIChatRequest, error) {
-	// 这里应该引入统一类型，为了避免循环导入，先用interface{}
-	// 在实际使用时需要类型断言或者重构包结构
-	
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
-	}
-	
-	var commonReq struct {
-		Model       string `json:"model"`
-		Messages    []struct {
-			Role     string `json:"role"`
-			Content  []struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ImageURL *struct {
-					URL    string `json:"url"`
-					Detail string `json:"detail,omitempty"`
-				} `json:"image_url,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-				ToolID string `json:"tool_id,omitempty"`
-			} `json:"content"`
-			Name      string `json:"name,omitempty"`
-			ToolCalls []struct {
-				ID       string          `json:"id"`
-				Type     string          `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			} `json:"tool_calls,omitempty"`
-		} `json:"messages"`
-		Tools       []struct {
-			Type     string `json:"type"`
-			Function struct {
-				Name        string                 `json:"name"`
-				Description string                 `json:"description"`
-				Parameters  map[string]interface{} `json:"parameters"`
-			} `json:"function"`
-		} `json:"tools,omitempty"`
-		MaxTokens    int     `json:"max_tokens,omitempty"`
-		Temperature  float64 `json:"temperature,omitempty"`
-		Stream       bool    `json:"stream,omitempty"`
-		SystemPrompt string  `json:"system_prompt,omitempty"`
-	}
-	
-	if err := json.Unmarshal(reqBytes, &commonReq); err != nil {
-		return nil, fmt.Errorf("unmarshal to common request failed: %w", err)
-	}
-	
+// ToOpenAIRequest 将统一请求转换为OpenAI请求，不修改req
+func ToOpenAIRequest(req *unified.ChatRequest) (*OpenAIChatRequest, error) {
 	openaiReq := &OpenAIChatRequest{
-		Model:  commonReq.Model,
-		Stream: commonReq.Stream,
+		Model:      req.Model,
+		Stream:     req.Stream,
+		Modalities: req.Modalities,
+	}
+	if req.Audio != nil {
+		openaiReq.Audio = &OpenAIAudioParam{
+			Voice:  req.Audio.Voice,
+			Format: req.Audio.Format,
+		}
 	}
 	
 	// GPT-5及新模型不支持非默认temperature，其他模型可以设置
-	if !strings.Contains(commonReq.Model, "gpt-5") && 
-	   !strings.Contains(commonReq.Model, "o1") &&
-	   commonReq.Temperature != 0 {
-		openaiReq.Temperature = &commonReq.Temperature
+	if !strings.Contains(req.Model, "gpt-5") && 
+	   !strings.Contains(req.Model, "o1") &&
+	   req.HasTemperature() {
+		temperature := req.Temperature
+		openaiReq.Temperature = &temperature
 	}
+	openaiReq.TopP = req.TopP
 	
 	// GPT-5及新模型使用max_completion_tokens，旧模型使用max_tokens
-	if commonReq.MaxTokens > 0 {
-		if strings.Contains(commonReq.Model, "gpt-5") || 
-		   strings.Contains(commonReq.Model, "o1") || 
-		   strings.Contains(commonReq.Model, "gpt-4o-realtime") {
-			openaiReq.MaxCompletionTokens = &commonReq.MaxTokens
+	if req.MaxTokens > 0 {
+		maxTokens := req.MaxTokens
+		if strings.Contains(req.Model, "gpt-5") || 
+		   strings.Contains(req.Model, "o1") || 
+		   strings.Contains(req.Model, "gpt-4o-realtime") {
+			openaiReq.MaxCompletionTokens = &maxTokens
 		} else {
-			openaiReq.MaxTokens = &commonReq.MaxTokens
+			openaiReq.MaxTokens = &maxTokens
 		}
 	}
 	
 	// 处理系统消息 - OpenAI将系统消息作为第一条消息
-	if commonReq.SystemPrompt != "" {
+	if req.SystemPrompt != "" {
 		openaiReq.Messages = append(openaiReq.Messages, OpenAIMessage{
 			Role:    "system",
-			Content: commonReq.SystemPrompt,
+			Content: req.SystemPrompt,
 		})
 	}
 	
 	// 转换消息
-	for _, msg := range commonReq.Messages {
+	for _, msg := range req.Messages {
 		openaiMsg := OpenAIMessage{
-			Role: msg.Role,
+			Role: string(msg.Role),
 			Name: msg.Name,
 		}
 		
@@ -143,7 +99,7 @@ func ToOpenAIRequest(req interface{}) (*OpenAIChatRequest, error) {
 							Type: "image_url",
 							ImageURL: &OpenAIImageURL{
 								URL:    content.ImageURL.URL,
-								Detail: content.ImageURL.Detail,
+								Detail: string(content.ImageURL.Detail),
 							},
 						})
 					}
@@ -153,6 +109,32 @@ func ToOpenAIRequest(req interface{}) (*OpenAIChatRequest, error) {
 				case "tool_call":
 					// 工具调用内容，跳过（通过ToolCalls字段处理）
 					continue
+				case "document":
+					if content.Document != nil {
+						contents = append(contents, OpenAIContent{
+							Type: "file",
+							File: &OpenAIFile{
+								Filename: content.Document.Name,
+								FileData: "data:" + content.Document.MimeType + ";base64," + content.Document.Data,
+							},
+						})
+					}
+				case "audio":
+					if content.Audio == nil {
+						continue
+					}
+					if content.Audio.ID != "" {
+						// 模型输出的音频通过ID引用
+						openaiMsg.Audio = &OpenAIAudio{ID: content.Audio.ID}
+					} else if content.Audio.Data != "" {
+						contents = append(contents, OpenAIContent{
+							Type: "input_audio",
+							InputAudio: &OpenAIInputAudio{
+								Data:   content.Audio.Data,
+								Format: content.Audio.Format,
+							},
+						})
+					}
 				}
 			}
 			
@@ -215,189 +197,137 @@ func ToOpenAIRequest(req interface{}) (*OpenAIChatRequest, error) {
 	}
 	
 	// 转换工具定义
-	for _, tool := range commonReq.Tools {
+	for _, tool := range req.Tools {
+		tool.Function.Parameters = schema.Sanitize(tool.Function.Parameters)
+		strict := tool.Function.Strict || req.StrictTools
+		if strict {
+			tool.Function.Parameters = strictSchema(tool.Function.Parameters)
+		}
 		openaiReq.Tools = append(openaiReq.Tools, OpenAITool{
 			Type: tool.Type,
 			Function: OpenAIFunctionDefinition{
 				Name:        tool.Function.Name,
 				Description: tool.Function.Description,
 				Parameters:  tool.Function.Parameters,
+				Strict:      strict,
 			},
 		})
 	}
+
+	// 约束解码
+	if constraint := req.Constraint; constraint != nil {
+		switch constraint.Backend {
+		case "", "vllm":
+			openaiReq.GuidedJSON = constraint.JSONSchema
+			openaiReq.GuidedRegex = constraint.Regex
+			openaiReq.GuidedGrammar = constraint.Grammar
+			openaiReq.GuidedChoice = constraint.Choice
+		case "llamacpp":
+			if constraint.Regex != "" || len(constraint.Choice) > 0 {
+				return nil, fmt.Errorf("llama.cpp does not support regex or choice constraints, use a grammar instead")
+			}
+			openaiReq.JSONSchema = constraint.JSONSchema
+			openaiReq.Grammar = constraint.Grammar
+		default:
+			return nil, fmt.Errorf("unsupported constraint backend: %s", constraint.Backend)
+		}
+	}
 	
+	// 结构化输出
+	if format := req.ResponseFormat; format != nil && format.Type != "" {
+		openaiReq.ResponseFormat = &OpenAIResponseFormat{Type: string(format.Type)}
+		if format.Type == "json_schema" {
+			name := format.Name
+			if name == "" {
+				name = "response"
+			}
+			openaiReq.ResponseFormat.JSONSchema = &OpenAIJSONSchema{
+				Name:   name,
+				Schema: format.Schema,
+				Strict: format.Strict,
+			}
+		}
+	}
+
+	openaiReq.IncludeRawResponse = req.IncludeRawResponse
+	openaiReq.ProviderOptions = req.ProviderOptions["openai"]
+
 	return openaiReq, nil
 }
 
 // FromOpenAIResponse 将OpenAI响应转换为统一响应
-func FromOpenAIResponse(resp *OpenAIChatResponse) interface{} {
-	// 同样，这里应该返回统一的响应类型
-	commonResp := struct {
-		ID      string    `json:"id"`
-		Object  string    `json:"object"`
-		Created time.Time `json:"created"`
-		Model   string    `json:"model"`
-		Choices []struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role     string `json:"role"`
-				Content  []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string          `json:"id"`
-						Type     string          `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
-	}{
+func FromOpenAIResponse(resp *OpenAIChatResponse) *unified.ChatResponse {
+	commonResp := &unified.ChatResponse{
 		ID:      resp.ID,
 		Object:  resp.Object,
 		Created: time.Unix(resp.Created, 0),
 		Model:   resp.Model,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: unified.Usage{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
 	}
-	
+
 	// 转换选择
 	for _, choice := range resp.Choices {
-		commonChoice := struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role     string `json:"role"`
-				Content  []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string          `json:"id"`
-						Type     string          `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		}{
+		commonChoice := unified.Choice{
 			Index:        choice.Index,
 			FinishReason: choice.FinishReason,
 		}
-		
-		// 处理消息内容
-		commonChoice.Message.Role = choice.Message.Role
-		
+		commonChoice.Message.Role = unified.MessageRole(choice.Message.Role)
+
 		// 如果是字符串内容
 		if textContent, ok := choice.Message.Content.(string); ok {
-			commonChoice.Message.Content = append(commonChoice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "text",
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type: unified.ContentTypeText,
 				Text: textContent,
 			})
 		}
-		
-		// 处理工具调用
+
+		// 模型输出的音频作为audio内容项
+		if audio := choice.Message.Audio; audio != nil {
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type: unified.ContentTypeAudio,
+				Audio: &unified.Audio{
+					ID:         audio.ID,
+					Data:       audio.Data,
+					Transcript: audio.Transcript,
+					ExpiresAt:  audio.ExpiresAt,
+				},
+			})
+		}
+
+		// 处理工具调用，同时添加到内容中作为tool_call类型
 		for _, toolCall := range choice.Message.ToolCalls {
-			commonChoice.Message.ToolCalls = append(commonChoice.Message.ToolCalls, struct {
-				ID       string          `json:"id"`
-				Type     string          `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			}{
+			call := unified.ToolCall{
 				ID:   toolCall.ID,
 				Type: toolCall.Type,
-				Function: struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				}{
+				Function: unified.FunctionCall{
 					Name:      toolCall.Function.Name,
-					Arguments: json.RawMessage(toolCall.Function.Arguments),
-				},
-			})
-			
-			// 同时添加到内容中作为tool_call类型
-			commonChoice.Message.Content = append(commonChoice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "tool_call",
-				ToolCall: &struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				}{
-					ID:   toolCall.ID,
-					Type: toolCall.Type,
-					Function: struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					}{
-						Name:      toolCall.Function.Name,
-						Arguments: json.RawMessage(toolCall.Function.Arguments),
-					},
+					Arguments: responseArguments(toolCall.Function.Arguments),
 				},
+			}
+			commonChoice.Message.ToolCalls = append(commonChoice.Message.ToolCalls, call)
+			contentCall := call
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type:     unified.ContentTypeTool,
+				ToolCall: &contentCall,
 			})
 		}
-		
+
 		commonResp.Choices = append(commonResp.Choices, commonChoice)
 	}
-	
+
 	return commonResp
-}
\ No newline at end of file
+}
+
+// responseArguments 将响应中的参数字符串转换为json.RawMessage，不是有效JSON的参数（如模型输出的格式错误的参数）
+// 转换为JSON字符串，避免整个响应无法转换，由调用方决定如何处理
+func responseArguments(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	quoted, _ := json.Marshal(arguments)
+	return quoted
+}
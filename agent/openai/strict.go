@@ -0,0 +1,134 @@
+package openai
+
+import "sort"
+
+// strictSchema 将参数Schema转换为strict模式要求的形式，返回新的Schema，不修改原Schema
+// strict模式要求每个对象都设置additionalProperties为false，并且所有属性都在required中，
+// 原本可选的属性改为可以为null
+func strictSchema(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(schema)+2)
+	for key, value := range schema {
+		result[key] = value
+	}
+
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		required := make(map[string]bool)
+		for _, name := range schemaRequired(schema["required"]) {
+			required[name] = true
+		}
+		strictProperties := make(map[string]interface{}, len(properties))
+		names := make([]string, 0, len(properties))
+		for name, value := range properties {
+			names = append(names, name)
+			property, ok := value.(map[string]interface{})
+			if !ok {
+				strictProperties[name] = value
+				continue
+			}
+			property = strictSchema(property)
+			if !required[name] {
+				property = nullableSchema(property)
+			}
+			strictProperties[name] = property
+		}
+		sort.Strings(names)
+		result["properties"] = strictProperties
+		result["required"] = names
+		result["additionalProperties"] = false
+	} else if schema["type"] == "object" {
+		result["properties"] = map[string]interface{}{}
+		result["required"] = []string{}
+		result["additionalProperties"] = false
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		result["items"] = strictSchema(items)
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		if list, ok := schema[key].([]interface{}); ok {
+			strictList := make([]interface{}, len(list))
+			for i, item := range list {
+				if sub, ok := item.(map[string]interface{}); ok {
+					strictList[i] = strictSchema(sub)
+				} else {
+					strictList[i] = item
+				}
+			}
+			result[key] = strictList
+		}
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		if defs, ok := schema[key].(map[string]interface{}); ok {
+			strictDefs := make(map[string]interface{}, len(defs))
+			for name, value := range defs {
+				if sub, ok := value.(map[string]interface{}); ok {
+					strictDefs[name] = strictSchema(sub)
+				} else {
+					strictDefs[name] = value
+				}
+			}
+			result[key] = strictDefs
+		}
+	}
+	return result
+}
+
+// nullableSchema 允许属性为null，用于strict模式下原本可选的属性
+func nullableSchema(schema map[string]interface{}) map[string]interface{} {
+	switch t := schema["type"].(type) {
+	case string:
+		if t != "null" {
+			schema["type"] = []interface{}{t, "null"}
+		}
+	case []interface{}:
+		for _, item := range t {
+			if item == "null" {
+				return schema
+			}
+		}
+		schema["type"] = append(append([]interface{}{}, t...), "null")
+	case []string:
+		types := make([]interface{}, 0, len(t)+1)
+		for _, item := range t {
+			if item == "null" {
+				return schema
+			}
+			types = append(types, item)
+		}
+		schema["type"] = append(types, "null")
+	default:
+		// 没有type的Schema（如只有anyOf）用anyOf表示可以为null
+		return map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+	}
+	// enum中也需要包含null
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		schema["enum"] = append(append([]interface{}{}, enum...), nil)
+	} else if enum, ok := schema["enum"].([]string); ok {
+		values := make([]interface{}, 0, len(enum)+1)
+		for _, value := range enum {
+			values = append(values, value)
+		}
+		schema["enum"] = append(values, nil)
+	}
+	return schema
+}
+
+// schemaRequired 读取required列表，兼容[]string和[]interface{}
+func schemaRequired(value interface{}) []string {
+	switch required := value.(type) {
+	case []string:
+		return required
+	case []interface{}:
+		names := make([]string, 0, len(required))
+		for _, item := range required {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 package openai
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
 
 // OpenAIMessage OpenAI的消息结构
 type OpenAIMessage struct {
@@ -8,6 +14,27 @@ type OpenAIMessage struct {
 	Name      string          `json:"name,omitempty"`
 	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string         `json:"tool_call_id,omitempty"`
+	Audio     *OpenAIAudio    `json:"audio,omitempty"`
+}
+
+// OpenAIAudio OpenAI的音频输出结构，多轮对话中只需回传ID
+type OpenAIAudio struct {
+	ID         string `json:"id"`
+	Data       string `json:"data,omitempty"`
+	ExpiresAt  int64  `json:"expires_at,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+}
+
+// OpenAIAudioParam OpenAI的音频输出参数
+type OpenAIAudioParam struct {
+	Voice  string `json:"voice"`
+	Format string `json:"format"`
+}
+
+// OpenAIInputAudio OpenAI的音频输入结构
+type OpenAIInputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
 }
 
 // OpenAIContent OpenAI的内容结构(用于多模态)
@@ -15,6 +42,14 @@ type OpenAIContent struct {
 	Type     string             `json:"type"`
 	Text     string             `json:"text,omitempty"`
 	ImageURL *OpenAIImageURL   `json:"image_url,omitempty"`
+	InputAudio *OpenAIInputAudio `json:"input_audio,omitempty"`
+	File       *OpenAIFile       `json:"file,omitempty"`
+}
+
+// OpenAIFile OpenAI的文件输入结构（如PDF）
+type OpenAIFile struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data"` // data URL
 }
 
 // OpenAIImageURL OpenAI的图片URL结构
@@ -25,6 +60,7 @@ type OpenAIImageURL struct {
 
 // OpenAIToolCall OpenAI的工具调用结构
 type OpenAIToolCall struct {
+	Index    *int              `json:"index,omitempty"` // 流式增量中工具调用的序号
 	ID       string            `json:"id"`
 	Type     string            `json:"type"`
 	Function OpenAIFunctionCall `json:"function"`
@@ -47,6 +83,7 @@ type OpenAIFunctionDefinition struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
+	Strict      bool                   `json:"strict,omitempty"`
 }
 
 // OpenAIChatRequest OpenAI的聊天请求结构
@@ -57,7 +94,97 @@ type OpenAIChatRequest struct {
 	MaxTokens          *int            `json:"max_tokens,omitempty"`
 	MaxCompletionTokens *int           `json:"max_completion_tokens,omitempty"`
 	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"top_p,omitempty"`
 	Stream             bool            `json:"stream,omitempty"`
+	Modalities         []string          `json:"modalities,omitempty"`
+	Audio              *OpenAIAudioParam `json:"audio,omitempty"`
+	ResponseFormat     *OpenAIResponseFormat `json:"response_format,omitempty"`
+
+	// 约束解码参数，只有vLLM、llama.cpp等OpenAI兼容服务支持，官方API不接受
+	GuidedJSON    map[string]interface{} `json:"guided_json,omitempty"`    // vLLM
+	GuidedRegex   string                 `json:"guided_regex,omitempty"`   // vLLM
+	GuidedGrammar string                 `json:"guided_grammar,omitempty"` // vLLM
+	GuidedChoice  []string               `json:"guided_choice,omitempty"`  // vLLM
+	JSONSchema    map[string]interface{} `json:"json_schema,omitempty"`    // llama.cpp
+	Grammar       string                 `json:"grammar,omitempty"`        // llama.cpp
+
+	// IncludeRawResponse 是否在响应中保留提供商返回的原始JSON，不参与序列化
+	IncludeRawResponse bool `json:"-"`
+
+	// ProviderOptions 提供商特有的请求参数，序列化时深度合并到请求体中，优先级高于已建模的字段
+	ProviderOptions map[string]interface{} `json:"-"`
+}
+
+// OpenAIResponseFormat 结构化输出格式
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"` // text、json_object、json_schema
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema json_schema格式的Schema定义
+type OpenAIJSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema,omitempty"`
+	Strict bool                   `json:"strict,omitempty"`
+}
+
+// MarshalJSON 序列化请求，并将ProviderOptions中的字段合并到请求体中
+func (r OpenAIChatRequest) MarshalJSON() ([]byte, error) {
+	type alias OpenAIChatRequest
+	data, err := json.Marshal(alias(r))
+	if err != nil {
+		return nil, err
+	}
+	return mergeProviderOptions(data, r.ProviderOptions)
+}
+
+// mergeProviderOptions 将ProviderOptions深度合并到序列化后的请求体中
+// 同名字段以ProviderOptions为准，两边都是对象时合并子字段，值为nil时删除该字段
+func mergeProviderOptions(data []byte, options map[string]interface{}) ([]byte, error) {
+	if len(options) == 0 {
+		return data, nil
+	}
+
+	var body map[string]interface{}
+	if err := decodeJSONObject(data, &body); err != nil {
+		return nil, err
+	}
+	// 先序列化一次，使结构体等类型的值统一为map，便于深度合并
+	optionBytes, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provider options failed: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := decodeJSONObject(optionBytes, &normalized); err != nil {
+		return nil, err
+	}
+
+	mergeJSONObject(body, normalized)
+	return json.Marshal(body)
+}
+
+// mergeJSONObject 递归合并JSON对象
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			mergeJSONObject(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decodeJSONObject 解析JSON对象，数字保留为json.Number以免大整数丢失精度
+func decodeJSONObject(data []byte, v *map[string]interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
 }
 
 // OpenAIUsage OpenAI的使用统计结构
@@ -0,0 +1,360 @@
+// Package proxy 在GoAgent服务前部署的提供商反向代理：多个客户端发出相同的非流式聊天请求时，
+// 只有第一个请求发送到上游，其余的在TTL内直接返回缓存的响应，减少重复调用的费用和延迟
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialHeaders 各提供商携带API Key的请求头，默认参与缓存键计算，不同凭据的请求不共享缓存
+var CredentialHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key"}
+
+// credentialQueryParam Google通过key查询参数传递API Key
+const credentialQueryParam = "key"
+
+// 缓存的默认配置
+const (
+	defaultTTL           = 10 * time.Minute
+	defaultMaxEntries    = 1000
+	defaultMaxBytes      = 64 << 20
+	defaultMaxEntryBytes = 1 << 20
+	defaultMaxBodyBytes  = 8 << 20
+)
+
+// CacheConfig 缓存配置，零值字段使用默认值
+type CacheConfig struct {
+	TTL           time.Duration // 缓存的有效期，默认10分钟
+	MaxEntries    int           // 最多缓存的响应数，超过时淘汰最久未使用的，默认1000
+	MaxBytes      int64         // 所有缓存响应体的总大小上限，默认64MB
+	MaxEntryBytes int64         // 单个响应体超过该大小时不缓存，默认1MB
+	MaxBodyBytes  int64         // 请求体超过该大小时不缓存，直接转发，默认8MB
+	// KeyHeaders 除凭据外另外参与缓存键计算的请求头，如OpenAI-Organization
+	KeyHeaders []string
+	// ShareAcrossCredentials 为true时凭据（CredentialHeaders和key查询参数）不参与缓存键计算，不同API Key的客户端共享缓存
+	// 命中缓存时不经过上游鉴权，未携带或携带无效API Key的客户端也能读到其他客户端付费得到的响应及其内容，
+	// 只在代理本身已经鉴权且所有客户端属于同一租户时开启
+	ShareAcrossCredentials bool
+	// IgnoreFields 计算缓存键时忽略的请求体顶层字段，如OpenAI的user、metadata，这些字段不影响生成结果
+	IgnoreFields []string
+}
+
+// CacheStats 缓存的统计信息
+type CacheStats struct {
+	Hits    int64 // 命中缓存的请求数，包括等待相同请求完成后复用其响应的请求
+	Misses  int64 // 转发到上游的可缓存请求数
+	Entries int   // 当前缓存的响应数
+	Bytes   int64 // 当前缓存的响应体总大小
+}
+
+// CachingProxy 缓存聊天补全响应的反向代理，实现http.Handler
+// 只缓存请求体为JSON、非流式的POST请求的200响应，请求体的stream、streamGenerateContent路径、Accept或响应的text/event-stream都视为流式；缓存键为方法、路径、查询参数、凭据、KeyHeaders和规范化的请求体的哈希，
+// 请求体的规范化忽略字段顺序、空白和IgnoreFields。相同的请求同时到达时只转发一个，其余等待其结果。
+// 其他请求（流式、GET等）原样转发，响应头中的X-Cache为HIT、MISS或BYPASS
+type CachingProxy struct {
+	config  CacheConfig
+	proxy   *httputil.ReverseProxy
+	ignored map[string]bool
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List // 最近使用的在前
+	bytes    int64
+	inflight map[string]*inflightCall
+	stats    CacheStats
+}
+
+// cacheEntry 缓存的响应
+type cacheEntry struct {
+	key       string
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+}
+
+// inflightCall 正在转发的请求，相同请求的等待者在done关闭后重新查找缓存
+type inflightCall struct {
+	done chan struct{}
+}
+
+// cacheKeyContext 在请求的context中保存缓存键，转发后按键保存响应
+type cacheKeyContext struct{}
+
+// NewCachingProxy 创建转发到upstream的缓存代理，upstream为提供商的接口地址，如https://api.openai.com
+// 请求路径追加在upstream的路径之后，请求头（包括鉴权）原样转发
+func NewCachingProxy(upstream string, config CacheConfig) (*CachingProxy, error) {
+	target, err := url.Parse(upstream)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("上游地址无效: %q", upstream)
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultMaxEntries
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultMaxBytes
+	}
+	if config.MaxEntryBytes <= 0 {
+		config.MaxEntryBytes = defaultMaxEntryBytes
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	p := &CachingProxy{
+		config:   config,
+		ignored:  make(map[string]bool),
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*inflightCall),
+	}
+	for _, field := range config.IgnoreFields {
+		p.ignored[field] = true
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = target.Host
+			r.SetXForwarded()
+		},
+		ModifyResponse: p.storeResponse,
+	}
+	return p, nil
+}
+
+// SetTransport 设置转发使用的Transport，为nil时使用http.DefaultTransport
+func (p *CachingProxy) SetTransport(transport http.RoundTripper) {
+	p.proxy.Transport = transport
+}
+
+// ServeHTTP 处理一个请求
+func (p *CachingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, body, ok := p.cacheKey(r)
+	if !ok {
+		w.Header().Set("X-Cache", "BYPASS")
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	for {
+		p.mu.Lock()
+		if entry := p.lookup(key); entry != nil {
+			p.stats.Hits++
+			p.mu.Unlock()
+			writeCached(w, entry)
+			return
+		}
+		call, waiting := p.inflight[key]
+		if !waiting {
+			call = &inflightCall{done: make(chan struct{})}
+			p.inflight[key] = call
+			p.stats.Misses++
+		}
+		p.mu.Unlock()
+
+		if !waiting {
+			defer func() {
+				p.mu.Lock()
+				delete(p.inflight, key)
+				p.mu.Unlock()
+				close(call.done)
+			}()
+			break
+		}
+		// 等待相同的请求完成，完成后重新查找缓存；上游失败时由等待者之一重新转发
+		select {
+		case <-call.done:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("X-Cache", "MISS")
+	r = r.WithContext(context.WithValue(r.Context(), cacheKeyContext{}, key))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	// 不转发客户端的Accept-Encoding，由Transport协商压缩并解压，缓存的是未压缩的响应体
+	r.Header.Del("Accept-Encoding")
+	p.proxy.ServeHTTP(w, r)
+}
+
+// Stats 返回缓存的统计信息
+func (p *CachingProxy) Stats() CacheStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Entries = p.lru.Len()
+	stats.Bytes = p.bytes
+	return stats
+}
+
+// Purge 清空缓存
+func (p *CachingProxy) Purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = make(map[string]*list.Element)
+	p.lru.Init()
+	p.bytes = 0
+}
+
+// cacheKey 计算可缓存请求的缓存键，返回读出的请求体；请求不可缓存时ok为false，请求体保持可读
+func (p *CachingProxy) cacheKey(r *http.Request) (string, []byte, bool) {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return "", nil, false
+	}
+	if mediaType := r.Header.Get("Content-Type"); mediaType != "" && !strings.HasPrefix(mediaType, "application/json") {
+		return "", nil, false
+	}
+	if isStreamRequest(r) {
+		return "", nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, p.config.MaxBodyBytes+1))
+	if err != nil || int64(len(body)) > p.config.MaxBodyBytes {
+		// 读出的部分放回请求体之前，原样转发
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return "", nil, false
+	}
+
+	var request map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&request); err != nil || request["stream"] == true {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return "", nil, false
+	}
+	for field := range p.ignored {
+		delete(request, field)
+	}
+	// map按键排序序列化，字段顺序和空白不同的相同请求得到相同的结果
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return "", nil, false
+	}
+
+	// 命中缓存时不经过上游鉴权，凭据必须参与缓存键计算，否则无效的API Key也能读到其他客户端的响应
+	query := r.URL.Query()
+	headers := p.config.KeyHeaders
+	if p.config.ShareAcrossCredentials {
+		query.Del(credentialQueryParam)
+	} else {
+		headers = slices.Concat(CredentialHeaders, headers)
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", r.Method, r.URL.Path, query.Encode())
+	for _, header := range headers {
+		fmt.Fprintf(hash, "%s: %q\n", http.CanonicalHeaderKey(header), r.Header.Values(header))
+	}
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), body, true
+}
+
+// isStreamRequest 判断请求体之外的流式标记：Google的streamGenerateContent没有stream字段，客户端通过Accept请求SSE
+func isStreamRequest(r *http.Request) bool {
+	if strings.Contains(r.URL.Path, "streamGenerateContent") {
+		return true
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		if isEventStream(accept) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEventStream 判断媒体类型是否包含text/event-stream
+func isEventStream(mediaType string) bool {
+	return strings.Contains(strings.ToLower(mediaType), "text/event-stream")
+}
+
+// lookup 查找未过期的缓存并移到最前，调用方持有锁
+func (p *CachingProxy) lookup(key string) *cacheEntry {
+	element, ok := p.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		p.remove(element)
+		return nil
+	}
+	p.lru.MoveToFront(element)
+	return entry
+}
+
+// storeResponse 读取可缓存请求的200响应并保存，响应体超过MaxEntryBytes时不保存，原样返回给客户端
+func (p *CachingProxy) storeResponse(resp *http.Response) error {
+	key, ok := resp.Request.Context().Value(cacheKeyContext{}).(string)
+	if !ok || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	// 请求体没有stream字段的流式响应，不缓冲，由ReverseProxy逐条转发
+	if isEventStream(resp.Header.Get("Content-Type")) {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.config.MaxEntryBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > p.config.MaxEntryBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := make(http.Header)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if element, ok := p.entries[key]; ok {
+		p.remove(element)
+	}
+	p.entries[key] = p.lru.PushFront(&cacheEntry{key: key, header: header, body: body, expiresAt: time.Now().Add(p.config.TTL)})
+	p.bytes += int64(len(body))
+	for p.lru.Len() > p.config.MaxEntries || p.bytes > p.config.MaxBytes {
+		p.remove(p.lru.Back())
+	}
+	return nil
+}
+
+// remove 移除缓存，调用方持有锁
+func (p *CachingProxy) remove(element *list.Element) {
+	entry := p.lru.Remove(element).(*cacheEntry)
+	delete(p.entries, entry.key)
+	p.bytes -= int64(len(entry.body))
+}
+
+// writeCached 返回缓存的响应
+func writeCached(w http.ResponseWriter, entry *cacheEntry) {
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("Content-Length", fmt.Sprint(len(entry.body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(entry.body)
+}
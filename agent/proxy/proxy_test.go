@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// upstream 记录请求数的上游服务，请求头X-Test-Stream不为空时以SSE返回
+func upstream(requests *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if r.Header.Get("X-Test-Stream") != "" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"n\":%d}\n\ndata: [DONE]\n\n", n)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"n":%d}`, n)
+	}))
+}
+
+// send 通过代理发送请求，返回X-Cache和响应体
+func send(t *testing.T, proxy http.Handler, path, body string, header http.Header) (string, string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	return w.Header().Get("X-Cache"), w.Body.String()
+}
+
+func TestCacheKeyIsolatesCredentials(t *testing.T) {
+	const body = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	alice := http.Header{"Authorization": {"Bearer alice"}}
+	bob := http.Header{"Authorization": {"Bearer bob"}}
+
+	tests := []struct {
+		name  string
+		share bool
+		path  string
+		first http.Header
+		other http.Header
+		want  string // 另一个凭据的请求的X-Cache
+	}{
+		{"authorization header", false, "/v1/chat/completions", alice, bob, "MISS"},
+		{"anthropic header", false, "/v1/messages", http.Header{"X-Api-Key": {"alice"}}, http.Header{"X-Api-Key": {"bob"}}, "MISS"},
+		{"google query param", false, "/v1beta/models/gemini:generateContent?key=alice", nil, nil, "MISS"},
+		{"missing credential", false, "/v1/chat/completions", alice, nil, "MISS"},
+		{"shared across credentials", true, "/v1/chat/completions", alice, bob, "HIT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			server := upstream(&requests)
+			defer server.Close()
+			proxy, err := NewCachingProxy(server.URL, CacheConfig{ShareAcrossCredentials: tt.share})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cache, _ := send(t, proxy, tt.path, body, tt.first); cache != "MISS" {
+				t.Fatalf("first request X-Cache = %s, want MISS", cache)
+			}
+			if cache, _ := send(t, proxy, tt.path, body, tt.first); cache != "HIT" {
+				t.Fatalf("same credential X-Cache = %s, want HIT", cache)
+			}
+			otherPath := strings.Replace(tt.path, "key=alice", "key=bob", 1)
+			cache, response := send(t, proxy, otherPath, body, tt.other)
+			if cache != tt.want {
+				t.Errorf("other credential X-Cache = %s, want %s", cache, tt.want)
+			}
+			if tt.want == "MISS" && response != `{"n":2}` {
+				t.Errorf("other credential got %s, want the upstream response", response)
+			}
+		})
+	}
+}
+
+func TestStreamRequestsBypassCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		header http.Header
+		want   string
+	}{
+		{"stream field", "/v1/chat/completions", `{"model":"gpt-4o","stream":true}`, nil, "BYPASS"},
+		{"accept header", "/v1/chat/completions", `{"model":"gpt-4o"}`, http.Header{"Accept": {"text/event-stream"}}, "BYPASS"},
+		{"google stream path", "/v1beta/models/gemini:streamGenerateContent", `{"contents":[]}`, nil, "BYPASS"},
+		// 请求体中没有流式标记，上游返回SSE时转发但不缓存
+		{"event stream response", "/v1/chat/completions", `{"model":"gpt-4o"}`, http.Header{"X-Test-Stream": {"1"}}, "MISS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			server := upstream(&requests)
+			defer server.Close()
+			proxy, err := NewCachingProxy(server.URL, CacheConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if cache, _ := send(t, proxy, tt.path, tt.body, tt.header); cache != tt.want {
+					t.Errorf("request %d X-Cache = %s, want %s", i+1, cache, tt.want)
+				}
+			}
+			if got := requests.Load(); got != 2 {
+				t.Errorf("upstream received %d requests, want 2", got)
+			}
+			if stats := proxy.Stats(); stats.Entries != 0 || stats.Hits != 0 {
+				t.Errorf("stats = %+v, want nothing cached", stats)
+			}
+		})
+	}
+}
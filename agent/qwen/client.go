@@ -2,13 +2,17 @@ package qwen
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/credential"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/payload"
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/retry"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
 // Config Qwen配置
@@ -16,8 +20,19 @@ type Config struct {
 	APIKey  string
 	BaseURL string
 	Model   string
+	// Headers 可选，附加到每个请求的HTTP头（如组织ID、网关鉴权），同名时覆盖默认请求头
+	Headers map[string]string
+	// Credentials 可选，每次请求时获取API密钥，设置后优先于APIKey，用于在不重建客户端的情况下轮换密钥
+	Credentials func(ctx context.Context) (string, error)
+	// HTTPClient 可选，发送请求使用的HTTP客户端，多个客户端共享同一个时可以复用连接池，为nil时使用新建的默认客户端
+	HTTPClient *http.Client
+	// Retry 可选，限流、服务端错误和网络错误时的重试策略，为nil时不重试
+	Retry *RetryPolicy
 }
 
+// RetryPolicy HTTP请求的重试策略，退避时间翻倍并遵守Retry-After
+type RetryPolicy = retry.Policy
+
 // Client Qwen客户端
 type Client struct {
 	config     *Config
@@ -33,9 +48,13 @@ func NewClient(config *Config) *Client {
 		config.Model = "qwen-plus"
 	}
 	
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &Client{
 		config:     config,
-		httpClient: &http.Client{},
+		httpClient: httpClient,
 	}
 }
 
@@ -44,14 +63,32 @@ func (c *Client) GetProvider() string {
 	return "qwen"
 }
 
+// applyHeaders 设置配置中的自定义请求头
+func (c *Client) applyHeaders(httpReq *http.Request) {
+	for key, value := range c.config.Headers {
+		httpReq.Header.Set(key, value)
+	}
+}
+
+// do 按重试策略发送请求
+func (c *Client) do(httpReq *http.Request) (*http.Response, error) {
+	return c.config.Retry.Do(c.httpClient, httpReq)
+}
+
 // ValidateRequest 验证请求参数
-func (c *Client) ValidateRequest(req interface{}) error {
+func (c *Client) ValidateRequest(req *unified.ChatRequest) error {
 	// 可以添加特定的验证逻辑
 	return nil
 }
 
 // Chat 发送聊天请求
-func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error) {
+func (c *Client) Chat(ctx context.Context, req *unified.ChatRequest) (_ *unified.ChatResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	qwenReq, err := ToQwenRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to qwen request failed: %w", err)
@@ -62,20 +99,23 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 		qwenReq.Model = c.config.Model
 	}
 	
-	reqBody, err := json.Marshal(qwenReq)
+	reqBody, err := payload.JSON(qwenReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -83,19 +123,38 @@ func (c *Client) Chat(ctx context.Context, req interface{}) (interface{}, error)
 	
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
 	var qwenResp QwenChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&qwenResp); err != nil {
+	if !qwenReq.IncludeRawResponse {
+		// 不需要原始响应时直接从响应体流式解码，不缓存整个响应
+		if err := payload.DecodeJSON(resp.Body, &qwenResp); err != nil {
+			return nil, fmt.Errorf("decode response failed: %w", err)
+		}
+		return FromQwenResponse(&qwenResp), nil
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %w", err)
+	}
+	if err := json.Unmarshal(bodyBytes, &qwenResp); err != nil {
 		return nil, fmt.Errorf("decode response failed: %w", err)
 	}
-	
-	return FromQwenResponse(&qwenResp), nil
+	commonResp := FromQwenResponse(&qwenResp)
+	commonResp.RawResponse = bodyBytes
+	return commonResp, nil
 }
 
 // ChatStream 发送流式聊天请求
-func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interface{}, error) {
+func (c *Client) ChatStream(ctx context.Context, req *unified.ChatRequest) (_ <-chan QwenStreamResponse, err error) {
+	apiKey, err := credential.APIKey(ctx, c.config.APIKey, c.config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = credential.Redact(err, apiKey) }()
+
 	qwenReq, err := ToQwenRequest(req)
 	if err != nil {
 		return nil, fmt.Errorf("convert to qwen request failed: %w", err)
@@ -109,21 +168,24 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 		qwenReq.Model = c.config.Model
 	}
 	
-	reqBody, err := json.Marshal(qwenReq)
+	reqBody, err := payload.JSON(qwenReq)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request failed: %w", err)
 	}
+	defer reqBody.Release()
 	
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", nil)
 	if err != nil {
 		return nil, fmt.Errorf("create http request failed: %w", err)
 	}
+	reqBody.Attach(httpReq)
 	
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
 	httpReq.Header.Set("Accept", "text/event-stream")
+	c.applyHeaders(httpReq)
 	
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
@@ -131,15 +193,18 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("api request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, retry.NewStatusError(resp, body)
 	}
 	
-	ch := make(chan interface{}, 10)
+	ch := make(chan QwenStreamResponse, 10)
 	
 	go func() {
 		defer resp.Body.Close()
 		defer close(ch)
 		
+		// 关闭思考模式时不会有思考内容，不检测预先填充的<think>，回答文本立即输出
+		parser := NewThinkStreamParser(qwenReq.EnableThinking == nil || *qwenReq.EnableThinking)
+		var last QwenStreamResponse
 		scanner := bufio.NewScanner(resp.Body)
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -150,7 +215,7 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 			
 			data := strings.TrimPrefix(line, "data: ")
 			if data == "[DONE]" {
-				return
+				break
 			}
 			
 			var streamResp QwenStreamResponse
@@ -158,13 +223,31 @@ func (c *Client) ChatStream(ctx context.Context, req interface{}) (<-chan interf
 				continue
 			}
 			
-			// 转换为统一格式
+			// 拆分思考内容
+			SplitStreamThinking(&streamResp, parser)
+			last = streamResp
 			select {
 			case ch <- streamResp:
 			case <-ctx.Done():
 				return
 			}
 		}
+		
+		// 流结束时没有收到finish_reason，输出解析器中暂存的文本
+		reasoning, answer := parser.Flush()
+		if reasoning == "" && answer == "" {
+			return
+		}
+		select {
+		case ch <- QwenStreamResponse{
+			Id:      last.Id,
+			Object:  last.Object,
+			Created: last.Created,
+			Model:   last.Model,
+			Choices: []QwenStreamChoice{{Delta: QwenMessageDelta{Content: answer, ReasoningContent: reasoning}}},
+		}:
+		case <-ctx.Done():
+		}
 	}()
 	
 	return ch, nil
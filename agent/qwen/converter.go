@@ -2,94 +2,44 @@ package qwen
 
 import (
 	"encoding/json"
-	"fmt"
 	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/internal/schema"
+	"github.com/ccIisIaIcat/GoAgent/agent/unified"
 )
 
-// ToQwenRequest 将统一请求转换为Qwen请求
-func ToQwenRequest(req interface{}) (*QwenChatRequest, error) {
-	// 使用JSON序列化/反序列化来避免循环导入，参考OpenAI实现
-	reqBytes, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request failed: %w", err)
-	}
-	
-	var commonReq struct {
-		Model       string `json:"model"`
-		Messages    []struct {
-			Role     string `json:"role"`
-			Content  []struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ImageURL *struct {
-					URL    string `json:"url"`
-					Detail string `json:"detail,omitempty"`
-				} `json:"image_url,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-				ToolID string `json:"tool_id,omitempty"`
-			} `json:"content"`
-			Name      string `json:"name,omitempty"`
-			ToolCalls []struct {
-				ID       string          `json:"id"`
-				Type     string          `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			} `json:"tool_calls,omitempty"`
-		} `json:"messages"`
-		Tools       []struct {
-			Type     string `json:"type"`
-			Function struct {
-				Name        string                 `json:"name"`
-				Description string                 `json:"description"`
-				Parameters  map[string]interface{} `json:"parameters"`
-			} `json:"function"`
-		} `json:"tools,omitempty"`
-		MaxTokens    int     `json:"max_tokens,omitempty"`
-		Temperature  float64 `json:"temperature,omitempty"`
-		Stream       bool    `json:"stream,omitempty"`
-		SystemPrompt string  `json:"system_prompt,omitempty"`
-	}
-	
-	if err := json.Unmarshal(reqBytes, &commonReq); err != nil {
-		return nil, fmt.Errorf("unmarshal to common request failed: %w", err)
-	}
-	
+// ToQwenRequest 将统一请求转换为Qwen请求，不修改req
+func ToQwenRequest(req *unified.ChatRequest) (*QwenChatRequest, error) {
 	qwenReq := &QwenChatRequest{
-		Model:  commonReq.Model,
-		Stream: commonReq.Stream,
+		Model:  req.Model,
+		Stream: req.Stream,
 	}
 	
 	// 设置temperature
-	if commonReq.Temperature != 0 {
-		qwenReq.Temperature = &commonReq.Temperature
+	if req.HasTemperature() {
+		temperature := req.Temperature
+		qwenReq.Temperature = &temperature
 	}
+	qwenReq.TopP = req.TopP
 	
 	// 设置max_tokens
-	if commonReq.MaxTokens > 0 {
-		qwenReq.MaxTokens = &commonReq.MaxTokens
+	if req.MaxTokens > 0 {
+		maxTokens := req.MaxTokens
+		qwenReq.MaxTokens = &maxTokens
 	}
 	
 	// 处理系统消息 - Qwen将系统消息作为第一条消息
-	if commonReq.SystemPrompt != "" {
+	if req.SystemPrompt != "" {
 		qwenReq.Messages = append(qwenReq.Messages, QwenMessage{
 			Role:    "system",
-			Content: commonReq.SystemPrompt,
+			Content: req.SystemPrompt,
 		})
 	}
 	
 	// 转换消息
-	for _, msg := range commonReq.Messages {
+	for _, msg := range req.Messages {
 		qwenMsg := QwenMessage{
-			Role: msg.Role,
+			Role: string(msg.Role),
 			Name: msg.Name,
 		}
 		
@@ -115,7 +65,7 @@ func ToQwenRequest(req interface{}) (*QwenChatRequest, error) {
 							Type: "image_url",
 							ImageUrl: &QwenImageUrl{
 								Url:    content.ImageURL.URL,
-								Detail: content.ImageURL.Detail,
+								Detail: string(content.ImageURL.Detail),
 							},
 						})
 					}
@@ -181,190 +131,141 @@ func ToQwenRequest(req interface{}) (*QwenChatRequest, error) {
 		qwenReq.Messages = append(qwenReq.Messages, qwenMsg)
 	}
 	
+	// 预填充：partial模式从最后一条assistant消息的内容继续生成
+	if req.Prefill != "" {
+		qwenReq.Messages = append(qwenReq.Messages, QwenMessage{
+			Role:    "assistant",
+			Content: req.Prefill,
+			Partial: true,
+		})
+	}
+	
 	// 转换工具定义
-	for _, tool := range commonReq.Tools {
+	for _, tool := range req.Tools {
 		qwenReq.Tools = append(qwenReq.Tools, QwenTool{
 			Type: tool.Type,
 			Function: QwenFunctionDefine{
 				Name:        tool.Function.Name,
 				Description: tool.Function.Description,
-				Parameters:  tool.Function.Parameters,
+				Parameters:  schema.Sanitize(tool.Function.Parameters),
 			},
 		})
 	}
 	
+	// 思考模式开关，Extensions中的同名参数优先
+	qwenReq.EnableThinking = req.EnableThinking
+	applyExtensions(qwenReq, req.Extensions)
+
+	// 结构化输出，使用兼容模式的json_object，Schema由调用方写入提示词
+	if format := req.ResponseFormat; format != nil && format.Type != "" {
+		formatType := string(format.Type)
+		if formatType == "json_schema" {
+			formatType = "json_object"
+		}
+		qwenReq.ResponseFormat = &QwenResponseFormat{Type: formatType}
+	}
+
+	qwenReq.IncludeRawResponse = req.IncludeRawResponse
+	qwenReq.ProviderOptions = req.ProviderOptions["qwen"]
+
 	return qwenReq, nil
 }
 
+// applyExtensions 将统一请求中的扩展参数折叠进Qwen请求体
+func applyExtensions(qwenReq *QwenChatRequest, extensions map[string]interface{}) {
+	for key, value := range extensions {
+		switch key {
+		case ExtEnableSearch:
+			if b, ok := value.(bool); ok {
+				qwenReq.EnableSearch = &b
+				continue
+			}
+		case ExtEnableThinking:
+			if b, ok := value.(bool); ok {
+				qwenReq.EnableThinking = &b
+				continue
+			}
+		case ExtVLHighResolutionImages:
+			if b, ok := value.(bool); ok {
+				qwenReq.VLHighResolutionImages = &b
+				continue
+			}
+		}
+
+		if qwenReq.ExtraBody == nil {
+			qwenReq.ExtraBody = make(map[string]interface{})
+		}
+		qwenReq.ExtraBody[key] = value
+	}
+}
+
 // FromQwenResponse 将Qwen响应转换为统一响应
-func FromQwenResponse(resp *QwenChatResponse) interface{} {
-	// 使用匿名结构体返回统一的响应类型，避免循环导入
-	commonResp := struct {
-		ID      string    `json:"id"`
-		Object  string    `json:"object"`
-		Created time.Time `json:"created"`
-		Model   string    `json:"model"`
-		Choices []struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role     string `json:"role"`
-				Content  []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string          `json:"id"`
-						Type     string          `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
-	}{
+func FromQwenResponse(resp *QwenChatResponse) *unified.ChatResponse {
+	commonResp := &unified.ChatResponse{
 		ID:      resp.Id,
 		Object:  resp.Object,
 		Created: time.Unix(resp.Created, 0),
 		Model:   resp.Model,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
+		Usage: unified.Usage{
 			PromptTokens:     resp.Usage.PromptTokens,
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
 	}
-	
+
 	// 转换选择
 	for _, choice := range resp.Choices {
-		commonChoice := struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role     string `json:"role"`
-				Content  []struct {
-					Type     string `json:"type"`
-					Text     string `json:"text,omitempty"`
-					ToolCall *struct {
-						ID       string          `json:"id"`
-						Type     string          `json:"type"`
-						Function struct {
-							Name      string          `json:"name"`
-							Arguments json.RawMessage `json:"arguments"`
-						} `json:"function"`
-					} `json:"tool_call,omitempty"`
-				} `json:"content"`
-				ToolCalls []struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_calls,omitempty"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		}{
+		commonChoice := unified.Choice{
 			Index:        choice.Index,
 			FinishReason: choice.FinishReason,
 		}
-		
-		// 处理消息内容
-		commonChoice.Message.Role = choice.Message.Role
-		
+		commonChoice.Message.Role = unified.MessageRole(choice.Message.Role)
+
+		// 思考内容：有reasoning_content时直接使用，回答文本原样保留，否则从<think>标签中拆分
+		commonChoice.Message.ReasoningContent = choice.Message.ReasoningContent
+
 		// 如果是字符串内容
 		if textContent, ok := choice.Message.Content.(string); ok {
-			commonChoice.Message.Content = append(commonChoice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "text",
-				Text: textContent,
+			answer := textContent
+			if commonChoice.Message.ReasoningContent == "" {
+				commonChoice.Message.ReasoningContent, answer = SplitThinkContent(textContent)
+			}
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type: unified.ContentTypeText,
+				Text: answer,
 			})
 		}
-		
-		// 处理工具调用
+
+		// 处理工具调用，同时添加到内容中作为tool_call类型
 		for _, toolCall := range choice.Message.ToolCalls {
-			commonChoice.Message.ToolCalls = append(commonChoice.Message.ToolCalls, struct {
-				ID       string          `json:"id"`
-				Type     string          `json:"type"`
-				Function struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				} `json:"function"`
-			}{
+			call := unified.ToolCall{
 				ID:   toolCall.Id,
 				Type: toolCall.Type,
-				Function: struct {
-					Name      string          `json:"name"`
-					Arguments json.RawMessage `json:"arguments"`
-				}{
+				Function: unified.FunctionCall{
 					Name:      toolCall.Function.Name,
-					Arguments: json.RawMessage(toolCall.Function.Arguments),
-				},
-			})
-			
-			// 同时添加到内容中作为tool_call类型
-			commonChoice.Message.Content = append(commonChoice.Message.Content, struct {
-				Type     string `json:"type"`
-				Text     string `json:"text,omitempty"`
-				ToolCall *struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				} `json:"tool_call,omitempty"`
-			}{
-				Type: "tool_call",
-				ToolCall: &struct {
-					ID       string          `json:"id"`
-					Type     string          `json:"type"`
-					Function struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					} `json:"function"`
-				}{
-					ID:   toolCall.Id,
-					Type: toolCall.Type,
-					Function: struct {
-						Name      string          `json:"name"`
-						Arguments json.RawMessage `json:"arguments"`
-					}{
-						Name:      toolCall.Function.Name,
-						Arguments: json.RawMessage(toolCall.Function.Arguments),
-					},
+					Arguments: responseArguments(toolCall.Function.Arguments),
 				},
+			}
+			commonChoice.Message.ToolCalls = append(commonChoice.Message.ToolCalls, call)
+			contentCall := call
+			commonChoice.Message.Content = append(commonChoice.Message.Content, unified.Content{
+				Type:     unified.ContentTypeTool,
+				ToolCall: &contentCall,
 			})
 		}
-		
+
 		commonResp.Choices = append(commonResp.Choices, commonChoice)
 	}
-	
+
 	return commonResp
 }
+
+// responseArguments 将响应中的参数字符串转换为json.RawMessage，不是有效JSON的参数（如模型输出的格式错误的参数）
+// 转换为JSON字符串，避免整个响应无法转换，由调用方决定如何处理
+func responseArguments(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	quoted, _ := json.Marshal(arguments)
+	return quoted
+}
@@ -0,0 +1,162 @@
+package qwen
+
+import "strings"
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// SplitThinkContent 将包含<think>标签的完整文本拆分为思考内容和最终回答
+// 部分模型模板会预先填充<think>，输出中只有结束标签，此时结束标签之前的文本都是思考内容
+func SplitThinkContent(text string) (reasoning string, answer string) {
+	parser := NewThinkStreamParser(true)
+	reasoning, answer = parser.Feed(text)
+	restReasoning, restAnswer := parser.Flush()
+	reasoning += restReasoning
+	answer += restAnswer
+	return strings.TrimSpace(reasoning), strings.TrimLeft(answer, "\r\n")
+}
+
+// ThinkStreamParser 流式解析<think>标签，标签可能被拆分到多个分片中
+type ThinkStreamParser struct {
+	inThink bool
+	pending string // 可能是标签前缀的未决文本
+	// detecting 为true时还没有出现任何标签，文本暂存在held中：
+	// 先出现</think>说明模板预先填充了<think>，暂存的文本是思考内容；先出现<think>或流结束时按普通文本处理
+	detecting bool
+	held      string
+	// passthrough 为true时提供商已通过reasoning_content单独返回思考内容，之后的文本都是回答，不再解析标签
+	passthrough bool
+}
+
+// NewThinkStreamParser 创建解析器，detectPrefill为true时检测模板预先填充的<think>
+// 检测期间（出现第一个标签之前）的文本暂存到确定归属后才输出，确定不会输出思考内容时（如关闭思考模式）传入false以立即输出
+func NewThinkStreamParser(detectPrefill bool) *ThinkStreamParser {
+	return &ThinkStreamParser{detecting: detectPrefill}
+}
+
+// Feed 输入一个文本分片，返回其中可以确定归属的思考内容和回答内容
+func (p *ThinkStreamParser) Feed(chunk string) (reasoning string, answer string) {
+	if p.passthrough {
+		return "", chunk
+	}
+	if p.detecting {
+		text := p.held + chunk
+		openIdx, closeIdx := strings.Index(text, thinkOpenTag), strings.Index(text, thinkCloseTag)
+		switch {
+		case closeIdx >= 0 && (openIdx < 0 || closeIdx < openIdx):
+			// 只有结束标签：之前的文本都是思考内容
+			p.detecting, p.held = false, ""
+			restReasoning, restAnswer := p.Feed(text[closeIdx+len(thinkCloseTag):])
+			return text[:closeIdx] + restReasoning, restAnswer
+		case openIdx >= 0:
+			p.detecting, p.held = false, ""
+			chunk = text
+		default:
+			p.held = text
+			return "", ""
+		}
+	}
+
+	text := p.pending + chunk
+	p.pending = ""
+
+	var reasoningBuilder, answerBuilder strings.Builder
+	for text != "" {
+		tag := thinkOpenTag
+		if p.inThink {
+			tag = thinkCloseTag
+		}
+
+		idx := strings.Index(text, tag)
+		if idx >= 0 {
+			p.write(&reasoningBuilder, &answerBuilder, text[:idx])
+			text = text[idx+len(tag):]
+			p.inThink = !p.inThink
+			continue
+		}
+
+		// 末尾可能是被截断的标签，暂存等待下一个分片
+		keep := partialTagSuffix(text, tag)
+		p.write(&reasoningBuilder, &answerBuilder, text[:len(text)-keep])
+		p.pending = text[len(text)-keep:]
+		break
+	}
+
+	return reasoningBuilder.String(), answerBuilder.String()
+}
+
+// StopParsing 停止解析<think>标签，暂存的文本按Flush的规则输出，之后的文本都作为回答
+// 提供商通过reasoning_content单独返回思考内容时调用，回答文本中的标签是回答的一部分
+func (p *ThinkStreamParser) StopParsing() (reasoning string, answer string) {
+	if p.passthrough {
+		return "", ""
+	}
+	reasoning, answer = p.Flush()
+	p.passthrough = true
+	return reasoning, answer
+}
+
+// Flush 在流结束时输出所有暂存的文本，没有出现任何标签时暂存的文本属于回答
+func (p *ThinkStreamParser) Flush() (reasoning string, answer string) {
+	if p.detecting {
+		text := p.held
+		p.detecting, p.held = false, ""
+		return "", text
+	}
+	if p.pending == "" {
+		return "", ""
+	}
+	text := p.pending
+	p.pending = ""
+	if p.inThink {
+		return text, ""
+	}
+	return "", text
+}
+
+// write 根据当前状态写入对应的缓冲区
+func (p *ThinkStreamParser) write(reasoning, answer *strings.Builder, text string) {
+	if p.inThink {
+		reasoning.WriteString(text)
+	} else {
+		answer.WriteString(text)
+	}
+}
+
+// partialTagSuffix 返回text末尾与tag前缀重合的长度
+func partialTagSuffix(text, tag string) int {
+	maxLen := len(tag) - 1
+	if maxLen > len(text) {
+		maxLen = len(text)
+	}
+	for n := maxLen; n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// SplitStreamThinking 将流式分片中<think>标签内的文本移到reasoning_content，不会混入回答文本
+// 标签可能跨分片，parser在整个流中共用；结束分片中输出暂存的文本，没有结束分片时调用方在流结束时调用parser.Flush
+func SplitStreamThinking(resp *QwenStreamResponse, parser *ThinkStreamParser) {
+	for i := range resp.Choices {
+		delta := &resp.Choices[i].Delta
+		var reasoning, answer string
+		if delta.ReasoningContent != "" {
+			reasoning, answer = parser.StopParsing()
+		}
+		chunkReasoning, chunkAnswer := parser.Feed(delta.Content)
+		reasoning += chunkReasoning
+		answer += chunkAnswer
+		if resp.Choices[i].FinishReason != nil {
+			restReasoning, restAnswer := parser.Flush()
+			reasoning += restReasoning
+			answer += restAnswer
+		}
+		delta.ReasoningContent += reasoning
+		delta.Content = answer
+	}
+}
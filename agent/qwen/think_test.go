@@ -0,0 +1,83 @@
+package qwen
+
+import "testing"
+
+// feedChunks 依次输入分片并在结束时Flush，返回拼接后的思考内容和回答
+func feedChunks(parser *ThinkStreamParser, chunks []string) (string, string) {
+	var reasoning, answer string
+	for _, chunk := range chunks {
+		r, a := parser.Feed(chunk)
+		reasoning += r
+		answer += a
+	}
+	r, a := parser.Flush()
+	return reasoning + r, answer + a
+}
+
+func TestThinkStreamParserSplitTags(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		detectPrefill bool
+		reasoning     string
+		answer        string
+	}{
+		{"both tags", "<think>plan</think>answer", true, "plan", "answer"},
+		{"both tags without detection", "<think>plan</think>answer", false, "plan", "answer"},
+		{"prefilled open tag", "plan</think>answer", true, "plan", "answer"},
+		{"no tags", "just an answer", true, "", "just an answer"},
+		{"tag-like text", "a <thin b", true, "", "a <thin b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 在每个位置拆成两个分片，标签被拆开的情况都被覆盖
+			for i := 0; i <= len(tt.text); i++ {
+				chunks := []string{tt.text[:i], tt.text[i:]}
+				reasoning, answer := feedChunks(NewThinkStreamParser(tt.detectPrefill), chunks)
+				if reasoning != tt.reasoning || answer != tt.answer {
+					t.Errorf("split %q|%q = (%q, %q), want (%q, %q)", chunks[0], chunks[1], reasoning, answer, tt.reasoning, tt.answer)
+				}
+			}
+			// 每个字节一个分片
+			var chunks []string
+			for i := range tt.text {
+				chunks = append(chunks, tt.text[i:i+1])
+			}
+			reasoning, answer := feedChunks(NewThinkStreamParser(tt.detectPrefill), chunks)
+			if reasoning != tt.reasoning || answer != tt.answer {
+				t.Errorf("byte chunks = (%q, %q), want (%q, %q)", reasoning, answer, tt.reasoning, tt.answer)
+			}
+		})
+	}
+}
+
+func TestSplitStreamThinkingAcrossChunks(t *testing.T) {
+	stop := "stop"
+	chunks := []string{"<th", "ink>pl", "an</thi", "nk>ans", "wer"}
+	parser := NewThinkStreamParser(true)
+	var reasoning, answer string
+	for i, content := range chunks {
+		resp := &QwenStreamResponse{Choices: []QwenStreamChoice{{Delta: QwenMessageDelta{Content: content}}}}
+		if i == len(chunks)-1 {
+			resp.Choices[0].FinishReason = &stop
+		}
+		SplitStreamThinking(resp, parser)
+		reasoning += resp.Choices[0].Delta.ReasoningContent
+		answer += resp.Choices[0].Delta.Content
+	}
+	if reasoning != "plan" || answer != "answer" {
+		t.Errorf("got (%q, %q), want (plan, answer)", reasoning, answer)
+	}
+
+	// 提供商单独返回reasoning_content时，回答中的标签原样保留
+	parser = NewThinkStreamParser(true)
+	resp := &QwenStreamResponse{Choices: []QwenStreamChoice{{Delta: QwenMessageDelta{ReasoningContent: "plan", Content: "use <th"}}}}
+	SplitStreamThinking(resp, parser)
+	answer = resp.Choices[0].Delta.Content
+	resp = &QwenStreamResponse{Choices: []QwenStreamChoice{{Delta: QwenMessageDelta{Content: "ink> tags"}, FinishReason: &stop}}}
+	SplitStreamThinking(resp, parser)
+	answer += resp.Choices[0].Delta.Content
+	if answer != "use <think> tags" {
+		t.Errorf("answer with reasoning_content = %q, want the tags kept", answer)
+	}
+}
@@ -1,5 +1,18 @@
 package qwen
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// DashScope扩展参数名称
+const (
+	ExtEnableSearch           = "enable_search"
+	ExtEnableThinking         = "enable_thinking"
+	ExtVLHighResolutionImages = "vl_high_resolution_images"
+)
+
 // QwenChatRequest Qwen聊天请求（基于OpenAI格式）
 type QwenChatRequest struct {
 	Model            string                 `json:"model"`
@@ -16,6 +29,103 @@ type QwenChatRequest struct {
 	FrequencyPenalty *float64               `json:"frequency_penalty,omitempty"`
 	LogitBias        map[string]interface{} `json:"logit_bias,omitempty"`
 	User             string                 `json:"user,omitempty"`
+	ResponseFormat   *QwenResponseFormat    `json:"response_format,omitempty"`
+
+	// DashScope扩展参数
+	EnableSearch           *bool `json:"enable_search,omitempty"`
+	EnableThinking         *bool `json:"enable_thinking,omitempty"`
+	VLHighResolutionImages *bool `json:"vl_high_resolution_images,omitempty"`
+
+	// ExtraBody 其他未建模的扩展参数，序列化时合并到请求体顶层
+	ExtraBody map[string]interface{} `json:"-"`
+
+	// IncludeRawResponse 是否在响应中保留提供商返回的原始JSON，不参与序列化
+	IncludeRawResponse bool `json:"-"`
+
+	// ProviderOptions 提供商特有的请求参数，序列化时深度合并到请求体中，优先级高于已建模的字段
+	ProviderOptions map[string]interface{} `json:"-"`
+}
+
+// QwenResponseFormat 结构化输出格式（text或json_object）
+type QwenResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// MarshalJSON 序列化请求，并将ExtraBody和ProviderOptions中的字段合并到请求体中
+func (r QwenChatRequest) MarshalJSON() ([]byte, error) {
+	type alias QwenChatRequest
+	data, err := json.Marshal(alias(r))
+	if err != nil {
+		return nil, err
+	}
+	if len(r.ExtraBody) == 0 {
+		return mergeProviderOptions(data, r.ProviderOptions)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	for key, value := range r.ExtraBody {
+		// 已建模的字段优先，避免扩展参数覆盖核心参数
+		if _, exists := body[key]; !exists {
+			body[key] = value
+		}
+	}
+	data, err = json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return mergeProviderOptions(data, r.ProviderOptions)
+}
+
+// mergeProviderOptions 将ProviderOptions深度合并到序列化后的请求体中
+// 同名字段以ProviderOptions为准，两边都是对象时合并子字段，值为nil时删除该字段
+func mergeProviderOptions(data []byte, options map[string]interface{}) ([]byte, error) {
+	if len(options) == 0 {
+		return data, nil
+	}
+
+	var body map[string]interface{}
+	if err := decodeJSONObject(data, &body); err != nil {
+		return nil, err
+	}
+	// 先序列化一次，使结构体等类型的值统一为map，便于深度合并
+	optionBytes, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provider options failed: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := decodeJSONObject(optionBytes, &normalized); err != nil {
+		return nil, err
+	}
+
+	mergeJSONObject(body, normalized)
+	return json.Marshal(body)
+}
+
+// mergeJSONObject 递归合并JSON对象
+func mergeJSONObject(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		srcObj, srcIsObj := value.(map[string]interface{})
+		dstObj, dstIsObj := dst[key].(map[string]interface{})
+		if srcIsObj && dstIsObj {
+			mergeJSONObject(dstObj, srcObj)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decodeJSONObject 解析JSON对象，数字保留为json.Number以免大整数丢失精度
+func decodeJSONObject(data []byte, v *map[string]interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
 }
 
 // QwenMessage Qwen消息
@@ -25,6 +135,10 @@ type QwenMessage struct {
 	Name       string         `json:"name,omitempty"`
 	ToolCalls  []QwenToolCall `json:"tool_calls,omitempty"`
 	ToolCallId string         `json:"tool_call_id,omitempty"`
+	// ReasoningContent Qwen3思考模式下返回的思考内容，仅出现在响应中
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// Partial 前缀续写（partial模式），仅用于最后一条assistant消息
+	Partial bool `json:"partial,omitempty"`
 }
 
 // QwenContent Qwen内容
@@ -42,6 +156,7 @@ type QwenImageUrl struct {
 
 // QwenToolCall Qwen工具调用
 type QwenToolCall struct {
+	Index    *int             `json:"index,omitempty"` // 流式增量中工具调用的序号
 	Id       string           `json:"id"`
 	Type     string           `json:"type"`
 	Function QwenFunctionCall `json:"function"`
@@ -113,9 +228,10 @@ type QwenStreamChoice struct {
 
 // QwenMessageDelta Qwen消息增量
 type QwenMessageDelta struct {
-	Role      string         `json:"role,omitempty"`
-	Content   string         `json:"content,omitempty"`
-	ToolCalls []QwenToolCall `json:"tool_calls,omitempty"`
+	Role             string         `json:"role,omitempty"`
+	Content          string         `json:"content,omitempty"`
+	ReasoningContent string         `json:"reasoning_content,omitempty"`
+	ToolCalls        []QwenToolCall `json:"tool_calls,omitempty"`
 }
 
 // QwenErrorResponse Qwen错误响应
@@ -0,0 +1,132 @@
+package tenant
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+)
+
+var (
+	// ErrInvalidKey API Key无效、已吊销或已过期
+	ErrInvalidKey = errors.New("API Key无效")
+	// ErrForbidden API Key的范围不包含请求的会话
+	ErrForbidden = errors.New("无权访问该会话")
+)
+
+// keyPrefix 生成的API Key的前缀，便于在日志和密钥扫描中识别
+const keyPrefix = "gak_"
+
+// Scope API Key的访问范围
+type Scope struct {
+	TenantID  string
+	SessionID string    // 为空时可以访问租户的所有会话
+	Expires   time.Time // 为零值时不过期
+}
+
+// keyRecord 保存的API Key信息，只保存Key的哈希
+type keyRecord struct {
+	scope Scope
+}
+
+// scopeKey 在context中保存Scope的键
+type scopeKey struct{}
+
+// IssueKey 为租户（或租户的一个会话）生成API Key，Key只在此时返回一次，注册表中只保存其哈希
+func (r *Registry) IssueKey(scope Scope) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tenants[scope.TenantID] == nil {
+		return "", ErrUnknownTenant
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成API Key失败: %w", err)
+	}
+	key := keyPrefix + hex.EncodeToString(buf)
+	r.keys[hashKey(key)] = keyRecord{scope: scope}
+	return key, nil
+}
+
+// RevokeKey 吊销API Key
+func (r *Registry) RevokeKey(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, hashKey(key))
+}
+
+// Authenticate 返回API Key的访问范围，过期的Key会被移除
+func (r *Registry) Authenticate(key string) (Scope, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hash := hashKey(key)
+	record, ok := r.keys[hash]
+	if !ok {
+		return Scope{}, ErrInvalidKey
+	}
+	if !record.scope.Expires.IsZero() && time.Now().After(record.scope.Expires) {
+		delete(r.keys, hash)
+		return Scope{}, ErrInvalidKey
+	}
+	if r.tenants[record.scope.TenantID] == nil {
+		return Scope{}, ErrUnknownTenant
+	}
+	return record.scope, nil
+}
+
+// SessionFor 按访问范围返回会话，sessionID为空时使用范围限定的会话
+func (r *Registry) SessionFor(scope Scope, sessionID string) (*ConversationManager.ConversationManager, error) {
+	if sessionID == "" {
+		sessionID = scope.SessionID
+	}
+	if scope.SessionID != "" && sessionID != scope.SessionID {
+		return nil, ErrForbidden
+	}
+	return r.Session(scope.TenantID, sessionID)
+}
+
+// Middleware 校验请求中的API Key（Authorization: Bearer或X-API-Key请求头），
+// 通过后将访问范围放入请求的context，处理函数通过ScopeFromContext获取
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get("X-API-Key")
+		if auth := req.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "缺少API Key", http.StatusUnauthorized)
+			return
+		}
+		scope, err := r.Authenticate(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(WithScope(req.Context(), scope)))
+	})
+}
+
+// WithScope 返回带有访问范围的context
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext 获取Middleware放入context的访问范围
+func ScopeFromContext(ctx context.Context) (Scope, bool) {
+	scope, ok := ctx.Value(scopeKey{}).(Scope)
+	return scope, ok
+}
+
+// hashKey API Key的SHA-256
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
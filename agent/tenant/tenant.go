@@ -0,0 +1,233 @@
+// Package tenant 让一个GoAgent服务同时服务多个客户：每个租户有自己的提供商配置（API Key）、
+// 共享预算、工具允许列表和相互隔离的会话历史，调用方通过限定租户（和会话）范围的API Key访问
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+var (
+	// ErrUnknownTenant 租户不存在
+	ErrUnknownTenant = errors.New("租户不存在")
+	// ErrTooManySessions 租户的会话数达到上限
+	ErrTooManySessions = errors.New("会话数已达上限")
+)
+
+// Tenant 一个租户的配置
+type Tenant struct {
+	ID string
+	// Providers 租户自己的提供商配置，每个租户使用独立的AgentManager，API Key不会被其他租户使用
+	Providers []*general.ProviderConfig
+	// Budget 租户所有会话共享的预算，为nil时不限制
+	Budget *ConversationManager.Budget
+	// AllowedTools 租户可以使用的工具，为空时不限制
+	AllowedTools []string
+	// AllowedModels 租户可以使用的模型，为空时不限制；租户的AgentManager在发送请求前检查，会话无法绕过
+	AllowedModels []string
+	// MaxSessions 租户同时保留的会话数上限，0表示不限制
+	MaxSessions int
+	// Setup 新会话创建后调用，用于设置系统提示词、注册工具等，在应用工具允许列表之前调用
+	Setup func(cm *ConversationManager.ConversationManager) error
+}
+
+// Registry 租户和会话的注册表，并发安全
+type Registry struct {
+	mu         sync.Mutex
+	tenants    map[string]*tenantState
+	keys       map[string]keyRecord // API Key的SHA-256到其范围
+	httpClient *http.Client         // 所有租户共享的HTTP客户端，复用到提供商的连接
+}
+
+// tenantState 租户及其会话
+type tenantState struct {
+	tenant   Tenant
+	manager  *general.AgentManager
+	sessions map[string]*ConversationManager.ConversationManager
+}
+
+// NewRegistry 创建空的注册表
+func NewRegistry() *Registry {
+	return &Registry{
+		tenants:    make(map[string]*tenantState),
+		keys:       make(map[string]keyRecord),
+		httpClient: general.NewHTTPClient(general.TransportConfig{}),
+	}
+}
+
+// AddTenant 添加租户，ID已存在时替换其配置：已有会话保留，之后新建的会话使用新配置
+func (r *Registry) AddTenant(tenant Tenant) error {
+	if tenant.ID == "" {
+		return fmt.Errorf("租户ID不能为空")
+	}
+	manager := general.NewAgentManager()
+	manager.SetHTTPClient(r.httpClient)
+	manager.SetAllowedModels(tenant.AllowedModels...)
+	for _, provider := range tenant.Providers {
+		if err := manager.AddProvider(provider); err != nil {
+			return fmt.Errorf("租户 %s 的提供商 %s 配置错误: %w", tenant.ID, provider.Provider, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := &tenantState{tenant: tenant, manager: manager, sessions: make(map[string]*ConversationManager.ConversationManager)}
+	if existing := r.tenants[tenant.ID]; existing != nil {
+		state.sessions = existing.sessions
+	}
+	r.tenants[tenant.ID] = state
+	return nil
+}
+
+// RemoveTenant 移除租户，关闭其所有会话并吊销其所有API Key
+func (r *Registry) RemoveTenant(ctx context.Context, tenantID string) error {
+	r.mu.Lock()
+	state := r.tenants[tenantID]
+	delete(r.tenants, tenantID)
+	for hash, record := range r.keys {
+		if record.scope.TenantID == tenantID {
+			delete(r.keys, hash)
+		}
+	}
+	r.mu.Unlock()
+	if state == nil {
+		return ErrUnknownTenant
+	}
+	var errs []error
+	for _, cm := range state.sessions {
+		if err := cm.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Tenants 返回所有租户的ID
+func (r *Registry) Tenants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.tenants))
+	for id := range r.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Session 返回租户的会话，不存在时按租户配置创建；不同租户的同名会话相互独立
+// Setup在锁外调用，可以回调注册表；并发创建同一会话时只保留先完成的一个
+func (r *Registry) Session(tenantID, sessionID string) (*ConversationManager.ConversationManager, error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("会话ID不能为空")
+	}
+	r.mu.Lock()
+	state, cm, err := r.lookupSession(tenantID, sessionID)
+	r.mu.Unlock()
+	if cm != nil || err != nil {
+		return cm, err
+	}
+
+	cm = ConversationManager.NewConversationManager(state.manager)
+	if state.tenant.Budget != nil {
+		cm.AddBudget(state.tenant.Budget)
+	}
+	if state.tenant.Setup != nil {
+		if err := state.tenant.Setup(cm); err != nil {
+			return nil, fmt.Errorf("初始化租户 %s 的会话失败: %w", tenantID, err)
+		}
+	}
+	cm.SetToolAllowlist(state.tenant.AllowedTools...)
+
+	// Setup期间租户可能被替换或移除、会话可能已被创建或达到上限，重新检查
+	r.mu.Lock()
+	current, existing, err := r.lookupSession(tenantID, sessionID)
+	if err == nil && existing == nil {
+		current.sessions[sessionID] = cm
+	}
+	r.mu.Unlock()
+	if existing != nil || err != nil {
+		// 丢弃的会话可能已在Setup中启动了MCP服务等资源
+		cm.Shutdown(context.Background())
+	}
+	if existing != nil {
+		return existing, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// lookupSession 返回租户状态和已有的会话，会话不存在且已达上限时返回ErrTooManySessions，调用时持有r.mu
+func (r *Registry) lookupSession(tenantID, sessionID string) (*tenantState, *ConversationManager.ConversationManager, error) {
+	state := r.tenants[tenantID]
+	if state == nil {
+		return nil, nil, ErrUnknownTenant
+	}
+	if cm := state.sessions[sessionID]; cm != nil {
+		return state, cm, nil
+	}
+	if state.tenant.MaxSessions > 0 && len(state.sessions) >= state.tenant.MaxSessions {
+		return nil, nil, fmt.Errorf("租户 %s: %w (%d)", tenantID, ErrTooManySessions, state.tenant.MaxSessions)
+	}
+	return state, nil, nil
+}
+
+// Sessions 返回租户的所有会话ID
+func (r *Registry) Sessions(tenantID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.tenants[tenantID]
+	if state == nil {
+		return nil, ErrUnknownTenant
+	}
+	ids := make([]string, 0, len(state.sessions))
+	for id := range state.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// CloseSession 关闭并移除租户的会话
+func (r *Registry) CloseSession(ctx context.Context, tenantID, sessionID string) error {
+	r.mu.Lock()
+	state := r.tenants[tenantID]
+	if state == nil {
+		r.mu.Unlock()
+		return ErrUnknownTenant
+	}
+	cm := state.sessions[sessionID]
+	delete(state.sessions, sessionID)
+	r.mu.Unlock()
+	if cm == nil {
+		return fmt.Errorf("会话 %s 不存在", sessionID)
+	}
+	return cm.Shutdown(ctx)
+}
+
+// CheckModel 检查租户是否可以使用该模型，用于在发送前提前检查；会话的请求由租户的AgentManager强制检查
+func (r *Registry) CheckModel(tenantID string, model string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.tenants[tenantID]
+	if state == nil {
+		return ErrUnknownTenant
+	}
+	if len(state.tenant.AllowedModels) == 0 {
+		return nil
+	}
+	for _, allowed := range state.tenant.AllowedModels {
+		if allowed == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("租户 %s 不能使用模型 %s", tenantID, model)
+}
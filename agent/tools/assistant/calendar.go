@@ -0,0 +1,506 @@
+package assistant
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// googleCalendarBaseURL Google Calendar API地址
+var googleCalendarBaseURL = "https://www.googleapis.com/calendar/v3"
+
+// maxCalendarEvents list_events最多返回的日程数量
+const maxCalendarEvents = 50
+
+// maxCalendarResponseSize 读取响应的最大字节数
+const maxCalendarResponseSize = 4 << 20
+
+// calendarEvent 工具返回的日程
+type calendarEvent struct {
+	ID          string `json:"id,omitempty"`
+	Summary     string `json:"summary"`
+	Start       string `json:"start"`
+	End         string `json:"end,omitempty"`
+	AllDay      bool   `json:"all_day,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	start time.Time
+}
+
+// calendar 列出和创建日程
+type calendar struct {
+	config   CalendarConfig
+	location *time.Location
+	client   *http.Client
+}
+
+// newCalendar 创建日历客户端
+func newCalendar(config CalendarConfig) (*calendar, error) {
+	c := &calendar{config: config, location: time.Local, client: &http.Client{Timeout: defaultTimeout}}
+	c.config.Password = expandSecret(c.config.Password)
+	c.config.Token = expandSecret(c.config.Token)
+	if c.config.CalendarID == "" {
+		c.config.CalendarID = "primary"
+	}
+	if config.TimeZone != "" {
+		location, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("无效的时区 %q: %w", config.TimeZone, err)
+		}
+		c.location = location
+	}
+	return c, nil
+}
+
+// ListEvents 列出时间范围内的日程，按开始时间排序
+func (c *calendar) ListEvents(start, end string) (string, error) {
+	from := time.Now()
+	if strings.TrimSpace(start) != "" {
+		t, err := parseEventTime(start, c.location)
+		if err != nil {
+			return "", err
+		}
+		from = t
+	}
+	to := from.AddDate(0, 0, 7)
+	if strings.TrimSpace(end) != "" {
+		t, err := parseEventTime(end, c.location)
+		if err != nil {
+			return "", err
+		}
+		to = t
+	}
+	if !to.After(from) {
+		return "", fmt.Errorf("结束时间必须晚于开始时间")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	var events []calendarEvent
+	var err error
+	if c.config.Type == CalendarGoogle {
+		events, err = c.googleList(ctx, from, to)
+	} else {
+		events, err = c.caldavList(ctx, from, to)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(events) == 0 {
+		return "这段时间没有日程", nil
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+	if len(events) > maxCalendarEvents {
+		events = events[:maxCalendarEvents]
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("序列化结果失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// CreateEvent 创建日程，返回日程ID
+func (c *calendar) CreateEvent(summary, start, end, location, description string) (string, error) {
+	if strings.TrimSpace(summary) == "" {
+		return "", fmt.Errorf("日程标题不能为空")
+	}
+	from, err := parseEventTime(start, c.location)
+	if err != nil {
+		return "", err
+	}
+	to := from.Add(time.Hour)
+	if strings.TrimSpace(end) != "" {
+		if to, err = parseEventTime(end, c.location); err != nil {
+			return "", err
+		}
+	}
+	if !to.After(from) {
+		return "", fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	event := calendarEvent{Summary: summary, Location: location, Description: description}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	var id string
+	if c.config.Type == CalendarGoogle {
+		id, err = c.googleCreate(ctx, event, from, to)
+	} else {
+		id, err = c.caldavCreate(ctx, event, from, to)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("已创建日程 %s（%s 至 %s），ID: %s", summary, from.In(c.location).Format("2006-01-02 15:04"), to.In(c.location).Format("2006-01-02 15:04"), id), nil
+}
+
+// parseEventTime 解析RFC3339或不带时区的日期时间，不带时区时使用loc
+func parseEventTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q，请使用如2024-05-01 09:00的格式", value)
+}
+
+// do 发送请求并读取响应，状态码为400及以上时返回错误
+func (c *calendar) do(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求日历服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCalendarResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("读取日历服务响应失败: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("日历服务返回HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// googleEventTime Google Calendar的时间，全天日程使用date
+type googleEventTime struct {
+	DateTime string `json:"dateTime,omitempty"`
+	Date     string `json:"date,omitempty"`
+}
+
+// googleEvent Google Calendar的日程
+type googleEvent struct {
+	ID          string          `json:"id,omitempty"`
+	Summary     string          `json:"summary,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Location    string          `json:"location,omitempty"`
+	Start       googleEventTime `json:"start"`
+	End         googleEventTime `json:"end"`
+}
+
+// googleRequest 创建带访问令牌的Google Calendar请求
+func (c *calendar) googleRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	token := c.config.Token
+	if c.config.Credentials != nil {
+		key, err := c.config.Credentials.APIKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("获取Google访问令牌失败: %w", err)
+		}
+		token = key
+	}
+	requestURL := googleCalendarBaseURL + "/calendars/" + url.PathEscape(c.config.CalendarID) + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// googleList 列出Google Calendar中的日程，重复日程展开为单次日程
+func (c *calendar) googleList(ctx context.Context, from, to time.Time) ([]calendarEvent, error) {
+	query := url.Values{
+		"timeMin":      {from.Format(time.RFC3339)},
+		"timeMax":      {to.Format(time.RFC3339)},
+		"singleEvents": {"true"},
+		"orderBy":      {"startTime"},
+		"maxResults":   {fmt.Sprint(maxCalendarEvents)},
+	}
+	req, err := c.googleRequest(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Items []googleEvent `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("解析日历服务响应失败: %w", err)
+	}
+
+	events := make([]calendarEvent, 0, len(result.Items))
+	for _, item := range result.Items {
+		event := calendarEvent{ID: item.ID, Summary: item.Summary, Location: item.Location, Description: item.Description}
+		if item.Start.DateTime != "" {
+			event.start, _ = time.Parse(time.RFC3339, item.Start.DateTime)
+			event.Start = event.start.In(c.location).Format(time.RFC3339)
+			if end, err := time.Parse(time.RFC3339, item.End.DateTime); err == nil {
+				event.End = end.In(c.location).Format(time.RFC3339)
+			}
+		} else {
+			event.start, _ = time.ParseInLocation("2006-01-02", item.Start.Date, c.location)
+			event.Start, event.End, event.AllDay = item.Start.Date, item.End.Date, true
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// googleCreate 在Google Calendar中创建日程
+func (c *calendar) googleCreate(ctx context.Context, event calendarEvent, from, to time.Time) (string, error) {
+	body := googleEvent{
+		Summary:     event.Summary,
+		Description: event.Description,
+		Location:    event.Location,
+		Start:       googleEventTime{DateTime: from.Format(time.RFC3339)},
+		End:         googleEventTime{DateTime: to.Format(time.RFC3339)},
+	}
+	req, err := c.googleRequest(ctx, http.MethodPost, "/events", nil, body)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	var created googleEvent
+	if err := json.Unmarshal(data, &created); err != nil {
+		return "", fmt.Errorf("解析日历服务响应失败: %w", err)
+	}
+	return created.ID, nil
+}
+
+// caldavMultistatus REPORT响应，标签只匹配本地名称
+type caldavMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			CalendarData string `xml:"prop>calendar-data"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// caldavRequest 创建带Basic认证的CalDAV请求
+func (c *calendar) caldavRequest(ctx context.Context, method, requestURL string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	return req, nil
+}
+
+// caldavList 通过calendar-query列出时间范围内的日程，重复日程只返回第一次
+func (c *calendar) caldavList(ctx context.Context, from, to time.Time) ([]calendarEvent, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><c:calendar-data/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">
+        <c:time-range start="` + from.UTC().Format("20060102T150405Z") + `" end="` + to.UTC().Format("20060102T150405Z") + `"/>
+      </c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+	req, err := c.caldavRequest(ctx, "REPORT", c.config.URL, []byte(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	data, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var multistatus caldavMultistatus
+	if err := xml.Unmarshal(data, &multistatus); err != nil {
+		return nil, fmt.Errorf("解析日历服务响应失败: %w", err)
+	}
+
+	var events []calendarEvent
+	for _, response := range multistatus.Responses {
+		for _, propstat := range response.Propstats {
+			if propstat.CalendarData == "" {
+				continue
+			}
+			events = append(events, parseICalendar(propstat.CalendarData, c.location)...)
+		}
+	}
+	return events, nil
+}
+
+// caldavCreate 以新的iCalendar对象创建日程
+func (c *calendar) caldavCreate(ctx context.Context, event calendarEvent, from, to time.Time) (string, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	uid := hex.EncodeToString(id)
+
+	var b strings.Builder
+	writeLine := func(line string) { b.WriteString(foldICalendarLine(line) + "\r\n") }
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:-//GoAgent//Assistant Tools//EN")
+	writeLine("BEGIN:VEVENT")
+	writeLine("UID:" + uid)
+	writeLine("DTSTAMP:" + time.Now().UTC().Format("20060102T150405Z"))
+	writeLine("DTSTART:" + from.UTC().Format("20060102T150405Z"))
+	writeLine("DTEND:" + to.UTC().Format("20060102T150405Z"))
+	writeLine("SUMMARY:" + escapeICalendarText(event.Summary))
+	if event.Location != "" {
+		writeLine("LOCATION:" + escapeICalendarText(event.Location))
+	}
+	if event.Description != "" {
+		writeLine("DESCRIPTION:" + escapeICalendarText(event.Description))
+	}
+	writeLine("END:VEVENT")
+	writeLine("END:VCALENDAR")
+
+	req, err := c.caldavRequest(ctx, http.MethodPut, strings.TrimRight(c.config.URL, "/")+"/"+uid+".ics", []byte(b.String()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	req.Header.Set("If-None-Match", "*")
+	if _, err := c.do(req); err != nil {
+		return "", err
+	}
+	return uid, nil
+}
+
+// parseICalendar 解析iCalendar数据中的VEVENT
+func parseICalendar(data string, loc *time.Location) []calendarEvent {
+	// 展开折叠的行
+	data = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(data)
+	var events []calendarEvent
+	var event *calendarEvent
+	var startDate, endDate icalTime
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		nameAndParams, value := line[:colon], line[colon+1:]
+		parts := strings.Split(nameAndParams, ";")
+		name := strings.ToUpper(parts[0])
+		params := make(map[string]string)
+		for _, param := range parts[1:] {
+			if eq := strings.Index(param, "="); eq > 0 {
+				params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+			}
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &calendarEvent{}
+			startDate, endDate = icalTime{}, icalTime{}
+		case name == "END" && value == "VEVENT" && event != nil:
+			event.start, event.Start, event.AllDay = startDate.t, startDate.format(loc), startDate.allDay
+			event.End = endDate.format(loc)
+			events = append(events, *event)
+			event = nil
+		case event == nil:
+		case name == "UID":
+			event.ID = value
+		case name == "SUMMARY":
+			event.Summary = unescapeICalendarText(value)
+		case name == "LOCATION":
+			event.Location = unescapeICalendarText(value)
+		case name == "DESCRIPTION":
+			event.Description = unescapeICalendarText(value)
+		case name == "DTSTART":
+			startDate = parseICalendarTime(value, params, loc)
+		case name == "DTEND":
+			endDate = parseICalendarTime(value, params, loc)
+		}
+	}
+	return events
+}
+
+// icalTime iCalendar中的时间
+type icalTime struct {
+	t      time.Time
+	allDay bool
+}
+
+// format 全天日程使用日期，其他使用loc时区的RFC3339
+func (t icalTime) format(loc *time.Location) string {
+	if t.t.IsZero() {
+		return ""
+	}
+	if t.allDay {
+		return t.t.Format("2006-01-02")
+	}
+	return t.t.In(loc).Format(time.RFC3339)
+}
+
+// parseICalendarTime 解析DATE或DATE-TIME值，支持UTC、TZID和浮动时间
+func parseICalendarTime(value string, params map[string]string, loc *time.Location) icalTime {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, _ := time.ParseInLocation("20060102", value, loc)
+		return icalTime{t: t, allDay: true}
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, _ := time.Parse("20060102T150405Z", value)
+		return icalTime{t: t}
+	}
+	location := loc
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			location = l
+		}
+	}
+	t, _ := time.ParseInLocation("20060102T150405", value, location)
+	return icalTime{t: t}
+}
+
+// escapeICalendarText 转义TEXT值中的特殊字符
+func escapeICalendarText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// unescapeICalendarText 还原TEXT值中的转义字符
+func unescapeICalendarText(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(value)
+}
+
+// foldICalendarLine 将超过75字节的行折叠，不拆分UTF-8字符
+func foldICalendarLine(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,207 @@
+// Package assistant 提供助手常用的邮件和日历工具：通过SMTP发送邮件、通过IMAP搜索邮件，
+// 通过CalDAV或Google Calendar列出和创建日程，配置可以从YAML文件读取
+package assistant
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+	"gopkg.in/yaml.v2"
+)
+
+// 日历类型
+const (
+	CalendarCalDAV = "caldav"
+	CalendarGoogle = "google"
+)
+
+// defaultTimeout 连接邮件服务器和日历服务的超时时间
+const defaultTimeout = 30 * time.Second
+
+// Config 邮件和日历工具的配置，未配置的部分不注册对应的工具
+// Password和Token的值为${NAME}时从环境变量NAME读取
+type Config struct {
+	Email    *EmailConfig    `yaml:"Email,omitempty"`
+	Calendar *CalendarConfig `yaml:"Calendar,omitempty"`
+	Prefix   string          `yaml:"Prefix,omitempty"` // 工具名称前缀
+	Group    string          `yaml:"Group,omitempty"`  // 工具加入的工具组，为空时不分组
+}
+
+// EmailConfig 邮件配置
+type EmailConfig struct {
+	SMTP              *SMTPConfig `yaml:"SMTP,omitempty"`              // 发送邮件，为nil时不注册send_email
+	IMAP              *IMAPConfig `yaml:"IMAP,omitempty"`              // 搜索邮件，为nil时不注册search_email
+	AllowedRecipients []string    `yaml:"AllowedRecipients,omitempty"` // 允许的收件人地址或@域名，为空时不限制
+}
+
+// SMTPConfig SMTP服务器配置，端口465使用TLS连接，其他端口在服务器支持时使用STARTTLS
+type SMTPConfig struct {
+	Host     string `yaml:"Host"`
+	Port     int    `yaml:"Port,omitempty"` // 默认587
+	Username string `yaml:"Username,omitempty"`
+	Password string `yaml:"Password,omitempty"`
+	From     string `yaml:"From"` // 发件人地址，可以带名称，如"助手 <bot@example.com>"
+}
+
+// IMAPConfig IMAP服务器配置，端口993使用TLS连接，其他端口使用STARTTLS
+type IMAPConfig struct {
+	Host     string `yaml:"Host"`
+	Port     int    `yaml:"Port,omitempty"` // 默认993
+	Username string `yaml:"Username"`
+	Password string `yaml:"Password"`
+	Mailbox  string `yaml:"Mailbox,omitempty"` // 默认INBOX
+}
+
+// CalendarConfig 日历配置
+type CalendarConfig struct {
+	Type        string                      `yaml:"Type"`                 // caldav或google
+	URL         string                      `yaml:"URL,omitempty"`        // CalDAV日历集合的地址
+	Username    string                      `yaml:"Username,omitempty"`   // CalDAV用户名
+	Password    string                      `yaml:"Password,omitempty"`   // CalDAV密码
+	CalendarID  string                      `yaml:"CalendarID,omitempty"` // Google日历ID，默认primary
+	Token       string                      `yaml:"Token,omitempty"`      // Google OAuth访问令牌
+	TimeZone    string                      `yaml:"TimeZone,omitempty"`   // 解析没有时区的时间和显示时间使用的时区，默认本地时区
+	Credentials general.CredentialsProvider `yaml:"-"`                    // Google访问令牌的来源，设置时优先于Token
+}
+
+// LoadConfig 从YAML文件读取配置
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig 解析YAML配置并检查必填字段
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("解析配置失败: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate 检查必填字段和日历类型
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Email != nil {
+		if smtp := c.Email.SMTP; smtp != nil {
+			if smtp.Host == "" {
+				problems = append(problems, "Email.SMTP.Host不能为空")
+			}
+			if smtp.From == "" {
+				problems = append(problems, "Email.SMTP.From不能为空")
+			}
+		}
+		if imap := c.Email.IMAP; imap != nil {
+			if imap.Host == "" || imap.Username == "" {
+				problems = append(problems, "Email.IMAP.Host和Username不能为空")
+			}
+		}
+	}
+	if calendar := c.Calendar; calendar != nil {
+		switch calendar.Type {
+		case CalendarCalDAV:
+			if calendar.URL == "" {
+				problems = append(problems, "Calendar.URL不能为空")
+			}
+		case CalendarGoogle:
+			if calendar.Token == "" && calendar.Credentials == nil {
+				problems = append(problems, "Calendar.Token不能为空")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("不支持的日历类型 %q，可选caldav或google", calendar.Type))
+		}
+		if calendar.TimeZone != "" {
+			if _, err := time.LoadLocation(calendar.TimeZone); err != nil {
+				problems = append(problems, fmt.Sprintf("无效的时区 %q", calendar.TimeZone))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("配置错误: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Register 按配置将邮件和日历工具注册到cm，返回注册的工具名称
+// 工具为send_email、search_email、list_events和create_event，发送邮件和创建日程前建议通过SetToolApprover确认
+func Register(cm *ConversationManager.ConversationManager, config *Config) ([]string, error) {
+	if config == nil {
+		return nil, fmt.Errorf("配置不能为空")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	var registered []string
+	register := func(name, description string, fn interface{}, paramNames, paramDescriptions []string) error {
+		name = config.Prefix + name
+		if err := cm.RegisterFunction(name, description, fn, paramNames, paramDescriptions); err != nil {
+			return fmt.Errorf("注册工具 %s 失败: %w", name, err)
+		}
+		registered = append(registered, name)
+		return nil
+	}
+
+	if config.Email != nil && config.Email.SMTP != nil {
+		mailer := &mailer{config: *config.Email.SMTP, allowed: config.Email.AllowedRecipients}
+		mailer.config.Password = expandSecret(mailer.config.Password)
+		if err := register("send_email", "发送一封纯文本邮件", mailer.SendEmail,
+			[]string{"to", "cc", "subject", "body"},
+			[]string{"收件人地址列表", "抄送地址列表，可以为空", "邮件主题", "邮件正文（纯文本）"}); err != nil {
+			return registered, err
+		}
+	}
+	if config.Email != nil && config.Email.IMAP != nil {
+		mailbox := &mailbox{config: *config.Email.IMAP}
+		mailbox.config.Password = expandSecret(mailbox.config.Password)
+		if err := register("search_email", "搜索邮箱中的邮件，返回最新的匹配邮件的发件人、主题、日期和正文摘要", mailbox.SearchEmail,
+			[]string{"text", "from", "since", "limit"},
+			[]string{"邮件主题或正文中包含的文字，可以为空", "发件人地址或名称，可以为空", "只搜索该日期（YYYY-MM-DD）及之后的邮件，可以为空", "最多返回的邮件数量，默认10"}); err != nil {
+			return registered, err
+		}
+	}
+	if config.Calendar != nil {
+		calendar, err := newCalendar(*config.Calendar)
+		if err != nil {
+			return registered, err
+		}
+		if err := register("list_events", "列出时间范围内的日程", calendar.ListEvents,
+			[]string{"start", "end"},
+			[]string{"开始时间，如2024-05-01或2024-05-01 09:00，为空时为现在", "结束时间，为空时为开始时间后7天"}); err != nil {
+			return registered, err
+		}
+		if err := register("create_event", "在日历中创建日程", calendar.CreateEvent,
+			[]string{"summary", "start", "end", "location", "description"},
+			[]string{"日程标题", "开始时间，如2024-05-01 09:00", "结束时间，为空时为开始后1小时", "地点，可以为空", "说明，可以为空"}); err != nil {
+			return registered, err
+		}
+	}
+	if len(registered) == 0 {
+		return nil, fmt.Errorf("配置中没有邮件或日历")
+	}
+
+	if config.Group != "" {
+		if err := cm.AddToolsToGroup(config.Group, registered...); err != nil {
+			return registered, err
+		}
+	}
+	return registered, nil
+}
+
+// expandSecret 值为${NAME}时从环境变量读取，避免把密码写在配置文件中
+func expandSecret(value string) string {
+	if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+		return os.Getenv(value[2 : len(value)-1])
+	}
+	return value
+}
@@ -0,0 +1,401 @@
+package assistant
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxEmailSnippet 搜索结果中正文摘要的最大字符数
+const maxEmailSnippet = 500
+
+// maxEmailFetch 每封邮件读取的最大字节数，只用于提取头部和正文摘要
+const maxEmailFetch = 64 << 10
+
+// mailer 发送邮件
+type mailer struct {
+	config  SMTPConfig
+	allowed []string
+}
+
+// SendEmail 发送纯文本邮件
+func (m *mailer) SendEmail(to []string, cc []string, subject string, body string) (string, error) {
+	from, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return "", fmt.Errorf("发件人地址无效: %w", err)
+	}
+	toAddresses, err := m.parseRecipients(to)
+	if err != nil {
+		return "", err
+	}
+	if len(toAddresses) == 0 {
+		return "", fmt.Errorf("收件人不能为空")
+	}
+	ccAddresses, err := m.parseRecipients(cc)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(subject, "\r\n") {
+		return "", fmt.Errorf("主题不能包含换行")
+	}
+
+	var recipients []string
+	for _, address := range append(append([]*mail.Address(nil), toAddresses...), ccAddresses...) {
+		recipients = append(recipients, address.Address)
+	}
+	message := buildEmail(from, toAddresses, ccAddresses, subject, body)
+	if err := m.send(from.Address, recipients, message); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("邮件已发送给 %s", strings.Join(recipients, ", ")), nil
+}
+
+// parseRecipients 解析收件人地址并检查是否在允许的范围内
+func (m *mailer) parseRecipients(list []string) ([]*mail.Address, error) {
+	var addresses []*mail.Address
+	for _, item := range list {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(item)
+		if err != nil {
+			return nil, fmt.Errorf("地址 %s 无效: %w", item, err)
+		}
+		if !m.recipientAllowed(address.Address) {
+			return nil, fmt.Errorf("不允许发送给 %s", address.Address)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// recipientAllowed 检查地址是否在AllowedRecipients中，以@开头的项匹配整个域名
+func (m *mailer) recipientAllowed(address string) bool {
+	if len(m.allowed) == 0 {
+		return true
+	}
+	address = strings.ToLower(address)
+	for _, allowed := range m.allowed {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if address == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(address, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildEmail 生成UTF-8纯文本邮件，正文使用base64编码
+func buildEmail(from *mail.Address, to, cc []*mail.Address, subject, body string) []byte {
+	join := func(addresses []*mail.Address) string {
+		parts := make([]string, len(addresses))
+		for i, address := range addresses {
+			parts[i] = address.String()
+		}
+		return strings.Join(parts, ", ")
+	}
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var b bytes.Buffer
+	b.WriteString("From: " + from.String() + "\r\n")
+	b.WriteString("To: " + join(to) + "\r\n")
+	if len(cc) > 0 {
+		b.WriteString("Cc: " + join(cc) + "\r\n")
+	}
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Message-ID: <" + hex.EncodeToString(id) + "@" + domain + ">\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.Bytes()
+}
+
+// send 连接SMTP服务器并发送邮件
+func (m *mailer) send(from string, recipients []string, message []byte) error {
+	port := m.config.Port
+	if port == 0 {
+		port = 587
+	}
+	address := net.JoinHostPort(m.config.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: m.config.Host}
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+
+	var conn net.Conn
+	var err error
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("连接SMTP服务器失败: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(defaultTimeout))
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("连接SMTP服务器失败: %w", err)
+	}
+	defer client.Close()
+
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS失败: %w", err)
+			}
+		}
+	}
+	if m.config.Username != "" {
+		// PlainAuth只在TLS连接或本机上发送密码
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("SMTP认证失败: %w", err)
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("发送失败: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送失败: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("发送失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送失败: %w", err)
+	}
+	return client.Quit()
+}
+
+// mailbox 搜索邮件
+type mailbox struct {
+	config IMAPConfig
+}
+
+// emailSummary 搜索结果中的一封邮件
+type emailSummary struct {
+	UID     uint32 `json:"uid"`
+	From    string `json:"from"`
+	To      string `json:"to,omitempty"`
+	Subject string `json:"subject"`
+	Date    string `json:"date"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// imapUIDPattern FETCH响应中的UID
+var imapUIDPattern = regexp.MustCompile(`UID (\d+)`)
+
+// SearchEmail 搜索邮件，按时间从新到旧返回最多limit封
+func (m *mailbox) SearchEmail(text string, from string, since string, limit int) (string, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	criteria := []interface{}{}
+	if text = strings.TrimSpace(text); text != "" {
+		criteria = append(criteria, "TEXT", imapString(text))
+	}
+	if from = strings.TrimSpace(from); from != "" {
+		criteria = append(criteria, "FROM", imapString(from))
+	}
+	if since = strings.TrimSpace(since); since != "" {
+		date, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return "", fmt.Errorf("since必须是YYYY-MM-DD格式的日期")
+		}
+		criteria = append(criteria, "SINCE", date.Format("2-Jan-2006"))
+	}
+	if len(criteria) == 0 {
+		criteria = append(criteria, "ALL")
+	}
+	for _, c := range criteria {
+		if _, ok := c.(imapLiteral); ok {
+			criteria = append([]interface{}{"CHARSET", "UTF-8"}, criteria...)
+			break
+		}
+	}
+
+	conn, err := dialIMAP(m.config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.close()
+
+	mailboxName := m.config.Mailbox
+	if mailboxName == "" {
+		mailboxName = "INBOX"
+	}
+	// EXAMINE以只读方式打开邮箱，不会改变邮件的已读状态
+	if _, err := conn.command("EXAMINE", imapString(mailboxName)); err != nil {
+		return "", fmt.Errorf("打开邮箱 %s 失败: %w", mailboxName, err)
+	}
+	responses, err := conn.command(append([]interface{}{"UID", "SEARCH"}, criteria...)...)
+	if err != nil {
+		return "", fmt.Errorf("搜索失败: %w", err)
+	}
+	var uids []uint32
+	for _, response := range responses {
+		fields := strings.Fields(response.text)
+		if len(fields) < 2 || fields[0] != "*" || !strings.EqualFold(fields[1], "SEARCH") {
+			continue
+		}
+		for _, field := range fields[2:] {
+			if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	if len(uids) == 0 {
+		return "没有找到匹配的邮件", nil
+	}
+
+	// UID递增，最新的邮件在最后
+	sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+	if len(uids) > limit {
+		uids = uids[:limit]
+	}
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	responses, err = conn.command("UID", "FETCH", strings.Join(set, ","), fmt.Sprintf("(UID BODY.PEEK[]<0.%d>)", maxEmailFetch))
+	if err != nil {
+		return "", fmt.Errorf("读取邮件失败: %w", err)
+	}
+
+	byUID := make(map[uint32]emailSummary)
+	for _, response := range responses {
+		match := imapUIDPattern.FindStringSubmatch(response.text)
+		if match == nil || len(response.literals) == 0 {
+			continue
+		}
+		uid, _ := strconv.ParseUint(match[1], 10, 32)
+		summary := summarizeEmail(response.literals[0])
+		summary.UID = uint32(uid)
+		byUID[summary.UID] = summary
+	}
+	results := make([]emailSummary, 0, len(uids))
+	for _, uid := range uids {
+		if summary, ok := byUID[uid]; ok {
+			results = append(results, summary)
+		}
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return "", fmt.Errorf("序列化结果失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// summarizeEmail 解析邮件的头部和正文摘要，邮件可能被截断
+func summarizeEmail(raw []byte) emailSummary {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return emailSummary{Subject: "(无法解析的邮件)"}
+	}
+	decoder := &mime.WordDecoder{}
+	decode := func(value string) string {
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			return decoded
+		}
+		return value
+	}
+	summary := emailSummary{
+		From:    decode(message.Header.Get("From")),
+		To:      decode(message.Header.Get("To")),
+		Subject: decode(message.Header.Get("Subject")),
+		Date:    message.Header.Get("Date"),
+	}
+	if date, err := message.Header.Date(); err == nil {
+		summary.Date = date.Format(time.RFC3339)
+	}
+	text := emailText(message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), message.Body, 0)
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxEmailSnippet {
+		text = string(runes[:maxEmailSnippet]) + "..."
+	}
+	summary.Snippet = text
+	return summary
+}
+
+// htmlTagPattern HTML标签
+var htmlTagPattern = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]*>`)
+
+// emailText 提取邮件正文的文本，优先使用text/plain，其次使用去掉标签的text/html
+func emailText(contentType, encoding string, body io.Reader, depth int) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") && depth < 5 {
+		reader := multipart.NewReader(body, params["boundary"])
+		var html string
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			partType := part.Header.Get("Content-Type")
+			text := emailText(partType, part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+			if text == "" {
+				continue
+			}
+			if strings.HasPrefix(partType, "text/html") {
+				if html == "" {
+					html = text
+				}
+				continue
+			}
+			return text
+		}
+		return html
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return ""
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	// 邮件可能被截断，读取出错时保留已读到的内容
+	data, _ := io.ReadAll(io.LimitReader(body, maxEmailFetch))
+	text := string(data)
+	if mediaType == "text/html" {
+		text = htmlTagPattern.ReplaceAllString(text, " ")
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,189 @@
+package assistant
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 只实现搜索邮件需要的IMAP4rev1命令：LOGIN、EXAMINE、UID SEARCH、UID FETCH和LOGOUT
+
+// maxIMAPLiteral 单个响应字面量的最大字节数
+const maxIMAPLiteral = 1 << 20
+
+// imapLiteralPattern 行尾的字面量长度，如{123}
+var imapLiteralPattern = regexp.MustCompile(`\{(\d+)\}$`)
+
+// imapLiteral 以字面量发送的参数，用于包含非ASCII字符或换行的字符串
+type imapLiteral string
+
+// imapResponse 一条非标记响应，字面量在text中以\x00占位
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+// imapConn IMAP连接
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapString 将字符串转换为命令参数：可打印ASCII使用带引号的字符串，否则使用字面量
+func imapString(s string) interface{} {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return imapLiteral(s)
+		}
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// dialIMAP 连接并登录IMAP服务器，端口993使用TLS，其他端口使用STARTTLS
+func dialIMAP(config IMAPConfig) (*imapConn, error) {
+	port := config.Port
+	if port == 0 {
+		port = 993
+	}
+	address := net.JoinHostPort(config.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: config.Host}
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+
+	var conn net.Conn
+	var err error
+	if port == 993 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接IMAP服务器失败: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(defaultTimeout))
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("读取IMAP问候失败: %w", err)
+	}
+	if !strings.HasPrefix(strings.ToUpper(greeting.text), "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("IMAP服务器拒绝连接: %s", greeting.text)
+	}
+
+	if port != 993 {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("STARTTLS失败: %w", err)
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("STARTTLS失败: %w", err)
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+	}
+
+	if _, err := c.command("LOGIN", imapString(config.Username), imapString(config.Password)); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("IMAP登录失败: %w", err)
+	}
+	return c, nil
+}
+
+// command 发送命令并读取到标记响应，返回期间的非标记响应，状态不是OK时返回错误
+func (c *imapConn) command(args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%03d", c.tag)
+
+	var line strings.Builder
+	line.WriteString(tag)
+	for _, arg := range args {
+		line.WriteString(" ")
+		literal, ok := arg.(imapLiteral)
+		if !ok {
+			line.WriteString(fmt.Sprint(arg))
+			continue
+		}
+		// 同步字面量：发送长度后等待服务器的继续请求
+		fmt.Fprintf(&line, "{%d}\r\n", len(literal))
+		if _, err := io.WriteString(c.conn, line.String()); err != nil {
+			return nil, err
+		}
+		line.Reset()
+		continuation, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(continuation.text, "+") {
+			return nil, fmt.Errorf("服务器拒绝字面量: %s", continuation.text)
+		}
+		line.WriteString(string(literal))
+	}
+	line.WriteString("\r\n")
+	if _, err := io.WriteString(c.conn, line.String()); err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(response.text, tag+" ") {
+			responses = append(responses, response)
+			continue
+		}
+		status := strings.TrimPrefix(response.text, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return nil, fmt.Errorf("%s", status)
+		}
+		return responses, nil
+	}
+}
+
+// readResponse 读取一条完整的响应，包括其中的字面量
+func (c *imapConn) readResponse() (imapResponse, error) {
+	var response imapResponse
+	var text strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return response, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		match := imapLiteralPattern.FindStringSubmatch(line)
+		if match == nil {
+			text.WriteString(line)
+			response.text = text.String()
+			return response, nil
+		}
+		size, err := strconv.Atoi(match[1])
+		if err != nil || size > maxIMAPLiteral {
+			return response, fmt.Errorf("IMAP字面量过大")
+		}
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return response, err
+		}
+		text.WriteString(line[:len(line)-len(match[0])])
+		text.WriteString("\x00")
+		response.literals = append(response.literals, literal)
+	}
+}
+
+// close 退出登录并关闭连接
+func (c *imapConn) close() {
+	c.command("LOGOUT")
+	c.conn.Close()
+}
@@ -0,0 +1,346 @@
+// Package graph 提供知识图谱形式的记忆：对话中的事实以"主语 - 谓语 - 宾语"三元组保存，
+// 按文本中提到的实体召回相关事实，作为向量记忆之外的另一种选择
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// Config 知识图谱记忆的配置
+type Config struct {
+	Limit  int    // 每次召回的最多事实数，为0时为20
+	Depth  int    // 召回时从提到的实体沿关系扩展的跳数，为0时为1
+	Source string // 写入事实时记录的来源，如会话ID
+	Prefix string // 工具名称前缀
+	Group  string // 工具加入的工具组，为空时不分组
+}
+
+// Memory 知识图谱记忆
+type Memory struct {
+	store  Store
+	config Config
+}
+
+// New 创建知识图谱记忆，config为nil时使用默认配置
+func New(store Store, config *Config) *Memory {
+	m := &Memory{store: store}
+	if config != nil {
+		m.config = *config
+	}
+	if m.config.Limit <= 0 {
+		m.config.Limit = 20
+	}
+	if m.config.Depth <= 0 {
+		m.config.Depth = 1
+	}
+	return m
+}
+
+// Register 将remember_facts、recall_facts和forget_facts工具注册到cm，返回注册的工具名称
+func (m *Memory) Register(cm *ConversationManager.ConversationManager) ([]string, error) {
+	var registered []string
+	register := func(name, description string, fn interface{}, paramNames, paramDescriptions []string) error {
+		name = m.config.Prefix + name
+		if err := cm.RegisterFunction(name, description, fn, paramNames, paramDescriptions); err != nil {
+			return fmt.Errorf("注册工具 %s 失败: %w", name, err)
+		}
+		registered = append(registered, name)
+		return nil
+	}
+
+	if err := register("remember_facts", "将关于用户、人物、组织、地点等的事实保存到长期记忆中", m.Remember,
+		[]string{"facts"},
+		[]string{`事实列表，每条为[主语, 谓语, 宾语]，如[["张三", "就职于", "示例公司"], ["张三", "喜欢", "咖啡"]]`}); err != nil {
+		return registered, err
+	}
+	if err := register("recall_facts", "从长期记忆中查找与文本中提到的实体相关的事实", m.recallFacts,
+		[]string{"query"},
+		[]string{"包含实体名称的文本，如人名或公司名"}); err != nil {
+		return registered, err
+	}
+	if err := register("forget_facts", "从长期记忆中删除过时或错误的事实", m.Forget,
+		[]string{"facts"},
+		[]string{"要删除的事实列表，每条为[主语, 谓语, 宾语]，宾语为空字符串时删除该主语和谓语的所有事实"}); err != nil {
+		return registered, err
+	}
+
+	if m.config.Group != "" {
+		if err := cm.AddToolsToGroup(m.config.Group, registered...); err != nil {
+			return registered, err
+		}
+	}
+	return registered, nil
+}
+
+// Remember 保存事实
+func (m *Memory) Remember(facts [][]string) (string, error) {
+	triples, err := parseFacts(facts, false)
+	if err != nil {
+		return "", err
+	}
+	if err := m.Add(context.Background(), triples); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("已保存 %d 条事实", len(triples)), nil
+}
+
+// Forget 删除事实
+func (m *Memory) Forget(facts [][]string) (string, error) {
+	triples, err := parseFacts(facts, true)
+	if err != nil {
+		return "", err
+	}
+	count, err := m.store.Remove(context.Background(), triples)
+	if err != nil {
+		return "", fmt.Errorf("删除事实失败: %w", err)
+	}
+	return fmt.Sprintf("已删除 %d 条事实", count), nil
+}
+
+// recallFacts 执行recall_facts工具
+func (m *Memory) recallFacts(query string) (string, error) {
+	triples, err := m.Recall(context.Background(), query)
+	if err != nil {
+		return "", err
+	}
+	if len(triples) == 0 {
+		return "没有找到相关的事实", nil
+	}
+	return formatFacts(triples), nil
+}
+
+// Add 写入事实，填充来源和时间
+func (m *Memory) Add(ctx context.Context, triples []Triple) error {
+	now := time.Now()
+	for i := range triples {
+		if triples[i].Time.IsZero() {
+			triples[i].Time = now
+		}
+		if triples[i].Source == "" {
+			triples[i].Source = m.config.Source
+		}
+	}
+	if err := m.store.Add(ctx, triples); err != nil {
+		return fmt.Errorf("保存事实失败: %w", err)
+	}
+	return nil
+}
+
+// Recall 找出text中提到的已知实体，返回与这些实体相关的事实，并按Depth沿关系扩展
+func (m *Memory) Recall(ctx context.Context, text string) ([]Triple, error) {
+	entities, err := m.store.Entities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("读取实体失败: %w", err)
+	}
+	frontier := mentions(text, entities)
+
+	var result []Triple
+	seenTriples := make(map[string]bool)
+	seenEntities := make(map[string]bool)
+	for _, entity := range frontier {
+		seenEntities[normalize(entity)] = true
+	}
+	for depth := 0; depth < m.config.Depth && len(frontier) > 0 && len(result) < m.config.Limit; depth++ {
+		related, err := m.store.Related(ctx, frontier, m.config.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("查询事实失败: %w", err)
+		}
+		var next []string
+		for _, triple := range related {
+			if seenTriples[triple.key()] || len(result) >= m.config.Limit {
+				continue
+			}
+			seenTriples[triple.key()] = true
+			result = append(result, triple)
+			for _, entity := range []string{triple.Subject, triple.Object} {
+				if !seenEntities[normalize(entity)] {
+					seenEntities[normalize(entity)] = true
+					next = append(next, entity)
+				}
+			}
+		}
+		frontier = next
+	}
+	return result, nil
+}
+
+// Context 返回text中提到的实体的相关事实，格式化为可以加入系统提示词或用户消息的文本，没有相关事实时为空
+func (m *Memory) Context(ctx context.Context, text string) (string, error) {
+	triples, err := m.Recall(ctx, text)
+	if err != nil || len(triples) == 0 {
+		return "", err
+	}
+	return "已知事实：\n" + formatFacts(triples), nil
+}
+
+// Learn 用extractor从消息中提取事实并保存，返回保存的事实数量
+func (m *Memory) Learn(ctx context.Context, extractor Extractor, messages []general.Message) (int, error) {
+	var b strings.Builder
+	for _, msg := range messages {
+		if msg.Role != general.RoleUser && msg.Role != general.RoleAssistant {
+			continue
+		}
+		for _, content := range msg.Content {
+			if content.Type == general.ContentTypeText && strings.TrimSpace(content.Text) != "" {
+				fmt.Fprintf(&b, "%s: %s\n", msg.Role, strings.TrimSpace(content.Text))
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return 0, nil
+	}
+	triples, err := extractor.Extract(ctx, b.String())
+	if err != nil {
+		return 0, fmt.Errorf("提取事实失败: %w", err)
+	}
+	if len(triples) == 0 {
+		return 0, nil
+	}
+	if err := m.Add(ctx, triples); err != nil {
+		return 0, err
+	}
+	return len(triples), nil
+}
+
+// Extractor 从对话文本中提取事实
+type Extractor interface {
+	Extract(ctx context.Context, text string) ([]Triple, error)
+}
+
+// ModelExtractor 使用模型（通常是便宜的小模型）从对话中提取事实
+type ModelExtractor struct {
+	manager  *general.AgentManager
+	provider general.Provider
+	model    string
+}
+
+// NewModelExtractor 创建使用指定提供商和模型的事实提取器
+func NewModelExtractor(manager *general.AgentManager, provider general.Provider, model string) *ModelExtractor {
+	return &ModelExtractor{manager: manager, provider: provider, model: model}
+}
+
+// Extract 请求模型以JSON数组输出对话中值得长期记住的事实
+func (e *ModelExtractor) Extract(ctx context.Context, text string) ([]Triple, error) {
+	prompt := "从以下对话中提取值得长期记住的事实，如人物、组织、地点之间的关系，以及用户的身份、偏好和计划。" +
+		"只输出JSON数组，每条事实为[主语, 谓语, 宾语]，实体使用对话中的完整名称，没有事实时输出[]。\n\n" + text
+	req := &general.ChatRequest{
+		Model: e.model,
+		Messages: []general.Message{
+			{Role: general.RoleUser, Content: []general.Content{{Type: general.ContentTypeText, Text: prompt}}},
+		},
+		MaxTokens:      2000,
+		Temperature:    0,
+		TemperatureSet: true,
+	}
+	resp, err := e.manager.Chat(ctx, e.provider, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("模型没有返回内容")
+	}
+	var output strings.Builder
+	for _, content := range resp.Choices[0].Message.Content {
+		if content.Type == general.ContentTypeText {
+			output.WriteString(content.Text)
+		}
+	}
+
+	// 模型可能在JSON前后加入说明或代码块标记，只取最外层的数组
+	raw := output.String()
+	start, end := strings.Index(raw, "["), strings.LastIndex(raw, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("模型输出不是JSON数组: %s", raw)
+	}
+	var facts [][]string
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &facts); err != nil {
+		return nil, fmt.Errorf("解析模型输出失败: %w", err)
+	}
+	var triples []Triple
+	for _, fact := range facts {
+		if len(fact) == 3 && strings.TrimSpace(fact[0]) != "" && strings.TrimSpace(fact[1]) != "" && strings.TrimSpace(fact[2]) != "" {
+			triples = append(triples, Triple{Subject: strings.TrimSpace(fact[0]), Predicate: strings.TrimSpace(fact[1]), Object: strings.TrimSpace(fact[2])})
+		}
+	}
+	return triples, nil
+}
+
+// parseFacts 将工具参数转换为三元组，allowEmptyObject为true时宾语可以为空
+func parseFacts(facts [][]string, allowEmptyObject bool) ([]Triple, error) {
+	if len(facts) == 0 {
+		return nil, fmt.Errorf("事实列表不能为空")
+	}
+	triples := make([]Triple, 0, len(facts))
+	for i, fact := range facts {
+		if len(fact) == 2 && allowEmptyObject {
+			fact = append(fact, "")
+		}
+		if len(fact) != 3 {
+			return nil, fmt.Errorf("第 %d 条事实应为[主语, 谓语, 宾语]", i+1)
+		}
+		triple := Triple{Subject: strings.TrimSpace(fact[0]), Predicate: strings.TrimSpace(fact[1]), Object: strings.TrimSpace(fact[2])}
+		if triple.Subject == "" || triple.Predicate == "" || (triple.Object == "" && !allowEmptyObject) {
+			return nil, fmt.Errorf("第 %d 条事实的主语、谓语和宾语不能为空", i+1)
+		}
+		triples = append(triples, triple)
+	}
+	return triples, nil
+}
+
+// formatFacts 每行一条事实
+func formatFacts(triples []Triple) string {
+	lines := make([]string, len(triples))
+	for i, triple := range triples {
+		lines[i] = "- " + triple.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mentions 返回text中提到的实体，忽略大小写；由字母数字组成的实体要求前后不是字母数字，避免"Al"匹配"Alice"
+func mentions(text string, entities []string) []string {
+	lower := normalize(text)
+	var found []string
+	for _, entity := range entities {
+		key := normalize(entity)
+		if key == "" || !strings.Contains(lower, key) {
+			continue
+		}
+		if containsWord(lower, key) {
+			found = append(found, entity)
+		}
+	}
+	return found
+}
+
+// containsWord 判断text中是否有前后边界不是ASCII字母数字的key，中文等没有空格分词的文字不检查边界
+func containsWord(text, key string) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], key)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(key)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		first, _ := utf8.DecodeRuneInString(key)
+		last, _ := utf8.DecodeLastRuneInString(key)
+		if !(isASCIIWord(first) && isASCIIWord(before)) && !(isASCIIWord(last) && isASCIIWord(after)) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// isASCIIWord 判断是否为ASCII字母或数字
+func isASCIIWord(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
@@ -0,0 +1,190 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Triple 一条事实：主语 - 谓语 - 宾语，如"张三 - 就职于 - 示例公司"
+type Triple struct {
+	Subject   string    `json:"subject"`
+	Predicate string    `json:"predicate"`
+	Object    string    `json:"object"`
+	Source    string    `json:"source,omitempty"` // 事实的来源，如会话ID
+	Time      time.Time `json:"time"`             // 写入时间
+}
+
+// String 返回"主语 谓语 宾语"形式的文本
+func (t Triple) String() string {
+	return t.Subject + " " + t.Predicate + " " + t.Object
+}
+
+// key 去重使用的键，忽略大小写和首尾空白
+func (t Triple) key() string {
+	return normalize(t.Subject) + "\x00" + normalize(t.Predicate) + "\x00" + normalize(t.Object)
+}
+
+// Store 事实存储
+type Store interface {
+	// Add 写入事实，相同的事实只更新时间和来源
+	Add(ctx context.Context, triples []Triple) error
+	// Remove 删除事实，Object为空时删除主语和谓语相同的所有事实，返回删除的数量
+	Remove(ctx context.Context, triples []Triple) (int, error)
+	// Related 返回主语或宾语为entities中任一实体的事实，按时间从新到旧排列，最多limit条
+	Related(ctx context.Context, entities []string, limit int) ([]Triple, error)
+	// Entities 返回所有出现过的实体（主语和宾语）
+	Entities(ctx context.Context) ([]string, error)
+}
+
+// MemoryStore 进程内的事实存储，设置文件路径时每次修改后以JSON写入文件
+type MemoryStore struct {
+	mu      sync.RWMutex
+	path    string
+	triples []Triple
+}
+
+// NewMemoryStore 创建进程内的事实存储，path不为空时从该文件加载并在修改后保存，文件不存在时从空开始
+func NewMemoryStore(path string) (*MemoryStore, error) {
+	s := &MemoryStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取事实文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.triples); err != nil {
+		return nil, fmt.Errorf("解析事实文件失败: %w", err)
+	}
+	return s, nil
+}
+
+// Add 写入事实
+func (s *MemoryStore) Add(ctx context.Context, triples []Triple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := make(map[string]int, len(s.triples))
+	for i, triple := range s.triples {
+		index[triple.key()] = i
+	}
+	for _, triple := range triples {
+		if i, ok := index[triple.key()]; ok {
+			s.triples[i].Time = triple.Time
+			s.triples[i].Source = triple.Source
+			continue
+		}
+		index[triple.key()] = len(s.triples)
+		s.triples = append(s.triples, triple)
+	}
+	return s.save()
+}
+
+// Remove 删除事实
+func (s *MemoryStore) Remove(ctx context.Context, triples []Triple) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.triples[:0:0]
+	for _, existing := range s.triples {
+		removed := false
+		for _, triple := range triples {
+			if normalize(existing.Subject) == normalize(triple.Subject) &&
+				normalize(existing.Predicate) == normalize(triple.Predicate) &&
+				(triple.Object == "" || normalize(existing.Object) == normalize(triple.Object)) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, existing)
+		}
+	}
+	count := len(s.triples) - len(kept)
+	if count == 0 {
+		return 0, nil
+	}
+	s.triples = kept
+	return count, s.save()
+}
+
+// Related 返回与实体相关的事实
+func (s *MemoryStore) Related(ctx context.Context, entities []string, limit int) ([]Triple, error) {
+	wanted := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		wanted[normalize(entity)] = true
+	}
+	s.mu.RLock()
+	var related []Triple
+	for _, triple := range s.triples {
+		if wanted[normalize(triple.Subject)] || wanted[normalize(triple.Object)] {
+			related = append(related, triple)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(related, func(i, j int) bool { return related[i].Time.After(related[j].Time) })
+	if limit > 0 && len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+// Entities 返回所有实体
+func (s *MemoryStore) Entities(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]bool)
+	var entities []string
+	for _, triple := range s.triples {
+		for _, entity := range []string{triple.Subject, triple.Object} {
+			if key := normalize(entity); !seen[key] {
+				seen[key] = true
+				entities = append(entities, entity)
+			}
+		}
+	}
+	return entities, nil
+}
+
+// save 将事实写入文件，先写临时文件再重命名，避免写入中断时损坏原文件，调用时需持有锁
+func (s *MemoryStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.triples, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("保存事实文件失败: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("保存事实文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("保存事实文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("保存事实文件失败: %w", err)
+	}
+	return nil
+}
+
+// normalize 实体和谓语比较时使用的形式
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
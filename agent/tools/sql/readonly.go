@@ -0,0 +1,122 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// readOnlyStatements 只读模式下允许的语句开头
+var readOnlyStatements = map[string]bool{
+	"SELECT": true, "WITH": true, "SHOW": true, "DESCRIBE": true, "DESC": true, "EXPLAIN": true, "VALUES": true,
+}
+
+// writeKeywords 只读模式下不允许出现在语句任何位置的关键字，用于拦截写入型CTE、SELECT INTO、EXPLAIN ANALYZE DELETE等
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true, "REPLACE": true,
+	"CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "RENAME": true,
+	"GRANT": true, "REVOKE": true, "ATTACH": true, "DETACH": true, "COPY": true, "LOAD": true,
+	"CALL": true, "EXEC": true, "EXECUTE": true, "DO": true, "HANDLER": true,
+	"LOCK": true, "UNLOCK": true, "VACUUM": true, "REINDEX": true, "PRAGMA": true,
+	"SET": true, "RESET": true, "INTO": true, "OUTFILE": true, "DUMPFILE": true,
+	"BEGIN": true, "COMMIT": true, "ROLLBACK": true, "SAVEPOINT": true, "RELEASE": true,
+}
+
+// checkReadOnly 检查语句是否为单条只读查询
+// 不同数据库对字符串中反斜杠的处理不同，两种解释都检查，任一种不通过即拒绝；
+// 静态检查无法识别有副作用的函数，Query还会在只读事务中执行并回滚
+func checkReadOnly(query string) error {
+	for _, backslashEscapes := range []bool{false, true} {
+		words, statements := sqlWords(query, backslashEscapes)
+		if statements > 1 {
+			return fmt.Errorf("每次只能执行一条语句")
+		}
+		if len(words) == 0 {
+			return fmt.Errorf("SQL语句不能为空")
+		}
+		if !readOnlyStatements[words[0]] {
+			return fmt.Errorf("只允许只读查询，不能执行 %s 语句", words[0])
+		}
+		for _, word := range words {
+			if writeKeywords[word] {
+				return fmt.Errorf("只允许只读查询，语句中不能包含 %s", word)
+			}
+		}
+	}
+	return nil
+}
+
+// sqlWords 返回字符串、带引号的标识符和注释以外的大写单词，以及非空语句的数量
+// MySQL的/*!...*/注释会被执行，按普通内容处理
+func sqlWords(query string, backslashEscapes bool) ([]string, int) {
+	var words []string
+	statements := 0
+	statementHasContent := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// 字符串和带引号的标识符，两个连续的引号表示引号本身
+			i++
+			for i < len(query) {
+				if backslashEscapes && query[i] == '\\' {
+					i += 2
+					continue
+				}
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			statementHasContent = true
+		case c == '[':
+			for i < len(query) && query[i] != ']' {
+				i++
+			}
+			i++
+			statementHasContent = true
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*") && !strings.HasPrefix(query[i:], "/*!"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+		case c == ';':
+			if statementHasContent {
+				statements++
+				statementHasContent = false
+			}
+			i++
+		case isSQLWordChar(c):
+			start := i
+			for i < len(query) && isSQLWordChar(query[i]) {
+				i++
+			}
+			words = append(words, strings.ToUpper(query[start:i]))
+			statementHasContent = true
+		default:
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != '(' {
+				statementHasContent = true
+			}
+			i++
+		}
+	}
+	if statementHasContent {
+		statements++
+	}
+	return words, statements
+}
+
+// isSQLWordChar 判断字符是否属于关键字或标识符
+func isSQLWordChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
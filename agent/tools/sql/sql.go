@@ -0,0 +1,276 @@
+// Package sql 将数据库连接提供为对话工具：带只读限制和行数限制的查询工具，以及查看表结构的工具
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+)
+
+// 数据库方言，决定查看表结构的方式和参数占位符
+const (
+	DialectSQLite   = "sqlite"
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+)
+
+// Config 数据库工具的配置
+type Config struct {
+	Dialect     string        // 数据库方言，为空时根据驱动类型判断，无法判断时使用information_schema和?占位符
+	MaxRows     int           // 查询结果的最大行数，为0时为100
+	Timeout     time.Duration // 每次查询的超时时间，为0时为30秒
+	AllowWrites bool          // 允许执行写入语句，默认只允许只读查询
+	Prefix      string        // 工具名称前缀
+	Group       string        // 工具加入的工具组，为空时不分组
+}
+
+// Toolkit 数据库工具
+type Toolkit struct {
+	db     *sql.DB
+	config Config
+}
+
+// queryResult 查询工具返回的结果
+type queryResult struct {
+	Columns      []string        `json:"columns,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	Truncated    bool            `json:"truncated,omitempty"`
+	RowsAffected *int64          `json:"rows_affected,omitempty"`
+}
+
+// New 创建数据库工具，config为nil时使用默认配置
+func New(db *sql.DB, config *Config) *Toolkit {
+	t := &Toolkit{db: db}
+	if config != nil {
+		t.config = *config
+	}
+	if t.config.MaxRows <= 0 {
+		t.config.MaxRows = 100
+	}
+	if t.config.Timeout <= 0 {
+		t.config.Timeout = 30 * time.Second
+	}
+	if t.config.Dialect == "" {
+		t.config.Dialect = detectDialect(db)
+	}
+	return t
+}
+
+// detectDialect 根据驱动的类型名判断方言
+func detectDialect(db *sql.DB) string {
+	name := strings.ToLower(fmt.Sprintf("%T", db.Driver()))
+	switch {
+	case strings.Contains(name, "sqlite"):
+		return DialectSQLite
+	case strings.Contains(name, "mysql"):
+		return DialectMySQL
+	case strings.Contains(name, "pq."), strings.Contains(name, "pgx"), strings.Contains(name, "postgres"):
+		return DialectPostgres
+	}
+	return ""
+}
+
+// Register 将查询工具和表结构工具注册到cm，返回注册的工具名称
+func (t *Toolkit) Register(cm *ConversationManager.ConversationManager) ([]string, error) {
+	queryName := t.config.Prefix + "sql_query"
+	schemaName := t.config.Prefix + "sql_schema"
+
+	placeholder := "?"
+	if t.config.Dialect == DialectPostgres {
+		placeholder = "$1、$2"
+	}
+	mode := "只能执行只读查询（SELECT、WITH、SHOW、DESCRIBE、EXPLAIN），每次一条语句"
+	if t.config.AllowWrites {
+		mode = "每次执行一条语句"
+	}
+	queryDescription := fmt.Sprintf("在数据库上执行SQL。%s，最多返回 %d 行。值应通过params传入并在SQL中使用占位符 %s，不要拼接到SQL中", mode, t.config.MaxRows, placeholder)
+	if t.config.Dialect != "" {
+		queryDescription = fmt.Sprintf("在%s数据库上执行SQL。%s，最多返回 %d 行。值应通过params传入并在SQL中使用占位符 %s，不要拼接到SQL中", t.config.Dialect, mode, t.config.MaxRows, placeholder)
+	}
+
+	if err := cm.RegisterFunction(queryName, queryDescription, t.Query,
+		[]string{"query", "params"}, []string{"SQL语句", "按顺序对应占位符的参数值"}); err != nil {
+		return nil, err
+	}
+	if err := cm.RegisterFunction(schemaName, "查看数据库结构：table为空时列出所有表和视图，否则列出该表的列、类型和是否可为空", t.Schema,
+		[]string{"table"}, []string{"表名，为空时列出所有表"}); err != nil {
+		return []string{queryName}, err
+	}
+
+	names := []string{queryName, schemaName}
+	if t.config.Group != "" {
+		if err := cm.AddToolsToGroup(t.config.Group, names...); err != nil {
+			return names, err
+		}
+	}
+	return names, nil
+}
+
+// Query 执行SQL并以JSON返回列名和行，超过MaxRows的行被截断
+// 只读模式下语句先经过检查，再在只读事务中执行，结束后总是回滚；驱动不支持只读事务时使用普通事务并回滚
+// ctx被取消（如对话被取消或Shutdown）或超过Timeout时停止执行
+func (t *Toolkit) Query(ctx context.Context, query string, params []interface{}) (string, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", fmt.Errorf("SQL语句不能为空")
+	}
+	if !t.config.AllowWrites {
+		if err := checkReadOnly(query); err != nil {
+			return "", err
+		}
+	}
+	// 允许写入时，不以只读语句开头的语句按写入执行并返回影响的行数
+	words, _ := sqlWords(query, false)
+	write := len(words) == 0 || !readOnlyStatements[words[0]]
+
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+	tx, err := t.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: !t.config.AllowWrites})
+	if err != nil && !t.config.AllowWrites {
+		tx, err = t.db.BeginTx(ctx, nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var result queryResult
+	if write {
+		res, err := tx.ExecContext(ctx, query, params...)
+		if err != nil {
+			return "", fmt.Errorf("执行失败: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err == nil {
+			result.RowsAffected = &affected
+		}
+	} else {
+		if result, err = t.readRows(ctx, tx, query, params); err != nil {
+			return "", err
+		}
+	}
+	if t.config.AllowWrites {
+		if err := tx.Commit(); err != nil {
+			return "", fmt.Errorf("提交事务失败: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("序列化结果失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// readRows 执行查询并读取最多MaxRows行
+func (t *Toolkit) readRows(ctx context.Context, tx *sql.Tx, query string, params []interface{}) (queryResult, error) {
+	rows, err := tx.QueryContext(ctx, query, params...)
+	if err != nil {
+		return queryResult{}, fmt.Errorf("查询失败: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return queryResult{}, fmt.Errorf("读取列失败: %w", err)
+	}
+	result := queryResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if len(result.Rows) >= t.config.MaxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return queryResult{}, fmt.Errorf("读取行失败: %w", err)
+		}
+		for i, value := range values {
+			// 文本列通常以[]byte返回，直接序列化会变成base64
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return queryResult{}, fmt.Errorf("读取行失败: %w", err)
+	}
+	return result, nil
+}
+
+// Schema 列出所有表和视图，table不为空时列出该表的列
+func (t *Toolkit) Schema(ctx context.Context, table string) (string, error) {
+	table = strings.TrimSpace(table)
+	var query string
+	var params []interface{}
+	switch t.config.Dialect {
+	case DialectSQLite:
+		query = "SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name"
+		if table != "" {
+			query = `SELECT name, type, CASE WHEN "notnull" = 1 THEN 'NO' ELSE 'YES' END FROM pragma_table_info(?) ORDER BY cid`
+		}
+	case DialectMySQL:
+		query = "SELECT table_name, table_type FROM information_schema.tables WHERE table_schema = DATABASE() ORDER BY table_name"
+		if table != "" {
+			query = "SELECT column_name, column_type, is_nullable FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position"
+		}
+	case DialectPostgres:
+		query = "SELECT table_name, table_type FROM information_schema.tables WHERE table_schema = current_schema() ORDER BY table_name"
+		if table != "" {
+			query = "SELECT column_name, data_type, is_nullable FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position"
+		}
+	default:
+		query = "SELECT table_name, table_type FROM information_schema.tables WHERE table_schema NOT IN ('information_schema', 'pg_catalog', 'sys', 'mysql', 'performance_schema') ORDER BY table_name"
+		if table != "" {
+			query = "SELECT column_name, data_type, is_nullable FROM information_schema.columns WHERE table_name = ? ORDER BY ordinal_position"
+		}
+	}
+	if table != "" {
+		params = append(params, table)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+	rows, err := t.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return "", fmt.Errorf("查询表结构失败: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var name, kind sql.NullString
+		var nullable sql.NullString
+		targets := []interface{}{&name, &kind}
+		if table != "" {
+			targets = append(targets, &nullable)
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return "", fmt.Errorf("读取表结构失败: %w", err)
+		}
+		line := name.String + " " + kind.String
+		if table != "" && strings.EqualFold(nullable.String, "NO") {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("读取表结构失败: %w", err)
+	}
+	if len(lines) == 0 {
+		if table != "" {
+			return "", fmt.Errorf("表 %s 不存在或没有列", table)
+		}
+		return "数据库中没有表", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,131 @@
+package vector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/general"
+)
+
+// Embedder 将文本转换为向量
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFunc 将函数适配为Embedder
+type EmbedderFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// Embed 调用函数本身
+func (f EmbedderFunc) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return f(ctx, texts)
+}
+
+// OpenAIEmbedder 调用OpenAI兼容的/embeddings接口生成向量，通义千问、DeepSeek等兼容接口的服务也可以使用
+type OpenAIEmbedder struct {
+	BaseURL     string                      // 接口地址，为空时为https://api.openai.com/v1
+	APIKey      string                      // API密钥
+	Credentials general.CredentialsProvider // 每次请求时获取API密钥，设置后优先于APIKey
+	Model       string                      // 模型，为空时为text-embedding-3-small
+	Dimensions  int                         // 向量维度，为0时使用模型默认维度
+	HTTPClient  *http.Client                // 为nil时使用http.DefaultClient
+}
+
+// Embed 生成向量，结果顺序与texts相同
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	baseURL := strings.TrimRight(e.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	model := e.Model
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	key := e.APIKey
+	if e.Credentials != nil {
+		var err error
+		if key, err = e.Credentials.APIKey(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	body := map[string]interface{}{"model": model, "input": texts}
+	if e.Dimensions > 0 {
+		body["dimensions"] = e.Dimensions
+	}
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	headers := map[string]string{"Authorization": "Bearer " + key}
+	if err := doJSON(ctx, e.HTTPClient, http.MethodPost, baseURL+"/embeddings", headers, body, &result); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("向量序号 %d 超出范围", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("缺少第 %d 条文本的向量", i)
+		}
+	}
+	return vectors, nil
+}
+
+// doJSON 发送JSON请求并解析JSON响应，状态码不是2xx时返回包含响应内容的错误
+func doJSON(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		if value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("请求失败 (%d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package vector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// MemoryStore 进程内的向量存储，使用余弦相似度线性搜索，适合测试和少量数据
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+// NewMemoryStore 创建进程内的向量存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Upsert 写入记录
+func (s *MemoryStore) Upsert(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		if record.ID == "" {
+			return fmt.Errorf("记录ID不能为空")
+		}
+		s.records[record.ID] = record
+	}
+	return nil
+}
+
+// Search 按余弦相似度搜索
+func (s *MemoryStore) Search(ctx context.Context, vector []float32, limit int, filter map[string]interface{}) ([]Match, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matches []Match
+	for _, record := range s.records {
+		if !matchFilter(record.Metadata, filter) {
+			continue
+		}
+		if len(record.Vector) != len(vector) {
+			return nil, fmt.Errorf("向量维度不一致: 记录 %s 为 %d，查询为 %d", record.ID, len(record.Vector), len(vector))
+		}
+		matches = append(matches, Match{Record: record, Score: cosine(vector, record.Vector)})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// Delete 删除记录
+func (s *MemoryStore) Delete(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.records, id)
+	}
+	return nil
+}
+
+// matchFilter 判断元数据是否包含filter中的所有键值
+func matchFilter(metadata, filter map[string]interface{}) bool {
+	for key, want := range filter {
+		got, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		// JSON数字在不同来源中可能是int或float64，按数值比较
+		if a, ok := toFloat(got); ok {
+			if b, ok := toFloat(want); ok && a == b {
+				continue
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// toFloat 将数值转换为float64
+func toFloat(v interface{}) (float64, bool) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// cosine 计算余弦相似度，任一向量为零向量时为0
+func cosine(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,158 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MilvusConfig Milvus连接配置，使用RESTful v2接口（Milvus 2.4及以上，或Zilliz Cloud）
+type MilvusConfig struct {
+	URL        string       // 服务地址，如http://localhost:19530
+	Token      string       // 认证令牌，为用户名:密码或API密钥，可以为空
+	Database   string       // 数据库名称，为空时使用default
+	Collection string       // 集合名称
+	HTTPClient *http.Client // 为nil时使用http.DefaultClient
+}
+
+// MilvusStore 通过RESTful接口访问Milvus的向量存储
+// 集合需要VarChar类型的主键id、向量字段vector，并开启动态字段保存text和metadata，CreateCollection创建的集合满足要求
+type MilvusStore struct {
+	config MilvusConfig
+}
+
+// NewMilvus 创建Milvus向量存储
+func NewMilvus(config MilvusConfig) (*MilvusStore, error) {
+	if config.URL == "" || config.Collection == "" {
+		return nil, fmt.Errorf("Milvus的URL和Collection不能为空")
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	return &MilvusStore{config: config}, nil
+}
+
+// CreateCollection 创建使用余弦相似度的集合，dimension为向量维度
+func (s *MilvusStore) CreateCollection(ctx context.Context, dimension int) error {
+	return s.do(ctx, "/v2/vectordb/collections/create", map[string]interface{}{
+		"dimension":        dimension,
+		"metricType":       "COSINE",
+		"idType":           "VarChar",
+		"primaryFieldName": "id",
+		"vectorFieldName":  "vector",
+		"params":           map[string]interface{}{"max_length": 512},
+	}, nil)
+}
+
+// Upsert 写入记录
+func (s *MilvusStore) Upsert(ctx context.Context, records []Record) error {
+	data := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		metadata := record.Metadata
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		data = append(data, map[string]interface{}{
+			"id":       record.ID,
+			"vector":   record.Vector,
+			"text":     record.Text,
+			"metadata": metadata,
+		})
+	}
+	return s.do(ctx, "/v2/vectordb/entities/upsert", map[string]interface{}{"data": data}, nil)
+}
+
+// Search 搜索相似记录
+func (s *MilvusStore) Search(ctx context.Context, vector []float32, limit int, filter map[string]interface{}) ([]Match, error) {
+	body := map[string]interface{}{
+		"data":         [][]float32{vector},
+		"annsField":    "vector",
+		"limit":        limit,
+		"outputFields": []string{"id", "text", "metadata"},
+	}
+	if len(filter) > 0 {
+		var conditions []string
+		for key, value := range filter {
+			literal, err := milvusLiteral(value)
+			if err != nil {
+				return nil, fmt.Errorf("过滤条件 %s: %w", key, err)
+			}
+			conditions = append(conditions, fmt.Sprintf("metadata[%s] == %s", strconv.Quote(key), literal))
+		}
+		body["filter"] = strings.Join(conditions, " and ")
+	}
+
+	var results []struct {
+		ID       string                 `json:"id"`
+		Distance float64                `json:"distance"`
+		Text     string                 `json:"text"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if err := s.do(ctx, "/v2/vectordb/entities/search", body, &results); err != nil {
+		return nil, err
+	}
+	matches := make([]Match, 0, len(results))
+	for _, result := range results {
+		matches = append(matches, Match{
+			Record: Record{ID: result.ID, Text: result.Text, Metadata: result.Metadata},
+			Score:  result.Distance, // COSINE度量下distance即余弦相似度
+		})
+	}
+	return matches, nil
+}
+
+// Delete 删除记录
+func (s *MilvusStore) Delete(ctx context.Context, ids []string) error {
+	quoted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		quoted = append(quoted, strconv.Quote(id))
+	}
+	return s.do(ctx, "/v2/vectordb/entities/delete", map[string]interface{}{
+		"filter": "id in [" + strings.Join(quoted, ", ") + "]",
+	}, nil)
+}
+
+// do 请求Milvus接口，Milvus在HTTP状态200时以code字段表示错误
+func (s *MilvusStore) do(ctx context.Context, path string, body map[string]interface{}, out interface{}) error {
+	body["collectionName"] = s.config.Collection
+	if s.config.Database != "" {
+		body["dbName"] = s.config.Database
+	}
+	headers := map[string]string{}
+	if s.config.Token != "" {
+		headers["Authorization"] = "Bearer " + s.config.Token
+	}
+
+	var result struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := doJSON(ctx, s.config.HTTPClient, http.MethodPost, s.config.URL+path, headers, body, &result); err != nil {
+		return fmt.Errorf("Milvus: %w", err)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("Milvus: 错误 %d: %s", result.Code, result.Message)
+	}
+	if out != nil && len(result.Data) > 0 {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return fmt.Errorf("Milvus: 解析响应失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// milvusLiteral 将过滤值转换为Milvus过滤表达式中的字面量
+func milvusLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	if f, ok := toFloat(value); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("只支持字符串、数字和布尔值")
+}
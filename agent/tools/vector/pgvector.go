@@ -0,0 +1,147 @@
+package vector
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// identifierPattern 允许的表名，可以带schema前缀
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PGVectorStore 使用PostgreSQL的pgvector扩展的向量存储，数据库驱动由调用方导入
+// 表包含id（text主键）、embedding（vector）、text（text）和metadata（jsonb）列，CreateTable创建的表满足要求
+type PGVectorStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPGVector 创建pgvector向量存储，table为表名，可以带schema前缀
+func NewPGVector(db *sql.DB, table string) (*PGVectorStore, error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("无效的表名 %q", table)
+	}
+	return &PGVectorStore{db: db, table: table}, nil
+}
+
+// CreateTable 创建vector扩展、表和HNSW余弦索引，dimension为向量维度
+func (s *PGVectorStore) CreateTable(ctx context.Context, dimension int) error {
+	index := strings.ReplaceAll(s.table, ".", "_") + "_embedding_idx"
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS vector",
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id text PRIMARY KEY, embedding vector(%d) NOT NULL, text text NOT NULL, metadata jsonb NOT NULL DEFAULT '{}')", s.table, dimension),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING hnsw (embedding vector_cosine_ops)", index, s.table),
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("pgvector: %w", err)
+		}
+	}
+	return nil
+}
+
+// Upsert 在一个事务中写入记录
+func (s *PGVectorStore) Upsert(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("pgvector: %w", err)
+	}
+	defer tx.Rollback()
+
+	statement := fmt.Sprintf(`INSERT INTO %s (id, embedding, text, metadata) VALUES ($1, $2::vector, $3, $4::jsonb)
+ON CONFLICT (id) DO UPDATE SET embedding = EXCLUDED.embedding, text = EXCLUDED.text, metadata = EXCLUDED.metadata`, s.table)
+	for _, record := range records {
+		metadata, err := marshalMetadata(record.Metadata)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, statement, record.ID, vectorLiteral(record.Vector), record.Text, metadata); err != nil {
+			return fmt.Errorf("pgvector: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("pgvector: %w", err)
+	}
+	return nil
+}
+
+// Search 按余弦距离搜索，Score为1减去余弦距离
+func (s *PGVectorStore) Search(ctx context.Context, vector []float32, limit int, filter map[string]interface{}) ([]Match, error) {
+	args := []interface{}{vectorLiteral(vector)}
+	where := ""
+	if len(filter) > 0 {
+		metadata, err := marshalMetadata(filter)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, metadata)
+		where = " WHERE metadata @> $2::jsonb"
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT id, text, metadata, 1 - (embedding <=> $1::vector) FROM %s%s ORDER BY embedding <=> $1::vector LIMIT $%d",
+		s.table, where, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector: %w", err)
+	}
+	defer rows.Close()
+	var matches []Match
+	for rows.Next() {
+		var match Match
+		var metadata []byte
+		if err := rows.Scan(&match.ID, &match.Text, &metadata, &match.Score); err != nil {
+			return nil, fmt.Errorf("pgvector: %w", err)
+		}
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &match.Metadata); err != nil {
+				return nil, fmt.Errorf("pgvector: 解析metadata失败: %w", err)
+			}
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pgvector: %w", err)
+	}
+	return matches, nil
+}
+
+// Delete 删除记录
+func (s *PGVectorStore) Delete(ctx context.Context, ids []string) error {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", s.table, strings.Join(placeholders, ", "))
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("pgvector: %w", err)
+	}
+	return nil
+}
+
+// vectorLiteral 将向量转换为pgvector的文本格式，如[1,2,3]
+func vectorLiteral(vector []float32) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// marshalMetadata 将元数据序列化为JSON，nil序列化为空对象
+func marshalMetadata(metadata map[string]interface{}) (string, error) {
+	if metadata == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("序列化metadata失败: %w", err)
+	}
+	return string(data), nil
+}
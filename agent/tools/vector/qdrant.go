@@ -0,0 +1,133 @@
+package vector
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// uuidPattern Qdrant接受的UUID格式的点ID
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// QdrantConfig Qdrant连接配置
+type QdrantConfig struct {
+	URL        string       // 服务地址，如http://localhost:6333
+	APIKey     string       // API密钥，可以为空
+	Collection string       // 集合名称
+	HTTPClient *http.Client // 为nil时使用http.DefaultClient
+}
+
+// QdrantStore 通过REST接口访问Qdrant的向量存储
+// Qdrant的点ID只能是无符号整数或UUID，其他ID会转换为由ID派生的UUID，原ID保存在payload的id字段中
+type QdrantStore struct {
+	config QdrantConfig
+}
+
+// NewQdrant 创建Qdrant向量存储
+func NewQdrant(config QdrantConfig) (*QdrantStore, error) {
+	if config.URL == "" || config.Collection == "" {
+		return nil, fmt.Errorf("Qdrant的URL和Collection不能为空")
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	return &QdrantStore{config: config}, nil
+}
+
+// CreateCollection 创建使用余弦距离的集合，dimension为向量维度
+func (s *QdrantStore) CreateCollection(ctx context.Context, dimension int) error {
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{"size": dimension, "distance": "Cosine"},
+	}
+	return s.do(ctx, http.MethodPut, "", body, nil)
+}
+
+// Upsert 写入记录
+func (s *QdrantStore) Upsert(ctx context.Context, records []Record) error {
+	points := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		points = append(points, map[string]interface{}{
+			"id":     qdrantPointID(record.ID),
+			"vector": record.Vector,
+			"payload": map[string]interface{}{
+				"id":       record.ID,
+				"text":     record.Text,
+				"metadata": record.Metadata,
+			},
+		})
+	}
+	return s.do(ctx, http.MethodPut, "/points?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+// Search 搜索相似记录
+func (s *QdrantStore) Search(ctx context.Context, vector []float32, limit int, filter map[string]interface{}) ([]Match, error) {
+	body := map[string]interface{}{"vector": vector, "limit": limit, "with_payload": true}
+	if len(filter) > 0 {
+		var must []map[string]interface{}
+		for key, value := range filter {
+			must = append(must, map[string]interface{}{
+				"key":   "metadata." + key,
+				"match": map[string]interface{}{"value": value},
+			})
+		}
+		body["filter"] = map[string]interface{}{"must": must}
+	}
+
+	var result struct {
+		Result []struct {
+			Score   float64 `json:"score"`
+			Payload struct {
+				ID       string                 `json:"id"`
+				Text     string                 `json:"text"`
+				Metadata map[string]interface{} `json:"metadata"`
+			} `json:"payload"`
+		} `json:"result"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/points/search", body, &result); err != nil {
+		return nil, err
+	}
+	matches := make([]Match, 0, len(result.Result))
+	for _, point := range result.Result {
+		matches = append(matches, Match{
+			Record: Record{ID: point.Payload.ID, Text: point.Payload.Text, Metadata: point.Payload.Metadata},
+			Score:  point.Score,
+		})
+	}
+	return matches, nil
+}
+
+// Delete 删除记录
+func (s *QdrantStore) Delete(ctx context.Context, ids []string) error {
+	points := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		points = append(points, qdrantPointID(id))
+	}
+	return s.do(ctx, http.MethodPost, "/points/delete?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+// do 请求集合下的接口
+func (s *QdrantStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	endpoint := s.config.URL + "/collections/" + url.PathEscape(s.config.Collection) + path
+	headers := map[string]string{"api-key": s.config.APIKey}
+	if err := doJSON(ctx, s.config.HTTPClient, method, endpoint, headers, body, out); err != nil {
+		return fmt.Errorf("Qdrant: %w", err)
+	}
+	return nil
+}
+
+// qdrantPointID 将记录ID转换为Qdrant的点ID：无符号整数和UUID原样使用，其他ID转换为SHA-1派生的UUID
+func qdrantPointID(id string) interface{} {
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return n
+	}
+	if uuidPattern.MatchString(id) {
+		return strings.ToLower(id)
+	}
+	sum := sha1.Sum([]byte(id))
+	sum[6] = sum[6]&0x0f | 0x50 // 版本5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122变体
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,198 @@
+// Package vector 提供向量存储的统一接口和Qdrant、Milvus、pgvector、内存四种实现，
+// 并将存储注册为对话工具（memory_upsert、memory_search和memory_delete），让模型可以保存和检索语义记忆
+package vector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ccIisIaIcat/GoAgent/agent/ConversationManager"
+)
+
+// Record 一条向量记录
+type Record struct {
+	ID       string                 `json:"id"`
+	Vector   []float32              `json:"-"`
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Match 一条搜索结果
+type Match struct {
+	Record
+	Score float64 `json:"score"` // 相似度，越大越相似，余弦相似度的范围为-1到1
+}
+
+// Store 向量存储
+type Store interface {
+	// Upsert 写入记录，ID已存在时覆盖
+	Upsert(ctx context.Context, records []Record) error
+	// Search 返回与vector最相似的最多limit条记录，filter不为空时只返回元数据中对应键值都相等的记录
+	Search(ctx context.Context, vector []float32, limit int, filter map[string]interface{}) ([]Match, error)
+	// Delete 删除记录，不存在的ID被忽略
+	Delete(ctx context.Context, ids []string) error
+}
+
+// Config 向量记忆工具的配置
+type Config struct {
+	Limit   int           // 搜索默认返回的记录数，为0时为5
+	Timeout time.Duration // 每次工具调用的超时时间，为0时为30秒
+	Prefix  string        // 工具名称前缀
+	Group   string        // 工具加入的工具组，为空时不分组
+}
+
+// Toolkit 向量记忆工具，写入和搜索时用embedder将文本转换为向量
+type Toolkit struct {
+	store    Store
+	embedder Embedder
+	config   Config
+}
+
+// New 创建向量记忆工具，config为nil时使用默认配置
+func New(store Store, embedder Embedder, config *Config) *Toolkit {
+	t := &Toolkit{store: store, embedder: embedder}
+	if config != nil {
+		t.config = *config
+	}
+	if t.config.Limit <= 0 {
+		t.config.Limit = 5
+	}
+	if t.config.Timeout <= 0 {
+		t.config.Timeout = 30 * time.Second
+	}
+	return t
+}
+
+// Register 将memory_upsert、memory_search和memory_delete工具注册到cm，返回注册的工具名称
+func (t *Toolkit) Register(cm *ConversationManager.ConversationManager) ([]string, error) {
+	var registered []string
+	register := func(name, description string, fn interface{}, paramNames, paramDescriptions []string) error {
+		name = t.config.Prefix + name
+		if err := cm.RegisterFunction(name, description, fn, paramNames, paramDescriptions); err != nil {
+			return fmt.Errorf("注册工具 %s 失败: %w", name, err)
+		}
+		registered = append(registered, name)
+		return nil
+	}
+
+	if err := register("memory_upsert", "将一段文本保存到长期记忆中，之后可以按语义搜索。ID已存在时覆盖原有内容", t.Upsert,
+		[]string{"id", "text", "metadata"},
+		[]string{"记忆的ID，为空时自动生成，更新已有记忆时传入原ID", "要保存的文本", "附加的元数据（如来源、分类），可以为空"}); err != nil {
+		return registered, err
+	}
+	if err := register("memory_search", "按语义在长期记忆中搜索与查询最相关的文本", t.Search,
+		[]string{"query", "limit", "filter"},
+		[]string{"查询文本", fmt.Sprintf("最多返回的记录数，默认%d", t.config.Limit), "只返回元数据中这些键值都相等的记录，可以为空"}); err != nil {
+		return registered, err
+	}
+	if err := register("memory_delete", "从长期记忆中删除记录", t.Delete,
+		[]string{"ids"},
+		[]string{"要删除的记忆ID列表"}); err != nil {
+		return registered, err
+	}
+
+	if t.config.Group != "" {
+		if err := cm.AddToolsToGroup(t.config.Group, registered...); err != nil {
+			return registered, err
+		}
+	}
+	return registered, nil
+}
+
+// Upsert 将文本转换为向量后写入存储，返回记录的ID
+func (t *Toolkit) Upsert(id, text string, metadata map[string]interface{}) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("文本不能为空")
+	}
+	id = strings.TrimSpace(id)
+	if id == "" {
+		id = newID()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.config.Timeout)
+	defer cancel()
+	vectors, err := t.embed(ctx, []string{text})
+	if err != nil {
+		return "", err
+	}
+	record := Record{ID: id, Vector: vectors[0], Text: text, Metadata: metadata}
+	if err := t.store.Upsert(ctx, []Record{record}); err != nil {
+		return "", fmt.Errorf("写入向量存储失败: %w", err)
+	}
+	return fmt.Sprintf("已保存记忆 %s", id), nil
+}
+
+// Search 按语义搜索，以JSON返回匹配的记录和相似度
+func (t *Toolkit) Search(query string, limit int, filter map[string]interface{}) (string, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", fmt.Errorf("查询文本不能为空")
+	}
+	if limit <= 0 {
+		limit = t.config.Limit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.config.Timeout)
+	defer cancel()
+	vectors, err := t.embed(ctx, []string{query})
+	if err != nil {
+		return "", err
+	}
+	matches, err := t.store.Search(ctx, vectors[0], limit, filter)
+	if err != nil {
+		return "", fmt.Errorf("搜索向量存储失败: %w", err)
+	}
+	if len(matches) == 0 {
+		return "没有找到相关的记忆", nil
+	}
+	data, err := json.Marshal(matches)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Delete 删除记录
+func (t *Toolkit) Delete(ids []string) (string, error) {
+	var cleaned []string
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			cleaned = append(cleaned, id)
+		}
+	}
+	if len(cleaned) == 0 {
+		return "", fmt.Errorf("ID列表不能为空")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.config.Timeout)
+	defer cancel()
+	if err := t.store.Delete(ctx, cleaned); err != nil {
+		return "", fmt.Errorf("删除记忆失败: %w", err)
+	}
+	return fmt.Sprintf("已删除 %d 条记忆", len(cleaned)), nil
+}
+
+// embed 将文本转换为向量并检查数量
+func (t *Toolkit) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := t.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("生成向量失败: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("生成向量失败: 期望 %d 个向量，得到 %d 个", len(texts), len(vectors))
+	}
+	return vectors, nil
+}
+
+// newID 生成随机的记录ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
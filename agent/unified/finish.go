@@ -0,0 +1,12 @@
+package unified
+
+// FinishReason 归一化后的结束原因
+type FinishReason string
+
+const (
+	FinishReasonStop          FinishReason = "stop"           // 正常结束
+	FinishReasonLength        FinishReason = "length"         // 达到最大token数
+	FinishReasonToolCalls     FinishReason = "tool_calls"     // 需要调用工具
+	FinishReasonContentFilter FinishReason = "content_filter" // 被提供商的安全策略拦截
+	FinishReasonOther         FinishReason = "other"          // 无法识别的结束原因
+)
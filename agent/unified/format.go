@@ -0,0 +1,43 @@
+package unified
+
+// ResponseFormatType 结构化输出类型
+type ResponseFormatType string
+
+const (
+	ResponseFormatText       ResponseFormatType = "text"        // 普通文本
+	ResponseFormatJSONObject ResponseFormatType = "json_object" // 任意JSON对象
+	ResponseFormatJSONSchema ResponseFormatType = "json_schema" // 符合Schema的JSON
+)
+
+// ResponseFormat 结构化输出格式
+// OpenAI使用原生的json_schema，Google使用responseJsonSchema，DeepSeek和Qwen使用json_object并在系统提示词中附上Schema，
+// Anthropic只在系统提示词中说明格式；无论提供商是否原生支持，返回的内容都会在本地校验
+type ResponseFormat struct {
+	Type   ResponseFormatType     `json:"type"`
+	Name   string                 `json:"name,omitempty"`   // json_schema的名称，为空时使用response
+	Schema map[string]interface{} `json:"schema,omitempty"` // json_schema的JSON Schema
+	Strict bool                   `json:"strict,omitempty"` // OpenAI的strict模式
+}
+
+// ConstraintBackend 约束解码参数的格式
+type ConstraintBackend string
+
+const (
+	ConstraintBackendVLLM     ConstraintBackend = "vllm"     // guided_json、guided_regex、guided_grammar、guided_choice
+	ConstraintBackendLlamaCpp ConstraintBackend = "llamacpp" // json_schema、grammar（GBNF）
+)
+
+// GenerationConstraint 约束解码参数，推理服务在采样时只允许符合约束的token，输出保证可以解析
+// 官方OpenAI API不接受这些参数，只用于Type为openai的本地或自建推理服务
+type GenerationConstraint struct {
+	Backend    ConstraintBackend      `json:"backend,omitempty"`     // 为空时使用vllm
+	JSONSchema map[string]interface{} `json:"json_schema,omitempty"` // 输出必须符合的JSON Schema
+	Regex      string                 `json:"regex,omitempty"`       // 输出必须匹配的正则表达式，仅vLLM
+	Grammar    string                 `json:"grammar,omitempty"`     // 语法，vLLM为EBNF，llama.cpp为GBNF
+	Choice     []string               `json:"choice,omitempty"`      // 输出只能是其中之一，仅vLLM
+}
+
+// Structured 判断请求是否需要结构化输出
+func (f *ResponseFormat) Structured() bool {
+	return f != nil && (f.Type == ResponseFormatJSONObject || f.Type == ResponseFormatJSONSchema)
+}
@@ -0,0 +1,235 @@
+// Package unified 定义各提供商共用的统一请求和响应结构，不依赖项目中的其他包，
+// 提供商的converter直接转换这些结构，general包以类型别名的形式导出
+package unified
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MessageRole 定义消息角色类型
+type MessageRole string
+
+const (
+	RoleSystem    MessageRole = "system"
+	RoleUser      MessageRole = "user"
+	RoleAssistant MessageRole = "assistant"
+	RoleTool      MessageRole = "tool"
+)
+
+// ContentType 定义内容类型
+type ContentType string
+
+const (
+	ContentTypeText     ContentType = "text"
+	ContentTypeImageURL ContentType = "image_url"
+	ContentTypeImageB64 ContentType = "image_base64"
+	ContentTypeTool     ContentType = "tool_call"
+	ContentTypeToolRes  ContentType = "tool_result"
+	ContentTypeAudio    ContentType = "audio"
+	ContentTypeDocument ContentType = "document"
+)
+
+// ImageDetail 定义图片详细程度
+type ImageDetail string
+
+const (
+	DetailLow  ImageDetail = "low"
+	DetailHigh ImageDetail = "high"
+	DetailAuto ImageDetail = "auto"
+)
+
+// Content 统一内容结构
+type Content struct {
+	Type     ContentType `json:"type"`
+	Text     string      `json:"text,omitempty"`
+	ImageURL *ImageURL   `json:"image_url,omitempty"`
+	ToolCall *ToolCall   `json:"tool_call,omitempty"`
+	ToolID   string      `json:"tool_id,omitempty"`
+	Audio    *Audio      `json:"audio,omitempty"`
+	Document *Document   `json:"document,omitempty"`
+}
+
+// Document 文档内容结构（如PDF）
+type Document struct {
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"` // base64编码的文档数据
+}
+
+// Audio 音频内容结构
+// 模型输出的音频带有ID，多轮对话中通过ID引用；用户输入的音频使用Data和Format
+type Audio struct {
+	ID         string `json:"id,omitempty"`
+	Data       string `json:"data,omitempty"`   // base64编码的音频数据
+	Format     string `json:"format,omitempty"` // 如wav、mp3
+	Transcript string `json:"transcript,omitempty"`
+	ExpiresAt  int64  `json:"expires_at,omitempty"` // 音频ID的过期时间（Unix时间戳）
+}
+
+// AudioOutput 音频输出参数
+type AudioOutput struct {
+	Voice  string `json:"voice"`  // 如alloy、echo、shimmer
+	Format string `json:"format"` // 如wav、mp3、pcm16
+}
+
+// ImageURL 图片URL结构
+type ImageURL struct {
+	URL    string      `json:"url"`
+	Detail ImageDetail `json:"detail,omitempty"`
+}
+
+// Message 统一消息结构
+type Message struct {
+	Role      MessageRole `json:"role"`
+	Content   []Content   `json:"content"`
+	Name      string      `json:"name,omitempty"`
+	ToolCalls []ToolCall  `json:"tool_calls,omitempty"`
+	// ReasoningContent 模型的思考内容（如Qwen3的<think>段），不会作为回答文本发送给提供商
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// ID 消息ID，由ConversationManager在加入历史时生成，用于持久化、去重和界面渲染，不会发送给提供商
+	ID string `json:"id,omitempty"`
+	// CreatedAt 消息的创建时间，由ConversationManager在加入历史时填充，不会发送给提供商
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToolCall 工具调用结构
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"` // "function"
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall 函数调用结构
+type FunctionCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	// RawArguments 模型返回的无法解析为JSON的原始参数，Arguments被修复或替换时保留用于调试，不会发送给提供商
+	RawArguments string `json:"raw_arguments,omitempty"`
+}
+
+// Tool 工具定义结构
+type Tool struct {
+	Type     string             `json:"type"` // "function"
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition 函数定义结构
+type FunctionDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	// Strict 为true时以OpenAI的strict模式发送，参数Schema自动补充additionalProperties:false并将所有属性列为必填（可选属性改为可以为null）
+	// 生成的参数保证符合Schema，其他提供商忽略该字段
+	Strict bool `json:"strict,omitempty"`
+}
+
+// ChatRequest 统一聊天请求结构
+type ChatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Tools       []Tool    `json:"tools,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	// TemperatureSet 为true时Temperature为0也按设置发送，否则0表示未设置，使用默认温度
+	TemperatureSet bool   `json:"temperature_set,omitempty"`
+	Stream         bool   `json:"stream,omitempty"`
+	SystemPrompt   string `json:"system_prompt,omitempty"`
+	// Extensions 提供商特有的扩展参数，由对应提供商的converter合并到请求体中
+	// 例如Qwen的enable_search、enable_thinking、vl_high_resolution_images
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+	// EnableThinking 思考模式开关（如Qwen3的enable_thinking），为nil时使用提供商默认行为
+	EnableThinking *bool `json:"enable_thinking,omitempty"`
+	// PrefixCompletion 将最后一条assistant消息作为回复前缀续写（DeepSeek Beta）
+	PrefixCompletion bool `json:"prefix_completion,omitempty"`
+	// Prefill 回复的开头，模型从这里继续生成，如以"{"开头强制输出JSON
+	// 支持Anthropic（assistant预填充）、DeepSeek（前缀续写）和Qwen（partial模式），返回的回复文本包含Prefill
+	Prefill string `json:"prefill,omitempty"`
+	// Modalities 输出模态，如["text", "audio"]（OpenAI gpt-4o-audio-preview）
+	Modalities []string `json:"modalities,omitempty"`
+	// Audio 音频输出参数，Modalities包含audio时必填
+	Audio *AudioOutput `json:"audio,omitempty"`
+	// IncludeRawResponse 在ChatResponse.RawResponse中保留提供商返回的原始JSON（仅非流式请求）
+	IncludeRawResponse bool `json:"include_raw_response,omitempty"`
+	// TopP 核采样参数，为nil时使用提供商默认值
+	TopP *float64 `json:"top_p,omitempty"`
+	// ProviderOptions 按提供商指定的请求参数，只对对应提供商生效，由converter深度合并到请求体中
+	// 同名字段覆盖统一模型生成的值，值为nil时删除该字段，用于在统一模型支持前使用提供商的新功能
+	ProviderOptions map[Provider]map[string]interface{} `json:"provider_options,omitempty"`
+	// ResponseFormat 结构化输出格式，为nil时输出普通文本
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// StructuredOutputRetries 结构化输出未通过校验时带着校验问题让模型重新回答的最大次数，0表示不重试直接返回StructuredOutputError
+	StructuredOutputRetries int `json:"structured_output_retries,omitempty"`
+	// EmulateTools 为true时以文本模拟函数调用，提供商配置了EmulateTools时总是模拟
+	EmulateTools bool `json:"emulate_tools,omitempty"`
+	// Constraint 约束解码参数，由vLLM、llama.cpp等推理服务在解码时强制输出格式，仅OpenAI客户端发送
+	Constraint *GenerationConstraint `json:"constraint,omitempty"`
+	// StrictTools 为true时以OpenAI的strict模式发送所有工具定义，等同于为每个工具设置FunctionDefinition.Strict
+	StrictTools bool `json:"strict_tools,omitempty"`
+}
+
+// HasTemperature 判断请求是否设置了温度
+func (r *ChatRequest) HasTemperature() bool {
+	return r.TemperatureSet || r.Temperature != 0
+}
+
+// Usage 使用统计结构
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// Extensions 提供商特有的统计项，如DeepSeek的prompt_cache_hit_tokens
+	Extensions map[string]int `json:"extensions,omitempty"`
+}
+
+// Usage扩展统计项名称
+const (
+	UsagePromptCacheHitTokens  = "prompt_cache_hit_tokens"
+	UsagePromptCacheMissTokens = "prompt_cache_miss_tokens"
+)
+
+// Add 将另一次调用的使用量累加到当前统计中
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	for key, value := range other.Extensions {
+		if u.Extensions == nil {
+			u.Extensions = make(map[string]int)
+		}
+		u.Extensions[key] += value
+	}
+}
+
+// ChatResponse 统一聊天响应结构
+type ChatResponse struct {
+	ID      string    `json:"id"`
+	Object  string    `json:"object"`
+	Created time.Time `json:"created"`
+	Model   string    `json:"model"`
+	Choices []Choice  `json:"choices"`
+	Usage   Usage     `json:"usage"`
+	// RawResponse 提供商返回的原始JSON，仅在请求设置了IncludeRawResponse时保留
+	// 用于调试，或读取统一模型尚未覆盖的提供商特有字段
+	RawResponse json.RawMessage `json:"raw_response,omitempty"`
+}
+
+// Choice 选择结构
+type Choice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"` // 提供商返回的原始结束原因
+	// NormalizedFinishReason 归一化后的结束原因，下游逻辑无需关心提供商差异
+	NormalizedFinishReason FinishReason `json:"normalized_finish_reason,omitempty"`
+}
+
+// Provider 定义提供商类型
+type Provider string
+
+const (
+	ProviderOpenAI    Provider = "openai"
+	ProviderAnthropic Provider = "anthropic"
+	ProviderGoogle    Provider = "google"
+	ProviderDeepSeek  Provider = "deepseek"
+	ProviderQwen      Provider = "qwen"
+)